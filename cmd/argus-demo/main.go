@@ -0,0 +1,76 @@
+// Command argus-demo runs the seven example services of test/ in one process and
+// sends them traffic, exporting their traces, metrics and logs to an OtelContext
+// gRPC endpoint. It replaces starting each program in its own terminal.
+//
+//	go run ./cmd/argus-demo
+//	go run ./cmd/argus-demo --chaos-level 3 --rps 50 --duration 5m --endpoint argus:4317
+//	go run ./cmd/argus-demo --rps 0   # serve only; send requests yourself
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/shop"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "localhost:4317", "OTLP gRPC endpoint")
+	host := flag.String("host", "127.0.0.1", "interface the services listen on")
+	basePort := flag.Int("base-port", 9001, "port of order-service; the others follow it as in test/ (0 picks free ports)")
+	chaos := flag.Float64("chaos-level", 1, "failure and latency injection: 0 none, 1 as in test/, 2 twice as often")
+	rps := flag.Float64("rps", 10, "requests per second sent to the services (0 sends none)")
+	duration := flag.Duration("duration", 0, "how long to run (0 runs until interrupted)")
+	metricInterval := flag.Duration("metric-interval", 5*time.Second, "metric export interval")
+	quiet := flag.Bool("quiet", false, "export service logs without printing them")
+	flag.Parse()
+
+	if *chaos < 0 {
+		log.Fatalf("--chaos-level must be >= 0, got %v", *chaos)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	cfg := shop.Config{
+		Endpoint:       *endpoint,
+		Host:           *host,
+		BasePort:       *basePort,
+		ChaosLevel:     *chaos,
+		RPS:            *rps,
+		MetricInterval: *metricInterval,
+	}
+	if *quiet {
+		cfg.LogWriter = io.Discard
+	}
+	topology, err := shop.Start(ctx, cfg)
+	if err != nil {
+		log.Fatalf("failed to start services: %v", err)
+	}
+	fmt.Printf("argus-demo: chaos-level=%v rps=%v endpoint=%s\n", *chaos, *rps, *endpoint)
+	for _, name := range shop.Services {
+		fmt.Printf("  %-21s %s\n", name, topology.URL(name))
+	}
+
+	stats := topology.Drive(ctx)
+	fmt.Printf("argus-demo: sent=%d failed=%d skipped=%d\n", stats.Sent, stats.Failed, stats.Skipped)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := topology.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "shutdown: %v\n", err)
+		os.Exit(1)
+	}
+}
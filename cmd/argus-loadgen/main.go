@@ -0,0 +1,99 @@
+// Command argus-loadgen sends deterministic OTLP traffic to an OtelContext gRPC
+// endpoint, for reproducing ingestion bugs and benchmarking changes.
+//
+//	go run ./cmd/argus-loadgen --profile steady --seed 42 --duration 2m
+//	go run ./cmd/argus-loadgen --profile backpressure --endpoint argus:4317
+//
+// Flags set explicitly override the values of the chosen profile.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/loadgen"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	names := make([]string, 0, len(loadgen.Profiles))
+	for name := range loadgen.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	endpoint := flag.String("endpoint", "localhost:4317", "OTLP gRPC endpoint")
+	profileName := flag.String("profile", "smoke", "traffic profile: "+strings.Join(names, ", "))
+	seed := flag.Uint64("seed", 0, "seed for trace IDs, services, attributes and errors")
+	tps := flag.Float64("tps", 0, "traces per second")
+	duration := flag.Duration("duration", 0, "how long to generate traffic for")
+	spans := flag.Int("spans", 0, "spans per trace")
+	errorRatio := flag.Float64("error-ratio", 0, "share of traces with a failed span (0-1)")
+	logs := flag.Int("logs", 0, "log records per trace")
+	cardinality := flag.Int("cardinality", 0, "distinct values of the user.id attribute")
+	services := flag.Int("services", 0, "number of services")
+	batch := flag.Int("batch", 0, "traces per export request")
+	concurrency := flag.Int("concurrency", 0, "export requests in flight")
+	burst := flag.Bool("burst", false, "send as fast as possible instead of pacing to --tps")
+	flag.Parse()
+
+	p, ok := loadgen.Profiles[*profileName]
+	if !ok {
+		log.Fatalf("unknown profile %q (want one of %s)", *profileName, strings.Join(names, ", "))
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "seed":
+			p.Seed = *seed
+		case "tps":
+			p.TracesPerSec = *tps
+		case "duration":
+			p.Duration = *duration
+		case "spans":
+			p.SpansPerTrace = *spans
+		case "error-ratio":
+			p.ErrorRatio = *errorRatio
+		case "logs":
+			p.LogsPerTrace = *logs
+		case "cardinality":
+			p.AttrCardinality = *cardinality
+		case "services":
+			p.Services = *services
+		case "batch":
+			p.BatchSize = *batch
+		case "concurrency":
+			p.Concurrency = *concurrency
+		case "burst":
+			p.Burst = *burst
+		}
+	})
+
+	conn, err := grpc.NewClient(*endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("failed to connect to %s: %v", *endpoint, err)
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("argus-loadgen: profile=%s seed=%d traces=%d endpoint=%s burst=%v\n",
+		*profileName, p.Seed, p.TotalTraces(), *endpoint, p.Burst)
+	report, err := loadgen.New(conn, p).Run(ctx)
+	report.Print(os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stopped early: %v\n", err)
+		os.Exit(1)
+	}
+	if report.FailedRequests > 0 {
+		os.Exit(2)
+	}
+}
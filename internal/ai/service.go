@@ -14,13 +14,22 @@ import (
 	"github.com/tmc/langchaingo/llms/openai"
 )
 
+// defaultPromptBudget bounds the log text put in a prompt, in bytes. It is well under
+// the ingest body limit: the model needs the gist of the error, not a 64KB payload.
+const defaultPromptBudget = 8 << 10
+
 type Service struct {
 	repo       *storage.Repository
 	llm        llms.Model
 	enabled    bool
 	workQueue  chan storage.Log
 	workerPool int
+	budget     int // bytes of log body and attributes per prompt
 	wg         sync.WaitGroup
+	onInsight  func(l storage.Log, insight string) // called after an insight is persisted
+
+	// suppressAfter unhelpful ratings of an error fingerprint stop its analysis; 0 never does.
+	suppressAfter int
 }
 
 func NewService(repo *storage.Repository) *Service {
@@ -61,18 +70,42 @@ func NewService(repo *storage.Repository) *Service {
 		fmt.Sscanf(wp, "%d", &workerPool)
 	}
 
+	s := newService(repo, llm, queueSize, workerPool)
+	if pb := os.Getenv("AI_PROMPT_MAX_BYTES"); pb != "" {
+		fmt.Sscanf(pb, "%d", &s.budget)
+	}
+	return s
+}
+
+// newService builds an enabled service around the given model and starts its workers.
+func newService(repo *storage.Repository, llm llms.Model, queueSize, workerPool int) *Service {
 	s := &Service{
 		repo:       repo,
 		llm:        llm,
 		enabled:    true,
 		workQueue:  make(chan storage.Log, queueSize),
 		workerPool: workerPool,
+		budget:     defaultPromptBudget,
+
+		suppressAfter: storage.DefaultInsightSuppressAfter,
 	}
 
 	s.startWorkers()
 	return s
 }
 
+// SetInsightCallback sets the function to call after an insight has been saved.
+// The callback runs on an AI worker goroutine and must not block.
+func (s *Service) SetInsightCallback(cb func(l storage.Log, insight string)) {
+	s.onInsight = cb
+}
+
+// SetSuppressAfter sets how many unhelpful ratings of an error's insights stop the
+// analysis of further logs with the same fingerprint. 0 analyzes every error log.
+func (s *Service) SetSuppressAfter(n int) {
+	s.suppressAfter = n
+}
+
 func (s *Service) startWorkers() {
 	for i := 0; i < s.workerPool; i++ {
 		s.wg.Add(1)
@@ -97,8 +130,7 @@ func (s *Service) EnqueueLog(l storage.Log) {
 	if !s.enabled {
 		return
 	}
-	severity := strings.ToUpper(l.Severity)
-	if strings.Contains(severity, "ERROR") || strings.Contains(severity, "CRITICAL") || strings.Contains(severity, "FATAL") {
+	if l.Severity == storage.SeverityError || l.Severity == storage.SeverityFatal {
 		select {
 		case s.workQueue <- l:
 		default:
@@ -107,8 +139,12 @@ func (s *Service) EnqueueLog(l storage.Log) {
 	}
 }
 
-func (s *Service) analyzeLog(ctx context.Context, l storage.Log) {
-	prompt := fmt.Sprintf(`Analyze the following error log and provide a brief, actionable insight (max 2 sentences).
+// buildPrompt asks for an insight on l, keeping its body and attributes within
+// budget bytes: three quarters for the body, the rest for the attributes.
+func buildPrompt(l storage.Log, budget int) string {
+	body, _ := storage.TruncateText(string(l.Body), budget*3/4)
+	attrs, _ := storage.TruncateText(string(l.AttributesJSON), budget/4)
+	return fmt.Sprintf(`Analyze the following error log and provide a brief, actionable insight (max 2 sentences).
 	
 	Service: %s
 	Timestamp: %s
@@ -116,7 +152,14 @@ func (s *Service) analyzeLog(ctx context.Context, l storage.Log) {
 	Body: %s
 	Attributes: %s
 	
-	Insight:`, l.ServiceName, l.Timestamp, l.Severity, l.Body, l.AttributesJSON)
+	Insight:`, l.ServiceName, l.Timestamp, l.Severity, body, attrs)
+}
+
+func (s *Service) analyzeLog(ctx context.Context, l storage.Log) {
+	if s.suppressed(l) {
+		return
+	}
+	prompt := buildPrompt(l, s.budget)
 
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -134,5 +177,25 @@ func (s *Service) analyzeLog(ctx context.Context, l storage.Log) {
 
 	if err := s.repo.UpdateLogInsight(l.ID, insight); err != nil {
 		log.Printf("Failed to save AI insight for log %d: %v", l.ID, err)
+		return
+	}
+
+	if s.onInsight != nil {
+		s.onInsight(l, insight)
+	}
+}
+
+// suppressed reports whether the insights on errors like l were rated unhelpful
+// often enough to stop analyzing them. A failed lookup does not suppress.
+func (s *Service) suppressed(l storage.Log) bool {
+	if s.suppressAfter <= 0 {
+		return false
+	}
+	fp := storage.ErrorFingerprint(l.ServiceName, string(l.Body))
+	sup, err := s.repo.ForTenant(l.TenantID).GetInsightSuppression(fp, s.suppressAfter)
+	if err != nil {
+		log.Printf("Failed to check insight suppression for log %d: %v", l.ID, err)
+		return false
 	}
+	return sup.Suppressed
 }
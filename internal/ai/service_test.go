@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/realtime"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"github.com/coder/websocket"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// fakeLLM returns a fixed completion for every prompt.
+type fakeLLM struct{ reply string }
+
+func (f fakeLLM) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: f.reply}}}, nil
+}
+
+func (f fakeLLM) Call(_ context.Context, _ string, _ ...llms.CallOption) (string, error) {
+	return f.reply, nil
+}
+
+func TestInsightCallbackBroadcast(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "ai.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	defer repo.Close()
+
+	logs := []storage.Log{{TraceID: "abc123", ServiceName: "checkout", Severity: "ERROR", Body: "db timeout", Timestamp: time.Now()}}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatalf("BatchCreateLogs() error = %v", err)
+	}
+
+	// A live client of the tenant, subscribed to the log's service, as main wires it
+	hub := realtime.NewEventHub(repo, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Start(ctx, time.Hour, 10*time.Millisecond)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.HandleWebSocket(w, r.WithContext(tenant.NewContext(r.Context(), tenant.Identity{Tenant: logs[0].TenantID})))
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"?service=checkout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	readCtx, cancelRead := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelRead()
+	if _, _, err := conn.Read(readCtx); err != nil { // the initial live snapshot
+		t.Fatal(err)
+	}
+
+	svc := newService(repo, fakeLLM{reply: "  Increase the pool size.  "}, 10, 1)
+	svc.SetInsightCallback(hub.BroadcastLogInsight)
+	svc.EnqueueLog(logs[0])
+
+	_, data, err := conn.Read(readCtx)
+	if err != nil {
+		t.Fatalf("waiting for the insight: %v", err)
+	}
+	svc.Stop()
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"type":         "ai_insight",
+		"log_id":       float64(logs[0].ID),
+		"trace_id":     "abc123",
+		"service_name": "checkout",
+		"insight":      "Increase the pool size.",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("payload[%q] = %v, want %v", k, got[k], v)
+		}
+	}
+
+	saved, err := repo.GetLog(logs[0].ID)
+	if err != nil {
+		t.Fatalf("GetLog() error = %v", err)
+	}
+	if string(saved.AIInsight) != "Increase the pool size." {
+		t.Errorf("persisted insight = %q", saved.AIInsight)
+	}
+}
+
+func TestBuildPromptClampsLogText(t *testing.T) {
+	l := storage.Log{
+		ServiceName:    "checkout",
+		Severity:       "ERROR",
+		Body:           storage.CompressedText(strings.Repeat("b", 10000)),
+		AttributesJSON: storage.CompressedText(strings.Repeat("a", 10000)),
+	}
+	prompt := buildPrompt(l, 400)
+	if !strings.Contains(prompt, strings.Repeat("b", 300)) || strings.Contains(prompt, strings.Repeat("b", 301)) {
+		t.Errorf("prompt does not hold exactly 300 body bytes")
+	}
+	if !strings.Contains(prompt, strings.Repeat("a", 100)) || strings.Contains(prompt, strings.Repeat("a", 101)) {
+		t.Errorf("prompt does not hold exactly 100 attribute bytes")
+	}
+	if !strings.Contains(prompt, "[truncated 9700 bytes]") || !strings.Contains(prompt, "[truncated 9900 bytes]") {
+		t.Errorf("prompt lacks the truncation markers")
+	}
+
+	l.Body = "db timeout"
+	if prompt := buildPrompt(l, 400); !strings.Contains(prompt, "Body: db timeout\n") {
+		t.Errorf("short body altered:\n%s", prompt)
+	}
+}
+
+func TestSuppressedLogSkipped(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "ai.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	defer repo.Close()
+
+	logs := []storage.Log{
+		{ServiceName: "checkout", Severity: "ERROR", Body: "db timeout after 30s", Timestamp: time.Now()},
+		{ServiceName: "checkout", Severity: "ERROR", Body: "db timeout after 45s", Timestamp: time.Now()},
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatalf("BatchCreateLogs() error = %v", err)
+	}
+	if err := repo.CreateInsightFeedback(&storage.InsightFeedback{LogID: logs[0].ID, Rating: storage.InsightUnhelpful}); err != nil {
+		t.Fatalf("CreateInsightFeedback() error = %v", err)
+	}
+
+	svc := newService(repo, fakeLLM{reply: "Increase the pool size."}, 10, 1)
+	svc.SetSuppressAfter(1)
+	svc.analyzeLog(context.Background(), logs[1])
+	svc.Stop()
+
+	saved, err := repo.GetLog(logs[1].ID)
+	if err != nil {
+		t.Fatalf("GetLog() error = %v", err)
+	}
+	if saved.AIInsight != "" {
+		t.Errorf("insight = %q, want none for a suppressed error", saved.AIInsight)
+	}
+}
@@ -0,0 +1,264 @@
+// Package anomaly flags services whose request rate or error rate departs from their
+// own recent behaviour, without user-defined thresholds. Every evaluation interval the
+// detector folds each service's traffic into a rolling baseline (EWMA mean and
+// variance) and records an AnomalyEvent once a signal has deviated by more than K
+// standard deviations for M consecutive intervals.
+package anomaly
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// Signals evaluated per service.
+const (
+	SignalRequestRate = "request_rate" // requests per minute
+	SignalErrorRate   = "error_rate"   // failed share of requests, 0-1
+)
+
+const (
+	// ewmaAlpha weights the newest interval in the baseline; 0.1 gives roughly a
+	// ten-interval memory.
+	ewmaAlpha = 0.1
+
+	// minErrorRateRequests is the traffic an interval needs before its error rate is
+	// meaningful; quieter intervals neither update nor test the error baseline.
+	minErrorRateRequests = 20
+
+	// minErrorRate keeps the error-rate noise floor above zero for services that
+	// have never failed, so a single failure does not read as infinite sigma.
+	minErrorRate = 0.01
+
+	// eventRetention is how long anomaly events are kept.
+	eventRetention = 7 * 24 * time.Hour
+)
+
+// Config holds the detector's sensitivity.
+type Config struct {
+	Sigma       float64 // K: deviation in standard deviations
+	Consecutive int     // M: deviating intervals in a row before an event fires
+	MinSamples  int     // baseline intervals required before a signal is evaluated
+}
+
+// DefaultConfig returns the default sensitivity: 3 sigma for 3 intervals after 15
+// intervals of history.
+func DefaultConfig() Config {
+	return Config{Sigma: 3, Consecutive: 3, MinSamples: 15}
+}
+
+// baseline is the rolling mean and variance of one signal plus its deviation streak.
+type baseline struct {
+	mean     float64
+	variance float64
+	samples  int
+	streak   int // consecutive deviating intervals; negative for drops
+}
+
+// observation is the outcome of testing one value against a baseline.
+type observation struct {
+	mean   float64
+	stddev float64
+	sigma  float64
+	streak int
+	fire   bool
+}
+
+// observe tests x against the baseline (once it has enough samples) and then folds x
+// into it. stddevFloor is the smallest standard deviation the signal is assumed to
+// have given its volume, which keeps sparse or perfectly steady series quiet.
+func (b *baseline) observe(x, stddevFloor float64, cfg Config) observation {
+	obs := observation{mean: b.mean}
+	if b.samples >= cfg.MinSamples {
+		obs.stddev = math.Max(math.Sqrt(b.variance), stddevFloor)
+		if obs.stddev > 0 {
+			obs.sigma = (x - b.mean) / obs.stddev
+		}
+		switch {
+		case obs.sigma > cfg.Sigma:
+			b.streak = max(b.streak, 0) + 1
+		case obs.sigma < -cfg.Sigma:
+			b.streak = min(b.streak, 0) - 1
+		default:
+			b.streak = 0
+		}
+		obs.streak = b.streak
+		obs.fire = abs(b.streak) == cfg.Consecutive
+	}
+
+	// Hold the baseline while a deviation is still being confirmed, so the outlier
+	// does not dilute the baseline it is tested against. Once the episode has fired,
+	// keep learning so a lasting level shift becomes the new normal.
+	if b.streak != 0 && abs(b.streak) < cfg.Consecutive {
+		return obs
+	}
+
+	if b.samples == 0 {
+		b.mean = x
+	} else {
+		diff := x - b.mean
+		incr := ewmaAlpha * diff
+		b.mean += incr
+		b.variance = (1 - ewmaAlpha) * (b.variance + diff*incr)
+	}
+	b.samples++
+	return obs
+}
+
+// serviceBaselines holds the baselines of one service.
+type serviceBaselines struct {
+	requests baseline // requests per interval
+	errors   baseline // error share per interval
+}
+
+// Detector periodically evaluates per-service traffic against rolling baselines.
+type Detector struct {
+	repo     storage.AnomalyStore
+	interval time.Duration
+	cfg      Config
+
+	mu        sync.Mutex
+	baselines map[string]*serviceBaselines
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates a detector that evaluates every interval.
+func New(repo storage.AnomalyStore, interval time.Duration, cfg Config) *Detector {
+	return &Detector{
+		repo:      repo,
+		interval:  interval,
+		cfg:       cfg,
+		baselines: make(map[string]*serviceBaselines),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start runs the evaluation loop. Blocks until ctx is cancelled or Stop is called.
+func (d *Detector) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			d.EvaluateOnce()
+		}
+	}
+}
+
+// Stop terminates the evaluation loop.
+func (d *Detector) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+	})
+}
+
+// EvaluateOnce evaluates the interval ending now and returns the recorded events.
+func (d *Detector) EvaluateOnce() []storage.AnomalyEvent {
+	now := time.Now()
+	traffic, err := d.repo.GetServiceTraffic(now.Add(-d.interval), now)
+	if err != nil {
+		slog.Error("Anomaly: failed to get service traffic", "error", err)
+		return nil
+	}
+
+	events := d.evaluate(traffic, now)
+	for i := range events {
+		ev := &events[i]
+		if err := d.repo.CreateAnomalyEvent(ev); err != nil {
+			slog.Error("Anomaly: failed to persist event", "service", ev.ServiceName, "signal", ev.Signal, "error", err)
+		}
+		slog.Warn("📉 Anomaly detected",
+			"service", ev.ServiceName, "signal", ev.Signal, "value", ev.Value,
+			"baseline_mean", ev.BaselineMean, "sigma", ev.Sigma, "intervals", ev.Intervals)
+	}
+
+	if _, err := d.repo.PruneAnomalyEvents(now.Add(-eventRetention)); err != nil {
+		slog.Error("Anomaly: failed to prune events", "error", err)
+	}
+	return events
+}
+
+// evaluate folds one interval of traffic into the baselines and returns the events
+// that fired. Services with a baseline but no traffic this interval count as zero
+// requests, so an outage registers as a request-rate drop.
+func (d *Detector) evaluate(traffic []storage.ServiceTraffic, now time.Time) []storage.AnomalyEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seen := make(map[string]bool, len(traffic))
+	for _, t := range traffic {
+		seen[t.ServiceName] = true
+	}
+	for service := range d.baselines {
+		if !seen[service] {
+			traffic = append(traffic, storage.ServiceTraffic{ServiceName: service})
+		}
+	}
+
+	perMinute := time.Minute.Seconds() / d.interval.Seconds()
+	var events []storage.AnomalyEvent
+	for _, t := range traffic {
+		sb, ok := d.baselines[t.ServiceName]
+		if !ok {
+			sb = &serviceBaselines{}
+			d.baselines[t.ServiceName] = sb
+		}
+
+		// Request counts are roughly Poisson: variance equals the mean.
+		count := float64(t.Count)
+		obs := sb.requests.observe(count, math.Sqrt(math.Max(sb.requests.mean, 1)), d.cfg)
+		if obs.fire {
+			events = append(events, d.event(t, SignalRequestRate, count*perMinute, obs, perMinute, now))
+		}
+
+		if t.Count < minErrorRateRequests {
+			sb.errors.streak = 0
+			continue
+		}
+		// Error shares are binomial: variance p(1-p)/n.
+		rate := float64(t.ErrorCount) / count
+		p := math.Max(sb.errors.mean, minErrorRate)
+		obs = sb.errors.observe(rate, math.Sqrt(p*(1-p)/count), d.cfg)
+		if obs.fire {
+			events = append(events, d.event(t, SignalErrorRate, rate, obs, 1, now))
+		}
+	}
+	return events
+}
+
+// event builds an AnomalyEvent; scale converts baseline units into the signal's units.
+func (d *Detector) event(t storage.ServiceTraffic, signal string, value float64, obs observation, scale float64, now time.Time) storage.AnomalyEvent {
+	return storage.AnomalyEvent{
+		ServiceName:    t.ServiceName,
+		Signal:         signal,
+		Value:          round(value),
+		BaselineMean:   round(obs.mean * scale),
+		BaselineStdDev: round(obs.stddev * scale),
+		Sigma:          round(obs.sigma),
+		Intervals:      abs(obs.streak),
+		SampleCount:    t.Count,
+		DetectedAt:     now,
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,145 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func newTestDetector() *Detector {
+	return New(nil, time.Minute, DefaultConfig())
+}
+
+// feed runs one evaluation per interval and returns every event that fired.
+func feed(d *Detector, intervals ...[]storage.ServiceTraffic) []storage.AnomalyEvent {
+	var events []storage.AnomalyEvent
+	now := time.Now()
+	for i, traffic := range intervals {
+		events = append(events, d.evaluate(traffic, now.Add(time.Duration(i)*time.Minute))...)
+	}
+	return events
+}
+
+func steady(service string, n int, count, errors func(i int) int64) [][]storage.ServiceTraffic {
+	out := make([][]storage.ServiceTraffic, n)
+	for i := range out {
+		out[i] = []storage.ServiceTraffic{{ServiceName: service, Count: count(i), ErrorCount: errors(i)}}
+	}
+	return out
+}
+
+func wobble(base int64) func(int) int64 {
+	return func(i int) int64 { return base + int64(i%5) - 2 }
+}
+
+func none(int) int64 { return 0 }
+
+func TestRequestRateSpikeFiresAfterConsecutiveIntervals(t *testing.T) {
+	d := newTestDetector()
+	history := steady("checkout", 30, wobble(100), none)
+	if events := feed(d, history...); len(events) != 0 {
+		t.Fatalf("steady traffic fired %d events", len(events))
+	}
+
+	spike := steady("checkout", 3, func(int) int64 { return 300 }, none)
+	if events := feed(d, spike[:2]...); len(events) != 0 {
+		t.Fatalf("fired after %d deviating intervals, want %d", 2, DefaultConfig().Consecutive)
+	}
+	events := feed(d, spike[2])
+	if len(events) != 1 {
+		t.Fatalf("got %d events on the third deviating interval, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Signal != SignalRequestRate || ev.ServiceName != "checkout" || ev.Intervals != 3 || ev.Value != 300 {
+		t.Errorf("event = %+v", ev)
+	}
+	if ev.BaselineMean < 100 || ev.BaselineMean > 200 || ev.BaselineStdDev <= 0 || ev.Sigma <= 3 {
+		t.Errorf("baseline in event = mean %v stddev %v sigma %v", ev.BaselineMean, ev.BaselineStdDev, ev.Sigma)
+	}
+
+	// The same episode does not fire again.
+	if events := feed(d, steady("checkout", 2, func(int) int64 { return 300 }, none)...); len(events) != 0 {
+		t.Errorf("ongoing episode fired again: %+v", events)
+	}
+}
+
+func TestRequestRateDropAndOutage(t *testing.T) {
+	d := newTestDetector()
+	feed(d, steady("payments", 30, wobble(200), none)...)
+
+	// The service disappears from the traffic query entirely.
+	events := feed(d, nil, nil, nil)
+	if len(events) != 1 || events[0].Signal != SignalRequestRate || events[0].Sigma >= 0 || events[0].Value != 0 {
+		t.Fatalf("outage events = %+v, want one request-rate drop", events)
+	}
+}
+
+func TestErrorRateSpike(t *testing.T) {
+	d := newTestDetector()
+	feed(d, steady("checkout", 30, wobble(200), func(i int) int64 { return int64(i % 3) })...)
+
+	events := feed(d, steady("checkout", 3, func(int) int64 { return 200 }, func(int) int64 { return 60 })...)
+	if len(events) != 1 || events[0].Signal != SignalErrorRate {
+		t.Fatalf("events = %+v, want one error-rate event", events)
+	}
+	if ev := events[0]; ev.Value != 0.3 || ev.BaselineMean > 0.02 || ev.SampleCount != 200 {
+		t.Errorf("event = %+v", ev)
+	}
+}
+
+func TestSparseServiceDoesNotFire(t *testing.T) {
+	d := newTestDetector()
+	// A batch job: mostly idle, occasionally a handful of requests, sometimes failing.
+	counts := []int64{0, 0, 1, 0, 3, 0, 0, 2, 0, 1, 0, 0, 4, 0, 1}
+	traffic := steady("batch", 300, func(i int) int64 { return counts[i%len(counts)] }, func(i int) int64 {
+		if counts[i%len(counts)] > 2 {
+			return 1
+		}
+		return 0
+	})
+	if events := feed(d, traffic...); len(events) != 0 {
+		t.Errorf("sparse service fired %d events, first: %+v", len(events), events[0])
+	}
+}
+
+func TestMinSamplesSuppressesYoungBaselines(t *testing.T) {
+	d := New(nil, time.Minute, Config{Sigma: 3, Consecutive: 1, MinSamples: 10})
+	traffic := steady("new-service", 5, wobble(50), none)
+	traffic = append(traffic, []storage.ServiceTraffic{{ServiceName: "new-service", Count: 5000}})
+	if events := feed(d, traffic...); len(events) != 0 {
+		t.Errorf("fired before the baseline had MinSamples intervals: %+v", events)
+	}
+}
+
+// memStore serves one interval of traffic per call and keeps the recorded events.
+type memStore struct {
+	traffic [][]storage.ServiceTraffic
+	events  []storage.AnomalyEvent
+}
+
+func (m *memStore) GetServiceTraffic(start, end time.Time) ([]storage.ServiceTraffic, error) {
+	next := m.traffic[0]
+	m.traffic = m.traffic[1:]
+	return next, nil
+}
+
+func (m *memStore) CreateAnomalyEvent(ev *storage.AnomalyEvent) error {
+	m.events = append(m.events, *ev)
+	return nil
+}
+
+func (m *memStore) PruneAnomalyEvents(olderThan time.Time) (int64, error) { return 0, nil }
+
+func TestEvaluateOnceRecordsEvents(t *testing.T) {
+	store := &memStore{traffic: steady("checkout", 30, wobble(100), none)}
+	store.traffic = append(store.traffic, []storage.ServiceTraffic{{ServiceName: "checkout", Count: 5000}})
+	d := New(store, time.Minute, Config{Sigma: 3, Consecutive: 1, MinSamples: 10})
+	var returned []storage.AnomalyEvent
+	for len(store.traffic) > 0 {
+		returned = append(returned, d.EvaluateOnce()...)
+	}
+	if len(store.events) != 1 || len(returned) != 1 || store.events[0].ServiceName != "checkout" {
+		t.Errorf("recorded %+v, returned %+v; want the one spike of checkout", store.events, returned)
+	}
+}
@@ -2,25 +2,56 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/archive"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
 )
 
 // handleGetStats handles GET /api/stats
 func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := s.repo.GetStats()
+	stats, err := s.store(r).GetStats()
 	if err != nil {
-		slog.Error("Failed to get DB stats", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to get DB stats", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
 
+// handleGetVersion handles GET /api/version
+func (s *Server) handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.build)
+}
+
+// SetDraining marks the server as shutting down, so load balancers stop sending it
+// traffic before the listeners close.
+func (s *Server) SetDraining() {
+	s.draining.Store(true)
+}
+
+// handleReady handles GET /api/ready
+// 200 while the server accepts traffic, 503 once shutdown has begun.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeUnavailable(w, "shutting down")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
+
 // handlePurge handles DELETE /api/admin/purge
+//
+// With a purge worker set, a purge of more than purgeSyncMax rows is queued as a
+// background job instead: the response is 202 with the job and its status URL in
+// the Location header.
 func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
 	// Default: purge data older than 7 days
 	days := 7
@@ -32,21 +63,32 @@ func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
 
 	cutoff := time.Now().AddDate(0, 0, -days)
 
-	logsDeleted, err := s.repo.PurgeLogs(cutoff)
+	if s.purger != nil {
+		n, err := s.store(r).CountPurgeable(cutoff)
+		if err != nil {
+			writeInternalError(w, "Failed to count purgeable rows", err, "cutoff", cutoff)
+			return
+		}
+		if n > s.purgeSyncMax {
+			s.startPurgeJob(w, r, cutoff, n)
+			return
+		}
+	}
+
+	logsDeleted, err := s.store(r).PurgeLogs(cutoff)
 	if err != nil {
-		slog.Error("Failed to purge logs", "cutoff", cutoff, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to purge logs", err, "cutoff", cutoff)
 		return
 	}
 
-	tracesDeleted, err := s.repo.PurgeTraces(cutoff)
+	tracesDeleted, err := s.store(r).PurgeTraces(cutoff)
 	if err != nil {
-		slog.Error("Failed to purge traces", "cutoff", cutoff, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to purge traces", err, "cutoff", cutoff)
 		return
 	}
 
 	slog.Info("Admin purge completed", "days", days, "logs_purged", logsDeleted, "traces_purged", tracesDeleted)
+	auditRows(r, logsDeleted+tracesDeleted)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -56,13 +98,333 @@ func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// startPurgeJob queues a purge of the n rows older than cutoff and answers 202.
+func (s *Server) startPurgeJob(w http.ResponseWriter, r *http.Request, cutoff time.Time, n int64) {
+	job, err := s.store(r).CreatePurgeJob(cutoff)
+	if err != nil {
+		writeInternalError(w, "Failed to create purge job", err, "cutoff", cutoff)
+		return
+	}
+	s.purger.Notify()
+	slog.Warn("Admin purge queued", "job_id", job.ID, "cutoff", cutoff, "rows", n, "remote_addr", r.RemoteAddr)
+
+	id := strconv.FormatUint(uint64(job.ID), 10)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/admin/purge/"+id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// purgeJobID parses the {id} of a purge job route, answering 400 when it is invalid.
+func purgeJobID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil || id == 0 {
+		writeBadRequest(w, "invalid id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// handleGetPurgeJob handles GET /api/admin/purge/{id}
+func (s *Server) handleGetPurgeJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := purgeJobID(w, r)
+	if !ok {
+		return
+	}
+	job, err := s.store(r).GetPurgeJob(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "purge job not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "Failed to get purge job", err, "id", id)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCancelPurgeJob handles DELETE /api/admin/purge/{id}
+// The job stops after its current batch; what it already deleted stays deleted.
+func (s *Server) handleCancelPurgeJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := purgeJobID(w, r)
+	if !ok {
+		return
+	}
+	job, err := s.store(r).CancelPurgeJob(id)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeNotFound(w, "purge job not found")
+		return
+	case errors.Is(err, storage.ErrPurgeJobFinished):
+		writeError(w, http.StatusConflict, ErrCodeConflict, "purge job already finished", job)
+		return
+	case err != nil:
+		writeInternalError(w, "Failed to cancel purge job", err, "id", id)
+		return
+	}
+	auditRows(r, job.LogsPurged+job.TracesPurged)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handlePurgeService handles DELETE /api/admin/data?service=foo&before=<RFC3339>
+func (s *Server) handlePurgeService(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		writeBadRequest(w, "service parameter is required")
+		return
+	}
+
+	var before time.Time
+	if b := r.URL.Query().Get("before"); b != "" {
+		t, err := time.Parse(time.RFC3339, b)
+		if err != nil {
+			writeBadRequest(w, "invalid before parameter (expected RFC3339)")
+			return
+		}
+		before = t
+	}
+
+	slog.Warn("Admin service purge requested", "service", service, "before", before, "remote_addr", r.RemoteAddr)
+
+	result, err := s.store(r).PurgeService(service, before)
+	if err != nil {
+		writeInternalError(w, "Failed to purge service data", err, "service", service)
+		return
+	}
+	auditRows(r, result.Traces+result.Spans+result.Logs+result.MetricBuckets)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service": service,
+		"before":  before,
+		"deleted": result,
+	})
+}
+
+// handleRemapService handles POST /api/admin/remap-service
+// Body: {"from": "payments", "to": "payment-service"}
+func (s *Server) handleRemapService(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" || req.To == "" {
+		writeBadRequest(w, "request body must be JSON with 'from' and 'to' fields")
+		return
+	}
+	if req.From == req.To {
+		writeBadRequest(w, "'from' and 'to' must differ")
+		return
+	}
+
+	slog.Warn("Admin service remap requested", "from", req.From, "to", req.To, "remote_addr", r.RemoteAddr)
+
+	result, err := s.store(r).RemapService(req.From, req.To)
+	if err != nil {
+		writeInternalError(w, "Failed to remap service", err, "from", req.From, "to", req.To)
+		return
+	}
+	auditRows(r, result.Traces+result.Spans+result.Logs+result.MetricBuckets)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    req.From,
+		"to":      req.To,
+		"updated": result,
+	})
+}
+
 // handleVacuum handles POST /api/admin/vacuum
 func (s *Server) handleVacuum(w http.ResponseWriter, _ *http.Request) {
 	if err := s.repo.VacuumDB(); err != nil {
-		slog.Error("Failed to vacuum database", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to vacuum database", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "vacuumed"})
 }
+
+// handleGetIndexes handles GET /api/admin/indexes
+// Lists the indexes of every table; "missing" holds the expected ones not found.
+func (s *Server) handleGetIndexes(w http.ResponseWriter, _ *http.Request) {
+	audit, err := s.repo.AuditIndexes()
+	if err != nil {
+		writeInternalError(w, "Failed to audit indexes", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(audit)
+}
+
+// handleGetDLQ handles GET /api/admin/dlq
+// Reports the queued entries by type and the progress of the current or last replay.
+func (s *Server) handleGetDLQ(w http.ResponseWriter, _ *http.Request) {
+	if s.dlq == nil {
+		writeUnavailable(w, "the dead letter queue is not enabled")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.dlq.Status())
+}
+
+// handleGetOutbox handles GET /api/admin/outbox
+// Query: state (pending, delivered or dead), limit
+//
+// Counts the anomaly and SLO breach notifications per delivery state and lists the
+// latest ones, with their attempts and last error.
+func (s *Server) handleGetOutbox(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state != "" && state != storage.OutboxPending && state != storage.OutboxDelivered && state != storage.OutboxDead {
+		writeBadRequest(w, "'state' must be pending, delivered or dead")
+		return
+	}
+	limit := 100
+	if l := q.Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, 1000)
+		}
+	}
+	status, err := s.repo.GetOutboxStatus(r.Context(), state, limit)
+	if err != nil {
+		writeInternalError(w, "Failed to get outbox status", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// SlowQueriesResponse is the slow query log.
+type SlowQueriesResponse struct {
+	ThresholdMs float64             `json:"threshold_ms"`
+	Queries     []storage.SlowQuery `json:"queries"` // newest first
+}
+
+// handleGetSlowQueries handles GET /api/admin/slow-queries
+// Lists the most recent statements that took DB_SLOW_QUERY_THRESHOLD or longer.
+func (s *Server) handleGetSlowQueries(w http.ResponseWriter, _ *http.Request) {
+	if s.slowQueries == nil {
+		writeUnavailable(w, "the slow query log is off; set DB_SLOW_QUERY_THRESHOLD to enable it")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SlowQueriesResponse{
+		ThresholdMs: float64(s.slowQueries.Threshold().Microseconds()) / 1000,
+		Queries:     s.slowQueries.Recent(),
+	})
+}
+
+// handleReaggregateMetrics handles POST /api/admin/metrics/reaggregate
+// Body: {"start": "2024-01-31T10:00:00Z", "end": "2024-01-31T12:00:00Z"}
+//
+// Deletes the metric buckets in [start, end). The part of the range still held by the
+// TSDB ring buffer is rebuilt from its per-window aggregates (one bucket per service
+// and metric, without attribute grouping); anything older is only deleted.
+func (s *Server) handleReaggregateMetrics(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Start.IsZero() || req.End.IsZero() {
+		writeBadRequest(w, "request body must be JSON with RFC3339 'start' and 'end' fields")
+		return
+	}
+	if !req.End.After(req.Start) {
+		writeBadRequest(w, "'end' must be after 'start'")
+		return
+	}
+
+	slog.Warn("Admin metric re-aggregation requested", "start", req.Start, "end", req.End, "remote_addr", r.RemoteAddr)
+
+	deleted, err := s.repo.DeleteMetricBuckets(req.Start, req.End)
+	if err != nil {
+		writeInternalError(w, "Failed to delete metric buckets", err, "start", req.Start, "end", req.End)
+		return
+	}
+	auditRows(r, deleted)
+
+	resp := map[string]interface{}{
+		"start":   req.Start,
+		"end":     req.End,
+		"deleted": deleted,
+		"rebuilt": 0,
+		"action":  "deleted",
+	}
+	if s.ringBuf != nil {
+		retainedSince := s.ringBuf.RetainedSince()
+		resp["raw_retained_since"] = retainedSince
+		if req.End.After(retainedSince) {
+			var buckets []storage.MetricBucket
+			for _, win := range s.ringBuf.WindowsBetween(req.Start, req.End) {
+				buckets = append(buckets, storage.MetricBucket{
+					Name:           win.MetricName,
+					ServiceName:    win.ServiceName,
+					TimeBucket:     win.WindowStart,
+					Min:            win.Min,
+					Max:            win.Max,
+					Sum:            win.Sum,
+					Count:          win.Count,
+					AttributesJSON: storage.CompressedText("{}"),
+				})
+			}
+			if err := s.repo.BatchCreateMetrics(buckets); err != nil {
+				writeInternalError(w, "Failed to rebuild metric buckets", err, "start", req.Start, "end", req.End)
+				return
+			}
+			resp["rebuilt"] = len(buckets)
+			resp["action"] = "rebuilt"
+			if req.Start.Before(retainedSince) {
+				resp["action"] = "partially_rebuilt"
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleListArchives handles GET /api/admin/archive
+func (s *Server) handleListArchives(w http.ResponseWriter, r *http.Request) {
+	if s.purgeArchive == nil {
+		writeUnavailable(w, "trace archive not enabled")
+		return
+	}
+	archives, err := s.purgeArchive.List(r.Context())
+	if err != nil {
+		writeInternalError(w, "Failed to list archives", err)
+		return
+	}
+	if archives == nil {
+		archives = []archive.ObjectInfo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(archives)
+}
+
+// handleRestoreArchive handles POST /api/admin/archive/restore
+// Body: {"name": "traces-2024-01-31-1706745600000000000.ndjson.zst"}
+func (s *Server) handleRestoreArchive(w http.ResponseWriter, r *http.Request) {
+	if s.purgeArchive == nil {
+		writeUnavailable(w, "trace archive not enabled")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeBadRequest(w, "request body must be JSON with a 'name' field")
+		return
+	}
+
+	res, err := s.purgeArchive.Restore(r.Context(), req.Name)
+	if err != nil {
+		writeInternalError(w, "Failed to restore archive", err, "archive", req.Name)
+		return
+	}
+	slog.Warn("Admin archive restore", "archive", res.Name, "traces", res.Traces, "spans", res.Spans, "logs", res.Logs, "remote_addr", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/buildinfo"
+	"github.com/RandomCodeSpace/otelcontext/internal/queue"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+)
+
+func reaggregate(t *testing.T, s *Server, start, end time.Time) map[string]interface{} {
+	t.Helper()
+	body := fmt.Sprintf(`{"start":%q,"end":%q}`, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	rec := httptest.NewRecorder()
+	s.handleReaggregateMetrics(rec, httptest.NewRequest(http.MethodPost, "/api/admin/metrics/reaggregate", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestReaggregateMetricsDeletesWithoutRawData(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	// Buckets written by a host whose clock ran five hours ahead.
+	future := now.Add(5 * time.Hour)
+	if err := repo.BatchCreateMetrics([]storage.MetricBucket{
+		{Name: "queue_depth", ServiceName: "bad-clock", TimeBucket: future, Count: 1, Sum: 3},
+		{Name: "queue_depth", ServiceName: "bad-clock", TimeBucket: future.Add(30 * time.Second), Count: 1, Sum: 4},
+		{Name: "queue_depth", ServiceName: "good-clock", TimeBucket: now, Count: 1, Sum: 5},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := reaggregate(t, s, future.Add(-time.Hour), future.Add(time.Hour))
+	if resp["deleted"] != float64(2) || resp["rebuilt"] != float64(0) || resp["action"] != "deleted" {
+		t.Errorf("response = %v, want 2 deleted and nothing rebuilt", resp)
+	}
+
+	left, err := repo.GetMetricBuckets(now.Add(-time.Hour), future.Add(time.Hour), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].ServiceName != "good-clock" {
+		t.Errorf("remaining buckets = %+v, want only good-clock", left)
+	}
+}
+
+func TestReaggregateMetricsRebuildsFromRingBuffer(t *testing.T) {
+	s, repo := newTestServer(t)
+	ring := tsdb.NewRingBuffer(120, 30*time.Second)
+	s.SetRingBuffer(ring)
+
+	now := time.Now().UTC()
+	window := now.Truncate(30 * time.Second)
+	ring.Record("queue_depth", "checkout", 2, now)
+	ring.Record("queue_depth", "checkout", 6, now)
+
+	// A skewed bucket inside the retained range, plus a correct one that is replaced.
+	if err := repo.BatchCreateMetrics([]storage.MetricBucket{
+		{Name: "queue_depth", ServiceName: "checkout", TimeBucket: window, Count: 1, Sum: 99},
+		{Name: "queue_depth", ServiceName: "checkout", TimeBucket: window.Add(-10 * time.Minute), Count: 1, Sum: 42},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := reaggregate(t, s, now.Add(-30*time.Minute), now.Add(time.Minute))
+	if resp["deleted"] != float64(2) || resp["rebuilt"] != float64(1) || resp["action"] != "rebuilt" {
+		t.Fatalf("response = %v, want 2 deleted and 1 rebuilt", resp)
+	}
+
+	buckets, err := repo.GetMetricBuckets(now.Add(-time.Hour), now.Add(time.Hour), "checkout", "queue_depth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 {
+		t.Fatalf("got %d buckets, want 1", len(buckets))
+	}
+	if b := buckets[0]; b.Count != 2 || b.Sum != 8 || b.Min != 2 || b.Max != 6 || !b.TimeBucket.Equal(window) {
+		t.Errorf("rebuilt bucket = %+v", b)
+	}
+}
+
+func TestGetDLQ(t *testing.T) {
+	s, _ := newTestServer(t)
+	rec := httptest.NewRecorder()
+	s.handleGetDLQ(rec, httptest.NewRequest(http.MethodGet, "/api/admin/dlq", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a DLQ: status = %d, want 503", rec.Code)
+	}
+
+	dlq, err := queue.NewDLQ(t.TempDir(), time.Hour, func(string, []byte) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dlq.Stop()
+	dlq.Enqueue(queue.Entry{Type: queue.TypeTraces, Data: []string{"t1"}}, queue.Entry{Type: queue.TypeSpans, Data: []string{"s1"}})
+	s.SetDLQ(dlq)
+
+	rec = httptest.NewRecorder()
+	s.handleGetDLQ(rec, httptest.NewRequest(http.MethodGet, "/api/admin/dlq", nil))
+	var st queue.Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Files != 2 || st.ByType["traces"] != 1 || st.ByType["spans"] != 1 || st.DiskBytes == 0 || st.Replay != nil {
+		t.Errorf("status = %+v, want two queued entries and no replay yet", st)
+	}
+}
+
+func TestGetOutbox(t *testing.T) {
+	s, repo := newTestServer(t)
+	for _, svc := range []string{"checkout", "cart"} {
+		if err := repo.CreateAnomalyEvent(&storage.AnomalyEvent{ServiceName: svc, Signal: "error_rate", DetectedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending, err := repo.PendingOutboxEvents(context.Background(), time.Now(), 10)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("PendingOutboxEvents() = %d events, %v", len(pending), err)
+	}
+	if err := repo.RecordOutboxFailure(context.Background(), pending[0].ID, 10, "webhook returned 500", time.Now(), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleGetOutbox(rec, httptest.NewRequest(http.MethodGet, "/api/admin/outbox?state=dead", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var st storage.OutboxStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Counts["dead"] != 1 || st.Counts["pending"] != 1 || st.Counts["delivered"] != 0 {
+		t.Errorf("counts = %v, want 1 dead and 1 pending", st.Counts)
+	}
+	if len(st.Events) != 1 || st.Events[0].ServiceName != "checkout" || st.Events[0].Attempts != 10 || st.Events[0].LastError == "" {
+		t.Errorf("events = %+v, want the dead checkout anomaly", st.Events)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleGetOutbox(rec, httptest.NewRequest(http.MethodGet, "/api/admin/outbox?state=failed", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown state: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetBuildInfo(buildinfo.Info{Version: "v1.2.3", Commit: "abc123", BuildDate: "2026-01-02T03:04:05Z",
+		GoVersion: "go1.25.0", DBDriver: "sqlite", UIBuild: "0123456789abcdef"})
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "v1.2.3", "commit": "abc123", "build_date": "2026-01-02T03:04:05Z",
+		"go_version": "go1.25.0", "db_driver": "sqlite", "ui_build": "0123456789abcdef"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if !strings.Contains(rec.Body.String(), `"version":"v1.2.3"`) {
+		t.Error("OpenAPI document does not report the build version")
+	}
+}
+
+func TestReadyTurnsUnavailableWhenDraining(t *testing.T) {
+	s, _ := newTestServer(t)
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		s.handleReady(rec, httptest.NewRequest(http.MethodGet, "/api/ready", nil))
+		return rec.Code
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("before shutdown: status %d, want 200", code)
+	}
+	s.SetDraining()
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("draining: status %d, want 503", code)
+	}
+}
+
+func TestGetSlowQueries(t *testing.T) {
+	s, repo := newTestServer(t)
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/slow-queries", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a slow query log: status %d, want 503", rec.Code)
+	}
+
+	slow := storage.NewSlowQueryLog(time.Nanosecond, 100) // every statement counts as slow
+	repo.SetSlowQueryLog(slow)
+	s.SetSlowQueryLog(slow)
+
+	// The route set by the mux wrapper reaches the statements the handler runs
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/service-map?focus=payments-secret", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("service map: status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/slow-queries", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var resp SlowQueriesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, q := range resp.Queries {
+		if q.Route == "/api/metrics/service-map" && q.Table == "spans" {
+			found = true
+		}
+		if strings.Contains(q.SQL, "payments-secret") {
+			t.Errorf("slow query kept a value: %s", q.SQL)
+		}
+	}
+	if !found {
+		t.Errorf("response = %+v, want the spans query of /api/metrics/service-map", resp)
+	}
+}
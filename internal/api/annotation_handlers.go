@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
+)
+
+// handleCreateTraceAnnotation handles POST /api/traces/{id}/annotations
+// Body: {"key": "root_cause", "value": "...", "author": "..."}
+func (s *Server) handleCreateTraceAnnotation(w http.ResponseWriter, r *http.Request) {
+	var a storage.TraceAnnotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	a.ID = 0
+	a.TraceID = r.PathValue("id")
+
+	if err := s.store(r).CreateTraceAnnotation(&a); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidAnnotation):
+			writeBadRequest(w, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeNotFound(w, "trace not found")
+		default:
+			writeInternalError(w, "Failed to annotate trace", err, "trace_id", a.TraceID)
+		}
+		return
+	}
+
+	slog.Info("Trace annotated", "trace_id", a.TraceID, "key", a.Key, "author", a.Author)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// handleDeleteTraceAnnotations handles DELETE /api/traces/{id}/annotations
+// Query params: key (required), value (only annotations with this value)
+func (s *Server) handleDeleteTraceAnnotations(w http.ResponseWriter, r *http.Request) {
+	traceID := r.PathValue("id")
+	f := storage.AnnotationFilter{Key: r.URL.Query().Get("key"), Value: r.URL.Query().Get("value")}
+	if f.Key == "" {
+		writeBadRequest(w, "key is required")
+		return
+	}
+	if _, err := s.store(r).DeleteTraceAnnotations(traceID, f); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeNotFound(w, "annotation not found")
+			return
+		}
+		writeInternalError(w, "Failed to delete annotations", err, "trace_id", traceID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseAnnotationFilters reads repeated annotation=key or annotation=key:value params.
+func parseAnnotationFilters(r *http.Request) []storage.AnnotationFilter {
+	var filters []storage.AnnotationFilter
+	for _, a := range r.URL.Query()["annotation"] {
+		key, value, _ := strings.Cut(a, ":")
+		if key != "" {
+			filters = append(filters, storage.AnnotationFilter{Key: key, Value: value})
+		}
+	}
+	return filters
+}
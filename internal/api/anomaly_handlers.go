@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// handleGetAnomalies handles GET /api/anomalies
+// Query: service_name, since (RFC3339), limit, offset
+func (s *Server) handleGetAnomalies(w http.ResponseWriter, r *http.Request) {
+	filter := storage.AnomalyFilter{
+		ServiceName: r.URL.Query().Get("service_name"),
+		Limit:       100,
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			filter.Limit = v
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			filter.Offset = v
+		}
+	}
+	if since := r.URL.Query().Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeBadRequest(w, "invalid since parameter (expected RFC3339)")
+			return
+		}
+		filter.Since = t
+	}
+
+	events, total, err := s.repo.ListAnomalyEvents(filter)
+	if err != nil {
+		writeInternalError(w, "Failed to list anomalies", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":  events,
+		"total": total,
+	})
+}
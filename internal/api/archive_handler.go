@@ -35,7 +35,7 @@ func (s *Server) handleSearchColdArchive(w http.ResponseWriter, r *http.Request)
 
 	coldPath := s.coldStoragePath()
 	if coldPath == "" {
-		http.Error(w, "cold storage not configured", http.StatusServiceUnavailable)
+		writeUnavailable(w, "cold storage not configured")
 		return
 	}
 
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+const (
+	// auditBodyMax is how much of a request body is read for the audit params; larger
+	// bodies are left out of the entry.
+	auditBodyMax = 4 << 10
+	// auditParamsMax caps the stored params summary.
+	auditParamsMax = 2048
+)
+
+// sensitiveParamWords mark parameters whose values are never written to the audit
+// log. Names are matched case-insensitively by substring.
+var sensitiveParamWords = []string{"password", "passwd", "secret", "token", "key", "auth", "credential"}
+
+type auditContextKey struct{}
+
+// auditRecord collects what a handler reports about its action for the audit entry.
+type auditRecord struct {
+	rows *int64
+}
+
+// auditRows reports the number of rows an admin action affected. It is a no-op for
+// requests that are not audited.
+func auditRows(r *http.Request, n int64) {
+	if rec, ok := r.Context().Value(auditContextKey{}).(*auditRecord); ok {
+		rec.rows = &n
+	}
+}
+
+// audited wraps an admin handler so each mutating call is recorded as an
+// AuditEntry. Reads are not recorded. Recording is best-effort: a failed write is
+// logged and does not affect the response.
+func (s *Server) audited(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+
+		entry := &storage.AuditEntry{
+			Timestamp:  time.Now().UTC(),
+			RemoteAddr: r.RemoteAddr,
+			Principal:  auditPrincipal(r),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Params:     auditParams(r),
+		}
+		rec := &auditRecord{}
+		rw := wrapResponseWriter(w)
+		h(rw, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, rec)))
+
+		entry.Status = rw.statusCode
+		entry.RowsAffected = rec.rows
+		if err := s.repo.CreateAuditEntry(entry); err != nil {
+			slog.Warn("Failed to write audit entry", "method", entry.Method, "path", entry.Path, "status", entry.Status, "error", err)
+		}
+	}
+}
+
+// auditPrincipal returns the authenticated user of r. With multi-tenancy on, that is
+// the identity of its token; otherwise, when a fronting proxy enforces basic auth,
+// its user name is recorded.
+func auditPrincipal(r *http.Request) string {
+	if id, ok := tenant.FromContext(r.Context()); ok {
+		return id.String()
+	}
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
+// auditParams summarises the query parameters of r and the top-level scalar fields
+// of a small JSON body as a query string, with sensitive values redacted. The body
+// is restored for the handler.
+func auditParams(r *http.Request) string {
+	params := url.Values{}
+	for k, vs := range r.URL.Query() {
+		params[k] = append([]string(nil), vs...)
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		buf, err := io.ReadAll(io.LimitReader(r.Body, auditBodyMax+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		var fields map[string]any
+		if err == nil && len(buf) <= auditBodyMax && json.Unmarshal(buf, &fields) == nil {
+			for k, v := range fields {
+				switch v.(type) {
+				case string, float64, bool:
+					params.Add(k, fmt.Sprint(v))
+				}
+			}
+		}
+	}
+
+	for k := range params {
+		if sensitiveParam(k) {
+			params[k] = []string{"REDACTED"}
+		}
+	}
+	enc := params.Encode()
+	if len(enc) > auditParamsMax {
+		enc = enc[:auditParamsMax]
+	}
+	return enc
+}
+
+func sensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range sensitiveParamWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleListAudit handles GET /api/admin/audit
+// Query: start, end (RFC3339), limit, offset
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	filter := storage.AuditFilter{Limit: 100}
+	q := r.URL.Query()
+	if l := q.Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			filter.Limit = min(v, 1000)
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			filter.Offset = v
+		}
+	}
+	for name, dst := range map[string]*time.Time{"start": &filter.Start, "end": &filter.End} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeBadRequest(w, "invalid "+name+" parameter (expected RFC3339)")
+				return
+			}
+			*dst = t
+		}
+	}
+
+	entries, total, err := s.repo.ListAuditEntries(filter)
+	if err != nil {
+		writeInternalError(w, "Failed to list audit entries", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":  entries,
+		"total": total,
+	})
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestAuditedAdminCalls(t *testing.T) {
+	s, repo := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /api/admin/purge", s.audited(s.handlePurge))
+	mux.HandleFunc("POST /api/admin/remap-service", s.audited(s.handleRemapService))
+	mux.HandleFunc("GET /api/admin/audit", s.audited(s.handleListAudit))
+
+	old := time.Now().AddDate(0, 0, -30)
+	if err := repo.BatchCreateLogs([]storage.Log{
+		{ServiceName: "cart", Severity: "INFO", Body: "a", Timestamp: old},
+		{ServiceName: "cart", Severity: "INFO", Body: "b", Timestamp: old},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/admin/purge?days=7&api_token=hunter2", nil)
+	req.SetBasicAuth("ops", "pw")
+	req.RemoteAddr = "10.0.0.7:5555"
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	body := `{"from": "cart", "to": "", "secret_key": "s3cr3t"}`
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/admin/remap-service", strings.NewReader(body)))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/audit?limit=10", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET audit status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data  []storage.AuditEntry `json:"data"`
+		Total int64                `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// The audit read itself is not recorded.
+	if resp.Total != 2 || len(resp.Data) != 2 {
+		t.Fatalf("got %d entries (total %d), want 2", len(resp.Data), resp.Total)
+	}
+
+	remap, purge := resp.Data[0], resp.Data[1] // newest first
+	if purge.Method != http.MethodDelete || purge.Path != "/api/admin/purge" || purge.Status != http.StatusOK ||
+		purge.Principal != "ops" || purge.RemoteAddr != "10.0.0.7:5555" {
+		t.Errorf("purge entry = %+v", purge)
+	}
+	if purge.RowsAffected == nil || *purge.RowsAffected != 2 {
+		t.Errorf("purge rows affected = %v, want 2", purge.RowsAffected)
+	}
+	params, _ := url.ParseQuery(purge.Params)
+	if params.Get("days") != "7" || params.Get("api_token") != "REDACTED" {
+		t.Errorf("purge params = %q, want days kept and api_token redacted", purge.Params)
+	}
+
+	// The handler still read the full body, and the rejected call was recorded.
+	if remap.Status != http.StatusBadRequest || remap.RowsAffected != nil {
+		t.Errorf("remap entry = %+v, want a 400 without rows", remap)
+	}
+	params, _ = url.ParseQuery(remap.Params)
+	if params.Get("from") != "cart" || params.Get("secret_key") != "REDACTED" {
+		t.Errorf("remap params = %q, want from kept and secret_key redacted", remap.Params)
+	}
+}
+
+// failingAuditBackend cannot record audit entries.
+type failingAuditBackend struct {
+	storage.Backend
+}
+
+func (failingAuditBackend) CreateAuditEntry(*storage.AuditEntry) error {
+	return errors.New("database is locked")
+}
+
+func TestAuditFailureDoesNotFailAction(t *testing.T) {
+	s := &Server{repo: failingAuditBackend{}}
+	called := false
+	h := s.audited(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		auditRows(r, 3)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/api/admin/vacuum", nil))
+	if !called || rec.Code != http.StatusNoContent {
+		t.Errorf("called %v, status %d; want the action to succeed", called, rec.Code)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// defaultRestoreMaxBytes caps restore uploads unless SetRestore gives another limit.
+const defaultRestoreMaxBytes = 10 << 30
+
+// writeBackupError answers for a failed backup or restore.
+func writeBackupError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrBackupUnsupported):
+		writeError(w, http.StatusNotImplemented, ErrCodeUnimplemented, err.Error(), nil)
+	case errors.Is(err, storage.ErrInvalidBackup):
+		writeBadRequest(w, err.Error())
+	default:
+		writeInternalError(w, msg, err)
+	}
+}
+
+// handleBackup handles GET /api/admin/backup. It streams a consistent snapshot of the
+// SQLite database as a file download; other drivers get 501. The snapshot is written
+// to a temporary file first, so ingestion is only held up while it is taken, not while
+// a slow client downloads it.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if !s.backupMu.TryLock() {
+		writeError(w, http.StatusConflict, ErrCodeConflict, "a backup or restore is already running", nil)
+		return
+	}
+	path, err := s.repo.Backup(r.Context(), os.TempDir())
+	s.backupMu.Unlock()
+	if err != nil {
+		writeBackupError(w, "Failed to back up database", err)
+		return
+	}
+	defer os.Remove(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		writeInternalError(w, "Failed to open backup", err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		writeInternalError(w, "Failed to open backup", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="otelcontext-%s.db"`, time.Now().UTC().Format("20060102T150405Z")))
+	n, err := io.Copy(w, f)
+	if err != nil {
+		slog.Warn("Backup download interrupted", "bytes_sent", n, "bytes", fi.Size(), "error", err)
+		return
+	}
+	slog.Info("Backup downloaded", "bytes", n, "remote_addr", r.RemoteAddr)
+}
+
+// handleRestore handles POST /api/admin/restore?confirm=true. The body is a file from
+// GET /api/admin/backup, sent raw or as the "file" field of a multipart form. It is
+// integrity-checked and then replaces all stored data in one transaction. Disabled
+// unless RESTORE_ENABLED=true.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if !s.restoreOn {
+		writeUnavailable(w, "restore is disabled; set RESTORE_ENABLED=true to allow it")
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		writeBadRequest(w, "restore replaces all stored data; repeat the request with confirm=true")
+		return
+	}
+	if !s.backupMu.TryLock() {
+		writeError(w, http.StatusConflict, ErrCodeConflict, "a backup or restore is already running", nil)
+		return
+	}
+	defer s.backupMu.Unlock()
+
+	limit := s.restoreMax
+	if limit <= 0 {
+		limit = defaultRestoreMaxBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	body, err := importFile(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "otelcontext-restore-*.db")
+	if err != nil {
+		writeInternalError(w, "Failed to store restore upload", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	start := time.Now()
+	n, err := io.Copy(tmp, body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+				fmt.Sprintf("backup exceeds %d bytes (RESTORE_MAX_MB)", limit), nil)
+			return
+		}
+		writeBadRequest(w, "failed to read upload: "+err.Error())
+		return
+	}
+	slog.Warn("Restore upload received", "bytes", n, "duration", time.Since(start), "remote_addr", r.RemoteAddr)
+
+	res, err := s.repo.Restore(r.Context(), tmp.Name())
+	if err != nil {
+		writeBackupError(w, "Failed to restore database", err)
+		return
+	}
+	var rows int64
+	for _, c := range res.Tables {
+		rows += c
+	}
+	auditRows(r, rows)
+	if s.eventHub != nil {
+		s.eventHub.NotifyRefresh()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestBackupRestoreEndpoints(t *testing.T) {
+	s, repo := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/admin/backup", s.handleBackup)
+	mux.HandleFunc("POST /api/admin/restore", s.handleRestore)
+	if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: "t1", ServiceName: "cart", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/backup", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "SQLite format 3\x00") {
+		t.Fatalf("backup: status %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "attachment") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	backup := rec.Body.Bytes()
+
+	restore := func(query string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/admin/restore"+query, bytes.NewReader(body)))
+		return rec
+	}
+	if rec := restore("?confirm=true", backup); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("restore while disabled: status %d, want 503", rec.Code)
+	}
+
+	s.SetRestore(true, 1<<20)
+	if rec := restore("", backup); rec.Code != http.StatusBadRequest {
+		t.Errorf("restore without confirm: status %d, want 400", rec.Code)
+	}
+	if rec := restore("?confirm=true", []byte("not a database")); rec.Code != http.StatusBadRequest {
+		t.Errorf("restore of garbage: status %d, want 400 (%s)", rec.Code, rec.Body.String())
+	}
+
+	repo.PurgeTraces(time.Now().Add(time.Hour))
+	rec = restore("?confirm=true", backup)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"traces":1`) {
+		t.Fatalf("restore: status %d (%s)", rec.Code, rec.Body.String())
+	}
+	if trace, err := repo.GetTrace("t1"); err != nil || trace.TraceID != "t1" {
+		t.Errorf("trace after restore = %v, %v", trace, err)
+	}
+
+	s.SetRestore(true, 100)
+	if rec := restore("?confirm=true", backup); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized restore: status %d, want 413", rec.Code)
+	}
+}
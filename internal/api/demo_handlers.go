@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/demo"
+)
+
+// SetDemo exposes the demo traffic generator to the admin API.
+func (s *Server) SetDemo(g *demo.Generator) {
+	s.demo = g
+}
+
+// handleDemo handles GET /api/admin/demo.
+func (s *Server) handleDemo(w http.ResponseWriter, r *http.Request) {
+	s.writeDemoStatus(w, nil)
+}
+
+// handleDemoStart handles POST /api/admin/demo/start. Starting a running generator
+// is a no-op.
+func (s *Server) handleDemoStart(w http.ResponseWriter, r *http.Request) {
+	s.writeDemoStatus(w, (*demo.Generator).Start)
+}
+
+// handleDemoStop handles POST /api/admin/demo/stop. Demo data already stored is
+// kept; the throwaway database goes when the process exits.
+func (s *Server) handleDemoStop(w http.ResponseWriter, r *http.Request) {
+	s.writeDemoStatus(w, (*demo.Generator).Stop)
+}
+
+// writeDemoStatus applies action, if any, to the generator and writes its status.
+func (s *Server) writeDemoStatus(w http.ResponseWriter, action func(*demo.Generator)) {
+	if s.demo == nil {
+		writeUnavailable(w, "demo mode is off; start with --demo or APP_ENV=demo")
+		return
+	}
+	if action != nil {
+		action(s.demo)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.demo.Status())
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/demo"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+)
+
+func TestDemoEndpoints(t *testing.T) {
+	s, repo := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/admin/demo", s.handleDemo)
+	mux.HandleFunc("POST /api/admin/demo/start", s.handleDemoStart)
+	mux.HandleFunc("POST /api/admin/demo/stop", s.handleDemoStop)
+
+	call := func(method, target string) (int, demo.Status) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		var st demo.Status
+		json.Unmarshal(rec.Body.Bytes(), &st)
+		return rec.Code, st
+	}
+
+	if code, _ := call(http.MethodGet, "/api/admin/demo"); code != http.StatusServiceUnavailable {
+		t.Fatalf("status without demo mode = %d, want 503", code)
+	}
+
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	gen := demo.New(demo.Exporters{
+		Traces:  ingest.NewTraceServer(repo, nil, cfg),
+		Logs:    ingest.NewLogsServer(repo, nil, cfg),
+		Metrics: ingest.NewMetricsServer(repo, nil, nil, cfg),
+	}, 1, 100)
+	s.SetDemo(gen)
+	t.Cleanup(gen.Stop)
+
+	if code, st := call(http.MethodPost, "/api/admin/demo/start"); code != http.StatusOK || !st.Running {
+		t.Fatalf("start = %d %+v", code, st)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		traces, err := repo.GetTracesFiltered(time.Time{}, time.Time{}, nil, "", "", 10, 0, "", "")
+		if err == nil && traces.Total > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no demo traces stored: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if code, st := call(http.MethodPost, "/api/admin/demo/stop"); code != http.StatusOK || st.Running || st.Requests == 0 {
+		t.Fatalf("stop = %d %+v", code, st)
+	}
+}
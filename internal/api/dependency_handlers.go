@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// handleGetServiceDependencies handles GET /api/services/{name}/dependencies
+// Compares the calls from the service to each service it calls over the last
+// window (default 1h) with the window before it, and flags the dependencies whose
+// error rate or p95 latency degraded. error_rate_delta, latency_change and
+// min_calls override the configured thresholds.
+func (s *Server) handleGetServiceDependencies(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := s.depDefaults
+	query.Service = r.PathValue("name")
+
+	window := storage.DefaultDependencyWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > storage.MaxDependencyWindow {
+			writeBadRequest(w, "window must be a positive duration of at most "+storage.MaxDependencyWindow.String())
+			return
+		}
+		window = d
+	}
+	query.End = time.Now().UTC()
+	query.Start = query.End.Add(-window)
+
+	if v := q.Get("error_rate_delta"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			writeBadRequest(w, "error_rate_delta must be between 0 and 1")
+			return
+		}
+		query.ErrorRateDelta = f
+	}
+	if v := q.Get("latency_change"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			writeBadRequest(w, "latency_change must be >= 0")
+			return
+		}
+		query.LatencyChange = f
+	}
+	if v := q.Get("min_calls"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeBadRequest(w, "min_calls must be >= 0")
+			return
+		}
+		query.MinCalls = n
+	}
+
+	result, err := s.store(r).GetServiceDependenciesContext(r.Context(), query)
+	if err != nil {
+		writeQueryError(w, r, "Failed to get service dependencies", err, "service", query.Service)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
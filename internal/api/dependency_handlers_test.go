@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestGetServiceDependencies(t *testing.T) {
+	s, repo := newTestServer(t)
+	s.depDefaults = storage.DependencyQuery{ErrorRateDelta: 0.05, LatencyChange: 0.5, MinCalls: 10}
+	now := time.Now()
+	if err := repo.BatchCreateSpans([]storage.Span{
+		{TraceID: "t1", SpanID: "a", ServiceName: "checkout", Kind: storage.SpanKindClient, StartTime: now.Add(-time.Minute), Duration: 5000, HasError: true},
+		{TraceID: "t1", SpanID: "b", ParentSpanID: "a", ServiceName: "payment", StartTime: now.Add(-time.Minute), Duration: 4000},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/services/checkout/dependencies"+query, nil)
+		req.SetPathValue("name", "checkout")
+		rec := httptest.NewRecorder()
+		s.handleGetServiceDependencies(rec, req)
+		return rec
+	}
+
+	rec := get("?window=10m&min_calls=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var res storage.DependencyHealthResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if got := res.End.Sub(res.Start); got != 10*time.Minute || res.Service != "checkout" {
+		t.Errorf("result covers %v for %q, want 10m for checkout", got, res.Service)
+	}
+	if len(res.Dependencies) != 1 {
+		t.Fatalf("dependencies = %+v, want payment only", res.Dependencies)
+	}
+	if d := res.Dependencies[0]; d.Target != "payment" || d.Current.P95LatencyMs != 5 || !d.Degraded {
+		t.Errorf("payment = %+v, want p95 5ms from the CLIENT span and degraded with min_calls=1", d)
+	}
+
+	// With the default min_calls one failed call is not enough.
+	rec = get("")
+	res = storage.DependencyHealthResult{}
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if len(res.Dependencies) != 1 || res.Dependencies[0].Degraded {
+		t.Errorf("default thresholds: %+v, want payment listed but not degraded", res.Dependencies)
+	}
+
+	for _, q := range []string{"?window=48h", "?window=soon", "?error_rate_delta=2", "?latency_change=-1", "?min_calls=x"} {
+		if rec := get(q); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", q, rec.Code)
+		}
+	}
+}
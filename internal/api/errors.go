@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of API error responses.
+const (
+	ErrCodeInvalidArgument = "invalid_argument"
+	ErrCodeNotFound        = "not_found"
+	ErrCodeInternal        = "internal"
+	ErrCodeUnavailable     = "unavailable"
+	ErrCodeRateLimited     = "rate_limited"
+	ErrCodeTooLarge        = "payload_too_large"
+	ErrCodeConflict        = "conflict"
+	ErrCodeUnimplemented   = "unimplemented"
+	ErrCodeUnauthenticated = "unauthenticated"
+	ErrCodeForbidden       = "permission_denied"
+)
+
+// APIError is the machine-readable error body: {"error":{"code":...,"message":...,"details":...}}.
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeError writes a JSON error response with the given status and code.
+func writeError(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: APIError{Code: code, Message: message, Details: details}})
+}
+
+// writeBadRequest writes a 400 invalid_argument error.
+func writeBadRequest(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument, message, nil)
+}
+
+// writeNotFound writes a 404 not_found error.
+func writeNotFound(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusNotFound, ErrCodeNotFound, message, nil)
+}
+
+// writeUnavailable writes a 503 unavailable error.
+func writeUnavailable(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusServiceUnavailable, ErrCodeUnavailable, message, nil)
+}
+
+// writeInternalError logs err with msg and args, and answers with a generic 500 body.
+// The full error never reaches the client; instead both the log line and the response
+// carry a correlation ID so the two can be matched up.
+func writeInternalError(w http.ResponseWriter, msg string, err error, args ...any) {
+	id := newCorrelationID()
+	slog.Error(msg, append(args, "error", err, "correlation_id", id)...)
+	w.Header().Set("X-Correlation-ID", id)
+	writeError(w, http.StatusInternalServerError, ErrCodeInternal,
+		"internal server error", map[string]string{"correlation_id": id})
+}
+
+// writeQueryError answers for a failed read. Nothing is written when the client has
+// gone away, since the query was only cancelled on its behalf. A query cut off by
+// DB_QUERY_TIMEOUT is a 503 the client can retry with a narrower range; anything
+// else is an internal error.
+func writeQueryError(w http.ResponseWriter, r *http.Request, msg string, err error, args ...any) {
+	if r.Context().Err() != nil {
+		slog.Debug(msg+": request cancelled", append(args, "error", err)...)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn(msg+": query timed out", append(args, "error", err)...)
+		writeUnavailable(w, "query timed out; narrow the time range or filters")
+		return
+	}
+	writeInternalError(w, msg, err, args...)
+}
+
+// newCorrelationID returns a random 16-character hex identifier.
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func newTestServer(t *testing.T) (*Server, *storage.Repository) {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "api.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return &Server{repo: repo}, repo
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body is not JSON: %v (%s)", err, rec.Body.String())
+	}
+	return body.Error
+}
+
+func TestErrorResponseBadRequest(t *testing.T) {
+	s, _ := newTestServer(t)
+	rec := httptest.NewRecorder()
+	s.handlePurgeService(rec, httptest.NewRequest(http.MethodDelete, "/api/admin/data", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Code != ErrCodeInvalidArgument || e.Message == "" {
+		t.Errorf("error = %+v, want invalid_argument with message", e)
+	}
+}
+
+func TestErrorResponseNotFound(t *testing.T) {
+	s, _ := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/traces/missing", nil)
+	req.SetPathValue("id", "missing")
+	rec := httptest.NewRecorder()
+	s.handleGetTraceByID(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Code != ErrCodeNotFound {
+		t.Errorf("code = %q, want not_found", e.Code)
+	}
+}
+
+func TestErrorResponseInternalHidesCause(t *testing.T) {
+	s, repo := newTestServer(t)
+	repo.Close() // every query now fails with "sql: database is closed"
+
+	rec := httptest.NewRecorder()
+	s.handleGetStats(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	e := decodeError(t, rec)
+	if e.Code != ErrCodeInternal {
+		t.Errorf("code = %q, want internal", e.Code)
+	}
+	if strings.Contains(rec.Body.String(), "closed") {
+		t.Errorf("internal error leaked to client: %s", rec.Body.String())
+	}
+	details, _ := e.Details.(map[string]interface{})
+	id, _ := details["correlation_id"].(string)
+	if id == "" || rec.Header().Get("X-Correlation-ID") != id {
+		t.Errorf("correlation id missing or mismatched: details=%v header=%q", e.Details, rec.Header().Get("X-Correlation-ID"))
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/export"
+	"gorm.io/gorm"
+)
+
+// forwardTargetMaxBytes caps the forward request body, which only names a target.
+const forwardTargetMaxBytes = 64 << 10
+
+// handleForwardTrace handles POST /api/traces/{id}/forward
+// Body: {"endpoint": "apm.example.com:4317", "tls": true, "headers": {"api-key": "..."}}
+// Rebuilds the stored trace as an OTLP export and sends it to the endpoint, which
+// must be listed in TRACE_FORWARD_ENDPOINTS. A receiver that cannot be reached or
+// refuses the export is a 502.
+func (s *Server) handleForwardTrace(w http.ResponseWriter, r *http.Request) {
+	var target export.Target
+	r.Body = http.MaxBytesReader(w, r.Body, forwardTargetMaxBytes)
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", forwardTargetMaxBytes), nil)
+			return
+		}
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	if target.Endpoint == "" {
+		writeBadRequest(w, "endpoint is required")
+		return
+	}
+	if s.forwarder == nil || !s.forwarder.Allowed(target.Endpoint) {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden,
+			fmt.Sprintf("endpoint %q is not in TRACE_FORWARD_ENDPOINTS", target.Endpoint), nil)
+		return
+	}
+
+	traceID := r.PathValue("id")
+	trace, err := s.store(r).GetTrace(traceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "trace not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "Failed to get trace", err, "trace_id", traceID)
+		return
+	}
+
+	res, err := s.forwarder.Forward(r.Context(), target, export.TraceRequest(trace))
+	if err != nil {
+		slog.Warn("Trace forward failed", "trace_id", traceID, "endpoint", target.Endpoint, "error", err)
+		writeError(w, http.StatusBadGateway, ErrCodeUnavailable, err.Error(), nil)
+		return
+	}
+	slog.Info("Trace forwarded", "trace_id", traceID, "endpoint", target.Endpoint, "spans", res.Spans, "rejected_spans", res.RejectedSpans)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
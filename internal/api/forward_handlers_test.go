@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/export"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestForwardTraceChecksTheAllowList(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now()
+	if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ServiceName: "web", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]storage.Span{{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", OperationName: "GET /", ServiceName: "web", StartTime: now, EndTime: now}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A port nothing listens on.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := lis.Addr().String()
+	lis.Close()
+
+	forward := func(traceID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/traces/"+traceID+"/forward", strings.NewReader(body))
+		req.SetPathValue("id", traceID)
+		rec := httptest.NewRecorder()
+		s.handleForwardTrace(rec, req)
+		return rec
+	}
+	body := `{"endpoint": "` + closed + `"}`
+
+	// Without TRACE_FORWARD_ENDPOINTS nothing is allowed.
+	if rec := forward("4bf92f3577b34da6a3ce929d0e0e4736", body); rec.Code != http.StatusForbidden || decodeError(t, rec).Code != ErrCodeForbidden {
+		t.Errorf("no allow-list: status = %d, body = %s; want 403", rec.Code, rec.Body.String())
+	}
+
+	s.SetTraceForwarder(export.NewForwarder([]string{closed}, time.Second))
+	if rec := forward("4bf92f3577b34da6a3ce929d0e0e4736", `{"endpoint": "169.254.169.254:80"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("unlisted endpoint: status = %d, want 403", rec.Code)
+	}
+	if rec := forward("4bf92f3577b34da6a3ce929d0e0e4736", `{"tls": true}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing endpoint: status = %d, want 400", rec.Code)
+	}
+	huge := `{"endpoint": "` + closed + `", "headers": {"x": "` + strings.Repeat("a", forwardTargetMaxBytes) + `"}}`
+	if rec := forward("4bf92f3577b34da6a3ce929d0e0e4736", huge); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status = %d, want 413", rec.Code)
+	}
+	if rec := forward("ffffffffffffffffffffffffffffffff", body); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown trace: status = %d, want 404", rec.Code)
+	}
+	if rec := forward("4bf92f3577b34da6a3ce929d0e0e4736", body); rec.Code != http.StatusBadGateway || decodeError(t, rec).Code != ErrCodeUnavailable {
+		t.Errorf("unreachable receiver: status = %d, body = %s; want 502", rec.Code, rec.Body.String())
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"math"
@@ -79,7 +80,7 @@ func (s *Server) handleGetSystemGraph(w http.ResponseWriter, r *http.Request) {
 		// Graph not yet hydrated — fall back to DB path.
 		resp = s.buildGraphFromDB()
 		if resp == nil {
-			http.Error(w, "failed to build system graph", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "failed to build system graph", nil)
 			return
 		}
 	}
@@ -220,7 +221,7 @@ func (s *Server) buildGraphFromDB() *SystemGraphResponse {
 	end := time.Now()
 	start := end.Add(-1 * time.Hour)
 
-	svcMap, err := s.repo.GetServiceMapMetrics(start, end)
+	svcMap, err := s.repo.GetServiceMapMetricsContext(context.Background(), start, end)
 	if err != nil {
 		slog.Error("Failed to get service map for system graph", "error", err)
 		return nil
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// GzipMiddleware compresses JSON and text responses under /api/ for clients that
+// accept gzip. A response is held back until minBytes have been written: smaller
+// ones go out as is, since compressing them costs more than it saves. minBytes <= 0
+// turns compression off.
+func GzipMiddleware(minBytes int, next http.Handler) http.Handler {
+	if minBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !strings.HasPrefix(r.URL.Path, "/api/") || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w, min: minBytes}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(token), "gzip") {
+			continue
+		}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil {
+				return q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressible reports whether a response of the content type is worth compressing;
+// binary downloads such as backups and profiles are sent as is.
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/")
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether to
+// compress it, then streams the rest.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	min     int
+	status  int    // held until the header is sent
+	buf     []byte // body written before the decision
+	started bool
+	gz      *gzip.Writer // nil when sent uncompressed
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if !g.started && g.status == 0 {
+		g.status = code
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.started {
+		g.buf = append(g.buf, p...)
+		if len(g.buf) < g.min {
+			return len(p), nil
+		}
+		if err := g.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far, so streamed responses keep streaming.
+func (g *gzipResponseWriter) Flush() {
+	if !g.started {
+		g.start(true)
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// start sends the header and the buffered body, compressed if compress is set and
+// the handler has neither encoded the body itself nor sent a binary type.
+func (g *gzipResponseWriter) start(compress bool) error {
+	g.started = true
+	h := g.Header()
+	if h.Get("Content-Type") == "" && len(g.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+	if compress && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = gzipWriters.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+
+	buf := g.buf
+	g.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if g.gz != nil {
+		_, err := g.gz.Write(buf)
+		return err
+	}
+	_, err := g.ResponseWriter.Write(buf)
+	return err
+}
+
+// close sends a response that stayed under the threshold, or finishes the gzip
+// stream.
+func (g *gzipResponseWriter) close() {
+	if !g.started {
+		if g.status == 0 && len(g.buf) == 0 {
+			return // nothing written; let net/http send its default 200
+		}
+		g.start(false)
+		return
+	}
+	if g.gz != nil {
+		g.gz.Close()
+		gzipWriters.Put(g.gz)
+		g.gz = nil
+	}
+}
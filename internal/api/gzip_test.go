@@ -0,0 +1,72 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("x", 4096) + `"}`
+	h := GzipMiddleware(1024, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"ok":true}`)
+		case "/api/binary":
+			w.Header().Set("Content-Type", "application/vnd.sqlite3")
+			io.WriteString(w, large)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			// Written in pieces, so the threshold is crossed mid-response.
+			for i := 0; i < len(large); i += 100 {
+				io.WriteString(w, large[i:min(i+100, len(large))])
+			}
+		}
+	}))
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/traces", "br, gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("headers = %v, want gzip encoding and Vary", rec.Header())
+	}
+	if rec.Body.Len() >= len(large) {
+		t.Errorf("compressed body is %d bytes, original %d", rec.Body.Len(), len(large))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := io.ReadAll(zr); err != nil || string(body) != large {
+		t.Errorf("round trip: %d bytes, err %v; want the original %d bytes", len(body), err, len(large))
+	}
+
+	for _, c := range []struct{ path, accept string }{
+		{"/api/small", "gzip"},
+		{"/api/binary", "gzip"},
+		{"/api/traces", ""},
+		{"/api/traces", "gzip;q=0"},
+		{"/other", "gzip"},
+	} {
+		rec := get(c.path, c.accept)
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("%s with %q: Content-Encoding %q, want none", c.path, c.accept, enc)
+		}
+	}
+	if rec := get("/api/small", "gzip"); rec.Code != http.StatusCreated || rec.Body.String() != `{"ok":true}` {
+		t.Errorf("small response = %d %q", rec.Code, rec.Body)
+	}
+}
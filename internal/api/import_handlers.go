@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/importer"
+)
+
+// defaultImportMaxBytes caps import uploads when SetImportMaxBytes was not called.
+const defaultImportMaxBytes = 256 << 20
+
+// handleImport handles POST /api/import?format=jaeger|otlp-json. The file is sent
+// either as the "file" field of a multipart form or as the raw request body, and is
+// imported while it streams in. Traces that already exist are skipped.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	format, err := importer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	limit := s.importMax
+	if limit <= 0 {
+		limit = defaultImportMaxBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	body, err := importFile(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	res, err := importer.Import(s.store(r), format, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+				fmt.Sprintf("import file exceeds %d bytes; traces before the cut-off were imported", limit), res)
+		case errors.Is(err, importer.ErrInvalidInput):
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument, err.Error(), res)
+		default:
+			writeInternalError(w, "Failed to import traces", err, "format", format)
+		}
+		return
+	}
+
+	slog.Info("Imported traces", "format", format, "traces", res.Traces, "spans", res.Spans, "logs", res.Logs, "skipped_traces", res.SkippedTraces)
+	if res.Traces > 0 && s.eventHub != nil {
+		s.eventHub.NotifyRefresh()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// importFile returns the uploaded file: the "file" part of a multipart form, read
+// part by part so it is never buffered whole, or else the request body itself.
+func importFile(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("invalid multipart body: %w", err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New(`multipart body has no "file" field`)
+			}
+			return nil, fmt.Errorf("invalid multipart body: %w", err)
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
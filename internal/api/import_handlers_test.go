@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/importer"
+)
+
+const importDoc = `{"data":[{"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spans":[{"spanID":"00f067aa0ba902b7","operationName":"GET /","startTime":1760000000000000,"duration":1000,"processID":"p1"}],"processes":{"p1":{"serviceName":"web"}}}]}`
+
+func TestImportMultipartUpload(t *testing.T) {
+	s, repo := newTestServer(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("note", "from staging")
+	fw, _ := mw.CreateFormFile("file", "trace.json")
+	fw.Write([]byte(importDoc))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/import?format=jaeger", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	s.handleImport(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var res importer.Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Traces != 1 || res.Spans != 1 {
+		t.Errorf("result = %+v, want 1 trace and 1 span", res)
+	}
+	if _, err := repo.GetTrace("4bf92f3577b34da6a3ce929d0e0e4736"); err != nil {
+		t.Errorf("imported trace not found: %v", err)
+	}
+}
+
+func TestImportRejectsOversizedBody(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetImportMaxBytes(64)
+
+	rec := httptest.NewRecorder()
+	s.handleImport(rec, httptest.NewRequest(http.MethodPost, "/api/import?format=jaeger", strings.NewReader(importDoc)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Code != ErrCodeTooLarge {
+		t.Errorf("code = %q, want %q", e.Code, ErrCodeTooLarge)
+	}
+}
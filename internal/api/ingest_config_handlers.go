@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+)
+
+// handleGetIngestConfig handles GET /api/admin/ingest-config
+func (s *Server) handleGetIngestConfig(w http.ResponseWriter, r *http.Request) {
+	if s.filters == nil {
+		writeUnavailable(w, "ingest filters are not configurable")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.filters.Get())
+}
+
+// handlePutIngestConfig handles PUT /api/admin/ingest-config. The body replaces the
+// whole filter configuration; omitted service lists become empty.
+func (s *Server) handlePutIngestConfig(w http.ResponseWriter, r *http.Request) {
+	if s.filters == nil {
+		writeUnavailable(w, "ingest filters are not configurable")
+		return
+	}
+	var c ingest.FilterConfig
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	applied, err := s.filters.Update(c)
+	if err != nil {
+		if errors.Is(err, ingest.ErrInvalidFilters) {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		writeInternalError(w, "Failed to save ingest config", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(applied)
+}
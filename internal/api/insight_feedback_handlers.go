@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
+)
+
+// InsightFeedbackResponse is the response of POST /api/logs/{id}/insight/feedback.
+type InsightFeedbackResponse struct {
+	Feedback    storage.InsightFeedback    `json:"feedback"`
+	Suppression storage.InsightSuppression `json:"suppression"`
+}
+
+// handleCreateInsightFeedback handles POST /api/logs/{id}/insight/feedback
+// Body: {"rating": "helpful"|"unhelpful", "comment": "..."}. The response carries
+// whether analysis of the log's error fingerprint is now suppressed.
+func (s *Server) handleCreateInsightFeedback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "invalid id")
+		return
+	}
+	var body struct {
+		Rating  string `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+
+	f := storage.InsightFeedback{LogID: uint(id), Rating: body.Rating, Comment: body.Comment}
+	if err := s.store(r).CreateInsightFeedback(&f); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidFeedback):
+			writeBadRequest(w, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeNotFound(w, "log not found")
+		default:
+			writeInternalError(w, "Failed to record insight feedback", err, "id", id)
+		}
+		return
+	}
+	sup, err := s.store(r).GetInsightSuppression(f.Fingerprint, s.suppressAfter)
+	if err != nil {
+		writeInternalError(w, "Failed to get insight suppression", err, "fingerprint", f.Fingerprint)
+		return
+	}
+
+	slog.Info("Insight feedback recorded", "log_id", id, "rating", f.Rating, "fingerprint", f.Fingerprint, "suppressed", sup.Suppressed)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(InsightFeedbackResponse{Feedback: f, Suppression: sup})
+}
+
+// handleGetInsightFeedbackSummary handles GET /api/ai/feedback/summary
+// Ratings per service, most rated first, for tuning the prompt.
+func (s *Server) handleGetInsightFeedbackSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.store(r).GetInsightFeedbackSummary(s.suppressAfter)
+	if err != nil {
+		writeInternalError(w, "Failed to summarize insight feedback", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestInsightFeedback(t *testing.T) {
+	s, repo := newTestServer(t)
+	s.suppressAfter = 2
+	logs := []storage.Log{{ServiceName: "checkout", Severity: "ERROR", Body: "payment 123 declined", Timestamp: time.Now()}}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(int(logs[0].ID))
+
+	post := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/logs/"+id+"/insight/feedback", strings.NewReader(body))
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		s.handleCreateInsightFeedback(rec, req)
+		return rec
+	}
+	if rec := post("9999", `{"rating":"helpful"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("missing log: status = %d, want 404", rec.Code)
+	}
+	if rec := post(id, `{"rating":"great"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad rating: status = %d, want 400", rec.Code)
+	}
+
+	var res InsightFeedbackResponse
+	for i := range 2 {
+		rec := post(id, `{"rating":"unhelpful","comment":"generic advice"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if want := i == 1; res.Suppression.Suppressed != want {
+			t.Errorf("after %d unhelpful ratings: suppressed = %v, want %v", i+1, res.Suppression.Suppressed, want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/"+id+"/insight", nil)
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	s.handleGetLogInsight(rec, req)
+	var insight LogInsight
+	if err := json.Unmarshal(rec.Body.Bytes(), &insight); err != nil {
+		t.Fatal(err)
+	}
+	if !insight.Suppression.Suppressed || insight.Suppression.Fingerprint != res.Feedback.Fingerprint {
+		t.Errorf("insight = %+v, want the suppressed fingerprint", insight)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleGetInsightFeedbackSummary(rec, httptest.NewRequest(http.MethodGet, "/api/ai/feedback/summary", nil))
+	var summary []storage.InsightFeedbackSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 1 || summary[0].ServiceName != "checkout" || summary[0].Unhelpful != 2 || summary[0].Suppressed != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
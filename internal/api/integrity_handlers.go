@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// Integrity job states.
+const (
+	IntegrityRunning = "running"
+	IntegrityDone    = "done"
+	IntegrityFailed  = "failed"
+)
+
+// IntegrityJob is a background database integrity check started by
+// POST /api/admin/integrity and polled through GET /api/admin/integrity/{id}.
+type IntegrityJob struct {
+	ID         string                   `json:"id"`
+	Status     string                   `json:"status"`
+	Quick      bool                     `json:"quick"`
+	Repair     bool                     `json:"repair"`
+	StartedAt  time.Time                `json:"started_at"`
+	FinishedAt *time.Time               `json:"finished_at,omitempty"`
+	Report     *storage.IntegrityReport `json:"report,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+// integrityJobs runs one integrity check at a time and remembers the latest.
+type integrityJobs struct {
+	mu     sync.Mutex
+	latest *IntegrityJob
+	wg     sync.WaitGroup // the running check
+}
+
+// get returns a copy of the job with the given ID, or nil if it is not the latest.
+func (j *integrityJobs) get(id string) *IntegrityJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.latest == nil || j.latest.ID != id {
+		return nil
+	}
+	job := *j.latest
+	return &job
+}
+
+// start launches check in the background unless a job is still running, in which
+// case that job is returned with started false.
+func (j *integrityJobs) start(quick, repair bool, check func() (*storage.IntegrityReport, error)) (job IntegrityJob, started bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.latest != nil && j.latest.Status == IntegrityRunning {
+		return *j.latest, false
+	}
+	j.latest = &IntegrityJob{
+		ID:        newCorrelationID(),
+		Status:    IntegrityRunning,
+		Quick:     quick,
+		Repair:    repair,
+		StartedAt: time.Now().UTC(),
+	}
+	running := j.latest
+
+	j.wg.Go(func() {
+		report, err := check()
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		finished := time.Now().UTC()
+		running.FinishedAt = &finished
+		switch {
+		case err == nil:
+			running.Status = IntegrityDone
+			running.Report = report
+		case errors.Is(err, storage.ErrIntegrityUnsupported):
+			running.Status = IntegrityFailed
+			running.Error = err.Error()
+		default:
+			// Same policy as writeInternalError: the details stay in the server log.
+			running.Status = IntegrityFailed
+			running.Error = "integrity check failed (correlation_id " + running.ID + ")"
+			slog.Error("Database integrity check failed", "error", err, "correlation_id", running.ID)
+		}
+	})
+	return *running, true
+}
+
+// handleStartIntegrityCheck handles POST /api/admin/integrity?quick=true&repair=true
+//
+// The check runs in the background; the response is the new job with its status URL
+// in the Location header. Only one check runs at a time — a second request gets 409
+// with the running job as details.
+func (s *Server) handleStartIntegrityCheck(w http.ResponseWriter, r *http.Request) {
+	quick := r.URL.Query().Get("quick") == "true"
+	repair := r.URL.Query().Get("repair") == "true"
+
+	job, started := s.integrity.start(quick, repair, func() (*storage.IntegrityReport, error) {
+		return s.repo.CheckIntegrity(s.jobContext(), quick, repair)
+	})
+	if !started {
+		writeError(w, http.StatusConflict, ErrCodeConflict, "an integrity check is already running", job)
+		return
+	}
+	slog.Warn("Admin integrity check started", "job_id", job.ID, "quick", quick, "repair", repair, "remote_addr", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/admin/integrity/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleGetIntegrityCheck handles GET /api/admin/integrity/{id}
+func (s *Server) handleGetIntegrityCheck(w http.ResponseWriter, r *http.Request) {
+	job := s.integrity.get(r.PathValue("id"))
+	if job == nil {
+		writeNotFound(w, "integrity check not found; only the most recent one is kept")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
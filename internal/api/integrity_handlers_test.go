@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestIntegrityCheckJob(t *testing.T) {
+	s, _ := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/admin/integrity", s.handleStartIntegrityCheck)
+	mux.HandleFunc("GET /api/admin/integrity/{id}", s.handleGetIntegrityCheck)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/admin/integrity?repair=true", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want 202 (%s)", rec.Code, rec.Body.String())
+	}
+	var job IntegrityJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	location := rec.Header().Get("Location")
+	if job.ID == "" || !job.Repair || location != "/api/admin/integrity/"+job.ID {
+		t.Fatalf("job = %+v, Location = %q", job, location)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == IntegrityRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, location, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET status = %d (%s)", rec.Code, rec.Body.String())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != IntegrityDone || job.FinishedAt == nil || job.Report == nil || !job.Report.OK || !job.Report.Reindexed {
+		t.Fatalf("finished job = %+v, report %+v, want a clean repaired report", job, job.Report)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/integrity/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", rec.Code)
+	}
+}
+
+func TestIntegrityCheckOneAtATime(t *testing.T) {
+	var jobs integrityJobs
+	release := make(chan struct{})
+	defer close(release)
+	first, started := jobs.start(false, false, func() (*storage.IntegrityReport, error) {
+		<-release
+		return &storage.IntegrityReport{OK: true}, nil
+	})
+	if !started {
+		t.Fatal("first job did not start")
+	}
+	running, started := jobs.start(true, true, nil)
+	if started || running.ID != first.ID {
+		t.Errorf("second start = %+v (started %v), want the running job back", running, started)
+	}
+}
+
+func TestStopCancelsIntegrityCheck(t *testing.T) {
+	s := NewServer(nil, nil, nil)
+	job, _ := s.integrity.start(false, false, func() (*storage.IntegrityReport, error) {
+		<-s.jobContext().Done()
+		return nil, s.jobContext().Err()
+	})
+	s.Stop()
+	if got := s.integrity.get(job.ID); got == nil || got.Status != IntegrityFailed {
+		t.Errorf("job after Stop = %+v, want it failed", got)
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/liveness"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+// ServiceLivenessResponse is the response of GET /api/services/liveness.
+type ServiceLivenessResponse struct {
+	StaleAfter string             `json:"stale_after"` // "0s" = stale detection off
+	Services   []liveness.Service `json:"services"`
+}
+
+// handleGetServiceLiveness handles GET /api/services/liveness
+// When each service last exported spans, logs and metrics, its ingest lag and clock
+// skew, and whether it has gone quiet.
+func (s *Server) handleGetServiceLiveness(w http.ResponseWriter, r *http.Request) {
+	if s.liveness == nil {
+		writeUnavailable(w, "service liveness is not tracked")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ServiceLivenessResponse{
+		StaleAfter: s.liveness.StaleAfter().String(),
+		Services:   s.liveness.Services(tenant.Scope(r.Context())),
+	})
+}
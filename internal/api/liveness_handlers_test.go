@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/liveness"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+func TestGetServiceLiveness(t *testing.T) {
+	s, repo := newTestServer(t)
+	get := func(id *tenant.Identity) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/services/liveness", nil)
+		if id != nil {
+			req = req.WithContext(tenant.NewContext(req.Context(), *id))
+		}
+		rec := httptest.NewRecorder()
+		s.handleGetServiceLiveness(rec, req)
+		return rec
+	}
+	if rec := get(nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a tracker: status = %d, want 503", rec.Code)
+	}
+
+	tr := liveness.New(repo, time.Minute, 5*time.Minute, time.Minute)
+	if err := tr.Load(); err != nil {
+		t.Fatal(err)
+	}
+	tr.Observe("alpha", "api", liveness.SignalSpans, time.Now())
+	tr.Observe("beta", "web", liveness.SignalLogs, time.Now())
+	s.SetLiveness(tr)
+
+	var all, beta ServiceLivenessResponse
+	if rec := get(nil); rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &all) != nil {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if all.StaleAfter != "5m0s" || len(all.Services) != 2 || all.Services[0].LastSpanAt == nil {
+		t.Errorf("all tenants = %+v", all)
+	}
+	rec := get(&tenant.Identity{Tenant: "beta"})
+	if json.Unmarshal(rec.Body.Bytes(), &beta) != nil || len(beta.Services) != 1 || beta.Services[0].ServiceName != "web" {
+		t.Errorf("beta = %s, want only web", rec.Body)
+	}
+}
@@ -2,16 +2,26 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/RandomCodeSpace/otelcontext/internal/realtime"
 	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
 )
 
-// handleGetLogs handles GET /api/logs with advanced filtering
+// handleGetLogs handles GET /api/logs with advanced filtering. A full page carries
+// next_cursor; passing it back as cursor= continues by keyset instead of offset.
+// Repeated attr=key:value params match indexed log attributes (LOG_INDEXED_ATTRIBUTES).
+// include_trace_summary=true adds a summary of each log's trace, so dead trace links
+// can be told apart; has_trace=false lists logs whose trace is not stored. fields=
+// limits each log to the listed JSON fields. Unless view=full, bodies are cut to a
+// preview and attributes and AI insights are left for GET /api/logs/{id}.
 func (s *Server) handleGetLogs(w http.ResponseWriter, r *http.Request) {
 	limit := 50
 	offset := 0
@@ -27,100 +37,292 @@ func (s *Server) handleGetLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	filter.Limit = limit
+	filter.Offset = offset
+	filter.Fields = parseFields(r)
+	switch r.URL.Query().Get("view") {
+	case "", "summary":
+		filter.Summary = true
+	case "full":
+	default:
+		writeBadRequest(w, "view must be summary or full")
+		return
+	}
+
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err := storage.ParseLogCursor(c)
+		if err != nil {
+			writeBadRequest(w, "invalid cursor: "+err.Error())
+			return
+		}
+		filter.Cursor = cursor
+	}
+
+	logs, total, err := s.store(r).GetLogsV2Context(r.Context(), filter)
+	if errors.Is(err, storage.ErrAttributeNotIndexed) {
+		writeBadRequest(w, err.Error()+"; add it to LOG_INDEXED_ATTRIBUTES")
+		return
+	}
+	if errors.Is(err, storage.ErrUnknownField) {
+		writeBadRequest(w, "invalid fields: "+err.Error())
+		return
+	}
+	if err != nil {
+		writeQueryError(w, r, "Failed to get logs", err)
+		return
+	}
+	if r.URL.Query().Get("include_trace_summary") == "true" {
+		if err := s.store(r).AttachTraceSummaries(logs); err != nil {
+			writeInternalError(w, "Failed to get trace summaries", err)
+			return
+		}
+	}
+
+	resp := map[string]interface{}{
+		"data":  logs,
+		"total": total,
+	}
+	if len(filter.Fields) > 0 {
+		resp["data"] = projectRows(logs, filter.Fields)
+	}
+	if limit > 0 && len(logs) == limit {
+		resp["next_cursor"] = storage.LogCursorAfter(logs[len(logs)-1]).String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseLogFilter reads the log search parameters shared by /api/logs and
+// /api/traces/by-logs: service_name, severity, search, scope_name, repeated
+// attr=key:value, has_trace, synthetic, start and end. Paging is left to the caller.
+func parseLogFilter(r *http.Request) (storage.LogFilter, error) {
+	q := r.URL.Query()
 	filter := storage.LogFilter{
-		ServiceName: r.URL.Query().Get("service_name"),
-		Severity:    r.URL.Query().Get("severity"),
-		Search:      r.URL.Query().Get("search"),
-		Limit:       limit,
-		Offset:      offset,
+		ServiceName: q.Get("service_name"),
+		Severity:    q.Get("severity"),
+		Search:      q.Get("search"),
+		ScopeName:   q.Get("scope_name"),
+	}
+
+	for _, a := range q["attr"] {
+		key, value, ok := strings.Cut(a, ":")
+		if !ok || key == "" {
+			return filter, errors.New("attr must be key:value")
+		}
+		filter.Attributes = append(filter.Attributes, storage.AttributeFilter{Key: key, Value: value})
+	}
+
+	if v := q.Get("has_trace"); v != "" {
+		hasTrace, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("has_trace must be true or false")
+		}
+		filter.HasTrace = &hasTrace
+	}
+	if v := q.Get("synthetic"); v != "" {
+		synthetic, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("synthetic must be true or false")
+		}
+		filter.Synthetic = &synthetic
 	}
 
-	if startStr := r.URL.Query().Get("start"); startStr != "" {
+	if startStr := q.Get("start"); startStr != "" {
 		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
 			filter.StartTime = t
 		}
 	}
-	if endStr := r.URL.Query().Get("end"); endStr != "" {
+	if endStr := q.Get("end"); endStr != "" {
 		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
 			filter.EndTime = t
 		}
 	}
+	return filter, nil
+}
+
+// handleGetLog handles GET /api/logs/{id}, returning the whole log.
+func (s *Server) handleGetLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeBadRequest(w, "invalid id")
+		return
+	}
 
-	logs, total, err := s.repo.GetLogsV2(filter)
+	l, err := s.store(r).GetLog(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "log not found")
+		return
+	}
 	if err != nil {
-		slog.Error("Failed to get logs", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to get log", err, "id", id)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":  logs,
-		"total": total,
-	})
+	json.NewEncoder(w).Encode(l)
 }
 
-// handleGetLogContext handles GET /api/logs/context
+// handleGetLogContext handles GET /api/logs/context. It returns at most limit logs
+// within window of timestamp, balanced around it; older_cursor and newer_cursor
+// from a previous page, passed back as older= or newer= with the same timestamp,
+// load further logs in that direction.
 func (s *Server) handleGetLogContext(w http.ResponseWriter, r *http.Request) {
-	tsStr := r.URL.Query().Get("timestamp")
+	q := r.URL.Query()
+	tsStr := q.Get("timestamp")
 	if tsStr == "" {
-		http.Error(w, "missing timestamp", http.StatusBadRequest)
+		writeBadRequest(w, "missing timestamp")
 		return
 	}
 
 	ts, err := time.Parse(time.RFC3339, tsStr)
 	if err != nil {
 		slog.Warn("Invalid timestamp format for log context", "timestamp", tsStr)
-		http.Error(w, "invalid timestamp format", http.StatusBadRequest)
+		writeBadRequest(w, "invalid timestamp format")
+		return
+	}
+
+	query := storage.LogContextQuery{
+		Target:      ts,
+		Window:      storage.DefaultLogContextWindow,
+		ServiceName: q.Get("service_name"),
+		Limit:       storage.DefaultLogContextLimit,
+	}
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > storage.MaxLogContextWindow {
+			writeBadRequest(w, "window must be a positive duration of at most "+storage.MaxLogContextWindow.String())
+			return
+		}
+		query.Window = d
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > storage.MaxLogContextLimit {
+			writeBadRequest(w, "limit must be between 1 and "+strconv.Itoa(storage.MaxLogContextLimit))
+			return
+		}
+		query.Limit = n
+	}
+	older, newer := q.Get("older"), q.Get("newer")
+	if older != "" && newer != "" {
+		writeBadRequest(w, "older and newer are mutually exclusive")
 		return
 	}
+	if older != "" {
+		if query.Older, err = storage.ParseLogCursor(older); err != nil {
+			writeBadRequest(w, "invalid older cursor: "+err.Error())
+			return
+		}
+	}
+	if newer != "" {
+		if query.Newer, err = storage.ParseLogCursor(newer); err != nil {
+			writeBadRequest(w, "invalid newer cursor: "+err.Error())
+			return
+		}
+	}
 
-	logs, err := s.repo.GetLogContext(ts)
+	page, err := s.store(r).GetLogContext(r.Context(), query)
 	if err != nil {
-		slog.Error("Failed to get log context", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeQueryError(w, r, "Failed to get log context", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(logs)
+	json.NewEncoder(w).Encode(page)
+}
+
+// LogInsight is the response of GET /api/logs/{id}/insight.
+type LogInsight struct {
+	Insight     string                     `json:"insight"`
+	Suppression storage.InsightSuppression `json:"suppression"` // of the log's error fingerprint
 }
 
 // handleGetLogInsight handles GET /api/logs/{id}/insight
 func (s *Server) handleGetLogInsight(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	if idStr == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+		writeBadRequest(w, "missing id")
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
+		writeBadRequest(w, "invalid id")
 		return
 	}
 
-	l, err := s.repo.GetLog(uint(id))
+	l, err := s.store(r).GetLog(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "log not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "Failed to get log for insight", err, "id", id)
+		return
+	}
+
+	sup, err := s.store(r).GetInsightSuppression(storage.ErrorFingerprint(l.ServiceName, string(l.Body)), s.suppressAfter)
 	if err != nil {
-		slog.Error("Log not found for insight", "id", id, "error", err)
-		http.Error(w, "log not found", http.StatusNotFound)
+		writeInternalError(w, "Failed to get insight suppression", err, "id", id)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"insight": string(l.AIInsight)})
+	json.NewEncoder(w).Encode(LogInsight{Insight: string(l.AIInsight), Suppression: sup})
+}
+
+// handleGetLogRaw handles GET /api/logs/{id}/raw. It writes the stored body alone,
+// without the JSON envelope, so it can be copied or piped as is. A body cut at ingest
+// keeps its truncation marker and is flagged with X-Body-Truncated.
+func (s *Server) handleGetLogRaw(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeBadRequest(w, "invalid id")
+		return
+	}
+
+	l, err := s.store(r).GetLog(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "log not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "Failed to get log", err, "id", id)
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	switch l.BodyType {
+	case storage.BodyTypeKvlist, storage.BodyTypeArray, storage.BodyTypeBytes:
+		contentType = "application/json" // stored JSON-encoded
+	}
+	w.Header().Set("Content-Type", contentType)
+	if l.Truncated {
+		w.Header().Set("X-Body-Truncated", "true")
+	}
+	io.WriteString(w, string(l.Body))
 }
 
-// BroadcastLog sends a log entry to the buffered WebSocket hub.
+// BroadcastLog sends a log entry to the live clients of /ws and /ws/events.
 func (s *Server) BroadcastLog(l storage.Log) {
-	s.hub.Broadcast(realtime.LogEntry{
+	s.eventHub.BroadcastLog(realtime.LogEntry{
 		ID:             l.ID,
 		TraceID:        l.TraceID,
 		SpanID:         l.SpanID,
 		Severity:       l.Severity,
 		Body:           string(l.Body),
+		BodyType:       l.BodyType,
+		Truncated:      l.Truncated,
 		ServiceName:    l.ServiceName,
+		Environment:    l.Environment,
 		AttributesJSON: string(l.AttributesJSON),
 		AIInsight:      string(l.AIInsight),
 		Timestamp:      l.Timestamp,
+		TenantID:       l.TenantID,
 	})
 }
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestGetLogRaw(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now()
+	logs := []storage.Log{
+		{ServiceName: "svc", Severity: "ERROR", Body: "payload...[truncated 42 bytes]", Truncated: true, Timestamp: now},
+		{ServiceName: "svc", Severity: "INFO", Body: `{"user":"a"}`, BodyType: storage.BodyTypeKvlist, Timestamp: now.Add(time.Second)},
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/logs", s.handleGetLogs)
+	mux.HandleFunc("GET /api/logs/{id}/raw", s.handleGetLogRaw)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/api/logs/" + strconv.Itoa(int(logs[0].ID)) + "/raw")
+	if rec.Code != http.StatusOK || rec.Body.String() != "payload...[truncated 42 bytes]" {
+		t.Fatalf("raw = %d %q", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Content-Type") != "text/plain; charset=utf-8" || rec.Header().Get("X-Body-Truncated") != "true" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+	rec = get("/api/logs/" + strconv.Itoa(int(logs[1].ID)) + "/raw")
+	if rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("X-Body-Truncated") != "" || rec.Body.String() != `{"user":"a"}` {
+		t.Errorf("kvlist raw = %v %q", rec.Header(), rec.Body)
+	}
+	if rec := get("/api/logs/99999/raw"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing log = %d, want 404", rec.Code)
+	}
+
+	var list struct {
+		Data []storage.Log `json:"data"`
+	}
+	json.Unmarshal(get("/api/logs").Body.Bytes(), &list)
+	if len(list.Data) != 2 || list.Data[0].Truncated || !list.Data[1].Truncated {
+		t.Errorf("truncated flags in /api/logs = %+v", list.Data)
+	}
+}
+
+func TestSyntheticLogFilter(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now()
+	if err := repo.BatchCreateLogs([]storage.Log{
+		{ServiceName: "svc", Severity: "ERROR", Body: "payment declined", Timestamp: now.Add(-time.Minute)},
+		{ServiceName: "svc", Severity: "ERROR", Body: "Span 'charge' failed", Synthetic: true, Timestamp: now.Add(-time.Minute + time.Second)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(h http.HandlerFunc, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		return rec
+	}
+
+	for query, want := range map[string]string{"": "2", "synthetic=true": "Span 'charge' failed", "synthetic=false": "payment declined"} {
+		var list struct {
+			Data []storage.Log `json:"data"`
+		}
+		json.Unmarshal(get(s.handleGetLogs, query).Body.Bytes(), &list)
+		got := strconv.Itoa(len(list.Data))
+		if len(list.Data) == 1 {
+			got = string(list.Data[0].Body)
+		}
+		if got != want {
+			t.Errorf("/api/logs?%s = %s, want %s", query, got, want)
+		}
+	}
+
+	for query, want := range map[string]int64{"": 2, "synthetic=true": 2, "synthetic=false": 1} {
+		var stats storage.DashboardStats
+		json.Unmarshal(get(s.handleGetDashboardStats, query).Body.Bytes(), &stats)
+		if stats.ErrorLogs != want || stats.TotalLogs != want {
+			t.Errorf("dashboard?%s: %d logs, %d error logs; want %d", query, stats.TotalLogs, stats.ErrorLogs, want)
+		}
+	}
+
+	for _, h := range []http.HandlerFunc{s.handleGetLogs, s.handleGetDashboardStats} {
+		if rec := get(h, "synthetic=maybe"); rec.Code != http.StatusBadRequest {
+			t.Errorf("synthetic=maybe: status = %d, want 400", rec.Code)
+		}
+	}
+}
+
+func TestGetLogsSummaryView(t *testing.T) {
+	s, repo := newTestServer(t)
+	long := strings.Repeat("x", storage.LogPreviewRunes+1)
+	logs := []storage.Log{{ServiceName: "svc", Severity: "ERROR", Body: storage.CompressedText(long), AttributesJSON: `{"k":"v"}`, Timestamp: time.Now()}}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/logs", s.handleGetLogs)
+	mux.HandleFunc("GET /api/logs/{id}", s.handleGetLog)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	list := func(query string) storage.Log {
+		t.Helper()
+		var resp struct {
+			Data []storage.Log `json:"data"`
+		}
+		if err := json.Unmarshal(get("/api/logs"+query).Body.Bytes(), &resp); err != nil || len(resp.Data) != 1 {
+			t.Fatalf("/api/logs%s = %d logs, %v", query, len(resp.Data), err)
+		}
+		return resp.Data[0]
+	}
+
+	if l := list(""); !l.BodyPreview || len(l.Body) >= len(long)+len("…") || l.AttributesJSON != "" {
+		t.Errorf("default view = body %d bytes (preview %v), attributes %q; want a preview without attributes", len(l.Body), l.BodyPreview, l.AttributesJSON)
+	}
+	if l := list("?view=full"); l.BodyPreview || string(l.Body) != long || l.AttributesJSON != `{"k":"v"}` {
+		t.Errorf("full view = %+v, want the whole row", l)
+	}
+	if rec := get("/api/logs?view=compact"); rec.Code != http.StatusBadRequest {
+		t.Errorf("view=compact: status = %d, want 400", rec.Code)
+	}
+
+	var detail storage.Log
+	rec := get("/api/logs/" + strconv.Itoa(int(logs[0].ID)))
+	if err := json.Unmarshal(rec.Body.Bytes(), &detail); err != nil || string(detail.Body) != long || detail.AttributesJSON != `{"k":"v"}` {
+		t.Errorf("GET /api/logs/{id} = %d %+v, want the whole log", rec.Code, detail)
+	}
+	if rec := get("/api/logs/99999"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing log = %d, want 404", rec.Code)
+	}
+}
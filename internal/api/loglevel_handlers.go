@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/logging"
+)
+
+// LogLevelState is the logging configuration reported by GET /api/admin/loglevel.
+type LogLevelState struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"` // component overrides only
+	Known      []string          `json:"known_components"`
+}
+
+// LogLevelUpdate is the body of PUT /api/admin/loglevel. Without a component it sets
+// the global level; with one it overrides that component, and an empty level clears
+// the override.
+type LogLevelUpdate struct {
+	Component string `json:"component,omitempty"`
+	Level     string `json:"level"`
+}
+
+func logLevelState() LogLevelState {
+	st := LogLevelState{
+		Level:      logging.Level().String(),
+		Components: map[string]string{},
+		Known:      logging.Components(),
+	}
+	for name, l := range logging.ComponentOverrides() {
+		st.Components[name] = l.String()
+	}
+	return st
+}
+
+// handleGetLogLevel handles GET /api/admin/loglevel
+func (s *Server) handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevelState())
+}
+
+// handlePutLogLevel handles PUT /api/admin/loglevel. The change lasts until the
+// process restarts; LOG_LEVEL applies again after that.
+func (s *Server) handlePutLogLevel(w http.ResponseWriter, r *http.Request) {
+	var u LogLevelUpdate
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	if u.Component != "" && u.Level == "" {
+		if !logging.SetComponentLevel(u.Component, nil) {
+			writeBadRequest(w, "unknown component: "+u.Component)
+			return
+		}
+	} else {
+		l, err := logging.ParseLevel(u.Level)
+		if err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		if u.Component == "" {
+			logging.SetLevel(l)
+		} else if !logging.SetComponentLevel(u.Component, &l) {
+			writeBadRequest(w, "unknown component: "+u.Component)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevelState())
+}
+
+// handlePprof serves the net/http/pprof profiles under /api/admin/pprof/.
+func handlePprof(w http.ResponseWriter, r *http.Request) {
+	switch name := r.PathValue("profile"); name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
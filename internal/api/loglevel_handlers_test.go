@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/logging"
+)
+
+func TestLogLevelEndpoints(t *testing.T) {
+	s, _ := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/admin/loglevel", s.handleGetLogLevel)
+	mux.HandleFunc("PUT /api/admin/loglevel", s.handlePutLogLevel)
+	logging.Component("api-test")
+	prev := logging.Level()
+	t.Cleanup(func() {
+		logging.SetLevel(prev)
+		logging.SetComponentLevel("api-test", nil)
+	})
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/admin/loglevel", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := put(`{"level":"debug"}`); rec.Code != http.StatusOK || logging.Level() != slog.LevelDebug {
+		t.Fatalf("global PUT: status %d, level %v (%s)", rec.Code, logging.Level(), rec.Body.String())
+	}
+	rec := put(`{"component":"api-test","level":"ERROR"}`)
+	var st LogLevelState
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Level != "DEBUG" || st.Components["api-test"] != "ERROR" {
+		t.Errorf("component PUT state = %+v", st)
+	}
+	if rec := put(`{"component":"api-test","level":""}`); !strings.Contains(rec.Body.String(), `"components":{}`) {
+		t.Errorf("clearing the override: %s", rec.Body.String())
+	}
+
+	for _, body := range []string{`{"level":"loud"}`, `{"component":"nope","level":"INFO"}`, `{"component":"nope"}`, `not json`} {
+		if rec := put(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestPprofRoutesGated(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		s, _ := newTestServer(t)
+		s.SetPprofEnabled(enabled)
+		mux := http.NewServeMux()
+		s.RegisterRoutes(mux)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/pprof/goroutine?debug=1", nil))
+		if got := rec.Code == http.StatusOK; got != enabled {
+			t.Errorf("enabled=%v: goroutine profile status %d", enabled, rec.Code)
+		}
+	}
+}
@@ -2,120 +2,257 @@ package api
 
 import (
 	"encoding/json"
-	"log/slog"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
 )
 
-// handleGetTrafficMetrics handles GET /api/metrics/traffic
+// handleGetTrafficMetrics handles GET /api/metrics/traffic. With group_by=service_name
+// it returns one zero-filled series per service (top K, plus an "other" rollup). With
+// compare_offset it returns a storage.TrafficComparison instead. Buckets and their
+// timestamps follow ?tz= (default DISPLAY_TIMEZONE).
 func (s *Server) handleGetTrafficMetrics(w http.ResponseWriter, r *http.Request) {
-	// Default to last 30 minutes if not specified
-	end := time.Now()
-	start := end.Add(-30 * time.Minute)
+	start, end, ok := s.timeRange(w, r, clampRange)
+	if !ok {
+		return
+	}
 
-	if startStr := r.URL.Query().Get("start"); startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			start = t
-		}
+	serviceNames := r.URL.Query()["service_name"]
+	loc, ok := s.location(w, r)
+	if !ok {
+		return
 	}
-	if endStr := r.URL.Query().Get("end"); endStr != "" {
-		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			end = t
+
+	if v := r.URL.Query().Get("compare_offset"); v != "" {
+		if r.URL.Query().Get("group_by") != "" {
+			writeBadRequest(w, "compare_offset cannot be combined with group_by")
+			return
 		}
+		shift, err := s.timeShift(v)
+		if err != nil {
+			writeBadRequest(w, "compare_offset: "+err.Error())
+			return
+		}
+		cmp, err := storage.GetTrafficComparison(s.store(r), start, end, serviceNames, shift)
+		if err != nil {
+			writeInternalError(w, "Failed to get traffic metrics", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cmp)
+		return
 	}
 
-	serviceNames := r.URL.Query()["service_name"]
+	if r.URL.Query().Get("group_by") == "service_name" {
+		top, _ := strconv.Atoi(r.URL.Query().Get("top"))
+		series, err := s.store(r).GetTrafficByService(start, end, serviceNames, top, loc)
+		if err != nil {
+			writeInternalError(w, "Failed to get traffic metrics", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+		return
+	}
 
-	points, err := s.repo.GetTrafficMetrics(start, end, serviceNames)
+	points, err := s.store(r).GetTrafficMetrics(start, end, serviceNames)
 	if err != nil {
-		slog.Error("Failed to get traffic metrics", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to get traffic metrics", err)
 		return
 	}
+	for i := range points {
+		points[i].Timestamp = points[i].Timestamp.In(loc)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(points)
 }
 
 // handleGetLatencyHeatmap handles GET /api/metrics/latency_heatmap
+// Returns a time × duration histogram with time buckets aligned in ?tz= (default
+// DISPLAY_TIMEZONE). ?format=points returns the legacy raw (timestamp, duration)
+// list, capped at 2000 points.
 func (s *Server) handleGetLatencyHeatmap(w http.ResponseWriter, r *http.Request) {
-	end := time.Now()
-	start := end.Add(-30 * time.Minute)
+	start, end, ok := s.timeRange(w, r, clampRange)
+	if !ok {
+		return
+	}
+
+	serviceNames := r.URL.Query()["service_name"]
 
-	if startStr := r.URL.Query().Get("start"); startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			start = t
+	if r.URL.Query().Get("format") == "points" {
+		points, err := s.store(r).GetLatencyHeatmap(start, end, serviceNames)
+		if err != nil {
+			writeInternalError(w, "Failed to get latency heatmap", err)
+			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(points)
+		return
 	}
-	if endStr := r.URL.Query().Get("end"); endStr != "" {
-		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			end = t
-		}
+
+	loc, ok := s.location(w, r)
+	if !ok {
+		return
+	}
+	heatmap, err := s.store(r).GetLatencyHistogram(start, end, serviceNames, loc)
+	if err != nil {
+		writeInternalError(w, "Failed to get latency heatmap", err)
+		return
 	}
 
-	serviceNames := r.URL.Query()["service_name"]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(heatmap)
+}
+
+// handleGetLatencyByStatus handles GET /api/metrics/latency_by_status
+// Root-span count, average and p95 latency per time bucket and HTTP status class,
+// with buckets aligned in ?tz= as for the latency heatmap.
+func (s *Server) handleGetLatencyByStatus(w http.ResponseWriter, r *http.Request) {
+	start, end, ok := s.timeRange(w, r, clampRange)
+	if !ok {
+		return
+	}
 
-	points, err := s.repo.GetLatencyHeatmap(start, end, serviceNames)
+	loc, ok := s.location(w, r)
+	if !ok {
+		return
+	}
+	res, err := s.store(r).GetLatencyByStatus(start, end, r.URL.Query()["service_name"], loc)
 	if err != nil {
-		slog.Error("Failed to get latency heatmap", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to get latency by status", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(points)
+	json.NewEncoder(w).Encode(res)
 }
 
 // handleGetDashboardStats handles GET /api/metrics/dashboard
 func (s *Server) handleGetDashboardStats(w http.ResponseWriter, r *http.Request) {
-	// Default to last 30 minutes if not specified
-	end := time.Now()
-	start := end.Add(-30 * time.Minute)
+	start, end, ok := s.timeRange(w, r, rejectRange)
+	if !ok {
+		return
+	}
 
-	if startStr := r.URL.Query().Get("start"); startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			start = t
-		}
+	serviceNames := r.URL.Query()["service_name"]
+	errorMode := r.URL.Query().Get("error_mode")
+	if !validErrorMode(errorMode) {
+		writeBadRequest(w, "error_mode must be root or rollup")
+		return
 	}
-	if endStr := r.URL.Query().Get("end"); endStr != "" {
-		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			end = t
+	view := storage.DashboardView{ErrorMode: errorMode}
+	if v := r.URL.Query().Get("synthetic"); v != "" {
+		synthetic, err := strconv.ParseBool(v)
+		if err != nil {
+			writeBadRequest(w, "synthetic must be true or false")
+			return
 		}
+		view.ExcludeSynthetic = !synthetic
 	}
 
-	serviceNames := r.URL.Query()["service_name"]
+	if v := r.URL.Query().Get("compare_offset"); v != "" {
+		shift, err := s.timeShift(v)
+		if err != nil {
+			writeBadRequest(w, "compare_offset: "+err.Error())
+			return
+		}
+		cmp, err := storage.GetDashboardComparison(r.Context(), s.store(r), start, end, serviceNames, shift, view)
+		if err != nil {
+			writeQueryError(w, r, "Failed to get dashboard stats", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cmp)
+		return
+	}
 
-	stats, err := s.repo.GetDashboardStats(start, end, serviceNames)
+	stats, err := s.store(r).GetDashboardStatsContext(r.Context(), start, end, serviceNames)
 	if err != nil {
-		slog.Error("Failed to get dashboard stats", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeQueryError(w, r, "Failed to get dashboard stats", err)
 		return
 	}
+	// total_errors and error_rate follow the requested mode; both counts stay in the
+	// payload so clients can show the difference.
+	view.Apply(stats)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
 
+// location returns the IANA time zone named by ?tz=, or the display time zone. An
+// unknown zone is answered with 400 and ok false.
+func (s *Server) location(w http.ResponseWriter, r *http.Request) (loc *time.Location, ok bool) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		if s.displayLoc != nil {
+			return s.displayLoc, true
+		}
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		writeBadRequest(w, "invalid tz: unknown time zone "+strconv.Quote(name))
+		return nil, false
+	}
+	return loc, true
+}
+
+// timeShift parses a compare_offset. Comparison windows older than the raw
+// retention are reported rather than compared against purged data.
+func (s *Server) timeShift(offset string) (storage.TimeShift, error) {
+	d, err := storage.ParseCompareOffset(offset)
+	if err != nil {
+		return storage.TimeShift{}, err
+	}
+	shift := storage.TimeShift{Offset: d}
+	if s.rawRetention > 0 {
+		shift.RetainedSince = time.Now().Add(-s.rawRetention)
+	}
+	return shift, nil
+}
+
 // handleGetServiceMapMetrics handles GET /api/metrics/service-map
 func (s *Server) handleGetServiceMapMetrics(w http.ResponseWriter, r *http.Request) {
-	end := time.Now()
-	start := end.Add(-30 * time.Minute)
+	start, end, ok := s.timeRange(w, r, rejectRange)
+	if !ok {
+		return
+	}
 
-	if startStr := r.URL.Query().Get("start"); startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			start = t
+	q := r.URL.Query()
+	filter := storage.ServiceMapFilter{Focus: q.Get("focus"), Depth: 1}
+	if v := q.Get("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeBadRequest(w, "depth must be >= 1")
+			return
+		}
+		if filter.Focus == "" {
+			writeBadRequest(w, "depth requires focus")
+			return
 		}
+		filter.Depth = n
 	}
-	if endStr := r.URL.Query().Get("end"); endStr != "" {
-		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			end = t
+	if v := q.Get("min_call_count"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeBadRequest(w, "min_call_count must be >= 0")
+			return
 		}
+		filter.MinCallCount = n
 	}
 
-	metrics, err := s.repo.GetServiceMapMetrics(start, end)
+	metrics, err := s.store(r).GetServiceMapContext(r.Context(), start, end, filter)
 	if err != nil {
-		slog.Error("Failed to get service map metrics", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeQueryError(w, r, "Failed to get service map metrics", err)
+		return
+	}
+	if metrics, err = s.withServiceMetadata(metrics); err != nil {
+		writeInternalError(w, "Failed to get service metadata", err)
 		return
 	}
 
@@ -123,11 +260,78 @@ func (s *Server) handleGetServiceMapMetrics(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(metrics)
 }
 
+// ServiceMapHistoryResponse is the service map around a past moment.
+type ServiceMapHistoryResponse struct {
+	At         time.Time                  `json:"at"`
+	Source     string                     `json:"source"` // "live" (computed from spans) or "snapshot"
+	Start      time.Time                  `json:"start"`
+	End        time.Time                  `json:"end"`
+	ServiceMap *storage.ServiceMapMetrics `json:"service_map"`
+}
+
+// handleGetServiceMapHistory handles GET /api/metrics/service-map/history
+func (s *Server) handleGetServiceMapHistory(w http.ResponseWriter, r *http.Request) {
+	at, err := time.Parse(time.RFC3339, r.URL.Query().Get("at"))
+	if err != nil {
+		writeBadRequest(w, "at must be an RFC3339 time")
+		return
+	}
+
+	// While spans are retained the map is computed exactly, over the same window a
+	// snapshot taken at that moment would cover.
+	resp := ServiceMapHistoryResponse{At: at, Source: "live", Start: at.Add(-s.mapWindow), End: at}
+	live := s.rawRetention <= 0 || at.After(time.Now().Add(-s.rawRetention))
+	if live {
+		resp.ServiceMap, err = s.store(r).GetServiceMapMetricsContext(r.Context(), resp.Start, resp.End)
+		if err != nil {
+			writeQueryError(w, r, "Failed to get service map metrics", err)
+			return
+		}
+		if len(resp.ServiceMap.Nodes) > 0 {
+			if resp.ServiceMap, err = s.withServiceMetadata(resp.ServiceMap); err != nil {
+				writeInternalError(w, "Failed to get service metadata", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+	}
+
+	// Past retention, or the spans were purged early: use the nearest snapshot. An
+	// empty live result is only replaced by a snapshot of the same window.
+	snap, err := s.repo.GetServiceMapSnapshotNear(at)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !live {
+			writeNotFound(w, "no service map snapshot stored")
+			return
+		}
+	case err != nil:
+		writeInternalError(w, "Failed to get service map snapshot", err)
+		return
+	case !live || snap.Timestamp.Sub(at).Abs() <= s.mapWindow:
+		m, err := snap.ServiceMap()
+		if err != nil {
+			writeInternalError(w, "Failed to decode service map snapshot", err, "snapshot_id", snap.ID)
+			return
+		}
+		resp = ServiceMapHistoryResponse{At: at, Source: "snapshot", Start: snap.Timestamp.Add(-snap.Window()), End: snap.Timestamp, ServiceMap: m}
+	}
+	if resp.ServiceMap, err = s.withServiceMetadata(resp.ServiceMap); err != nil {
+		writeInternalError(w, "Failed to get service metadata", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 // handleGetMetricBuckets handles GET /api/metrics
 func (s *Server) handleGetMetricBuckets(w http.ResponseWriter, r *http.Request) {
 	start, end, err := parseTimeRange(r)
 	if err != nil {
-		http.Error(w, "invalid time range", http.StatusBadRequest)
+		writeBadRequest(w, "invalid time range")
 		return
 	}
 
@@ -136,14 +340,13 @@ func (s *Server) handleGetMetricBuckets(w http.ResponseWriter, r *http.Request)
 
 	// name is required for bucket queries
 	if name == "" {
-		http.Error(w, "metric name is required", http.StatusBadRequest)
+		writeBadRequest(w, "metric name is required")
 		return
 	}
 
-	buckets, err := s.repo.GetMetricBuckets(start, end, serviceName, name)
+	buckets, err := s.store(r).GetMetricBuckets(start, end, serviceName, name)
 	if err != nil {
-		slog.Error("Failed to get metric buckets", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to get metric buckets", err)
 		return
 	}
 
@@ -152,27 +355,65 @@ func (s *Server) handleGetMetricBuckets(w http.ResponseWriter, r *http.Request)
 }
 
 // handleGetMetricNames handles GET /api/metadata/metrics
+// The metric catalog; ?names_only=true returns just the names, as before the catalog.
 func (s *Server) handleGetMetricNames(w http.ResponseWriter, r *http.Request) {
 	serviceName := r.URL.Query().Get("service_name")
 
-	names, err := s.repo.GetMetricNames(serviceName)
+	if r.URL.Query().Get("names_only") == "true" {
+		names, err := s.store(r).GetMetricNames(serviceName)
+		if err != nil {
+			writeInternalError(w, "Failed to get metric names", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(names)
+		return
+	}
+
+	catalog, err := s.store(r).GetMetricCatalog(serviceName)
 	if err != nil {
-		slog.Error("Failed to get metric names", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to get metric catalog", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(names)
+	json.NewEncoder(w).Encode(catalog)
 }
 
+// handleGetServices handles GET /api/metadata/services
+// With ?details=true each service comes with its catalog metadata.
 func (s *Server) handleGetServices(w http.ResponseWriter, r *http.Request) {
-	services, err := s.repo.GetServices()
+	services, err := s.store(r).GetServices()
+	if err != nil {
+		writeInternalError(w, "Failed to get services metadata", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("details") != "true" {
+		json.NewEncoder(w).Encode(services)
+		return
+	}
+
+	byName, err := s.serviceMetadataByName()
+	if err != nil {
+		writeInternalError(w, "Failed to get service metadata", err)
+		return
+	}
+	summaries := make([]ServiceSummary, len(services))
+	for i, name := range services {
+		summaries[i] = ServiceSummary{Name: name, Metadata: byName[name]}
+	}
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// handleGetEnvironments handles GET /api/metadata/environments
+// The values the env parameter of the read endpoints accepts.
+func (s *Server) handleGetEnvironments(w http.ResponseWriter, r *http.Request) {
+	envs, err := s.store(r).GetEnvironments()
 	if err != nil {
-		slog.Error("Failed to get services metadata", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, "Failed to get environments", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(services)
+	json.NewEncoder(w).Encode(envs)
 }
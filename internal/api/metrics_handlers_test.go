@@ -0,0 +1,310 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+)
+
+func TestServiceMapHistory(t *testing.T) {
+	s, repo := newTestServer(t)
+	s.SetServiceMapHistory(5*time.Minute, 24*time.Hour)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := repo.BatchCreateSpans([]storage.Span{{
+		TraceID: "t1", SpanID: "s1", OperationName: "GET /cart", ServiceName: "cart",
+		StartTime: now.Add(-time.Minute), EndTime: now.Add(-time.Minute + time.Millisecond),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	old := now.Add(-72 * time.Hour)
+	snapMap := &storage.ServiceMapMetrics{Nodes: []storage.ServiceMapNode{{Name: "legacy", TotalTraces: 7}}}
+	if err := repo.SaveServiceMapSnapshot(old, 5*time.Minute, snapMap); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(at time.Time) (int, ServiceMapHistoryResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleGetServiceMapHistory(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/service-map/history?at="+at.Format(time.RFC3339), nil))
+		var resp ServiceMapHistoryResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	// Within raw retention: computed from spans.
+	code, resp := get(now)
+	if code != http.StatusOK || resp.Source != "live" || len(resp.ServiceMap.Nodes) != 1 || resp.ServiceMap.Nodes[0].Name != "cart" {
+		t.Errorf("recent: status %d, response %+v, want the live map with cart", code, resp)
+	}
+
+	// Past raw retention: the nearest snapshot, with the window it covers.
+	code, resp = get(old.Add(20 * time.Minute))
+	if code != http.StatusOK || resp.Source != "snapshot" || resp.ServiceMap.Nodes[0].Name != "legacy" {
+		t.Fatalf("old: status %d, response %+v, want the stored snapshot", code, resp)
+	}
+	if !resp.End.Equal(old) || !resp.Start.Equal(old.Add(-5*time.Minute)) {
+		t.Errorf("snapshot window = %v..%v, want %v..%v", resp.Start, resp.End, old.Add(-5*time.Minute), old)
+	}
+
+	// Within retention but no spans, and no snapshot of that window: an empty live map.
+	code, resp = get(now.Add(-12 * time.Hour))
+	if code != http.StatusOK || resp.Source != "live" || len(resp.ServiceMap.Nodes) != 0 {
+		t.Errorf("quiet period: status %d, response %+v, want an empty live map", code, resp)
+	}
+}
+
+func TestDashboardCompareOffset(t *testing.T) {
+	s, repo := newTestServer(t)
+	s.SetServiceMapHistory(5*time.Minute, 7*24*time.Hour)
+	now := time.Now().UTC()
+	if err := repo.BatchCreateTraces([]storage.Trace{
+		{TraceID: "now", ServiceName: "api", Status: "STATUS_CODE_ERROR", Timestamp: now.Add(-time.Minute)},
+		{TraceID: "yesterday", ServiceName: "api", Status: "STATUS_CODE_ERROR", Timestamp: now.Add(-time.Minute - 24*time.Hour)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(h http.HandlerFunc, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		return rec
+	}
+
+	rec := get(s.handleGetDashboardStats, "compare_offset=24h")
+	var cmp storage.DashboardComparison
+	if err := json.Unmarshal(rec.Body.Bytes(), &cmp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if cmp.Comparison == nil || cmp.Comparison.TotalErrors != 1 || cmp.Deltas.TotalErrors == nil || *cmp.Deltas.TotalErrors != 0 {
+		t.Errorf("comparison = %+v, deltas %+v; want one error each day, unchanged", cmp.Comparison, cmp.Deltas)
+	}
+
+	// Past the 7-day retention: null comparison, flagged.
+	rec = get(s.handleGetTrafficMetrics, "compare_offset=7d")
+	var traffic map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &traffic)
+	if traffic["beyond_retention"] != true || traffic["comparison"] != nil {
+		t.Errorf("traffic = %v, want beyond_retention and a null comparison", traffic)
+	}
+
+	for _, tc := range []struct {
+		h     http.HandlerFunc
+		query string
+	}{
+		{s.handleGetDashboardStats, "compare_offset=1y"},
+		{s.handleGetDashboardStats, "compare_offset=0h"},
+		{s.handleGetTrafficMetrics, "compare_offset=24h&group_by=service_name"},
+	} {
+		if rec := get(tc.h, tc.query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tc.query, rec.Code)
+		}
+	}
+}
+
+func TestTrafficTimezone(t *testing.T) {
+	s, repo := newTestServer(t)
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata unavailable:", err)
+	}
+	end := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	if err := repo.BatchCreateTraces([]storage.Trace{
+		{TraceID: "a", ServiceName: "api", Timestamp: end.Add(-5 * time.Minute)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(h http.HandlerFunc, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		return rec
+	}
+	window := "start=" + end.Add(-10*time.Minute).Format(time.RFC3339) + "&end=" + end.Format(time.RFC3339)
+
+	// The display zone applies when the request names none.
+	s.SetDisplayTimezone(ny)
+	rec := get(s.handleGetTrafficMetrics, window+"&group_by=service_name")
+	var series storage.TrafficByService
+	if err := json.Unmarshal(rec.Body.Bytes(), &series); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(series.Series) != 1 || series.Series[0].Points[0].Timestamp.Format("-07:00") != "-04:00" {
+		t.Errorf("series = %+v, want points in New York time", series.Series)
+	}
+
+	rec = get(s.handleGetTrafficMetrics, window+"&tz=UTC")
+	var points []storage.TrafficPoint
+	if err := json.Unmarshal(rec.Body.Bytes(), &points); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if len(points) == 0 || points[0].Timestamp.Format("Z07:00") != "Z" {
+		t.Errorf("points = %+v, want UTC timestamps", points)
+	}
+
+	for _, h := range []http.HandlerFunc{s.handleGetTrafficMetrics, s.handleGetLatencyHeatmap} {
+		if rec := get(h, window+"&tz=Mars/Olympus_Mons"); rec.Code != http.StatusBadRequest {
+			t.Errorf("unknown tz: status = %d, want 400", rec.Code)
+		}
+	}
+}
+
+func TestGetMetricCatalog(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now().UTC()
+	if err := repo.BatchCreateMetrics([]storage.MetricBucket{{Name: "queue_depth", ServiceName: "checkout", TimeBucket: now, Count: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveMetricCatalog([]storage.MetricCatalog{{Name: "queue_depth", Type: "gauge", Unit: "{message}",
+		Services: []string{"checkout"}, Cardinality: 3, LastSeen: now}}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string, v any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleGetMetricNames(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/metrics"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", query, rec.Code, rec.Body)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var catalog []storage.MetricCatalog
+	get("", &catalog)
+	if len(catalog) != 1 || catalog[0].Unit != "{message}" || catalog[0].Cardinality != 3 || len(catalog[0].Services) != 1 {
+		t.Errorf("catalog = %+v, want queue_depth with its metadata", catalog)
+	}
+	var names []string
+	get("?names_only=true", &names)
+	if len(names) != 1 || names[0] != "queue_depth" {
+		t.Errorf("names_only = %v, want [queue_depth]", names)
+	}
+}
+
+func TestServiceMapFocusParams(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now().UTC()
+	span := func(traceID, id, parent, service string) storage.Span {
+		return storage.Span{TraceID: traceID, SpanID: id, ParentSpanID: parent, ServiceName: service, OperationName: "op",
+			StartTime: now.Add(-time.Minute), EndTime: now.Add(-time.Minute + time.Millisecond)}
+	}
+	if err := repo.BatchCreateSpans([]storage.Span{
+		span("t1", "a", "", "web"), span("t1", "b", "a", "cart"), span("t1", "c", "b", "db"),
+		span("t2", "d", "", "batch"), span("t2", "e", "d", "db"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string) (int, storage.ServiceMapMetrics) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleGetServiceMapMetrics(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/service-map?"+query, nil))
+		var m storage.ServiceMapMetrics
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, m
+	}
+
+	for _, query := range []string{"depth=2", "focus=web&depth=0", "focus=web&min_call_count=-1"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, code)
+		}
+	}
+	if code, m := get("focus=web"); code != http.StatusOK || len(m.Nodes) != 2 || len(m.Edges) != 1 {
+		t.Errorf("focus=web: status %d, map %+v, want web and cart", code, m)
+	}
+	if code, m := get("focus=web&depth=2"); code != http.StatusOK || len(m.Nodes) != 3 {
+		t.Errorf("focus=web&depth=2: status %d, map %+v, want web, cart and db", code, m)
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	s, repo := newTestServer(t)
+	s.SetMaxTimeRange(24 * time.Hour)
+	start := time.Now().UTC().Truncate(time.Minute).Add(-time.Hour)
+	buckets := []storage.MetricBucket{
+		{Name: "errors", ServiceName: "checkout", TimeBucket: start, Count: 1, Sum: 3, Max: 3},
+		{Name: "errors", ServiceName: "checkout", TimeBucket: start.Add(2 * time.Minute), Count: 2, Sum: 8, Max: 5},
+		{Name: "errors", ServiceName: "cart", TimeBucket: start, Count: 1, Sum: 1, Max: 1},
+	}
+	for i := range maxQuerySeries + 1 {
+		buckets = append(buckets, storage.MetricBucket{Name: "pods", ServiceName: "checkout", TimeBucket: start, Count: 1,
+			AttributesJSON: storage.CompressedText(fmt.Sprintf(`{"pod":"p%d"}`, i))})
+	}
+	if err := repo.BatchCreateMetrics(buckets); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleQueryMetrics(rec, httptest.NewRequest(http.MethodPost, "/api/metrics/query", strings.NewReader(body)))
+		return rec
+	}
+	window := `"start":"` + start.Format(time.RFC3339) + `","end":"` + start.Add(3*time.Minute).Format(time.RFC3339) + `","step":"1m"`
+
+	rec := post(`{"expr":"errors{service=\"checkout\"} * 10",` + window + `}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var res struct {
+		Step       string      `json:"step"`
+		Timestamps []time.Time `json:"timestamps"`
+		Series     []struct {
+			Service string     `json:"service"`
+			Values  []*float64 `json:"values"`
+		} `json:"series"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Step != "1m0s" || len(res.Timestamps) != 3 || len(res.Series) != 1 || res.Series[0].Service != "checkout" {
+		t.Fatalf("result = %s, want one checkout series of 3 points", rec.Body)
+	}
+	if v := res.Series[0].Values; v[0] == nil || *v[0] != 30 || v[1] != nil || v[2] == nil || *v[2] != 40 {
+		t.Errorf("values = %s, want [30,null,40]", rec.Body)
+	}
+
+	if rec := post(`{"expr":"sum(errors)","fill":"zero",` + window + `}`); !strings.Contains(rec.Body.String(), `"values":[4,0,4]`) {
+		t.Errorf("fill=zero: %s, want [4,0,4]", rec.Body)
+	}
+
+	for _, tt := range []struct {
+		body, detail string
+	}{
+		{`{"expr":"sum(errors) / rate(2)"}`, `"position":19`},
+		{`{"expr":"pods",` + window + `}`, `"position":0`},
+		{`{"expr":"pods{service=\"checkout\"} + 1","start":"` + start.Format(time.RFC3339) + `"}`, `"position":0`},
+		{`{"expr":"errors","step":"1s"}`, `"max_steps":1440`},
+		{`{"expr":"errors","step":"fast"}`, ``},
+		{`{"expr":"errors","fill":"previous"}`, ``},
+		{`{"expr":"errors","start":"2020-01-01T00:00:00Z"}`, `"max_range"`},
+		{`{"expr":""}`, `"position":0`},
+		{`{"expr":"` + strings.Repeat("(", 100) + `a` + strings.Repeat(")", 100) + `"}`, `"position":64`},
+		{`{"expr":"` + strings.Repeat("(", tsdb.MaxExprLen+1) + `"}`, `"position":4096`},
+		{`not json`, ``},
+	} {
+		rec := post(tt.body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.detail) {
+			t.Errorf("%.80s: status %d, body %.200s; want 400 with %s", tt.body, rec.Code, rec.Body, tt.detail)
+		}
+	}
+	// A body of nested parentheses several MB long once overflowed the parser's stack.
+	if rec := post(`{"expr":"` + strings.Repeat("(", 8<<20) + `"}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("8 MB body: status %d, want 413", rec.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+)
+
+// metricsQueryMaxBytes caps the query body; tsdb.MaxExprLen caps the expression in it.
+const metricsQueryMaxBytes = 64 << 10
+
+const (
+	maxQuerySeries = 200  // series a selector, or the result, may have
+	maxQuerySteps  = 1440 // points per series
+	querySteps     = 100  // points per series when no step is given
+)
+
+// MetricsQuery is the body of POST /api/metrics/query.
+type MetricsQuery struct {
+	Expr  string    `json:"expr"`
+	Start time.Time `json:"start"`          // default: 30 minutes before end
+	End   time.Time `json:"end"`            // default: now
+	Step  string    `json:"step,omitempty"` // Go duration; default: the range split in 100 steps
+	Fill  string    `json:"fill,omitempty"` // missing points as "null" (default) or "zero"
+}
+
+// MetricsQueryResult is an evaluated metric expression over the effective range.
+type MetricsQueryResult struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Step  string    `json:"step"`
+	tsdb.QueryResult
+}
+
+// handleQueryMetrics handles POST /api/metrics/query
+// Body: {"expr": "sum(rate(http_server_requests{service=\"order-service\"}))", "step": "1m"}
+//
+// Evaluates a metric expression (see tsdb.ParseExpr) over the stored metric buckets,
+// one point per step. The window is guarded by API_MAX_TIME_RANGE, and a query may
+// return at most 200 series of at most 1440 points. The expression is at most 4096
+// bytes and nests at most 64 parentheses and calls. An expression that does not parse
+// or matches too many series is a 400 whose details carry the byte position of the
+// offending token.
+func (s *Server) handleQueryMetrics(w http.ResponseWriter, r *http.Request) {
+	var req MetricsQuery
+	r.Body = http.MaxBytesReader(w, r.Body, metricsQueryMaxBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", metricsQueryMaxBytes), nil)
+			return
+		}
+		writeBadRequest(w, "request body must be JSON with an 'expr' field")
+		return
+	}
+	if req.Fill != "" && req.Fill != "null" && req.Fill != "zero" {
+		writeBadRequest(w, "'fill' must be null or zero")
+		return
+	}
+	expr, err := tsdb.ParseExpr(req.Expr)
+	if err != nil {
+		writeExprError(w, err)
+		return
+	}
+
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() {
+		req.Start = req.End.Add(-defaultTimeRange)
+	}
+	if !req.Start.Before(req.End) {
+		writeBadRequest(w, "'start' must be before 'end'")
+		return
+	}
+	if s.maxRange > 0 && req.End.Sub(req.Start) > s.maxRange {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument, "time range longer than API_MAX_TIME_RANGE",
+			map[string]string{"max_range": s.maxRange.String()})
+		return
+	}
+	qr := tsdb.QueryRange{Start: req.Start, End: req.End}
+	if req.Step == "" {
+		if qr.Step = (req.End.Sub(req.Start) / querySteps).Round(time.Second); qr.Step < time.Second {
+			qr.Step = time.Second
+		}
+	} else if qr.Step, err = time.ParseDuration(req.Step); err != nil || qr.Step < time.Second {
+		writeBadRequest(w, "'step' must be a duration of at least 1s")
+		return
+	}
+	if n := qr.Steps(); n > maxQuerySteps {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument,
+			fmt.Sprintf("%d steps exceed the maximum of %d; use a longer step", n, maxQuerySteps),
+			map[string]int{"max_steps": maxQuerySteps})
+		return
+	}
+
+	res, err := tsdb.Evaluate(s.store(r), expr, qr, maxQuerySeries)
+	if err != nil {
+		var exprErr *tsdb.ExprError
+		if errors.As(err, &exprErr) {
+			writeExprError(w, err)
+			return
+		}
+		writeInternalError(w, "Failed to evaluate metric query", err, "expr", req.Expr)
+		return
+	}
+	if req.Fill == "zero" {
+		res.FillMissing(0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MetricsQueryResult{Start: qr.Start, End: qr.End, Step: qr.Step.String(), QueryResult: *res})
+}
+
+// writeExprError answers 400 for a metric expression error, with the position of the
+// offending token when known.
+func writeExprError(w http.ResponseWriter, err error) {
+	var exprErr *tsdb.ExprError
+	if !errors.As(err, &exprErr) {
+		writeBadRequest(w, "invalid expression: "+err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument, "invalid expression: "+exprErr.Error(),
+		map[string]int{"position": exprErr.Pos})
+}
@@ -2,11 +2,14 @@ package api
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
 	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
 )
 
@@ -30,66 +33,69 @@ func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return rw.ResponseWriter.(http.Hijacker).Hijack()
 }
 
-// MetricsMiddleware records OtelContext_http_requests_total and OtelContext_http_request_duration_seconds
-// for every HTTP request.
+// Handler wraps mux, with all routes registered, in the server's middleware:
+// request metrics, then gzip, then authentication.
+func (s *Server) Handler(mux *http.ServeMux, gzipMinBytes int) http.Handler {
+	return MetricsMiddleware(s.metrics, GzipMiddleware(gzipMinBytes, s.Authenticate(recordRoute(mux))))
+}
+
+// routeKey is the context key of the pattern recordRoute saves for MetricsMiddleware.
+type routeKey struct{}
+
+// MetricsMiddleware records OtelContext_http_requests_total and
+// OtelContext_http_request_duration_seconds for every HTTP request, labeled by the
+// mux route pattern that served it so IDs in the path don't multiply series.
+// WebSocket endpoints are skipped: their duration is the life of the connection.
 func MetricsMiddleware(metrics *telemetry.Metrics, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		rw := wrapResponseWriter(w)
+		pattern := new(string)
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, pattern))
 		next.ServeHTTP(rw, r)
-		duration := time.Since(start).Seconds()
 
-		path := sanitizePath(r.URL.Path)
+		// ServeMux sets Pattern on the request it dispatched, which is r only when no
+		// middleware in between replaced the request, as Authenticate does.
+		if *pattern == "" {
+			*pattern = r.Pattern
+		}
+		route := routeLabel(*pattern)
+		if route == "/ws" || strings.HasPrefix(route, "/ws/") {
+			return
+		}
 		status := strconv.Itoa(rw.statusCode)
-
-		metrics.HTTPRequestsTotal.WithLabelValues(r.Method, path, status).Inc()
-		metrics.HTTPRequestDuration.WithLabelValues(r.Method, path).Observe(duration)
+		metrics.HTTPRequestsTotal.WithLabelValues(r.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
 	})
 }
 
-// sanitizePath normalizes URL paths to avoid high-cardinality label explosions.
-// Dynamic segments (UUIDs, numeric IDs) are collapsed to {id}.
-func sanitizePath(path string) string {
-	// Keep well-known API prefixes; collapse long dynamic segments.
-	// Fast path: if the path is short and contains no digits it's already clean.
-	if len(path) <= 20 {
-		return path
-	}
-
-	// Walk segments and replace pure-numeric or UUID-like segments with {id}.
-	out := make([]byte, 0, len(path))
-	start := 0
-	for i := 0; i <= len(path); i++ {
-		if i == len(path) || path[i] == '/' {
-			seg := path[start:i]
-			if isIDSegment(seg) {
-				out = append(out, []byte("{id}")...)
-			} else {
-				out = append(out, []byte(seg)...)
-			}
-			if i < len(path) {
-				out = append(out, '/')
-			}
-			start = i + 1
+// recordRoute saves the pattern mux matched for the MetricsMiddleware above it.
+func recordRoute(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		if pattern, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*pattern = r.Pattern
 		}
-	}
-	return string(out)
+	})
 }
 
-func isIDSegment(s string) bool {
-	if len(s) == 0 {
-		return false
+// withQueryRoute tags the request context with its route, which the repository's
+// statement telemetry reads to attribute slow queries and query latency.
+func withQueryRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	route := routeLabel(pattern)
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(storage.WithQueryRoute(r.Context(), route)))
 	}
-	// UUID: 32-36 chars with hyphens
-	if len(s) >= 32 {
-		return true
+}
+
+// routeLabel strips the method from a mux pattern ("GET /api/traces/{id}" becomes
+// "/api/traces/{id}"). Requests no route matched share the "unmatched" label.
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
 	}
-	// Pure numeric
-	for _, c := range s {
-		if c < '0' || c > '9' {
-			return false
-		}
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
 	}
-	return len(s) > 0
+	return pattern
 }
-
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+func TestSelfMonitoringMetrics(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.metrics = telemetry.New() // registers on the default registry; once per test binary
+	// With multi-tenancy on, Authenticate hands the mux a copy of each request.
+	tokens, err := tenant.ParseTokens("a-secret=alpha", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTenants(tokens)
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+	srv := httptest.NewServer(s.Handler(mux, 0))
+	defer srv.Close()
+
+	get := func(path string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer root")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	get("/api/traces/4bf92f3577b34da6a3ce929d0e0e4736")
+	get("/api/traces/00f067aa0ba902b700f067aa0ba902b7")
+	get("/ws/health") // not an upgrade; rejected, and must not be recorded
+	get("/no/such/route")
+
+	scrape := get("/metrics/prometheus")
+	want := []string{
+		"go_goroutines ",
+		"go_memstats_heap_inuse_bytes ",
+		"go_gc_duration_seconds",
+		"go_sched_latencies_seconds_bucket",
+		`OtelContext_http_requests_total{method="GET",route="/api/traces/{id}",status="404"} 2`,
+		`OtelContext_http_request_duration_seconds_count{method="GET",route="/api/traces/{id}"} 2`,
+		`OtelContext_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	}
+	if runtime.GOOS == "linux" {
+		want = append(want, "process_resident_memory_bytes ", "process_open_fds ")
+	}
+	for _, series := range want {
+		if !strings.Contains(scrape, series) {
+			t.Errorf("scrape is missing %s", series)
+		}
+	}
+	if strings.Contains(scrape, `route="/ws`) {
+		t.Errorf("WebSocket endpoint recorded in HTTP metrics")
+	}
+
+	if h := s.metrics.GetHealthStats(); h.Goroutines == 0 || h.HeapInuseMB <= 0 {
+		t.Errorf("health stats = %+v, want goroutines and heap in use", h)
+	}
+}
+
+func TestRouteLabel(t *testing.T) {
+	for pattern, want := range map[string]string{
+		"GET /api/traces/{id}": "/api/traces/{id}",
+		"/ws":                  "/ws",
+		"":                     "unmatched",
+	} {
+		if got := routeLabel(pattern); got != want {
+			t.Errorf("routeLabel(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
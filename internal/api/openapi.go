@@ -0,0 +1,786 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/buildinfo"
+	"github.com/RandomCodeSpace/otelcontext/internal/demo"
+	"github.com/RandomCodeSpace/otelcontext/internal/export"
+	"github.com/RandomCodeSpace/otelcontext/internal/importer"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/queue"
+	"github.com/RandomCodeSpace/otelcontext/internal/quota"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// The REST API is described once, in apiRoutes. The same table produces the OpenAPI 3
+// document served at GET /api/openapi.json and drives validateParams, so the spec
+// cannot drift from what the server actually accepts. Response schemas are derived
+// from the Go types the handlers encode.
+
+// openAPIVersion is the OpenAPI specification version the document conforms to.
+const openAPIVersion = "3.0.3"
+
+// paramSpec documents and validates one query or path parameter.
+type paramSpec struct {
+	Name        string
+	In          string // "query" or "path"
+	Type        string // "string", "integer", "number" or "boolean"
+	Format      string // "date-time" for RFC3339 timestamps
+	Enum        []string
+	Min         *float64
+	Max         *float64
+	Required    bool
+	Repeated    bool // may be given several times, e.g. ?service_name=a&service_name=b
+	Description string
+}
+
+func queryString(name, desc string) paramSpec {
+	return paramSpec{Name: name, In: "query", Type: "string", Description: desc}
+}
+
+func queryInt(name string, min, max float64, desc string) paramSpec {
+	p := paramSpec{Name: name, In: "query", Type: "integer", Description: desc, Min: &min}
+	if max > 0 {
+		p.Max = &max
+	}
+	return p
+}
+
+func queryNumber(name string, min, max float64, desc string) paramSpec {
+	p := queryInt(name, min, max, desc)
+	p.Type = "number"
+	return p
+}
+
+func queryBool(name, desc string) paramSpec {
+	return paramSpec{Name: name, In: "query", Type: "boolean", Description: desc}
+}
+
+func queryTime(name, desc string) paramSpec {
+	return paramSpec{Name: name, In: "query", Type: "string", Format: "date-time", Description: desc}
+}
+
+func queryEnum(name, desc string, values ...string) paramSpec {
+	return paramSpec{Name: name, In: "query", Type: "string", Enum: values, Description: desc}
+}
+
+func pathParam(name, typ, desc string) paramSpec {
+	return paramSpec{Name: name, In: "path", Type: typ, Required: true, Description: desc}
+}
+
+func (p paramSpec) required() paramSpec { p.Required = true; return p }
+func (p paramSpec) repeated() paramSpec { p.Repeated = true; return p }
+
+// routeSpec describes one endpoint. Response is a value of the type the handler
+// encodes on success; List wraps it as {"data": [...], "total": n}, and Cursor adds
+// the next_cursor token to that wrapper.
+type routeSpec struct {
+	Method   string
+	Path     string
+	Tag      string
+	Summary  string
+	Params   []paramSpec
+	Body     *schema // JSON request body, nil if none
+	Response any
+	List     bool
+	Cursor   bool
+	Status   int // success status, default 200
+}
+
+// pattern is the http.ServeMux pattern the route is registered under.
+func (rs routeSpec) pattern() string { return rs.Method + " " + rs.Path }
+
+// Shared parameter sets.
+var (
+	timeRangeParams = []paramSpec{
+		queryTime("start", "Start of the time range (RFC3339)"),
+		queryTime("end", "End of the time range (RFC3339)"),
+	}
+	// Windows of the endpoints guarded by API_MAX_TIME_RANGE; the X-Time-Range-Start
+	// and X-Time-Range-End headers of the response give the window queried.
+	guardedRangeParams = []paramSpec{
+		queryTime("start", "Start of the time range (RFC3339); default 30 minutes before end"),
+		queryTime("end", "End of the time range (RFC3339); default now"),
+	}
+	serviceNamesParam = queryString("service_name", "Restrict to these services").repeated()
+	envParam          = queryString("env", "Restrict to data ingested from this deployment.environment (see /api/metadata/environments)")
+	errorModeParam    = queryEnum("error_mode", "root: the trace's own status; rollup: any span failed", storage.ErrorModeRoot, storage.ErrorModeRollup)
+	severityValues    = []string{"TRACE", "DEBUG", "INFO", "WARN", "WARNING", "ERROR", "FATAL"}
+	fieldsParam       = queryString("fields", "Comma-separated JSON fields to return for each row, e.g. trace_id,timestamp; default all")
+	compareParam      = queryString("compare_offset", "Also return the same range this much earlier (e.g. 24h, 7d) with percent deltas")
+	tzParam           = queryString("tz", "IANA time zone that day and hour buckets are aligned in, e.g. America/New_York (default DISPLAY_TIMEZONE)")
+)
+
+func pageParams(maxLimit float64) []paramSpec {
+	return []paramSpec{
+		queryInt("limit", 1, maxLimit, "Maximum number of items to return"),
+		queryInt("offset", 0, 0, "Number of items to skip"),
+	}
+}
+
+func params(sets ...[]paramSpec) []paramSpec {
+	var out []paramSpec
+	for _, s := range sets {
+		out = append(out, s...)
+	}
+	return out
+}
+
+// apiRoutes is every documented endpoint, in the order RegisterRoutes lists them.
+var apiRoutes = []routeSpec{
+	{Method: "GET", Path: "/api/metadata/services", Tag: "services", Summary: "List service names",
+		Params: []paramSpec{
+			queryBool("details", "Return each service with its owner, team, tier and links instead of the bare names"),
+			envParam,
+		}, Response: []string{}},
+	{Method: "GET", Path: "/api/metadata/environments", Tag: "services", Summary: "List the deployment environments seen in traces and logs",
+		Response: []string{}},
+	{Method: "PUT", Path: "/api/metadata/services/{name}", Tag: "services", Summary: "Set a service's owner, team, tier, description and links",
+		Params: []paramSpec{pathParam("name", "string", "Service name; need not have reported yet")},
+		Body:   schemaFor(reflect.TypeOf(storage.ServiceMetadata{}), nil), Response: storage.ServiceMetadata{}},
+	{Method: "POST", Path: "/api/metadata/services/import", Tag: "services", Summary: "Import service metadata from CSV or JSON; all rows or none are saved",
+		Params: []paramSpec{
+			queryEnum("format", "Layout of the uploaded file (default: csv for a text/csv body, else json)", "csv", "json"),
+		}, Response: map[string]int{}},
+	{Method: "GET", Path: "/api/metadata/services/export", Tag: "services", Summary: "Export service metadata in a format the import accepts",
+		Params: []paramSpec{
+			queryEnum("format", "File layout (default json)", "csv", "json"),
+		}, Response: []storage.ServiceMetadata{}},
+	{Method: "GET", Path: "/api/services/liveness", Tag: "services", Summary: "When each service last exported each signal, its ingest lag and clock skew, and whether it went quiet",
+		Response: ServiceLivenessResponse{}},
+	{Method: "GET", Path: "/api/services/{name}/dependencies", Tag: "services", Summary: "Health of a service's dependencies against the previous window",
+		Params: []paramSpec{
+			pathParam("name", "string", "Calling service"),
+			queryString("window", "Window length, e.g. 30m (default 1h, at most 24h)"),
+			queryNumber("error_rate_delta", 0, 1, "Error rate rise (0-1) that flags a dependency"),
+			queryNumber("latency_change", 0, 0, "Relative p95 rise that flags a dependency, e.g. 0.5"),
+			queryInt("min_calls", 0, 0, "Calls in the current window before a dependency can be flagged"),
+		}, Response: storage.DependencyHealthResult{}},
+	{Method: "GET", Path: "/api/metadata/metrics", Tag: "metrics", Summary: "Metric catalog: type, unit, services, cardinality, last seen",
+		Params: []paramSpec{
+			queryString("service_name", "Restrict to one service"),
+			queryBool("names_only", "Return only the metric names, as an array of strings"),
+		}, Response: []storage.MetricCatalog{}},
+
+	{Method: "GET", Path: "/api/metrics", Tag: "metrics", Summary: "Aggregated metric buckets",
+		Params: params(timeRangeParams, []paramSpec{
+			queryString("name", "Metric name").required(),
+			queryString("service_name", "Restrict to one service"),
+		}), Response: []storage.MetricBucket{}},
+	{Method: "POST", Path: "/api/metrics/query", Tag: "metrics", Summary: "Evaluate a metric expression (selectors, rate, avg, sum, min, max and arithmetic) step by step",
+		Body: schemaFor(reflect.TypeOf(MetricsQuery{}), nil), Response: MetricsQueryResult{}},
+	{Method: "GET", Path: "/api/metrics/traffic", Tag: "metrics", Summary: "Requests and errors per minute (per-service series with group_by=service_name)",
+		Params: params(guardedRangeParams, []paramSpec{
+			serviceNamesParam,
+			queryEnum("group_by", "Split into one series per service (response: TrafficByService)", "service_name"),
+			queryInt("top", 1, storage.MaxTrafficSeries, "With group_by: services given their own series; the rest are summed as \"other\" (default 10)"),
+			compareParam,
+			tzParam,
+			envParam,
+		}), Response: []storage.TrafficPoint{}},
+	{Method: "GET", Path: "/api/metrics/latency_heatmap", Tag: "metrics", Summary: "Latency histogram (or raw points with format=points)",
+		Params:   params(guardedRangeParams, []paramSpec{serviceNamesParam, queryEnum("format", "Response shape", "histogram", "points"), tzParam, envParam}),
+		Response: storage.LatencyHeatmap{}},
+	{Method: "GET", Path: "/api/metrics/latency_by_status", Tag: "metrics", Summary: "Root-span count, average and p95 latency per time bucket and HTTP status class (2xx, 4xx, 5xx, unknown)",
+		Params:   params(guardedRangeParams, []paramSpec{serviceNamesParam, tzParam}),
+		Response: storage.LatencyByStatus{}},
+	{Method: "GET", Path: "/api/metrics/dashboard", Tag: "metrics", Summary: "Dashboard statistics",
+		Params: params(guardedRangeParams, []paramSpec{serviceNamesParam, errorModeParam, compareParam,
+			queryBool("synthetic", "false: leave logs synthesized from span statuses and events out of total_logs and error_logs"), envParam}),
+		Response: storage.DashboardStats{}},
+	{Method: "GET", Path: "/api/metrics/service-map", Tag: "services", Summary: "Service map nodes and edges",
+		Params: params(guardedRangeParams, []paramSpec{
+			queryString("focus", "Only services within depth hops of this one, read from the traces passing through it"),
+			queryInt("depth", 1, 0, "Hops from focus, along calls in either direction (default 1)"),
+			queryInt("min_call_count", 0, 0, "Drop edges with fewer calls, before hops are counted"),
+			envParam,
+		}), Response: storage.ServiceMapMetrics{}},
+	{Method: "GET", Path: "/api/metrics/service-map/history", Tag: "services", Summary: "Service map at a past moment, from spans or the nearest snapshot",
+		Params: []paramSpec{queryTime("at", "Moment to show").required()}, Response: ServiceMapHistoryResponse{}},
+
+	{Method: "GET", Path: "/api/system/graph", Tag: "services", Summary: "System topology and health"},
+	{Method: "GET", Path: "/api/archive/search", Tag: "archive", Summary: "Search the cold archive (NDJSON stream)",
+		Params: params(timeRangeParams, []paramSpec{
+			queryEnum("type", "Archived signal", "logs", "traces", "metrics"),
+			queryString("q", "Case-insensitive substring to match"),
+		})},
+
+	{Method: "GET", Path: "/api/traces", Tag: "traces", Summary: "Search traces",
+		Params: params(timeRangeParams, pageParams(1000), []paramSpec{
+			serviceNamesParam,
+			queryString("status", "Substring of the trace status, e.g. ERROR"),
+			queryString("search", "Substring of the trace ID; a full trace or span ID matches that trace exactly"),
+			queryBool("error_only", "Only failed traces"),
+			errorModeParam,
+			queryEnum("sort_by", "Sort field", "timestamp", "duration", "service_name", "status", "trace_id", "idle_percentage"),
+			queryEnum("order_by", "Sort direction", "asc", "desc"),
+			queryInt("min_duration_ms", 0, 0, "Inclusive lower duration bound"),
+			queryInt("max_duration_ms", 0, 0, "Inclusive upper duration bound"),
+			queryEnum("completeness", "Whether every span's parent was received, as last checked by the reconciler",
+				storage.TraceComplete, storage.TracePartial, storage.TraceCompletenessUnknown),
+			queryString("annotation", "Annotated with key, or key:value").repeated(),
+			fieldsParam,
+			envParam,
+		}), Response: storage.TracesResponse{}},
+	{Method: "GET", Path: "/api/traces/paths", Tag: "traces", Summary: "Top cross-service trace paths",
+		Params: params(timeRangeParams, []paramSpec{
+			queryString("service_name", "Only paths through this service"),
+			queryEnum("sort_by", "Ranking", "count", "errors", "error_rate", "duration"),
+			queryInt("limit", 1, 1000, "Number of paths to return"),
+			queryInt("max_spans", 1, 0, "Spans considered per trace"),
+		}), Response: storage.TracePathsResult{}},
+	{Method: "GET", Path: "/api/traces/by-logs", Tag: "traces", Summary: "Traces behind the logs matching a log search",
+		Params: params(timeRangeParams, pageParams(1000), []paramSpec{
+			queryString("service_name", "Restrict logs to one service"),
+			queryEnum("severity", "Log severity", severityValues...),
+			queryString("search", "Substring of the log body"),
+			queryString("scope_name", "Instrumentation scope name"),
+			queryString("attr", "Indexed attribute match as key:value").repeated(),
+			queryInt("max_traces", 1, storage.MaxTracesByLogs, "Distinct traces considered, most recent matches first (default 500)"),
+			queryEnum("sort_by", "Sort field", "timestamp", "duration", "service_name", "status", "trace_id", "idle_percentage"),
+			queryEnum("order_by", "Sort direction", "asc", "desc"),
+		}), Response: storage.TracesByLogsResponse{}},
+	{Method: "GET", Path: "/api/traces/query", Tag: "traces", Summary: "Search traces with a TraceQL-lite expression",
+		Params: params(timeRangeParams, pageParams(1000), []paramSpec{
+			queryString("q", `Query, e.g. service="payment-service" && duration>500ms && span.attr["http.status_code"]=504`).required(),
+			queryEnum("sort_by", "Sort field", "timestamp", "duration", "service_name", "status", "trace_id", "idle_percentage"),
+			queryEnum("order_by", "Sort direction", "asc", "desc"),
+			fieldsParam,
+		}), Response: storage.TracesResponse{}},
+	{Method: "GET", Path: "/api/traces/lookup", Tag: "traces", Summary: "Trace of a full trace ID or span ID",
+		Params: []paramSpec{
+			queryString("id", "32-character trace ID or 16-character span ID, in any case").required(),
+		}, Response: TraceLookup{}},
+	{Method: "GET", Path: "/api/traces/{id}", Tag: "traces", Summary: "Trace with spans, logs, its timeline and each span's self time",
+		Params: []paramSpec{
+			pathParam("id", "string", "Trace ID"),
+			queryString("baseline", "Annotate each span with its operation's p50/p95 over this window (e.g. 7d) and a slow flag above p95"),
+			queryBool("critical_path", "Mark the spans on the critical path with their contribution in µs and percent"),
+		}, Response: TraceDetail{}},
+	{Method: "GET", Path: "/api/traces/{id}/flamegraph", Tag: "traces", Summary: "Trace as d3-flamegraph data (value = self time in µs)",
+		Params: []paramSpec{
+			pathParam("id", "string", "Trace ID"),
+			queryBool("merge", "Merge identical sibling operations, summing their values"),
+		}, Response: storage.FlamegraphNode{}},
+	{Method: "GET", Path: "/api/traces/{id}/related", Tag: "traces", Summary: "Traces connected to this one by span links, in either direction",
+		Params: []paramSpec{pathParam("id", "string", "Trace ID")}, Response: []storage.RelatedTrace{}},
+	{Method: "POST", Path: "/api/traces/{id}/annotations", Tag: "traces", Summary: "Annotate a trace",
+		Params: []paramSpec{pathParam("id", "string", "Trace ID")},
+		Body: objectSchema(map[string]*schema{
+			"key":    {Type: "string"},
+			"value":  {Type: "string"},
+			"author": {Type: "string"},
+		}, "key"), Response: storage.TraceAnnotation{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/api/traces/{id}/annotations", Tag: "traces", Summary: "Remove annotations from a trace",
+		Params: []paramSpec{
+			pathParam("id", "string", "Trace ID"),
+			queryString("key", "Annotation key").required(),
+			queryString("value", "Only annotations with this value"),
+		}, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/traces/{id}/forward", Tag: "traces", Summary: "Send a trace to another backend over OTLP gRPC",
+		Params: []paramSpec{pathParam("id", "string", "Trace ID")},
+		Body: objectSchema(map[string]*schema{
+			"endpoint": {Type: "string"},
+			"tls":      {Type: "boolean"},
+			"headers":  {Type: "object", AdditionalProperties: &schema{Type: "string"}},
+		}, "endpoint"), Response: export.Result{}},
+	{Method: "GET", Path: "/api/spans", Tag: "traces", Summary: "Search spans",
+		Params: params(timeRangeParams, pageParams(1000), []paramSpec{
+			queryString("service_name", "Restrict to one service"),
+			queryString("operation", "Operation name"),
+			queryString("trace_id", "Trace ID"),
+			queryString("scope_name", "Instrumentation scope name"),
+			queryString("scope_version", "Instrumentation scope version"),
+		}), Response: storage.Span{}, List: true},
+
+	{Method: "GET", Path: "/api/logs", Tag: "logs", Summary: "Search logs",
+		Params: params(timeRangeParams, pageParams(1000), []paramSpec{
+			queryString("service_name", "Restrict to one service"),
+			queryEnum("severity", "Severity", severityValues...),
+			queryString("search", "Substring of the log body"),
+			queryString("scope_name", "Instrumentation scope name"),
+			queryString("attr", "Indexed attribute match as key:value").repeated(),
+			queryBool("has_trace", "true: only logs whose trace is stored; false: logs referencing a trace that is not stored"),
+			queryBool("synthetic", "true: only logs synthesized from span statuses and events; false: only logs the apps exported"),
+			queryBool("include_trace_summary", "Attach a summary of each log's trace (exists, duration, status, service)"),
+			queryString("cursor", "next_cursor from the previous page; takes precedence over offset"),
+			queryEnum("view", "summary (default): bodies cut to a preview, no attributes or AI insight; full: whole rows", "summary", "full"),
+			fieldsParam,
+			envParam,
+		}), Response: storage.Log{}, List: true, Cursor: true},
+	{Method: "GET", Path: "/api/logs/context", Tag: "logs", Summary: "Logs around a point in time",
+		Params: []paramSpec{
+			queryTime("timestamp", "Centre of the window (RFC3339)").required(),
+			queryString("window", "How far either side of timestamp to look, as a Go duration (default 1m, max 10m)"),
+			queryString("service_name", "Only logs of this service"),
+			queryInt("limit", 1, storage.MaxLogContextLimit, "Rows per page, balanced around timestamp (default 200)"),
+			queryString("older", "older_cursor from a previous page; loads older logs"),
+			queryString("newer", "newer_cursor from a previous page; loads newer logs"),
+		}, Response: storage.LogContextPage{}},
+	{Method: "GET", Path: "/api/logs/similar", Tag: "logs", Summary: "Semantically similar logs",
+		Params: []paramSpec{queryString("q", "Text to match").required(), queryInt("limit", 1, 50, "Number of results")}},
+	{Method: "GET", Path: "/api/logs/{id}", Tag: "logs", Summary: "A log with its whole body, attributes and AI insight",
+		Params: []paramSpec{pathParam("id", "integer", "Log ID")}, Response: storage.Log{}},
+	{Method: "GET", Path: "/api/logs/{id}/insight", Tag: "logs", Summary: "AI insight for a log and whether its error is suppressed",
+		Params: []paramSpec{pathParam("id", "integer", "Log ID")}, Response: LogInsight{}},
+	{Method: "POST", Path: "/api/logs/{id}/insight/feedback", Tag: "logs", Summary: "Rate a log's AI insight",
+		Params: []paramSpec{pathParam("id", "integer", "Log ID")},
+		Body: objectSchema(map[string]*schema{
+			"rating":  {Type: "string", Enum: []string{storage.InsightHelpful, storage.InsightUnhelpful}},
+			"comment": {Type: "string"},
+		}, "rating"), Response: InsightFeedbackResponse{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/api/ai/feedback/summary", Tag: "logs", Summary: "AI insight ratings per service",
+		Response: []storage.InsightFeedbackSummary{}},
+	{Method: "GET", Path: "/api/logs/{id}/raw", Tag: "logs", Summary: "Stored log body alone, as text/plain (or JSON for structured bodies)",
+		Params: []paramSpec{pathParam("id", "integer", "Log ID")}},
+
+	{Method: "GET", Path: "/api/slos", Tag: "slos", Summary: "List SLOs", Response: []storage.SLO{}},
+	{Method: "POST", Path: "/api/slos", Tag: "slos", Summary: "Create an SLO",
+		Body: schemaFor(reflect.TypeOf(storage.SLO{}), nil), Response: storage.SLO{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/api/slos/status", Tag: "slos", Summary: "Latest SLO evaluations", Response: []storage.SLOStatus{}},
+	{Method: "GET", Path: "/api/slos/{id}", Tag: "slos", Summary: "Get an SLO",
+		Params: []paramSpec{pathParam("id", "integer", "SLO ID")}, Response: storage.SLO{}},
+	{Method: "PUT", Path: "/api/slos/{id}", Tag: "slos", Summary: "Update an SLO",
+		Params: []paramSpec{pathParam("id", "integer", "SLO ID")},
+		Body:   schemaFor(reflect.TypeOf(storage.SLO{}), nil), Response: storage.SLO{}},
+	{Method: "DELETE", Path: "/api/slos/{id}", Tag: "slos", Summary: "Delete an SLO",
+		Params: []paramSpec{pathParam("id", "integer", "SLO ID")}, Status: http.StatusNoContent},
+
+	{Method: "GET", Path: "/api/anomalies", Tag: "anomalies", Summary: "Detected anomalies",
+		Params: params(pageParams(0), []paramSpec{
+			queryString("service_name", "Restrict to one service"),
+			queryTime("since", "Only anomalies detected after this time (RFC3339)"),
+		}), Response: storage.AnomalyEvent{}, List: true},
+
+	{Method: "GET", Path: "/api/stats", Tag: "admin", Summary: "Database statistics", Response: map[string]any{}},
+	{Method: "GET", Path: "/api/health", Tag: "admin", Summary: "Ingestion health"},
+	{Method: "GET", Path: "/api/ready", Tag: "admin", Summary: "Readiness: 503 once shutdown has begun"},
+	{Method: "GET", Path: "/api/version", Tag: "admin", Summary: "Server and embedded UI build information",
+		Response: buildinfo.Info{}},
+	{Method: "DELETE", Path: "/api/admin/purge", Tag: "admin", Summary: "Purge logs and traces older than N days",
+		Params: []paramSpec{queryInt("days", 1, 0, "Retention in days (default 7)")}, Response: map[string]any{}},
+	{Method: "GET", Path: "/api/admin/purge/{id}", Tag: "admin", Summary: "Progress of a background purge job",
+		Params: []paramSpec{pathParam("id", "integer", "Job ID returned by DELETE /api/admin/purge")}, Response: storage.PurgeJob{}},
+	{Method: "DELETE", Path: "/api/admin/purge/{id}", Tag: "admin", Summary: "Cancel a background purge job",
+		Params: []paramSpec{pathParam("id", "integer", "Job ID returned by DELETE /api/admin/purge")}, Response: storage.PurgeJob{}},
+	{Method: "DELETE", Path: "/api/admin/data", Tag: "admin", Summary: "Delete one service's data",
+		Params: []paramSpec{
+			queryString("service", "Service to delete").required(),
+			queryTime("before", "Only data older than this (RFC3339)"),
+		}, Response: map[string]any{}},
+	{Method: "POST", Path: "/api/admin/remap-service", Tag: "admin", Summary: "Rename a service in stored data",
+		Body: objectSchema(map[string]*schema{"from": {Type: "string"}, "to": {Type: "string"}}, "from", "to"), Response: map[string]any{}},
+	{Method: "POST", Path: "/api/admin/vacuum", Tag: "admin", Summary: "Reclaim database space", Response: map[string]string{}},
+	{Method: "POST", Path: "/api/admin/integrity", Tag: "admin", Summary: "Start a background database integrity check",
+		Params: []paramSpec{
+			queryBool("quick", "Run the cheaper check (SQLite quick_check, CHECK TABLE QUICK, no heap cross-check on PostgreSQL)"),
+			queryBool("repair", "Rebuild indexes after the check and check again"),
+		}, Response: IntegrityJob{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/admin/integrity/{id}", Tag: "admin", Summary: "Status and result of an integrity check",
+		Params: []paramSpec{pathParam("id", "string", "Job ID returned by POST /api/admin/integrity")}, Response: IntegrityJob{}},
+	{Method: "GET", Path: "/api/admin/indexes", Tag: "admin", Summary: "Existing indexes and expected ones that are missing",
+		Response: storage.IndexAudit{}},
+	{Method: "GET", Path: "/api/admin/dlq", Tag: "admin", Summary: "Dead letter queue contents and replay progress",
+		Response: queue.Status{}},
+	{Method: "GET", Path: "/api/admin/outbox", Tag: "admin", Summary: "Anomaly and SLO breach notifications per delivery state, with the latest events",
+		Params: []paramSpec{
+			queryEnum("state", "Only list events in this state", storage.OutboxPending, storage.OutboxDelivered, storage.OutboxDead),
+			queryInt("limit", 1, 1000, "Maximum number of events to return (default 100)"),
+		}, Response: storage.OutboxStatus{}},
+	{Method: "GET", Path: "/api/admin/slow-queries", Tag: "admin", Summary: "Recent database statements slower than DB_SLOW_QUERY_THRESHOLD, with the API route that ran them",
+		Response: SlowQueriesResponse{}},
+	{Method: "POST", Path: "/api/admin/metrics/reaggregate", Tag: "admin", Summary: "Rebuild metric buckets for a time range",
+		Body: objectSchema(map[string]*schema{
+			"start": {Type: "string", Format: "date-time"},
+			"end":   {Type: "string", Format: "date-time"},
+		}, "start", "end"), Response: map[string]any{}},
+	{Method: "GET", Path: "/api/admin/archive", Tag: "admin", Summary: "List pre-purge archives"},
+	{Method: "POST", Path: "/api/admin/archive/restore", Tag: "admin", Summary: "Restore an archive"},
+	{Method: "GET", Path: "/api/admin/quotas", Tag: "admin", Summary: "List per-service ingest quotas", Response: []storage.ServiceQuota{}},
+	{Method: "GET", Path: "/api/admin/quotas/usage", Tag: "admin", Summary: "Today's ingest usage per service", Response: []quota.ServiceUsage{}},
+	{Method: "PUT", Path: "/api/admin/quotas/{service}", Tag: "admin", Summary: "Set a service's daily quota",
+		Params: []paramSpec{pathParam("service", "string", "Service name")},
+		Body: objectSchema(map[string]*schema{
+			"max_spans_per_day": {Type: "integer"},
+			"max_logs_per_day":  {Type: "integer"},
+		}), Response: storage.ServiceQuota{}},
+	{Method: "DELETE", Path: "/api/admin/quotas/{service}", Tag: "admin", Summary: "Remove a service's quota",
+		Params: []paramSpec{pathParam("service", "string", "Service name")}, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/admin/ingest-config", Tag: "admin", Summary: "Effective ingest filter settings", Response: ingest.FilterConfig{}},
+	{Method: "PUT", Path: "/api/admin/ingest-config", Tag: "admin", Summary: "Replace the ingest filter settings without a restart",
+		Body: schemaFor(reflect.TypeOf(ingest.FilterConfig{}), nil), Response: ingest.FilterConfig{}},
+	{Method: "POST", Path: "/api/admin/report/run", Tag: "admin", Summary: "Start building and delivering the daily report",
+		Params:   []paramSpec{queryTime("end", "End of the report day (RFC3339; default: start of the current day in tz)"), tzParam},
+		Response: ReportJob{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/admin/report/run/{id}", Tag: "admin", Summary: "Status and result of a report run",
+		Params: []paramSpec{pathParam("id", "string", "Job ID returned by POST /api/admin/report/run")}, Response: ReportJob{}},
+	{Method: "GET", Path: "/api/admin/audit", Tag: "admin", Summary: "Audit log of mutating admin calls, newest first",
+		Params: params(timeRangeParams, pageParams(1000)), Response: storage.AuditEntry{}, List: true},
+	{Method: "GET", Path: "/api/admin/backup", Tag: "admin", Summary: "Download a consistent snapshot of the SQLite database (application/vnd.sqlite3)"},
+	{Method: "POST", Path: "/api/admin/restore", Tag: "admin", Summary: "Replace all data with an uploaded backup (RESTORE_ENABLED only)",
+		Params: []paramSpec{queryBool("confirm", "Must be true: the restore replaces all stored data").required()}, Response: storage.RestoreResult{}},
+	{Method: "GET", Path: "/api/admin/loglevel", Tag: "admin", Summary: "Current log level and per-component overrides", Response: LogLevelState{}},
+	{Method: "PUT", Path: "/api/admin/loglevel", Tag: "admin", Summary: "Change the global or a component's log level until restart",
+		Body: schemaFor(reflect.TypeOf(LogLevelUpdate{}), nil), Response: LogLevelState{}},
+	{Method: "GET", Path: "/api/admin/demo", Tag: "admin", Summary: "Demo traffic generator status (demo mode only)", Response: demo.Status{}},
+	{Method: "POST", Path: "/api/admin/demo/start", Tag: "admin", Summary: "Resume simulated demo traffic", Response: demo.Status{}},
+	{Method: "POST", Path: "/api/admin/demo/stop", Tag: "admin", Summary: "Pause simulated demo traffic", Response: demo.Status{}},
+	{Method: "GET", Path: "/api/realtime/clients", Tag: "admin", Summary: "Connected /ws and /ws/events clients with per-client delivery stats",
+		Response: RealtimeClients{}},
+	{Method: "DELETE", Path: "/api/realtime/clients/{id}", Tag: "admin", Summary: "Force-disconnect a WebSocket client",
+		Params: []paramSpec{pathParam("id", "string", "Client ID from GET /api/realtime/clients")}, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/import", Tag: "admin", Summary: "Import a Jaeger or OTLP JSON trace export",
+		Params: []paramSpec{
+			queryEnum("format", "Layout of the uploaded file", "jaeger", "otlp-json").required(),
+		}, Response: importer.Result{}},
+}
+
+// routeSpecs indexes apiRoutes by ServeMux pattern.
+var routeSpecs = func() map[string]*routeSpec {
+	m := make(map[string]*routeSpec, len(apiRoutes))
+	for i := range apiRoutes {
+		m[apiRoutes[i].pattern()] = &apiRoutes[i]
+	}
+	return m
+}()
+
+// FieldError is one entry in the details of a 400 returned by validateParams.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// validateParams wraps h so that requests whose query parameters do not match spec
+// are answered with 400 and one FieldError per offending parameter. A nil spec
+// returns h unchanged. Unknown parameters are ignored.
+func validateParams(spec *routeSpec, h http.HandlerFunc) http.HandlerFunc {
+	if spec == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if errs := spec.validate(r); len(errs) > 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument, "invalid query parameters", errs)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// validate checks the query parameters of r against the route.
+func (rs *routeSpec) validate(r *http.Request) []FieldError {
+	query := r.URL.Query()
+	var errs []FieldError
+	for _, p := range rs.Params {
+		if p.In != "query" {
+			continue
+		}
+		values := query[p.Name]
+		if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			if p.Required {
+				errs = append(errs, FieldError{Field: p.Name, Reason: "is required"})
+			}
+			continue
+		}
+		for _, v := range values {
+			if reason := p.check(v); reason != "" {
+				errs = append(errs, FieldError{Field: p.Name, Reason: reason})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// check returns why v is not a valid value for p, or "" if it is.
+func (p paramSpec) check(v string) string {
+	var n float64
+	switch p.Type {
+	case "integer":
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "must be an integer"
+		}
+		n = float64(i)
+	case "number":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) {
+			return "must be a number"
+		}
+		n = f
+	case "boolean":
+		if v != "true" && v != "false" {
+			return "must be true or false"
+		}
+	}
+	if p.Min != nil && n < *p.Min {
+		return fmt.Sprintf("must be at least %v", *p.Min)
+	}
+	if p.Max != nil && n > *p.Max {
+		return fmt.Sprintf("must be at most %v", *p.Max)
+	}
+	if p.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return "must be an RFC3339 timestamp"
+		}
+	}
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, v) {
+		return "must be one of " + strings.Join(p.Enum, ", ")
+	}
+	return ""
+}
+
+// schema is the subset of the OpenAPI 3.0 Schema Object the document uses.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+func objectSchema(props map[string]*schema, required ...string) *schema {
+	return &schema{Type: "object", Properties: props, Required: required}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor derives a schema from a Go type using its json tags. When components is
+// non-nil, named structs are emitted once under components and referenced by $ref.
+func schemaFor(t reflect.Type, components map[string]*schema) *schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		if components != nil && t.Name() != "" {
+			name := t.Name()
+			if _, ok := components[name]; !ok {
+				components[name] = nil // reserve before recursing, in case of cycles
+				components[name] = structSchema(t, components)
+			}
+			return &schema{Ref: "#/components/schemas/" + name}
+		}
+		return structSchema(t, components)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: schemaFor(t.Elem(), components)}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), components)}
+	default:
+		return &schema{} // interface{}: any value
+	}
+}
+
+// structSchema lists the JSON-visible fields of t, flattening embedded structs and
+// struct pointers. As in encoding/json, a field of t wins over an embedded one.
+func structSchema(t reflect.Type, components map[string]*schema) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	direct := make(map[string]*schema)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		embedded := f.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+		if f.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+			for k, v := range structSchema(embedded, components).Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		direct[name] = schemaFor(f.Type, components)
+	}
+	for k, v := range direct {
+		s.Properties[k] = v
+	}
+	return s
+}
+
+// openAPIDoc is the top level of an OpenAPI 3.0 document.
+type openAPIDoc struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       map[string]string               `json:"info"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components map[string]map[string]*schema   `json:"components"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []parameter         `json:"parameters,omitempty"`
+	RequestBody *requestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Style       string  `json:"style,omitempty"`
+	Explode     *bool   `json:"explode,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+// buildOpenAPI renders routes as an OpenAPI 3 document.
+func buildOpenAPI(routes []routeSpec, version string) *openAPIDoc {
+	components := map[string]*schema{
+		"Error": objectSchema(map[string]*schema{
+			"error": objectSchema(map[string]*schema{
+				"code":    {Type: "string", Enum: []string{ErrCodeInvalidArgument, ErrCodeNotFound, ErrCodeInternal, ErrCodeUnavailable, ErrCodeRateLimited}},
+				"message": {Type: "string"},
+				"details": {},
+			}, "code", "message"),
+		}, "error"),
+	}
+	errorResponse := func(desc string) response {
+		return response{Description: desc, Content: map[string]mediaType{"application/json": {Schema: &schema{Ref: "#/components/schemas/Error"}}}}
+	}
+
+	doc := &openAPIDoc{
+		OpenAPI: openAPIVersion,
+		Info:    map[string]string{"title": "OtelContext API", "version": version},
+		Paths:   make(map[string]map[string]operation),
+	}
+	explode := true
+	for _, rs := range routes {
+		op := operation{
+			OperationID: operationID(rs),
+			Summary:     rs.Summary,
+			Tags:        []string{rs.Tag},
+			Responses: map[string]response{
+				"400": errorResponse("Invalid request"),
+				"500": errorResponse("Internal error"),
+			},
+		}
+		for _, p := range rs.Params {
+			ps := &schema{Type: p.Type, Format: p.Format, Enum: p.Enum, Minimum: p.Min, Maximum: p.Max}
+			param := parameter{Name: p.Name, In: p.In, Description: p.Description, Required: p.Required, Schema: ps}
+			if p.Repeated {
+				param.Schema = &schema{Type: "array", Items: ps}
+				param.Style, param.Explode = "form", &explode
+			}
+			op.Parameters = append(op.Parameters, param)
+		}
+		if rs.Body != nil {
+			op.RequestBody = &requestBody{Required: true, Content: map[string]mediaType{"application/json": {Schema: rs.Body}}}
+		}
+
+		status := rs.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := response{Description: http.StatusText(status)}
+		if rs.Response != nil {
+			body := schemaFor(reflect.TypeOf(rs.Response), components)
+			if rs.List {
+				props := map[string]*schema{
+					"data":  {Type: "array", Items: body},
+					"total": {Type: "integer"},
+				}
+				if rs.Cursor {
+					props["next_cursor"] = &schema{Type: "string"}
+				}
+				body = objectSchema(props, "data", "total")
+			}
+			ok.Content = map[string]mediaType{"application/json": {Schema: body}}
+		}
+		op.Responses[strconv.Itoa(status)] = ok
+		if slices.ContainsFunc(rs.Params, func(p paramSpec) bool { return p.In == "path" }) {
+			op.Responses["404"] = errorResponse("Not found")
+		}
+
+		if doc.Paths[rs.Path] == nil {
+			doc.Paths[rs.Path] = make(map[string]operation)
+		}
+		doc.Paths[rs.Path][strings.ToLower(rs.Method)] = op
+	}
+	doc.Components = map[string]map[string]*schema{"schemas": components}
+	return doc
+}
+
+// operationID derives a stable camelCase identifier, e.g. "GET /api/traces/{id}" ->
+// "getTracesById".
+func operationID(rs routeSpec) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rs.Method))
+	for _, seg := range strings.Split(strings.TrimPrefix(rs.Path, "/api/"), "/") {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			b.WriteString("By")
+			seg = strings.TrimSuffix(name, "}")
+		}
+		for _, w := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+// handleGetOpenAPI handles GET /api/openapi.json
+func (s *Server) handleGetOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.openAPISpec)
+}
+
+// marshalOpenAPI renders the document served by handleGetOpenAPI.
+func marshalOpenAPI(version string) []byte {
+	doc, err := json.Marshal(buildOpenAPI(apiRoutes, version))
+	if err != nil {
+		panic(fmt.Sprintf("api: failed to render OpenAPI document: %v", err))
+	}
+	return doc
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// validateOpenAPIDoc checks doc against the structural rules of the OpenAPI 3.0
+// schema: required fields, parameter locations, path templating, response keys,
+// schema types and $ref resolution. It returns one message per violation.
+func validateOpenAPIDoc(doc map[string]any) []string {
+	var errs []string
+	fail := func(format string, args ...any) { errs = append(errs, fmt.Sprintf(format, args...)) }
+
+	if v, _ := doc["openapi"].(string); !regexp.MustCompile(`^3\.0\.\d+$`).MatchString(v) {
+		fail("openapi = %q, want 3.0.x", v)
+	}
+	info, _ := doc["info"].(map[string]any)
+	for _, k := range []string{"title", "version"} {
+		if s, _ := info[k].(string); s == "" {
+			fail("info.%s is required", k)
+		}
+	}
+
+	components, _ := doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+
+	var checkSchema func(where string, s any)
+	checkSchema = func(where string, s any) {
+		m, ok := s.(map[string]any)
+		if !ok {
+			fail("%s: schema is not an object", where)
+			return
+		}
+		if ref, ok := m["$ref"].(string); ok {
+			name, found := strings.CutPrefix(ref, "#/components/schemas/")
+			if !found || schemas[name] == nil {
+				fail("%s: unresolved $ref %q", where, ref)
+			}
+			return
+		}
+		switch t := m["type"]; t {
+		case nil, "string", "integer", "number", "boolean", "object":
+		case "array":
+			if m["items"] == nil {
+				fail("%s: array without items", where)
+			}
+		default:
+			fail("%s: invalid type %v", where, t)
+		}
+		if items, ok := m["items"]; ok {
+			checkSchema(where+".items", items)
+		}
+		if props, ok := m["properties"].(map[string]any); ok {
+			for name, p := range props {
+				checkSchema(where+"."+name, p)
+			}
+		}
+		if ap, ok := m["additionalProperties"]; ok {
+			checkSchema(where+".additionalProperties", ap)
+		}
+	}
+	for name, s := range schemas {
+		checkSchema("components.schemas."+name, s)
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	if len(paths) == 0 {
+		fail("paths is empty")
+	}
+	templateVar := regexp.MustCompile(`\{([^}]+)\}`)
+	operationIDs := make(map[string]string)
+	for path, item := range paths {
+		if !strings.HasPrefix(path, "/") {
+			fail("path %q must start with /", path)
+		}
+		ops, _ := item.(map[string]any)
+		for method, o := range ops {
+			where := method + " " + path
+			switch method {
+			case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+			default:
+				fail("%s: invalid operation", where)
+				continue
+			}
+			op, _ := o.(map[string]any)
+			if id, _ := op["operationId"].(string); id != "" {
+				if prev, dup := operationIDs[id]; dup {
+					fail("%s: operationId %q also used by %s", where, id, prev)
+				}
+				operationIDs[id] = where
+			}
+
+			seen := make(map[string]bool)
+			pathParams := make(map[string]bool)
+			params, _ := op["parameters"].([]any)
+			for _, raw := range params {
+				p, _ := raw.(map[string]any)
+				name, _ := p["name"].(string)
+				in, _ := p["in"].(string)
+				if name == "" {
+					fail("%s: parameter without name", where)
+				}
+				switch in {
+				case "query", "header", "cookie":
+				case "path":
+					pathParams[name] = true
+					if p["required"] != true {
+						fail("%s: path parameter %q must be required", where, name)
+					}
+				default:
+					fail("%s: parameter %q has invalid location %q", where, name, in)
+				}
+				if seen[in+":"+name] {
+					fail("%s: duplicate parameter %q", where, name)
+				}
+				seen[in+":"+name] = true
+				if p["schema"] == nil {
+					fail("%s: parameter %q needs a schema", where, name)
+				} else {
+					checkSchema(where+" param "+name, p["schema"])
+				}
+			}
+			for _, m := range templateVar.FindAllStringSubmatch(path, -1) {
+				if !pathParams[m[1]] {
+					fail("%s: path variable {%s} is not declared", where, m[1])
+				}
+			}
+
+			if body, ok := op["requestBody"].(map[string]any); ok {
+				content, _ := body["content"].(map[string]any)
+				if len(content) == 0 {
+					fail("%s: requestBody without content", where)
+				}
+				for mt, c := range content {
+					checkSchema(where+" body "+mt, c.(map[string]any)["schema"])
+				}
+			}
+
+			responses, _ := op["responses"].(map[string]any)
+			if len(responses) == 0 {
+				fail("%s: responses are required", where)
+			}
+			for code, r := range responses {
+				if !regexp.MustCompile(`^([1-5]\d\d|[1-5]XX|default)$`).MatchString(code) {
+					fail("%s: invalid response key %q", where, code)
+				}
+				resp, _ := r.(map[string]any)
+				if d, _ := resp["description"].(string); d == "" {
+					fail("%s: response %s needs a description", where, code)
+				}
+				content, _ := resp["content"].(map[string]any)
+				for mt, c := range content {
+					checkSchema(where+" "+code+" "+mt, c.(map[string]any)["schema"])
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func TestOpenAPIDocumentIsValid(t *testing.T) {
+	s := &Server{version: "test"}
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	for _, e := range validateOpenAPIDoc(doc) {
+		t.Error(e)
+	}
+
+	paths := doc["paths"].(map[string]any)
+	for _, p := range []string{"/api/traces", "/api/traces/{id}", "/api/logs", "/api/metrics", "/api/metadata/services", "/api/admin/purge"} {
+		if paths[p] == nil {
+			t.Errorf("spec does not cover %s", p)
+		}
+	}
+	if v := doc["info"].(map[string]any)["version"]; v != "test" {
+		t.Errorf("info.version = %v, want test", v)
+	}
+}
+
+// TestEveryAPIRouteIsDocumented keeps apiRoutes and RegisterRoutes in step.
+func TestEveryAPIRouteIsDocumented(t *testing.T) {
+	src, err := os.ReadFile("server.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := regexp.MustCompile(`(?:handle|admin|global)\("([A-Z]+ /api/[^"]+)"`).FindAllStringSubmatch(string(src), -1)
+	if len(registered) == 0 {
+		t.Fatal("no routes found in server.go")
+	}
+	for _, m := range registered {
+		if routeSpecs[m[1]] == nil {
+			t.Errorf("%s is registered but missing from apiRoutes", m[1])
+		}
+	}
+	if len(registered) != len(apiRoutes) {
+		t.Errorf("%d routes registered, %d documented", len(registered), len(apiRoutes))
+	}
+}
+
+func TestValidateParamsRejectsBadQuery(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.version = "test"
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/traces?limit=abc&sort_by=bogus&start=yesterday&error_only=1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	var body struct {
+		Error struct {
+			Code    string       `json:"code"`
+			Details []FieldError `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, fe := range body.Error.Details {
+		got[fe.Field] = fe.Reason
+	}
+	if body.Error.Code != ErrCodeInvalidArgument || len(got) != 4 || got["limit"] == "" || got["sort_by"] == "" || got["start"] == "" || got["error_only"] == "" {
+		t.Errorf("error = %+v", body.Error)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/logs?limit=5000", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "at most 1000") {
+		t.Errorf("limit above maximum: status %d body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/metrics", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"name"`) {
+		t.Errorf("missing required name: status %d body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/traces?limit=10&sort_by=duration&order_by=desc&start=2024-01-01T00:00:00Z&service_name=a&service_name=b", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("valid query: status %d body %s", rec.Code, rec.Body.String())
+	}
+}
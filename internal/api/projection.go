@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// parseFields reads the comma-separated fields= projection of a list endpoint.
+func parseFields(r *http.Request) []string {
+	var fields []string
+	for _, f := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// projectRows renders rows as objects holding only the given JSON fields. The
+// repository has already loaded just the columns behind them; this keeps the zero
+// values of the others out of the response.
+func projectRows[T any](rows []T, fields []string) []map[string]any {
+	index := jsonFieldIndex(reflect.TypeFor[T]())
+	out := make([]map[string]any, len(rows))
+	for i := range rows {
+		v := reflect.ValueOf(&rows[i]).Elem()
+		m := make(map[string]any, len(fields))
+		for _, f := range fields {
+			if idx, ok := index[f]; ok {
+				m[f] = v.Field(idx).Interface()
+			}
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// jsonFieldIndex maps the JSON names of t's fields to their index.
+func jsonFieldIndex(t reflect.Type) map[string]int {
+	index := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			index[name] = i
+		}
+	}
+	return index
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestListFieldsProjection(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now().UTC()
+	if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: "t1", ServiceName: "svc", Duration: 2500, Status: "STATUS_CODE_OK", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs([]storage.Log{{TraceID: "t1", ServiceName: "svc", Severity: "INFO", Body: "hello", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/traces", s.handleGetTraces)
+	mux.HandleFunc("GET /api/logs", s.handleGetLogs)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	var traces struct {
+		Traces []map[string]any `json:"traces"`
+		Total  int              `json:"total"`
+	}
+	rec := get("/api/traces?fields=trace_id,duration_ms")
+	if err := json.Unmarshal(rec.Body.Bytes(), &traces); err != nil || len(traces.Traces) != 1 {
+		t.Fatalf("traces = %d %s", rec.Code, rec.Body)
+	}
+	if got := traces.Traces[0]; len(got) != 2 || got["trace_id"] != "t1" || got["duration_ms"] != 2.5 || traces.Total != 1 {
+		t.Errorf("projected trace = %v (total %d), want trace_id and duration_ms only", got, traces.Total)
+	}
+
+	var logs struct {
+		Data []map[string]any `json:"data"`
+	}
+	rec = get("/api/logs?fields=body,%20severity")
+	if err := json.Unmarshal(rec.Body.Bytes(), &logs); err != nil || len(logs.Data) != 1 {
+		t.Fatalf("logs = %d %s", rec.Code, rec.Body)
+	}
+	if got := logs.Data[0]; len(got) != 2 || got["body"] != "hello" || got["severity"] != "INFO" {
+		t.Errorf("projected log = %v, want body and severity only", got)
+	}
+
+	for _, target := range []string{"/api/traces?fields=trace_id,spans", "/api/logs?fields=password"} {
+		if rec := get(target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", target, rec.Code)
+		} else {
+			decodeError(t, rec)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/purge"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestPurgeQueuesLargePurges(t *testing.T) {
+	s, repo := newTestServer(t)
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	logs := make([]storage.Log, 5)
+	for i := range logs {
+		logs[i] = storage.Log{ServiceName: "api", Body: storage.CompressedText("old " + strconv.Itoa(i)), Timestamp: old}
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	s.SetPurgeWorker(purge.New(repo, 2, 0), 3)
+
+	rec := httptest.NewRecorder()
+	s.handlePurge(rec, httptest.NewRequest(http.MethodDelete, "/api/admin/purge?days=7", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	var job storage.PurgeJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.FormatUint(uint64(job.ID), 10)
+	if job.Status != storage.PurgePending || rec.Header().Get("Location") != "/api/admin/purge/"+id {
+		t.Errorf("job %+v at %q, want a pending job with its status URL", job, rec.Header().Get("Location"))
+	}
+
+	call := func(method, id string, h http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/admin/purge/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+	if rec := call(http.MethodGet, "42", s.handleGetPurgeJob); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status = %d, want 404", rec.Code)
+	}
+	if rec := call(http.MethodGet, "x", s.handleGetPurgeJob); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad id: status = %d, want 400", rec.Code)
+	}
+
+	s.purger.RunPending(context.Background())
+	rec = call(http.MethodGet, id, s.handleGetPurgeJob)
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != storage.PurgeDone || job.LogsPurged != 5 {
+		t.Errorf("job = %+v, want done with 5 logs", job)
+	}
+	if rec := call(http.MethodDelete, id, s.handleCancelPurgeJob); rec.Code != http.StatusConflict {
+		t.Errorf("cancel finished job: status = %d, want 409", rec.Code)
+	}
+
+	// Within the inline limit the purge runs in the request.
+	rec = httptest.NewRecorder()
+	s.handlePurge(rec, httptest.NewRequest(http.MethodDelete, "/api/admin/purge?days=7", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("small purge: status = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
+)
+
+// handleListQuotas handles GET /api/admin/quotas
+func (s *Server) handleListQuotas(w http.ResponseWriter, r *http.Request) {
+	quotas, err := s.repo.ListServiceQuotas()
+	if err != nil {
+		writeInternalError(w, "Failed to list quotas", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quotas)
+}
+
+// handlePutQuota handles PUT /api/admin/quotas/{service}. A zero limit leaves that
+// signal unlimited.
+func (s *Server) handlePutQuota(w http.ResponseWriter, r *http.Request) {
+	var q storage.ServiceQuota
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	q.ServiceName = r.PathValue("service")
+	if q.MaxSpansPerDay < 0 || q.MaxLogsPerDay < 0 {
+		writeBadRequest(w, "quota limits must be >= 0")
+		return
+	}
+	if err := s.repo.UpsertServiceQuota(&q); err != nil {
+		writeInternalError(w, "Failed to save quota", err, "service", q.ServiceName)
+		return
+	}
+	s.reloadQuotas()
+
+	slog.Info("Service quota updated", "service", q.ServiceName, "max_spans_per_day", q.MaxSpansPerDay, "max_logs_per_day", q.MaxLogsPerDay)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(q)
+}
+
+// handleDeleteQuota handles DELETE /api/admin/quotas/{service}
+func (s *Server) handleDeleteQuota(w http.ResponseWriter, r *http.Request) {
+	service := r.PathValue("service")
+	if err := s.repo.DeleteServiceQuota(service); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeNotFound(w, "quota not found")
+			return
+		}
+		writeInternalError(w, "Failed to delete quota", err, "service", service)
+		return
+	}
+	s.reloadQuotas()
+
+	slog.Info("Service quota removed", "service", service)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetQuotaUsage handles GET /api/admin/quotas/usage
+func (s *Server) handleGetQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	if s.quota == nil {
+		writeUnavailable(w, "ingest quotas are not enabled")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.quota.Usage())
+}
+
+// reloadQuotas makes quota changes take effect at ingest immediately.
+func (s *Server) reloadQuotas() {
+	if s.quota == nil {
+		return
+	}
+	if err := s.quota.Reload(); err != nil {
+		slog.Error("Failed to reload quotas", "error", err)
+	}
+}
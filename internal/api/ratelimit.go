@@ -1,68 +1,86 @@
 package api
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+// expensiveRoutes are the routes whose concurrency SetConcurrencyLimit caps: each
+// scans many rows or assembles a whole trace.
+var expensiveRoutes = map[string]bool{
+	"GET /api/metrics/dashboard":      true,
+	"GET /api/metrics/service-map":    true,
+	"GET /api/traces/{id}":            true,
+	"GET /api/traces/{id}/flamegraph": true,
+}
+
+// Throttling reasons, as labeled on OtelContext_http_throttled_total.
+const (
+	throttleRate        = "rate_limit"
+	throttleConcurrency = "concurrency"
 )
 
-// RateLimiter is a per-IP token bucket rate limiter middleware.
+// RateLimiter is a token bucket rate limiter with one bucket per client: the
+// caller's token when multi-tenancy is on, the client IP otherwise.
 type RateLimiter struct {
 	mu      sync.Mutex
 	clients map[string]*ipBucket
-	rps     float64 // tokens per second per IP
+	rps     float64 // tokens per second per client
 	burst   float64 // max burst (= rps by default)
 }
 
-// NewRateLimiter creates a RateLimiter with the given requests-per-second limit.
-func NewRateLimiter(rps float64) *RateLimiter {
+// NewRateLimiter creates a RateLimiter allowing rps requests per second per client,
+// with bursts of up to burst requests (<= 0 means rps, and at least one).
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	b := float64(burst)
+	if burst <= 0 {
+		b = math.Max(rps, 1)
+	}
 	rl := &RateLimiter{
 		clients: make(map[string]*ipBucket),
 		rps:     rps,
-		burst:   rps,
+		burst:   b,
 	}
 	go rl.cleanup()
 	return rl
 }
 
-// Middleware returns an http.Handler that enforces rate limiting.
-func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := clientIP(r)
-		if !rl.allow(ip) {
-			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
-func (rl *RateLimiter) allow(ip string) bool {
+// allow takes a token from key's bucket. When there is none it reports how long
+// until the next one.
+func (rl *RateLimiter) allow(key string) (bool, time.Duration) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	b, ok := rl.clients[ip]
+	b, ok := rl.clients[key]
 	if !ok {
 		b = &ipBucket{
 			tokens:   rl.burst,
 			lastSeen: time.Now(),
 		}
-		rl.clients[ip] = b
+		rl.clients[key] = b
 	}
 	b.refill(rl.rps, rl.burst)
-	return b.take()
+	if b.take() {
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rl.rps * float64(time.Second))
 }
 
-// cleanup removes stale IP entries every minute.
+// cleanup removes stale client entries every minute.
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 	for range ticker.C {
 		rl.mu.Lock()
 		cutoff := time.Now().Add(-2 * time.Minute)
-		for ip, b := range rl.clients {
+		for key, b := range rl.clients {
 			if b.lastSeen.Before(cutoff) {
-				delete(rl.clients, ip)
+				delete(rl.clients, key)
 			}
 		}
 		rl.mu.Unlock()
@@ -92,6 +110,81 @@ func (b *ipBucket) take() bool {
 	return false
 }
 
+// SetRateLimiter limits every /api route with rl. Call before RegisterRoutes.
+func (s *Server) SetRateLimiter(rl *RateLimiter) {
+	s.rateLimiter = rl
+}
+
+// SetConcurrencyLimit lets at most n requests of each expensive route run at once;
+// further ones wait up to wait for a slot and are then answered 503. n <= 0 means no
+// limit. Call before RegisterRoutes.
+func (s *Server) SetConcurrencyLimit(n int, wait time.Duration) {
+	s.maxConcurrent = n
+	s.concurrencyWait = wait
+}
+
+// limited wraps the handler of pattern with the rate limiter and, for expensive
+// routes, the concurrency limit.
+func (s *Server) limited(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	if s.maxConcurrent > 0 && expensiveRoutes[pattern] {
+		h = s.limitConcurrency(pattern, h)
+	}
+	if rl := s.rateLimiter; rl != nil {
+		next := h
+		h = func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := rl.allow(rateLimitKey(r)); !ok {
+				s.throttled(pattern, throttleRate)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "rate limit exceeded", nil)
+				return
+			}
+			next(w, r)
+		}
+	}
+	return h
+}
+
+// limitConcurrency runs at most s.maxConcurrent requests of h at once.
+func (s *Server) limitConcurrency(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	slots := make(chan struct{}, s.maxConcurrent)
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			timer := time.NewTimer(s.concurrencyWait)
+			defer timer.Stop()
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				s.throttled(pattern, throttleConcurrency)
+				w.Header().Set("Retry-After", "1")
+				writeUnavailable(w, "too many concurrent requests for this endpoint")
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+		defer func() { <-slots }()
+		h(w, r)
+	}
+}
+
+// throttled counts a request rejected by a limiter.
+func (s *Server) throttled(pattern, reason string) {
+	if s.metrics != nil {
+		s.metrics.HTTPThrottled.WithLabelValues(routeLabel(pattern), reason).Inc()
+	}
+}
+
+// rateLimitKey identifies the client a request is counted against: its token's
+// identity when it was authenticated, its IP otherwise.
+func rateLimitKey(r *http.Request) string {
+	if id, ok := tenant.FromContext(r.Context()); ok {
+		return "token:" + id.String()
+	}
+	return "ip:" + clientIP(r)
+}
+
 // clientIP extracts the real client IP, respecting X-Forwarded-For.
 func clientIP(r *http.Request) string {
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
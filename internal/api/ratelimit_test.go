@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// throttleCounter gives s an unregistered throttled-requests counter and returns a
+// reader for it.
+func throttleCounter(s *Server) func(route, reason string) float64 {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "throttled"}, []string{"route", "reason"})
+	s.metrics = &telemetry.Metrics{HTTPThrottled: vec}
+	return func(route, reason string) float64 {
+		var m dto.Metric
+		vec.WithLabelValues(route, reason).Write(&m)
+		return m.GetCounter().GetValue()
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	s, _ := newTestServer(t)
+	count := throttleCounter(s)
+	s.SetRateLimiter(NewRateLimiter(0.5, 3))
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/version", nil)
+		req.RemoteAddr = ip + ":50000"
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	// Ten panels refreshing at once: the burst passes, the rest is turned away.
+	codes := map[int]int{}
+	var last *httptest.ResponseRecorder
+	for range 10 {
+		last = get("10.0.0.1")
+		codes[last.Code]++
+	}
+	if codes[http.StatusOK] != 3 || codes[http.StatusTooManyRequests] != 7 {
+		t.Fatalf("status codes = %v, want 3 OK and 7 throttled", codes)
+	}
+	if got := last.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2 (one token every 2s)", got)
+	}
+	if e := decodeError(t, last); e.Code != ErrCodeRateLimited {
+		t.Errorf("error code = %q, want %s", e.Code, ErrCodeRateLimited)
+	}
+	if n := count("/api/version", "rate_limit"); n != 7 {
+		t.Errorf("throttled counter = %v, want 7", n)
+	}
+
+	// Other clients have their own bucket.
+	if rec := get("10.0.0.2"); rec.Code != http.StatusOK {
+		t.Errorf("second client: status = %d, want 200", rec.Code)
+	}
+	// Routes outside /api are not limited.
+	req := httptest.NewRequest(http.MethodGet, "/metrics/prometheus", nil)
+	req.RemoteAddr = "10.0.0.1:50000"
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code == http.StatusTooManyRequests {
+		t.Error("/metrics/prometheus was rate limited")
+	}
+}
+
+func TestRateLimiterKeysOnToken(t *testing.T) {
+	rl := NewRateLimiter(1, 1)
+	req := func(tenantID string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/traces", nil)
+		r.RemoteAddr = "10.0.0.1:1234" // one proxy in front of every caller
+		if tenantID != "" {
+			r = r.WithContext(tenant.NewContext(r.Context(), tenant.Identity{Tenant: tenantID}))
+		}
+		return r
+	}
+	for _, id := range []string{"acme", "globex", ""} {
+		if ok, _ := rl.allow(rateLimitKey(req(id))); !ok {
+			t.Errorf("first request of %q throttled", id)
+		}
+	}
+	if ok, wait := rl.allow(rateLimitKey(req("acme"))); ok || wait <= 0 || wait > time.Second {
+		t.Errorf("second acme request = %v, wait %v; want throttled for up to 1s", ok, wait)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	s, _ := newTestServer(t)
+	count := throttleCounter(s)
+	s.SetConcurrencyLimit(2, 50*time.Millisecond)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	h := s.limited("GET /api/metrics/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	cheap := s.limited("GET /api/version", func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+	var done sync.WaitGroup
+	for range 2 {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			serve(h)
+		}()
+	}
+	<-started
+	<-started
+
+	// Both slots are taken: the third request waits briefly, then gets a 503.
+	start := time.Now()
+	rec := serve(h)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("third request: status = %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("rejected after %v, want it to queue for the wait first", waited)
+	}
+	if rec := serve(cheap); rec.Code != http.StatusOK {
+		t.Errorf("unlimited route: status = %d, want 200", rec.Code)
+	}
+	if n := count("/api/metrics/dashboard", "concurrency"); n != 1 {
+		t.Errorf("throttled counter = %v, want 1", n)
+	}
+
+	// A request queued long enough gets the slot freed by a finished one.
+	s.concurrencyWait = 5 * time.Second
+	queued := make(chan int)
+	go func() { queued <- serve(h).Code }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if code := <-queued; code != http.StatusOK {
+		t.Errorf("queued request: status = %d, want 200", code)
+	}
+	done.Wait()
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/realtime"
+)
+
+// RealtimeClients is the response of GET /api/realtime/clients.
+type RealtimeClients struct {
+	Clients []realtime.ClientInfo `json:"clients"`
+	Totals  realtime.ClientTotals `json:"totals"`
+}
+
+// handleListRealtimeClients handles GET /api/realtime/clients. It lists the clients
+// of /ws and /ws/events, longest connected first.
+func (s *Server) handleListRealtimeClients(w http.ResponseWriter, r *http.Request) {
+	clients := []realtime.ClientInfo{}
+	if s.eventHub != nil {
+		clients = append(clients, s.eventHub.Clients()...)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RealtimeClients{Clients: clients, Totals: realtime.SummarizeClients(clients)})
+}
+
+// handleDisconnectRealtimeClient handles DELETE /api/realtime/clients/{id}. The
+// client is closed with a policy-violation status and may reconnect.
+func (s *Server) handleDisconnectRealtimeClient(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.eventHub == nil || !s.eventHub.Disconnect(id) {
+		writeNotFound(w, "client not found")
+		return
+	}
+
+	slog.Info("Realtime client disconnected by admin", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
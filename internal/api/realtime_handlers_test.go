@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/realtime"
+	"github.com/coder/websocket"
+)
+
+func TestRealtimeClients(t *testing.T) {
+	events := realtime.NewEventHub(nil, nil)
+	defer events.Stop()
+	s := &Server{eventHub: events}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", events.HandleLegacyWebSocket)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseNow()
+
+	list := func() RealtimeClients {
+		rec := httptest.NewRecorder()
+		s.handleListRealtimeClients(rec, httptest.NewRequest(http.MethodGet, "/api/realtime/clients", nil))
+		var res RealtimeClients
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	var res RealtimeClients
+	for deadline := time.Now().Add(5 * time.Second); len(res.Clients) == 0 && time.Now().Before(deadline); {
+		res = list()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(res.Clients) != 1 || res.Clients[0].Hub != "ws" || res.Totals.Connected != 1 || res.Totals.ByHub["ws"] != 1 {
+		t.Fatalf("response = %+v, want the one /ws client", res)
+	}
+
+	disconnect := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/realtime/clients/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		s.handleDisconnectRealtimeClient(rec, req)
+		return rec
+	}
+	if rec := disconnect("unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: status = %d, want 404", rec.Code)
+	}
+	if rec := disconnect(res.Clients[0].ID); rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+	if _, _, err := conn.Read(ctx); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Errorf("client read error = %v, want policy violation close", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(list().Clients) != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("client still listed after disconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
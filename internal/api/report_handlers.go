@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/report"
+)
+
+// Report job states.
+const (
+	ReportRunning = "running"
+	ReportDone    = "done"
+	ReportFailed  = "failed"
+)
+
+// ReportJob is a report run started by POST /api/admin/report/run and polled through
+// GET /api/admin/report/run/{id}.
+type ReportJob struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	End        time.Time      `json:"end"` // end of the report day
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Result     *report.Result `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// reportJobs runs one report at a time and remembers the latest.
+type reportJobs struct {
+	mu     sync.Mutex
+	latest *ReportJob
+	wg     sync.WaitGroup // the running report
+}
+
+// get returns a copy of the job with the given ID, or nil if it is not the latest.
+func (j *reportJobs) get(id string) *ReportJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.latest == nil || j.latest.ID != id {
+		return nil
+	}
+	job := *j.latest
+	return &job
+}
+
+// start launches run in the background unless a job is still running, in which case
+// that job is returned with started false.
+func (j *reportJobs) start(end time.Time, run func() (*report.Result, error)) (job ReportJob, started bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.latest != nil && j.latest.Status == ReportRunning {
+		return *j.latest, false
+	}
+	j.latest = &ReportJob{
+		ID:        newCorrelationID(),
+		Status:    ReportRunning,
+		End:       end,
+		StartedAt: time.Now().UTC(),
+	}
+	running := j.latest
+
+	j.wg.Go(func() {
+		res, err := run()
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		finished := time.Now().UTC()
+		running.FinishedAt = &finished
+		if err != nil {
+			// Same policy as writeInternalError: the details stay in the server log.
+			running.Status = ReportFailed
+			running.Error = "report failed (correlation_id " + running.ID + ")"
+			slog.Error("Daily report run failed", "error", err, "correlation_id", running.ID)
+			return
+		}
+		running.Status = ReportDone
+		running.Result = res
+	})
+	return *running, true
+}
+
+// handleRunReport handles POST /api/admin/report/run. It builds the daily report for
+// the day before end (default: the previous full day in ?tz=, itself defaulting to
+// DISPLAY_TIMEZONE) and delivers it to the configured destinations.
+//
+// Delivery retries back off for up to a minute, so the run is a background job: the
+// response is the new job with its status URL in the Location header, and 409 with
+// the running job as details while another run is in progress.
+func (s *Server) handleRunReport(w http.ResponseWriter, r *http.Request) {
+	if s.reporter == nil {
+		writeUnavailable(w, "reports are not configured")
+		return
+	}
+	loc, ok := s.location(w, r)
+	if !ok {
+		return
+	}
+	end := report.StartOfDay(time.Now(), loc)
+	if v := r.URL.Query().Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeBadRequest(w, "invalid end parameter (expected RFC3339)")
+			return
+		}
+		end = t
+	}
+
+	job, started := s.reports.start(end, func() (*report.Result, error) {
+		return s.reporter.Run(s.jobContext(), end, loc)
+	})
+	if !started {
+		writeError(w, http.StatusConflict, ErrCodeConflict, "a report is already running", job)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/admin/report/run/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleGetReportRun handles GET /api/admin/report/run/{id}
+func (s *Server) handleGetReportRun(w http.ResponseWriter, r *http.Request) {
+	job := s.reports.get(r.PathValue("id"))
+	if job == nil {
+		writeNotFound(w, "report run not found; only the most recent one is kept")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
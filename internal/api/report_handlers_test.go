@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/report"
+)
+
+// failingSender never delivers.
+type failingSender struct{}
+
+func (failingSender) Channel() string { return "webhook" }
+func (failingSender) Send(context.Context, *report.Report, string) error {
+	return errors.New("connection refused")
+}
+
+func TestReportRunJob(t *testing.T) {
+	s, repo := newTestServer(t)
+	reporter := report.New(repo, failingSender{})
+	reporter.SetRetries(0)
+	s.SetReporter(reporter)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/admin/report/run", s.handleRunReport)
+	mux.HandleFunc("GET /api/admin/report/run/{id}", s.handleGetReportRun)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/admin/report/run?end=2026-01-02T00:00:00Z", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want 202 (%s)", rec.Code, rec.Body.String())
+	}
+	var job ReportJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	location := rec.Header().Get("Location")
+	if job.ID == "" || !job.End.Equal(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)) || location != "/api/admin/report/run/"+job.ID {
+		t.Fatalf("job = %+v, Location = %q", job, location)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == ReportRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, location, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET status = %d (%s)", rec.Code, rec.Body.String())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != ReportDone || job.FinishedAt == nil || job.Result == nil || job.Result.Report == nil {
+		t.Fatalf("finished job = %+v, want a built report", job)
+	}
+	if d := job.Result.Deliveries; len(d) != 1 || d[0].Delivered || d[0].Error == "" {
+		t.Errorf("deliveries = %+v, want the failed webhook delivery", d)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/report/run/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", rec.Code)
+	}
+}
+
+func TestReportRunOneAtATime(t *testing.T) {
+	var jobs reportJobs
+	release := make(chan struct{})
+	defer close(release)
+	first, started := jobs.start(time.Now(), func() (*report.Result, error) {
+		<-release
+		return &report.Result{}, nil
+	})
+	if !started {
+		t.Fatal("first run did not start")
+	}
+	running, started := jobs.start(time.Now(), nil)
+	if started || running.ID != first.ID {
+		t.Errorf("second start = %+v (started %v), want the running job back", running, started)
+	}
+}
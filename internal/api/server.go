@@ -1,118 +1,392 @@
-package api
-
-import (
-	"net/http"
-	"time"
-
-	"github.com/RandomCodeSpace/otelcontext/internal/cache"
-	"github.com/RandomCodeSpace/otelcontext/internal/graph"
-	"github.com/RandomCodeSpace/otelcontext/internal/graphrag"
-	"github.com/RandomCodeSpace/otelcontext/internal/realtime"
-	"github.com/RandomCodeSpace/otelcontext/internal/storage"
-	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
-	"github.com/RandomCodeSpace/otelcontext/internal/vectordb"
-)
-
-// Server handles HTTP API requests.
-type Server struct {
-	repo      *storage.Repository
-	hub       *realtime.Hub
-	eventHub  *realtime.EventHub
-	metrics   *telemetry.Metrics
-	cache     *cache.TTLCache
-	graph     *graph.Graph       // in-memory service dependency graph (may be nil before first build)
-	graphRAG  *graphrag.GraphRAG // layered GraphRAG for advanced queries
-	vectorIdx *vectordb.Index    // TF-IDF semantic log search index
-	coldPath  string             // cold storage base path for archive search
-}
-
-// NewServer creates a new API server.
-func NewServer(repo *storage.Repository, hub *realtime.Hub, eventHub *realtime.EventHub, metrics *telemetry.Metrics) *Server {
-	return &Server{
-		repo:     repo,
-		hub:      hub,
-		eventHub: eventHub,
-		metrics:  metrics,
-		cache:    cache.New(),
-	}
-}
-
-// SetGraph wires the in-memory service graph into the API server.
-func (s *Server) SetGraph(g *graph.Graph) {
-	s.graph = g
-}
-
-// SetGraphRAG wires the GraphRAG instance for advanced queries.
-func (s *Server) SetGraphRAG(g *graphrag.GraphRAG) {
-	s.graphRAG = g
-}
-
-// SetVectorIndex wires the TF-IDF vector index for semantic log search.
-func (s *Server) SetVectorIndex(idx *vectordb.Index) {
-	s.vectorIdx = idx
-}
-
-// SetColdStoragePath sets the base path for cold archive search.
-func (s *Server) SetColdStoragePath(path string) {
-	s.coldPath = path
-}
-
-// RegisterRoutes registers API endpoints on the provided mux.
-func (s *Server) RegisterRoutes(mux *http.ServeMux) {
-	// Metadata & Discovery
-	mux.HandleFunc("GET /api/metadata/services", s.handleGetServices)
-	mux.HandleFunc("GET /api/metadata/metrics", s.handleGetMetricNames)
-
-	// Metrics & Dashboard
-	mux.HandleFunc("GET /api/metrics", s.handleGetMetricBuckets)
-	mux.HandleFunc("GET /api/metrics/traffic", s.handleGetTrafficMetrics)
-	mux.HandleFunc("GET /api/metrics/latency_heatmap", s.handleGetLatencyHeatmap)
-	mux.HandleFunc("GET /api/metrics/dashboard", s.handleGetDashboardStats)
-	mux.HandleFunc("GET /api/metrics/service-map", s.handleGetServiceMapMetrics)
-
-	// System Graph (AI-consumable topology + health)
-	mux.HandleFunc("GET /api/system/graph", s.handleGetSystemGraph)
-
-	// Archive search (cold storage)
-	mux.HandleFunc("GET /api/archive/search", s.handleSearchColdArchive)
-
-	// Traces
-	mux.HandleFunc("GET /api/traces", s.handleGetTraces)
-	mux.HandleFunc("GET /api/traces/{id}", s.handleGetTraceByID)
-
-	// Logs
-	mux.HandleFunc("GET /api/logs", s.handleGetLogs)
-	mux.HandleFunc("GET /api/logs/context", s.handleGetLogContext)
-	mux.HandleFunc("GET /api/logs/similar", s.handleGetSimilarLogs)
-	mux.HandleFunc("GET /api/logs/{id}/insight", s.handleGetLogInsight)
-
-	// Admin & System
-	mux.HandleFunc("GET /api/stats", s.handleGetStats)
-	mux.HandleFunc("GET /api/health", s.metrics.HealthHandler())
-	mux.Handle("GET /metrics/prometheus", telemetry.PrometheusHandler())
-	mux.HandleFunc("DELETE /api/admin/purge", s.handlePurge)
-	mux.HandleFunc("POST /api/admin/vacuum", s.handleVacuum)
-
-	// WebSockets
-	mux.HandleFunc("/ws", s.hub.HandleWebSocket)
-	mux.HandleFunc("/ws/health", s.metrics.HealthWSHandler())
-	mux.HandleFunc("/ws/events", s.eventHub.HandleWebSocket)
-}
-
-// parseTimeRange parses start and end times from request query parameters
-func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
-	var start, end time.Time
-
-	if startStr := r.URL.Query().Get("start"); startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			start = t
-		}
-	}
-	if endStr := r.URL.Query().Get("end"); endStr != "" {
-		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			end = t
-		}
-	}
-
-	return start, end, nil
-}
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/archive"
+	"github.com/RandomCodeSpace/otelcontext/internal/buildinfo"
+	"github.com/RandomCodeSpace/otelcontext/internal/cache"
+	"github.com/RandomCodeSpace/otelcontext/internal/demo"
+	"github.com/RandomCodeSpace/otelcontext/internal/export"
+	"github.com/RandomCodeSpace/otelcontext/internal/graph"
+	"github.com/RandomCodeSpace/otelcontext/internal/graphrag"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/liveness"
+	"github.com/RandomCodeSpace/otelcontext/internal/purge"
+	"github.com/RandomCodeSpace/otelcontext/internal/queue"
+	"github.com/RandomCodeSpace/otelcontext/internal/quota"
+	"github.com/RandomCodeSpace/otelcontext/internal/realtime"
+	"github.com/RandomCodeSpace/otelcontext/internal/report"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+	"github.com/RandomCodeSpace/otelcontext/internal/vectordb"
+)
+
+// Server handles HTTP API requests.
+type Server struct {
+	repo         storage.Backend
+	eventHub     *realtime.EventHub // serves /ws/events and the legacy /ws
+	metrics      *telemetry.Metrics
+	cache        *cache.TTLCache
+	graph        *graph.Graph          // in-memory service dependency graph (may be nil before first build)
+	graphRAG     *graphrag.GraphRAG    // layered GraphRAG for advanced queries
+	vectorIdx    *vectordb.Index       // TF-IDF semantic log search index
+	coldPath     string                // cold storage base path for archive search
+	purgeArchive *archive.PurgeArchive // pre-purge trace archive (nil when ARCHIVE_ENABLED=false)
+	ringBuf      *tsdb.RingBuffer      // recent per-window metric aggregates, used to rebuild buckets
+	quota        *quota.Manager        // per-service ingest quotas (nil = usage endpoint unavailable)
+	filters      *ingest.Filters       // runtime ingest filters (nil = ingest-config endpoints unavailable)
+	reporter     *report.Generator     // daily report (nil = report endpoint unavailable)
+	mapWindow    time.Duration         // range covered by one service map snapshot
+	rawRetention time.Duration         // spans older than this are assumed purged
+	version      string                // build version reported in the OpenAPI document
+	build        buildinfo.Info        // reported by GET /api/version
+	importMax    int64                 // size cap for POST /api/import bodies
+	forwarder    *export.Forwarder     // POST /api/traces/{id}/forward (nil = no endpoints allowed)
+	openAPISpec  []byte                // rendered by RegisterRoutes
+	integrity    integrityJobs         // background integrity checks
+	reports      reportJobs            // on-demand report runs
+	pprof        bool                  // serve /api/admin/pprof/ (PPROF_ENABLED)
+	backupMu     sync.Mutex            // one backup snapshot or restore at a time
+	restoreOn    bool                  // allow POST /api/admin/restore (RESTORE_ENABLED)
+	restoreMax   int64                 // size cap for restore uploads
+	tenants      *tenant.Tokens        // API and ingest tokens (nil = multi-tenancy off)
+	demo         *demo.Generator       // simulated traffic (nil = not in demo mode)
+
+	depDefaults   storage.DependencyQuery // thresholds for /api/services/{name}/dependencies
+	suppressAfter int                     // unhelpful insight ratings that suppress a fingerprint
+	purger        *purge.Worker           // background purge jobs (nil = purges always run inline)
+	purgeSyncMax  int64                   // purges of up to this many rows run inline
+	displayLoc    *time.Location          // default ?tz= of bucketed endpoints (DISPLAY_TIMEZONE)
+	baselines     *baselineCache          // per-operation latency baselines of GET /api/traces/{id}?baseline=
+	liveness      *liveness.Tracker       // per-service export liveness (nil = liveness endpoint unavailable)
+	dlq           *queue.DeadLetterQueue  // failed writes awaiting replay (nil = DLQ endpoint unavailable)
+	slowQueries   *storage.SlowQueryLog   // recent slow statements (nil = slow query endpoint unavailable)
+	maxRange      time.Duration           // longest window of the time-range-guarded endpoints (0 = unlimited)
+	draining      atomic.Bool             // shutting down: GET /api/ready reports not ready
+	jobsCtx       context.Context         // background jobs started through the API; cancelled by Stop
+	stopJobs      context.CancelFunc
+
+	rateLimiter     *RateLimiter  // per-client limit of /api routes (nil = unlimited)
+	maxConcurrent   int           // concurrent requests per expensive route (0 = unlimited)
+	concurrencyWait time.Duration // how long excess requests wait for a slot
+}
+
+// NewServer creates a new API server.
+func NewServer(repo storage.Backend, eventHub *realtime.EventHub, metrics *telemetry.Metrics) *Server {
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	return &Server{
+		repo:      repo,
+		eventHub:  eventHub,
+		metrics:   metrics,
+		cache:     cache.New(),
+		version:   "dev",
+		mapWindow: 5 * time.Minute,
+		depDefaults: storage.DependencyQuery{
+			ErrorRateDelta: storage.DefaultDependencyErrorRateDelta,
+			LatencyChange:  storage.DefaultDependencyLatencyChange,
+			MinCalls:       storage.DefaultDependencyMinCalls,
+		},
+		suppressAfter: storage.DefaultInsightSuppressAfter,
+		baselines:     newBaselineCache(baselineCacheTTL),
+		maxRange:      defaultMaxTimeRange,
+		jobsCtx:       jobsCtx,
+		stopJobs:      stopJobs,
+	}
+}
+
+// Stop cancels the integrity checks and report runs started through the API and
+// waits for them to return.
+func (s *Server) Stop() {
+	if s.stopJobs != nil {
+		s.stopJobs()
+	}
+	s.integrity.wg.Wait()
+	s.reports.wg.Wait()
+}
+
+// jobContext is the context of background jobs started through the API, which
+// outlive the request that started them.
+func (s *Server) jobContext() context.Context {
+	if s.jobsCtx == nil {
+		return context.Background() // a Server not made by NewServer, as in tests
+	}
+	return s.jobsCtx
+}
+
+// SetGraph wires the in-memory service graph into the API server.
+func (s *Server) SetGraph(g *graph.Graph) {
+	s.graph = g
+}
+
+// SetGraphRAG wires the GraphRAG instance for advanced queries.
+func (s *Server) SetGraphRAG(g *graphrag.GraphRAG) {
+	s.graphRAG = g
+}
+
+// SetVectorIndex wires the TF-IDF vector index for semantic log search.
+func (s *Server) SetVectorIndex(idx *vectordb.Index) {
+	s.vectorIdx = idx
+}
+
+// SetColdStoragePath sets the base path for cold archive search.
+func (s *Server) SetColdStoragePath(path string) {
+	s.coldPath = path
+}
+
+// SetPurgeArchive wires the pre-purge trace archive for the admin archive endpoints.
+func (s *Server) SetPurgeArchive(p *archive.PurgeArchive) {
+	s.purgeArchive = p
+}
+
+// SetRingBuffer wires the TSDB ring buffer used by metric re-aggregation.
+func (s *Server) SetRingBuffer(rb *tsdb.RingBuffer) {
+	s.ringBuf = rb
+}
+
+// SetDLQ wires the dead letter queue reported by GET /api/admin/dlq.
+func (s *Server) SetDLQ(d *queue.DeadLetterQueue) {
+	s.dlq = d
+}
+
+// SetSlowQueryLog wires the slow statements reported by GET /api/admin/slow-queries.
+func (s *Server) SetSlowQueryLog(l *storage.SlowQueryLog) {
+	s.slowQueries = l
+}
+
+// SetQuotaManager wires the ingest quota manager so quota changes apply immediately.
+func (s *Server) SetQuotaManager(q *quota.Manager) {
+	s.quota = q
+}
+
+// SetLiveness wires the per-service export liveness tracker.
+func (s *Server) SetLiveness(t *liveness.Tracker) {
+	s.liveness = t
+}
+
+// SetReporter wires the daily report generator for on-demand runs.
+func (s *Server) SetReporter(g *report.Generator) {
+	s.reporter = g
+}
+
+// SetServiceMapHistory sets the window of stored service map snapshots and how long
+// raw spans are kept. Past service maps within rawRetention are computed from spans;
+// older ones come from snapshots.
+func (s *Server) SetServiceMapHistory(window, rawRetention time.Duration) {
+	if window > 0 {
+		s.mapWindow = window
+	}
+	s.rawRetention = rawRetention
+}
+
+// SetIngestFilters wires the receivers' shared ingest filters so they can be changed at runtime.
+func (s *Server) SetIngestFilters(f *ingest.Filters) {
+	s.filters = f
+}
+
+// SetImportMaxBytes sets the size cap for uploaded import files.
+func (s *Server) SetImportMaxBytes(n int64) {
+	if n > 0 {
+		s.importMax = n
+	}
+}
+
+// SetTraceForwarder enables POST /api/traces/{id}/forward to the forwarder's endpoints.
+func (s *Server) SetTraceForwarder(f *export.Forwarder) {
+	s.forwarder = f
+}
+
+// SetBuildInfo sets the build reported by GET /api/version and in the OpenAPI document.
+func (s *Server) SetBuildInfo(info buildinfo.Info) {
+	s.build = info
+	s.version = info.Version
+}
+
+// SetRestore allows POST /api/admin/restore, with uploads capped at maxBytes
+// (<= 0 keeps the default).
+func (s *Server) SetRestore(enabled bool, maxBytes int64) {
+	s.restoreOn = enabled
+	if maxBytes > 0 {
+		s.restoreMax = maxBytes
+	}
+}
+
+// SetDependencyThresholds sets when GET /api/services/{name}/dependencies flags a
+// dependency as degraded; requests may override them.
+func (s *Server) SetDependencyThresholds(errorRateDelta, latencyChange float64, minCalls int) {
+	s.depDefaults.ErrorRateDelta = errorRateDelta
+	s.depDefaults.LatencyChange = latencyChange
+	s.depDefaults.MinCalls = int64(minCalls)
+}
+
+// SetDisplayTimezone sets the time zone that day and hour buckets are aligned in
+// when a request names none.
+func (s *Server) SetDisplayTimezone(loc *time.Location) {
+	s.displayLoc = loc
+}
+
+// SetPurgeWorker makes DELETE /api/admin/purge queue purges of more than syncMaxRows
+// rows as background jobs run by w.
+func (s *Server) SetPurgeWorker(w *purge.Worker, syncMaxRows int64) {
+	s.purger = w
+	s.purgeSyncMax = syncMaxRows
+}
+
+// SetInsightSuppression sets how many unhelpful ratings suppress AI analysis of an
+// error fingerprint, as reported by the insight endpoints. It should match the AI
+// service's setting.
+func (s *Server) SetInsightSuppression(suppressAfter int) {
+	s.suppressAfter = suppressAfter
+}
+
+// SetPprofEnabled exposes the net/http/pprof profiles under /api/admin/pprof/.
+func (s *Server) SetPprofEnabled(enabled bool) {
+	s.pprof = enabled
+}
+
+// RegisterRoutes registers API endpoints on the provided mux. Routes documented in
+// apiRoutes have their query parameters validated before the handler runs.
+func (s *Server) RegisterRoutes(mux *http.ServeMux) {
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, s.limited(pattern, withQueryRoute(pattern, validateParams(routeSpecs[pattern], h))))
+	}
+	// Admin routes are audited, including calls rejected by parameter validation.
+	// With multi-tenancy on, all but tenantAdminRoutes need the super-admin token.
+	admin := func(pattern string, h http.HandlerFunc) {
+		if !tenantAdminRoutes[pattern] {
+			h = s.superAdminOnly(h)
+		}
+		mux.HandleFunc(pattern, s.limited(pattern, withQueryRoute(pattern, s.audited(validateParams(routeSpecs[pattern], h)))))
+	}
+	// Routes serving instance-wide data are limited to the super-admin likewise.
+	global := func(pattern string, h http.HandlerFunc) {
+		handle(pattern, s.superAdminOnly(h))
+	}
+
+	// API description
+	s.openAPISpec = marshalOpenAPI(s.version)
+	mux.HandleFunc("GET /api/openapi.json", s.handleGetOpenAPI)
+
+	// Metadata & Discovery
+	handle("GET /api/metadata/services", s.handleGetServices)
+	handle("GET /api/metadata/environments", s.handleGetEnvironments)
+	global("PUT /api/metadata/services/{name}", s.handlePutServiceMetadata)
+	global("POST /api/metadata/services/import", s.handleImportServiceMetadata)
+	global("GET /api/metadata/services/export", s.handleExportServiceMetadata)
+	handle("GET /api/services/liveness", s.handleGetServiceLiveness)
+	handle("GET /api/services/{name}/dependencies", s.handleGetServiceDependencies)
+	handle("GET /api/metadata/metrics", s.handleGetMetricNames)
+
+	// Metrics & Dashboard
+	handle("GET /api/metrics", s.handleGetMetricBuckets)
+	handle("POST /api/metrics/query", s.handleQueryMetrics)
+	handle("GET /api/metrics/traffic", s.handleGetTrafficMetrics)
+	handle("GET /api/metrics/latency_heatmap", s.handleGetLatencyHeatmap)
+	handle("GET /api/metrics/latency_by_status", s.handleGetLatencyByStatus)
+	handle("GET /api/metrics/dashboard", s.handleGetDashboardStats)
+	handle("GET /api/metrics/service-map", s.handleGetServiceMapMetrics)
+	global("GET /api/metrics/service-map/history", s.handleGetServiceMapHistory)
+
+	// System Graph (AI-consumable topology + health)
+	global("GET /api/system/graph", s.handleGetSystemGraph)
+
+	// Archive search (cold storage)
+	global("GET /api/archive/search", s.handleSearchColdArchive)
+
+	// Traces
+	handle("GET /api/traces", s.handleGetTraces)
+	handle("GET /api/traces/paths", s.handleGetTracePaths)
+	handle("GET /api/traces/by-logs", s.handleGetTracesByLogs)
+	handle("GET /api/traces/query", s.handleQueryTraces)
+	handle("GET /api/traces/lookup", s.handleLookupTrace)
+	handle("GET /api/traces/{id}", s.handleGetTraceByID)
+	handle("GET /api/traces/{id}/flamegraph", s.handleGetTraceFlamegraph)
+	handle("GET /api/traces/{id}/related", s.handleGetRelatedTraces)
+	handle("POST /api/traces/{id}/annotations", s.handleCreateTraceAnnotation)
+	handle("DELETE /api/traces/{id}/annotations", s.handleDeleteTraceAnnotations)
+	handle("POST /api/traces/{id}/forward", s.handleForwardTrace)
+	handle("GET /api/spans", s.handleGetSpans)
+
+	// Logs
+	handle("GET /api/logs", s.handleGetLogs)
+	handle("GET /api/logs/context", s.handleGetLogContext)
+	global("GET /api/logs/similar", s.handleGetSimilarLogs)
+	handle("GET /api/logs/{id}", s.handleGetLog)
+	handle("GET /api/logs/{id}/insight", s.handleGetLogInsight)
+	handle("POST /api/logs/{id}/insight/feedback", s.handleCreateInsightFeedback)
+	handle("GET /api/ai/feedback/summary", s.handleGetInsightFeedbackSummary)
+	handle("GET /api/logs/{id}/raw", s.handleGetLogRaw)
+
+	// SLOs
+	global("GET /api/slos", s.handleListSLOs)
+	global("POST /api/slos", s.handleCreateSLO)
+	global("GET /api/slos/status", s.handleGetSLOStatus)
+	global("GET /api/slos/{id}", s.handleGetSLO)
+	global("PUT /api/slos/{id}", s.handleUpdateSLO)
+	global("DELETE /api/slos/{id}", s.handleDeleteSLO)
+
+	// Anomalies
+	global("GET /api/anomalies", s.handleGetAnomalies)
+
+	// Admin & System
+	handle("GET /api/stats", s.handleGetStats)
+	handle("GET /api/health", s.metrics.HealthHandler())
+	handle("GET /api/version", s.handleGetVersion)
+	handle("GET /api/ready", s.handleReady)
+	mux.Handle("GET /metrics/prometheus", telemetry.PrometheusHandler())
+	admin("DELETE /api/admin/purge", s.handlePurge)
+	admin("GET /api/admin/purge/{id}", s.handleGetPurgeJob)
+	admin("DELETE /api/admin/purge/{id}", s.handleCancelPurgeJob)
+	admin("DELETE /api/admin/data", s.handlePurgeService)
+	admin("POST /api/admin/remap-service", s.handleRemapService)
+	admin("POST /api/admin/vacuum", s.handleVacuum)
+	admin("POST /api/admin/integrity", s.handleStartIntegrityCheck)
+	admin("GET /api/admin/integrity/{id}", s.handleGetIntegrityCheck)
+	admin("GET /api/admin/indexes", s.handleGetIndexes)
+	admin("GET /api/admin/dlq", s.handleGetDLQ)
+	admin("GET /api/admin/outbox", s.handleGetOutbox)
+	admin("GET /api/admin/slow-queries", s.handleGetSlowQueries)
+	admin("POST /api/admin/metrics/reaggregate", s.handleReaggregateMetrics)
+	admin("GET /api/admin/archive", s.handleListArchives)
+	admin("POST /api/admin/archive/restore", s.handleRestoreArchive)
+	admin("GET /api/admin/quotas", s.handleListQuotas)
+	admin("GET /api/admin/quotas/usage", s.handleGetQuotaUsage)
+	admin("PUT /api/admin/quotas/{service}", s.handlePutQuota)
+	admin("DELETE /api/admin/quotas/{service}", s.handleDeleteQuota)
+	admin("GET /api/admin/ingest-config", s.handleGetIngestConfig)
+	admin("PUT /api/admin/ingest-config", s.handlePutIngestConfig)
+	admin("POST /api/admin/report/run", s.handleRunReport)
+	admin("GET /api/admin/report/run/{id}", s.handleGetReportRun)
+	admin("GET /api/admin/audit", s.handleListAudit)
+	admin("GET /api/admin/backup", s.handleBackup)
+	admin("POST /api/admin/restore", s.handleRestore)
+	admin("GET /api/admin/loglevel", s.handleGetLogLevel)
+	admin("PUT /api/admin/loglevel", s.handlePutLogLevel)
+	admin("GET /api/admin/demo", s.handleDemo)
+	admin("POST /api/admin/demo/start", s.handleDemoStart)
+	admin("POST /api/admin/demo/stop", s.handleDemoStop)
+	global("GET /api/realtime/clients", s.handleListRealtimeClients)
+	admin("DELETE /api/realtime/clients/{id}", s.handleDisconnectRealtimeClient)
+	if s.pprof {
+		mux.HandleFunc("GET /api/admin/pprof/", s.superAdminOnly(handlePprof))
+		mux.HandleFunc("GET /api/admin/pprof/{profile}", s.superAdminOnly(handlePprof))
+	}
+	handle("POST /api/import", s.handleImport)
+
+	// WebSockets
+	mux.HandleFunc("/ws", s.eventHub.HandleLegacyWebSocket)
+	mux.HandleFunc("/ws/health", s.metrics.HealthWSHandler())
+	mux.HandleFunc("/ws/events", s.eventHub.HandleWebSocket)
+}
+
+// validErrorMode reports whether an error_mode query value is supported; empty
+// means the default root-only semantics.
+func validErrorMode(mode string) bool {
+	return mode == "" || mode == storage.ErrorModeRoot || mode == storage.ErrorModeRollup
+}
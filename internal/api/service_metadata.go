@@ -0,0 +1,298 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// serviceMetadataMaxBytes caps service catalog imports.
+const serviceMetadataMaxBytes = 4 << 20
+
+// serviceMetadataColumns are the CSV columns of the service catalog, in export order.
+// The links column holds "title=url" pairs separated by ";".
+var serviceMetadataColumns = []string{"service_name", "owner", "team", "tier", "description", "links"}
+
+// ServiceSummary is a service that has reported telemetry, with its catalog metadata.
+type ServiceSummary struct {
+	Name     string                   `json:"name"`
+	Metadata *storage.ServiceMetadata `json:"metadata"` // null when the catalog has no entry
+}
+
+// handlePutServiceMetadata handles PUT /api/metadata/services/{name}
+func (s *Server) handlePutServiceMetadata(w http.ResponseWriter, r *http.Request) {
+	var m storage.ServiceMetadata
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	m.ServiceName = r.PathValue("name")
+	if err := validateServiceMetadata(&m); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if err := s.repo.UpsertServiceMetadata(&m); err != nil {
+		writeInternalError(w, "Failed to save service metadata", err, "service", m.ServiceName)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// handleImportServiceMetadata handles POST /api/metadata/services/import?format=csv|json
+// The file is the request body or the "file" field of a multipart form; without
+// ?format= a text/csv body is read as CSV. Rows replace the metadata of their
+// services, including services that have not reported yet; nothing is saved when any
+// row is invalid.
+func (s *Server) handleImportServiceMetadata(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+			format = "csv"
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, serviceMetadataMaxBytes)
+	body, err := importFile(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	var rows []storage.ServiceMetadata
+	if format == "csv" {
+		rows, err = parseServiceMetadataCSV(body)
+	} else {
+		err = json.NewDecoder(body).Decode(&rows)
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+				fmt.Sprintf("import file exceeds %d bytes", serviceMetadataMaxBytes), nil)
+			return
+		}
+		writeBadRequest(w, fmt.Sprintf("invalid %s: %v", format, err))
+		return
+	}
+	seen := make(map[string]bool, len(rows))
+	for i := range rows {
+		if err := validateServiceMetadata(&rows[i]); err != nil {
+			writeBadRequest(w, fmt.Sprintf("row %d: %v", i+1, err))
+			return
+		}
+		if seen[rows[i].ServiceName] {
+			writeBadRequest(w, fmt.Sprintf("row %d: service %q appears more than once", i+1, rows[i].ServiceName))
+			return
+		}
+		seen[rows[i].ServiceName] = true
+	}
+	if err := s.repo.ImportServiceMetadata(rows); err != nil {
+		writeInternalError(w, "Failed to import service metadata", err)
+		return
+	}
+
+	slog.Info("Imported service metadata", "format", format, "services", len(rows))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"imported": len(rows)})
+}
+
+// handleExportServiceMetadata handles GET /api/metadata/services/export?format=csv|json
+// The file can be imported again as it is.
+func (s *Server) handleExportServiceMetadata(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.repo.ListServiceMetadata()
+	if err != nil {
+		writeInternalError(w, "Failed to list service metadata", err)
+		return
+	}
+	if r.URL.Query().Get("format") == "csv" {
+		var buf bytes.Buffer
+		if err := writeServiceMetadataCSV(&buf, rows); err != nil {
+			writeInternalError(w, "Failed to write service metadata", err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="service-metadata.csv"`)
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="service-metadata.json"`)
+	json.NewEncoder(w).Encode(rows)
+}
+
+// serviceMetadataByName returns the catalog keyed by service name.
+func (s *Server) serviceMetadataByName() (map[string]*storage.ServiceMetadata, error) {
+	rows, err := s.repo.ListServiceMetadata()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*storage.ServiceMetadata, len(rows))
+	for i := range rows {
+		byName[rows[i].ServiceName] = &rows[i]
+	}
+	return byName, nil
+}
+
+// withServiceMetadata returns a copy of m whose nodes carry their catalog metadata.
+// m itself may be shared with a cache, so it is left alone.
+func (s *Server) withServiceMetadata(m *storage.ServiceMapMetrics) (*storage.ServiceMapMetrics, error) {
+	if m == nil {
+		return nil, nil
+	}
+	byName, err := s.serviceMetadataByName()
+	if err != nil || len(byName) == 0 {
+		return m, err
+	}
+	out := *m
+	out.Nodes = slices.Clone(m.Nodes)
+	for i := range out.Nodes {
+		out.Nodes[i].Metadata = byName[out.Nodes[i].Name]
+	}
+	return &out, nil
+}
+
+// validateServiceMetadata checks the tier and the links, and trims the text fields.
+func validateServiceMetadata(m *storage.ServiceMetadata) error {
+	m.ServiceName = strings.TrimSpace(m.ServiceName)
+	m.Owner = strings.TrimSpace(m.Owner)
+	m.Team = strings.TrimSpace(m.Team)
+	m.Tier = strings.ToLower(strings.TrimSpace(m.Tier))
+	m.Description = strings.TrimSpace(m.Description)
+	if m.ServiceName == "" {
+		return errors.New("service_name is required")
+	}
+	if m.Tier != "" && !slices.Contains(storage.ServiceTiers, m.Tier) {
+		return fmt.Errorf("tier must be one of %s, got %q", strings.Join(storage.ServiceTiers, ", "), m.Tier)
+	}
+	if len(m.Description) > 1024 {
+		return errors.New("description must be at most 1024 bytes")
+	}
+	for i, l := range m.Links {
+		l.Title, l.URL = strings.TrimSpace(l.Title), strings.TrimSpace(l.URL)
+		if l.Title == "" {
+			return fmt.Errorf("link %d needs a title", i+1)
+		}
+		// Kept out of titles so the CSV links column can always be read back.
+		if strings.ContainsAny(l.Title, ";=") {
+			return fmt.Errorf("link title %q must not contain ';' or '='", l.Title)
+		}
+		u, err := url.Parse(l.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("link %q must be an absolute http or https URL, got %q", l.Title, l.URL)
+		}
+		m.Links[i] = l
+	}
+	return nil
+}
+
+// parseServiceMetadataCSV reads a CSV file with a header row naming some of
+// serviceMetadataColumns, in any order; service_name is required. A leading UTF-8
+// byte order mark, as spreadsheet programs write, is skipped.
+func parseServiceMetadataCSV(r io.Reader) ([]storage.ServiceMetadata, error) {
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	cr := csv.NewReader(br)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("missing header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(serviceMetadataColumns, name) {
+			return nil, fmt.Errorf("unknown column %q; columns are %s", name, strings.Join(serviceMetadataColumns, ", "))
+		}
+		if _, dup := index[name]; dup {
+			return nil, fmt.Errorf("column %q appears more than once", name)
+		}
+		index[name] = i
+	}
+	if _, ok := index["service_name"]; !ok {
+		return nil, errors.New("missing service_name column")
+	}
+
+	var rows []storage.ServiceMetadata
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		line, _ := cr.FieldPos(0)
+		links, err := parseServiceLinks(field("links"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, storage.ServiceMetadata{
+			ServiceName: field("service_name"),
+			Owner:       field("owner"),
+			Team:        field("team"),
+			Tier:        field("tier"),
+			Description: field("description"),
+			Links:       links,
+		})
+	}
+}
+
+// writeServiceMetadataCSV writes rows in the format parseServiceMetadataCSV reads.
+func writeServiceMetadataCSV(w io.Writer, rows []storage.ServiceMetadata) error {
+	cw := csv.NewWriter(w)
+	cw.Write(serviceMetadataColumns)
+	for _, m := range rows {
+		cw.Write([]string{m.ServiceName, m.Owner, m.Team, m.Tier, m.Description, formatServiceLinks(m.Links)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseServiceLinks reads the CSV links column: "title=url" pairs separated by ";".
+func parseServiceLinks(s string) ([]storage.ServiceLink, error) {
+	links := []storage.ServiceLink{}
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		title, link, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("link %q is not title=url", strings.TrimSpace(pair))
+		}
+		links = append(links, storage.ServiceLink{Title: strings.TrimSpace(title), URL: strings.TrimSpace(link)})
+	}
+	return links, nil
+}
+
+// formatServiceLinks writes the CSV links column. A ";" in a URL is percent-encoded,
+// which leaves the URL the same.
+func formatServiceLinks(links []storage.ServiceLink) string {
+	pairs := make([]string, len(links))
+	for i, l := range links {
+		pairs[i] = l.Title + "=" + strings.ReplaceAll(l.URL, ";", "%3B")
+	}
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestParseServiceMetadataCSV(t *testing.T) {
+	in := "\xef\xbb\xbfteam,SERVICE_NAME,links,tier,description\r\n" +
+		`payments,checkout,"Runbook=https://wiki.example.com/checkout?a=1;Dashboard = https://grafana.example.com/d/x",Critical,"Takes orders, ""fast"""` + "\r\n" +
+		`search,query,,,"multi` + "\n" + `line"` + "\r\n"
+	rows, err := parseServiceMetadataCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parseServiceMetadataCSV() error = %v", err)
+	}
+	want := []storage.ServiceMetadata{
+		{ServiceName: "checkout", Team: "payments", Tier: "Critical", Description: `Takes orders, "fast"`, Links: []storage.ServiceLink{
+			{Title: "Runbook", URL: "https://wiki.example.com/checkout?a=1"},
+			{Title: "Dashboard", URL: "https://grafana.example.com/d/x"},
+		}},
+		{ServiceName: "query", Team: "search", Description: "multi\nline", Links: []storage.ServiceLink{}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v\nwant %+v", rows, want)
+	}
+}
+
+func TestParseServiceMetadataCSVErrors(t *testing.T) {
+	for name, in := range map[string]string{
+		"empty":           "",
+		"unknown column":  "service_name,owner,pager\ncheckout,ann,x\n",
+		"duplicate":       "service_name,owner,owner\ncheckout,ann,bob\n",
+		"no service_name": "owner,team\nann,payments\n",
+		"bad link":        "service_name,links\ncheckout,https://wiki.example.com\n",
+		"bare quote":      "service_name,owner\ncheckout,an\"n\n",
+		"short row":       "service_name,owner\ncheckout\n",
+	} {
+		if _, err := parseServiceMetadataCSV(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestValidateServiceMetadata(t *testing.T) {
+	ok := storage.ServiceMetadata{ServiceName: " checkout ", Tier: " HIGH ", Links: []storage.ServiceLink{{Title: "Runbook", URL: "https://wiki.example.com/r"}}}
+	if err := validateServiceMetadata(&ok); err != nil {
+		t.Fatalf("valid metadata rejected: %v", err)
+	}
+	if ok.ServiceName != "checkout" || ok.Tier != "high" {
+		t.Errorf("normalized to %q tier %q, want checkout tier high", ok.ServiceName, ok.Tier)
+	}
+
+	for name, m := range map[string]storage.ServiceMetadata{
+		"no name":       {Tier: "low"},
+		"tier":          {ServiceName: "a", Tier: "gold"},
+		"relative URL":  {ServiceName: "a", Links: []storage.ServiceLink{{Title: "Runbook", URL: "/wiki/a"}}},
+		"scheme":        {ServiceName: "a", Links: []storage.ServiceLink{{Title: "Runbook", URL: "javascript:alert(1)"}}},
+		"no host":       {ServiceName: "a", Links: []storage.ServiceLink{{Title: "Runbook", URL: "https://"}}},
+		"no title":      {ServiceName: "a", Links: []storage.ServiceLink{{URL: "https://wiki.example.com"}}},
+		"title with ;":  {ServiceName: "a", Links: []storage.ServiceLink{{Title: "a;b", URL: "https://wiki.example.com"}}},
+		"long describe": {ServiceName: "a", Description: strings.Repeat("x", 1025)},
+	} {
+		if err := validateServiceMetadata(&m); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestServiceMetadataImportExportRoundTrip(t *testing.T) {
+	for _, format := range []string{"csv", "json"} {
+		t.Run(format, func(t *testing.T) {
+			s, repo := newTestServer(t)
+			seed := []storage.ServiceMetadata{
+				{ServiceName: "checkout", Owner: "ann", Team: "payments", Tier: "critical", Description: "Takes orders, fast",
+					Links: []storage.ServiceLink{{Title: "Runbook", URL: "https://wiki.example.com/run;book?x=1"}}},
+				{ServiceName: "not-reporting-yet", Tier: "low", Links: []storage.ServiceLink{}},
+			}
+			if err := repo.ImportServiceMetadata(seed); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			s.handleExportServiceMetadata(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/services/export?format="+format, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("export status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+			exported := rec.Body.String()
+
+			// Import the file into an empty store, then export again.
+			s2, repo2 := newTestServer(t)
+			rec = httptest.NewRecorder()
+			s2.handleImportServiceMetadata(rec, httptest.NewRequest(http.MethodPost, "/api/metadata/services/import?format="+format, strings.NewReader(exported)))
+			if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"imported":2`) {
+				t.Fatalf("import status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+			rec = httptest.NewRecorder()
+			s2.handleExportServiceMetadata(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/services/export?format="+format, nil))
+			if format == "csv" && rec.Body.String() != exported {
+				t.Errorf("re-export differs:\n%s\nwant\n%s", rec.Body.String(), exported)
+			}
+
+			got, err := repo2.ListServiceMetadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 {
+				t.Fatalf("imported %d rows, want 2", len(got))
+			}
+			// CSV percent-encodes the ";" so the links column can be split again.
+			wantURL := "https://wiki.example.com/run;book?x=1"
+			if format == "csv" {
+				wantURL = "https://wiki.example.com/run%3Bbook?x=1"
+			}
+			c := got[0]
+			if c.ServiceName != "checkout" || c.Owner != "ann" || c.Team != "payments" || c.Tier != "critical" ||
+				c.Description != "Takes orders, fast" || len(c.Links) != 1 || c.Links[0] != (storage.ServiceLink{Title: "Runbook", URL: wantURL}) {
+				t.Errorf("checkout = %+v", c)
+			}
+			if got[1].ServiceName != "not-reporting-yet" || got[1].Tier != "low" || len(got[1].Links) != 0 {
+				t.Errorf("unknown service = %+v", got[1])
+			}
+		})
+	}
+}
+
+func TestServiceMetadataImportIsAllOrNothing(t *testing.T) {
+	s, repo := newTestServer(t)
+	body := "service_name,tier\ncheckout,high\ncart,platinum\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/metadata/services/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	s.handleImportServiceMetadata(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if e := decodeError(t, rec); !strings.Contains(e.Message, "row 2") {
+		t.Errorf("message = %q, want it to name row 2", e.Message)
+	}
+	if rows, _ := repo.ListServiceMetadata(); len(rows) != 0 {
+		t.Errorf("saved %d rows from a rejected import", len(rows))
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleImportServiceMetadata(rec, httptest.NewRequest(http.MethodPost, "/api/metadata/services/import?format=json",
+		strings.NewReader(`[{"service_name":"a"},{"service_name":"a"}]`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("duplicate services: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestServiceMetadataInSummaryAndServiceMap(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now().UTC()
+	if err := repo.BatchCreateTraces([]storage.Trace{
+		{TraceID: "t1", ServiceName: "checkout", Timestamp: now},
+		{TraceID: "t2", ServiceName: "cart", Timestamp: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]storage.Span{{
+		TraceID: "t1", SpanID: "s1", OperationName: "POST /order", ServiceName: "checkout",
+		StartTime: now.Add(-time.Minute), EndTime: now.Add(-time.Minute + time.Millisecond),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/metadata/services/checkout",
+		strings.NewReader(`{"owner":"ann","tier":"critical","links":[{"title":"Runbook","url":"https://wiki.example.com/checkout"}]}`))
+	req.SetPathValue("name", "checkout")
+	rec := httptest.NewRecorder()
+	s.handlePutServiceMetadata(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleGetServices(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/services?details=true", nil))
+	var summaries []ServiceSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summaries); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 || summaries[0].Name != "cart" || summaries[0].Metadata != nil ||
+		summaries[1].Metadata == nil || summaries[1].Metadata.Owner != "ann" || len(summaries[1].Metadata.Links) != 1 {
+		t.Errorf("summaries = %+v, want cart without metadata and checkout owned by ann", summaries)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleGetServices(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/services", nil))
+	if got := strings.TrimSpace(rec.Body.String()); got != `["cart","checkout"]` {
+		t.Errorf("names = %s, want the bare names without ?details", got)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleGetServiceMapMetrics(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/service-map", nil))
+	var m storage.ServiceMapMetrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Nodes) != 1 || m.Nodes[0].Metadata == nil || m.Nodes[0].Metadata.Tier != "critical" {
+		t.Errorf("service map nodes = %+v, want checkout with tier critical", m.Nodes)
+	}
+}
@@ -10,13 +10,13 @@ import (
 // Returns logs semantically similar to the query string using TF-IDF cosine similarity.
 func (s *Server) handleGetSimilarLogs(w http.ResponseWriter, r *http.Request) {
 	if s.vectorIdx == nil {
-		http.Error(w, "vector index not initialized", http.StatusServiceUnavailable)
+		writeUnavailable(w, "vector index not initialized")
 		return
 	}
 
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		http.Error(w, "q parameter is required", http.StatusBadRequest)
+		writeBadRequest(w, "q parameter is required")
 		return
 	}
 
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
+)
+
+// defaultSLOWindowMinutes is used when an SLO is created without a window.
+const defaultSLOWindowMinutes = 60
+
+// handleListSLOs handles GET /api/slos
+func (s *Server) handleListSLOs(w http.ResponseWriter, r *http.Request) {
+	slos, err := s.repo.ListSLOs()
+	if err != nil {
+		writeInternalError(w, "Failed to list SLOs", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slos)
+}
+
+// handleGetSLO handles GET /api/slos/{id}
+func (s *Server) handleGetSLO(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSLOID(w, r)
+	if !ok {
+		return
+	}
+	slo, err := s.repo.GetSLO(id)
+	if err != nil {
+		writeSLOLookupError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slo)
+}
+
+// handleCreateSLO handles POST /api/slos
+func (s *Server) handleCreateSLO(w http.ResponseWriter, r *http.Request) {
+	var slo storage.SLO
+	if err := json.NewDecoder(r.Body).Decode(&slo); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	slo.ID = 0
+	if err := validateSLO(&slo); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if err := s.repo.CreateSLO(&slo); err != nil {
+		writeInternalError(w, "Failed to create SLO", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(slo)
+}
+
+// handleUpdateSLO handles PUT /api/slos/{id}
+func (s *Server) handleUpdateSLO(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSLOID(w, r)
+	if !ok {
+		return
+	}
+	existing, err := s.repo.GetSLO(id)
+	if err != nil {
+		writeSLOLookupError(w, err)
+		return
+	}
+
+	var slo storage.SLO
+	if err := json.NewDecoder(r.Body).Decode(&slo); err != nil {
+		writeBadRequest(w, "invalid JSON body")
+		return
+	}
+	slo.ID = existing.ID
+	slo.CreatedAt = existing.CreatedAt
+	if err := validateSLO(&slo); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if err := s.repo.UpdateSLO(&slo); err != nil {
+		writeInternalError(w, "Failed to update SLO", err, "id", id)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slo)
+}
+
+// handleDeleteSLO handles DELETE /api/slos/{id}
+func (s *Server) handleDeleteSLO(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSLOID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.repo.DeleteSLO(id); err != nil {
+		writeInternalError(w, "Failed to delete SLO", err, "id", id)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetSLOStatus handles GET /api/slos/status
+func (s *Server) handleGetSLOStatus(w http.ResponseWriter, r *http.Request) {
+	statuses, err := s.repo.GetLatestSLOStatuses()
+	if err != nil {
+		writeInternalError(w, "Failed to get SLO status", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func parseSLOID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeBadRequest(w, "invalid slo id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeSLOLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "slo not found")
+		return
+	}
+	writeInternalError(w, "Failed to look up SLO", err)
+}
+
+// validateSLO checks required fields and applies defaults.
+func validateSLO(slo *storage.SLO) error {
+	if slo.ServiceName == "" || slo.Operation == "" {
+		return fmt.Errorf("service_name and operation are required")
+	}
+	if slo.Percentile <= 0 || slo.Percentile >= 100 {
+		return fmt.Errorf("percentile must be between 0 and 100 (exclusive), got %v", slo.Percentile)
+	}
+	if slo.ThresholdMs <= 0 {
+		return fmt.Errorf("threshold_ms must be > 0, got %v", slo.ThresholdMs)
+	}
+	if slo.WindowMinutes <= 0 {
+		slo.WindowMinutes = defaultSLOWindowMinutes
+	}
+	if slo.Name == "" {
+		slo.Name = fmt.Sprintf("%s %s p%v < %vms", slo.ServiceName, slo.Operation, slo.Percentile, slo.ThresholdMs)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"gorm.io/gorm"
+)
+
+// stubBackend stands in for an alternative storage backend. Only the methods a test
+// exercises are implemented; the rest fall through to the embedded nil interface.
+type stubBackend struct {
+	storage.Backend
+	traces   map[string]*storage.Trace
+	logs     []storage.Log
+	services []string
+	filter   storage.LogFilter
+	logsErr  error
+}
+
+func (b *stubBackend) GetTrace(traceID string) (*storage.Trace, error) {
+	if t, ok := b.traces[traceID]; ok {
+		return t, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (b *stubBackend) GetLogsV2Context(_ context.Context, filter storage.LogFilter) ([]storage.Log, int64, error) {
+	b.filter = filter
+	if b.logsErr != nil {
+		return nil, 0, b.logsErr
+	}
+	return b.logs, int64(len(b.logs)), nil
+}
+
+func (b *stubBackend) GetServices() ([]string, error) {
+	if b.services == nil {
+		return nil, errors.New("backend down")
+	}
+	return b.services, nil
+}
+
+func TestTraceReaderBackend(t *testing.T) {
+	s := &Server{repo: &stubBackend{traces: map[string]*storage.Trace{"abc": {TraceID: "abc", ServiceName: "checkout"}}}}
+
+	for id, want := range map[string]int{"abc": http.StatusOK, "missing": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/api/traces/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		s.handleGetTraceByID(rec, req)
+		if rec.Code != want {
+			t.Errorf("GET /api/traces/%s status = %d, want %d", id, rec.Code, want)
+		}
+	}
+}
+
+func TestLogReaderBackend(t *testing.T) {
+	backend := &stubBackend{logs: []storage.Log{{ServiceName: "checkout", Body: "payment declined"}}}
+	s := &Server{repo: backend}
+
+	rec := httptest.NewRecorder()
+	s.handleGetLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs?service_name=checkout&limit=10", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data  []storage.Log `json:"data"`
+		Total int64         `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 1 || string(resp.Data[0].Body) != "payment declined" {
+		t.Errorf("response = %+v", resp)
+	}
+	if backend.filter.ServiceName != "checkout" || backend.filter.Limit != 10 {
+		t.Errorf("filter passed to backend = %+v", backend.filter)
+	}
+}
+
+func TestDashboardReaderBackend(t *testing.T) {
+	s := &Server{repo: &stubBackend{services: []string{"cart", "checkout"}}}
+	rec := httptest.NewRecorder()
+	s.handleGetServices(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/services", nil))
+	var services []string
+	if err := json.Unmarshal(rec.Body.Bytes(), &services); err != nil || len(services) != 2 {
+		t.Errorf("services = %v (%v)", services, err)
+	}
+
+	s = &Server{repo: &stubBackend{}}
+	rec = httptest.NewRecorder()
+	s.handleGetServices(rec, httptest.NewRequest(http.MethodGet, "/api/metadata/services", nil))
+	if rec.Code != http.StatusInternalServerError || decodeError(t, rec).Code != ErrCodeInternal {
+		t.Errorf("status = %d, want a structured 500 when the backend fails", rec.Code)
+	}
+}
+
+func TestLogQueryCancellation(t *testing.T) {
+	s := &Server{repo: &stubBackend{logsErr: fmt.Errorf("failed to count logs: %w", context.DeadlineExceeded)}}
+	rec := httptest.NewRecorder()
+	s.handleGetLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs", nil))
+	if rec.Code != http.StatusServiceUnavailable || decodeError(t, rec).Code != ErrCodeUnavailable {
+		t.Errorf("status = %d, want a structured 503 when the query times out", rec.Code)
+	}
+
+	// A client that went away gets nothing written.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s = &Server{repo: &stubBackend{logsErr: context.Canceled}}
+	rec = httptest.NewRecorder()
+	s.handleGetLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs", nil).WithContext(ctx))
+	if rec.Body.Len() != 0 {
+		t.Errorf("body = %q, want nothing written for a cancelled request", rec.Body.String())
+	}
+}
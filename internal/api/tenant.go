@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+// tenantAdminRoutes are the admin routes a tenant token may call; they act on the
+// caller's own data only. Every other admin route changes instance-wide state and
+// needs the super-admin token.
+var tenantAdminRoutes = map[string]bool{
+	"DELETE /api/admin/purge":       true,
+	"GET /api/admin/purge/{id}":     true,
+	"DELETE /api/admin/purge/{id}":  true,
+	"DELETE /api/admin/data":        true,
+	"POST /api/admin/remap-service": true,
+}
+
+// publicPaths are served without a token even with multi-tenancy on.
+var publicPaths = map[string]bool{
+	"/api/health":       true,
+	"/api/version":      true,
+	"/api/ready":        true,
+	"/api/openapi.json": true,
+}
+
+// SetTenants turns on multi-tenancy when tokens has any tenant tokens: Authenticate
+// then requires a token for the API and WebSockets, and handlers only see the
+// caller's tenant.
+func (s *Server) SetTenants(tokens *tenant.Tokens) {
+	s.tenants = tokens
+}
+
+// Authenticate resolves the bearer token of each request into a tenant identity for
+// the handlers behind it. With multi-tenancy off it passes requests through as is.
+//
+// Requests to /api/ and /ws need a valid token; browsers, which cannot set headers
+// on WebSocket connections, may pass it as ?token= on /ws paths. OTLP/HTTP requests
+// without a token are stored under the default tenant, but an unknown token is
+// rejected everywhere rather than silently downgraded.
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.tenants.Enabled() || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		isWS := r.URL.Path == "/ws" || strings.HasPrefix(r.URL.Path, "/ws/")
+		token := tenant.BearerToken(r.Header.Get("Authorization"))
+		if token == "" && isWS {
+			token = r.URL.Query().Get("token")
+		}
+		if token == "" {
+			if isWS || strings.HasPrefix(r.URL.Path, "/api/") {
+				writeError(w, http.StatusUnauthorized, ErrCodeUnauthenticated, "a bearer token is required", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, ok := s.tenants.Resolve(token)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, ErrCodeUnauthenticated, "invalid token", nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), id)))
+	})
+}
+
+// RequireSuperAdmin rejects requests not made with the super-admin token while
+// multi-tenancy is on. It guards endpoints, such as MCP, that read across tenants.
+func (s *Server) RequireSuperAdmin(next http.Handler) http.Handler {
+	return s.superAdminOnly(next.ServeHTTP)
+}
+
+// superAdminOnly wraps handlers of instance-wide data: configuration, in-memory
+// indexes and tables without a tenant column.
+func (s *Server) superAdminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.tenants.Enabled() {
+			if id, _ := tenant.FromContext(r.Context()); !id.SuperAdmin {
+				writeError(w, http.StatusForbidden, ErrCodeForbidden, "this endpoint requires the super-admin token", nil)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// store returns the backend limited to the caller's tenant, or the whole backend
+// for the super-admin and with multi-tenancy off. With an env query parameter,
+// reads are further limited to that deployment environment.
+func (s *Server) store(r *http.Request) storage.Backend {
+	b := s.repo
+	if t := tenant.Scope(r.Context()); t != "" {
+		if scoper, ok := b.(storage.TenantScoper); ok {
+			b = scoper.ForTenant(t)
+		}
+	}
+	if env := r.URL.Query().Get("env"); env != "" {
+		if scoper, ok := b.(storage.EnvironmentScoper); ok {
+			b = scoper.ForEnvironment(env)
+		}
+	}
+	return b
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+// newTenantServer returns a server with multi-tenancy on for tenants alpha
+// (token "a-secret") and beta ("b-secret"), each holding one trace, log and metric
+// bucket of a service named "shared".
+func newTenantServer(t *testing.T) http.Handler {
+	t.Helper()
+	s, repo := newTestServer(t)
+	tokens, err := tenant.ParseTokens("a-secret=alpha,b-secret=beta", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTenants(tokens)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, tn := range []string{"alpha", "beta"} {
+		if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: tn + "-trace", TenantID: tn, ServiceName: "shared", Timestamp: now}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateLogs([]storage.Log{{TraceID: tn + "-trace", TenantID: tn, ServiceName: "shared", Severity: "ERROR", Body: "boom", Timestamp: now}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateMetrics([]storage.MetricBucket{{Name: "cpu", TenantID: tn, ServiceName: "shared", TimeBucket: now, Count: 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/health", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /api/traces", s.handleGetTraces)
+	mux.HandleFunc("GET /api/traces/{id}", s.handleGetTraceByID)
+	mux.HandleFunc("GET /api/logs", s.handleGetLogs)
+	mux.HandleFunc("GET /api/metrics", s.handleGetMetricBuckets)
+	mux.HandleFunc("GET /api/admin/audit", s.superAdminOnly(s.handleListAudit))
+	mux.HandleFunc("DELETE /api/admin/data", s.handlePurgeService)
+	return s.Authenticate(mux)
+}
+
+func tenantRequest(t *testing.T, h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTenantTokensIsolateReads(t *testing.T) {
+	h := newTenantServer(t)
+	metrics := "/api/metrics?name=cpu&start=" + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) +
+		"&end=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	count := func(target, token string) int {
+		t.Helper()
+		rec := tenantRequest(t, h, http.MethodGet, target, token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s with %q = %d: %s", target, token, rec.Code, rec.Body)
+		}
+		var body struct {
+			Total int `json:"total"`
+		}
+		if target == metrics {
+			var buckets []storage.MetricBucket
+			json.Unmarshal(rec.Body.Bytes(), &buckets)
+			return len(buckets)
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return body.Total
+	}
+	for _, target := range []string{"/api/traces", "/api/logs", metrics} {
+		if n := count(target, "a-secret"); n != 1 {
+			t.Errorf("%s as alpha: %d rows, want 1", target, n)
+		}
+		if n := count(target, "root"); n != 2 {
+			t.Errorf("%s as super-admin: %d rows, want 2", target, n)
+		}
+	}
+
+	if rec := tenantRequest(t, h, http.MethodGet, "/api/traces/beta-trace", "a-secret"); rec.Code != http.StatusNotFound {
+		t.Errorf("alpha reading beta-trace = %d, want 404", rec.Code)
+	}
+	if rec := tenantRequest(t, h, http.MethodGet, "/api/traces/alpha-trace", "a-secret"); rec.Code != http.StatusOK {
+		t.Errorf("alpha reading alpha-trace = %d, want 200", rec.Code)
+	}
+}
+
+func TestTenantTokensAuthentication(t *testing.T) {
+	h := newTenantServer(t)
+
+	for _, c := range []struct {
+		method, target, token string
+		want                  int
+	}{
+		{http.MethodGet, "/api/traces", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/traces", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/api/health", "", http.StatusOK},
+		{http.MethodGet, "/api/admin/audit", "a-secret", http.StatusForbidden},
+		{http.MethodGet, "/api/admin/audit", "root", http.StatusOK},
+	} {
+		rec := tenantRequest(t, h, c.method, c.target, c.token)
+		if rec.Code != c.want {
+			t.Errorf("%s %s with %q = %d, want %d", c.method, c.target, c.token, rec.Code, c.want)
+		}
+		if c.want >= 400 {
+			decodeError(t, rec)
+		}
+	}
+
+	// A tenant's purge leaves the other tenant's data of the same service alone.
+	if rec := tenantRequest(t, h, http.MethodDelete, "/api/admin/data?service=shared", "a-secret"); rec.Code != http.StatusOK {
+		t.Fatalf("alpha purge = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := tenantRequest(t, h, http.MethodGet, "/api/traces/beta-trace", "b-secret"); rec.Code != http.StatusOK {
+		t.Errorf("beta-trace after alpha's purge = %d, want 200", rec.Code)
+	}
+	if rec := tenantRequest(t, h, http.MethodGet, "/api/traces/alpha-trace", "root"); rec.Code != http.StatusNotFound {
+		t.Errorf("alpha-trace after alpha's purge = %d, want 404", rec.Code)
+	}
+}
+
+func TestEnvironmentFilterComposesWithServiceFilters(t *testing.T) {
+	s, repo := newTestServer(t)
+	s.repo = storage.NewDashboardCache(repo, time.Minute)
+
+	// prod has one trace per service and staging two; each root span calls db.
+	at := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	seed := func(env, service, traceID string) {
+		t.Helper()
+		if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: traceID, Environment: env, ServiceName: service, Timestamp: at, Duration: 2000, Status: "STATUS_CODE_OK"}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateSpans([]storage.Span{
+			{TraceID: traceID, SpanID: "root", Environment: env, ServiceName: service, OperationName: "GET /", StartTime: at, EndTime: at.Add(2 * time.Millisecond), Duration: 2000},
+			{TraceID: traceID, SpanID: "query", ParentSpanID: "root", Environment: env, ServiceName: "db", OperationName: "SELECT", StartTime: at, EndTime: at.Add(time.Millisecond), Duration: 1000},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateLogs([]storage.Log{{TraceID: traceID, Environment: env, ServiceName: service, Severity: "INFO", Body: storage.CompressedText(traceID), Timestamp: at}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for env, n := range map[string]int{"prod": 1, "staging": 2} {
+		for _, service := range []string{"checkout", "cart"} {
+			for i := range n {
+				seed(env, service, fmt.Sprintf("%s-%s-%d", env, service, i))
+			}
+		}
+	}
+	seed("", "checkout", "unlabelled")
+
+	get := func(target string, v any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		switch {
+		case strings.HasPrefix(target, "/api/traces"):
+			s.handleGetTraces(rec, req)
+		case strings.HasPrefix(target, "/api/logs"):
+			s.handleGetLogs(rec, req)
+		case strings.HasPrefix(target, "/api/metrics/dashboard"):
+			s.handleGetDashboardStats(rec, req)
+		case strings.HasPrefix(target, "/api/metrics/traffic"):
+			s.handleGetTrafficMetrics(rec, req)
+		case strings.HasPrefix(target, "/api/metrics/latency_heatmap"):
+			s.handleGetLatencyHeatmap(rec, req)
+		case strings.HasPrefix(target, "/api/metrics/service-map"):
+			s.handleGetServiceMapMetrics(rec, req)
+		case strings.HasPrefix(target, "/api/metadata/services"):
+			s.handleGetServices(rec, req)
+		case strings.HasPrefix(target, "/api/metadata/environments"):
+			s.handleGetEnvironments(rec, req)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", target, rec.Code, rec.Body)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+	}
+	window := "start=" + at.Add(-time.Minute).Format(time.RFC3339) + "&end=" + at.Add(time.Minute).Format(time.RFC3339)
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", 4},
+		{"&env=prod", 1},
+		{"&env=staging", 2},
+		{"&env=qa", 0},
+	} {
+		filter := "?" + window + "&service_name=checkout" + tc.query
+
+		var traces storage.TracesResponse
+		get("/api/traces"+filter, &traces)
+		var logs struct {
+			Total int `json:"total"`
+		}
+		get("/api/logs"+filter, &logs)
+		var dashboard storage.DashboardStats
+		get("/api/metrics/dashboard"+filter, &dashboard)
+		var traffic []storage.TrafficPoint
+		get("/api/metrics/traffic"+filter, &traffic)
+		requests := 0
+		for _, p := range traffic {
+			requests += int(p.Count)
+		}
+		var heatmap []storage.LatencyPoint
+		get("/api/metrics/latency_heatmap"+filter+"&format=points", &heatmap)
+		var serviceMap storage.ServiceMapMetrics
+		get("/api/metrics/service-map?"+window+"&focus=checkout"+tc.query, &serviceMap)
+		calls := 0
+		for _, e := range serviceMap.Edges {
+			if e.Source == "checkout" && e.Target == "db" {
+				calls += int(e.CallCount)
+			}
+		}
+
+		for name, got := range map[string]int{
+			"traces": int(traces.Total), "logs": logs.Total, "dashboard traces": int(dashboard.TotalTraces),
+			"traffic": requests, "heatmap points": len(heatmap), "service map calls": calls,
+		} {
+			if got != tc.want {
+				t.Errorf("checkout%s: %d %s, want %d", tc.query, got, name, tc.want)
+			}
+		}
+	}
+
+	var services []string
+	get("/api/metadata/services?env=prod", &services)
+	if !slices.Equal(services, []string{"cart", "checkout"}) {
+		t.Errorf("services in prod = %v, want cart and checkout", services)
+	}
+	get("/api/metadata/services?env=qa", &services)
+	if len(services) != 0 {
+		t.Errorf("services in qa = %v, want none", services)
+	}
+	var envs []string
+	get("/api/metadata/environments", &envs)
+	if !slices.Equal(envs, []string{"prod", "staging"}) {
+		t.Errorf("environments = %v, want prod and staging", envs)
+	}
+}
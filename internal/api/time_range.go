@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTimeRange    = 30 * time.Minute    // window of a guarded endpoint given no start
+	defaultMaxTimeRange = 30 * 24 * time.Hour // API_MAX_TIME_RANGE
+)
+
+// Headers reporting the window a guarded endpoint actually queried.
+const (
+	headerRangeStart   = "X-Time-Range-Start"
+	headerRangeEnd     = "X-Time-Range-End"
+	headerRangeClamped = "X-Time-Range-Clamped" // "true" when the requested window was shortened
+)
+
+// overlongRange says what a guarded endpoint does with a window longer than the
+// maximum.
+type overlongRange int
+
+const (
+	// clampRange queries the most recent part of the window the maximum allows. For
+	// time series, whose axis shows the effective range.
+	clampRange overlongRange = iota
+	// rejectRange answers 400. For totals, which would silently cover less than asked.
+	rejectRange
+)
+
+// parseTimeRange parses the RFC3339 start and end query params. A missing bound is
+// the zero time.
+func parseTimeRange(r *http.Request) (start, end time.Time, err error) {
+	q := r.URL.Query()
+	if v := q.Get("start"); v != "" {
+		if start, err = time.Parse(time.RFC3339, v); err != nil {
+			return time.Time{}, time.Time{}, errors.New("start must be an RFC3339 time")
+		}
+	}
+	if v := q.Get("end"); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			return time.Time{}, time.Time{}, errors.New("end must be an RFC3339 time")
+		}
+	}
+	return start, end, nil
+}
+
+// SetMaxTimeRange sets the longest window the dashboard, traffic, latency and service
+// map endpoints query; 0 removes the limit.
+func (s *Server) SetMaxTimeRange(d time.Duration) {
+	s.maxRange = d
+}
+
+// timeRange returns the window of an endpoint guarded against scanning years of data.
+// end defaults to now and start to 30 minutes before end. A malformed or inverted
+// range, or with rejectRange one longer than the maximum, is answered with 400 and
+// ok false. The effective window is reported in the X-Time-Range-* headers.
+func (s *Server) timeRange(w http.ResponseWriter, r *http.Request, overlong overlongRange) (start, end time.Time, ok bool) {
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return time.Time{}, time.Time{}, false
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultTimeRange)
+	}
+	if !start.Before(end) {
+		writeBadRequest(w, "start must be before end")
+		return time.Time{}, time.Time{}, false
+	}
+	if s.maxRange > 0 && end.Sub(start) > s.maxRange {
+		if overlong == rejectRange {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument, "time range longer than API_MAX_TIME_RANGE",
+				map[string]string{"max_range": s.maxRange.String()})
+			return time.Time{}, time.Time{}, false
+		}
+		start = end.Add(-s.maxRange)
+		w.Header().Set(headerRangeClamped, "true")
+	}
+	w.Header().Set(headerRangeStart, start.UTC().Format(time.RFC3339))
+	w.Header().Set(headerRangeEnd, end.UTC().Format(time.RFC3339))
+	return start, end, true
+}
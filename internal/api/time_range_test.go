@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGuardedTimeRange(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetMaxTimeRange(24 * time.Hour)
+	end := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	rfc := func(t time.Time) string { return t.Format(time.RFC3339) }
+
+	for _, h := range []struct {
+		name     string
+		handler  http.HandlerFunc
+		overlong overlongRange
+	}{
+		{"traffic", s.handleGetTrafficMetrics, clampRange},
+		{"latency_heatmap", s.handleGetLatencyHeatmap, clampRange},
+		{"latency_by_status", s.handleGetLatencyByStatus, clampRange},
+		{"dashboard", s.handleGetDashboardStats, rejectRange},
+		{"service-map", s.handleGetServiceMapMetrics, rejectRange},
+	} {
+		t.Run(h.name, func(t *testing.T) {
+			get := func(query string) *httptest.ResponseRecorder {
+				rec := httptest.NewRecorder()
+				h.handler(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/"+h.name+"?"+query, nil))
+				return rec
+			}
+			window := func(rec *httptest.ResponseRecorder) (time.Time, time.Time) {
+				t.Helper()
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status %d: %s", rec.Code, rec.Body)
+				}
+				from, err1 := time.Parse(time.RFC3339, rec.Header().Get(headerRangeStart))
+				to, err2 := time.Parse(time.RFC3339, rec.Header().Get(headerRangeEnd))
+				if err1 != nil || err2 != nil {
+					t.Fatalf("range headers = %q, %q", rec.Header().Get(headerRangeStart), rec.Header().Get(headerRangeEnd))
+				}
+				return from, to
+			}
+
+			// No bounds: the last 30 minutes
+			from, to := window(get(""))
+			if d := time.Since(to); d < 0 || d > time.Minute || to.Sub(from) != defaultTimeRange {
+				t.Errorf("default window = %s to %s, want the 30 minutes up to now", from, to)
+			}
+			// start only: up to now
+			if _, to := window(get("start=" + rfc(time.Now().Add(-time.Hour)))); time.Since(to) > time.Minute {
+				t.Errorf("end without a bound = %s, want now", to)
+			}
+			// end only: the 30 minutes before it
+			if from, to := window(get("end=" + rfc(end))); !to.Equal(end) || !from.Equal(end.Add(-defaultTimeRange)) {
+				t.Errorf("window given end = %s to %s", from, to)
+			}
+			// Within the maximum: as given, not clamped
+			rec := get("start=" + rfc(end.Add(-24*time.Hour)) + "&end=" + rfc(end))
+			if from, _ := window(rec); !from.Equal(end.Add(-24*time.Hour)) || rec.Header().Get(headerRangeClamped) != "" {
+				t.Errorf("24h window starts %s, clamped %q", from, rec.Header().Get(headerRangeClamped))
+			}
+
+			for _, q := range []string{
+				"start=" + rfc(end) + "&end=" + rfc(end.Add(-time.Hour)), // inverted
+				"start=" + rfc(end) + "&end=" + rfc(end),                 // empty
+				"start=yesterday",
+				"end=2026-03-02",
+			} {
+				if rec := get(q); rec.Code != http.StatusBadRequest {
+					t.Errorf("%s: status %d, want 400", q, rec.Code)
+				}
+			}
+
+			rec = get("start=2020-01-01T00:00:00Z&end=" + rfc(end))
+			if h.overlong == rejectRange {
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("years of data: status %d, want 400", rec.Code)
+				}
+				return
+			}
+			if from, to := window(rec); !from.Equal(end.Add(-24*time.Hour)) || !to.Equal(end) || rec.Header().Get(headerRangeClamped) != "true" {
+				t.Errorf("years of data queried %s to %s (clamped %q), want the last 24h", from, to, rec.Header().Get(headerRangeClamped))
+			}
+		})
+	}
+
+	// 0 lifts the limit
+	s.SetMaxTimeRange(0)
+	rec := httptest.NewRecorder()
+	s.handleGetDashboardStats(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/dashboard?start=2020-01-01T00:00:00Z&end="+rfc(end), nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("unlimited dashboard over years: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// baselineCacheTTL is how long an operation's latency baseline is reused. A baseline
+// covers days of spans, so a minute-old one is as good as a fresh one.
+const baselineCacheTTL = time.Minute
+
+// baselineMinSamples is the number of spans an operation needs in the baseline window
+// before its spans are flagged slow; a handful of spans is no norm.
+const baselineMinSamples = 20
+
+// BaselineAnnotation is a span's position in its operation's latency baseline, added
+// to DetailSpan by GET /api/traces/{id}?baseline=.
+type BaselineAnnotation struct {
+	Baseline *SpanBaseline `json:"baseline"` // nil when the operation has no spans in the window
+}
+
+// SpanBaseline places one span in its operation's latency distribution.
+type SpanBaseline struct {
+	P50Ms      float64 `json:"p50_ms"`
+	P95Ms      float64 `json:"p95_ms"`
+	Samples    int64   `json:"samples"`
+	Percentile float64 `json:"percentile"` // share of baseline spans that were faster, 0-100
+	Slow       bool    `json:"slow"`       // slower than p95, with at least baselineMinSamples samples
+}
+
+// baselineCache keeps operation baselines per tenant and window for ttl. Traces share
+// most of their operations, so opening one trace after another mostly hits.
+type baselineCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[baselineKey]baselineEntry
+}
+
+type baselineKey struct {
+	tenant string
+	window time.Duration
+	op     storage.OperationKey
+}
+
+type baselineEntry struct {
+	baseline *storage.OperationBaseline
+	expires  time.Time
+}
+
+func newBaselineCache(ttl time.Duration) *baselineCache {
+	return &baselineCache{ttl: ttl, now: time.Now, entries: make(map[baselineKey]baselineEntry)}
+}
+
+// get returns the baselines of ops, fetching the ones not cached with a single call
+// to fetch.
+func (c *baselineCache) get(tenant string, window time.Duration, ops []storage.OperationKey,
+	fetch func([]storage.OperationKey) (map[storage.OperationKey]*storage.OperationBaseline, error)) (map[storage.OperationKey]*storage.OperationBaseline, error) {
+	out := make(map[storage.OperationKey]*storage.OperationBaseline, len(ops))
+	var missing []storage.OperationKey
+	now := c.now()
+	c.mu.Lock()
+	for _, op := range ops {
+		if _, done := out[op]; done {
+			continue
+		}
+		if e, ok := c.entries[baselineKey{tenant, window, op}]; ok && now.Before(e.expires) {
+			out[op] = e.baseline
+		} else {
+			out[op] = nil
+			missing = append(missing, op)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	fetched, err := fetch(missing)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for _, op := range missing {
+		b := fetched[op]
+		if b == nil {
+			b = &storage.OperationBaseline{}
+		}
+		out[op] = b
+		c.entries[baselineKey{tenant, window, op}] = baselineEntry{baseline: b, expires: now.Add(c.ttl)}
+	}
+	return out, nil
+}
+
+// spanOperations lists the distinct operations of spans.
+func spanOperations(spans []storage.Span) []storage.OperationKey {
+	seen := make(map[storage.OperationKey]bool)
+	var ops []storage.OperationKey
+	for _, sp := range spans {
+		op := storage.OperationKey{ServiceName: sp.ServiceName, OperationName: sp.OperationName}
+		if !seen[op] {
+			seen[op] = true
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// annotateBaselines places each span in its operation's baseline and flags the spans
+// slower than their operation's p95.
+func annotateBaselines(spans []DetailSpan, baselines map[storage.OperationKey]*storage.OperationBaseline) {
+	for i := range spans {
+		sp := &spans[i].Span
+		spans[i].BaselineAnnotation = &BaselineAnnotation{}
+		b := baselines[storage.OperationKey{ServiceName: sp.ServiceName, OperationName: sp.OperationName}]
+		if b == nil || b.Count == 0 {
+			continue
+		}
+		spans[i].Baseline = &SpanBaseline{
+			P50Ms:      b.P50Ms,
+			P95Ms:      b.P95Ms,
+			Samples:    b.Count,
+			Percentile: b.PercentileOf(sp.Duration),
+			Slow:       b.Count >= baselineMinSamples && float64(sp.Duration)/1000 > b.P95Ms,
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestBaselineCache(t *testing.T) {
+	c := newBaselineCache(time.Minute)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	a := storage.OperationKey{ServiceName: "api", OperationName: "GET /a"}
+	b := storage.OperationKey{ServiceName: "api", OperationName: "GET /b"}
+	var calls [][]storage.OperationKey
+	fetch := func(ops []storage.OperationKey) (map[storage.OperationKey]*storage.OperationBaseline, error) {
+		calls = append(calls, ops)
+		out := make(map[storage.OperationKey]*storage.OperationBaseline)
+		for _, op := range ops {
+			out[op] = &storage.OperationBaseline{Count: int64(len(calls))}
+		}
+		return out, nil
+	}
+
+	got, err := c.get("", 7*24*time.Hour, []storage.OperationKey{a, a}, fetch)
+	if err != nil || len(calls) != 1 || len(calls[0]) != 1 || got[a].Count != 1 {
+		t.Fatalf("first get: %v, calls %v", err, calls)
+	}
+	// Only the operation not cached yet is fetched.
+	got, _ = c.get("", 7*24*time.Hour, []storage.OperationKey{a, b}, fetch)
+	if len(calls) != 2 || len(calls[1]) != 1 || calls[1][0] != b || got[a].Count != 1 || got[b].Count != 2 {
+		t.Errorf("second get fetched %v, got a=%d b=%d", calls[1], got[a].Count, got[b].Count)
+	}
+	// Other tenants and windows have their own entries.
+	c.get("acme", 7*24*time.Hour, []storage.OperationKey{a}, fetch)
+	c.get("", 24*time.Hour, []storage.OperationKey{a}, fetch)
+	if len(calls) != 4 {
+		t.Errorf("%d fetches, want 4", len(calls))
+	}
+	// Expired entries are fetched again, and pruned.
+	now = now.Add(time.Minute)
+	got, _ = c.get("", 7*24*time.Hour, []storage.OperationKey{a}, fetch)
+	if len(calls) != 5 || got[a].Count != 5 {
+		t.Errorf("after ttl: %d fetches, a=%d; want a refetch", len(calls), got[a].Count)
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("%d entries kept, want 1", len(c.entries))
+	}
+	// A failed fetch caches nothing.
+	now = now.Add(time.Minute)
+	fail := func([]storage.OperationKey) (map[storage.OperationKey]*storage.OperationBaseline, error) {
+		return nil, errors.New("db down")
+	}
+	if _, err := c.get("", 7*24*time.Hour, []storage.OperationKey{b}, fail); err == nil {
+		t.Error("fetch error not returned")
+	}
+}
+
+func TestAnnotateSpans(t *testing.T) {
+	// 100 spans of 1..100ms.
+	b := baselineOf(t, 100, func(i int) int64 { return int64(i+1) * 1000 })
+	few := baselineOf(t, baselineMinSamples-1, func(int) int64 { return 1000 })
+	baselines := map[storage.OperationKey]*storage.OperationBaseline{
+		{ServiceName: "api", OperationName: "GET /a"}:   b,
+		{ServiceName: "api", OperationName: "GET /few"}: few,
+	}
+	spans := []storage.Span{
+		{SpanID: "fast", ServiceName: "api", OperationName: "GET /a", Duration: 5_000},
+		{SpanID: "slow", ServiceName: "api", OperationName: "GET /a", Duration: 500_000},
+		{SpanID: "few", ServiceName: "api", OperationName: "GET /few", Duration: 500_000},
+		{SpanID: "new", ServiceName: "api", OperationName: "GET /new", Duration: 500_000},
+	}
+	got := newDetailSpans(spans)
+	annotateBaselines(got, baselines)
+	if len(got) != 4 || got[0].SpanID != "fast" {
+		t.Fatalf("got %+v", got)
+	}
+	if a := got[0].Baseline; a == nil || a.Slow || a.Percentile > 10 || a.Samples != 100 || a.P95Ms != b.P95Ms {
+		t.Errorf("fast span = %+v, want a low percentile, not slow", a)
+	}
+	if a := got[1].Baseline; a == nil || !a.Slow || a.Percentile != 100 {
+		t.Errorf("slow span = %+v, want slow at the 100th percentile", a)
+	}
+	if a := got[2].Baseline; a == nil || a.Slow {
+		t.Errorf("span with %d samples = %+v, want a baseline but no flag", baselineMinSamples-1, a)
+	}
+	if got[3].Baseline != nil {
+		t.Errorf("span without history = %+v, want no baseline", got[3].Baseline)
+	}
+}
+
+// baselineOf builds a baseline from n spans of the given durations.
+func baselineOf(t *testing.T, n int, durationUs func(int) int64) *storage.OperationBaseline {
+	t.Helper()
+	_, repo := newTestServer(t)
+	now := time.Now().UTC()
+	var spans []storage.Span
+	for i := 0; i < n; i++ {
+		spans = append(spans, storage.Span{TraceID: "base", SpanID: fmt.Sprintf("s%d", i), ServiceName: "svc",
+			OperationName: "op", Duration: durationUs(i), StartTime: now.Add(-time.Minute)})
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	op := storage.OperationKey{ServiceName: "svc", OperationName: "op"}
+	got, err := repo.GetOperationBaselines([]storage.OperationKey{op}, now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got[op]
+}
+
+func TestGetTraceWithBaseline(t *testing.T) {
+	s, repo := newTestServer(t)
+	s.baselines = newBaselineCache(baselineCacheTTL)
+	now := time.Now().UTC()
+	var spans []storage.Span
+	for i := 0; i < 40; i++ {
+		spans = append(spans, storage.Span{TraceID: "hist", SpanID: fmt.Sprintf("h%d", i), ServiceName: "api",
+			OperationName: "GET /x", Duration: 10_000, StartTime: now.Add(-24 * time.Hour)})
+	}
+	spans = append(spans, storage.Span{TraceID: "slow", SpanID: "root", ServiceName: "api", OperationName: "GET /x",
+		Duration: 900_000, StartTime: now.Add(-time.Minute)})
+	if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: "slow", ServiceName: "api", Timestamp: now.Add(-time.Minute)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/traces/slow?"+query, nil)
+		req.SetPathValue("id", "slow")
+		rec := httptest.NewRecorder()
+		s.handleGetTraceByID(rec, req)
+		return rec
+	}
+	rec := get("baseline=7d")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		TraceID        string `json:"trace_id"`
+		BaselineWindow string `json:"baseline_window"`
+		Spans          []struct {
+			SpanID   string        `json:"span_id"`
+			Baseline *SpanBaseline `json:"baseline"`
+		} `json:"spans"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID != "slow" || got.BaselineWindow != "7d" || len(got.Spans) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if b := got.Spans[0].Baseline; b == nil || !b.Slow || b.Samples != 41 {
+		t.Errorf("baseline = %+v, want slow against 41 samples", b)
+	}
+
+	// Without baseline the plain trace is returned.
+	var plain map[string]json.RawMessage
+	if rec := get(""); rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &plain) != nil || plain["baseline_window"] != nil {
+		t.Errorf("plain trace: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := get("baseline=forever"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad baseline: status = %d, want 400", rec.Code)
+	}
+}
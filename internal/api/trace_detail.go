@@ -0,0 +1,61 @@
+package api
+
+import (
+	"math"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// TraceDetail is the trace returned by GET /api/traces/{id}: its timeline, and spans
+// with their self time and the annotations asked for with ?baseline= and
+// ?critical_path=true.
+type TraceDetail struct {
+	*storage.Trace
+	Spans          []DetailSpan           `json:"spans"`
+	Timeline       *storage.TraceTimeline `json:"timeline"`
+	BaselineWindow string                 `json:"baseline_window,omitempty"`
+	CriticalPathUs *int64                 `json:"critical_path_us,omitempty"` // length of the critical path: the root span's duration
+}
+
+// DetailSpan is a span with its annotations; those not asked for are left out.
+type DetailSpan struct {
+	storage.Span
+	SelfTimeUs int64 `json:"self_time_us"` // duration not covered by child spans
+	*BaselineAnnotation
+	*CriticalPathAnnotation
+}
+
+// CriticalPathAnnotation is a span's share of the trace's critical path.
+type CriticalPathAnnotation struct {
+	OnCriticalPath      bool    `json:"on_critical_path"`
+	CriticalPathUs      int64   `json:"critical_path_us"`      // time the path spent in the span itself, not in its children
+	CriticalPathPercent float64 `json:"critical_path_percent"` // of the path's length
+}
+
+func newDetailSpans(spans []storage.Span) []DetailSpan {
+	out := make([]DetailSpan, len(spans))
+	self := storage.SelfTimes(spans)
+	for i, sp := range spans {
+		out[i].Span = sp
+		out[i].SelfTimeUs = self[i]
+	}
+	return out
+}
+
+// annotateCriticalPath marks the spans on the trace's critical path with their
+// contribution, and returns the path's length.
+func annotateCriticalPath(spans []DetailSpan) int64 {
+	raw := make([]storage.Span, len(spans))
+	for i := range spans {
+		raw[i] = spans[i].Span
+	}
+	contributions, total := storage.CriticalPath(raw)
+	for i, us := range contributions {
+		a := &CriticalPathAnnotation{OnCriticalPath: us > 0, CriticalPathUs: us}
+		if total > 0 {
+			a.CriticalPathPercent = math.Round(float64(us)/float64(total)*10000) / 100
+		}
+		spans[i].CriticalPathAnnotation = a
+	}
+	return total
+}
@@ -2,13 +2,20 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/query"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"gorm.io/gorm"
 )
 
-// handleGetTraces handles GET /api/traces
+// handleGetTraces handles GET /api/traces. fields= limits each trace to the listed
+// JSON fields, e.g. fields=trace_id,duration_ms,status,timestamp.
 func (s *Server) handleGetTraces(w http.ResponseWriter, r *http.Request) {
 	limit := 20
 	offset := 0
@@ -25,20 +32,184 @@ func (s *Server) handleGetTraces(w http.ResponseWriter, r *http.Request) {
 
 	start, end, err := parseTimeRange(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid time range: %v", err), http.StatusBadRequest)
+		writeBadRequest(w, fmt.Sprintf("Invalid time range: %v", err))
 		return
 	}
 
-	serviceNames := r.URL.Query()["service_name"]
-	status := r.URL.Query().Get("status")
-	search := r.URL.Query().Get("search")
-	sortBy := r.URL.Query().Get("sort_by")
-	orderBy := r.URL.Query().Get("order_by")
+	filter := storage.TraceFilter{
+		StartTime:    start,
+		EndTime:      end,
+		ServiceNames: r.URL.Query()["service_name"],
+		Status:       r.URL.Query().Get("status"),
+		Search:       r.URL.Query().Get("search"),
+		ErrorOnly:    r.URL.Query().Get("error_only") == "true",
+		ErrorMode:    r.URL.Query().Get("error_mode"),
+		Completeness: r.URL.Query().Get("completeness"),
+		Limit:        limit,
+		Offset:       offset,
+		SortBy:       r.URL.Query().Get("sort_by"),
+		OrderBy:      r.URL.Query().Get("order_by"),
+		Annotations:  parseAnnotationFilters(r),
+		Fields:       parseFields(r),
+	}
+	if !validErrorMode(filter.ErrorMode) {
+		writeBadRequest(w, "error_mode must be root or rollup")
+		return
+	}
+	switch filter.Completeness {
+	case "", storage.TraceComplete, storage.TracePartial, storage.TraceCompletenessUnknown:
+	default:
+		writeBadRequest(w, "completeness must be complete, partial or unknown")
+		return
+	}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("min_duration_ms"), 10, 64); err == nil && v > 0 {
+		filter.MinDurationMs = v
+	}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("max_duration_ms"), 10, 64); err == nil && v > 0 {
+		filter.MaxDurationMs = v
+	}
 
-	response, err := s.repo.GetTracesFiltered(start, end, serviceNames, status, search, limit, offset, sortBy, orderBy)
+	response, err := s.store(r).QueryTracesContext(r.Context(), filter)
+	if errors.Is(err, storage.ErrUnknownField) {
+		writeBadRequest(w, "invalid fields: "+err.Error())
+		return
+	}
 	if err != nil {
-		slog.Error("Failed to get filtered traces", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeQueryError(w, r, "Failed to get filtered traces", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(filter.Fields) > 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"traces": projectRows(response.Traces, filter.Fields),
+			"total":  response.Total,
+			"limit":  response.Limit,
+			"offset": response.Offset,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleQueryTraces handles GET /api/traces/query?q=...
+// Searches traces with a TraceQL-lite expression, e.g.
+//
+//	service="payment-service" && duration>500ms && status=error && span.attr["http.status_code"]=504
+//
+// Comparisons are field op value, joined with && and || (&& binds tighter) and
+// grouped with parentheses:
+//
+//	service, trace_id          = != against a string
+//	status                     = != against ok, error or unset
+//	duration                   = != > >= < <= against a duration (500ms, 1.5s, 2m)
+//	span.name, span.service    = != against a string; true if any span matches
+//	span.attr["key"]           = != against a string or number, > >= < <= against a
+//	                           number; true if any span's attribute matches
+//
+// Strings are double-quoted, or bare when they are a single word. span.attr is
+// evaluated over at most storage.MaxQuerySpanScan spans of the time range. start,
+// end, limit, offset, sort_by, order_by and fields work as on /api/traces, and the
+// response has the same shape. A query that does not parse is a 400 whose details
+// carry the byte position of the error.
+func (s *Server) handleQueryTraces(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	expr, err := query.Parse(q)
+	var syntaxErr *query.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidArgument, "invalid query: "+syntaxErr.Error(),
+			map[string]int{"position": syntaxErr.Pos})
+		return
+	}
+	if err != nil {
+		writeBadRequest(w, "invalid query: "+err.Error())
+		return
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		writeBadRequest(w, fmt.Sprintf("Invalid time range: %v", err))
+		return
+	}
+	filter := storage.TraceFilter{
+		StartTime: start,
+		EndTime:   end,
+		Limit:     20,
+		SortBy:    r.URL.Query().Get("sort_by"),
+		OrderBy:   r.URL.Query().Get("order_by"),
+		Fields:    parseFields(r),
+		Query:     expr,
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		filter.Limit = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil {
+		filter.Offset = v
+	}
+
+	response, err := s.store(r).QueryTracesContext(r.Context(), filter)
+	if errors.Is(err, storage.ErrUnknownField) {
+		writeBadRequest(w, "invalid fields: "+err.Error())
+		return
+	}
+	if err != nil {
+		writeQueryError(w, r, "Failed to query traces", err, "query", q)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(filter.Fields) > 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"traces": projectRows(response.Traces, filter.Fields),
+			"total":  response.Total,
+			"limit":  response.Limit,
+			"offset": response.Offset,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGetTracesByLogs handles GET /api/traces/by-logs
+// Takes the /api/logs search parameters (service_name, severity, search, attr, ...)
+// and lists the traces behind the matching logs, each with its count of matching
+// logs. max_traces bounds how many distinct traces are considered (default 500);
+// limit, offset, sort_by and order_by page through those.
+func (s *Server) handleGetTracesByLogs(w http.ResponseWriter, r *http.Request) {
+	logFilter, err := parseLogFilter(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	traceFilter := storage.TraceFilter{
+		Limit:   20,
+		SortBy:  r.URL.Query().Get("sort_by"),
+		OrderBy: r.URL.Query().Get("order_by"),
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		traceFilter.Limit = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil {
+		traceFilter.Offset = v
+	}
+	maxTraces := 500
+	if v := r.URL.Query().Get("max_traces"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > storage.MaxTracesByLogs {
+			writeBadRequest(w, fmt.Sprintf("max_traces must be between 1 and %d", storage.MaxTracesByLogs))
+			return
+		}
+		maxTraces = n
+	}
+
+	response, err := s.store(r).GetTracesByLogsContext(r.Context(), logFilter, traceFilter, maxTraces)
+	if errors.Is(err, storage.ErrAttributeNotIndexed) {
+		writeBadRequest(w, err.Error()+"; add it to LOG_INDEXED_ATTRIBUTES")
+		return
+	}
+	if err != nil {
+		writeQueryError(w, r, "Failed to get traces by logs", err)
 		return
 	}
 
@@ -47,20 +218,230 @@ func (s *Server) handleGetTraces(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleGetTraceByID handles GET /api/traces/{id}
+// The trace comes with its timeline (time covered by child spans versus idle time)
+// and each span's self time. Query params: baseline (e.g. 7d) annotates each span with
+// its operation's p50/p95 over that window before now, its percentile position and
+// whether it was slow; critical_path=true marks the spans that determined the trace's
+// latency.
 func (s *Server) handleGetTraceByID(w http.ResponseWriter, r *http.Request) {
 	traceID := r.PathValue("id")
 	if traceID == "" {
-		http.Error(w, "missing trace id", http.StatusBadRequest)
+		writeBadRequest(w, "missing trace id")
+		return
+	}
+	var window time.Duration
+	if v := r.URL.Query().Get("baseline"); v != "" {
+		d, err := storage.ParseCompareOffset(v)
+		if err != nil {
+			writeBadRequest(w, "baseline: "+err.Error())
+			return
+		}
+		window = d
+	}
+
+	trace, err := s.store(r).GetTrace(traceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "trace not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "Failed to get trace", err, "trace_id", traceID)
+		return
+	}
+
+	detail := TraceDetail{Trace: trace, Spans: newDetailSpans(trace.Spans), Timeline: storage.ComputeTraceTimeline(trace.Spans)}
+	if window > 0 {
+		baselines, err := s.operationBaselines(r, window, spanOperations(trace.Spans))
+		if err != nil {
+			writeInternalError(w, "Failed to get latency baselines", err, "trace_id", traceID)
+			return
+		}
+		annotateBaselines(detail.Spans, baselines)
+		detail.BaselineWindow = r.URL.Query().Get("baseline")
+	}
+	if r.URL.Query().Get("critical_path") == "true" {
+		total := annotateCriticalPath(detail.Spans)
+		detail.CriticalPathUs = &total
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// TraceLookup is the trace found for a pasted trace or span ID.
+type TraceLookup struct {
+	Matched string         `json:"matched"`           // "trace" or "span": what the ID was
+	SpanID  string         `json:"span_id,omitempty"` // the matched span, for a span ID
+	Trace   *storage.Trace `json:"trace"`
+}
+
+// handleLookupTrace handles GET /api/traces/lookup
+// Query params: id, a full 32-character trace ID or 16-character span ID in any case.
+// A span ID resolves to the trace it belongs to.
+func (s *Server) handleLookupTrace(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	store := s.store(r)
+	traceID, kind, err := store.LookupTraceIDContext(r.Context(), id)
+	if errors.Is(err, storage.ErrNotAnID) {
+		writeBadRequest(w, "id: "+err.Error())
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "no trace with this "+kind+" ID")
 		return
 	}
+	if err != nil {
+		writeQueryError(w, r, "Failed to look up trace", err)
+		return
+	}
+
+	trace, err := store.GetTrace(traceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "trace not found") // deleted in between
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "Failed to get trace", err, "trace_id", traceID)
+		return
+	}
+	lookup := TraceLookup{Matched: kind, Trace: trace}
+	if kind == storage.IDKindSpan {
+		lookup.SpanID, _ = storage.ParseExactID(id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lookup)
+}
+
+// operationBaselines returns the latency baselines of ops over the window before now,
+// from the cache where possible.
+func (s *Server) operationBaselines(r *http.Request, window time.Duration, ops []storage.OperationKey) (map[storage.OperationKey]*storage.OperationBaseline, error) {
+	end := time.Now()
+	fetch := func(ops []storage.OperationKey) (map[storage.OperationKey]*storage.OperationBaseline, error) {
+		return s.store(r).GetOperationBaselines(ops, end.Add(-window), end)
+	}
+	if s.baselines == nil {
+		return fetch(ops)
+	}
+	return s.baselines.get(tenant.Scope(r.Context()), window, ops, fetch)
+}
+
+// handleGetRelatedTraces handles GET /api/traces/{id}/related
+// Lists the traces connected to this one by span links in either direction, e.g. the
+// producer trace of a message consumer, with a summary of each.
+func (s *Server) handleGetRelatedTraces(w http.ResponseWriter, r *http.Request) {
+	traceID := r.PathValue("id")
+	related, err := s.store(r).GetRelatedTraces(traceID)
+	if err != nil {
+		writeInternalError(w, "Failed to get related traces", err, "trace_id", traceID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(related)
+}
+
+// handleGetTraceFlamegraph handles GET /api/traces/{id}/flamegraph
+// Query params: merge (combine identical sibling operations)
+func (s *Server) handleGetTraceFlamegraph(w http.ResponseWriter, r *http.Request) {
+	traceID := r.PathValue("id")
+	trace, err := s.store(r).GetTrace(traceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(w, "trace not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "Failed to get trace", err, "trace_id", traceID)
+		return
+	}
+
+	merge := r.URL.Query().Get("merge") == "true"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(storage.BuildFlamegraph(trace.Spans, merge))
+}
+
+// handleGetTracePaths handles GET /api/traces/paths
+// Query params: start, end (RFC3339; default last hour), service_name, sort_by
+// (count|errors|error_rate|duration), limit (default 20), max_spans (per-trace cap)
+func (s *Server) handleGetTracePaths(w http.ResponseWriter, r *http.Request) {
+	q := storage.TracePathQuery{
+		End:         time.Now(),
+		ServiceName: r.URL.Query().Get("service_name"),
+		SortBy:      r.URL.Query().Get("sort_by"),
+		Limit:       20,
+	}
+	q.Start = q.End.Add(-time.Hour)
+	if t, err := time.Parse(time.RFC3339, r.URL.Query().Get("start")); err == nil {
+		q.Start = t
+	}
+	if t, err := time.Parse(time.RFC3339, r.URL.Query().Get("end")); err == nil {
+		q.End = t
+	}
+	switch q.SortBy {
+	case "", "count", "errors", "error_rate", "duration":
+	default:
+		writeBadRequest(w, "sort_by must be one of count, errors, error_rate, duration")
+		return
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			q.Limit = v
+		}
+	}
+	if m := r.URL.Query().Get("max_spans"); m != "" {
+		if v, err := strconv.Atoi(m); err == nil && v > 0 {
+			q.MaxSpansPerTrace = v
+		}
+	}
+
+	result, err := s.store(r).GetTracePaths(q)
+	if err != nil {
+		writeInternalError(w, "Failed to get trace paths", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleGetSpans handles GET /api/spans
+// Query params: service_name, operation, trace_id, scope_name, scope_version, start, end, limit, offset
+func (s *Server) handleGetSpans(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	offset := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil {
+			limit = v
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil {
+			offset = v
+		}
+	}
+
+	filter := storage.SpanFilter{
+		ServiceName:   r.URL.Query().Get("service_name"),
+		OperationName: r.URL.Query().Get("operation"),
+		TraceID:       r.URL.Query().Get("trace_id"),
+		ScopeName:     r.URL.Query().Get("scope_name"),
+		ScopeVersion:  r.URL.Query().Get("scope_version"),
+		Limit:         limit,
+		Offset:        offset,
+	}
+	if t, err := time.Parse(time.RFC3339, r.URL.Query().Get("start")); err == nil {
+		filter.StartTime = t
+	}
+	if t, err := time.Parse(time.RFC3339, r.URL.Query().Get("end")); err == nil {
+		filter.EndTime = t
+	}
 
-	trace, err := s.repo.GetTrace(traceID)
+	spans, total, err := s.store(r).GetSpans(filter)
 	if err != nil {
-		slog.Error("Trace not found", "trace_id", traceID, "error", err)
-		http.Error(w, "trace not found", http.StatusNotFound)
+		writeInternalError(w, "Failed to get spans", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(trace)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":  spans,
+		"total": total,
+	})
 }
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestQueryTraces(t *testing.T) {
+	s, repo := newTestServer(t)
+	now := time.Now()
+	if err := repo.BatchCreateTraces([]storage.Trace{
+		{TraceID: "slow", ServiceName: "payment-service", Timestamp: now, Duration: 900_000, Status: "STATUS_CODE_ERROR"},
+		{TraceID: "fast", ServiceName: "payment-service", Timestamp: now, Duration: 10_000, Status: "STATUS_CODE_ERROR"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(q string, extra ...string) *httptest.ResponseRecorder {
+		target := "/api/traces/query?q=" + url.QueryEscape(q)
+		for _, e := range extra {
+			target += "&" + e
+		}
+		rec := httptest.NewRecorder()
+		s.handleQueryTraces(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get(`service="payment-service" && duration>500ms && status=error`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var res storage.TracesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || len(res.Traces) != 1 || res.Traces[0].TraceID != "slow" || res.Limit != 20 {
+		t.Errorf("response = %+v, want only the slow trace with limit 20", res)
+	}
+
+	rec = get(`status=error`, "fields=trace_id", "sort_by=trace_id", "order_by=asc")
+	var projected struct {
+		Traces []map[string]any `json:"traces"`
+		Total  int64            `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &projected); err != nil {
+		t.Fatal(err)
+	}
+	if projected.Total != 2 || len(projected.Traces) != 2 || len(projected.Traces[0]) != 1 || projected.Traces[0]["trace_id"] != "fast" {
+		t.Errorf("projected response = %s", rec.Body)
+	}
+
+	rec = get(`service="payment-service" && duration>`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad query status = %d, want 400", rec.Code)
+	}
+	apiErr := decodeError(t, rec)
+	if details, _ := apiErr.Details.(map[string]any); details["position"] != float64(38) {
+		t.Errorf("error = %+v, want position 38", apiErr)
+	}
+	if rec := get(""); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty query status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGetTraceCriticalPath(t *testing.T) {
+	s, repo := newTestServer(t)
+	t0 := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+	if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: "cp", ServiceName: "api", Timestamp: t0}}); err != nil {
+		t.Fatal(err)
+	}
+	// The db call runs alongside the slower cache call, which is on the path.
+	if err := repo.BatchCreateSpans([]storage.Span{
+		{TraceID: "cp", SpanID: "root", ParentSpanID: "", ServiceName: "api", OperationName: "GET /", StartTime: ms(0), Duration: 100_000},
+		{TraceID: "cp", SpanID: "cache", ParentSpanID: "root", ServiceName: "api", OperationName: "cache", StartTime: ms(10), Duration: 80_000},
+		{TraceID: "cp", SpanID: "db", ParentSpanID: "root", ServiceName: "api", OperationName: "db", StartTime: ms(10), Duration: 30_000},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string) map[string]json.RawMessage {
+		req := httptest.NewRequest(http.MethodGet, "/api/traces/cp?"+query, nil)
+		req.SetPathValue("id", "cp")
+		rec := httptest.NewRecorder()
+		s.handleGetTraceByID(rec, req)
+		var body map[string]json.RawMessage
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		return body
+	}
+	var spans []struct {
+		SpanID              string  `json:"span_id"`
+		OnCriticalPath      bool    `json:"on_critical_path"`
+		CriticalPathUs      int64   `json:"critical_path_us"`
+		CriticalPathPercent float64 `json:"critical_path_percent"`
+	}
+	body := get("critical_path=true")
+	if string(body["critical_path_us"]) != "100000" {
+		t.Errorf("critical_path_us = %s, want 100000", body["critical_path_us"])
+	}
+	json.Unmarshal(body["spans"], &spans)
+	want := map[string]int64{"root": 20_000, "cache": 80_000, "db": 0}
+	for _, sp := range spans {
+		if sp.CriticalPathUs != want[sp.SpanID] || sp.OnCriticalPath != (want[sp.SpanID] > 0) {
+			t.Errorf("span %s: %+v, want %dµs", sp.SpanID, sp, want[sp.SpanID])
+		}
+		if sp.SpanID == "cache" && sp.CriticalPathPercent != 80 {
+			t.Errorf("cache percent = %v, want 80", sp.CriticalPathPercent)
+		}
+	}
+	if _, ok := body["baseline_window"]; ok || len(spans) != 3 {
+		t.Errorf("got %d spans, baseline_window %s", len(spans), body["baseline_window"])
+	}
+
+	// Combined with a baseline, spans carry both.
+	body = get("critical_path=true&baseline=1d")
+	if string(body["baseline_window"]) != `"1d"` {
+		t.Fatalf("combined: %s", body["baseline_window"])
+	}
+	var raw []map[string]json.RawMessage
+	json.Unmarshal(body["spans"], &raw)
+	if _, ok := raw[0]["baseline"]; !ok || raw[0]["on_critical_path"] == nil {
+		t.Errorf("combined span = %v, want baseline and critical path fields", raw[0])
+	}
+	// Without either, no annotations.
+	if body := get(""); body["critical_path_us"] != nil {
+		t.Errorf("plain trace has critical_path_us %s", body["critical_path_us"])
+	}
+}
+
+func TestGetTraceTimeline(t *testing.T) {
+	s, repo := newTestServer(t)
+	t0 := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+	if err := repo.BatchCreateTraces([]storage.Trace{
+		{TraceID: "busy", ServiceName: "api", Timestamp: t0},
+		{TraceID: "idle", ServiceName: "api", Timestamp: t0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// idle: a 900ms root whose children cover 200ms of it; busy: 50 of 100ms idle.
+	if err := repo.BatchCreateSpans([]storage.Span{
+		{TraceID: "idle", SpanID: "root", ServiceName: "api", OperationName: "GET /", StartTime: ms(0), Duration: 900_000},
+		{TraceID: "idle", SpanID: "db", ParentSpanID: "root", ServiceName: "api", OperationName: "db", StartTime: ms(100), Duration: 150_000},
+		{TraceID: "idle", SpanID: "cache", ParentSpanID: "root", ServiceName: "api", OperationName: "cache", StartTime: ms(200), Duration: 100_000},
+		{TraceID: "busy", SpanID: "root", ServiceName: "api", OperationName: "GET /", StartTime: ms(0), Duration: 100_000},
+		{TraceID: "busy", SpanID: "db", ParentSpanID: "root", ServiceName: "api", OperationName: "db", StartTime: ms(50), Duration: 50_000},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/traces/idle", nil)
+	req.SetPathValue("id", "idle")
+	rec := httptest.NewRecorder()
+	s.handleGetTraceByID(rec, req)
+	var detail struct {
+		Timeline storage.TraceTimeline `json:"timeline"`
+		Spans    []struct {
+			SpanID     string `json:"span_id"`
+			SelfTimeUs int64  `json:"self_time_us"`
+		} `json:"spans"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if want := (storage.TraceTimeline{TotalDurationUs: 900_000, InstrumentedTimeUs: 200_000, IdleTimeUs: 700_000, IdlePercentage: 77.78}); detail.Timeline != want {
+		t.Errorf("timeline = %+v, want %+v", detail.Timeline, want)
+	}
+	self := map[string]int64{"root": 700_000, "db": 150_000, "cache": 100_000}
+	for _, sp := range detail.Spans {
+		if sp.SelfTimeUs != self[sp.SpanID] {
+			t.Errorf("span %s self time = %dµs, want %d", sp.SpanID, sp.SelfTimeUs, self[sp.SpanID])
+		}
+	}
+
+	// The list sorts by the idle percentage the reconciler stored.
+	if _, err := repo.ReconcileTraceCompleteness(context.Background(), storage.CompletenessCursor{}, time.Now(), 100); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	s.handleGetTraces(rec, httptest.NewRequest(http.MethodGet, "/api/traces?sort_by=idle_percentage&order_by=desc", nil))
+	var list storage.TracesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Traces) != 2 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got := list.Traces[0]; got.TraceID != "idle" || got.IdlePercentage == nil || *got.IdlePercentage != 77.78 {
+		t.Errorf("first trace = %s at %v%%, want idle at 77.78%%", got.TraceID, got.IdlePercentage)
+	}
+}
+
+func TestLookupTrace(t *testing.T) {
+	s, repo := newTestServer(t)
+	const traceID, spanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	now := time.Now()
+	if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: traceID, ServiceName: "api", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]storage.Span{{TraceID: traceID, SpanID: spanID, ServiceName: "api", OperationName: "GET /", StartTime: now}}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleLookupTrace(rec, httptest.NewRequest(http.MethodGet, "/api/traces/lookup?id="+url.QueryEscape(id), nil))
+		return rec
+	}
+
+	for id, wantSpan := range map[string]string{"4BF92F3577B34DA6A3CE929D0E0E4736": "", "00F067AA0BA902B7": spanID} {
+		rec := get(id)
+		var res TraceLookup
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &res) != nil {
+			t.Fatalf("lookup %s: status %d: %s", id, rec.Code, rec.Body)
+		}
+		if res.Trace == nil || res.Trace.TraceID != traceID || len(res.Trace.Spans) != 1 || res.SpanID != wantSpan {
+			t.Errorf("lookup %s = %s, want the trace with its span", id, rec.Body)
+		}
+	}
+	if rec := get("ffffffffffffffffffffffffffffffff"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown trace ID status = %d, want 404", rec.Code)
+	}
+	if rec := get("4bf92f35"); rec.Code != http.StatusBadRequest {
+		t.Errorf("partial ID status = %d, want 400", rec.Code)
+	}
+}
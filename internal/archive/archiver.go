@@ -124,6 +124,13 @@ func (a *Archiver) RunOnce(ctx context.Context) error {
 		slog.Warn("Archive: size limit enforcement failed", "error", err)
 	}
 
+	auditCutoff := time.Now().UTC().AddDate(0, 0, -a.cfg.AuditRetentionDays)
+	if n, err := a.repo.PruneAuditEntries(auditCutoff); err != nil {
+		slog.Warn("Archive: audit log pruning failed", "error", err)
+	} else if n > 0 {
+		slog.Info("Archive: pruned audit log", "entries", n, "cutoff", auditCutoff)
+	}
+
 	if err := Maintain(a.repo, a.cfg); err != nil {
 		slog.Warn("Archive: DB maintenance failed", "error", err)
 	}
@@ -0,0 +1,138 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/compress"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+const (
+	purgeArchivePrefix = "traces-"
+	purgeArchiveSuffix = ".ndjson.zst"
+)
+
+// RestoreResult reports how many rows were re-imported from an archive.
+type RestoreResult struct {
+	Name   string `json:"name"`
+	Traces int    `json:"traces"`
+	Spans  int    `json:"spans"`
+	Logs   int    `json:"logs"`
+}
+
+// PurgeArchive exports traces (with their spans and logs) to a Store before
+// they are purged, and re-imports them on demand.
+// Each exported batch becomes one file: traces-{YYYY-MM-DD}-{unix_nanos}.ndjson.zst,
+// dated by the oldest trace in the batch. Every line is a JSON-encoded storage.Trace.
+type PurgeArchive struct {
+	repo  *storage.Repository
+	store Store
+}
+
+// NewPurgeArchive creates a PurgeArchive writing to store.
+func NewPurgeArchive(repo *storage.Repository, store Store) *PurgeArchive {
+	return &PurgeArchive{repo: repo, store: store}
+}
+
+// Export writes a batch of traces to the store. It is meant to be installed
+// via Repository.SetPurgeArchiver; a returned error aborts the purge.
+func (p *PurgeArchive) Export(traces []storage.Trace) error {
+	if len(traces) == 0 {
+		return nil
+	}
+
+	oldest := traces[0].Timestamp
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, t := range traces {
+		if t.Timestamp.Before(oldest) {
+			oldest = t.Timestamp
+		}
+		if err := enc.Encode(t); err != nil {
+			return fmt.Errorf("failed to encode trace %s: %w", t.TraceID, err)
+		}
+	}
+
+	name := fmt.Sprintf("%s%s-%d%s", purgeArchivePrefix, oldest.UTC().Format("2006-01-02"), time.Now().UnixNano(), purgeArchiveSuffix)
+	if err := p.store.Put(context.Background(), name, compress.Compress(buf.Bytes())); err != nil {
+		return err
+	}
+	slog.Info("📦 Traces archived before purge", "archive", name, "traces", len(traces))
+	return nil
+}
+
+// List returns all archives, newest first.
+func (p *PurgeArchive) List(ctx context.Context) ([]ObjectInfo, error) {
+	objs, err := p.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name > objs[j].Name })
+	return objs, nil
+}
+
+// Restore re-imports the named archive through the regular batch insert paths.
+// Traces that already exist are skipped by BatchCreateTraces.
+func (p *PurgeArchive) Restore(ctx context.Context, name string) (*RestoreResult, error) {
+	if !isArchiveName(name) {
+		return nil, fmt.Errorf("invalid archive name %q", name)
+	}
+	data, err := p.store.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", name, err)
+	}
+	raw, err := compress.Decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress archive %s: %w", name, err)
+	}
+
+	var traces []storage.Trace
+	var spans []storage.Span
+	var logs []storage.Log
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for dec.More() {
+		var t storage.Trace
+		if err := dec.Decode(&t); err != nil {
+			return nil, fmt.Errorf("failed to decode archive %s: %w", name, err)
+		}
+		for _, s := range t.Spans {
+			s.ID = 0
+			spans = append(spans, s)
+		}
+		for _, l := range t.Logs {
+			l.ID = 0
+			logs = append(logs, l)
+		}
+		t.ID = 0
+		t.Spans, t.Logs = nil, nil
+		traces = append(traces, t)
+	}
+
+	if err := p.repo.BatchCreateTraces(traces); err != nil {
+		return nil, fmt.Errorf("failed to restore traces: %w", err)
+	}
+	if err := p.repo.BatchCreateSpans(spans); err != nil {
+		return nil, err
+	}
+	if err := p.repo.BatchCreateLogs(logs); err != nil {
+		return nil, err
+	}
+
+	return &RestoreResult{Name: name, Traces: len(traces), Spans: len(spans), Logs: len(logs)}, nil
+}
+
+// isArchiveName reports whether name is a purge archive file name. It also
+// rejects anything that could escape the archive directory.
+func isArchiveName(name string) bool {
+	return strings.HasPrefix(name, purgeArchivePrefix) &&
+		strings.HasSuffix(name, purgeArchiveSuffix) &&
+		!strings.ContainsAny(name, `/\`) &&
+		!strings.Contains(name, "..")
+}
@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func newTestRepo(t *testing.T) *storage.Repository {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "archive.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func seedOldTrace(t *testing.T, repo *storage.Repository, ts time.Time) {
+	t.Helper()
+	if err := repo.BatchCreateTraces([]storage.Trace{{TraceID: "t1", ServiceName: "checkout", Duration: 1000, Status: "STATUS_CODE_OK", Timestamp: ts}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]storage.Span{{TraceID: "t1", SpanID: "s1", ServiceName: "checkout", OperationName: "GET /", StartTime: ts, EndTime: ts.Add(time.Millisecond), Duration: 1000}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs([]storage.Log{{TraceID: "t1", SpanID: "s1", ServiceName: "checkout", Severity: "INFO", Body: "hello", Timestamp: ts}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPurgeArchiveRoundTrip(t *testing.T) {
+	repo := newTestRepo(t)
+	old := time.Now().AddDate(0, 0, -30)
+	seedOldTrace(t, repo, old)
+
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa := NewPurgeArchive(repo, store)
+	repo.SetPurgeArchiver(pa.Export)
+
+	n, err := repo.PurgeTraces(time.Now().AddDate(0, 0, -7))
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeTraces() = %d, %v; want 1, nil", n, err)
+	}
+	if _, err := repo.GetTrace("t1"); err == nil {
+		t.Fatal("trace still present after purge")
+	}
+
+	archives, err := pa.List(context.Background())
+	if err != nil || len(archives) != 1 {
+		t.Fatalf("List() = %v, %v; want one archive", archives, err)
+	}
+	if want := "traces-" + old.UTC().Format("2006-01-02") + "-"; archives[0].Name[:len(want)] != want {
+		t.Errorf("archive name = %q, want prefix %q", archives[0].Name, want)
+	}
+
+	res, err := pa.Restore(context.Background(), archives[0].Name)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if res.Traces != 1 || res.Spans != 1 || res.Logs != 1 {
+		t.Errorf("Restore() = %+v, want 1 trace, 1 span, 1 log", res)
+	}
+	tr, err := repo.GetTrace("t1")
+	if err != nil {
+		t.Fatalf("GetTrace() after restore error = %v", err)
+	}
+	if len(tr.Spans) != 1 || len(tr.Logs) != 1 {
+		t.Errorf("restored trace has %d spans, %d logs; want 1, 1", len(tr.Spans), len(tr.Logs))
+	}
+}
+
+func TestPurgeAbortsWhenArchiveFails(t *testing.T) {
+	repo := newTestRepo(t)
+	seedOldTrace(t, repo, time.Now().AddDate(0, 0, -30))
+	repo.SetPurgeArchiver(func([]storage.Trace) error { return errors.New("bucket unreachable") })
+
+	if _, err := repo.PurgeTraces(time.Now()); err == nil {
+		t.Fatal("PurgeTraces() succeeded despite archive failure")
+	}
+	if _, err := repo.GetTrace("t1"); err != nil {
+		t.Errorf("trace deleted although archiving failed: %v", err)
+	}
+}
+
+func TestRestoreRejectsInvalidNames(t *testing.T) {
+	pa := NewPurgeArchive(nil, &LocalStore{dir: t.TempDir()})
+	for _, name := range []string{"../etc/passwd", "traces-x/../../y.ndjson.zst", "manifest.json"} {
+		if _, err := pa.Restore(context.Background(), name); err == nil {
+			t.Errorf("Restore(%q) succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package buildinfo describes the running binary. Version, Commit and Date are set at
+// link time by the Makefile:
+//
+//	go build -ldflags "-X github.com/RandomCodeSpace/otelcontext/internal/buildinfo.Commit=$(git rev-parse --short HEAD)"
+//
+// When they are not set, the module version and the VCS stamp the Go toolchain
+// records are used instead.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/RandomCodeSpace/central-ops/pkg/version"
+)
+
+// Set with -ldflags "-X". Empty means "not stamped".
+var (
+	Version = ""
+	Commit  = ""
+	Date    = ""
+)
+
+// Info identifies a server build. DBDriver and UIBuild are filled in by the caller,
+// since they depend on configuration and on the embedded frontend.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	DBDriver  string `json:"db_driver,omitempty"`
+	UIBuild   string `json:"ui_build,omitempty"`
+}
+
+// Read returns the build information of the running binary.
+func Read() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: Date,
+		GoVersion: runtime.Version(),
+	}
+	if info.Version == "" {
+		info.Version = version.Detect()
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+				if len(info.Commit) > 12 {
+					info.Commit = info.Commit[:12]
+				}
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
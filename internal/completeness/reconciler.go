@@ -0,0 +1,92 @@
+// Package completeness marks traces complete or partial a few minutes behind ingest,
+// so a trace missing spans to sampling or a failed export is not mistaken for the
+// whole story.
+package completeness
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// batchSize is the number of traces checked per query.
+const batchSize = 500
+
+// Reconciler periodically checks the traces modified since its previous run, once
+// they have been left alone for the settling delay.
+type Reconciler struct {
+	store    storage.TraceCompletenessStore
+	interval time.Duration
+	delay    time.Duration
+
+	mu     sync.Mutex
+	cursor storage.CompletenessCursor // last trace checked; the first run starts from the oldest
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates a reconciler that runs every interval over traces last modified more
+// than delay ago.
+func New(store storage.TraceCompletenessStore, interval, delay time.Duration) *Reconciler {
+	return &Reconciler{
+		store:    store,
+		interval: interval,
+		delay:    delay,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start runs the reconcile loop. Blocks until ctx is cancelled or Stop is called.
+func (r *Reconciler) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			if _, err := r.RunOnce(ctx, time.Now()); err != nil {
+				slog.Error("Completeness: reconcile failed", "error", err)
+			}
+		}
+	}
+}
+
+// Stop terminates the reconcile loop.
+func (r *Reconciler) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+// RunOnce checks every trace modified since the previous run and before now minus
+// the delay, and returns how many it checked. A failed run resumes where it stopped.
+func (r *Reconciler) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	until := now.Add(-r.delay)
+	checked, partial := 0, 0
+	for ctx.Err() == nil {
+		batch, err := r.store.ReconcileTraceCompleteness(ctx, r.cursor, until, batchSize)
+		if err != nil {
+			return checked, err
+		}
+		r.cursor = batch.Next
+		checked += batch.Checked
+		partial += batch.Partial
+		if batch.Checked < batchSize {
+			break
+		}
+	}
+	if checked > 0 {
+		slog.Debug("Completeness: traces checked", "checked", checked, "partial", partial)
+	}
+	return checked, ctx.Err()
+}
@@ -0,0 +1,52 @@
+package completeness
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// pagedStore pretends `pending` traces are waiting and records each call.
+type pagedStore struct {
+	pending int
+	calls   []storage.CompletenessCursor
+	until   []time.Time
+}
+
+func (s *pagedStore) ReconcileTraceCompleteness(_ context.Context, after storage.CompletenessCursor, until time.Time, limit int) (*storage.CompletenessBatch, error) {
+	s.calls = append(s.calls, after)
+	s.until = append(s.until, until)
+	n := min(limit, s.pending)
+	s.pending -= n
+	return &storage.CompletenessBatch{Checked: n, Next: storage.CompletenessCursor{UpdatedAt: until, ID: after.ID + uint(n)}}, nil
+}
+
+func TestRunOnceResumesFromTheCursor(t *testing.T) {
+	store := &pagedStore{pending: batchSize + 3}
+	r := New(store, time.Minute, 3*time.Minute)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	checked, err := r.RunOnce(context.Background(), now)
+	if err != nil || checked != batchSize+3 {
+		t.Fatalf("RunOnce() = %d, %v; want %d", checked, err, batchSize+3)
+	}
+	if len(store.calls) != 2 || store.calls[1].ID != batchSize {
+		t.Fatalf("calls = %+v, want a second page from id %d", store.calls, batchSize)
+	}
+	for _, until := range store.until {
+		if !until.Equal(now.Add(-3 * time.Minute)) {
+			t.Errorf("until = %v, want now minus the delay", until)
+		}
+	}
+
+	// The next run picks up after the last trace checked.
+	store.pending = 1
+	if checked, err := r.RunOnce(context.Background(), now.Add(time.Minute)); err != nil || checked != 1 {
+		t.Fatalf("second RunOnce() = %d, %v; want 1", checked, err)
+	}
+	if last := store.calls[len(store.calls)-1]; last.ID != batchSize+3 {
+		t.Errorf("second run started at id %d, want %d", last.ID, batchSize+3)
+	}
+}
@@ -3,9 +3,12 @@ package config
 import (
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +16,7 @@ import (
 type Config struct {
 	Env               string
 	LogLevel          string
+	PprofEnabled      bool // serve net/http/pprof under /api/admin/pprof/
 	HTTPPort          string
 	GRPCPort          string
 	DBDriver          string
@@ -24,11 +28,38 @@ type Config struct {
 	IngestMinSeverity      string
 	IngestAllowedServices  string
 	IngestExcludedServices string
+	IngestServiceAliases   string // "alias=canonical,..." or path to a JSON file
+	IngestDefaultEnv       string // environment of data whose resource has no deployment.environment
+	IngestConfigFile       string // runtime filter changes are saved here ("" = not persisted)
+	IngestDeriveREDMetrics bool   // derive argus.derived.* metrics from root spans
+	IngestDedupeStatusLogs bool   // skip a failed span's status log when the app logged the error itself
+	LogCollapseWindow      string // fold identical log lines seen within this window, e.g. "10s"; "0" disables
+	LogCollapseMaxKeys     int    // distinct log lines tracked while collapsing
+	LogMaxBodyBytes        int    // longer log bodies are truncated at ingest; 0 = no limit
+	LogDispatchQueueSize   int    // stored log batches awaiting live fan-out; more are dropped
+	TraceMaxSpans          int    // spans stored per trace; more are counted on the trace only. 0 = no limit
+	TraceMaxSpansTracked   int    // traces whose span count is kept in memory for TRACE_MAX_SPANS
 
 	// DB Connection Pool
 	DBMaxOpenConns    int
 	DBMaxIdleConns    int
 	DBConnMaxLifetime string // e.g. "1h", "30m"
+	DBQueryTimeout    string // bound on API and live snapshot reads, e.g. "30s"; "0" disables
+
+	// Slow query log
+	DBSlowQueryThreshold string // statements taking longer are kept for /api/admin/slow-queries; "0" disables
+	DBSlowQueryLogSize   int    // slow statements kept, newest first
+
+	// Read replica
+	DBReadDSN    string // reads go to this replica of DB_DSN when set
+	DBReadMaxLag string // reads fall back to the primary while the replica lags more, e.g. "30s"
+
+	// Insert batching
+	DBBatchSize          int  // rows per insert statement; 0 = the driver's default
+	DBBatchAdaptive      bool // adjust the batch size per table from observed insert latency
+	DBBatchMinSize       int  // adaptive bounds
+	DBBatchMaxSize       int
+	DBBatchTargetLatency string // adaptive batches taking longer than this are halved, e.g. "250ms"
 
 	// Hot/Cold Storage
 	HotRetentionDays    int
@@ -36,6 +67,22 @@ type Config struct {
 	ColdStorageMaxGB    int
 	ArchiveScheduleHour int // 0-23, hour of day to run archival
 	ArchiveBatchSize    int
+	AuditRetentionDays  int // admin audit log, pruned by the daily archival pass
+
+	// Pre-purge trace archive (local directory or S3-compatible bucket)
+	ArchiveEnabled     bool
+	ArchivePath        string
+	ArchiveS3Endpoint  string
+	ArchiveS3Bucket    string
+	ArchiveS3Prefix    string
+	ArchiveS3Region    string
+	ArchiveS3AccessKey string
+	ArchiveS3SecretKey string
+
+	// Admin purge: larger purges run as background jobs in batches
+	PurgeBatchSize   int
+	PurgeBatchPause  string // e.g. "100ms", yields the write lock to ingestion
+	PurgeSyncMaxRows int    // purges of up to this many rows run inline
 
 	// TSDB
 	TSDBRingBufferDuration string // e.g. "1h"
@@ -47,7 +94,12 @@ type Config struct {
 
 	// Smart Observability — Metric Cardinality
 	MetricAttributeKeys  string // comma-separated allowlist
+	LogIndexedAttributes string // comma-separated log attribute keys filterable via attr=
 	MetricMaxCardinality int
+	MetricMaxSeries      int    // distinct attribute sets per metric and window; 0 = unlimited
+	MetricSeriesLimits   string // per-metric overrides, "name=limit,..."
+	MetricMaxFutureSkew  string // e.g. "1h"; points further ahead of server time are clamped to now
+	MetricMaxExemplars   int    // exemplars kept per bucket (highest values); 0 disables
 
 	// DLQ Safety
 	DLQMaxFiles   int
@@ -55,7 +107,12 @@ type Config struct {
 	DLQMaxRetries int
 
 	// API Protection
-	APIRateLimitRPS int
+	APIRateLimitRPS         int    // per client (token or IP); 0 disables
+	APIRateLimitBurst       int    // 0 = APIRateLimitRPS
+	APIMaxConcurrent        int    // concurrent requests per expensive endpoint; 0 disables
+	APIConcurrencyQueueWait string // how long excess requests wait for a slot, e.g. "2s"
+	APIGzipMinBytes         int    // gzip /api responses at least this large; 0 disables
+	APIMaxTimeRange         string // longest window of the dashboard, traffic, latency and service map endpoints, e.g. "720h"; "0" disables
 
 	// MCP Server
 	MCPEnabled bool
@@ -67,8 +124,116 @@ type Config struct {
 	// Vector Index
 	VectorIndexMaxEntries int
 
+	// SLO evaluation
+	SLOEvalInterval string // e.g. "1m"
+
+	// Dashboard stats cache
+	DashboardCacheTTL string // e.g. "5s"; "0" disables the cache
+
+	// Live snapshots pushed over the events WebSocket every 5s
+	LiveSnapshotWorkers int    // service filters computed concurrently
+	LiveSnapshotBudget  string // e.g. "4s"; what is left after this retries on the next tick
+	LiveIdleRefresh     int    // ticks without ingest before snapshots are pushed anyway; 0 = never
+	LiveReplaySize      int    // broadcasts kept for /ws/events clients resuming with since_seq
+	LiveReplayMaxAge    string // e.g. "5m"
+
+	// WebSocket keepalive on /ws, /ws/events and /ws/health
+	WSPingInterval string // e.g. "30s"; "0" sends no pings
+	WSIdleTimeout  string // e.g. "90s"; a client without a pong for this long is disconnected
+
+	// Ingest quotas
+	QuotaPersistInterval string // how often per-service usage counters are saved, e.g. "30s"
+
+	// Service liveness: GET /api/services/liveness and service_stale events
+	ServiceStaleAfter       string // silence after which an active service is stale, e.g. "5m"; "0" disables
+	ServiceRecoverAfter     string // exporting this long without such a gap clears stale, e.g. "1m"
+	LivenessPersistInterval string // how often liveness is checked and saved, e.g. "30s"
+
+	// Trace import
+	ImportMaxMB int // upload size cap for POST /api/import
+
+	// Trace forwarding (POST /api/traces/{id}/forward)
+	TraceForwardEndpoints string // comma-separated host:port OTLP gRPC receivers traces may be sent to; "" = none
+	TraceForwardTimeout   string // e.g. "10s"
+
+	// Backup & restore (SQLite)
+	RestoreEnabled bool // allow POST /api/admin/restore
+	RestoreMaxMB   int  // upload size cap for restores
+
+	// Multi-tenancy
+	TenantTokens    string // "token=tenant,..." or a JSON file path; empty leaves multi-tenancy off
+	SuperAdminToken string // reads every tenant and calls instance-wide admin routes
+
+	// Demo mode (APP_ENV=demo or --demo): throwaway storage fed by simulated services
+	Demo     bool
+	DemoRate float64 // simulated checkouts per second
+
+	// Anomaly detection (rate of change against a rolling baseline)
+	AnomalyEvalInterval string  // e.g. "1m"
+	AnomalySigma        float64 // K: deviation in standard deviations
+	AnomalyConsecutive  int     // M: deviating intervals in a row before an event fires
+	AnomalyMinSamples   int     // baseline intervals required before a service is evaluated
+
+	// Service map history
+	ServiceMapSnapshotInterval      string // e.g. "5m"; "0" disables snapshots
+	ServiceMapSnapshotRetentionDays int    // kept independently of HOT_RETENTION_DAYS
+
+	// Trace completeness: a reconciler marks settled traces complete or partial
+	TraceCompletenessInterval string // e.g. "1m"; "0" disables the reconciler
+	TraceCompletenessDelay    string // how long a trace must go without new spans before it is checked
+
+	// Dependency health: when GET /api/services/{name}/dependencies flags a dependency
+	DependencyErrorRateDelta float64 // error rate rise (0-1) against the previous window
+	DependencyLatencyChange  float64 // relative p95 rise, e.g. 0.5 = +50%
+	DependencyMinCalls       int     // calls in the current window before anything is flagged
+
+	// AI insight feedback: unhelpful ratings of an error fingerprint before its logs are
+	// no longer analyzed (0 = never suppress)
+	AISuppressAfter int
+
+	// IANA time zone in which traffic buckets, latency histograms and the daily report
+	// place their hour and day boundaries; a request's ?tz= overrides it. Storage is UTC.
+	DisplayTimezone string
+
+	// Daily report (delivered by webhook and/or SMTP)
+	ReportSchedule   string // cron expression in UTC, e.g. "0 7 * * *"; "" disables scheduled reports
+	ReportWebhookURL string
+	ReportRetries    int // extra delivery attempts after a failure
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPFrom         string
+	SMTPTo           string // comma-separated recipients
+
+	// Outbox: anomaly and SLO breach notifications, delivered to /ws/events and a webhook
+	OutboxInterval      string // how often undelivered events are retried, e.g. "2s"
+	OutboxMaxAttempts   int    // failed deliveries before an event is dead
+	OutboxWebhookURL    string // "" = broadcast only
+	OutboxWebhookEvents string // comma-separated event types POSTed; "" = all
+
+	// Log bridge: consume JSON logs from a NATS JetStream stream or Kafka topics
+	BridgeNATSURL       string // nats:// or tls://[user:password@]host:port; "" = no NATS source
+	BridgeNATSCreds     string // JWT credentials file ("" = none)
+	BridgeNATSNKey      string // NKey seed file ("" = none)
+	BridgeNATSCA        string // PEM file of roots to verify the server with ("" = system roots)
+	BridgeNATSStream    string
+	BridgeNATSConsumer  string // durable pull consumer, created if missing
+	BridgeNATSSubject   string // consumer filter subject; "" = the whole stream
+	BridgeKafkaBrokers  string // comma-separated host:port seed brokers; "" = no Kafka source
+	BridgeKafkaTopics   string // comma-separated
+	BridgeKafkaGroup    string // consumer group; offsets are committed once stored
+	BridgeKafkaTLS      bool
+	BridgeKafkaCA       string // PEM file of roots to verify the brokers with ("" = system roots)
+	BridgeKafkaSASL     string // "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512" ("" = none)
+	BridgeKafkaUsername string
+	BridgeKafkaPassword string
+	BridgeMapping       string // "logrus" (default) or "zap", then field=path overrides
+	BridgeBatchSize     int    // messages stored per insert
+	BridgeFlushInterval string // a partial batch is stored after this long, e.g. "1s"
+
 	// DevMode disables origin checks for WebSocket and enables dev-friendly defaults.
-	// Derived from APP_ENV == "development".
+	// Derived from APP_ENV == "development" or "demo".
 	DevMode bool
 }
 
@@ -91,8 +256,9 @@ func Load(customPath string) (*Config, error) {
 	env := getEnv("APP_ENV", "development")
 	return &Config{
 		Env:               env,
-		DevMode:           env == "development",
+		DevMode:           env == "development" || env == "demo",
 		LogLevel:          getEnv("LOG_LEVEL", "INFO"),
+		PprofEnabled:      getEnvBool("PPROF_ENABLED", false),
 		HTTPPort:          getEnv("HTTP_PORT", "8080"),
 		GRPCPort:          getEnv("GRPC_PORT", "4317"),
 		DBDriver:          getEnv("DB_DRIVER", "sqlite"),
@@ -103,11 +269,38 @@ func Load(customPath string) (*Config, error) {
 		IngestMinSeverity:      getEnv("INGEST_MIN_SEVERITY", "INFO"),
 		IngestAllowedServices:  getEnv("INGEST_ALLOWED_SERVICES", ""),
 		IngestExcludedServices: getEnv("INGEST_EXCLUDED_SERVICES", ""),
+		IngestServiceAliases:   getEnv("INGEST_SERVICE_ALIASES", ""),
+		IngestDefaultEnv:       getEnv("INGEST_DEFAULT_ENVIRONMENT", ""),
+		IngestConfigFile:       getEnv("INGEST_CONFIG_FILE", ""),
+		IngestDeriveREDMetrics: getEnvBool("INGEST_DERIVE_RED_METRICS", false),
+		IngestDedupeStatusLogs: getEnvBool("INGEST_DEDUPE_STATUS_LOGS", false),
+		LogCollapseWindow:      getEnv("LOG_COLLAPSE_WINDOW", "0"),
+		LogCollapseMaxKeys:     getEnvInt("LOG_COLLAPSE_MAX_KEYS", 10000),
+		LogMaxBodyBytes:        getEnvInt("LOG_MAX_BODY_BYTES", 64<<10),
+		LogDispatchQueueSize:   getEnvInt("LOG_DISPATCH_QUEUE_SIZE", 1024),
+		TraceMaxSpans:          getEnvInt("TRACE_MAX_SPANS", 5000),
+		TraceMaxSpansTracked:   getEnvInt("TRACE_MAX_SPANS_TRACKED", 50000),
 
 		// DB Connection Pool
 		DBMaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 50),
 		DBMaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 10),
 		DBConnMaxLifetime: getEnv("DB_CONN_MAX_LIFETIME", "1h"),
+		DBQueryTimeout:    getEnv("DB_QUERY_TIMEOUT", "30s"),
+
+		// Slow query log
+		DBSlowQueryThreshold: getEnv("DB_SLOW_QUERY_THRESHOLD", "250ms"),
+		DBSlowQueryLogSize:   getEnvInt("DB_SLOW_QUERY_LOG_SIZE", 200),
+
+		// Read replica
+		DBReadDSN:    getEnv("DB_READ_DSN", ""),
+		DBReadMaxLag: getEnv("DB_READ_MAX_LAG", "30s"),
+
+		// Insert batching
+		DBBatchSize:          getEnvInt("DB_BATCH_SIZE", 0),
+		DBBatchAdaptive:      getEnvBool("DB_BATCH_ADAPTIVE", false),
+		DBBatchMinSize:       getEnvInt("DB_BATCH_MIN_SIZE", 50),
+		DBBatchMaxSize:       getEnvInt("DB_BATCH_MAX_SIZE", 5000),
+		DBBatchTargetLatency: getEnv("DB_BATCH_TARGET_LATENCY", "250ms"),
 
 		// Hot/Cold Storage
 		HotRetentionDays:    getEnvInt("HOT_RETENTION_DAYS", 7),
@@ -115,6 +308,22 @@ func Load(customPath string) (*Config, error) {
 		ColdStorageMaxGB:    getEnvInt("COLD_STORAGE_MAX_GB", 50),
 		ArchiveScheduleHour: getEnvInt("ARCHIVE_SCHEDULE_HOUR", 2),
 		ArchiveBatchSize:    getEnvInt("ARCHIVE_BATCH_SIZE", 10000),
+		AuditRetentionDays:  getEnvInt("AUDIT_RETENTION_DAYS", 90),
+
+		// Pre-purge trace archive
+		ArchiveEnabled:     getEnvBool("ARCHIVE_ENABLED", false),
+		ArchivePath:        getEnv("ARCHIVE_PATH", "./data/archive"),
+		ArchiveS3Endpoint:  getEnv("ARCHIVE_S3_ENDPOINT", ""),
+		ArchiveS3Bucket:    getEnv("ARCHIVE_S3_BUCKET", ""),
+		ArchiveS3Prefix:    getEnv("ARCHIVE_S3_PREFIX", ""),
+		ArchiveS3Region:    getEnv("ARCHIVE_S3_REGION", "us-east-1"),
+		ArchiveS3AccessKey: getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+		ArchiveS3SecretKey: getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+
+		// Admin purge
+		PurgeBatchSize:   getEnvInt("PURGE_BATCH_SIZE", 10000),
+		PurgeBatchPause:  getEnv("PURGE_BATCH_PAUSE", "100ms"),
+		PurgeSyncMaxRows: getEnvInt("PURGE_SYNC_MAX_ROWS", 50000),
 
 		// TSDB
 		TSDBRingBufferDuration: getEnv("TSDB_RING_BUFFER_DURATION", "1h"),
@@ -126,7 +335,12 @@ func Load(customPath string) (*Config, error) {
 
 		// Cardinality
 		MetricAttributeKeys:  getEnv("METRIC_ATTRIBUTE_KEYS", ""),
+		LogIndexedAttributes: getEnv("LOG_INDEXED_ATTRIBUTES", ""),
 		MetricMaxCardinality: getEnvInt("METRIC_MAX_CARDINALITY", 10000),
+		MetricMaxSeries:      getEnvInt("METRIC_MAX_SERIES_PER_METRIC", 1000),
+		MetricSeriesLimits:   getEnv("METRIC_SERIES_LIMITS", ""),
+		MetricMaxFutureSkew:  getEnv("METRIC_MAX_FUTURE_SKEW", "1h"),
+		MetricMaxExemplars:   getEnvInt("METRIC_MAX_EXEMPLARS", 3),
 
 		// DLQ
 		DLQMaxFiles:   getEnvInt("DLQ_MAX_FILES", 1000),
@@ -134,7 +348,12 @@ func Load(customPath string) (*Config, error) {
 		DLQMaxRetries: getEnvInt("DLQ_MAX_RETRIES", 10),
 
 		// API
-		APIRateLimitRPS: getEnvInt("API_RATE_LIMIT_RPS", 100),
+		APIRateLimitRPS:         getEnvInt("API_RATE_LIMIT_RPS", 0),
+		APIRateLimitBurst:       getEnvInt("API_RATE_LIMIT_BURST", 0),
+		APIMaxConcurrent:        getEnvInt("API_MAX_CONCURRENT", 0),
+		APIConcurrencyQueueWait: getEnv("API_CONCURRENCY_QUEUE_WAIT", "2s"),
+		APIGzipMinBytes:         getEnvInt("API_GZIP_MIN_BYTES", 1024),
+		APIMaxTimeRange:         getEnv("API_MAX_TIME_RANGE", "720h"),
 
 		// MCP
 		MCPEnabled: getEnvBool("MCP_ENABLED", true),
@@ -145,6 +364,110 @@ func Load(customPath string) (*Config, error) {
 
 		// Vector
 		VectorIndexMaxEntries: getEnvInt("VECTOR_INDEX_MAX_ENTRIES", 100000),
+
+		// SLO
+		SLOEvalInterval: getEnv("SLO_EVAL_INTERVAL", "1m"),
+
+		// Dashboard cache
+		DashboardCacheTTL: getEnv("DASHBOARD_CACHE_TTL", "5s"),
+
+		// Live snapshots
+		LiveSnapshotWorkers: getEnvInt("LIVE_SNAPSHOT_WORKERS", 4),
+		LiveSnapshotBudget:  getEnv("LIVE_SNAPSHOT_BUDGET", "4s"),
+		LiveIdleRefresh:     getEnvInt("LIVE_IDLE_REFRESH_TICKS", 6),
+		LiveReplaySize:      getEnvInt("LIVE_REPLAY_SIZE", 256),
+		LiveReplayMaxAge:    getEnv("LIVE_REPLAY_MAX_AGE", "5m"),
+
+		// WebSocket keepalive
+		WSPingInterval: getEnv("WS_PING_INTERVAL", "30s"),
+		WSIdleTimeout:  getEnv("WS_IDLE_TIMEOUT", "90s"),
+
+		// Quotas
+		QuotaPersistInterval: getEnv("QUOTA_PERSIST_INTERVAL", "30s"),
+
+		// Service liveness
+		ServiceStaleAfter:       getEnv("SERVICE_STALE_AFTER", "5m"),
+		ServiceRecoverAfter:     getEnv("SERVICE_RECOVER_AFTER", "1m"),
+		LivenessPersistInterval: getEnv("LIVENESS_PERSIST_INTERVAL", "30s"),
+
+		// Import
+		ImportMaxMB: getEnvInt("IMPORT_MAX_MB", 256),
+
+		// Trace forwarding
+		TraceForwardEndpoints: getEnv("TRACE_FORWARD_ENDPOINTS", ""),
+		TraceForwardTimeout:   getEnv("TRACE_FORWARD_TIMEOUT", "10s"),
+
+		// Backup & restore
+		RestoreEnabled: getEnvBool("RESTORE_ENABLED", false),
+		RestoreMaxMB:   getEnvInt("RESTORE_MAX_MB", 10240),
+
+		// Multi-tenancy
+		TenantTokens:    getEnv("TENANT_TOKENS", ""),
+		SuperAdminToken: getEnv("SUPER_ADMIN_TOKEN", ""),
+
+		// Demo mode
+		Demo:     env == "demo",
+		DemoRate: getEnvFloat("DEMO_RATE", 5),
+
+		// Anomaly detection
+		AnomalyEvalInterval: getEnv("ANOMALY_EVAL_INTERVAL", "1m"),
+		AnomalySigma:        getEnvFloat("ANOMALY_SIGMA", 3),
+		AnomalyConsecutive:  getEnvInt("ANOMALY_CONSECUTIVE", 3),
+		AnomalyMinSamples:   getEnvInt("ANOMALY_MIN_SAMPLES", 15),
+
+		// Service map history
+		ServiceMapSnapshotInterval:      getEnv("SERVICE_MAP_SNAPSHOT_INTERVAL", "5m"),
+		ServiceMapSnapshotRetentionDays: getEnvInt("SERVICE_MAP_SNAPSHOT_RETENTION_DAYS", 90),
+
+		// Trace completeness
+		TraceCompletenessInterval: getEnv("TRACE_COMPLETENESS_INTERVAL", "1m"),
+		TraceCompletenessDelay:    getEnv("TRACE_COMPLETENESS_DELAY", "3m"),
+
+		// Dependency health
+		DependencyErrorRateDelta: getEnvFloat("DEPENDENCY_ERROR_RATE_DELTA", 0.05),
+		DependencyLatencyChange:  getEnvFloat("DEPENDENCY_LATENCY_CHANGE", 0.5),
+		DependencyMinCalls:       getEnvInt("DEPENDENCY_MIN_CALLS", 10),
+
+		AISuppressAfter: getEnvInt("AI_SUPPRESS_AFTER", 3),
+
+		DisplayTimezone: getEnv("DISPLAY_TIMEZONE", "UTC"),
+
+		// Daily report
+		ReportSchedule:   getEnv("REPORT_SCHEDULE", ""),
+		ReportWebhookURL: getEnv("REPORT_WEBHOOK_URL", ""),
+		ReportRetries:    getEnvInt("REPORT_RETRIES", 3),
+		SMTPHost:         getEnv("SMTP_HOST", ""),
+		SMTPPort:         getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:         getEnv("SMTP_FROM", ""),
+		SMTPTo:           getEnv("SMTP_TO", ""),
+
+		// Outbox
+		OutboxInterval:      getEnv("OUTBOX_INTERVAL", "2s"),
+		OutboxMaxAttempts:   getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		OutboxWebhookURL:    getEnv("OUTBOX_WEBHOOK_URL", ""),
+		OutboxWebhookEvents: getEnv("OUTBOX_WEBHOOK_EVENTS", ""),
+
+		// Log bridge
+		BridgeNATSURL:       getEnv("BRIDGE_NATS_URL", ""),
+		BridgeNATSCreds:     getEnv("BRIDGE_NATS_CREDS", ""),
+		BridgeNATSNKey:      getEnv("BRIDGE_NATS_NKEY", ""),
+		BridgeNATSCA:        getEnv("BRIDGE_NATS_CA", ""),
+		BridgeNATSStream:    getEnv("BRIDGE_NATS_STREAM", ""),
+		BridgeNATSConsumer:  getEnv("BRIDGE_NATS_CONSUMER", "otelcontext"),
+		BridgeNATSSubject:   getEnv("BRIDGE_NATS_SUBJECT", ""),
+		BridgeKafkaBrokers:  getEnv("BRIDGE_KAFKA_BROKERS", ""),
+		BridgeKafkaTopics:   getEnv("BRIDGE_KAFKA_TOPICS", ""),
+		BridgeKafkaGroup:    getEnv("BRIDGE_KAFKA_GROUP", "otelcontext"),
+		BridgeKafkaTLS:      getEnvBool("BRIDGE_KAFKA_TLS", false),
+		BridgeKafkaCA:       getEnv("BRIDGE_KAFKA_CA", ""),
+		BridgeKafkaSASL:     getEnv("BRIDGE_KAFKA_SASL", ""),
+		BridgeKafkaUsername: getEnv("BRIDGE_KAFKA_USERNAME", ""),
+		BridgeKafkaPassword: getEnv("BRIDGE_KAFKA_PASSWORD", ""),
+		BridgeMapping:       getEnv("BRIDGE_MAPPING", "logrus"),
+		BridgeBatchSize:     getEnvInt("BRIDGE_BATCH_SIZE", 500),
+		BridgeFlushInterval: getEnv("BRIDGE_FLUSH_INTERVAL", "1s"),
 	}, nil
 }
 
@@ -182,6 +505,20 @@ func getEnvBool(key string, fallback bool) bool {
 	return fallback
 }
 
+// UseDemoStorage points the database, DLQ and archives at dir, so a demo run leaves
+// nothing behind once dir is removed. The database is a SQLite file rather than
+// :memory:, which would limit the pool to a single connection.
+func (c *Config) UseDemoStorage(dir string) {
+	c.Demo = true
+	c.DevMode = true
+	c.DBDriver = "sqlite"
+	c.DBDSN = filepath.Join(dir, "demo.db")
+	c.DLQPath = filepath.Join(dir, "dlq")
+	c.ColdStoragePath = filepath.Join(dir, "cold")
+	c.ArchivePath = filepath.Join(dir, "archive")
+	c.IngestConfigFile = ""
+}
+
 // Validate checks that all configuration values are within valid ranges.
 // Call this once after Load() during startup to catch misconfiguration early.
 func (c *Config) Validate() error {
@@ -208,24 +545,200 @@ func (c *Config) Validate() error {
 	if c.HotRetentionDays < 1 {
 		return fmt.Errorf("HOT_RETENTION_DAYS must be >= 1, got %d", c.HotRetentionDays)
 	}
+	if c.AuditRetentionDays < 1 {
+		return fmt.Errorf("AUDIT_RETENTION_DAYS must be >= 1, got %d", c.AuditRetentionDays)
+	}
 	if c.ArchiveScheduleHour < 0 || c.ArchiveScheduleHour > 23 {
 		return fmt.Errorf("ARCHIVE_SCHEDULE_HOUR must be 0-23, got %d", c.ArchiveScheduleHour)
 	}
+	if len(c.IngestDefaultEnv) > 64 {
+		return fmt.Errorf("INGEST_DEFAULT_ENVIRONMENT must be at most 64 bytes, got %d", len(c.IngestDefaultEnv))
+	}
+	if c.TraceMaxSpans < 0 {
+		return fmt.Errorf("TRACE_MAX_SPANS must be >= 0, got %d", c.TraceMaxSpans)
+	}
+	if c.TraceMaxSpansTracked < 1 {
+		return fmt.Errorf("TRACE_MAX_SPANS_TRACKED must be >= 1, got %d", c.TraceMaxSpansTracked)
+	}
+	if c.PurgeBatchSize < 1 {
+		return fmt.Errorf("PURGE_BATCH_SIZE must be >= 1, got %d", c.PurgeBatchSize)
+	}
+	if c.PurgeSyncMaxRows < 0 {
+		return fmt.Errorf("PURGE_SYNC_MAX_ROWS must be >= 0, got %d", c.PurgeSyncMaxRows)
+	}
+	if d, err := time.ParseDuration(c.PurgeBatchPause); err != nil || d < 0 {
+		return fmt.Errorf("invalid PURGE_BATCH_PAUSE %q: must be a duration >= 0, e.g. 100ms", c.PurgeBatchPause)
+	}
 	if c.MetricMaxCardinality < 0 {
 		return fmt.Errorf("METRIC_MAX_CARDINALITY must be >= 0, got %d", c.MetricMaxCardinality)
 	}
+	if c.MetricMaxSeries < 0 {
+		return fmt.Errorf("METRIC_MAX_SERIES_PER_METRIC must be >= 0, got %d", c.MetricMaxSeries)
+	}
+	if c.MetricMaxExemplars < 0 {
+		return fmt.Errorf("METRIC_MAX_EXEMPLARS must be >= 0, got %d", c.MetricMaxExemplars)
+	}
 	if c.SamplingRate < 0 || c.SamplingRate > 1.0 {
 		return fmt.Errorf("SAMPLING_RATE must be between 0 and 1, got %f", c.SamplingRate)
 	}
+	if !(c.DemoRate > 0 && c.DemoRate <= 1000) {
+		return fmt.Errorf("DEMO_RATE must be above 0 and at most 1000, got %g", c.DemoRate)
+	}
+	if c.LiveSnapshotWorkers < 1 {
+		return fmt.Errorf("LIVE_SNAPSHOT_WORKERS must be >= 1, got %d", c.LiveSnapshotWorkers)
+	}
+	if d, err := time.ParseDuration(c.LiveSnapshotBudget); err != nil || d <= 0 {
+		return fmt.Errorf("invalid LIVE_SNAPSHOT_BUDGET %q: must be a positive duration, e.g. 4s", c.LiveSnapshotBudget)
+	}
+	if c.LiveIdleRefresh < 0 {
+		return fmt.Errorf("LIVE_IDLE_REFRESH_TICKS must be >= 0, got %d", c.LiveIdleRefresh)
+	}
+	if c.LiveReplaySize < 0 {
+		return fmt.Errorf("LIVE_REPLAY_SIZE must be >= 0, got %d", c.LiveReplaySize)
+	}
+	if d, err := time.ParseDuration(c.LiveReplayMaxAge); err != nil || d <= 0 {
+		return fmt.Errorf("invalid LIVE_REPLAY_MAX_AGE %q: must be a positive duration, e.g. 5m", c.LiveReplayMaxAge)
+	}
+	pingInterval, err := time.ParseDuration(c.WSPingInterval)
+	if err != nil || pingInterval < 0 {
+		return fmt.Errorf("invalid WS_PING_INTERVAL %q: must be a non-negative duration, e.g. 30s", c.WSPingInterval)
+	}
+	if d, err := time.ParseDuration(c.WSIdleTimeout); err != nil || pingInterval > 0 && d <= pingInterval {
+		return fmt.Errorf("invalid WS_IDLE_TIMEOUT %q: must be a duration longer than WS_PING_INTERVAL, e.g. 90s", c.WSIdleTimeout)
+	}
+	if c.AnomalySigma <= 0 {
+		return fmt.Errorf("ANOMALY_SIGMA must be > 0, got %f", c.AnomalySigma)
+	}
+	if c.AnomalyConsecutive < 1 {
+		return fmt.Errorf("ANOMALY_CONSECUTIVE must be >= 1, got %d", c.AnomalyConsecutive)
+	}
+	if d, err := time.ParseDuration(c.ServiceMapSnapshotInterval); err != nil || d < 0 {
+		return fmt.Errorf("invalid SERVICE_MAP_SNAPSHOT_INTERVAL %q: must be a duration >= 0, e.g. 5m", c.ServiceMapSnapshotInterval)
+	}
+	if c.ServiceMapSnapshotRetentionDays < 1 {
+		return fmt.Errorf("SERVICE_MAP_SNAPSHOT_RETENTION_DAYS must be >= 1, got %d", c.ServiceMapSnapshotRetentionDays)
+	}
+	if d, err := time.ParseDuration(c.TraceCompletenessInterval); err != nil || d < 0 {
+		return fmt.Errorf("invalid TRACE_COMPLETENESS_INTERVAL %q: must be a duration >= 0, e.g. 1m", c.TraceCompletenessInterval)
+	}
+	if d, err := time.ParseDuration(c.TraceCompletenessDelay); err != nil || d < 0 {
+		return fmt.Errorf("invalid TRACE_COMPLETENESS_DELAY %q: must be a duration >= 0, e.g. 3m", c.TraceCompletenessDelay)
+	}
+	if c.DependencyErrorRateDelta < 0 || c.DependencyErrorRateDelta > 1 {
+		return fmt.Errorf("DEPENDENCY_ERROR_RATE_DELTA must be between 0 and 1, got %f", c.DependencyErrorRateDelta)
+	}
+	if c.DependencyLatencyChange < 0 {
+		return fmt.Errorf("DEPENDENCY_LATENCY_CHANGE must be >= 0, got %f", c.DependencyLatencyChange)
+	}
+	if c.AISuppressAfter < 0 {
+		return fmt.Errorf("AI_SUPPRESS_AFTER must be >= 0, got %d", c.AISuppressAfter)
+	}
+	if d, err := time.ParseDuration(c.ServiceStaleAfter); err != nil || d < 0 {
+		return fmt.Errorf("invalid SERVICE_STALE_AFTER %q: must be a duration >= 0, e.g. 5m", c.ServiceStaleAfter)
+	}
+	if d, err := time.ParseDuration(c.ServiceRecoverAfter); err != nil || d < 0 {
+		return fmt.Errorf("invalid SERVICE_RECOVER_AFTER %q: must be a duration >= 0, e.g. 1m", c.ServiceRecoverAfter)
+	}
+	if d, err := time.ParseDuration(c.LivenessPersistInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid LIVENESS_PERSIST_INTERVAL %q: must be a positive duration, e.g. 30s", c.LivenessPersistInterval)
+	}
+	if d, err := time.ParseDuration(c.OutboxInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid OUTBOX_INTERVAL %q: must be a positive duration, e.g. 2s", c.OutboxInterval)
+	}
+	if c.TraceForwardEndpoints != "" {
+		for _, e := range strings.Split(c.TraceForwardEndpoints, ",") {
+			if _, _, err := net.SplitHostPort(strings.TrimSpace(e)); err != nil {
+				return fmt.Errorf("invalid TRACE_FORWARD_ENDPOINTS entry %q: must be host:port", e)
+			}
+		}
+	}
+	if d, err := time.ParseDuration(c.TraceForwardTimeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid TRACE_FORWARD_TIMEOUT %q: must be a positive duration, e.g. 10s", c.TraceForwardTimeout)
+	}
+	if c.OutboxMaxAttempts < 1 {
+		return fmt.Errorf("OUTBOX_MAX_ATTEMPTS must be >= 1, got %d", c.OutboxMaxAttempts)
+	}
+	if c.BridgeNATSURL != "" && c.BridgeNATSStream == "" {
+		return fmt.Errorf("BRIDGE_NATS_STREAM is required with BRIDGE_NATS_URL")
+	}
+	if c.BridgeKafkaBrokers != "" {
+		if c.BridgeNATSURL != "" {
+			return fmt.Errorf("BRIDGE_NATS_URL and BRIDGE_KAFKA_BROKERS are exclusive: the bridge reads from one broker")
+		}
+		if c.BridgeKafkaTopics == "" {
+			return fmt.Errorf("BRIDGE_KAFKA_TOPICS is required with BRIDGE_KAFKA_BROKERS")
+		}
+		switch strings.ToUpper(c.BridgeKafkaSASL) {
+		case "", "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		default:
+			return fmt.Errorf("invalid BRIDGE_KAFKA_SASL %q: must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", c.BridgeKafkaSASL)
+		}
+		if c.BridgeKafkaSASL != "" && c.BridgeKafkaUsername == "" {
+			return fmt.Errorf("BRIDGE_KAFKA_USERNAME is required with BRIDGE_KAFKA_SASL")
+		}
+	}
+	if c.BridgeBatchSize < 1 {
+		return fmt.Errorf("BRIDGE_BATCH_SIZE must be >= 1, got %d", c.BridgeBatchSize)
+	}
+	if d, err := time.ParseDuration(c.BridgeFlushInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid BRIDGE_FLUSH_INTERVAL %q: must be a positive duration, e.g. 1s", c.BridgeFlushInterval)
+	}
+	if _, err := time.LoadLocation(c.DisplayTimezone); err != nil {
+		return fmt.Errorf("invalid DISPLAY_TIMEZONE %q: %w", c.DisplayTimezone, err)
+	}
+	if c.ReportRetries < 0 {
+		return fmt.Errorf("REPORT_RETRIES must be >= 0, got %d", c.ReportRetries)
+	}
+	if c.SMTPHost != "" && (c.SMTPFrom == "" || c.SMTPTo == "") {
+		return fmt.Errorf("SMTP_HOST is set but SMTP_FROM or SMTP_TO is empty")
+	}
 	if c.APIRateLimitRPS < 0 {
 		return fmt.Errorf("API_RATE_LIMIT_RPS must be >= 0, got %d", c.APIRateLimitRPS)
 	}
+	if c.APIRateLimitBurst < 0 {
+		return fmt.Errorf("API_RATE_LIMIT_BURST must be >= 0, got %d", c.APIRateLimitBurst)
+	}
+	if c.APIMaxConcurrent < 0 {
+		return fmt.Errorf("API_MAX_CONCURRENT must be >= 0, got %d", c.APIMaxConcurrent)
+	}
+	if d, err := time.ParseDuration(c.APIConcurrencyQueueWait); err != nil || d < 0 {
+		return fmt.Errorf("invalid API_CONCURRENCY_QUEUE_WAIT %q: must be a duration >= 0, e.g. 2s", c.APIConcurrencyQueueWait)
+	}
+	if c.APIGzipMinBytes < 0 {
+		return fmt.Errorf("API_GZIP_MIN_BYTES must be >= 0, got %d", c.APIGzipMinBytes)
+	}
+	if d, err := time.ParseDuration(c.APIMaxTimeRange); err != nil || d < 0 {
+		return fmt.Errorf("invalid API_MAX_TIME_RANGE %q: must be a duration >= 0, e.g. 720h", c.APIMaxTimeRange)
+	}
 	if c.DBMaxOpenConns < 1 {
 		return fmt.Errorf("DB_MAX_OPEN_CONNS must be >= 1, got %d", c.DBMaxOpenConns)
 	}
 	if c.DBMaxIdleConns < 0 {
 		return fmt.Errorf("DB_MAX_IDLE_CONNS must be >= 0, got %d", c.DBMaxIdleConns)
 	}
+	if d, err := time.ParseDuration(c.DBQueryTimeout); err != nil || d < 0 {
+		return fmt.Errorf("invalid DB_QUERY_TIMEOUT %q: must be a duration >= 0, e.g. 30s", c.DBQueryTimeout)
+	}
+	if d, err := time.ParseDuration(c.DBSlowQueryThreshold); err != nil || d < 0 {
+		return fmt.Errorf("invalid DB_SLOW_QUERY_THRESHOLD %q: must be a duration >= 0, e.g. 250ms", c.DBSlowQueryThreshold)
+	}
+	if c.DBSlowQueryLogSize < 1 {
+		return fmt.Errorf("DB_SLOW_QUERY_LOG_SIZE must be >= 1, got %d", c.DBSlowQueryLogSize)
+	}
+	if d, err := time.ParseDuration(c.DBReadMaxLag); err != nil || d <= 0 {
+		return fmt.Errorf("invalid DB_READ_MAX_LAG %q: must be a positive duration, e.g. 30s", c.DBReadMaxLag)
+	}
+	if c.DBBatchSize < 0 {
+		return fmt.Errorf("DB_BATCH_SIZE must be >= 0, got %d", c.DBBatchSize)
+	}
+	if c.DBBatchAdaptive {
+		if c.DBBatchMinSize < 1 || c.DBBatchMaxSize < c.DBBatchMinSize {
+			return fmt.Errorf("DB_BATCH_MIN_SIZE and DB_BATCH_MAX_SIZE must satisfy 1 <= min <= max, got %d and %d", c.DBBatchMinSize, c.DBBatchMaxSize)
+		}
+		if d, err := time.ParseDuration(c.DBBatchTargetLatency); err != nil || d <= 0 {
+			return fmt.Errorf("invalid DB_BATCH_TARGET_LATENCY %q: must be a positive duration, e.g. 250ms", c.DBBatchTargetLatency)
+		}
+	}
 
 	// Compression level
 	switch strings.ToLower(c.CompressionLevel) {
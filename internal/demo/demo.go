@@ -0,0 +1,390 @@
+// Package demo feeds a running instance with simulated traffic so it can be tried
+// without instrumenting anything. A handful of fake services handle a checkout flow
+// with the chaos of the services under test/: injected order latency, rejected auth
+// tokens, payment gateway timeouts and inventory lock contention. Requests are built
+// from the OTLP protobuf types and handed to the ingest servers in-process, so live
+// streams, callbacks and derived metrics behave as they would for real senders.
+//
+// Every simulated request is derived from the seed and its own index; tests can
+// build one with Build and rely on its contents.
+package demo
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// ServicePrefix starts the name of every simulated service, so demo data is easy to
+// tell apart and purge.
+const ServicePrefix = "demo-"
+
+const (
+	frontend  = ServicePrefix + "frontend"
+	order     = ServicePrefix + "order"
+	auth      = ServicePrefix + "auth"
+	payment   = ServicePrefix + "payment"
+	inventory = ServicePrefix + "inventory"
+)
+
+// Services are the simulated services, in call order.
+var Services = []string{frontend, auth, order, inventory, payment}
+
+// MaxRate is the highest rate a generator sends at, in checkouts per second.
+const MaxRate = 1000
+
+// scopeName is the instrumentation scope stamped on generated telemetry.
+const scopeName = "github.com/RandomCodeSpace/otelcontext/internal/demo"
+
+// Exporters receive the generated requests; the OTLP ingest servers satisfy them.
+type Exporters struct {
+	Traces  coltracepb.TraceServiceServer
+	Logs    collogspb.LogsServiceServer
+	Metrics colmetricspb.MetricsServiceServer
+}
+
+// Status describes the generator for the admin API.
+type Status struct {
+	Running  bool     `json:"running"`
+	Rate     float64  `json:"rate"`     // simulated checkouts per second
+	Requests uint64   `json:"requests"` // simulated checkouts sent so far
+	Failed   int64    `json:"failed_exports"`
+	Services []string `json:"services"`
+}
+
+// Generator sends simulated checkouts at a fixed rate until stopped. It can be
+// stopped and started again; the request index carries on where it left off.
+type Generator struct {
+	exp    Exporters
+	seed   uint64
+	rate   float64
+	next   atomic.Uint64
+	failed atomic.Int64
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // nil while stopped
+	done   chan struct{}
+}
+
+// New creates a stopped generator sending rate checkouts per second (at least one,
+// at most MaxRate).
+func New(exp Exporters, seed uint64, rate float64) *Generator {
+	if !(rate > 0) {
+		rate = 1
+	}
+	rate = min(rate, MaxRate)
+	return &Generator{exp: exp, seed: seed, rate: rate}
+}
+
+// Start begins sending in the background. It does nothing if already running.
+func (g *Generator) Start() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	g.done = make(chan struct{})
+	go g.run(ctx, g.done)
+}
+
+// Stop halts sending and waits for an in-flight checkout to finish.
+func (g *Generator) Stop() {
+	g.mu.Lock()
+	cancel, done := g.cancel, g.done
+	g.cancel = nil
+	g.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Status reports whether the generator runs and what it has sent.
+func (g *Generator) Status() Status {
+	g.mu.Lock()
+	running := g.cancel != nil
+	g.mu.Unlock()
+	return Status{
+		Running:  running,
+		Rate:     g.rate,
+		Requests: g.next.Load(),
+		Failed:   g.failed.Load(),
+		Services: Services,
+	}
+}
+
+func (g *Generator) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / g.rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			g.Send(ctx, now)
+		}
+	}
+}
+
+// Send builds the next checkout, timestamped at now, and exports it. Export
+// failures are counted rather than returned: a full ingest pipeline rejecting demo
+// traffic is not worth stopping for.
+func (g *Generator) Send(ctx context.Context, now time.Time) {
+	req := Build(g.seed, g.next.Add(1)-1, now)
+	if _, err := g.exp.Traces.Export(ctx, req.Traces); err != nil {
+		g.failed.Add(1)
+	}
+	if _, err := g.exp.Logs.Export(ctx, req.Logs); err != nil {
+		g.failed.Add(1)
+	}
+	if _, err := g.exp.Metrics.Export(ctx, req.Metrics); err != nil {
+		g.failed.Add(1)
+	}
+}
+
+// Request is one simulated checkout as OTLP export requests.
+type Request struct {
+	Traces  *coltracepb.ExportTraceServiceRequest
+	Logs    *collogspb.ExportLogsServiceRequest
+	Metrics *colmetricspb.ExportMetricsServiceRequest
+	Outcome string // "ok", or the step that failed
+}
+
+// checkout accumulates the spans, logs and metrics of one simulated request, grouped
+// by service.
+type checkout struct {
+	rng     *rand.Rand
+	traceID []byte
+	spans   map[string][]*tracepb.Span
+	logs    map[string][]*logspb.LogRecord
+}
+
+// Build generates checkout i of the given seed, starting at now. The frontend
+// verifies the caller with auth, then asks order to place the order; order reserves
+// stock with inventory and charges the card through payment. A failed step fails its
+// callers and ends the checkout.
+func Build(seed, i uint64, now time.Time) *Request {
+	c := &checkout{
+		rng:     rand.New(rand.NewPCG(seed, i)),
+		traceID: make([]byte, 16),
+		spans:   make(map[string][]*tracepb.Span),
+		logs:    make(map[string][]*logspb.LogRecord),
+	}
+	binary.BigEndian.PutUint64(c.traceID[:8], seed)
+	binary.BigEndian.PutUint64(c.traceID[8:], i+1)
+
+	user := fmt.Sprintf("user-%d", c.rng.IntN(500))
+	orderID := fmt.Sprintf("ORD-%d", c.rng.IntN(100000))
+	outcome := "ok"
+
+	root := c.span(frontend, nil, "POST /checkout", tracepb.Span_SPAN_KIND_SERVER, now)
+	root.Attributes = append(root.Attributes, strAttr("user.id", user))
+	c.log(frontend, root, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "checkout started for "+user)
+	t := now.Add(2 * time.Millisecond)
+
+	// Auth: 5% of tokens fail validation, as in test/authservice.
+	authSpan := c.span(auth, root, "auth.verify_token", tracepb.Span_SPAN_KIND_SERVER, t)
+	t = c.finish(authSpan, t, 20+c.rng.IntN(20))
+	if c.rng.IntN(100) < 5 {
+		c.fail(authSpan, "token signature invalid")
+		outcome = "auth"
+	}
+
+	if outcome == "ok" {
+		orderSpan := c.span(order, root, "order.create", tracepb.Span_SPAN_KIND_SERVER, t)
+		orderSpan.Attributes = append(orderSpan.Attributes, strAttr("order.id", orderID))
+		ot := t.Add(time.Millisecond)
+		// Order: 30% of requests get 100-800ms of injected latency, as in test/orderservice.
+		if c.rng.IntN(100) < 30 {
+			latency := time.Duration(100+c.rng.IntN(700)) * time.Millisecond
+			orderSpan.Events = append(orderSpan.Events, &tracepb.Span_Event{
+				Name:         "chaos_latency_injected",
+				TimeUnixNano: uint64(ot.UnixNano()),
+				Attributes:   []*commonpb.KeyValue{strAttr("latency", latency.String())},
+			})
+			ot = ot.Add(latency)
+		}
+
+		// Inventory: 5% hit a 2-5s table lock and time out, as in test/inventoryservice.
+		invSpan := c.span(inventory, orderSpan, "inventory.reserve", tracepb.Span_SPAN_KIND_SERVER, ot)
+		invSpan.Attributes = append(invSpan.Attributes, strAttr("sku", fmt.Sprintf("SKU-%d", c.rng.IntN(50000))))
+		if c.rng.IntN(100) < 5 {
+			lock := 2000 + c.rng.IntN(3000)
+			c.log(inventory, invSpan, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, "inventory_items table locked, waiting")
+			ot = c.finish(invSpan, ot, lock)
+			c.fail(invSpan, fmt.Sprintf("database lock timeout: inventory_items table locked for %dms", lock))
+			outcome = "inventory"
+		} else {
+			ot = c.finish(invSpan, ot, 15+c.rng.IntN(15))
+		}
+
+		// Payment: 10% of charges time out at the gateway, as in test/paymentservice.
+		if outcome == "ok" {
+			paySpan := c.span(payment, orderSpan, "payment.charge", tracepb.Span_SPAN_KIND_SERVER, ot)
+			ot = c.finish(paySpan, ot, 50+c.rng.IntN(150))
+			if c.rng.IntN(100) < 10 {
+				c.fail(paySpan, "gateway timeout: upstream payment provider unreachable")
+				outcome = "payment"
+			} else {
+				c.log(payment, paySpan, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "payment approved for "+orderID)
+			}
+		}
+
+		t = c.finish(orderSpan, ot, 1)
+		if outcome != "ok" {
+			c.fail(orderSpan, "order "+orderID+" failed at "+outcome)
+		} else {
+			c.log(order, orderSpan, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "order "+orderID+" placed")
+		}
+	}
+
+	c.finish(root, t, 1)
+	if outcome != "ok" {
+		c.fail(root, "checkout failed")
+	}
+
+	return &Request{
+		Traces:  c.traceRequest(),
+		Logs:    c.logRequest(),
+		Metrics: metricRequest(c.rng, outcome, now),
+		Outcome: outcome,
+	}
+}
+
+// span opens a span of service starting at start; finish sets its end.
+func (c *checkout) span(service string, parent *tracepb.Span, name string, kind tracepb.Span_SpanKind, start time.Time) *tracepb.Span {
+	spanID := make([]byte, 8)
+	binary.BigEndian.PutUint64(spanID, c.rng.Uint64()|1)
+	s := &tracepb.Span{
+		TraceId:           c.traceID,
+		SpanId:            spanID,
+		Name:              name,
+		Kind:              kind,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK},
+	}
+	if parent != nil {
+		s.ParentSpanId = parent.SpanId
+	}
+	c.spans[service] = append(c.spans[service], s)
+	return s
+}
+
+// finish ends s ms milliseconds after from and returns the end time.
+func (c *checkout) finish(s *tracepb.Span, from time.Time, ms int) time.Time {
+	end := from.Add(time.Duration(ms) * time.Millisecond)
+	s.EndTimeUnixNano = uint64(end.UnixNano())
+	return end
+}
+
+// fail marks s as an error. Ingest synthesizes the ERROR log from the status.
+func (c *checkout) fail(s *tracepb.Span, msg string) {
+	s.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: msg}
+}
+
+func (c *checkout) log(service string, s *tracepb.Span, sev logspb.SeverityNumber, body string) {
+	text := "INFO"
+	if sev == logspb.SeverityNumber_SEVERITY_NUMBER_WARN {
+		text = "WARN"
+	}
+	c.logs[service] = append(c.logs[service], &logspb.LogRecord{
+		// Offset by the record count so two logs of one span never look like a retry.
+		TimeUnixNano:   s.StartTimeUnixNano + uint64(len(c.logs[service])),
+		SeverityText:   text,
+		SeverityNumber: sev,
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: body}},
+		TraceId:        c.traceID,
+		SpanId:         s.SpanId,
+	})
+}
+
+func (c *checkout) traceRequest() *coltracepb.ExportTraceServiceRequest {
+	req := &coltracepb.ExportTraceServiceRequest{}
+	for _, svc := range Services {
+		if spans := c.spans[svc]; len(spans) > 0 {
+			req.ResourceSpans = append(req.ResourceSpans, &tracepb.ResourceSpans{
+				Resource:   resource(svc),
+				ScopeSpans: []*tracepb.ScopeSpans{{Scope: &commonpb.InstrumentationScope{Name: scopeName}, Spans: spans}},
+			})
+		}
+	}
+	return req
+}
+
+func (c *checkout) logRequest() *collogspb.ExportLogsServiceRequest {
+	req := &collogspb.ExportLogsServiceRequest{}
+	for _, svc := range Services {
+		if logs := c.logs[svc]; len(logs) > 0 {
+			req.ResourceLogs = append(req.ResourceLogs, &logspb.ResourceLogs{
+				Resource:  resource(svc),
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: &commonpb.InstrumentationScope{Name: scopeName}, LogRecords: logs}},
+			})
+		}
+	}
+	return req
+}
+
+// metricRequest reports the checkout outcome from the frontend and a CPU reading
+// from every service.
+func metricRequest(rng *rand.Rand, outcome string, now time.Time) *colmetricspb.ExportMetricsServiceRequest {
+	ts := uint64(now.UnixNano())
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	for _, svc := range Services {
+		metrics := []*metricspb.Metric{{
+			Name: "demo.cpu.utilization",
+			Unit: "1",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{{
+				TimeUnixNano: ts,
+				Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.1 + 0.6*rng.Float64()},
+			}}}},
+		}}
+		if svc == frontend {
+			metrics = append(metrics, &metricspb.Metric{
+				Name: "demo.checkouts",
+				Unit: "{checkout}",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					IsMonotonic:            true,
+					DataPoints: []*metricspb.NumberDataPoint{{
+						TimeUnixNano: ts,
+						Value:        &metricspb.NumberDataPoint_AsInt{AsInt: 1},
+						Attributes:   []*commonpb.KeyValue{strAttr("outcome", outcome)},
+					}},
+				}},
+			})
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, &metricspb.ResourceMetrics{
+			Resource:     resource(svc),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: &commonpb.InstrumentationScope{Name: scopeName}, Metrics: metrics}},
+		})
+	}
+	return req
+}
+
+func resource(service string) *resourcepb.Resource {
+	return &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		strAttr("service.name", service),
+		strAttr("deployment.environment", "demo"),
+	}}
+}
+
+func strAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
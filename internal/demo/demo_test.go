@@ -0,0 +1,143 @@
+package demo
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBuildIsDeterministic(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for i := range uint64(50) {
+		a, b := Build(7, i, now), Build(7, i, now)
+		if !proto.Equal(a.Traces, b.Traces) || !proto.Equal(a.Logs, b.Logs) || !proto.Equal(a.Metrics, b.Metrics) {
+			t.Fatalf("checkout %d differs between builds", i)
+		}
+	}
+	if proto.Equal(Build(7, 0, now).Traces, Build(8, 0, now).Traces) {
+		t.Error("different seeds built the same checkout")
+	}
+}
+
+func TestBuildCoversTheChaos(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	outcomes := make(map[string]int)
+	for i := range uint64(1000) {
+		req := Build(1, i, now)
+		outcomes[req.Outcome]++
+
+		var root *tracepb.Span
+		for _, rs := range req.Traces.ResourceSpans {
+			service := rs.Resource.Attributes[0].Value.GetStringValue()
+			if !strings.HasPrefix(service, ServicePrefix) {
+				t.Fatalf("service %q lacks the %q prefix", service, ServicePrefix)
+			}
+			for _, s := range rs.ScopeSpans[0].Spans {
+				if s.EndTimeUnixNano < s.StartTimeUnixNano {
+					t.Fatalf("checkout %d: span %s ends before it starts", i, s.Name)
+				}
+				if len(s.ParentSpanId) == 0 {
+					root = s
+				}
+			}
+		}
+		failed := root.Status.Code == tracepb.Status_STATUS_CODE_ERROR
+		if failed != (req.Outcome != "ok") {
+			t.Fatalf("checkout %d: outcome %q but root status %v", i, req.Outcome, root.Status.Code)
+		}
+	}
+	for _, o := range []string{"ok", "auth", "inventory", "payment"} {
+		if outcomes[o] == 0 {
+			t.Errorf("no %q outcome in 1000 checkouts: %v", o, outcomes)
+		}
+	}
+	if outcomes["ok"] < 700 {
+		t.Errorf("only %d of 1000 checkouts succeeded", outcomes["ok"])
+	}
+}
+
+type countingExporter struct {
+	traces, logs, metrics atomic.Int64
+}
+
+func TestGeneratorStartStop(t *testing.T) {
+	var c countingExporter
+	g := New(Exporters{
+		Traces:  tracesServer{c: &c},
+		Logs:    logsServer{c: &c},
+		Metrics: metricsServer{c: &c},
+	}, 1, 200)
+
+	g.Start()
+	g.Start() // no second loop
+	deadline := time.Now().Add(5 * time.Second)
+	for c.traces.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !g.Status().Running {
+		t.Error("Status().Running = false while started")
+	}
+	g.Stop()
+
+	sent := c.traces.Load()
+	if sent < 3 {
+		t.Fatalf("sent %d checkouts, want at least 3", sent)
+	}
+	if st := g.Status(); st.Running || st.Requests != uint64(sent) {
+		t.Errorf("Status() = %+v after stop, want stopped with %d requests", st, sent)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if c.traces.Load() != sent || c.logs.Load() != sent || c.metrics.Load() != sent {
+		t.Errorf("exports after Stop: traces %d logs %d metrics %d, want %d each", c.traces.Load(), c.logs.Load(), c.metrics.Load(), sent)
+	}
+
+	g.Start()
+	g.Stop()
+	g.Stop() // stopping twice is harmless
+}
+
+type tracesServer struct {
+	coltracepb.UnimplementedTraceServiceServer
+	c *countingExporter
+}
+
+func (s tracesServer) Export(context.Context, *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.c.traces.Add(1)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type logsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	c *countingExporter
+}
+
+func (s logsServer) Export(context.Context, *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.c.logs.Add(1)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+type metricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	c *countingExporter
+}
+
+func (s metricsServer) Export(context.Context, *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.c.metrics.Add(1)
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestNewClampsRate(t *testing.T) {
+	for rate, want := range map[float64]float64{0: 1, -3: 1, 5: 5, 1e12: MaxRate} {
+		if got := New(Exporters{}, 1, rate).Status().Rate; got != want {
+			t.Errorf("New(rate %g) rate = %g, want %g", rate, got, want)
+		}
+	}
+}
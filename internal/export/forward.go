@@ -0,0 +1,111 @@
+package export
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultForwardTimeout bounds a forward when NewForwarder is given no timeout.
+const DefaultForwardTimeout = 10 * time.Second
+
+// ErrEndpointNotAllowed is returned for a target outside the forwarder's allow-list.
+var ErrEndpointNotAllowed = errors.New("endpoint is not in TRACE_FORWARD_ENDPOINTS")
+
+// Target is an OTLP gRPC receiver a trace is forwarded to.
+type Target struct {
+	Endpoint string            `json:"endpoint"`          // host:port
+	TLS      bool              `json:"tls"`               // verify the receiver against the system roots; plaintext otherwise
+	Headers  map[string]string `json:"headers,omitempty"` // sent as gRPC metadata, e.g. an API key
+}
+
+// Result reports what the receiver accepted.
+type Result struct {
+	Spans         int    `json:"spans"`             // spans sent
+	RejectedSpans int64  `json:"rejected_spans"`    // from the receiver's partial success
+	Message       string `json:"message,omitempty"` // the receiver's partial success message
+}
+
+// Forwarder sends traces to the OTLP gRPC endpoints of an allow-list, so the API
+// cannot be used to make the server connect to arbitrary hosts.
+type Forwarder struct {
+	allowed map[string]bool
+	timeout time.Duration
+}
+
+// NewForwarder creates a forwarder for the given host:port endpoints; a forward
+// gives up after timeout (<= 0: DefaultForwardTimeout).
+func NewForwarder(endpoints []string, timeout time.Duration) *Forwarder {
+	if timeout <= 0 {
+		timeout = DefaultForwardTimeout
+	}
+	f := &Forwarder{allowed: make(map[string]bool), timeout: timeout}
+	for _, e := range endpoints {
+		if e = normalizeEndpoint(e); e != "" {
+			f.allowed[e] = true
+		}
+	}
+	return f
+}
+
+// Allowed reports whether endpoint is on the allow-list.
+func (f *Forwarder) Allowed(endpoint string) bool {
+	return f.allowed[normalizeEndpoint(endpoint)]
+}
+
+// Forward sends req to the target. An error means the export failed as a whole; a
+// receiver accepting only part of it is reported in the Result.
+func (f *Forwarder) Forward(ctx context.Context, target Target, req *coltracepb.ExportTraceServiceRequest) (*Result, error) {
+	if !f.Allowed(target.Endpoint) {
+		return nil, fmt.Errorf("%w: %q", ErrEndpointNotAllowed, target.Endpoint)
+	}
+	creds := insecure.NewCredentials()
+	if target.TLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(normalizeEndpoint(target.Endpoint), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", target.Endpoint, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	if len(target.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(target.Headers))
+	}
+	resp, err := coltracepb.NewTraceServiceClient(conn).Export(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("export to %s failed: %w", target.Endpoint, err)
+	}
+	res := &Result{Spans: countSpans(req)}
+	if ps := resp.GetPartialSuccess(); ps != nil {
+		res.RejectedSpans, res.Message = ps.GetRejectedSpans(), ps.GetErrorMessage()
+	}
+	return res, nil
+}
+
+func countSpans(req *coltracepb.ExportTraceServiceRequest) int {
+	n := 0
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			n += len(ss.Spans)
+		}
+	}
+	return n
+}
+
+// normalizeEndpoint lower-cases an endpoint and trims its whitespace, so the
+// allow-list is matched regardless of case.
+func normalizeEndpoint(endpoint string) string {
+	return strings.ToLower(strings.TrimSpace(endpoint))
+}
@@ -0,0 +1,240 @@
+// Package export turns stored traces back into OTLP and forwards them to another
+// backend, e.g. to hand one problematic trace to a vendor APM for deeper analysis.
+//
+// Storage keeps less than OTLP carries, so the rebuilt request is what Argus knows
+// about the trace: the resource has service.name and deployment.environment.name
+// only, a span's status is ERROR or UNSET (its message comes from the status log
+// synthesized at ingest), and span events are rebuilt from the logs synthesized from
+// them. IDs, names, kinds, timestamps, scopes, attributes and links are preserved.
+package export
+
+import (
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// resourceKey groups spans into a ResourceSpans.
+type resourceKey struct{ service, env string }
+
+// scopeKey groups a resource's spans into a ScopeSpans.
+type scopeKey struct{ name, version string }
+
+// TraceRequest rebuilds the spans of t, loaded with its spans and logs as GetTrace
+// returns it, into an ExportTraceServiceRequest. Spans are grouped by service and
+// environment, then by instrumentation scope, in order of their start time.
+func TraceRequest(t *storage.Trace) *coltracepb.ExportTraceServiceRequest {
+	spans := slices.Clone(t.Spans)
+	slices.SortStableFunc(spans, func(a, b storage.Span) int {
+		return cmp.Or(a.StartTime.Compare(b.StartTime), strings.Compare(a.SpanID, b.SpanID))
+	})
+	logs := spanLogs(t.Logs)
+
+	req := &coltracepb.ExportTraceServiceRequest{}
+	resources := make(map[resourceKey]*tracepb.ResourceSpans)
+	scopes := make(map[resourceKey]map[scopeKey]*tracepb.ScopeSpans)
+	for i := range spans {
+		s := &spans[i]
+		rk := resourceKey{s.ServiceName, s.Environment}
+		rs, ok := resources[rk]
+		if !ok {
+			rs = &tracepb.ResourceSpans{Resource: resource(s.ServiceName, s.Environment)}
+			resources[rk] = rs
+			scopes[rk] = make(map[scopeKey]*tracepb.ScopeSpans)
+			req.ResourceSpans = append(req.ResourceSpans, rs)
+		}
+		sk := scopeKey{s.ScopeName, s.ScopeVersion}
+		ss, ok := scopes[rk][sk]
+		if !ok {
+			ss = &tracepb.ScopeSpans{}
+			if sk.name != "" || sk.version != "" {
+				ss.Scope = &commonpb.InstrumentationScope{Name: sk.name, Version: sk.version}
+			}
+			scopes[rk][sk] = ss
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+		ss.Spans = append(ss.Spans, Span(s, logs[s.SpanID]))
+	}
+	return req
+}
+
+// Span converts a stored span to OTLP. logs are the span's synthesized logs, from
+// which its events and status message are rebuilt; other logs are ignored.
+func Span(s *storage.Span, logs []storage.Log) *tracepb.Span {
+	out := &tracepb.Span{
+		TraceId:           hexID(s.TraceID),
+		SpanId:            hexID(s.SpanID),
+		ParentSpanId:      hexID(s.ParentSpanID),
+		Name:              s.OperationName,
+		Kind:              spanKind(s.Kind),
+		StartTimeUnixNano: uint64(s.StartTime.UnixNano()),
+		EndTimeUnixNano:   uint64(s.EndTime.UnixNano()),
+		Attributes:        Attributes(s.AttributesJSON),
+	}
+	for _, l := range s.Links {
+		out.Links = append(out.Links, &tracepb.Span_Link{
+			TraceId:    hexID(l.LinkedTraceID),
+			SpanId:     hexID(l.LinkedSpanID),
+			Attributes: Attributes(l.AttributesJSON),
+		})
+	}
+	if s.HasError {
+		out.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}
+	}
+	for _, l := range logs {
+		attrs, source := logAttributes(l.AttributesJSON)
+		switch source {
+		case ingest.SourceSpanEvent:
+			out.Events = append(out.Events, &tracepb.Span_Event{
+				Name:         eventName(l),
+				TimeUnixNano: uint64(l.Timestamp.UnixNano()),
+				Attributes:   attrs,
+			})
+		case ingest.SourceSpanStatus:
+			// Without a message, ingest made one up.
+			if out.Status != nil && string(l.Body) != fmt.Sprintf("Span '%s' failed", s.OperationName) {
+				out.Status.Message = string(l.Body)
+			}
+		}
+	}
+	return out
+}
+
+// Attributes decodes stored attributes JSON back into OTLP key-values, sorted by key.
+// JSON loses some types: whole numbers come back as ints, and bytes as their base64
+// string.
+func Attributes(text storage.CompressedText) []*commonpb.KeyValue {
+	if text == "" {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(string(text)))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	out := make([]*commonpb.KeyValue, len(keys))
+	for i, k := range keys {
+		out[i] = &commonpb.KeyValue{Key: k, Value: anyValue(m[k])}
+	}
+	return out
+}
+
+// anyValue converts a value decoded with UseNumber to an OTLP AnyValue.
+func anyValue(v any) *commonpb.AnyValue {
+	switch x := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: x}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: x}}
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: n}}
+		}
+		f, _ := x.Float64()
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: f}}
+	case []any:
+		values := make([]*commonpb.AnyValue, len(x))
+		for i, e := range x {
+			values[i] = anyValue(e)
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		kvs := make([]*commonpb.KeyValue, len(keys))
+		for i, k := range keys {
+			kvs[i] = &commonpb.KeyValue{Key: k, Value: anyValue(x[k])}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: kvs}}}
+	}
+	return &commonpb.AnyValue{}
+}
+
+// spanLogs groups the synthesized logs by span ID, oldest first.
+func spanLogs(logs []storage.Log) map[string][]storage.Log {
+	out := make(map[string][]storage.Log)
+	for _, l := range logs {
+		if l.Synthetic && l.SpanID != "" {
+			out[l.SpanID] = append(out[l.SpanID], l)
+		}
+	}
+	for _, ls := range out {
+		slices.SortStableFunc(ls, func(a, b storage.Log) int { return a.Timestamp.Compare(b.Timestamp) })
+	}
+	return out
+}
+
+// logAttributes returns the attributes of a synthesized log without those added at
+// ingest, and the source it was synthesized from.
+func logAttributes(text storage.CompressedText) ([]*commonpb.KeyValue, string) {
+	var source string
+	attrs := slices.DeleteFunc(Attributes(text), func(kv *commonpb.KeyValue) bool {
+		switch kv.Key {
+		case ingest.SourceAttr:
+			source = kv.Value.GetStringValue()
+			return true
+		case ingest.OriginalBodySizeAttr:
+			return true
+		}
+		return false
+	})
+	return attrs, source
+}
+
+// eventName recovers the name of the event a log was synthesized from: "exception"
+// for the ERROR ones, otherwise the log body, which ingest set to the event name
+// unless the event carried a message.
+func eventName(l storage.Log) string {
+	if l.Severity == storage.SeverityError {
+		return "exception"
+	}
+	return string(l.Body)
+}
+
+func resource(service, env string) *resourcepb.Resource {
+	attrs := []*commonpb.KeyValue{stringAttr("service.name", service)}
+	if env != "" {
+		attrs = append(attrs, stringAttr("deployment.environment.name", env))
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// spanKind reverses the stored kind ("SERVER", or "" when unset).
+func spanKind(kind string) tracepb.Span_SpanKind {
+	if kind == "" {
+		return tracepb.Span_SPAN_KIND_UNSPECIFIED
+	}
+	return tracepb.Span_SpanKind(tracepb.Span_SpanKind_value["SPAN_KIND_"+kind])
+}
+
+// hexID decodes a stored hex ID; an empty or malformed one is nil.
+func hexID(id string) []byte {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,211 @@
+package export
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestRepo(t *testing.T) *storage.Repository {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "export.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func attr(k string, v *commonpb.AnyValue) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: v}
+}
+
+func str(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
+
+func num(n int64) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: n}}
+}
+
+// sampleRequest is a trace across two services using what storage keeps of OTLP.
+func sampleRequest() *coltracepb.ExportTraceServiceRequest {
+	start := uint64(time.Date(2026, 10, 15, 9, 30, 0, 123456789, time.UTC).UnixNano())
+	traceID := []byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	id := func(b byte) []byte { return []byte{0, 0, 0, 0, 0, 0, 0, b} }
+	return &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{
+		{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+				attr("service.name", str("checkout")),
+				attr("deployment.environment.name", str("prod")),
+			}},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: "otelhttp", Version: "0.60.0"},
+				Spans: []*tracepb.Span{
+					{
+						TraceId: traceID, SpanId: id(1), Name: "POST /checkout", Kind: tracepb.Span_SPAN_KIND_SERVER,
+						StartTimeUnixNano: start, EndTimeUnixNano: start + 90_000_000,
+						Attributes: []*commonpb.KeyValue{
+							attr("http.request.method", str("POST")),
+							attr("http.response.status_code", num(502)),
+							attr("cart.total", &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 41.5}}),
+							attr("cart.express", &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}),
+							attr("cart.skus", &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+								Values: []*commonpb.AnyValue{str("A-1"), str("B-2")},
+							}}}),
+							attr("customer", &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+								Values: []*commonpb.KeyValue{attr("id", num(7)), attr("tier", str("gold"))},
+							}}}),
+						},
+						Links:  []*tracepb.Span_Link{{TraceId: id(9), SpanId: id(3), Attributes: []*commonpb.KeyValue{attr("link.kind", str("retry"))}}},
+						Events: []*tracepb.Span_Event{{Name: "cache.miss", TimeUnixNano: start + 1_000, Attributes: []*commonpb.KeyValue{attr("key", str("cart:7"))}}},
+						Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR},
+					},
+					{
+						TraceId: traceID, SpanId: id(2), ParentSpanId: id(1), Name: "POST /charge", Kind: tracepb.Span_SPAN_KIND_CLIENT,
+						StartTimeUnixNano: start + 5_000_000, EndTimeUnixNano: start + 85_000_000,
+						Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "upstream returned 502"},
+					},
+				},
+			}},
+		},
+		{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{attr("service.name", str("payments"))}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+				TraceId: traceID, SpanId: id(4), ParentSpanId: id(2), Name: "charge", Kind: tracepb.Span_SPAN_KIND_INTERNAL,
+				StartTimeUnixNano: start + 10_000_000, EndTimeUnixNano: start + 80_000_000,
+				Events: []*tracepb.Span_Event{{Name: "exception", TimeUnixNano: start + 70_000_000, Attributes: []*commonpb.KeyValue{
+					attr("exception.message", str("card declined")),
+					attr("exception.type", str("CardError")),
+				}}},
+				Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR},
+			}}}},
+		},
+	}}
+}
+
+// normalize sorts what OTLP leaves unordered, so requests compare modulo ordering.
+func normalize(req *coltracepb.ExportTraceServiceRequest) {
+	byKey := func(a, b *commonpb.KeyValue) int { return cmp.Compare(a.Key, b.Key) }
+	sortAttrs := func(attrs []*commonpb.KeyValue) {
+		slices.SortFunc(attrs, byKey)
+		for _, kv := range attrs {
+			if kvs := kv.Value.GetKvlistValue(); kvs != nil {
+				slices.SortFunc(kvs.Values, byKey)
+			}
+		}
+	}
+	service := func(rs *tracepb.ResourceSpans) string { return rs.Resource.Attributes[0].Value.GetStringValue() }
+	slices.SortFunc(req.ResourceSpans, func(a, b *tracepb.ResourceSpans) int { return cmp.Compare(service(a), service(b)) })
+	for _, rs := range req.ResourceSpans {
+		sortAttrs(rs.Resource.Attributes)
+		slices.SortFunc(rs.ScopeSpans, func(a, b *tracepb.ScopeSpans) int { return cmp.Compare(a.Scope.GetName(), b.Scope.GetName()) })
+		for _, ss := range rs.ScopeSpans {
+			slices.SortFunc(ss.Spans, func(a, b *tracepb.Span) int { return slices.Compare(a.SpanId, b.SpanId) })
+			for _, s := range ss.Spans {
+				sortAttrs(s.Attributes)
+				for _, e := range s.Events {
+					sortAttrs(e.Attributes)
+				}
+				for _, l := range s.Links {
+					sortAttrs(l.Attributes)
+				}
+			}
+		}
+	}
+}
+
+// receiver is an OTLP trace receiver recording what it is sent.
+type receiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+	got *coltracepb.ExportTraceServiceRequest
+	md  metadata.MD
+}
+
+func (r *receiver) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	r.got = req
+	r.md, _ = metadata.FromIncomingContext(ctx)
+	return &coltracepb.ExportTraceServiceResponse{PartialSuccess: &coltracepb.ExportTracePartialSuccess{
+		RejectedSpans: 1, ErrorMessage: "span quota exceeded",
+	}}, nil
+}
+
+func startReceiver(t *testing.T) (*receiver, string) {
+	t.Helper()
+	rcv := &receiver{}
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, rcv)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return rcv, lis.Addr().String()
+}
+
+func TestForwardRoundTrip(t *testing.T) {
+	repo := newTestRepo(t)
+	traces := ingest.NewTraceServer(repo, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+	if _, err := traces.Export(context.Background(), sampleRequest()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	trace, err := repo.GetTrace("4bf92f3577b34da6a3ce929d0e0e4736")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rcv, endpoint := startReceiver(t)
+	f := NewForwarder([]string{"other:4317", endpoint}, time.Second)
+	res, err := f.Forward(context.Background(), Target{Endpoint: endpoint, Headers: map[string]string{"api-key": "secret"}}, TraceRequest(trace))
+	if err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	if res.Spans != 3 || res.RejectedSpans != 1 || res.Message != "span quota exceeded" {
+		t.Errorf("Forward() = %+v, want 3 spans with the receiver's partial success", res)
+	}
+	if got := rcv.md.Get("api-key"); !slices.Equal(got, []string{"secret"}) {
+		t.Errorf("api-key header = %v, want secret", got)
+	}
+
+	want := sampleRequest()
+	normalize(want)
+	normalize(rcv.got)
+	if !proto.Equal(rcv.got, want) {
+		t.Errorf("forwarded request differs from the ingested one:\n got %s\nwant %s", protojson.Format(rcv.got), protojson.Format(want))
+	}
+}
+
+func TestForwardRejectsEndpointsNotAllowed(t *testing.T) {
+	rcv, endpoint := startReceiver(t)
+	f := NewForwarder([]string{"APM.example.com:4317 "}, time.Second)
+	if !f.Allowed("apm.example.com:4317") {
+		t.Error("Allowed() = false for a listed endpoint in another case")
+	}
+	_, err := f.Forward(context.Background(), Target{Endpoint: endpoint}, sampleRequest())
+	if !errors.Is(err, ErrEndpointNotAllowed) {
+		t.Errorf("Forward() error = %v, want ErrEndpointNotAllowed", err)
+	}
+	if rcv.got != nil {
+		t.Error("request sent to an endpoint not on the allow-list")
+	}
+}
@@ -6,37 +6,12 @@ import (
 	"log/slog"
 	"time"
 
-	"gorm.io/gorm"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
 )
 
-// Investigation is a persisted record of an automated error investigation.
-type Investigation struct {
-	ID               string          `gorm:"primaryKey;size:64" json:"id"`
-	CreatedAt        time.Time       `json:"created_at"`
-	Status           string          `gorm:"size:20" json:"status"`    // detected, triaged, resolved
-	Severity         string          `gorm:"size:20" json:"severity"`  // critical, warning, info
-	TriggerService   string          `gorm:"size:255;index" json:"trigger_service"`
-	TriggerOperation string          `gorm:"size:255" json:"trigger_operation"`
-	ErrorMessage     string          `gorm:"type:text" json:"error_message"`
-	RootService      string          `gorm:"size:255" json:"root_service"`
-	RootOperation    string          `gorm:"size:255" json:"root_operation"`
-	CausalChain      json.RawMessage `gorm:"type:text" json:"causal_chain"`
-	TraceIDs         json.RawMessage `gorm:"type:text" json:"trace_ids"`
-	ErrorLogs        json.RawMessage `gorm:"type:text" json:"error_logs"`
-	AnomalousMetrics json.RawMessage `gorm:"type:text" json:"anomalous_metrics"`
-	AffectedServices json.RawMessage `gorm:"type:text" json:"affected_services"`
-	SpanChain        json.RawMessage `gorm:"type:text" json:"span_chain"`
-}
-
-// TableName overrides GORM's default table name.
-func (Investigation) TableName() string {
-	return "investigations"
-}
-
-// AutoMigrateGraphRAG runs GORM auto-migration for GraphRAG models.
-func AutoMigrateGraphRAG(db *gorm.DB) error {
-	return db.AutoMigrate(&Investigation{}, &GraphSnapshot{})
-}
+// Investigation is a persisted record of an automated error investigation. Its
+// table is created and migrated with the rest of the schema by storage.
+type Investigation = storage.Investigation
 
 // PersistInvestigation saves an investigation record from an error chain analysis.
 func (g *GraphRAG) PersistInvestigation(triggerService string, chains []ErrorChainResult, anomalies []*AnomalyNode) {
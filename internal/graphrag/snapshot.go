@@ -5,23 +5,13 @@ import (
 	"fmt"
 	"log/slog"
 	"time"
-)
 
-// GraphSnapshot is a periodic snapshot of the service topology persisted to DB.
-type GraphSnapshot struct {
-	ID             string          `gorm:"primaryKey;size:64" json:"id"`
-	CreatedAt      time.Time       `json:"created_at"`
-	Nodes          json.RawMessage `gorm:"type:text" json:"nodes"`
-	Edges          json.RawMessage `gorm:"type:text" json:"edges"`
-	ServiceCount   int             `json:"service_count"`
-	TotalCalls     int64           `json:"total_calls"`
-	AvgHealthScore float64         `json:"avg_health_score"`
-}
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
 
-// TableName overrides GORM's default table name.
-func (GraphSnapshot) TableName() string {
-	return "graph_snapshots"
-}
+// GraphSnapshot is a periodic snapshot of the service topology persisted to DB. Its
+// table is created and migrated with the rest of the schema by storage.
+type GraphSnapshot = storage.GraphSnapshot
 
 // snapshotNode is a lightweight node representation for snapshots.
 type snapshotNode struct {
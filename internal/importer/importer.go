@@ -0,0 +1,294 @@
+// Package importer loads trace exports from other environments (Jaeger JSON, OTLP
+// JSON) into storage for offline analysis. Trace and span IDs and timestamps are
+// preserved; traces that already exist are skipped rather than duplicated.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// Format identifies the layout of an import file.
+type Format string
+
+const (
+	// FormatJaeger is the Jaeger query API / UI export: {"data":[{traceID, spans, processes}]}.
+	FormatJaeger Format = "jaeger"
+	// FormatOTLPJSON is OTLP/JSON ExportTraceServiceRequest documents, either one
+	// object or one per line as written by the collector's file exporter.
+	FormatOTLPJSON Format = "otlp-json"
+)
+
+// ErrInvalidInput is returned when the file does not match its format.
+var ErrInvalidInput = errors.New("invalid import file")
+
+// batchSpans is how many spans are buffered before they are written.
+var batchSpans = 1000
+
+// ParseFormat validates a format name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatJaeger, FormatOTLPJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported import format %q (want jaeger or otlp-json)", s)
+}
+
+// Store is the storage the importer writes to.
+type Store interface {
+	storage.TraceWriter
+	storage.LogWriter
+	ExistingTraceIDs(traceIDs []string) (map[string]bool, error)
+}
+
+// Result reports what an import stored and what it skipped because the trace was
+// already present.
+type Result struct {
+	Traces        int64 `json:"traces"`
+	Spans         int64 `json:"spans"`
+	Logs          int64 `json:"logs"`
+	SkippedTraces int64 `json:"skipped_traces"`
+	SkippedSpans  int64 `json:"skipped_spans"`
+	SkippedLogs   int64 `json:"skipped_logs"`
+}
+
+// span is a converted span with the status the trace summary is derived from.
+type span struct {
+	storage.Span
+	Status string
+}
+
+// trace is the part of one trace found in a chunk of the input. Exports may split a
+// trace across several chunks.
+type trace struct {
+	id    string
+	spans []span
+	logs  []storage.Log
+}
+
+// Import reads r in the given format and writes its traces to store in batches. The
+// input is decoded incrementally, one trace (Jaeger) or one document (OTLP) at a time.
+// On error the result still counts what was written before it.
+func Import(store Store, format Format, r io.Reader) (*Result, error) {
+	im := &importer{store: store, imported: make(map[string]bool), skipped: make(map[string]bool)}
+	var err error
+	switch format {
+	case FormatJaeger:
+		err = decodeJaeger(r, im.add)
+	case FormatOTLPJSON:
+		err = decodeOTLP(r, im.add)
+	default:
+		err = fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return &im.res, err
+	}
+	if err := im.flush(); err != nil {
+		return &im.res, err
+	}
+	return &im.res, nil
+}
+
+type importer struct {
+	store    Store
+	res      Result
+	batch    []*trace
+	byID     map[string]*trace // batch entries by trace ID
+	pending  int               // spans in batch
+	imported map[string]bool   // traces written by this import
+	skipped  map[string]bool   // traces that existed before this import
+}
+
+func (im *importer) add(t trace) error {
+	if im.byID == nil {
+		im.byID = make(map[string]*trace)
+	}
+	if cur, ok := im.byID[t.id]; ok {
+		cur.spans = append(cur.spans, t.spans...)
+		cur.logs = append(cur.logs, t.logs...)
+	} else {
+		im.byID[t.id] = &t
+		im.batch = append(im.batch, &t)
+	}
+	im.pending += len(t.spans)
+	if im.pending >= batchSpans {
+		return im.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered traces, skipping those that were stored before this
+// import began. Parts of a trace seen in an earlier batch are appended to it.
+func (im *importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	var lookup []string
+	for _, t := range im.batch {
+		if !im.imported[t.id] && !im.skipped[t.id] {
+			lookup = append(lookup, t.id)
+		}
+	}
+	existing, err := im.store.ExistingTraceIDs(lookup)
+	if err != nil {
+		return err
+	}
+
+	var (
+		traces []storage.Trace
+		spans  []storage.Span
+		logs   []storage.Log
+		res    Result
+	)
+	for _, t := range im.batch {
+		if im.skipped[t.id] || existing[t.id] {
+			if !im.skipped[t.id] {
+				res.SkippedTraces++
+			}
+			res.SkippedSpans += int64(len(t.spans))
+			res.SkippedLogs += int64(len(t.logs))
+			continue
+		}
+		if !im.imported[t.id] {
+			res.Traces++
+		}
+		traces = append(traces, summarize(t))
+		for _, s := range t.spans {
+			spans = append(spans, s.Span)
+		}
+		logs = append(logs, t.logs...)
+	}
+	res.Spans, res.Logs = int64(len(spans)), int64(len(logs))
+
+	if err := im.store.BatchCreateTraces(traces); err != nil {
+		return fmt.Errorf("failed to import traces: %w", err)
+	}
+	if err := im.store.BatchCreateSpans(spans); err != nil {
+		return fmt.Errorf("failed to import spans: %w", err)
+	}
+	if err := im.store.BatchCreateLogs(logs); err != nil {
+		return fmt.Errorf("failed to import logs: %w", err)
+	}
+
+	for _, t := range im.batch {
+		if existing[t.id] {
+			im.skipped[t.id] = true
+		} else if !im.skipped[t.id] {
+			im.imported[t.id] = true
+		}
+	}
+	im.res.Traces += res.Traces
+	im.res.Spans += res.Spans
+	im.res.Logs += res.Logs
+	im.res.SkippedTraces += res.SkippedTraces
+	im.res.SkippedSpans += res.SkippedSpans
+	im.res.SkippedLogs += res.SkippedLogs
+	im.batch, im.byID, im.pending = nil, nil, 0
+	return nil
+}
+
+// summarize builds the trace row the way ingest does: the root span, when present,
+// provides service, start, duration and status; otherwise the earliest span does.
+// Any failed span marks the trace as errored.
+func summarize(t *trace) storage.Trace {
+	spans := t.spans
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].StartTime.Before(spans[j].StartTime) })
+	head := spans[0]
+	for _, s := range spans {
+		if s.ParentSpanID == "" || strings.Trim(s.ParentSpanID, "0") == "" {
+			head = s
+			break
+		}
+	}
+	out := storage.Trace{
+		TraceID:     t.id,
+		ServiceName: head.ServiceName,
+		Duration:    head.Duration,
+		Status:      head.Status,
+		Timestamp:   head.StartTime,
+	}
+	for _, s := range spans {
+		if s.Status == statusError {
+			out.HasError = true
+		}
+	}
+	return out
+}
+
+const (
+	statusUnset = "STATUS_CODE_UNSET"
+	statusOK    = "STATUS_CODE_OK"
+	statusError = "STATUS_CODE_ERROR"
+)
+
+// statusLog is the ERROR log ingest synthesizes for a failed span without an error
+// event of its own.
+func statusLog(s span, message string, logs []storage.Log) (storage.Log, bool) {
+	if s.Status != statusError {
+		return storage.Log{}, false
+	}
+	for _, l := range logs {
+		if l.SpanID == s.SpanID && l.Severity == "ERROR" {
+			return storage.Log{}, false
+		}
+	}
+	if message == "" {
+		message = fmt.Sprintf("Span '%s' failed", s.OperationName)
+	}
+	return storage.Log{
+		TraceID:        s.TraceID,
+		SpanID:         s.SpanID,
+		Severity:       "ERROR",
+		Body:           storage.CompressedText(message),
+		ServiceName:    s.ServiceName,
+		ScopeName:      s.ScopeName,
+		ScopeVersion:   s.ScopeVersion,
+		AttributesJSON: "{}",
+		Timestamp:      s.EndTime,
+	}, true
+}
+
+// normalizeID lower-cases a hex ID and left-pads it to width, since some exporters
+// drop leading zeros or use 64-bit trace IDs.
+func normalizeID(id string, width int) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" || len(id) >= width {
+		return id
+	}
+	return strings.Repeat("0", width-len(id)) + id
+}
+
+// groupByTrace splits converted spans and logs into one trace per ID, in order of
+// first appearance.
+func groupByTrace(spans []span, logs []storage.Log) []trace {
+	byID := make(map[string]*trace)
+	var order []string
+	get := func(id string) *trace {
+		t, ok := byID[id]
+		if !ok {
+			t = &trace{id: id}
+			byID[id] = t
+			order = append(order, id)
+		}
+		return t
+	}
+	for _, s := range spans {
+		t := get(s.TraceID)
+		t.spans = append(t.spans, s)
+	}
+	for _, l := range logs {
+		if t, ok := byID[l.TraceID]; ok {
+			t.logs = append(t.logs, l)
+		}
+	}
+	out := make([]trace, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func newTestRepo(t *testing.T) *storage.Repository {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "import.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func importFixture(t *testing.T, repo *storage.Repository, format Format, name string) *Result {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	res, err := Import(repo, format, f)
+	if err != nil {
+		t.Fatalf("Import(%s) error = %v", name, err)
+	}
+	return res
+}
+
+func spansByID(t *testing.T, repo *storage.Repository, traceID string) (*storage.Trace, map[string]storage.Span) {
+	t.Helper()
+	tr, err := repo.GetTrace(traceID)
+	if err != nil {
+		t.Fatalf("GetTrace(%s) error = %v", traceID, err)
+	}
+	spans := make(map[string]storage.Span)
+	for _, s := range tr.Spans {
+		spans[s.SpanID] = s
+	}
+	return tr, spans
+}
+
+func TestImportJaeger(t *testing.T) {
+	repo := newTestRepo(t)
+	res := importFixture(t, repo, FormatJaeger, "jaeger.json")
+	if *res != (Result{Traces: 2, Spans: 3, Logs: 2}) {
+		t.Errorf("result = %+v, want 2 traces, 3 spans, 2 logs", *res)
+	}
+
+	tr, spans := spansByID(t, repo, "4bf92f3577b34da6a3ce929d0e0e4736")
+	if tr.ServiceName != "frontend" || tr.Duration != 250000 || !tr.HasError || tr.Status != statusError {
+		t.Errorf("trace = %+v, want frontend root, 250ms, errored", tr)
+	}
+	if want := time.UnixMicro(1760000000000000); !tr.Timestamp.Equal(want) {
+		t.Errorf("trace timestamp = %v, want %v", tr.Timestamp, want)
+	}
+	db := spans["b7ad6b7169203331"]
+	if db.ParentSpanID != "00f067aa0ba902b7" || db.ServiceName != "orders-db" || db.Kind != "CLIENT" || db.Duration != 120000 {
+		t.Errorf("child span = %+v", db)
+	}
+	if root := spans["00f067aa0ba902b7"]; root.ScopeName != "otelhttp" || !strings.Contains(string(root.AttributesJSON), `"http.status_code":500`) {
+		t.Errorf("root span scope = %q, attributes = %s", root.ScopeName, root.AttributesJSON)
+	}
+
+	var bodies []string
+	for _, l := range tr.Logs {
+		if l.Severity != "ERROR" {
+			t.Errorf("log %q severity = %s, want ERROR", l.Body, l.Severity)
+		}
+		bodies = append(bodies, string(l.Body))
+	}
+	if got := strings.Join(bodies, "|"); !strings.Contains(got, "deadlock detected") || !strings.Contains(got, "Span 'GET /checkout' failed") {
+		t.Errorf("logs = %v, want the span log and the synthesized status log", bodies)
+	}
+
+	// 64-bit Jaeger trace IDs are padded to the 128-bit form ingest uses.
+	if _, err := repo.GetTrace("0000000000000000a3ce929d0e0e4736"); err != nil {
+		t.Errorf("64-bit trace not stored under its padded ID: %v", err)
+	}
+
+	// Importing the same file again stores nothing new.
+	again := importFixture(t, repo, FormatJaeger, "jaeger.json")
+	if *again != (Result{SkippedTraces: 2, SkippedSpans: 3, SkippedLogs: 2}) {
+		t.Errorf("re-import result = %+v, want everything skipped", *again)
+	}
+	var count int64
+	repo.DB().Model(&storage.Span{}).Count(&count)
+	if count != 3 {
+		t.Errorf("spans after re-import = %d, want 3", count)
+	}
+}
+
+func TestImportOTLPJSON(t *testing.T) {
+	for _, batch := range []int{1000, 1} {
+		repo := newTestRepo(t)
+		// A batch size of 1 writes the trace split across documents in two batches.
+		old := batchSpans
+		batchSpans = batch
+		res := importFixture(t, repo, FormatOTLPJSON, "otlp.jsonl")
+		batchSpans = old
+
+		if *res != (Result{Traces: 2, Spans: 3, Logs: 2}) {
+			t.Errorf("batch %d: result = %+v, want 2 traces, 3 spans, 2 logs", batch, *res)
+		}
+		tr, spans := spansByID(t, repo, "5b8efff798038103d269b633813fc60c")
+		if tr.ServiceName != "gateway" || tr.Duration != 300000 || !tr.HasError {
+			t.Errorf("batch %d: trace = %+v, want gateway root, 300ms, errored by its child", batch, tr)
+		}
+		charge := spans["e457b5a2e4d86bd1"]
+		if charge.ParentSpanID != "eee19b7ec3c1b174" || charge.ServiceName != "payments" || charge.Kind != "CLIENT" || charge.ScopeVersion != "1.2.0" {
+			t.Errorf("batch %d: child span = %+v", batch, charge)
+		}
+		if want := time.Unix(0, 1760000000123456789+1_000_000); !charge.StartTime.Equal(want) {
+			t.Errorf("batch %d: start = %v, want %v", batch, charge.StartTime, want)
+		}
+		if len(tr.Logs) != 2 {
+			t.Errorf("batch %d: logs = %d, want the retry event and the status log", batch, len(tr.Logs))
+		}
+	}
+}
+
+func TestImportRejectsMalformedInput(t *testing.T) {
+	repo := newTestRepo(t)
+	tests := []struct {
+		format Format
+		input  string
+	}{
+		{FormatJaeger, `{"total": 0}`},
+		{FormatJaeger, `{"data": [{"traceID": "ab", "spans": [`},
+		{FormatJaeger, `[]`},
+		{FormatOTLPJSON, `{"resourceSpans": "nope"}`},
+		{FormatOTLPJSON, `{"resourceSpans": []} {`},
+	}
+	for _, tt := range tests {
+		if _, err := Import(repo, tt.format, strings.NewReader(tt.input)); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Import(%s, %q) error = %v, want ErrInvalidInput", tt.format, tt.input, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// Jaeger JSON as returned by /api/traces and the UI's "Download JSON". Times and
+// durations are microseconds.
+type jaegerTrace struct {
+	TraceID   string                   `json:"traceID"`
+	Spans     []jaegerSpan             `json:"spans"`
+	Processes map[string]jaegerProcess `json:"processes"`
+}
+
+type jaegerSpan struct {
+	TraceID       string         `json:"traceID"`
+	SpanID        string         `json:"spanID"`
+	OperationName string         `json:"operationName"`
+	References    []jaegerRef    `json:"references"`
+	StartTime     int64          `json:"startTime"`
+	Duration      int64          `json:"duration"`
+	Tags          []jaegerKV     `json:"tags"`
+	Logs          []jaegerLog    `json:"logs"`
+	ProcessID     string         `json:"processID"`
+	Process       *jaegerProcess `json:"process"` // inline form used by some exporters
+}
+
+type jaegerRef struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type jaegerProcess struct {
+	ServiceName string     `json:"serviceName"`
+	Tags        []jaegerKV `json:"tags"`
+}
+
+type jaegerLog struct {
+	Timestamp int64      `json:"timestamp"`
+	Fields    []jaegerKV `json:"fields"`
+}
+
+type jaegerKV struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// decodeJaeger streams the "data" array, decoding one trace at a time.
+func decodeJaeger(r io.Reader, emit func(trace) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	found := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("%w: Jaeger JSON: %w", ErrInvalidInput, err)
+		}
+		if key, _ := tok.(string); key != "data" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("%w: Jaeger JSON: %w", ErrInvalidInput, err)
+			}
+			continue
+		}
+		found = true
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			var jt jaegerTrace
+			if err := dec.Decode(&jt); err != nil {
+				return fmt.Errorf("%w: Jaeger trace: %w", ErrInvalidInput, err)
+			}
+			for _, t := range convertJaeger(jt) {
+				if err := emit(t); err != nil {
+					return err
+				}
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: Jaeger JSON has no \"data\" array", ErrInvalidInput)
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("%w: expected %q, got %v", ErrInvalidInput, want, tok)
+	}
+	return nil
+}
+
+// convertJaeger maps a Jaeger trace to spans and logs. Span logs become log records;
+// OpenTelemetry's otel.* tags provide status, kind and scope.
+func convertJaeger(jt jaegerTrace) []trace {
+	var spans []span
+	var logs []storage.Log
+	for _, js := range jt.Spans {
+		traceID := js.TraceID
+		if traceID == "" {
+			traceID = jt.TraceID
+		}
+		proc := jt.Processes[js.ProcessID]
+		if js.Process != nil {
+			proc = *js.Process
+		}
+		service := proc.ServiceName
+		if service == "" {
+			service = "unknown-service"
+		}
+
+		tags := make(map[string]string, len(js.Tags))
+		for _, kv := range js.Tags {
+			tags[kv.Key] = kv.stringValue()
+		}
+		start := time.UnixMicro(js.StartTime)
+		status := jaegerStatus(tags)
+		s := span{
+			Span: storage.Span{
+				TraceID:        normalizeID(traceID, 32),
+				SpanID:         normalizeID(js.SpanID, 16),
+				ParentSpanID:   jaegerParent(js.References),
+				OperationName:  js.OperationName,
+				Kind:           strings.ToUpper(tags["span.kind"]),
+				StartTime:      start,
+				EndTime:        start.Add(time.Duration(js.Duration) * time.Microsecond),
+				Duration:       js.Duration,
+				HasError:       status == statusError,
+				ServiceName:    service,
+				ScopeName:      firstNonEmpty(tags["otel.scope.name"], tags["otel.library.name"]),
+				ScopeVersion:   firstNonEmpty(tags["otel.scope.version"], tags["otel.library.version"]),
+				AttributesJSON: attributesJSON(js.Tags),
+			},
+			Status: status,
+		}
+		spans = append(spans, s)
+
+		var spanLogs []storage.Log
+		for _, jl := range js.Logs {
+			spanLogs = append(spanLogs, jaegerLogRecord(s, jl))
+		}
+		if l, ok := statusLog(s, tags["otel.status_description"], spanLogs); ok {
+			spanLogs = append(spanLogs, l)
+		}
+		logs = append(logs, spanLogs...)
+	}
+	return groupByTrace(spans, logs)
+}
+
+// jaegerParent returns the CHILD_OF parent, falling back to a FOLLOWS_FROM reference.
+func jaegerParent(refs []jaegerRef) string {
+	parent := ""
+	for _, ref := range refs {
+		if ref.RefType == "CHILD_OF" {
+			return normalizeID(ref.SpanID, 16)
+		}
+		if parent == "" {
+			parent = normalizeID(ref.SpanID, 16)
+		}
+	}
+	return parent
+}
+
+func jaegerStatus(tags map[string]string) string {
+	switch strings.ToUpper(tags["otel.status_code"]) {
+	case "ERROR":
+		return statusError
+	case "OK":
+		return statusOK
+	}
+	if tags["error"] == "true" {
+		return statusError
+	}
+	return statusUnset
+}
+
+// jaegerLogRecord converts a span log. Severity comes from a "level" field, or is
+// ERROR for error/exception events; the body is the message, falling back to the event.
+func jaegerLogRecord(s span, jl jaegerLog) storage.Log {
+	fields := make(map[string]string, len(jl.Fields))
+	for _, kv := range jl.Fields {
+		fields[kv.Key] = kv.stringValue()
+	}
+	event := fields["event"]
+	severity := strings.ToUpper(fields["level"])
+	if severity == "" {
+		severity = "INFO"
+		if event == "error" || event == "exception" {
+			severity = "ERROR"
+		}
+	}
+	return storage.Log{
+		TraceID:        s.TraceID,
+		SpanID:         s.SpanID,
+		Severity:       severity,
+		Body:           storage.CompressedText(firstNonEmpty(fields["message"], fields["exception.message"], event)),
+		ServiceName:    s.ServiceName,
+		ScopeName:      s.ScopeName,
+		ScopeVersion:   s.ScopeVersion,
+		AttributesJSON: attributesJSON(jl.Fields),
+		Timestamp:      time.UnixMicro(jl.Timestamp),
+	}
+}
+
+// attributesJSON stores tags in the same shape ingest uses for OTLP attributes, so
+// indexed log attributes and the UI read imported data like ingested data.
+func attributesJSON(kvs []jaegerKV) storage.CompressedText {
+	attrs := make([]*commonpb.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		attrs = append(attrs, &commonpb.KeyValue{Key: kv.Key, Value: kv.anyValue()})
+	}
+	return ingest.AttributesJSON(attrs)
+}
+
+func (kv jaegerKV) anyValue() *commonpb.AnyValue {
+	raw := strings.Trim(string(kv.Value), `"`)
+	switch strings.ToLower(kv.Type) {
+	case "bool":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: b}}
+		}
+	case "int64":
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: n}}
+		}
+	case "float64":
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: f}}
+		}
+	case "binary":
+		if b, err := base64.StdEncoding.DecodeString(raw); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: b}}
+		}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: kv.stringValue()}}
+}
+
+// stringValue renders the value as text: strings unquoted, everything else verbatim.
+func (kv jaegerKV) stringValue() string {
+	var s string
+	if json.Unmarshal(kv.Value, &s) == nil {
+		return s
+	}
+	return string(kv.Value)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
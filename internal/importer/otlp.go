@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// decodeOTLP reads consecutive OTLP/JSON trace documents. The collector's file
+// exporter writes one per line; a single pretty-printed document works as well.
+func decodeOTLP(r io.Reader, emit func(trace) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber() // keep nanosecond timestamps exact when re-encoding
+	for n := 1; ; n++ {
+		var doc map[string]any
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("%w: OTLP JSON document %d: %w", ErrInvalidInput, n, err)
+		}
+		// OTLP/JSON encodes IDs as hex, protojson expects base64 for bytes fields.
+		hexIDsToBase64(doc)
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("%w: OTLP JSON document %d: %w", ErrInvalidInput, n, err)
+		}
+		var req coltracepb.ExportTraceServiceRequest
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, &req); err != nil {
+			return fmt.Errorf("%w: OTLP JSON document %d: %w", ErrInvalidInput, n, err)
+		}
+		for _, t := range convertOTLP(&req) {
+			if err := emit(t); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// hexIDsToBase64 rewrites hex-encoded traceId, spanId and parentSpanId values in place.
+func hexIDsToBase64(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			switch k {
+			case "traceId", "spanId", "parentSpanId":
+				if s, ok := child.(string); ok && (len(s) == 32 || len(s) == 16) {
+					if b, err := hex.DecodeString(s); err == nil {
+						v[k] = base64.StdEncoding.EncodeToString(b)
+					}
+				}
+			default:
+				hexIDsToBase64(child)
+			}
+		}
+	case []any:
+		for _, child := range v {
+			hexIDsToBase64(child)
+		}
+	}
+}
+
+// convertOTLP maps spans the way the ingest path does, without sampling or filters,
+// and turns span events into logs.
+func convertOTLP(req *coltracepb.ExportTraceServiceRequest) []trace {
+	var spans []span
+	var logs []storage.Log
+	for _, rs := range req.ResourceSpans {
+		service := "unknown-service"
+		for _, kv := range rs.GetResource().GetAttributes() {
+			if kv.Key == "service.name" {
+				service = kv.Value.GetStringValue()
+				break
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			scopeName, scopeVersion := ss.GetScope().GetName(), ss.GetScope().GetVersion()
+			for _, sp := range ss.Spans {
+				start := time.Unix(0, int64(sp.StartTimeUnixNano)).UTC()
+				end := time.Unix(0, int64(sp.EndTimeUnixNano)).UTC()
+				kind := ""
+				if sp.Kind != tracepb.Span_SPAN_KIND_UNSPECIFIED {
+					kind = strings.TrimPrefix(sp.Kind.String(), "SPAN_KIND_")
+				}
+				status := statusUnset
+				if sp.Status != nil {
+					status = sp.Status.Code.String()
+				}
+				s := span{
+					Span: storage.Span{
+						TraceID:        fmt.Sprintf("%x", sp.TraceId),
+						SpanID:         fmt.Sprintf("%x", sp.SpanId),
+						ParentSpanID:   fmt.Sprintf("%x", sp.ParentSpanId),
+						OperationName:  sp.Name,
+						Kind:           kind,
+						StartTime:      start,
+						EndTime:        end,
+						Duration:       end.Sub(start).Microseconds(),
+						HasError:       status == statusError,
+						ServiceName:    service,
+						ScopeName:      scopeName,
+						ScopeVersion:   scopeVersion,
+						AttributesJSON: ingest.AttributesJSON(sp.Attributes),
+					},
+					Status: status,
+				}
+				spans = append(spans, s)
+
+				var spanLogs []storage.Log
+				for _, ev := range sp.Events {
+					severity := "INFO"
+					if ev.Name == "exception" {
+						severity = "ERROR"
+					}
+					body := ev.Name
+					for _, kv := range ev.Attributes {
+						if kv.Key == "exception.message" || kv.Key == "message" {
+							body = kv.Value.GetStringValue()
+							break
+						}
+					}
+					spanLogs = append(spanLogs, storage.Log{
+						TraceID:        s.TraceID,
+						SpanID:         s.SpanID,
+						Severity:       severity,
+						Body:           storage.CompressedText(body),
+						ServiceName:    service,
+						ScopeName:      scopeName,
+						ScopeVersion:   scopeVersion,
+						AttributesJSON: ingest.AttributesJSON(ev.Attributes),
+						Timestamp:      time.Unix(0, int64(ev.TimeUnixNano)).UTC(),
+					})
+				}
+				if l, ok := statusLog(s, sp.GetStatus().GetMessage(), spanLogs); ok {
+					spanLogs = append(spanLogs, l)
+				}
+				logs = append(logs, spanLogs...)
+			}
+		}
+	}
+	return groupByTrace(spans, logs)
+}
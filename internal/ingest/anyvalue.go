@@ -0,0 +1,98 @@
+package ingest
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// anyValueText renders v as stored text along with its type: strings pass through,
+// scalars are formatted, and kvlists, arrays and bytes are JSON-encoded. A nil or
+// unset value is "" of type storage.BodyTypeEmpty.
+func anyValueText(v *commonpb.AnyValue) (string, string) {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return x.StringValue, storage.BodyTypeString
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(x.BoolValue), storage.BodyTypeBool
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(x.IntValue, 10), storage.BodyTypeInt
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(x.DoubleValue, 'g', -1, 64), storage.BodyTypeDouble
+	case *commonpb.AnyValue_BytesValue:
+		return jsonText(x.BytesValue), storage.BodyTypeBytes
+	case *commonpb.AnyValue_ArrayValue:
+		return jsonText(anyValueInterface(v)), storage.BodyTypeArray
+	case *commonpb.AnyValue_KvlistValue:
+		return jsonText(anyValueInterface(v)), storage.BodyTypeKvlist
+	}
+	return "", storage.BodyTypeEmpty
+}
+
+// anyValueInterface converts v to plain Go values that encode as clean JSON: kvlists
+// become objects, arrays become lists and bytes become base64 strings. Doubles that
+// JSON cannot represent (NaN, ±Inf) become their string form.
+func anyValueInterface(v *commonpb.AnyValue) any {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return x.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return x.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return x.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		if math.IsNaN(x.DoubleValue) || math.IsInf(x.DoubleValue, 0) {
+			return strconv.FormatFloat(x.DoubleValue, 'g', -1, 64)
+		}
+		return x.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return x.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := x.ArrayValue.GetValues()
+		out := make([]any, len(values))
+		for i, e := range values {
+			out[i] = anyValueInterface(e)
+		}
+		return out
+	case *commonpb.AnyValue_KvlistValue:
+		kvs := x.KvlistValue.GetValues()
+		out := make(map[string]any, len(kvs))
+		for _, kv := range kvs {
+			out[kv.Key] = anyValueInterface(kv.Value)
+		}
+		return out
+	}
+	return nil
+}
+
+// AttributesJSON encodes OTLP attributes as the plain JSON object they are stored as,
+// {"http.method": "GET", "retries": 2}, with values converted by anyValueInterface.
+// No attributes encode as "".
+func AttributesJSON(attrs []*commonpb.KeyValue) storage.CompressedText {
+	if len(attrs) == 0 {
+		return ""
+	}
+	out := make(map[string]any, len(attrs))
+	for _, kv := range attrs {
+		out[kv.Key] = anyValueInterface(kv.Value)
+	}
+	return storage.CompressedText(jsonText(out))
+}
+
+// attributeText renders an attribute value for use as a plain string, e.g. a metric
+// grouping label: strings as is, anything else as in anyValueText.
+func attributeText(v *commonpb.AnyValue) string {
+	s, _ := anyValueText(v)
+	return s
+}
+
+func jsonText(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,191 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/compress"
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func str(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
+
+func intVal(n int64) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: n}}
+}
+
+func kvlist(kvs ...*commonpb.KeyValue) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: kvs}}}
+}
+
+func array(values ...*commonpb.AnyValue) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+}
+
+// bodyFixtures covers every AnyValue variant a log body can carry, as sent by e.g.
+// the zap and logrus OTLP bridges for structured messages.
+var bodyFixtures = []struct {
+	name     string
+	body     *commonpb.AnyValue
+	wantBody string
+	wantType string
+}{
+	{"string", str("payment declined"), "payment declined", storage.BodyTypeString},
+	{"bool", &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}, "true", storage.BodyTypeBool},
+	{"int", intVal(-42), "-42", storage.BodyTypeInt},
+	{"double", &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 0.25}}, "0.25", storage.BodyTypeDouble},
+	{"bytes", &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte("hi")}}, `"aGk="`, storage.BodyTypeBytes},
+	{"array", array(str("a"), intVal(1), array()), `["a",1,[]]`, storage.BodyTypeArray},
+	{"kvlist", kvlist(
+		strAttr("msg", "order placed"),
+		&commonpb.KeyValue{Key: "order", Value: kvlist(&commonpb.KeyValue{Key: "id", Value: intVal(7)})},
+		&commonpb.KeyValue{Key: "tags", Value: array(str("eu"))},
+	), `{"msg":"order placed","order":{"id":7},"tags":["eu"]}`, storage.BodyTypeKvlist},
+	{"unset", &commonpb.AnyValue{}, "", storage.BodyTypeEmpty},
+	{"missing", nil, "", storage.BodyTypeEmpty},
+}
+
+func TestLogsExportBodyTypes(t *testing.T) {
+	store := &memStore{}
+	srv := NewLogsServer(store, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+	now := uint64(time.Now().UnixNano())
+
+	records := make([]*logspb.LogRecord, len(bodyFixtures))
+	for i, f := range bodyFixtures {
+		records[i] = &logspb.LogRecord{TimeUnixNano: now, SeverityText: "INFO", Body: f.body}
+	}
+	_, err := srv.Export(context.Background(), &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "orders")}},
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: records}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(store.logs) != len(bodyFixtures) {
+		t.Fatalf("stored %d logs, want %d", len(store.logs), len(bodyFixtures))
+	}
+	for i, f := range bodyFixtures {
+		l := store.logs[i]
+		if string(l.Body) != f.wantBody || l.BodyType != f.wantType {
+			t.Errorf("%s body stored as %q (%s), want %q (%s)", f.name, l.Body, l.BodyType, f.wantBody, f.wantType)
+		}
+	}
+}
+
+func TestAnyValueInterfaceNonFiniteDoubles(t *testing.T) {
+	v := array(
+		&commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: math.NaN()}},
+		&commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: math.Inf(1)}},
+	)
+	if got, typ := anyValueText(v); got != `["NaN","+Inf"]` || typ != storage.BodyTypeArray {
+		t.Errorf("anyValueText() = %q (%s), want NaN and +Inf as strings", got, typ)
+	}
+}
+
+func TestMetricsExportAttributeValues(t *testing.T) {
+	srv := NewMetricsServer(nil, nil, nil, &config.Config{})
+	var got []tsdb.RawMetric
+	srv.SetMetricCallback(func(raw tsdb.RawMetric) { got = append(got, raw) })
+
+	_, err := srv.Export(context.Background(), &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "orders")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: "requests",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{DataPoints: []*metricspb.NumberDataPoint{{
+					TimeUnixNano: uint64(time.Now().UnixNano()),
+					Value:        &metricspb.NumberDataPoint_AsInt{AsInt: 1},
+					Attributes: []*commonpb.KeyValue{
+						strAttr("http.method", "GET"),
+						{Key: "http.status_code", Value: intVal(200)},
+						{Key: "regions", Value: array(str("eu"), str("us"))},
+					},
+				}}}},
+			}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d points, want 1", len(got))
+	}
+	want := map[string]interface{}{"http.method": "GET", "http.status_code": "200", "regions": `["eu","us"]`}
+	for k, v := range want {
+		if got[0].Attributes[k] != v {
+			t.Errorf("attribute %s = %#v, want %#v", k, got[0].Attributes[k], v)
+		}
+	}
+}
+
+func TestAttributesJSON(t *testing.T) {
+	attrs := []*commonpb.KeyValue{
+		strAttr("http.method", "GET"),
+		{Key: "http.status_code", Value: intVal(503)},
+		{Key: "retried", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: false}}},
+		{Key: "ratio", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 0.25}}},
+		{Key: "inf", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: math.Inf(-1)}}},
+		{Key: "token", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte("hi")}}},
+		{Key: "big", Value: intVal(math.MaxInt64)},
+		{Key: "regions", Value: array(str("eu"), intVal(1), array())},
+		{Key: "user", Value: kvlist(
+			strAttr("id", "u-1"),
+			&commonpb.KeyValue{Key: "plan", Value: kvlist(&commonpb.KeyValue{Key: "seats", Value: intVal(5)})},
+			&commonpb.KeyValue{Key: "roles", Value: array(kvlist(strAttr("name", "admin")))},
+		)},
+		{Key: "unset", Value: &commonpb.AnyValue{}},
+		{Key: "missing"},
+	}
+	want := `{"big":9223372036854775807,"http.method":"GET","http.status_code":503,"inf":"-Inf","missing":null,` +
+		`"ratio":0.25,"regions":["eu",1,[]],"retried":false,"token":"aGk=","unset":null,` +
+		`"user":{"id":"u-1","plan":{"seats":5},"roles":[{"name":"admin"}]}}`
+	if got := string(AttributesJSON(attrs)); got != want {
+		t.Errorf("AttributesJSON() =\n%s\nwant\n%s", got, want)
+	}
+	if got := AttributesJSON(nil); got != "" {
+		t.Errorf("AttributesJSON(nil) = %q, want empty", got)
+	}
+}
+
+// TestAttributesJSONSize compares the stored attributes of a typical HTTP server span
+// with the protobuf structs json.Marshal wrote before.
+func TestAttributesJSONSize(t *testing.T) {
+	attrs := []*commonpb.KeyValue{
+		strAttr("http.request.method", "POST"),
+		strAttr("url.path", "/api/v1/orders"),
+		strAttr("url.scheme", "https"),
+		strAttr("server.address", "orders.internal"),
+		{Key: "server.port", Value: intVal(8443)},
+		{Key: "http.response.status_code", Value: intVal(201)},
+		strAttr("user_agent.original", "okhttp/4.12.0"),
+		strAttr("network.protocol.version", "1.1"),
+		{Key: "http.request.header.x-tenant", Value: array(str("acme"))},
+	}
+	legacy, err := json.Marshal(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean := []byte(AttributesJSON(attrs))
+	legacyZ, cleanZ := len(compress.Compress(legacy)), len(compress.Compress(clean))
+	t.Logf("attributes: %d bytes, was %d (%.0f%% smaller); compressed %d bytes, was %d (%.0f%% smaller)",
+		len(clean), len(legacy), 100-100*float64(len(clean))/float64(len(legacy)),
+		cleanZ, legacyZ, 100-100*float64(cleanZ)/float64(legacyZ))
+	if len(clean)*2 > len(legacy) || cleanZ >= legacyZ {
+		t.Errorf("attributes take %d bytes (%d compressed), want well under the %d (%d) of the protobuf structs", len(clean), cleanZ, len(legacy), legacyZ)
+	}
+}
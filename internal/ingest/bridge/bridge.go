@@ -0,0 +1,179 @@
+// Package bridge consumes JSON log messages from a message broker and stores them
+// as logs, for platforms that already ship their logs to a broker rather than to an
+// OTLP endpoint.
+package bridge
+
+import (
+	"context"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/logging"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+var logger = logging.Component("bridge")
+
+// Message is one message consumed from a broker.
+type Message struct {
+	Data []byte
+	ID   string // source-specific handle passed back to Commit, e.g. an ack subject
+}
+
+// Source is a broker subscription. Messages are delivered at least once: those not
+// committed are delivered again, to this or another consumer of the group.
+type Source interface {
+	// Fetch returns up to max messages, waiting at most wait for the first one.
+	Fetch(ctx context.Context, max int, wait time.Duration) ([]Message, error)
+	// Commit acknowledges msgs, which are then not delivered again.
+	Commit(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+// Message results, as labeled on OtelContext_bridge_messages_total.
+const (
+	ResultStored   = "stored"
+	ResultFiltered = "filtered"
+	ResultSpilled  = "spilled"
+	ResultFailed   = "failed"
+)
+
+// Bridge reads messages from a Source in batches, maps them onto logs and stores
+// them. A batch is committed only once its logs are stored, or spilled to the dead
+// letter queue when storing fails; if both fail it is left for redelivery.
+type Bridge struct {
+	src           Source
+	repo          storage.LogWriter
+	mapping       Mapping
+	batchSize     int
+	flushInterval time.Duration
+	maxBodyBytes  int                       // bodies are cut to this size (0 = no limit)
+	filters       *ingest.Filters           // nil = every log is kept
+	logCallback   func([]storage.Log)       // called with each stored batch of logs
+	deadLetter    func([]storage.Log) error // nil = failed batches are redelivered
+	onResult      func(result string, n int)
+}
+
+// New creates a bridge that stores the messages of src, mapped by mapping, in
+// batches of up to batchSize messages, flushing a partial batch after flushInterval.
+func New(src Source, repo storage.LogWriter, mapping Mapping, batchSize int, flushInterval time.Duration) *Bridge {
+	return &Bridge{
+		src:           src,
+		repo:          repo,
+		mapping:       mapping,
+		batchSize:     max(batchSize, 1),
+		flushInterval: flushInterval,
+	}
+}
+
+// SetMaxBodyBytes cuts longer bodies at ingest, as LOG_MAX_BODY_BYTES does for OTLP.
+func (b *Bridge) SetMaxBodyBytes(n int) {
+	b.maxBodyBytes = n
+}
+
+// SetFilters applies the ingest filters shared with the OTLP receivers.
+func (b *Bridge) SetFilters(f *ingest.Filters) {
+	b.filters = f
+}
+
+// SetLogCallback sets the function to call with each batch of logs after it is
+// stored, as the OTLP receivers do.
+func (b *Bridge) SetLogCallback(cb func([]storage.Log)) {
+	b.logCallback = cb
+}
+
+// SetDeadLetter sets where batches go that cannot be stored.
+func (b *Bridge) SetDeadLetter(fn func([]storage.Log) error) {
+	b.deadLetter = fn
+}
+
+// SetMetrics sets a callback counting messages by result (ResultStored, ...).
+func (b *Bridge) SetMetrics(onResult func(result string, n int)) {
+	b.onResult = onResult
+}
+
+// Start consumes messages until ctx is cancelled, then stores what it has already
+// fetched and closes the source.
+func (b *Bridge) Start(ctx context.Context) {
+	defer b.src.Close()
+
+	var pending []Message
+	var first time.Time // when the oldest pending message was fetched
+	backoff := time.Second
+	for ctx.Err() == nil {
+		wait := b.flushInterval
+		if len(pending) > 0 {
+			wait = max(b.flushInterval-time.Since(first), 0)
+		}
+		msgs, err := b.src.Fetch(ctx, b.batchSize-len(pending), wait)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("Failed to fetch messages", "error", err, "retry_in", backoff)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+		if len(pending) == 0 && len(msgs) > 0 {
+			first = time.Now()
+		}
+		pending = append(pending, msgs...)
+		if len(pending) >= b.batchSize || (len(pending) > 0 && time.Since(first) >= b.flushInterval) {
+			b.flush(ctx, pending)
+			pending = nil
+		}
+	}
+	if len(pending) > 0 {
+		b.flush(context.WithoutCancel(ctx), pending)
+	}
+}
+
+// flush stores the logs of msgs and commits them, or leaves them uncommitted when
+// they could neither be stored nor spilled.
+func (b *Bridge) flush(ctx context.Context, msgs []Message) {
+	logs := make([]storage.Log, 0, len(msgs))
+	for _, m := range msgs {
+		l := b.mapping.Log(m.Data, b.maxBodyBytes)
+		if b.filters != nil && !b.filters.AllowLog(l.ServiceName, l.Severity) {
+			continue
+		}
+		logs = append(logs, l)
+	}
+	b.count(ResultFiltered, len(msgs)-len(logs))
+
+	if len(logs) > 0 {
+		if err := b.repo.BatchCreateLogs(logs); err != nil {
+			if b.deadLetter == nil {
+				logger.Error("Failed to store bridged logs; leaving them for redelivery", "logs", len(logs), "error", err)
+				b.count(ResultFailed, len(logs))
+				return
+			}
+			if dlqErr := b.deadLetter(logs); dlqErr != nil {
+				logger.Error("Failed to store or spill bridged logs; leaving them for redelivery", "logs", len(logs), "error", err, "dlq_error", dlqErr)
+				b.count(ResultFailed, len(logs))
+				return
+			}
+			logger.Warn("Failed to store bridged logs; spilled to the DLQ", "logs", len(logs), "error", err)
+			b.count(ResultSpilled, len(logs))
+		} else {
+			b.count(ResultStored, len(logs))
+			if b.logCallback != nil {
+				b.logCallback(logs)
+			}
+		}
+	}
+
+	if err := b.src.Commit(ctx, msgs); err != nil {
+		// The logs are kept. Redelivered copies of messages that carry a timestamp are
+		// then skipped as duplicates; those without one are stored twice.
+		logger.Warn("Failed to commit bridged messages", "messages", len(msgs), "error", err)
+	}
+}
+
+func (b *Bridge) count(result string, n int) {
+	if b.onResult != nil && n > 0 {
+		b.onResult(result, n)
+	}
+}
@@ -0,0 +1,183 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// stubSource hands out queued messages and records commits.
+type stubSource struct {
+	mu        sync.Mutex
+	queue     []Message
+	committed []string
+	fetches   int
+	closed    bool
+}
+
+func (s *stubSource) Fetch(ctx context.Context, max int, wait time.Duration) ([]Message, error) {
+	s.mu.Lock()
+	s.fetches++
+	n := min(max, len(s.queue))
+	msgs := s.queue[:n]
+	s.queue = s.queue[n:]
+	s.mu.Unlock()
+	if n == 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+	return msgs, nil
+}
+
+func (s *stubSource) Commit(_ context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		s.committed = append(s.committed, m.ID)
+	}
+	return nil
+}
+
+func (s *stubSource) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *stubSource) commits() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.committed...)
+}
+
+type stubWriter struct {
+	mu   sync.Mutex
+	logs []storage.Log
+	err  error
+}
+
+func (w *stubWriter) BatchCreateLogs(logs []storage.Log) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.logs = append(w.logs, logs...)
+	return nil
+}
+
+func messages(n int) []Message {
+	msgs := make([]Message, n)
+	for i := range msgs {
+		msgs[i] = Message{Data: fmt.Appendf(nil, `{"level":"info","msg":"m%d","service":"api"}`, i), ID: fmt.Sprint(i)}
+	}
+	return msgs
+}
+
+func TestBridgeStoresInBatchesAndCommits(t *testing.T) {
+	src := &stubSource{queue: messages(5)}
+	w := &stubWriter{}
+	b := New(src, w, presets["logrus"], 2, 20*time.Millisecond)
+	var callbacks int
+	b.SetLogCallback(func([]storage.Log) { callbacks++ })
+	results := map[string]int{}
+	b.SetMetrics(func(result string, n int) { results[result] += n })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Start(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(src.commits()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(w.logs) != 5 {
+		t.Fatalf("stored %d logs, want 5", len(w.logs))
+	}
+	if got := src.commits(); len(got) != 5 {
+		t.Errorf("committed %v, want all 5 messages", got)
+	}
+	if callbacks != 3 {
+		t.Errorf("log callback called %d times, want 3 (batches of 2, 2 and 1)", callbacks)
+	}
+	if results[ResultStored] != 5 {
+		t.Errorf("results = %v, want 5 stored", results)
+	}
+	if !src.closed {
+		t.Error("source not closed on exit")
+	}
+}
+
+func TestBridgeFlushFailures(t *testing.T) {
+	storeErr := errors.New("database is locked")
+
+	t.Run("spilled", func(t *testing.T) {
+		src := &stubSource{}
+		b := New(src, &stubWriter{err: storeErr}, presets["logrus"], 10, time.Second)
+		var spilled []storage.Log
+		b.SetDeadLetter(func(logs []storage.Log) error {
+			spilled = append(spilled, logs...)
+			return nil
+		})
+		b.flush(context.Background(), messages(3))
+		if len(spilled) != 3 {
+			t.Errorf("spilled %d logs, want 3", len(spilled))
+		}
+		if len(src.commits()) != 3 {
+			t.Errorf("spilled messages not committed")
+		}
+	})
+
+	t.Run("redelivered", func(t *testing.T) {
+		src := &stubSource{}
+		b := New(src, &stubWriter{err: storeErr}, presets["logrus"], 10, time.Second)
+		b.SetDeadLetter(func([]storage.Log) error { return errors.New("disk full") })
+		results := map[string]int{}
+		b.SetMetrics(func(result string, n int) { results[result] += n })
+		b.flush(context.Background(), messages(3))
+		if got := src.commits(); len(got) != 0 {
+			t.Errorf("committed %v although the logs were neither stored nor spilled", got)
+		}
+		if results[ResultFailed] != 3 {
+			t.Errorf("results = %v, want 3 failed", results)
+		}
+	})
+}
+
+func TestBridgeAppliesFilters(t *testing.T) {
+	src := &stubSource{}
+	w := &stubWriter{}
+	b := New(src, w, presets["logrus"], 10, time.Second)
+	b.SetFilters(ingest.NewFilters(&config.Config{IngestMinSeverity: "WARN"}))
+	results := map[string]int{}
+	b.SetMetrics(func(result string, n int) { results[result] += n })
+
+	b.flush(context.Background(), []Message{
+		{Data: []byte(`{"level":"info","msg":"dropped"}`), ID: "1"},
+		{Data: []byte(`{"level":"error","msg":"kept"}`), ID: "2"},
+	})
+	if len(w.logs) != 1 || string(w.logs[0].Body) != "kept" {
+		t.Errorf("stored %+v, want only the error log", w.logs)
+	}
+	if got := src.commits(); len(got) != 2 {
+		t.Errorf("committed %v, want filtered messages committed too", got)
+	}
+	if results[ResultFiltered] != 1 || results[ResultStored] != 1 {
+		t.Errorf("results = %v, want 1 filtered and 1 stored", results)
+	}
+}
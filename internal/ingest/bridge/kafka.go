@@ -0,0 +1,233 @@
+package bridge
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// kafkaRedeliverAfter is how long a fetched message may stay uncommitted before the
+// source rejoins its group to fetch it again, as JetStream redelivers past the ack wait.
+const kafkaRedeliverAfter = time.Minute
+
+// KafkaOptions are the connection settings of a KafkaSource besides its brokers.
+type KafkaOptions struct {
+	TLS           bool   // connect over TLS; implied by CAFile
+	CAFile        string // PEM roots to verify the brokers with ("" = the system roots)
+	SASLMechanism string // "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512" ("" = none)
+	Username      string
+	Password      string
+}
+
+// KafkaSource consumes topics as a member of a consumer group, starting at the
+// earliest offset when the group has none committed. Offsets are committed only by
+// Commit, never automatically. It is not safe for concurrent use.
+type KafkaSource struct {
+	opts []kgo.Opt
+
+	cl       *kgo.Client
+	inFlight map[string]fetchedRecord // fetched but not committed, by Message.ID
+}
+
+// fetchedRecord is a record awaiting Commit.
+type fetchedRecord struct {
+	rec *kgo.Record
+	at  time.Time
+}
+
+// NewKafkaSource creates a source reading topics, comma-separated, as a member of
+// group. brokers is a comma-separated list of host:port seed brokers.
+func NewKafkaSource(brokers, topics, group string, o KafkaOptions) (*KafkaSource, error) {
+	var seeds []string
+	for _, b := range strings.Split(brokers, ",") {
+		b = strings.TrimSpace(b)
+		if host, port, err := net.SplitHostPort(b); err != nil || host == "" || port == "" {
+			return nil, fmt.Errorf("invalid Kafka broker %q: must be host:port", b)
+		}
+		seeds = append(seeds, b)
+	}
+	var names []string
+	for _, t := range strings.Split(topics, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			names = append(names, t)
+		}
+	}
+	if len(names) == 0 || group == "" {
+		return nil, errors.New("a Kafka topic and consumer group are required")
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(seeds...),
+		kgo.ClientID("otelcontext-bridge"),
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeTopics(names...),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.DisableAutoCommit(),
+	}
+	if o.TLS || o.CAFile != "" {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if o.CAFile != "" {
+			pem, err := os.ReadFile(o.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read Kafka CA file: %w", err)
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in Kafka CA file %s", o.CAFile)
+			}
+		}
+		opts = append(opts, kgo.DialTLSConfig(cfg))
+	}
+	if o.SASLMechanism != "" {
+		mech, err := saslMechanism(o)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mech))
+	}
+	return &KafkaSource{opts: opts, inFlight: make(map[string]fetchedRecord)}, nil
+}
+
+func saslMechanism(o KafkaOptions) (sasl.Mechanism, error) {
+	if o.Username == "" {
+		return nil, errors.New("SASL needs a Kafka username")
+	}
+	switch strings.ToUpper(o.SASLMechanism) {
+	case "PLAIN":
+		return plain.Auth{User: o.Username, Pass: o.Password}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: o.Username, Pass: o.Password}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: o.Username, Pass: o.Password}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unknown Kafka SASL mechanism %q: must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", o.SASLMechanism)
+	}
+}
+
+// Fetch polls up to max records, waiting at most wait for them.
+func (s *KafkaSource) Fetch(ctx context.Context, max int, wait time.Duration) ([]Message, error) {
+	s.redeliverExpired()
+	if s.cl == nil {
+		cl, err := kgo.NewClient(s.opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create Kafka client: %w", err)
+		}
+		s.cl = cl
+	}
+
+	var fetches kgo.Fetches
+	if wait <= 0 {
+		fetches = s.cl.PollRecords(nil, max) // a nil context returns what is already buffered
+	} else {
+		pollCtx, cancel := context.WithTimeout(ctx, wait)
+		defer cancel()
+		fetches = s.cl.PollRecords(pollCtx, max)
+	}
+
+	var msgs []Message
+	fetches.EachRecord(func(r *kgo.Record) {
+		id := fmt.Sprintf("%s/%d/%d", r.Topic, r.Partition, r.Offset)
+		s.inFlight[id] = fetchedRecord{rec: r, at: time.Now()}
+		msgs = append(msgs, Message{Data: r.Value, ID: id})
+	})
+	var errs []error
+	fetches.EachError(func(topic string, partition int32, err error) {
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+			errs = append(errs, fmt.Errorf("%s[%d]: %w", topic, partition, err))
+		}
+	})
+	if ctx.Err() != nil {
+		return msgs, ctx.Err()
+	}
+	if err := errors.Join(errs...); err != nil {
+		return msgs, fmt.Errorf("fetch: %w", err)
+	}
+	return msgs, nil
+}
+
+// Commit commits the offsets past msgs. Kafka offsets cover every earlier record of
+// a partition too, so a partition is committed only up to its oldest record still
+// uncommitted; that one and those after it are fetched again after a rejoin.
+func (s *KafkaSource) Commit(ctx context.Context, msgs []Message) error {
+	offsets := make(map[string]map[int32]kgo.EpochOffset)
+	for _, m := range msgs {
+		f, ok := s.inFlight[m.ID]
+		if !ok {
+			continue // fetched before a rejoin, so fetched again anyway
+		}
+		delete(s.inFlight, m.ID)
+		r := f.rec
+		if offsets[r.Topic] == nil {
+			offsets[r.Topic] = make(map[int32]kgo.EpochOffset)
+		}
+		next := kgo.EpochOffset{Epoch: r.LeaderEpoch, Offset: r.Offset + 1}
+		if at, ok := offsets[r.Topic][r.Partition]; !ok || at.Less(next) {
+			offsets[r.Topic][r.Partition] = next
+		}
+	}
+	for _, f := range s.inFlight {
+		r := f.rec
+		if at, ok := offsets[r.Topic][r.Partition]; ok && r.Offset < at.Offset {
+			offsets[r.Topic][r.Partition] = kgo.EpochOffset{Epoch: r.LeaderEpoch, Offset: r.Offset}
+		}
+	}
+	if len(offsets) == 0 || s.cl == nil {
+		return nil
+	}
+
+	var commitErr error
+	s.cl.CommitOffsetsSync(ctx, offsets, func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+		if err != nil {
+			commitErr = err
+			return
+		}
+		for _, t := range resp.Topics {
+			for _, p := range t.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+					commitErr = fmt.Errorf("%s[%d]: %w", t.Topic, p.Partition, err)
+					return
+				}
+			}
+		}
+	})
+	if commitErr != nil {
+		return fmt.Errorf("commit offsets: %w", commitErr)
+	}
+	return nil
+}
+
+// Close leaves the group.
+func (s *KafkaSource) Close() error {
+	if s.cl != nil {
+		s.cl.Close()
+		s.cl = nil
+	}
+	return nil
+}
+
+// redeliverExpired leaves the group when a message has stayed uncommitted for
+// kafkaRedeliverAfter, e.g. after a batch that could not be stored, so that the next
+// Fetch rejoins and resumes from the committed offsets.
+func (s *KafkaSource) redeliverExpired() {
+	for _, f := range s.inFlight {
+		if time.Since(f.at) > kafkaRedeliverAfter {
+			logger.Warn("Rejoining the Kafka group to fetch uncommitted messages again", "messages", len(s.inFlight))
+			s.Close()
+			clear(s.inFlight)
+			return
+		}
+	}
+}
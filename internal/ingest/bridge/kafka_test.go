@@ -0,0 +1,175 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// newKafkaCluster starts an in-process cluster with a one-partition "logs" topic and
+// returns its broker address.
+func newKafkaCluster(t *testing.T, opts ...kfake.Opt) string {
+	t.Helper()
+	c, err := kfake.NewCluster(append([]kfake.Opt{kfake.NumBrokers(1), kfake.SeedTopics(1, "logs")}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c.ListenAddrs()[0]
+}
+
+// produceKafka writes values to the "logs" topic.
+func produceKafka(t *testing.T, addr string, values []string, opts ...kgo.Opt) {
+	t.Helper()
+	cl, err := kgo.NewClient(append([]kgo.Opt{kgo.SeedBrokers(addr), kgo.DefaultProduceTopic("logs")}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	for _, v := range values {
+		if err := cl.ProduceSync(context.Background(), &kgo.Record{Value: []byte(v)}).FirstErr(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestKafkaSource(t *testing.T, addr string, o KafkaOptions) *KafkaSource {
+	t.Helper()
+	src, err := NewKafkaSource(addr, "logs", "otelcontext", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { src.Close() })
+	return src
+}
+
+// fetchKafka fetches until it has n messages, failing after 10s.
+func fetchKafka(t *testing.T, src *KafkaSource, n int) []Message {
+	t.Helper()
+	var msgs []Message
+	deadline := time.Now().Add(10 * time.Second)
+	for len(msgs) < n && time.Now().Before(deadline) {
+		got, err := src.Fetch(context.Background(), n-len(msgs), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, got...)
+	}
+	if len(msgs) != n {
+		t.Fatalf("fetched %d messages, want %d", len(msgs), n)
+	}
+	return msgs
+}
+
+func dataOf(msgs []Message) []string {
+	var vs []string
+	for _, m := range msgs {
+		vs = append(vs, string(m.Data))
+	}
+	return vs
+}
+
+func TestKafkaSourceFetchAndCommit(t *testing.T) {
+	addr := newKafkaCluster(t)
+	produceKafka(t, addr, []string{`{"msg":"a"}`, `{"msg":"b"}`, `{"msg":"c"}`, `{"msg":"d"}`})
+	ctx := context.Background()
+
+	src := newTestKafkaSource(t, addr, KafkaOptions{})
+	msgs := fetchKafka(t, src, 2)
+	if vs := dataOf(msgs); vs[0] != `{"msg":"a"}` || vs[1] != `{"msg":"b"}` || msgs[0].ID == "" {
+		t.Fatalf("first fetch = %+v, want a and b with IDs", msgs)
+	}
+	if err := src.Commit(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	// Committing d alone must not commit past c, which was fetched before it
+	msgs = fetchKafka(t, src, 2)
+	if err := src.Commit(ctx, msgs[1:]); err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+
+	src = newTestKafkaSource(t, addr, KafkaOptions{})
+	msgs = fetchKafka(t, src, 2)
+	if vs := dataOf(msgs); vs[0] != `{"msg":"c"}` || vs[1] != `{"msg":"d"}` {
+		t.Fatalf("fetch after rejoining = %v, want c and d again", vs)
+	}
+	if err := src.Commit(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+
+	src = newTestKafkaSource(t, addr, KafkaOptions{})
+	if msgs, err := src.Fetch(ctx, 10, time.Second); err != nil || len(msgs) != 0 {
+		t.Fatalf("fetch of a fully committed topic = %v, %v", dataOf(msgs), err)
+	}
+}
+
+func TestKafkaSourceRedeliversUncommitted(t *testing.T) {
+	addr := newKafkaCluster(t)
+	produceKafka(t, addr, []string{`{"msg":"a"}`})
+	src := newTestKafkaSource(t, addr, KafkaOptions{})
+	fetchKafka(t, src, 1)
+
+	for id, f := range src.inFlight {
+		f.at = f.at.Add(-2 * kafkaRedeliverAfter)
+		src.inFlight[id] = f
+	}
+	msgs := fetchKafka(t, src, 1)
+	if vs := dataOf(msgs); vs[0] != `{"msg":"a"}` {
+		t.Fatalf("fetch after the redelivery delay = %v, want a again", vs)
+	}
+}
+
+func TestKafkaSourceSASL(t *testing.T) {
+	addr := newKafkaCluster(t, kfake.EnableSASL(), kfake.Superuser("SCRAM-SHA-256", "bridge", "s3cret"))
+	produceKafka(t, addr, []string{`{"msg":"a"}`}, kgo.SASL(scram.Auth{User: "bridge", Pass: "s3cret"}.AsSha256Mechanism()))
+	src := newTestKafkaSource(t, addr, KafkaOptions{SASLMechanism: "scram-sha-256", Username: "bridge", Password: "s3cret"})
+	fetchKafka(t, src, 1)
+}
+
+func TestKafkaSourceCancel(t *testing.T) {
+	src := newTestKafkaSource(t, newKafkaCluster(t), KafkaOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := src.Fetch(ctx, 10, time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Fetch error = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Fetch did not return promptly on cancel")
+	}
+}
+
+func TestNewKafkaSource(t *testing.T) {
+	if _, err := NewKafkaSource("kafka-a:9092, kafka-b:9092", "logs,audit", "g", KafkaOptions{TLS: true, SASLMechanism: "PLAIN", Username: "u"}); err != nil {
+		t.Errorf("NewKafkaSource with a broker list: %v", err)
+	}
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(ca, []byte("not a certificate"), 0o600)
+	for name, args := range map[string]struct {
+		brokers, topics, group string
+		o                      KafkaOptions
+	}{
+		"no port":       {"kafka", "logs", "g", KafkaOptions{}},
+		"empty broker":  {"kafka:9092,", "logs", "g", KafkaOptions{}},
+		"no topic":      {"kafka:9092", " , ", "g", KafkaOptions{}},
+		"no group":      {"kafka:9092", "logs", "", KafkaOptions{}},
+		"bad CA":        {"kafka:9092", "logs", "g", KafkaOptions{CAFile: ca}},
+		"missing CA":    {"kafka:9092", "logs", "g", KafkaOptions{CAFile: ca + ".missing"}},
+		"bad mechanism": {"kafka:9092", "logs", "g", KafkaOptions{SASLMechanism: "GSSAPI", Username: "u"}},
+		"SASL, no user": {"kafka:9092", "logs", "g", KafkaOptions{SASLMechanism: "PLAIN"}},
+	} {
+		if _, err := NewKafkaSource(args.brokers, args.topics, args.group, args.o); err == nil {
+			t.Errorf("%s: NewKafkaSource succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+// Mapping names the message fields a log is read from. A name may be a dotted path
+// into nested objects, e.g. "kubernetes.labels.app".
+type Mapping struct {
+	Timestamp string
+	Severity  string
+	Message   string
+	Service   string
+	TraceID   string
+	SpanID    string
+}
+
+// Mapping presets for the JSON written by common Go loggers.
+var presets = map[string]Mapping{
+	// logrus.JSONFormatter: {"time":"2026-10-15T12:00:00Z","level":"error","msg":"..."}
+	"logrus": {Timestamp: "time", Severity: "level", Message: "msg", Service: "service", TraceID: "trace_id", SpanID: "span_id"},
+	// zap.NewProductionConfig: {"ts":1760529600.123,"level":"error","msg":"..."}
+	"zap": {Timestamp: "ts", Severity: "level", Message: "msg", Service: "service", TraceID: "trace_id", SpanID: "span_id"},
+}
+
+// ParseMapping parses a mapping spec: an optional preset name ("logrus", the
+// default, or "zap") followed by field=path overrides, e.g. "zap,service=app.name".
+// The fields are timestamp, severity, message, service, trace_id and span_id.
+func ParseMapping(spec string) (Mapping, error) {
+	m := presets["logrus"]
+	for i, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field, path, ok := strings.Cut(part, "=")
+		if !ok {
+			p, known := presets[part]
+			if !known || i > 0 {
+				return Mapping{}, fmt.Errorf("%q is not a preset (logrus or zap) or field=path", part)
+			}
+			m = p
+			continue
+		}
+		field, path = strings.TrimSpace(field), strings.TrimSpace(path)
+		if path == "" {
+			return Mapping{}, fmt.Errorf("%s has no path", field)
+		}
+		switch field {
+		case "timestamp":
+			m.Timestamp = path
+		case "severity":
+			m.Severity = path
+		case "message":
+			m.Message = path
+		case "service":
+			m.Service = path
+		case "trace_id":
+			m.TraceID = path
+		case "span_id":
+			m.SpanID = path
+		default:
+			return Mapping{}, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return m, nil
+}
+
+// Log maps one message onto a log. Fields the mapping does not use become the log's
+// attributes. A message that is not a JSON object is stored as an INFO log with the
+// message as body; one without the message field keeps the whole object as body.
+func (m Mapping) Log(data []byte, maxBodyBytes int) storage.Log {
+	l := storage.Log{
+		TenantID:    tenant.Default,
+		Severity:    storage.SeverityInfo,
+		ServiceName: "unknown-service",
+		Timestamp:   time.Now().UTC(),
+	}
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keeps nanosecond timestamps exact
+	if dec.Decode(&fields) != nil || fields == nil {
+		l.Body, l.BodyType = storage.CompressedText(data), storage.BodyTypeString
+		return limitBody(l, nil, maxBodyBytes)
+	}
+
+	if v, ok := take(fields, m.Timestamp); ok {
+		if ts, ok := parseTimestamp(v); ok {
+			l.Timestamp = ts
+		}
+	}
+	if v, ok := take(fields, m.Severity); ok {
+		l.RawSeverity = text(v)
+		if s, ok := storage.CanonicalSeverity(l.RawSeverity); ok {
+			l.Severity = s
+		}
+	}
+	if v, ok := take(fields, m.Service); ok && text(v) != "" {
+		l.ServiceName = text(v)
+	}
+	if v, ok := take(fields, m.TraceID); ok {
+		l.TraceID = strings.ToLower(text(v))
+	}
+	if v, ok := take(fields, m.SpanID); ok {
+		l.SpanID = strings.ToLower(text(v))
+	}
+	if v, ok := take(fields, m.Message); ok {
+		l.Body, l.BodyType = storage.CompressedText(text(v)), storage.BodyTypeString
+	} else {
+		body, _ := json.Marshal(fields)
+		l.Body, l.BodyType = storage.CompressedText(body), storage.BodyTypeKvlist
+		fields = nil
+	}
+	return limitBody(l, fields, maxBodyBytes)
+}
+
+// limitBody cuts l's body to maxBodyBytes and stores attrs, recording the original
+// size of a cut body as the OTLP receiver does.
+func limitBody(l storage.Log, attrs map[string]any, maxBodyBytes int) storage.Log {
+	body, cut := storage.TruncateText(string(l.Body), maxBodyBytes)
+	if cut {
+		if attrs == nil {
+			attrs = map[string]any{}
+		}
+		attrs[ingest.OriginalBodySizeAttr] = len(l.Body)
+		l.Body, l.Truncated = storage.CompressedText(body), true
+	}
+	if len(attrs) > 0 {
+		data, _ := json.Marshal(attrs)
+		l.AttributesJSON = storage.CompressedText(data)
+	}
+	return l
+}
+
+// take removes the value at the dotted path from fields and returns it.
+func take(fields map[string]any, path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	if v, ok := fields[path]; ok { // keys may contain dots themselves
+		delete(fields, path)
+		return v, true
+	}
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		return nil, false
+	}
+	inner, ok := fields[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	v, ok := take(inner, rest)
+	if ok && len(inner) == 0 {
+		delete(fields, head)
+	}
+	return v, ok
+}
+
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case json.Number:
+		return v.String()
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// parseTimestamp reads an RFC 3339 string or a Unix time in seconds (zap's
+// default, may be fractional), milliseconds, microseconds or nanoseconds, told
+// apart by magnitude.
+func parseTimestamp(v any) (time.Time, bool) {
+	s := text(v)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UTC(), true
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch abs := max(n, -n); {
+		case abs < 1e11:
+			return time.Unix(n, 0).UTC(), true
+		case abs < 1e14:
+			return time.UnixMilli(n).UTC(), true
+		case abs < 1e17:
+			return time.UnixMicro(n).UTC(), true
+		default:
+			return time.Unix(0, n).UTC(), true
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && math.Abs(f) < 1e11 {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3).UTC(), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func attrs(t *testing.T, l storage.Log) map[string]any {
+	t.Helper()
+	if l.AttributesJSON == "" {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal([]byte(l.AttributesJSON), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMappingPresets(t *testing.T) {
+	logrus, _ := ParseMapping("")
+	l := logrus.Log([]byte(`{"time":"2026-10-15T12:00:00.5Z","level":"warning","msg":"disk almost full","service":"billing","trace_id":"ABCD","span_id":"12","disk":"/data"}`), 0)
+	want := time.Date(2026, 10, 15, 12, 0, 0, 5e8, time.UTC)
+	if !l.Timestamp.Equal(want) || l.Severity != storage.SeverityWarn || l.RawSeverity != "warning" ||
+		string(l.Body) != "disk almost full" || l.ServiceName != "billing" || l.TraceID != "abcd" || l.SpanID != "12" {
+		t.Errorf("logrus log = %+v", l)
+	}
+	if a := attrs(t, l); len(a) != 1 || a["disk"] != "/data" {
+		t.Errorf("attributes = %v, want only the unmapped field", a)
+	}
+
+	zap, _ := ParseMapping("zap")
+	l = zap.Log([]byte(`{"ts":1760529600.25,"level":"error","msg":"boom"}`), 0)
+	if want := time.Unix(1760529600, 25e7).UTC(); !l.Timestamp.Equal(want) || l.Severity != storage.SeverityError {
+		t.Errorf("zap log = %+v, want timestamp %v and ERROR", l, want)
+	}
+	if l.ServiceName != "unknown-service" {
+		t.Errorf("service = %q, want unknown-service", l.ServiceName)
+	}
+}
+
+func TestParseMappingOverrides(t *testing.T) {
+	m, err := ParseMapping("zap, service=kubernetes.labels.app, message=log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := m.Log([]byte(`{"ts":1760529600,"log":"ready","kubernetes":{"labels":{"app":"cart","tier":"web"}}}`), 0)
+	if l.ServiceName != "cart" || string(l.Body) != "ready" {
+		t.Errorf("log = %+v", l)
+	}
+	if a := attrs(t, l); a["kubernetes"].(map[string]any)["labels"].(map[string]any)["tier"] != "web" {
+		t.Errorf("attributes = %v, want the remaining nested fields", a)
+	}
+
+	for _, spec := range []string{"bunyan", "service=", "host=hostname", "service=app,zap"} {
+		if _, err := ParseMapping(spec); err == nil {
+			t.Errorf("ParseMapping(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestMappingUnstructured(t *testing.T) {
+	m := presets["logrus"]
+	l := m.Log([]byte("plain text line"), 0)
+	if string(l.Body) != "plain text line" || l.Severity != storage.SeverityInfo || l.BodyType != storage.BodyTypeString {
+		t.Errorf("non-JSON log = %+v", l)
+	}
+
+	l = m.Log([]byte(`{"level":"info","event":"login","user":"ana"}`), 0)
+	if l.BodyType != storage.BodyTypeKvlist || !strings.Contains(string(l.Body), `"user":"ana"`) || l.AttributesJSON != "" {
+		t.Errorf("log without message = %+v, want the object as body", l)
+	}
+
+	l = m.Log([]byte(`{"msg":"`+strings.Repeat("x", 100)+`"}`), 10)
+	if !l.Truncated || !strings.HasPrefix(string(l.Body), strings.Repeat("x", 10)+"...[truncated 90 bytes]") {
+		t.Errorf("body not cut: %q", l.Body)
+	}
+	if a := attrs(t, l); a[ingest.OriginalBodySizeAttr] != float64(100) {
+		t.Errorf("attributes = %v, want the original body size", a)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	sec := time.Date(2025, 10, 15, 12, 0, 0, 0, time.UTC)
+	for in, want := range map[string]time.Time{
+		"2025-10-15T14:00:00+02:00": sec,
+		"1760529600":                sec,
+		"1760529600123":             sec.Add(123 * time.Millisecond),
+		"1760529600123456":          sec.Add(123456 * time.Microsecond),
+		"1760529600123456789":       sec.Add(123456789),
+	} {
+		got, ok := parseTimestamp(json.Number(in))
+		if !ok || !got.Equal(want) {
+			t.Errorf("parseTimestamp(%s) = %v, %v; want %v", in, got, ok, want)
+		}
+	}
+	if _, ok := parseTimestamp("yesterday"); ok {
+		t.Error("parseTimestamp accepted garbage")
+	}
+}
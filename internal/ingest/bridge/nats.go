@@ -0,0 +1,220 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsTimeout bounds consumer lookups and ack flushes.
+const natsTimeout = 5 * time.Second
+
+// defaultAckWait is JetStream's ack wait for consumers that do not set one.
+const defaultAckWait = 30 * time.Second
+
+// NATSOptions are the connection settings of a NATSSource besides its URL, which may
+// carry a user and password or a token itself.
+type NATSOptions struct {
+	CredsFile string // JWT and NKey seed, as written by nsc ("" = none)
+	NKeyFile  string // NKey seed for NKey-only auth ("" = none)
+	CAFile    string // PEM roots to verify the server with ("" = the system roots)
+}
+
+// NATSSource consumes a JetStream stream through a durable pull consumer. It connects
+// on first use, creating the consumer if it does not exist yet; after that the client
+// reconnects by itself. TLS is used when the URL is tls:// or the server requires it.
+// It is not safe for concurrent use.
+type NATSSource struct {
+	url      string
+	opts     []nats.Option
+	stream   string
+	consumer string
+	subject  string // consumer filter subject ("" = the whole stream)
+
+	nc       *nats.Conn
+	cons     jetstream.Consumer
+	ackWait  time.Duration
+	inFlight map[string]fetchedMsg // fetched but not committed, by Message.ID
+}
+
+// fetchedMsg is a message awaiting Commit.
+type fetchedMsg struct {
+	msg jetstream.Msg
+	at  time.Time
+}
+
+// NewNATSSource creates a source reading stream through the durable consumer
+// consumer. rawURL is nats://[user:password@|token@]host[:port], or tls:// for a
+// server that must be reached over TLS; several may be given, comma-separated.
+func NewNATSSource(rawURL, stream, consumer, subject string, o NATSOptions) (*NATSSource, error) {
+	for _, raw := range strings.Split(rawURL, ",") {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid NATS URL: %w", err)
+		}
+		if (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid NATS URL %q: must be nats://host[:port] or tls://host[:port]", u.Redacted())
+		}
+	}
+	if stream == "" || consumer == "" {
+		return nil, errors.New("NATS stream and consumer are required")
+	}
+
+	opts := []nats.Option{nats.Name("otelcontext-bridge"), nats.MaxReconnects(-1)}
+	if o.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(o.CredsFile))
+	}
+	if o.NKeyFile != "" {
+		opt, err := nats.NkeyOptionFromSeed(o.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NATS NKey seed: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	if o.CAFile != "" {
+		opts = append(opts, nats.RootCAs(o.CAFile))
+	}
+	return &NATSSource{
+		url:      rawURL,
+		opts:     opts,
+		stream:   stream,
+		consumer: consumer,
+		subject:  subject,
+		inFlight: make(map[string]fetchedMsg),
+	}, nil
+}
+
+// Fetch pulls up to max messages, waiting at most wait for them.
+func (s *NATSSource) Fetch(ctx context.Context, max int, wait time.Duration) ([]Message, error) {
+	if err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+	s.forgetExpired()
+
+	var batch jetstream.MessageBatch
+	var err error
+	if wait <= 0 {
+		batch, err = s.cons.FetchNoWait(max)
+	} else {
+		fetchCtx, cancel := context.WithTimeout(ctx, wait)
+		defer cancel()
+		batch, err = s.cons.Fetch(max, jetstream.FetchContext(fetchCtx))
+	}
+	if err != nil {
+		s.cons = nil // look the consumer up again, in case it was deleted
+		return nil, fmt.Errorf("pull request: %w", err)
+	}
+
+	var msgs []Message
+	for m := range batch.Messages() {
+		id := m.Reply()
+		s.inFlight[id] = fetchedMsg{msg: m, at: time.Now()}
+		msgs = append(msgs, Message{Data: m.Data(), ID: id})
+	}
+	switch err := batch.Error(); {
+	case ctx.Err() != nil:
+		return msgs, ctx.Err()
+	case err == nil || errors.Is(err, context.DeadlineExceeded): // waited the full wait
+		return msgs, nil
+	default:
+		s.cons = nil
+		return msgs, fmt.Errorf("pull request ended: %w", err)
+	}
+}
+
+// Commit acknowledges msgs. Acks are not confirmed by the server; one that is lost
+// only means the message is delivered again.
+func (s *NATSSource) Commit(ctx context.Context, msgs []Message) error {
+	var errs []error
+	for _, m := range msgs {
+		f, ok := s.inFlight[m.ID]
+		if !ok {
+			continue // past its ack wait, so redelivered anyway
+		}
+		delete(s.inFlight, m.ID)
+		if err := f.msg.Ack(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if s.nc != nil && !s.nc.IsClosed() {
+		flushCtx, cancel := context.WithTimeout(ctx, natsTimeout)
+		defer cancel()
+		if err := s.nc.FlushWithContext(flushCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("ack: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (s *NATSSource) Close() error {
+	if s.nc != nil {
+		s.nc.Close()
+		s.nc, s.cons = nil, nil
+	}
+	return nil
+}
+
+// ensure connects and binds the consumer unless already done.
+func (s *NATSSource) ensure(ctx context.Context) error {
+	if s.nc != nil && s.nc.IsClosed() {
+		s.nc, s.cons = nil, nil
+	}
+	if s.cons != nil {
+		return nil
+	}
+	if s.nc == nil {
+		nc, err := nats.Connect(s.url, s.opts...)
+		if err != nil {
+			return fmt.Errorf("connect to NATS: %w", err)
+		}
+		s.nc = nc
+	}
+	js, err := jetstream.New(s.nc)
+	if err != nil {
+		return fmt.Errorf("JetStream: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, natsTimeout)
+	defer cancel()
+	cons, err := js.Consumer(ctx, s.stream, s.consumer)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		cons, err = js.CreateConsumer(ctx, s.stream, jetstream.ConsumerConfig{
+			Durable:       s.consumer,
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+			FilterSubject: s.subject,
+		})
+		if err == nil {
+			logger.Info("Created JetStream consumer", "stream", s.stream, "consumer", s.consumer, "subject", s.subject)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("JetStream consumer %s on stream %s: %w", s.consumer, s.stream, err)
+	}
+	s.cons = cons
+	s.ackWait = defaultAckWait
+	if info := cons.CachedInfo(); info != nil && info.Config.AckWait > 0 {
+		s.ackWait = info.Config.AckWait
+	}
+	return nil
+}
+
+// forgetExpired drops messages left uncommitted for well past the consumer's ack
+// wait, e.g. after a failed flush. JetStream has redelivered them by then.
+func (s *NATSSource) forgetExpired() {
+	for id, f := range s.inFlight {
+		if time.Since(f.at) > 2*s.ackWait {
+			delete(s.inFlight, id)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJetStream serves just enough of the NATS protocol for one pull consumer.
+type fakeJetStream struct {
+	mu       sync.Mutex
+	pending  []string // message payloads not yet delivered
+	acked    []string
+	created  map[string]any
+	connects []map[string]any
+	hold     bool // leave waiting pulls unanswered
+}
+
+// pullRequest is the payload of a CONSUMER.MSG.NEXT request.
+type pullRequest struct {
+	Batch   int   `json:"batch"`
+	Expires int64 `json:"expires,omitempty"` // nanoseconds
+	NoWait  bool  `json:"no_wait,omitempty"`
+}
+
+// listen serves f on a loopback port and returns its nats:// URL with credentials.
+func (f *fakeJetStream) listen(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return "nats://bridge:s3cret@" + ln.Addr().String()
+}
+
+func (f *fakeJetStream) serve(conn net.Conn) {
+	defer conn.Close()
+	// Writes go through a buffer, as on a socket, so the client can answer a PING
+	// while the server is still sending
+	out := make(chan string, 64)
+	defer close(out)
+	go func() {
+		for s := range out {
+			io.WriteString(conn, s)
+		}
+	}()
+	r := bufio.NewReader(conn)
+	send := func(format string, args ...any) { out <- fmt.Sprintf(format, args...) }
+
+	subs := make(map[string]string) // subject (pattern) → sid
+	sid := func(subject string) string {
+		if id, ok := subs[subject]; ok {
+			return id
+		}
+		for pattern, id := range subs {
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(subject, prefix) {
+				return id
+			}
+		}
+		return "0"
+	}
+	reply := func(subject, body string) { send("MSG %s %s %d\r\n%s\r\n", subject, sid(subject), len(body), body) }
+	status := func(subject, line string) {
+		hdr := "NATS/1.0 " + line + "\r\n\r\n"
+		send("HMSG %s %s %d %d\r\n%s\r\n", subject, sid(subject), len(hdr), len(hdr), hdr)
+	}
+	consumerInfo := `{"type":"io.nats.jetstream.api.v1.consumer_info_response","stream_name":"LOGS","name":"otelcontext",` +
+		`"config":{"durable_name":"otelcontext","ack_policy":"explicit","ack_wait":30000000000}}`
+
+	send("INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"jetstream\":true,\"max_payload\":1048576}\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch op {
+		case "CONNECT":
+			var c map[string]any
+			json.Unmarshal([]byte(args), &c)
+			f.mu.Lock()
+			f.connects = append(f.connects, c)
+			f.mu.Unlock()
+		case "PING":
+			send("PONG\r\n")
+		case "SUB":
+			fields := strings.Fields(args)
+			subs[fields[0]] = fields[len(fields)-1]
+		case "PUB", "HPUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			body := make([]byte, size+2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			body = body[:size]
+			if op == "HPUB" {
+				hdrSize, _ := strconv.Atoi(fields[len(fields)-2])
+				body, fields = body[hdrSize:], fields[:len(fields)-1]
+			}
+			subject, replyTo := fields[0], ""
+			if len(fields) == 3 {
+				replyTo = fields[1]
+			}
+			f.mu.Lock()
+			switch {
+			case subject == "$JS.API.CONSUMER.INFO.LOGS.otelcontext":
+				if f.created == nil {
+					reply(replyTo, `{"type":"io.nats.jetstream.api.v1.consumer_info_response","error":{"code":404,"err_code":10014,"description":"consumer not found"}}`)
+				} else {
+					reply(replyTo, consumerInfo)
+				}
+			case strings.HasPrefix(subject, "$JS.API.CONSUMER.CREATE.LOGS.otelcontext"):
+				json.Unmarshal(body, &f.created)
+				reply(replyTo, consumerInfo)
+			case subject == "$JS.API.CONSUMER.MSG.NEXT.LOGS.otelcontext":
+				var req pullRequest
+				json.Unmarshal(body, &req)
+				send("PING\r\n") // the client must answer pings mid-fetch
+				n := min(req.Batch, len(f.pending))
+				for i, data := range f.pending[:n] {
+					send("MSG %s %s $JS.ACK.LOGS.otelcontext.1.%d.%d.0.0 %d\r\n%s\r\n", replyTo, sid(replyTo), i+1, i+1, len(data), data)
+				}
+				f.pending = f.pending[n:]
+				if n < req.Batch && !f.hold {
+					if req.NoWait {
+						status(replyTo, "404 No Messages")
+					} else {
+						status(replyTo, "408 Request Timeout")
+					}
+				}
+			case strings.HasPrefix(subject, "$JS.ACK."):
+				f.acked = append(f.acked, subject)
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+func newFakeNATSSource(t *testing.T, f *fakeJetStream) *NATSSource {
+	t.Helper()
+	src, err := NewNATSSource(f.listen(t), "LOGS", "otelcontext", "logs.>", NATSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { src.Close() })
+	return src
+}
+
+func TestNATSSourceFetchAndCommit(t *testing.T) {
+	f := &fakeJetStream{pending: []string{`{"msg":"a"}`, `{"msg":"b"}`, `{"msg":"c"}`}}
+	src := newFakeNATSSource(t, f)
+	ctx := context.Background()
+
+	msgs, err := src.Fetch(ctx, 2, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || string(msgs[0].Data) != `{"msg":"a"}` || msgs[0].ID == "" {
+		t.Fatalf("first fetch = %+v, want a and b with ack subjects", msgs)
+	}
+	if err := src.Commit(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err = src.Fetch(ctx, 2, 50*time.Millisecond)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("second fetch = %+v, %v; want c alone once the request expires", msgs, err)
+	}
+	msgs, err = src.Fetch(ctx, 2, 0)
+	if err != nil || len(msgs) != 0 {
+		t.Fatalf("fetch of an empty stream = %+v, %v", msgs, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.connects) != 1 || f.connects[0]["user"] != "bridge" || f.connects[0]["pass"] != "s3cret" {
+		t.Errorf("connects = %v, want one with the URL's credentials", f.connects)
+	}
+	cfg, _ := f.created["config"].(map[string]any)
+	if cfg["durable_name"] != "otelcontext" || cfg["ack_policy"] != "explicit" || cfg["filter_subject"] != "logs.>" {
+		t.Errorf("created consumer = %v", f.created)
+	}
+	if len(f.acked) != 2 {
+		t.Errorf("acked %v, want the 2 committed messages", f.acked)
+	}
+}
+
+func TestNATSSourceCancel(t *testing.T) {
+	src := newFakeNATSSource(t, &fakeJetStream{created: map[string]any{}, hold: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := src.Fetch(ctx, 10, time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Fetch error = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Fetch did not return promptly on cancel")
+	}
+}
+
+func TestNewNATSSource(t *testing.T) {
+	if _, err := NewNATSSource("tls://tok@nats-a:4222, nats://nats-b", "LOGS", "c", "", NATSOptions{}); err != nil {
+		t.Errorf("NewNATSSource with a server list: %v", err)
+	}
+	for _, u := range []string{"http://localhost:4222", "nats://", "::", "nats://a,"} {
+		if _, err := NewNATSSource(u, "LOGS", "c", "", NATSOptions{}); err == nil {
+			t.Errorf("NewNATSSource(%q) succeeded, want an error", u)
+		}
+	}
+	seed := filepath.Join(t.TempDir(), "bridge.nk")
+	os.WriteFile(seed, []byte("not a seed"), 0o600)
+	if _, err := NewNATSSource("nats://localhost", "LOGS", "c", "", NATSOptions{NKeyFile: seed}); err == nil {
+		t.Error("NewNATSSource with an invalid NKey seed succeeded, want an error")
+	}
+}
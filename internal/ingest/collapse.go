@@ -0,0 +1,252 @@
+package ingest
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// DefaultCollapseMaxKeys bounds the number of distinct log lines a LogCollapser tracks.
+const DefaultCollapseMaxKeys = 10000
+
+// repeatBodyPreview caps the body carried by a LogRepeat.
+const repeatBodyPreview = 256
+
+// RepeatStore persists the repeat counts of collapsed logs.
+type RepeatStore interface {
+	AddLogRepeats(repeats map[uint]int64) error
+}
+
+// LogRepeat reports the copies of a stored log that were counted on it rather than
+// stored during one collapse window.
+type LogRepeat struct {
+	LogID       uint      `json:"log_id"`
+	TenantID    string    `json:"-"`
+	ServiceName string    `json:"service_name"`
+	Severity    string    `json:"severity"`
+	Body        string    `json:"body"` // truncated
+	Count       int64     `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+type collapseKey [16]byte
+
+// collapseEntry is one log line within its window.
+type collapseEntry struct {
+	key      collapseKey
+	logID    uint // 0 until the first occurrence is stored
+	tenant   string
+	service  string
+	severity string
+	body     string
+	first    time.Time
+	last     time.Time
+	pending  int64 // repeats not yet written
+}
+
+// LogCollapser folds repeats of a log line — same tenant, environment, service,
+// severity and body — into the first occurrence. The first one within a window is stored as usual;
+// the copies that follow within the window only add to its repeat_count, written when
+// the window ends. Tracked lines are capped with an LRU; an evicted line is flushed early.
+type LogCollapser struct {
+	store    RepeatStore
+	window   time.Duration
+	maxKeys  int
+	now      func() time.Time
+	onRepeat func(LogRepeat)
+
+	mu      sync.Mutex
+	entries map[collapseKey]*list.Element // of *collapseEntry
+	lru     *list.List                    // most recently seen first
+}
+
+// NewLogCollapser creates a collapser with the given window and key limit
+// (<= 0: DefaultCollapseMaxKeys). Counts are written to store.
+func NewLogCollapser(store RepeatStore, window time.Duration, maxKeys int) *LogCollapser {
+	if maxKeys <= 0 {
+		maxKeys = DefaultCollapseMaxKeys
+	}
+	return &LogCollapser{
+		store:   store,
+		window:  window,
+		maxKeys: maxKeys,
+		now:     time.Now,
+		entries: make(map[collapseKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// SetRepeatCallback sets the function called with each flushed repeat count, after
+// it has been written.
+func (c *LogCollapser) SetRepeatCallback(cb func(LogRepeat)) {
+	c.onRepeat = cb
+}
+
+func logCollapseKey(l *storage.Log) collapseKey {
+	h := sha256.New()
+	h.Write([]byte(l.TenantID))
+	h.Write([]byte{0})
+	h.Write([]byte(l.Environment))
+	h.Write([]byte{0})
+	h.Write([]byte(l.ServiceName))
+	h.Write([]byte{0})
+	h.Write([]byte(l.Severity))
+	h.Write([]byte{0})
+	h.Write([]byte(l.Body))
+	var k collapseKey
+	copy(k[:], h.Sum(nil))
+	return k
+}
+
+// Collapse returns the logs of a batch to store: the first occurrence of each line in
+// its window. The others are counted and collapsed is their number. Pass the stored
+// logs to Stored once they have IDs, or to Discard if storing them failed.
+func (c *LogCollapser) Collapse(logs []storage.Log) (keep []storage.Log, collapsed int) {
+	now := c.now()
+	var evicted []*collapseEntry
+
+	c.mu.Lock()
+	keep = logs[:0:0]
+	for i := range logs {
+		k := logCollapseKey(&logs[i])
+		if el, ok := c.entries[k]; ok {
+			e := el.Value.(*collapseEntry)
+			if now.Sub(e.first) < c.window {
+				e.pending++
+				e.last = now
+				c.lru.MoveToFront(el)
+				collapsed++
+				continue
+			}
+			// The window has rolled: flush and start a new one with this record.
+			c.remove(el)
+			evicted = append(evicted, e)
+		}
+		body := string(logs[i].Body)
+		if len(body) > repeatBodyPreview {
+			body = body[:repeatBodyPreview]
+		}
+		c.entries[k] = c.lru.PushFront(&collapseEntry{
+			key: k, tenant: logs[i].TenantID, service: logs[i].ServiceName, severity: logs[i].Severity, body: body,
+			first: now, last: now,
+		})
+		if c.lru.Len() > c.maxKeys {
+			oldest := c.lru.Back()
+			c.remove(oldest)
+			evicted = append(evicted, oldest.Value.(*collapseEntry))
+		}
+		keep = append(keep, logs[i])
+	}
+	c.mu.Unlock()
+
+	c.write(evicted)
+	return keep, collapsed
+}
+
+// Stored records the IDs of logs returned by Collapse once they are stored.
+func (c *LogCollapser) Stored(logs []storage.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range logs {
+		if el, ok := c.entries[logCollapseKey(&logs[i])]; ok {
+			if e := el.Value.(*collapseEntry); e.logID == 0 {
+				e.logID = logs[i].ID
+			}
+		}
+	}
+}
+
+// Discard forgets lines whose first occurrence could not be stored, so a retried
+// export stores them instead of counting them as repeats.
+func (c *LogCollapser) Discard(logs []storage.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range logs {
+		if el, ok := c.entries[logCollapseKey(&logs[i])]; ok && el.Value.(*collapseEntry).logID == 0 {
+			c.remove(el)
+		}
+	}
+}
+
+// Flush writes the counts of windows that have ended, or of all tracked lines when
+// all is set, and stops tracking them.
+func (c *LogCollapser) Flush(all bool) {
+	now := c.now()
+	var done []*collapseEntry
+	c.mu.Lock()
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if e := el.Value.(*collapseEntry); all || now.Sub(e.first) >= c.window {
+			c.remove(el)
+			done = append(done, e)
+		}
+		el = prev
+	}
+	c.mu.Unlock()
+	c.write(done)
+}
+
+// Len returns the number of tracked lines.
+func (c *LogCollapser) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Start flushes ended windows until ctx is cancelled, then flushes everything.
+func (c *LogCollapser) Start(ctx context.Context) {
+	ticker := time.NewTicker(max(c.window/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.Flush(true)
+			return
+		case <-ticker.C:
+			c.Flush(false)
+		}
+	}
+}
+
+// remove stops tracking el; c.mu must be held.
+func (c *LogCollapser) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*collapseEntry).key)
+	c.lru.Remove(el)
+}
+
+// write stores the pending counts of entries and reports them.
+func (c *LogCollapser) write(entries []*collapseEntry) {
+	repeats := make(map[uint]int64)
+	var reports []LogRepeat
+	for _, e := range entries {
+		if e.pending == 0 {
+			continue
+		}
+		if e.logID == 0 {
+			logger.Debug("Dropping repeat count of a log that was never stored", "service", e.service, "count", e.pending)
+			continue
+		}
+		repeats[e.logID] += e.pending
+		reports = append(reports, LogRepeat{
+			LogID: e.logID, TenantID: e.tenant, ServiceName: e.service, Severity: e.severity, Body: e.body,
+			Count: e.pending, FirstSeen: e.first, LastSeen: e.last,
+		})
+	}
+	if len(repeats) == 0 {
+		return
+	}
+	if err := c.store.AddLogRepeats(repeats); err != nil {
+		logger.Error("Failed to save log repeat counts", "logs", len(repeats), "error", err)
+		return
+	}
+	if c.onRepeat != nil {
+		for _, r := range reports {
+			c.onRepeat(r)
+		}
+	}
+}
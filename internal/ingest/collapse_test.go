@@ -0,0 +1,199 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func logRequest(service string, start time.Time, bodies ...string) *collogspb.ExportLogsServiceRequest {
+	records := make([]*logspb.LogRecord, len(bodies))
+	for i, b := range bodies {
+		records[i] = &logspb.LogRecord{
+			TimeUnixNano: uint64(start.Add(time.Duration(i) * time.Millisecond).UnixNano()),
+			SeverityText: "ERROR",
+			Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: b}},
+		}
+	}
+	return &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource:  &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", service)}},
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: records}},
+	}}}
+}
+
+func TestLogCollapserFoldsBursts(t *testing.T) {
+	repo := newTestRepo(t)
+	collapser := NewLogCollapser(repo, time.Minute, 0)
+	var repeats []LogRepeat
+	collapser.SetRepeatCallback(func(r LogRepeat) { repeats = append(repeats, r) })
+	srv := NewLogsServer(repo, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+	srv.SetCollapser(collapser)
+	var streamed int
+	srv.SetLogCallback(func(batch []storage.Log) { streamed += len(batch) })
+
+	now := time.Now()
+	burst := make([]string, 50)
+	for i := range burst {
+		burst[i] = "connection refused"
+	}
+	for _, req := range []*collogspb.ExportLogsServiceRequest{
+		logRequest("cart", now, burst...),
+		logRequest("cart", now.Add(time.Second), burst[:10]...),
+	} {
+		if _, err := srv.Export(context.Background(), req); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+	}
+	if streamed != 1 {
+		t.Errorf("log callback called %d times, want 1", streamed)
+	}
+	collapser.Flush(true)
+
+	logs, total, err := repo.GetLogsV2(storage.LogFilter{ServiceName: "cart", Limit: 100})
+	if err != nil || total != 1 {
+		t.Fatalf("GetLogsV2() = %d logs, %v; want 1", total, err)
+	}
+	if logs[0].RepeatCount != 59 {
+		t.Errorf("repeat_count = %d, want 59", logs[0].RepeatCount)
+	}
+	if len(repeats) != 1 || repeats[0].Count != 59 || repeats[0].LogID != logs[0].ID {
+		t.Errorf("repeat callbacks = %+v, want one of 59 for log %d", repeats, logs[0].ID)
+	}
+	if collapser.Len() != 0 {
+		t.Errorf("Len() after Flush = %d, want 0", collapser.Len())
+	}
+}
+
+func TestLogCollapserKeepsServicesApart(t *testing.T) {
+	repo := newTestRepo(t)
+	collapser := NewLogCollapser(repo, time.Minute, 0)
+	srv := NewLogsServer(repo, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+	srv.SetCollapser(collapser)
+
+	now := time.Now()
+	req := logRequest("cart", now, "timeout", "retrying", "timeout", "retrying")
+	req.ResourceLogs = append(req.ResourceLogs, logRequest("auth", now, "timeout", "timeout").ResourceLogs...)
+	staging := logRequest("cart", now, "timeout", "timeout").ResourceLogs[0]
+	staging.Resource.Attributes = append(staging.Resource.Attributes, strAttr("deployment.environment", "staging"))
+	req.ResourceLogs = append(req.ResourceLogs, staging)
+	if _, err := srv.Export(context.Background(), req); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	collapser.Flush(true)
+
+	// The same line from another environment is a line of its own.
+	var fromStaging []storage.Log
+	if err := repo.DB().Where("environment = ?", "staging").Find(&fromStaging).Error; err != nil || len(fromStaging) != 1 || fromStaging[0].RepeatCount != 1 {
+		t.Fatalf("staging logs = %+v, %v; want one repeated once", fromStaging, err)
+	}
+	repo.DB().Where("environment = ?", "staging").Delete(&storage.Log{})
+
+	for service, want := range map[string]map[string]int64{
+		"cart": {"timeout": 1, "retrying": 1},
+		"auth": {"timeout": 1},
+	} {
+		logs, _, err := repo.GetLogsV2(storage.LogFilter{ServiceName: service, Limit: 100})
+		if err != nil || len(logs) != len(want) {
+			t.Fatalf("%s: %d logs, %v; want %d", service, len(logs), err, len(want))
+		}
+		for _, l := range logs {
+			if l.RepeatCount != want[string(l.Body)] {
+				t.Errorf("%s %q: repeat_count = %d, want %d", service, l.Body, l.RepeatCount, want[string(l.Body)])
+			}
+		}
+	}
+}
+
+type repeatRecorder map[uint]int64
+
+func (r repeatRecorder) AddLogRepeats(repeats map[uint]int64) error {
+	for id, n := range repeats {
+		r[id] += n
+	}
+	return nil
+}
+
+func TestLogCollapserWindowAndEviction(t *testing.T) {
+	store := repeatRecorder{}
+	c := NewLogCollapser(store, 10*time.Second, 2)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	mk := func(body string) storage.Log {
+		return storage.Log{ServiceName: "cart", Severity: "WARN", Body: storage.CompressedText(body)}
+	}
+	collapse := func(id uint, body string) int {
+		keep, n := c.Collapse([]storage.Log{mk(body)})
+		if len(keep) == 1 {
+			keep[0].ID = id
+			c.Stored(keep)
+		}
+		return n
+	}
+
+	collapse(1, "a")
+	if n := collapse(2, "a"); n != 1 {
+		t.Fatalf("repeat within window collapsed %d, want 1", n)
+	}
+	now = now.Add(10 * time.Second)
+	if n := collapse(3, "a"); n != 0 {
+		t.Fatalf("record after the window collapsed %d, want 0", n)
+	}
+	if store[1] != 1 {
+		t.Errorf("count of first window = %d, want 1 written when it rolled", store[1])
+	}
+
+	// Tracking a third line evicts the least recently seen one, flushing it early.
+	collapse(4, "b")
+	collapse(0, "b")
+	collapse(0, "a")
+	collapse(5, "c")
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+	if store[4] != 1 {
+		t.Errorf("count of evicted line = %d, want 1", store[4])
+	}
+	if n := collapse(6, "b"); n != 0 {
+		t.Errorf("evicted line collapsed %d, want 0", n)
+	}
+}
+
+// flakyLogStore fails BatchCreateLogs while err is set.
+type flakyLogStore struct {
+	memStore
+	err error
+}
+
+func (f *flakyLogStore) BatchCreateLogs(logs []storage.Log) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.memStore.BatchCreateLogs(logs)
+}
+
+func TestLogCollapserDiscardAllowsRetry(t *testing.T) {
+	store := &flakyLogStore{err: errors.New("database is locked")}
+	c := NewLogCollapser(repeatRecorder{}, time.Minute, 0)
+	srv := NewLogsServer(store, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+	srv.SetCollapser(c)
+
+	req := logRequest("cart", time.Now(), "boom")
+	if _, err := srv.Export(context.Background(), req); err == nil {
+		t.Fatal("Export() succeeded with a failing store")
+	}
+	store.err = nil
+	if _, err := srv.Export(context.Background(), req); err != nil {
+		t.Fatalf("retried Export() error = %v", err)
+	}
+	if len(store.logs) != 1 {
+		t.Errorf("stored %d logs after retry, want 1", len(store.logs))
+	}
+}
@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+)
+
+// Metrics derived from root spans (INGEST_DERIVE_RED_METRICS), for services that send
+// traces but no metrics. Names under DerivedMetricPrefix are reserved: OTLP metrics
+// using them are dropped so they cannot mix with the derived series.
+const (
+	DerivedMetricPrefix   = "argus.derived."
+	DerivedRequestsMetric = DerivedMetricPrefix + "requests" // 1 per root span
+	DerivedErrorsMetric   = DerivedMetricPrefix + "errors"   // 1 per errored root span, else 0
+	DerivedDurationMetric = DerivedMetricPrefix + "duration" // root span duration in ms
+)
+
+// isReservedMetric reports whether an incoming metric name falls in the namespace of
+// the derived metrics.
+func isReservedMetric(name string) bool {
+	return strings.HasPrefix(name, DerivedMetricPrefix)
+}
+
+// isRootSpan reports whether a span has no parent; some SDKs send an all-zero ID.
+func isRootSpan(parentSpanID []byte) bool {
+	for _, b := range parentSpanID {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// deriveREDMetrics returns the request, error and duration points of one root span.
+// Only root spans are counted, so a request is counted once however many spans its
+// trace has. The duration point carries the span as an exemplar.
+func deriveREDMetrics(tenantID, service, operation, traceID, spanID string, start time.Time, durationMs float64, isError bool) []tsdb.RawMetric {
+	errCount := 0.0
+	if isError {
+		errCount = 1
+	}
+	point := func(name string, v float64) tsdb.RawMetric {
+		return tsdb.RawMetric{
+			Name:        name,
+			TenantID:    tenantID,
+			ServiceName: service,
+			Value:       v,
+			Timestamp:   start,
+			Attributes:  map[string]interface{}{"operation": operation},
+		}
+	}
+	duration := point(DerivedDurationMetric, durationMs)
+	duration.Exemplars = []storage.Exemplar{{TraceID: traceID, SpanID: spanID, Value: durationMs, Timestamp: start}}
+	return []tsdb.RawMetric{point(DerivedRequestsMetric, 1), point(DerivedErrorsMetric, errCount), duration}
+}
@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// DefaultDispatchQueueSize bounds the log batches a LogDispatcher holds.
+const DefaultDispatchQueueSize = 1024
+
+// slowDispatch is how long fan-out of one batch may take before it is logged.
+const slowDispatch = time.Second
+
+// LogDispatcher moves the fan-out of stored logs (live broadcast, AI enqueue,
+// refresh notification) off the Export path. Export hands each stored batch to
+// Dispatch, which only queues it; a single goroutine run by Start passes the
+// batches to the handler in order. When the queue is full the batch is dropped
+// rather than stalling ingest: the logs are already stored, only their live
+// fan-out is lost.
+type LogDispatcher struct {
+	queue   chan []storage.Log
+	handler func([]storage.Log)
+	dropped atomic.Int64
+
+	onDropped    func(logs int)
+	onDispatched func(time.Duration)
+}
+
+// NewLogDispatcher creates a dispatcher that queues up to size batches
+// (<= 0: DefaultDispatchQueueSize) for handler.
+func NewLogDispatcher(size int, handler func([]storage.Log)) *LogDispatcher {
+	if size <= 0 {
+		size = DefaultDispatchQueueSize
+	}
+	return &LogDispatcher{
+		queue:   make(chan []storage.Log, size),
+		handler: handler,
+	}
+}
+
+// SetMetrics installs hooks for dropped logs and for the time the handler took
+// per batch. Call before Start.
+func (d *LogDispatcher) SetMetrics(onDropped func(logs int), onDispatched func(time.Duration)) {
+	d.onDropped = onDropped
+	d.onDispatched = onDispatched
+}
+
+// Dispatch queues a batch without blocking; it has the signature of the
+// LogsServer and TraceServer log callbacks.
+func (d *LogDispatcher) Dispatch(batch []storage.Log) {
+	if len(batch) == 0 {
+		return
+	}
+	select {
+	case d.queue <- batch:
+	default:
+		d.dropped.Add(int64(len(batch)))
+		if d.onDropped != nil {
+			d.onDropped(len(batch))
+		}
+	}
+}
+
+// Dropped returns the number of logs dropped because the queue was full.
+func (d *LogDispatcher) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// Pending returns the number of queued batches.
+func (d *LogDispatcher) Pending() int {
+	return len(d.queue)
+}
+
+// Start runs the handler on queued batches until ctx is done, then hands over
+// what is still queued and returns.
+func (d *LogDispatcher) Start(ctx context.Context) {
+	for {
+		select {
+		case batch := <-d.queue:
+			d.run(batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case batch := <-d.queue:
+					d.run(batch)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *LogDispatcher) run(batch []storage.Log) {
+	start := time.Now()
+	d.handler(batch)
+	elapsed := time.Since(start)
+	if d.onDispatched != nil {
+		d.onDispatched(elapsed)
+	}
+	if elapsed > slowDispatch {
+		logger.Warn("Slow log fan-out", "logs", len(batch), "duration", elapsed, "queued", len(d.queue))
+	}
+}
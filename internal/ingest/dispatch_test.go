@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestLogDispatcherDeliversInOrder(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []uint
+	)
+	d := NewLogDispatcher(8, func(batch []storage.Log) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, l := range batch {
+			got = append(got, l.ID)
+		}
+	})
+	var observed int
+	d.SetMetrics(nil, func(time.Duration) { observed++ })
+	for i := range 5 {
+		d.Dispatch([]storage.Log{{ID: uint(2 * i)}, {ID: uint(2*i + 1)}})
+	}
+	d.Dispatch(nil) // ignored
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.Start(ctx) // drains the queue, then returns
+
+	if fmt.Sprint(got) != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Errorf("delivered %v, want 0..9 in order", got)
+	}
+	if observed != 5 || d.Pending() != 0 || d.Dropped() != 0 {
+		t.Errorf("observed %d batches, %d pending, %d dropped; want 5, 0, 0", observed, d.Pending(), d.Dropped())
+	}
+}
+
+func TestLogDispatcherDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	d := NewLogDispatcher(2, func([]storage.Log) { <-release })
+	var dropped int
+	d.SetMetrics(func(n int) { dropped += n }, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Start(ctx)
+		close(done)
+	}()
+
+	d.Dispatch([]storage.Log{{ID: 1}}) // taken by the handler, which blocks
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	d.Dispatch([]storage.Log{{ID: 2}})
+	d.Dispatch([]storage.Log{{ID: 3}})
+	start := time.Now()
+	d.Dispatch([]storage.Log{{ID: 4}, {ID: 5}}) // queue full
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("Dispatch blocked on a full queue")
+	}
+	if d.Dropped() != 2 || dropped != 2 {
+		t.Errorf("Dropped() = %d, hook saw %d; want 2", d.Dropped(), dropped)
+	}
+
+	close(release)
+	cancel()
+	<-done
+	if d.Pending() != 0 {
+		t.Errorf("%d batches left after Start returned", d.Pending())
+	}
+}
+
+func TestLogsExportHandsBatchToCallback(t *testing.T) {
+	srv := NewLogsServer(&memStore{}, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+	var batches [][]storage.Log
+	srv.SetLogCallback(func(batch []storage.Log) { batches = append(batches, batch) })
+	if _, err := srv.Export(context.Background(), logRequest("checkout", time.Now(), "a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Errorf("callback got %d batches, want one of 3 logs", len(batches))
+	}
+}
+
+// discardStore stores nothing, so benchmarks measure the Export path alone.
+type discardStore struct{}
+
+func (discardStore) BatchCreateLogs([]storage.Log) error { return nil }
+
+// BenchmarkLogsExportFanOut compares Export latency with the fan-out run inline
+// against handing it to a LogDispatcher, as the number of live subscribers (each
+// costing one JSON encode per log) grows. Dispatched, it stays flat.
+func BenchmarkLogsExportFanOut(b *testing.B) {
+	bodies := make([]string, 50)
+	for i := range bodies {
+		bodies[i] = fmt.Sprintf("request %d failed: connection reset by peer", i)
+	}
+	req := logRequest("checkout", time.Now(), bodies...)
+	fanOut := func(subscribers int) func([]storage.Log) {
+		return func(batch []storage.Log) {
+			for _, l := range batch {
+				for range subscribers {
+					json.Marshal(l)
+				}
+			}
+		}
+	}
+
+	for _, subscribers := range []int{0, 10, 100} {
+		b.Run(fmt.Sprintf("inline/subscribers=%d", subscribers), func(b *testing.B) {
+			srv := NewLogsServer(discardStore{}, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+			srv.SetLogCallback(fanOut(subscribers))
+			for b.Loop() {
+				srv.Export(context.Background(), req)
+			}
+		})
+		b.Run(fmt.Sprintf("dispatched/subscribers=%d", subscribers), func(b *testing.B) {
+			d := NewLogDispatcher(0, fanOut(subscribers))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go d.Start(ctx)
+			srv := NewLogsServer(discardStore{}, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+			srv.SetLogCallback(d.Dispatch)
+			for b.Loop() {
+				srv.Export(context.Background(), req)
+			}
+			b.ReportMetric(float64(d.Dropped()), "dropped")
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+)
+
+// ErrInvalidFilters is returned by Filters.Update for settings that cannot be applied.
+var ErrInvalidFilters = errors.New("invalid ingest filters")
+
+// FilterConfig holds the ingest filter settings that can be changed at runtime.
+type FilterConfig struct {
+	MinSeverity      string   `json:"min_severity"`
+	AllowedServices  []string `json:"allowed_services"`
+	ExcludedServices []string `json:"excluded_services"`
+}
+
+// filterSet is an immutable, parsed FilterConfig.
+type filterSet struct {
+	cfg         FilterConfig
+	minSeverity int
+	allowed     map[string]bool
+	excluded    map[string]bool
+}
+
+// Filters is the ingest filter configuration shared by the OTLP receivers. Updates
+// replace the whole set at once, so an Export call that loads it once sees either
+// the old or the new settings, never a mix.
+type Filters struct {
+	cur  atomic.Pointer[filterSet]
+	mu   sync.Mutex // serializes Update
+	path string     // file updates are persisted to ("" = not persisted)
+}
+
+// NewFilters builds the filters from INGEST_MIN_SEVERITY, INGEST_ALLOWED_SERVICES
+// and INGEST_EXCLUDED_SERVICES.
+func NewFilters(cfg *config.Config) *Filters {
+	severity, err := normalizeSeverity(cfg.IngestMinSeverity)
+	if err != nil {
+		logger.Warn("Unknown INGEST_MIN_SEVERITY, using INFO", "value", cfg.IngestMinSeverity)
+		severity = "INFO"
+	}
+	f := &Filters{}
+	f.cur.Store(newFilterSet(FilterConfig{
+		MinSeverity:      severity,
+		AllowedServices:  serviceListSlice(cfg.IngestAllowedServices),
+		ExcludedServices: serviceListSlice(cfg.IngestExcludedServices),
+	}))
+	return f
+}
+
+// SetPersistPath makes Update save the settings to path. If the file already exists
+// its settings replace the current ones, so changes made at runtime survive restarts.
+func (f *Filters) SetPersistPath(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ingest config: %w", err)
+	}
+	var c FilterConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("failed to parse ingest config %s: %w", path, err)
+	}
+	c, err = normalizeFilters(c)
+	if err != nil {
+		return fmt.Errorf("ingest config %s: %w", path, err)
+	}
+	f.cur.Store(newFilterSet(c))
+	logger.Info("Loaded ingest filters", "path", path, "min_severity", c.MinSeverity,
+		"allowed_services", c.AllowedServices, "excluded_services", c.ExcludedServices)
+	return nil
+}
+
+// Get returns the effective settings.
+func (f *Filters) Get() FilterConfig {
+	return f.load().cfg
+}
+
+// Update validates c and applies it to all receivers. It returns the normalized
+// settings now in effect.
+func (f *Filters) Update(c FilterConfig) (FilterConfig, error) {
+	c, err := normalizeFilters(c)
+	if err != nil {
+		return FilterConfig{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.path != "" {
+		if err := writeFilterFile(f.path, c); err != nil {
+			return FilterConfig{}, err
+		}
+	}
+	before := f.cur.Swap(newFilterSet(c)).cfg
+
+	logger.Info("Ingest filters updated",
+		"min_severity_before", before.MinSeverity, "min_severity", c.MinSeverity,
+		"allowed_services_before", before.AllowedServices, "allowed_services", c.AllowedServices,
+		"excluded_services_before", before.ExcludedServices, "excluded_services", c.ExcludedServices)
+	return c, nil
+}
+
+// AllowLog reports whether a log of severity from service passes the filters, for
+// log sources other than the OTLP receivers.
+func (f *Filters) AllowLog(service, severity string) bool {
+	fs := f.load()
+	return shouldIngestService(service, fs.allowed, fs.excluded) && shouldIngestSeverity(severity, fs.minSeverity)
+}
+
+func (f *Filters) load() *filterSet {
+	return f.cur.Load()
+}
+
+func newFilterSet(c FilterConfig) *filterSet {
+	return &filterSet{
+		cfg:         c,
+		minSeverity: parseSeverity(c.MinSeverity),
+		allowed:     serviceSet(c.AllowedServices),
+		excluded:    serviceSet(c.ExcludedServices),
+	}
+}
+
+// normalizeFilters upper-cases the severity and trims, de-duplicates and sorts the
+// service lists.
+func normalizeFilters(c FilterConfig) (FilterConfig, error) {
+	var err error
+	if c.MinSeverity, err = normalizeSeverity(c.MinSeverity); err != nil {
+		return FilterConfig{}, err
+	}
+	c.AllowedServices = cleanServiceList(c.AllowedServices)
+	c.ExcludedServices = cleanServiceList(c.ExcludedServices)
+	for _, s := range c.ExcludedServices {
+		if slices.Contains(c.AllowedServices, s) {
+			return FilterConfig{}, fmt.Errorf("%w: service %q is both allowed and excluded", ErrInvalidFilters, s)
+		}
+	}
+	return c, nil
+}
+
+// normalizeSeverity returns the upper-cased level name; empty means INFO.
+func normalizeSeverity(level string) (string, error) {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	switch level {
+	case "":
+		return "INFO", nil
+	case "WARNING":
+		return "WARN", nil
+	case "TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+		return level, nil
+	}
+	return "", fmt.Errorf("%w: unknown min_severity %q (want TRACE, DEBUG, INFO, WARN, ERROR or FATAL)", ErrInvalidFilters, level)
+}
+
+func cleanServiceList(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func serviceListSlice(list string) []string {
+	return cleanServiceList(strings.Split(list, ","))
+}
+
+func serviceSet(list []string) map[string]bool {
+	m := make(map[string]bool, len(list))
+	for _, s := range list {
+		m[s] = true
+	}
+	return m
+}
+
+// writeFilterFile replaces path atomically so a crash never leaves a partial file.
+func writeFilterFile(path string, c FilterConfig) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode ingest config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create ingest config directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write ingest config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write ingest config: %w", err)
+	}
+	return nil
+}
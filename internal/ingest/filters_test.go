@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func TestFiltersUpdateAppliesWithoutRestart(t *testing.T) {
+	repo := newTestRepo(t)
+	filters := NewFilters(&config.Config{IngestMinSeverity: "INFO"})
+	logs := NewLogsServer(repo, nil, &config.Config{})
+	logs.SetFilters(filters)
+	var stored atomic.Int64
+	logs.SetLogCallback(func(batch []storage.Log) { stored.Add(int64(len(batch))) })
+
+	export := func(service, severity string) int64 {
+		t.Helper()
+		before := stored.Load()
+		_, err := logs.Export(context.Background(), &collogspb.ExportLogsServiceRequest{
+			ResourceLogs: []*logspb.ResourceLogs{{
+				Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", service)}},
+				ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{{
+					TimeUnixNano: uint64(time.Now().UnixNano()),
+					SeverityText: severity,
+					Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "hello"}},
+				}}}},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored.Load() - before
+	}
+
+	if n := export("checkout", "INFO"); n != 1 {
+		t.Fatalf("INFO log stored %d times, want 1", n)
+	}
+	if _, err := filters.Update(FilterConfig{MinSeverity: "error", ExcludedServices: []string{" noisy ", "noisy"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := export("checkout", "INFO"); n != 0 {
+		t.Errorf("INFO log stored after raising min severity to ERROR")
+	}
+	if n := export("noisy", "ERROR"); n != 0 {
+		t.Errorf("log from excluded service stored")
+	}
+	if n := export("checkout", "ERROR"); n != 1 {
+		t.Errorf("ERROR log stored %d times, want 1", n)
+	}
+
+	got := filters.Get()
+	if got.MinSeverity != "ERROR" || len(got.ExcludedServices) != 1 || got.ExcludedServices[0] != "noisy" || len(got.AllowedServices) != 0 {
+		t.Errorf("Get() = %+v, want normalized settings", got)
+	}
+}
+
+func TestFiltersRejectInvalidSettings(t *testing.T) {
+	filters := NewFilters(&config.Config{IngestMinSeverity: "WARN"})
+	for _, c := range []FilterConfig{
+		{MinSeverity: "LOUD"},
+		{AllowedServices: []string{"a", "b"}, ExcludedServices: []string{"b"}},
+	} {
+		if _, err := filters.Update(c); !errors.Is(err, ErrInvalidFilters) {
+			t.Errorf("Update(%+v) err = %v, want ErrInvalidFilters", c, err)
+		}
+	}
+	if got := filters.Get().MinSeverity; got != "WARN" {
+		t.Errorf("rejected update changed the settings: min severity = %q", got)
+	}
+}
+
+func TestFiltersPersistAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ingest-config.json")
+	cfg := &config.Config{IngestMinSeverity: "INFO", IngestAllowedServices: "web"}
+
+	first := NewFilters(cfg)
+	if err := first.SetPersistPath(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Update(FilterConfig{MinSeverity: "DEBUG", AllowedServices: []string{"api", "web"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewFilters(cfg)
+	if err := second.SetPersistPath(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := second.Get(); got.MinSeverity != "DEBUG" || len(got.AllowedServices) != 2 {
+		t.Errorf("after restart Get() = %+v, want the persisted settings", got)
+	}
+}
+
+// An Export running while the config changes sees one complete version of it.
+func TestFiltersSwapIsAtomic(t *testing.T) {
+	filters := NewFilters(&config.Config{})
+	a := FilterConfig{MinSeverity: "DEBUG", AllowedServices: []string{"a"}}
+	b := FilterConfig{MinSeverity: "FATAL", ExcludedServices: []string{"b"}}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				fs := filters.load()
+				isA := fs.minSeverity == 10 && fs.allowed["a"] && len(fs.excluded) == 0
+				isB := fs.minSeverity == 50 && fs.excluded["b"] && len(fs.allowed) == 0
+				isInitial := fs.cfg.MinSeverity == "INFO" && len(fs.allowed)+len(fs.excluded) == 0
+				if !isA && !isB && !isInitial {
+					t.Errorf("torn filter config: %+v", fs.cfg)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 500; i++ {
+		c := a
+		if i%2 == 1 {
+			c = b
+		}
+		if _, err := filters.Update(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestLogSeverityNormalizedAtIngest(t *testing.T) {
+	repo := newTestRepo(t)
+	logs := NewLogsServer(repo, nil, &config.Config{})
+	logs.SetFilters(NewFilters(&config.Config{IngestMinSeverity: "WARN"}))
+
+	now := uint64(time.Now().UnixNano())
+	record := func(text string, number logspb.SeverityNumber, body string) *logspb.LogRecord {
+		return &logspb.LogRecord{TimeUnixNano: now, SeverityText: text, SeverityNumber: number,
+			Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: body}}}
+	}
+	_, err := logs.Export(context.Background(), &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}},
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{
+				record("warning", 0, "a"),
+				record("", logspb.SeverityNumber_SEVERITY_NUMBER_ERROR2, "b"),
+				record("Information", 0, "dropped by the WARN minimum"),
+				record("CRIT", logspb.SeverityNumber_SEVERITY_NUMBER_FATAL, "c"),
+			}}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []storage.Log
+	if err := repo.DB().Order("id").Find(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ severity, raw string }{
+		{"WARN", "warning"},
+		{"ERROR", "SEVERITY_NUMBER_ERROR2"},
+		{"FATAL", "CRIT"},
+	}
+	if len(stored) != len(want) {
+		t.Fatalf("stored %d logs, want %d", len(stored), len(want))
+	}
+	for i, w := range want {
+		if stored[i].Severity != w.severity || stored[i].RawSeverity != w.raw {
+			t.Errorf("log %q = %s (raw %q), want %s (raw %q)", stored[i].Body, stored[i].Severity, stored[i].RawSeverity, w.severity, w.raw)
+		}
+	}
+}
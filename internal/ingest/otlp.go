@@ -4,15 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log/slog"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"runtime"
 
 	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/liveness"
+	"github.com/RandomCodeSpace/otelcontext/internal/logging"
 	"github.com/RandomCodeSpace/otelcontext/internal/storage"
 	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
 	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
 	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
@@ -23,50 +28,97 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// logger covers the receivers, filters and sampling ("ingest" component).
+var logger = logging.Component("ingest")
+
+// TraceStore is where the trace receiver persists traces, spans and the logs it
+// synthesizes from span events.
+type TraceStore interface {
+	storage.TraceWriter
+	storage.LogWriter
+}
+
+// ErrorLogLookup finds the spans that already have an ERROR log exported by the app.
+type ErrorLogLookup interface {
+	SpansWithErrorLogs(ctx context.Context, tenantID string, spans []storage.LogSpanKey) (map[storage.LogSpanKey]bool, error)
+}
+
+// QuotaEnforcer caps per-service ingest volume. Each call records n items from
+// service and returns how many of them may be stored.
+type QuotaEnforcer interface {
+	AllowSpans(service string, n int) int
+	AllowLogs(service string, n int) int
+}
+
+// LivenessRecorder is told of every export a service makes, whether or not its data
+// is kept, with the newest payload timestamp in it (zero if it had none).
+type LivenessRecorder interface {
+	Observe(tenant, service, signal string, newest time.Time)
+}
+
 type TraceServer struct {
-	repo             *storage.Repository
-	metrics          *telemetry.Metrics
-	logCallback      func(storage.Log)
-	spanCallback     func(storage.Span) // called for each span after persistence
-	minSeverity      int
-	allowedServices  map[string]bool
-	excludedServices map[string]bool
-	sampler          *Sampler // nil = no sampling (keep all)
+	repo           TraceStore
+	metrics        *telemetry.Metrics
+	logCallback    func([]storage.Log) // called with each stored batch of logs
+	spanCallback   func(storage.Span)  // called for each span after persistence
+	traceCallback  func(storage.Trace) // called with one summary per trace after persistence
+	ingestCallback func(service string, count int)
+	filters        *Filters          // shared with the other receivers, swapped at runtime
+	serviceAliases map[string]string // alias -> canonical service name
+	defaultEnv     string            // environment of resources without deployment.environment
+	sampler        *Sampler          // nil = no sampling (keep all)
+	quota          QuotaEnforcer     // nil = no quotas
+	liveness       LivenessRecorder  // nil = not tracked
+	derived        *tsdb.Aggregator  // receives RED metrics derived from root spans (nil = off)
+	maxBodyBytes   int               // span event messages are cut to this size (0 = no limit)
+	errorLogs      ErrorLogLookup    // nil = status logs are not checked against stored app logs
+	spanLimit      *SpanLimiter      // nil = no per-trace span limit
 	coltracepb.UnimplementedTraceServiceServer
 }
 
 type LogsServer struct {
-	repo             *storage.Repository
-	metrics          *telemetry.Metrics
-	logCallback      func(storage.Log)
-	minSeverity      int
-	allowedServices  map[string]bool
-	excludedServices map[string]bool
+	repo           storage.LogWriter
+	metrics        *telemetry.Metrics
+	logCallback    func([]storage.Log) // called with each stored batch of logs
+	ingestCallback func(service string, count int)
+	filters        *Filters          // shared with the other receivers, swapped at runtime
+	serviceAliases map[string]string // alias -> canonical service name
+	defaultEnv     string            // environment of resources without deployment.environment
+	quota          QuotaEnforcer     // nil = no quotas
+	liveness       LivenessRecorder  // nil = not tracked
+	collapser      *LogCollapser     // nil = every record is stored
+	maxBodyBytes   int               // bodies are cut to this size (0 = no limit)
 	collogspb.UnimplementedLogsServiceServer
 }
 
 type MetricsServer struct {
-	repo             *storage.Repository
-	metrics          *telemetry.Metrics
-	aggregator       *tsdb.Aggregator
-	metricCallback   func(tsdb.RawMetric)
-	allowedServices  map[string]bool
-	excludedServices map[string]bool
+	repo           storage.MetricWriter
+	metrics        *telemetry.Metrics
+	aggregator     *tsdb.Aggregator
+	metricCallback func(tsdb.RawMetric)
+	ingestCallback func(service string, count int)
+	filters        *Filters          // shared with the other receivers, swapped at runtime
+	serviceAliases map[string]string // alias -> canonical service name
+	maxFutureSkew  time.Duration     // points further ahead than this are clamped to now (0 = off)
+	liveness       LivenessRecorder  // nil = not tracked
 	colmetricspb.UnimplementedMetricsServiceServer
 }
 
-func NewTraceServer(repo *storage.Repository, metrics *telemetry.Metrics, cfg *config.Config) *TraceServer {
+func NewTraceServer(repo TraceStore, metrics *telemetry.Metrics, cfg *config.Config) *TraceServer {
 	return &TraceServer{
-		repo:             repo,
-		metrics:          metrics,
-		minSeverity:      parseSeverity(cfg.IngestMinSeverity),
-		allowedServices:  parseServiceList(cfg.IngestAllowedServices),
-		excludedServices: parseServiceList(cfg.IngestExcludedServices),
+		repo:           repo,
+		metrics:        metrics,
+		filters:        NewFilters(cfg),
+		serviceAliases: parseServiceAliases(cfg.IngestServiceAliases),
+		defaultEnv:     cfg.IngestDefaultEnv,
+		maxBodyBytes:   cfg.LogMaxBodyBytes,
 	}
 }
 
-// SetLogCallback sets the function to call when a new log is synthesized from a trace.
-func (s *TraceServer) SetLogCallback(cb func(storage.Log)) {
+// SetLogCallback sets the function to call with each batch of logs synthesized from
+// spans, after persistence. It runs on the Export path, so it should hand the batch
+// off (see LogDispatcher) rather than do the fan-out itself.
+func (s *TraceServer) SetLogCallback(cb func([]storage.Log)) {
 	s.logCallback = cb
 }
 
@@ -75,33 +127,108 @@ func (s *TraceServer) SetSpanCallback(cb func(storage.Span)) {
 	s.spanCallback = cb
 }
 
+// SetTraceCallback sets the function to call with a summary of each trace in a persisted batch.
+func (s *TraceServer) SetTraceCallback(cb func(storage.Trace)) {
+	s.traceCallback = cb
+}
+
+// SetIngestCallback sets the function to call with per-service span counts after persistence.
+func (s *TraceServer) SetIngestCallback(cb func(service string, count int)) {
+	s.ingestCallback = cb
+}
+
 // SetSampler enables adaptive trace sampling. Pass nil to disable.
 func (s *TraceServer) SetSampler(sm *Sampler) {
 	s.sampler = sm
 }
 
-func NewLogsServer(repo *storage.Repository, metrics *telemetry.Metrics, cfg *config.Config) *LogsServer {
+// SetQuota enables per-service span quotas. Pass nil to disable.
+func (s *TraceServer) SetQuota(q QuotaEnforcer) {
+	s.quota = q
+}
+
+// SetFilters replaces the filters built from the config with a shared instance.
+func (s *TraceServer) SetFilters(f *Filters) {
+	s.filters = f
+}
+
+// SetLiveness records each service's span exports in l. Pass nil to disable.
+func (s *TraceServer) SetLiveness(l LivenessRecorder) {
+	s.liveness = l
+}
+
+// SetDerivedMetrics feeds request, error and duration metrics derived from root spans
+// into agg. Pass nil to disable.
+func (s *TraceServer) SetDerivedMetrics(agg *tsdb.Aggregator) {
+	s.derived = agg
+}
+
+// SetStatusLogDedupe skips the ERROR log synthesized for a failed span when lookup
+// finds that the app already logged an error under the span. Pass nil to disable.
+func (s *TraceServer) SetStatusLogDedupe(lookup ErrorLogLookup) {
+	s.errorLogs = lookup
+}
+
+// SetSpanLimiter caps the spans stored per trace. Pass nil to disable.
+func (s *TraceServer) SetSpanLimiter(l *SpanLimiter) {
+	s.spanLimit = l
+}
+
+func NewLogsServer(repo storage.LogWriter, metrics *telemetry.Metrics, cfg *config.Config) *LogsServer {
 	return &LogsServer{
-		repo:             repo,
-		metrics:          metrics,
-		minSeverity:      parseSeverity(cfg.IngestMinSeverity),
-		allowedServices:  parseServiceList(cfg.IngestAllowedServices),
-		excludedServices: parseServiceList(cfg.IngestExcludedServices),
+		repo:           repo,
+		metrics:        metrics,
+		filters:        NewFilters(cfg),
+		serviceAliases: parseServiceAliases(cfg.IngestServiceAliases),
+		defaultEnv:     cfg.IngestDefaultEnv,
+		maxBodyBytes:   cfg.LogMaxBodyBytes,
 	}
 }
 
-// SetLogCallback sets the function to call when a new log is received.
-func (s *LogsServer) SetLogCallback(cb func(storage.Log)) {
+// SetLogCallback sets the function to call with each batch of received logs, after
+// persistence. Like TraceServer.SetLogCallback it runs on the Export path.
+func (s *LogsServer) SetLogCallback(cb func([]storage.Log)) {
 	s.logCallback = cb
 }
 
-func NewMetricsServer(repo *storage.Repository, metrics *telemetry.Metrics, aggregator *tsdb.Aggregator, cfg *config.Config) *MetricsServer {
+// SetIngestCallback sets the function to call with per-service log counts after persistence.
+func (s *LogsServer) SetIngestCallback(cb func(service string, count int)) {
+	s.ingestCallback = cb
+}
+
+// SetQuota enables per-service log quotas. Pass nil to disable.
+func (s *LogsServer) SetQuota(q QuotaEnforcer) {
+	s.quota = q
+}
+
+// SetCollapser folds repeated identical records into their first occurrence. Pass
+// nil to disable.
+func (s *LogsServer) SetCollapser(c *LogCollapser) {
+	s.collapser = c
+}
+
+// SetFilters replaces the filters built from the config with a shared instance.
+func (s *LogsServer) SetFilters(f *Filters) {
+	s.filters = f
+}
+
+// SetLiveness records each service's log exports in l. Pass nil to disable.
+func (s *LogsServer) SetLiveness(l LivenessRecorder) {
+	s.liveness = l
+}
+
+func NewMetricsServer(repo storage.MetricWriter, metrics *telemetry.Metrics, aggregator *tsdb.Aggregator, cfg *config.Config) *MetricsServer {
+	maxFutureSkew, err := time.ParseDuration(cfg.MetricMaxFutureSkew)
+	if err != nil {
+		maxFutureSkew = time.Hour
+	}
 	return &MetricsServer{
-		repo:             repo,
-		metrics:          metrics,
-		aggregator:       aggregator,
-		allowedServices:  parseServiceList(cfg.IngestAllowedServices),
-		excludedServices: parseServiceList(cfg.IngestExcludedServices),
+		repo:           repo,
+		metrics:        metrics,
+		aggregator:     aggregator,
+		filters:        NewFilters(cfg),
+		serviceAliases: parseServiceAliases(cfg.IngestServiceAliases),
+		maxFutureSkew:  maxFutureSkew,
 	}
 }
 
@@ -110,27 +237,84 @@ func (s *MetricsServer) SetMetricCallback(cb func(tsdb.RawMetric)) {
 	s.metricCallback = cb
 }
 
+// SetIngestCallback sets the function to call with per-service metric point counts.
+func (s *MetricsServer) SetIngestCallback(cb func(service string, count int)) {
+	s.ingestCallback = cb
+}
+
+// SetLiveness records each service's metric exports in l. Pass nil to disable.
+func (s *MetricsServer) SetLiveness(l LivenessRecorder) {
+	s.liveness = l
+}
+
+// SetFilters replaces the filters built from the config with a shared instance.
+func (s *MetricsServer) SetFilters(f *Filters) {
+	s.filters = f
+}
+
 // Export handles incoming OTLP metrics data.
 func (s *MetricsServer) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	filters := s.filters.load()
+	now := time.Now()
+	tenantID := tenant.IngestTenant(ctx)
+	clamped, reserved := 0, 0
+	var dropped rejections
 	for _, resourceMetrics := range req.ResourceMetrics {
-		serviceName := getServiceName(resourceMetrics.Resource.Attributes)
+		serviceName := getServiceName(resourceMetrics.Resource.Attributes, s.serviceAliases)
 
-		if !shouldIngestService(serviceName, s.allowedServices, s.excludedServices) {
+		if !shouldIngestService(serviceName, filters.allowed, filters.excluded) {
+			n := 0
+			for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+				for _, m := range scopeMetrics.Metrics {
+					n += dataPoints(m)
+				}
+			}
+			dropped.add(rejectServiceExcluded, serviceName, n)
 			continue
 		}
 
+		pointCount := 0
+		var newest time.Time
 		for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+			scopeName, _ := scopeInfo(scopeMetrics.Scope)
 			for _, m := range scopeMetrics.Metrics {
+				if isReservedMetric(m.Name) {
+					reserved++
+					dropped.add(rejectReservedName, serviceName, dataPoints(m))
+					continue
+				}
 				var points []*metricspb.NumberDataPoint
+				var metricType string
 
 				// Extract points based on metric type
 				switch m.Data.(type) {
 				case *metricspb.Metric_Gauge:
-					points = m.GetGauge().DataPoints
+					points, metricType = m.GetGauge().DataPoints, "gauge"
 				case *metricspb.Metric_Sum:
-					points = m.GetSum().DataPoints
+					points, metricType = m.GetSum().DataPoints, "sum"
+				case *metricspb.Metric_Histogram:
+					// Histograms are not aggregated, but the catalog lists them.
+					if s.aggregator != nil {
+						for _, p := range m.GetHistogram().DataPoints {
+							ts := time.Unix(0, int64(p.TimeUnixNano)).UTC()
+							if ts.After(now) {
+								ts = now
+							}
+							s.aggregator.Describe(tsdb.RawMetric{
+								Name:        m.Name,
+								TenantID:    tenantID,
+								ServiceName: serviceName,
+								Timestamp:   ts,
+								Attributes:  attributeMap(p.Attributes),
+								Type:        "histogram",
+								Unit:        m.Unit,
+								Description: m.Description,
+							})
+						}
+					}
 				}
 
+				pointCount += len(points)
 				for _, p := range points {
 					var val float64
 					if p.Value != nil {
@@ -142,17 +326,28 @@ func (s *MetricsServer) Export(ctx context.Context, req *colmetricspb.ExportMetr
 						}
 					}
 
+					// A sender with a bad clock must not create far-future buckets.
+					ts := time.Unix(0, int64(p.TimeUnixNano)).UTC()
+					if p.TimeUnixNano != 0 && ts.After(newest) {
+						newest = ts
+					}
+					if s.maxFutureSkew > 0 && ts.Sub(now) > s.maxFutureSkew {
+						ts = now
+						clamped++
+					}
+
 					raw := tsdb.RawMetric{
 						Name:        m.Name,
+						TenantID:    tenantID,
 						ServiceName: serviceName,
+						ScopeName:   scopeName,
 						Value:       val,
-						Timestamp:   time.Unix(0, int64(p.TimeUnixNano)),
-						Attributes:  make(map[string]interface{}),
-					}
-
-					// Convert attributes to map for TSDB grouping
-					for _, kv := range p.Attributes {
-						raw.Attributes[kv.Key] = kv.Value.String()
+						Timestamp:   ts,
+						Attributes:  attributeMap(p.Attributes),
+						Exemplars:   convertExemplars(p.Exemplars),
+						Type:        metricType,
+						Unit:        m.Unit,
+						Description: m.Description,
 					}
 
 					// 1. Process via TSDB Aggregator (for storage)
@@ -167,6 +362,23 @@ func (s *MetricsServer) Export(ctx context.Context, req *colmetricspb.ExportMetr
 				}
 			}
 		}
+
+		if s.ingestCallback != nil && pointCount > 0 {
+			s.ingestCallback(serviceName, pointCount)
+		}
+		if s.liveness != nil && pointCount > 0 {
+			s.liveness.Observe(tenantID, serviceName, liveness.SignalMetrics, newest)
+		}
+	}
+
+	if reserved > 0 {
+		logger.Debug("Dropped metrics using the reserved derived-metric prefix", "count", reserved, "prefix", DerivedMetricPrefix)
+	}
+	if clamped > 0 {
+		logger.Debug("Clamped future-dated metric points", "count", clamped, "max_skew", s.maxFutureSkew)
+		if s.metrics != nil {
+			s.metrics.RecordMetricPointsClamped(clamped)
+		}
 	}
 
 	if s.metrics != nil {
@@ -174,49 +386,86 @@ func (s *MetricsServer) Export(ctx context.Context, req *colmetricspb.ExportMetr
 		s.metrics.RecordIngestion(1)
 	}
 
-	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if n := dropped.total(); n > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: n,
+			ErrorMessage:       dropped.message("data point", filters),
+		}
+	}
+	return resp, nil
 }
 
 // Export handles incoming OTLP trace data.
 func (s *TraceServer) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
-	slog.Debug("📥 [TRACES] Received Request", "resource_spans", len(req.ResourceSpans))
+	logger.Debug("📥 [TRACES] Received Request", "resource_spans", len(req.ResourceSpans))
+	filters := s.filters.load() // one snapshot per request
+	tenantID := tenant.IngestTenant(ctx)
 
 	type batchResult struct {
-		spans  []storage.Span
-		traces []storage.Trace
-		logs   []storage.Log
+		service string
+		spans   []storage.Span
+		traces  []storage.Trace
+		logs    []storage.Log
+		derived []tsdb.RawMetric
+		dropped rejections
 	}
 
 	results := make([]batchResult, len(req.ResourceSpans))
 
+	var logged map[storage.LogSpanKey]bool // read-only below
+	if s.errorLogs != nil {
+		logged = s.loggedFailures(ctx, tenantID, req)
+	}
+
 	g, _ := errgroup.WithContext(ctx)
 	g.SetLimit(runtime.GOMAXPROCS(0) * 4)
 
 	for idx, resourceSpans := range req.ResourceSpans {
 		idx, resourceSpans := idx, resourceSpans // Capture
 		g.Go(func() error {
-			serviceName := getServiceName(resourceSpans.Resource.Attributes)
-
-			if !shouldIngestService(serviceName, s.allowedServices, s.excludedServices) {
-				slog.Debug("🚫 [TRACES] Dropped service", "service", serviceName)
+			serviceName := getServiceName(resourceSpans.Resource.Attributes, s.serviceAliases)
+			env := getEnvironment(resourceSpans.Resource.Attributes, s.defaultEnv)
+
+			if !shouldIngestService(serviceName, filters.allowed, filters.excluded) {
+				logger.Debug("🚫 [TRACES] Dropped service", "service", serviceName)
+				n := 0
+				for _, scopeSpans := range resourceSpans.ScopeSpans {
+					n += len(scopeSpans.Spans)
+				}
+				results[idx].dropped.add(rejectServiceExcluded, serviceName, n)
 				return nil
 			}
 
 			localSpans := make([]storage.Span, 0)
 			localTraces := make([]storage.Trace, 0)
 			localLogs := make([]storage.Log, 0)
+			var localDerived []tsdb.RawMetric
+			var received int
+			var newest time.Time
 
 			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				scopeName, scopeVersion := scopeInfo(scopeSpans.Scope)
 				for _, span := range scopeSpans.Spans {
-					startTime := time.Unix(0, int64(span.StartTimeUnixNano))
-					endTime := time.Unix(0, int64(span.EndTimeUnixNano))
+					startTime := time.Unix(0, int64(span.StartTimeUnixNano)).UTC()
+					endTime := time.Unix(0, int64(span.EndTimeUnixNano)).UTC()
 					duration := endTime.Sub(startTime).Microseconds()
+					received++
+					if span.EndTimeUnixNano != 0 && endTime.After(newest) {
+						newest = endTime
+					}
 
 					// Adaptive sampling: evaluate before any allocations.
 					statusStr := "STATUS_CODE_UNSET"
 					if span.Status != nil {
 						statusStr = span.Status.Code.String()
 					}
+					// Derived metrics count every root span, sampled out or not.
+					if s.derived != nil && isRootSpan(span.ParentSpanId) {
+						localDerived = append(localDerived, deriveREDMetrics(tenantID, serviceName, span.Name,
+							fmt.Sprintf("%x", span.TraceId), fmt.Sprintf("%x", span.SpanId),
+							startTime, float64(duration)/1000.0, statusStr == "STATUS_CODE_ERROR")...)
+					}
 					if s.sampler != nil {
 						isError := statusStr == "STATUS_CODE_ERROR"
 						durationMs := float64(duration) / 1000.0
@@ -225,87 +474,111 @@ func (s *TraceServer) Export(ctx context.Context, req *coltracepb.ExportTraceSer
 						}
 					}
 
-					attrs, _ := json.Marshal(span.Attributes)
-
 					// Create Span Model
 					sModel := storage.Span{
 						TraceID:        fmt.Sprintf("%x", span.TraceId),
+						TenantID:       tenantID,
+						Environment:    env,
 						SpanID:         fmt.Sprintf("%x", span.SpanId),
 						ParentSpanID:   fmt.Sprintf("%x", span.ParentSpanId),
 						OperationName:  span.Name,
+						Kind:           spanKind(span.Kind),
 						StartTime:      startTime,
 						EndTime:        endTime,
 						Duration:       duration,
+						HasError:       statusStr == "STATUS_CODE_ERROR",
+						HTTPStatusCode: httpStatusCode(span.Attributes),
 						ServiceName:    serviceName,
-						AttributesJSON: storage.CompressedText(attrs),
+						ScopeName:      scopeName,
+						ScopeVersion:   scopeVersion,
+						AttributesJSON: AttributesJSON(span.Attributes),
+						Links:          spanLinks(span.Links),
 					}
 					localSpans = append(localSpans, sModel)
 
 					tModel := storage.Trace{
 						TraceID:     fmt.Sprintf("%x", span.TraceId),
+						TenantID:    tenantID,
+						Environment: env,
 						ServiceName: serviceName,
 						Timestamp:   startTime,
 						Duration:    duration,
 						Status:      statusStr,
+						HasError:    statusStr == "STATUS_CODE_ERROR",
 					}
 					localTraces = append(localTraces, tModel)
 
 					// Synthesize Logs from Span Events (exceptions) and Status
 					for _, event := range span.Events {
-						severity := "INFO"
+						severity := storage.SeverityInfo
 						if event.Name == "exception" {
-							severity = "ERROR"
+							severity = storage.SeverityError
 						}
 
-						if !shouldIngestSeverity(severity, s.minSeverity) {
+						if !shouldIngestSeverity(severity, filters.minSeverity) {
 							continue
 						}
 
 						body := event.Name
 						for _, attr := range event.Attributes {
 							if attr.Key == "exception.message" || attr.Key == "message" {
-								body = attr.Value.GetStringValue()
+								body = attributeText(attr.Value)
 								break
 							}
 						}
 
-						eventAttrs, _ := json.Marshal(event.Attributes)
+						eventAttrList := append(slices.Clip(event.Attributes), sourceAttr(SourceSpanEvent))
+						body, attrList, truncated := limitBody(body, eventAttrList, s.maxBodyBytes)
 
 						l := storage.Log{
 							TraceID:        fmt.Sprintf("%x", span.TraceId),
+							TenantID:       tenantID,
+							Environment:    env,
 							SpanID:         fmt.Sprintf("%x", span.SpanId),
 							Severity:       severity,
 							Body:           storage.CompressedText(body),
+							Truncated:      truncated,
 							ServiceName:    serviceName,
-							AttributesJSON: storage.CompressedText(eventAttrs),
-							Timestamp:      time.Unix(0, int64(event.TimeUnixNano)),
+							ScopeName:      scopeName,
+							ScopeVersion:   scopeVersion,
+							AttributesJSON: AttributesJSON(attrList),
+							Timestamp:      time.Unix(0, int64(event.TimeUnixNano)).UTC(),
+							Synthetic:      true,
 						}
 						localLogs = append(localLogs, l)
 					}
 
-					hasErrorLog := false
+					// An exception event, or with dedupe on an app log, already records the failure.
+					hasErrorLog := logged[storage.LogSpanKey{TraceID: fmt.Sprintf("%x", span.TraceId), SpanID: fmt.Sprintf("%x", span.SpanId)}]
 					for _, sl := range localLogs {
-						if sl.Severity == "ERROR" && sl.SpanID == fmt.Sprintf("%x", span.SpanId) {
+						if sl.Severity == storage.SeverityError && sl.SpanID == fmt.Sprintf("%x", span.SpanId) {
 							hasErrorLog = true
 							break
 						}
 					}
 
 					if !hasErrorLog && span.Status != nil && span.Status.Code == tracepb.Status_STATUS_CODE_ERROR {
-						if shouldIngestSeverity("ERROR", s.minSeverity) {
+						if shouldIngestSeverity(storage.SeverityError, filters.minSeverity) {
 							msg := span.Status.Message
 							if msg == "" {
 								msg = fmt.Sprintf("Span '%s' failed", span.Name)
 							}
+							msg, attrList, truncated := limitBody(msg, []*commonpb.KeyValue{sourceAttr(SourceSpanStatus)}, s.maxBodyBytes)
 
 							l := storage.Log{
 								TraceID:        fmt.Sprintf("%x", span.TraceId),
+								TenantID:       tenantID,
+								Environment:    env,
 								SpanID:         fmt.Sprintf("%x", span.SpanId),
-								Severity:       "ERROR",
+								Severity:       storage.SeverityError,
 								Body:           storage.CompressedText(msg),
+								Truncated:      truncated,
 								ServiceName:    serviceName,
-								AttributesJSON: "{}",
+								ScopeName:      scopeName,
+								ScopeVersion:   scopeVersion,
+								AttributesJSON: AttributesJSON(attrList),
 								Timestamp:      endTime,
+								Synthetic:      true,
 							}
 							localLogs = append(localLogs, l)
 						}
@@ -313,8 +586,20 @@ func (s *TraceServer) Export(ctx context.Context, req *coltracepb.ExportTraceSer
 				}
 			}
 
+			if s.liveness != nil && received > 0 {
+				s.liveness.Observe(tenantID, serviceName, liveness.SignalSpans, newest)
+			}
+
+			var dropped rejections
+			if s.quota != nil && len(localSpans) > 0 {
+				if accepted := s.quota.AllowSpans(serviceName, len(localSpans)); accepted < len(localSpans) {
+					dropped.add(rejectOverQuota, serviceName, len(localSpans)-accepted)
+					localSpans, localTraces, localLogs = truncateSpans(localSpans, localTraces, localLogs, accepted)
+				}
+			}
+
 			// Store results in pre-allocated slot (no mutex needed)
-			results[idx] = batchResult{spans: localSpans, traces: localTraces, logs: localLogs}
+			results[idx] = batchResult{service: serviceName, spans: localSpans, traces: localTraces, logs: localLogs, derived: localDerived, dropped: dropped}
 
 			return nil
 		})
@@ -322,23 +607,53 @@ func (s *TraceServer) Export(ctx context.Context, req *coltracepb.ExportTraceSer
 
 	g.Wait()
 
+	// The per-trace span limit applies to the export as a whole. Trace rows are kept
+	// for the dropped spans, so the trace is flagged on error and carries the marker.
+	var overLimit map[string]int
+	if s.spanLimit != nil {
+		var all []storage.Span
+		for _, r := range results {
+			all = append(all, r.spans...)
+		}
+		allow := s.spanLimit.Allow(all)
+		overLimit = make(map[string]int)
+		for i := range results {
+			r := &results[i]
+			n := len(r.spans)
+			r.spans, r.logs = keepSpans(r.spans, r.logs, allow[:n], overLimit)
+			r.dropped.add(rejectTraceSpanLimit, r.service, n-len(r.spans))
+			allow = allow[n:]
+		}
+	}
+
 	// Merge results after all goroutines complete (no lock contention)
 	var spansToInsert []storage.Span
 	var tracesToUpsert []storage.Trace
 	var synthesizedLogs []storage.Log
+	var derived []tsdb.RawMetric
+	var dropped rejections
 	for _, r := range results {
 		spansToInsert = append(spansToInsert, r.spans...)
 		tracesToUpsert = append(tracesToUpsert, r.traces...)
 		synthesizedLogs = append(synthesizedLogs, r.logs...)
+		derived = append(derived, r.derived...)
+		dropped = append(dropped, r.dropped...)
 	}
 
 	// Persist - CRITICAL ORDER: Traces MUST be inserted before Spans due to FK
 	if len(tracesToUpsert) > 0 {
 		if err := s.repo.BatchCreateTraces(tracesToUpsert); err != nil {
-			slog.Error("❌ Failed to insert traces", "error", err)
+			logger.Error("❌ Failed to insert traces", "error", err)
 			// Continue anyway to allow spans to be inserted if traces exist from previous runs
 		} else {
-			// slog.Debug("✅ Successfully persisted trace records", "count", len(tracesToUpsert))
+			// logger.Debug("✅ Successfully persisted trace records", "count", len(tracesToUpsert))
+		}
+	}
+	if len(overLimit) > 0 {
+		s.spanLimit.RecordDropped(overLimit)
+		if s.metrics != nil {
+			n, _ := dropped.count(rejectTraceSpanLimit)
+			s.metrics.RecordSpansOverTraceLimit(int(n))
 		}
 	}
 
@@ -346,89 +661,154 @@ func (s *TraceServer) Export(ctx context.Context, req *coltracepb.ExportTraceSer
 		if s.metrics != nil {
 			s.metrics.GRPCBatchSize.Observe(float64(len(spansToInsert)))
 		}
-		if err := s.repo.BatchCreateSpans(spansToInsert); err != nil {
-			slog.Error("❌ Failed to insert spans", "error", err)
+		stored, failed, err := storeByService(spansToInsert, func(sp storage.Span) string { return sp.ServiceName }, s.repo.BatchCreateSpans)
+		if err != nil {
+			logger.Error("❌ Failed to insert spans", "error", err)
 			return nil, err
 		}
+		spansToInsert = stored
+		dropped = append(dropped, failed...)
 		if s.metrics != nil {
 			s.metrics.RecordIngestion(len(spansToInsert))
 		}
+		if s.ingestCallback != nil {
+			_, unstored := failed.count(rejectPersistenceFailed)
+			for _, r := range results {
+				if len(r.spans) > 0 && !slices.Contains(unstored, r.service) {
+					s.ingestCallback(r.service, len(r.spans))
+				}
+			}
+		}
 		// Notify GraphRAG of persisted spans
 		if s.spanCallback != nil {
 			for _, span := range spansToInsert {
 				s.spanCallback(span)
 			}
 		}
+		// Push trace summaries to live clients
+		if s.traceCallback != nil {
+			for _, t := range summarizeTraces(tracesToUpsert, spansToInsert) {
+				s.traceCallback(t)
+			}
+		}
+	}
+	// Only now that the export will not be retried, so a resent one is not counted twice
+	for _, m := range derived {
+		s.derived.Ingest(m)
 	}
 
 	if len(synthesizedLogs) > 0 {
 		if err := s.repo.BatchCreateLogs(synthesizedLogs); err != nil {
-			slog.Error("❌ Failed to insert synthesized logs", "error", err)
+			logger.Error("❌ Failed to insert synthesized logs", "error", err)
 			// Continue, don't fail the whole trace request
 		}
 
 		if s.logCallback != nil {
-			for _, l := range synthesizedLogs {
-				s.logCallback(l)
-			}
+			s.logCallback(synthesizedLogs)
 		}
 	}
 
-	return &coltracepb.ExportTraceServiceResponse{}, nil
+	resp := &coltracepb.ExportTraceServiceResponse{}
+	if n, overQuota := dropped.count(rejectOverQuota); n > 0 {
+		logger.Warn("🚫 [TRACES] Spans rejected over daily quota", "services", overQuota, "rejected", n)
+	}
+	if n := dropped.total(); n > 0 {
+		resp.PartialSuccess = &coltracepb.ExportTracePartialSuccess{
+			RejectedSpans: n,
+			ErrorMessage:  dropped.message("span", filters),
+		}
+	}
+	return resp, nil
 }
 
 // Export handles incoming OTLP log data.
 func (s *LogsServer) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
-	// slog.Debug("📥 [LOGS] Received Request", "resource_logs", len(req.ResourceLogs))
+	// logger.Debug("📥 [LOGS] Received Request", "resource_logs", len(req.ResourceLogs))
+	filters := s.filters.load() // one snapshot per request
+	tenantID := tenant.IngestTenant(ctx)
 
 	logResults := make([][]storage.Log, len(req.ResourceLogs))
+	dropped := make([]rejections, len(req.ResourceLogs))
 
 	g, _ := errgroup.WithContext(ctx)
 
 	for idx, resourceLogs := range req.ResourceLogs {
 		idx, resourceLogs := idx, resourceLogs // Capture
 		g.Go(func() error {
-			serviceName := getServiceName(resourceLogs.Resource.Attributes)
-
-			if !shouldIngestService(serviceName, s.allowedServices, s.excludedServices) {
-				slog.Debug("🚫 [LOGS] Dropped service", "service", serviceName)
+			serviceName := getServiceName(resourceLogs.Resource.Attributes, s.serviceAliases)
+			env := getEnvironment(resourceLogs.Resource.Attributes, s.defaultEnv)
+
+			if !shouldIngestService(serviceName, filters.allowed, filters.excluded) {
+				logger.Debug("🚫 [LOGS] Dropped service", "service", serviceName)
+				n := 0
+				for _, scopeLogs := range resourceLogs.ScopeLogs {
+					n += len(scopeLogs.LogRecords)
+				}
+				dropped[idx].add(rejectServiceExcluded, serviceName, n)
 				return nil
 			}
 
 			localLogs := make([]storage.Log, 0)
+			var received, belowSeverity int
+			var newest time.Time
 
 			for _, scopeLogs := range resourceLogs.ScopeLogs {
+				scopeName, scopeVersion := scopeInfo(scopeLogs.Scope)
 				for _, l := range scopeLogs.LogRecords {
-					severity := l.SeverityText
-					if severity == "" {
-						severity = l.SeverityNumber.String()
+					received++
+					if ts := time.Unix(0, int64(l.TimeUnixNano)).UTC(); l.TimeUnixNano != 0 && ts.After(newest) {
+						newest = ts
+					}
+					severity := storage.NormalizeSeverity(l.SeverityText, int32(l.SeverityNumber))
+					rawSeverity := l.SeverityText
+					if rawSeverity == "" {
+						rawSeverity = l.SeverityNumber.String()
 					}
 
-					if !shouldIngestSeverity(severity, s.minSeverity) {
+					if !shouldIngestSeverity(severity, filters.minSeverity) {
+						belowSeverity++
 						continue
 					}
 
-					timestamp := time.Unix(0, int64(l.TimeUnixNano))
+					timestamp := time.Unix(0, int64(l.TimeUnixNano)).UTC()
 					if timestamp.Unix() == 0 {
-						timestamp = time.Now()
+						timestamp = time.Now().UTC()
 					}
 
-					bodyStr := l.Body.GetStringValue()
-					attrs, _ := json.Marshal(l.Attributes)
-
+					bodyStr, bodyType := anyValueText(l.Body)
+					bodyStr, attrList, truncated := limitBody(bodyStr, l.Attributes, s.maxBodyBytes)
 					logEntry := storage.Log{
 						TraceID:        fmt.Sprintf("%x", l.TraceId),
+						TenantID:       tenantID,
+						Environment:    env,
 						SpanID:         fmt.Sprintf("%x", l.SpanId),
 						Severity:       severity,
+						RawSeverity:    rawSeverity,
 						Body:           storage.CompressedText(bodyStr),
+						BodyType:       bodyType,
+						Truncated:      truncated,
 						ServiceName:    serviceName,
-						AttributesJSON: storage.CompressedText(attrs),
+						ScopeName:      scopeName,
+						ScopeVersion:   scopeVersion,
+						AttributesJSON: AttributesJSON(attrList),
 						Timestamp:      timestamp,
 					}
 					localLogs = append(localLogs, logEntry)
 				}
 			}
 
+			if s.liveness != nil && received > 0 {
+				s.liveness.Observe(tenantID, serviceName, liveness.SignalLogs, newest)
+			}
+
+			dropped[idx].add(rejectFilteredBySeverity, serviceName, belowSeverity)
+			if s.quota != nil && len(localLogs) > 0 {
+				if accepted := s.quota.AllowLogs(serviceName, len(localLogs)); accepted < len(localLogs) {
+					dropped[idx].add(rejectOverQuota, serviceName, len(localLogs)-accepted)
+					localLogs = localLogs[:accepted]
+				}
+			}
+
 			logResults[idx] = localLogs
 
 			return nil
@@ -439,43 +819,359 @@ func (s *LogsServer) Export(ctx context.Context, req *collogspb.ExportLogsServic
 
 	// Merge results after all goroutines complete (no lock contention)
 	var logsToInsert []storage.Log
-	for _, lr := range logResults {
+	var rejected rejections
+	for idx, lr := range logResults {
 		logsToInsert = append(logsToInsert, lr...)
+		rejected = append(rejected, dropped[idx]...)
+	}
+	// Repeats only add to the first occurrence's count, so they reach neither the
+	// database nor the live stream and AI callbacks.
+	if s.collapser != nil && len(logsToInsert) > 0 {
+		var collapsed int
+		logsToInsert, collapsed = s.collapser.Collapse(logsToInsert)
+		if collapsed > 0 && s.metrics != nil {
+			s.metrics.RecordLogsCollapsed(collapsed)
+		}
 	}
 
 	if len(logsToInsert) > 0 {
-		if err := s.repo.BatchCreateLogs(logsToInsert); err != nil {
-			slog.Error("❌ Failed to insert logs", "error", err)
+		stored, failed, err := storeByService(logsToInsert, func(l storage.Log) string { return l.ServiceName }, s.repo.BatchCreateLogs)
+		if err != nil {
+			logger.Error("❌ Failed to insert logs", "error", err)
+			if s.collapser != nil {
+				s.collapser.Discard(logsToInsert)
+			}
 			return nil, err
 		}
+		if s.collapser != nil {
+			s.collapser.Stored(stored)
+			if len(failed) > 0 {
+				s.collapser.Discard(logsToInsert) // only the lines still without an ID
+			}
+		}
+		logsToInsert = stored
+		rejected = append(rejected, failed...)
 		if s.metrics != nil {
 			s.metrics.RecordIngestion(len(logsToInsert))
 		}
+		if s.ingestCallback != nil {
+			_, unstored := failed.count(rejectPersistenceFailed)
+			for _, lr := range logResults {
+				if len(lr) > 0 && !slices.Contains(unstored, lr[0].ServiceName) {
+					s.ingestCallback(lr[0].ServiceName, len(lr))
+				}
+			}
+		}
 
 		// Notify listener
 		if s.logCallback != nil {
-			for _, l := range logsToInsert {
-				s.logCallback(l)
+			s.logCallback(logsToInsert)
+		}
+	}
+
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if n, overQuota := rejected.count(rejectOverQuota); n > 0 {
+		logger.Warn("🚫 [LOGS] Logs rejected over daily quota", "services", overQuota, "rejected", n)
+	}
+	if n := rejected.total(); n > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: n,
+			ErrorMessage:       rejected.message("log", filters),
+		}
+	}
+	return resp, nil
+}
+
+// truncateSpans keeps the first n spans of a resource, their trace rows (one per
+// span) and only the logs synthesized from the spans that remain.
+func truncateSpans(spans []storage.Span, traces []storage.Trace, logs []storage.Log, n int) ([]storage.Span, []storage.Trace, []storage.Log) {
+	kept := make(map[string]bool, n)
+	for _, sp := range spans[:n] {
+		kept[sp.TraceID+sp.SpanID] = true
+	}
+	keptLogs := logs[:0]
+	for _, l := range logs {
+		if kept[l.TraceID+l.SpanID] {
+			keptLogs = append(keptLogs, l)
+		}
+	}
+	return spans[:n], traces[:n], keptLogs
+}
+
+// keepSpans keeps the allowed spans, index for index, and the logs synthesized from
+// them. The others are counted per trace in dropped.
+func keepSpans(spans []storage.Span, logs []storage.Log, allow []bool, dropped map[string]int) ([]storage.Span, []storage.Log) {
+	gone := make(map[string]bool)
+	kept := spans[:0]
+	for i, sp := range spans {
+		if allow[i] {
+			kept = append(kept, sp)
+			continue
+		}
+		dropped[sp.TraceID]++
+		gone[sp.TraceID+sp.SpanID] = true
+	}
+	if len(gone) == 0 {
+		return kept, logs
+	}
+	keptLogs := logs[:0]
+	for _, l := range logs {
+		if !gone[l.TraceID+l.SpanID] {
+			keptLogs = append(keptLogs, l)
+		}
+	}
+	return kept, keptLogs
+}
+
+// spanLinks converts a span's OTLP links. The linking trace and span IDs are filled
+// in when the span is stored.
+func spanLinks(in []*tracepb.Span_Link) []storage.SpanLink {
+	var out []storage.SpanLink
+	for _, l := range in {
+		if len(l.TraceId) == 0 {
+			continue
+		}
+		out = append(out, storage.SpanLink{
+			LinkedTraceID:  fmt.Sprintf("%x", l.TraceId),
+			LinkedSpanID:   fmt.Sprintf("%x", l.SpanId),
+			AttributesJSON: AttributesJSON(l.Attributes),
+		})
+	}
+	return out
+}
+
+// quotaMessage explains a partial success caused by daily quotas.
+func quotaMessage(signal string, services []string) string {
+	slices.Sort(services)
+	services = slices.Compact(services)
+	return fmt.Sprintf("daily %s quota exceeded for service(s) %s; data is rejected until 00:00 UTC", signal, strings.Join(services, ", "))
+}
+
+// convertExemplars keeps the exemplars that carry a trace ID; the rest cannot link
+// anywhere.
+func convertExemplars(in []*metricspb.Exemplar) []storage.Exemplar {
+	var out []storage.Exemplar
+	for _, ex := range in {
+		if len(ex.TraceId) == 0 {
+			continue
+		}
+		var val float64
+		switch v := ex.Value.(type) {
+		case *metricspb.Exemplar_AsDouble:
+			val = v.AsDouble
+		case *metricspb.Exemplar_AsInt:
+			val = float64(v.AsInt)
+		}
+		out = append(out, storage.Exemplar{
+			TraceID:   fmt.Sprintf("%x", ex.TraceId),
+			SpanID:    fmt.Sprintf("%x", ex.SpanId),
+			Value:     val,
+			Timestamp: time.Unix(0, int64(ex.TimeUnixNano)).UTC(),
+		})
+	}
+	return out
+}
+
+// SourceAttr is added to the attributes of a log synthesized from a span, holding
+// what it was made from: SourceSpanEvent or SourceSpanStatus.
+const (
+	SourceAttr       = "otelcontext.source"
+	SourceSpanEvent  = "span_event"
+	SourceSpanStatus = "span_status"
+)
+
+func sourceAttr(source string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: SourceAttr, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: source}}}
+}
+
+// loggedFailures returns the failed spans of req that already have an ERROR log
+// exported by the app, whose status logs are not synthesized. If the lookup fails,
+// every status log is kept.
+func (s *TraceServer) loggedFailures(ctx context.Context, tenantID string, req *coltracepb.ExportTraceServiceRequest) map[storage.LogSpanKey]bool {
+	var failed []storage.LogSpanKey
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				if span.Status != nil && span.Status.Code == tracepb.Status_STATUS_CODE_ERROR {
+					failed = append(failed, storage.LogSpanKey{TraceID: fmt.Sprintf("%x", span.TraceId), SpanID: fmt.Sprintf("%x", span.SpanId)})
+				}
 			}
 		}
 	}
+	if len(failed) == 0 {
+		return nil
+	}
+	logged, err := s.errorLogs.SpansWithErrorLogs(ctx, tenantID, failed)
+	if err != nil {
+		logger.Warn("Failed to look up app error logs; keeping status logs", "error", err)
+		return nil
+	}
+	return logged
+}
+
+// OriginalBodySizeAttr is added to the attributes of a log whose body was cut to the
+// ingest limit, holding the body's size in bytes as received.
+const OriginalBodySizeAttr = "otelcontext.body.original_size"
+
+// limitBody cuts body to max bytes. When it does, it returns attrs extended with
+// OriginalBodySizeAttr, leaving the request's own slice untouched.
+// attributeMap converts point attributes to the map the TSDB groups series by.
+func attributeMap(attrs []*commonpb.KeyValue) map[string]interface{} {
+	out := make(map[string]interface{}, len(attrs))
+	for _, kv := range attrs {
+		out[kv.Key] = attributeText(kv.Value)
+	}
+	return out
+}
 
-	return &collogspb.ExportLogsServiceResponse{}, nil
+func limitBody(body string, attrs []*commonpb.KeyValue, max int) (string, []*commonpb.KeyValue, bool) {
+	cut, truncated := storage.TruncateText(body, max)
+	if !truncated {
+		return body, attrs, false
+	}
+	attrs = append(slices.Clip(attrs), &commonpb.KeyValue{
+		Key:   OriginalBodySizeAttr,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(len(body))}},
+	})
+	return cut, attrs, true
 }
 
-// Helper to extract service.name from attributes
-func getServiceName(attrs []*commonpb.KeyValue) string {
+// Helper to extract service.name from attributes, resolved through the alias table.
+func getServiceName(attrs []*commonpb.KeyValue, aliases map[string]string) string {
+	name := "unknown-service"
 	for _, kv := range attrs {
 		if kv.Key == "service.name" {
-			return kv.Value.GetStringValue()
+			name = attributeText(kv.Value)
+			break
+		}
+	}
+	if canonical, ok := aliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// getEnvironment returns the deployment environment of a resource, from
+// deployment.environment.name or, in older semantic conventions,
+// deployment.environment; fallback when it has neither. It is cut to the 64 bytes
+// of the environment column.
+func getEnvironment(attrs []*commonpb.KeyValue, fallback string) string {
+	env, current := fallback, false
+	for _, kv := range attrs {
+		switch {
+		case kv.Key == "deployment.environment.name":
+			env, current = attributeText(kv.Value), true
+		case kv.Key == "deployment.environment" && !current:
+			env = attributeText(kv.Value)
 		}
 	}
-	return "unknown-service"
+	if len(env) > 64 {
+		env = env[:64]
+	}
+	return env
+}
+
+// scopeInfo returns the instrumentation scope name and version, truncated to their column sizes.
+func scopeInfo(scope *commonpb.InstrumentationScope) (string, string) {
+	name, version := scope.GetName(), scope.GetVersion()
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	if len(version) > 64 {
+		version = version[:64]
+	}
+	return name, version
+}
+
+// summarizeTraces collapses the per-span trace rows of a batch into one summary per
+// trace ID. Root spans, when present in the batch, provide the operation, duration and
+// start time; any error span marks the whole trace as errored.
+func summarizeTraces(traces []storage.Trace, spans []storage.Span) []storage.Trace {
+	byID := make(map[string]*storage.Trace, len(traces))
+	order := make([]string, 0, len(traces))
+	for _, t := range traces {
+		if existing, ok := byID[t.TraceID]; ok {
+			if t.Status == "STATUS_CODE_ERROR" {
+				existing.Status = t.Status
+			}
+			continue
+		}
+		t := t
+		byID[t.TraceID] = &t
+		order = append(order, t.TraceID)
+	}
+
+	for _, sp := range spans {
+		t, ok := byID[sp.TraceID]
+		if !ok {
+			continue
+		}
+		isRoot := sp.ParentSpanID == "" || strings.Trim(sp.ParentSpanID, "0") == ""
+		if isRoot {
+			t.ServiceName = sp.ServiceName
+			t.Environment = sp.Environment
+			t.Operation = sp.OperationName
+			t.Duration = sp.Duration
+			t.Timestamp = sp.StartTime
+		} else if t.Operation == "" {
+			t.Operation = sp.OperationName
+		}
+	}
+
+	out := make([]storage.Trace, 0, len(order))
+	for _, id := range order {
+		t := byID[id]
+		t.DurationMs = float64(t.Duration) / 1000.0
+		out = append(out, *t)
+	}
+	return out
+}
+
+// spanKind converts the OTLP span kind enum to its short form (e.g. "SERVER").
+// Unspecified kinds are stored as an empty string.
+func spanKind(kind tracepb.Span_SpanKind) string {
+	if kind == tracepb.Span_SPAN_KIND_UNSPECIFIED {
+		return ""
+	}
+	return strings.TrimPrefix(kind.String(), "SPAN_KIND_")
+}
+
+// httpStatusCode returns the span's HTTP response status code, read from
+// http.response.status_code or, from older semantic conventions, http.status_code.
+// Some SDKs send it as a string. It is nil when neither attribute holds a number of
+// at most three digits.
+func httpStatusCode(attrs []*commonpb.KeyValue) *int {
+	for _, kv := range attrs {
+		if kv.Key != "http.response.status_code" && kv.Key != "http.status_code" {
+			continue
+		}
+		var code int64
+		switch v := kv.Value.GetValue().(type) {
+		case *commonpb.AnyValue_IntValue:
+			code = v.IntValue
+		case *commonpb.AnyValue_StringValue:
+			n, err := strconv.ParseInt(strings.TrimSpace(v.StringValue), 10, 64)
+			if err != nil {
+				continue
+			}
+			code = n
+		default:
+			continue
+		}
+		if code < 0 || code > 999 {
+			continue
+		}
+		c := int(code)
+		return &c
+	}
+	return nil
 }
 
 // Filtering Helpers
 func parseSeverity(level string) int {
 	switch strings.ToUpper(level) {
+	case "TRACE":
+		return 5
 	case "DEBUG":
 		return 10
 	case "INFO":
@@ -491,56 +1187,53 @@ func parseSeverity(level string) int {
 	}
 }
 
-func parseServiceList(list string) map[string]bool {
-	m := make(map[string]bool)
-	if list == "" {
+// parseServiceAliases builds the alias -> canonical service name table. spec is either
+// "alias=canonical,alias2=canonical" or the path of a JSON file holding {"alias": "canonical"}.
+// Invalid entries are skipped with a warning so a typo never blocks ingestion.
+func parseServiceAliases(spec string) map[string]string {
+	m := make(map[string]string)
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return m
+	}
+
+	if !strings.Contains(spec, "=") {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			logger.Warn("Failed to read service alias file", "path", spec, "error", err)
+			return m
+		}
+		var file map[string]string
+		if err := json.Unmarshal(data, &file); err != nil {
+			logger.Warn("Invalid service alias file", "path", spec, "error", err)
+			return m
+		}
+		for alias, canonical := range file {
+			if alias = strings.TrimSpace(alias); alias != "" && strings.TrimSpace(canonical) != "" {
+				m[alias] = strings.TrimSpace(canonical)
+			}
+		}
 		return m
 	}
-	parts := strings.Split(list, ",")
-	for _, p := range parts {
-		trimmed := strings.TrimSpace(p)
-		if trimmed != "" {
-			m[trimmed] = true
+
+	for _, pair := range strings.Split(spec, ",") {
+		alias, canonical, ok := strings.Cut(pair, "=")
+		alias, canonical = strings.TrimSpace(alias), strings.TrimSpace(canonical)
+		if !ok || alias == "" || canonical == "" {
+			if strings.TrimSpace(pair) != "" {
+				logger.Warn("Ignoring invalid service alias", "entry", pair)
+			}
+			continue
 		}
+		m[alias] = canonical
 	}
 	return m
 }
 
+// shouldIngestSeverity reports whether a log of the canonical level passes the
+// minimum severity filter.
 func shouldIngestSeverity(level string, minLevel int) bool {
-	// Map OTLP/Text severity to int
-	// If it's a number string "1", "9", etc., convert.
-	// OTLP: TRACE=1, DEBUG=5, INFO=9, WARN=13, ERROR=17, FATAL=21
-	// Simple mapping for text:
-
-	lvl := 0
-	upper := strings.ToUpper(level)
-
-	switch {
-	case strings.Contains(upper, "DEBUG"):
-		lvl = 10
-	case strings.Contains(upper, "INFO"):
-		lvl = 20
-	case strings.Contains(upper, "WARN"):
-		lvl = 30
-	case strings.Contains(upper, "ERR"):
-		lvl = 40
-	case strings.Contains(upper, "FATAL"):
-		lvl = 50
-	default:
-		// Fallback for strict numeric strings or unknown
-		// If "SEVERITY_NUMBER_INFO" etc.
-		if strings.Contains(upper, "INFO") {
-			lvl = 20
-		} else if strings.Contains(upper, "WARN") {
-			lvl = 30
-		} else if strings.Contains(upper, "ERR") {
-			lvl = 40
-		} else {
-			lvl = 20
-		} // Default treat as info
-	}
-
-	return lvl >= minLevel
+	return parseSeverity(level) >= minLevel
 }
 
 func shouldIngestService(service string, allowed map[string]bool, excluded map[string]bool) bool {
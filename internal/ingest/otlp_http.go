@@ -4,7 +4,6 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 
 	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
@@ -13,6 +12,8 @@ import (
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -68,8 +69,8 @@ func (h *HTTPHandler) handleTraces(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.traces.Export(r.Context(), req)
 	if err != nil {
-		slog.Error("HTTP OTLP traces export failed", "error", err)
-		writeOTLPError(w, http.StatusInternalServerError, err.Error())
+		logger.Error("HTTP OTLP traces export failed", "error", err)
+		writeOTLPError(w, exportErrorStatus(err), err.Error())
 		return
 	}
 
@@ -91,8 +92,8 @@ func (h *HTTPHandler) handleLogs(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.logs.Export(r.Context(), req)
 	if err != nil {
-		slog.Error("HTTP OTLP logs export failed", "error", err)
-		writeOTLPError(w, http.StatusInternalServerError, err.Error())
+		logger.Error("HTTP OTLP logs export failed", "error", err)
+		writeOTLPError(w, exportErrorStatus(err), err.Error())
 		return
 	}
 
@@ -114,8 +115,8 @@ func (h *HTTPHandler) handleMetrics(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.metrics.Export(r.Context(), req)
 	if err != nil {
-		slog.Error("HTTP OTLP metrics export failed", "error", err)
-		writeOTLPError(w, http.StatusInternalServerError, err.Error())
+		logger.Error("HTTP OTLP metrics export failed", "error", err)
+		writeOTLPError(w, exportErrorStatus(err), err.Error())
 		return
 	}
 
@@ -188,6 +189,15 @@ func (h *HTTPHandler) writeResponse(w http.ResponseWriter, r *http.Request, msg
 	}
 }
 
+// exportErrorStatus maps an Export error to its HTTP status: 503, which OTLP senders
+// retry, for an Unavailable one and 500 otherwise.
+func exportErrorStatus(err error) int {
+	if status.Code(err) == codes.Unavailable {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 // writeOTLPError writes an OTLP-compliant error response.
 func writeOTLPError(w http.ResponseWriter, statusCode int, msg string) {
 	// OTLP HTTP spec: errors are returned as Status protobuf
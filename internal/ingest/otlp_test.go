@@ -0,0 +1,908 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSummarizeTraces(t *testing.T) {
+	now := time.Now()
+	traces := []storage.Trace{
+		{TraceID: "t1", ServiceName: "backend", Status: "STATUS_CODE_UNSET", Duration: 50_000, Timestamp: now.Add(time.Millisecond)},
+		{TraceID: "t1", ServiceName: "frontend", Status: "STATUS_CODE_ERROR", Duration: 100_000, Timestamp: now},
+		{TraceID: "t2", ServiceName: "worker", Status: "STATUS_CODE_OK", Duration: 10_000, Timestamp: now},
+	}
+	spans := []storage.Span{
+		{TraceID: "t1", SpanID: "b", ParentSpanID: "a", ServiceName: "backend", OperationName: "query", Duration: 50_000, StartTime: now.Add(time.Millisecond)},
+		{TraceID: "t1", SpanID: "a", ParentSpanID: "0000000000000000", ServiceName: "frontend", OperationName: "GET /", Duration: 100_000, StartTime: now},
+		{TraceID: "t2", SpanID: "c", ParentSpanID: "x", ServiceName: "worker", OperationName: "consume", Duration: 10_000, StartTime: now},
+	}
+
+	got := summarizeTraces(traces, spans)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(got))
+	}
+
+	root := got[0]
+	if root.TraceID != "t1" || root.ServiceName != "frontend" || root.Operation != "GET /" || root.DurationMs != 100 {
+		t.Errorf("t1 summary = %+v, want root span frontend GET / 100ms", root)
+	}
+	if root.Status != "STATUS_CODE_ERROR" {
+		t.Errorf("t1 status = %q, want error from any span", root.Status)
+	}
+	if got[1].Operation != "consume" {
+		t.Errorf("t2 operation = %q, want first span fallback", got[1].Operation)
+	}
+}
+
+func TestParseServiceAliases(t *testing.T) {
+	aliases := parseServiceAliases(" payments=payment-service, payment-svc = payment-service ,bogus,=x")
+	if len(aliases) != 2 || aliases["payments"] != "payment-service" || aliases["payment-svc"] != "payment-service" {
+		t.Fatalf("parseServiceAliases() = %v", aliases)
+	}
+
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	if err := os.WriteFile(path, []byte(`{"orders-v2": "orders"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := parseServiceAliases(path); got["orders-v2"] != "orders" {
+		t.Errorf("parseServiceAliases(file) = %v", got)
+	}
+
+	attrs := []*commonpb.KeyValue{{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payments"}}}}
+	if got := getServiceName(attrs, aliases); got != "payment-service" {
+		t.Errorf("getServiceName() = %q, want payment-service", got)
+	}
+	if got := getServiceName(nil, aliases); got != "unknown-service" {
+		t.Errorf("getServiceName(nil) = %q, want unknown-service", got)
+	}
+}
+
+func newTestRepo(t *testing.T) *storage.Repository {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "ingest.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func strAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func TestExportStoresInstrumentationScope(t *testing.T) {
+	repo := newTestRepo(t)
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	now := uint64(time.Now().UnixNano())
+	res := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}}
+
+	traces := NewTraceServer(repo, nil, cfg)
+	_, err := traces.Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: res,
+			ScopeSpans: []*tracepb.ScopeSpans{
+				{
+					Scope: &commonpb.InstrumentationScope{Name: "otelhttp", Version: "0.67.0"},
+					Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{1}, Name: "GET /cart", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000}},
+				},
+				{
+					Scope: &commonpb.InstrumentationScope{Name: "checkout/manual"},
+					Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{2}, ParentSpanId: []byte{1}, Name: "price", StartTimeUnixNano: now, EndTimeUnixNano: now + 500}},
+				},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("trace Export() error = %v", err)
+	}
+
+	logs := NewLogsServer(repo, nil, cfg)
+	_, err = logs.Export(context.Background(), &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: res,
+			ScopeLogs: []*logspb.ScopeLogs{
+				{Scope: &commonpb.InstrumentationScope{Name: "slog", Version: "1"}, LogRecords: []*logspb.LogRecord{{TimeUnixNano: now, SeverityText: "INFO", Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "a"}}}}},
+				{LogRecords: []*logspb.LogRecord{{TimeUnixNano: now, SeverityText: "INFO", Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "b"}}}}},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("logs Export() error = %v", err)
+	}
+
+	spans, total, err := repo.GetSpans(storage.SpanFilter{ScopeName: "otelhttp", Limit: 10})
+	if err != nil || total != 1 {
+		t.Fatalf("GetSpans(scope=otelhttp) = %d, %v; want 1", total, err)
+	}
+	if spans[0].OperationName != "GET /cart" || spans[0].ScopeVersion != "0.67.0" {
+		t.Errorf("otelhttp span = %+v", spans[0])
+	}
+	if _, total, _ := repo.GetSpans(storage.SpanFilter{ScopeName: "checkout/manual", Limit: 10}); total != 1 {
+		t.Errorf("manual scope span count = %d, want 1", total)
+	}
+
+	scoped, total, err := repo.GetLogsV2(storage.LogFilter{ScopeName: "slog", Limit: 10})
+	if err != nil || total != 1 || string(scoped[0].Body) != "a" || scoped[0].ScopeVersion != "1" {
+		t.Errorf("GetLogsV2(scope=slog) = %+v, %d, %v", scoped, total, err)
+	}
+	all, total, _ := repo.GetLogsV2(storage.LogFilter{ServiceName: "checkout", Limit: 10})
+	if total != 2 {
+		t.Fatalf("log count = %d, want 2", total)
+	}
+	for _, l := range all {
+		if string(l.Body) == "b" && l.ScopeName != "" {
+			t.Errorf("log without scope stored scope %q", l.ScopeName)
+		}
+	}
+}
+
+func TestMetricsExportClampsFutureTimestamps(t *testing.T) {
+	m := &telemetry.Metrics{
+		IngestionRate:       prometheus.NewCounter(prometheus.CounterOpts{Name: "ingestion_test"}),
+		MetricPointsClamped: prometheus.NewCounter(prometheus.CounterOpts{Name: "clamped_test"}),
+	}
+	srv := NewMetricsServer(nil, m, nil, &config.Config{MetricMaxFutureSkew: "1h"})
+
+	var got []tsdb.RawMetric
+	srv.SetMetricCallback(func(raw tsdb.RawMetric) { got = append(got, raw) })
+
+	before := time.Now()
+	onTime := before.Add(-time.Minute)
+	slightlyAhead := before.Add(30 * time.Minute) // within the allowed skew
+	point := func(ts time.Time) *metricspb.NumberDataPoint {
+		return &metricspb.NumberDataPoint{TimeUnixNano: uint64(ts.UnixNano()), Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1}}
+	}
+	_, err := srv.Export(context.Background(), &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "bad-clock")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: "queue_depth",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+					point(onTime),
+					point(slightlyAhead),
+					point(before.Add(5 * time.Hour)),
+					point(before.Add(48 * time.Hour)),
+				}}},
+			}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	after := time.Now()
+
+	if len(got) != 4 {
+		t.Fatalf("got %d points, want 4", len(got))
+	}
+	if !got[0].Timestamp.Equal(onTime) || !got[1].Timestamp.Equal(slightlyAhead) {
+		t.Errorf("in-range timestamps changed: %v, %v", got[0].Timestamp, got[1].Timestamp)
+	}
+	for _, raw := range got[2:] {
+		if raw.Timestamp.Before(before) || raw.Timestamp.After(after) {
+			t.Errorf("future point timestamp = %v, want clamped to now", raw.Timestamp)
+		}
+	}
+
+	var counter dto.Metric
+	if err := m.MetricPointsClamped.Write(&counter); err != nil {
+		t.Fatal(err)
+	}
+	if v := counter.GetCounter().GetValue(); v != 2 {
+		t.Errorf("clamped counter = %v, want 2", v)
+	}
+}
+
+func TestMetricsExportReadsExemplars(t *testing.T) {
+	srv := NewMetricsServer(nil, nil, nil, &config.Config{})
+	var got []tsdb.RawMetric
+	srv.SetMetricCallback(func(raw tsdb.RawMetric) { got = append(got, raw) })
+
+	ts := time.Now()
+	_, err := srv.Export(context.Background(), &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: "http.server.duration",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{DataPoints: []*metricspb.NumberDataPoint{{
+					TimeUnixNano: uint64(ts.UnixNano()),
+					Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.9},
+					Exemplars: []*metricspb.Exemplar{
+						{TraceId: []byte{0xab, 0xcd}, SpanId: []byte{0x01}, TimeUnixNano: uint64(ts.UnixNano()), Value: &metricspb.Exemplar_AsDouble{AsDouble: 0.9}},
+						{Value: &metricspb.Exemplar_AsInt{AsInt: 5}}, // no trace context
+					},
+				}}}},
+			}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(got) != 1 || len(got[0].Exemplars) != 1 {
+		t.Fatalf("got %+v, want one point with one exemplar", got)
+	}
+	if ex := got[0].Exemplars[0]; ex.TraceID != "abcd" || ex.SpanID != "01" || ex.Value != 0.9 || !ex.Timestamp.Equal(time.Unix(0, ts.UnixNano())) {
+		t.Errorf("exemplar = %+v", ex)
+	}
+}
+
+// memStore is an in-memory TraceStore standing in for an alternative backend.
+type memStore struct {
+	traces []storage.Trace
+	spans  []storage.Span
+	logs   []storage.Log
+}
+
+func (m *memStore) BatchCreateTraces(traces []storage.Trace) error {
+	m.traces = append(m.traces, traces...)
+	return nil
+}
+
+func (m *memStore) BatchCreateSpans(spans []storage.Span) error {
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+func (m *memStore) BatchCreateLogs(logs []storage.Log) error {
+	m.logs = append(m.logs, logs...)
+	return nil
+}
+
+func TestExportWritesThroughStoreInterfaces(t *testing.T) {
+	store := &memStore{}
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	now := uint64(time.Now().UnixNano())
+	res := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}}
+
+	traces := NewTraceServer(store, nil, cfg)
+	_, err := traces.Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: res,
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+				TraceId: []byte{7}, SpanId: []byte{1}, Name: "GET /cart", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000,
+				Events: []*tracepb.Span_Event{{Name: "exception", TimeUnixNano: now}},
+			}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("trace Export() error = %v", err)
+	}
+	if len(store.traces) != 1 || len(store.spans) != 1 {
+		t.Fatalf("store got traces=%d spans=%d, want 1 each", len(store.traces), len(store.spans))
+	}
+	if store.spans[0].OperationName != "GET /cart" || store.spans[0].ServiceName != "checkout" {
+		t.Errorf("span = %+v", store.spans[0])
+	}
+	if len(store.logs) != 1 {
+		t.Errorf("synthesized logs = %d, want 1 from the span event", len(store.logs))
+	}
+
+	logs := NewLogsServer(store, nil, cfg)
+	_, err = logs.Export(context.Background(), &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: res,
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{{
+				TimeUnixNano: now, SeverityText: "ERROR", Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment declined"}},
+			}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("logs Export() error = %v", err)
+	}
+	if len(store.logs) != 2 || string(store.logs[1].Body) != "payment declined" {
+		t.Errorf("store logs = %+v", store.logs)
+	}
+}
+
+func TestExportKeepsSpanLinks(t *testing.T) {
+	store := &memStore{}
+	now := uint64(time.Now().UnixNano())
+	_, err := NewTraceServer(store, nil, &config.Config{}).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "billing")}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+				TraceId: []byte{0xc0}, SpanId: []byte{0xc1}, Name: "orders process", Kind: tracepb.Span_SPAN_KIND_CONSUMER,
+				StartTimeUnixNano: now, EndTimeUnixNano: now + 1000,
+				Links: []*tracepb.Span_Link{
+					{TraceId: []byte{0xa0}, SpanId: []byte{0xa1}, Attributes: []*commonpb.KeyValue{strAttr("messaging.operation", "process")}},
+					{SpanId: []byte{0xb1}}, // no trace ID: nothing to link to
+				},
+			}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	links := store.spans[0].Links
+	if len(links) != 1 || links[0].LinkedTraceID != "a0" || links[0].LinkedSpanID != "a1" || !strings.Contains(string(links[0].AttributesJSON), "messaging.operation") {
+		t.Errorf("span links = %+v, want the one link to trace a0", links)
+	}
+}
+
+func TestExportPromotesHTTPStatusCode(t *testing.T) {
+	intAttr := func(k string, v int64) *commonpb.KeyValue {
+		return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}}
+	}
+	cases := []struct {
+		attrs []*commonpb.KeyValue
+		want  int // 0: nil
+	}{
+		{[]*commonpb.KeyValue{strAttr("http.request.method", "GET"), intAttr("http.response.status_code", 200)}, 200},
+		{[]*commonpb.KeyValue{intAttr("http.status_code", 503)}, 503},
+		{[]*commonpb.KeyValue{strAttr("http.status_code", " 404")}, 404},
+		{[]*commonpb.KeyValue{strAttr("http.response.status_code", "teapot"), intAttr("http.status_code", 418)}, 418},
+		{[]*commonpb.KeyValue{intAttr("http.response.status_code", 20000)}, 0},
+		{[]*commonpb.KeyValue{strAttr("rpc.system", "grpc")}, 0},
+	}
+	var spans []*tracepb.Span
+	now := uint64(time.Now().UnixNano())
+	for i, c := range cases {
+		spans = append(spans, &tracepb.Span{TraceId: []byte{0xd0, byte(i)}, SpanId: []byte{byte(i + 1)}, Name: "GET /",
+			StartTimeUnixNano: now, EndTimeUnixNano: now + 1000, Attributes: c.attrs})
+	}
+
+	store := &memStore{}
+	_, err := NewTraceServer(store, nil, &config.Config{}).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource:   &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "web")}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(store.spans) != len(cases) {
+		t.Fatalf("stored %d spans, want %d", len(store.spans), len(cases))
+	}
+	for i, c := range cases {
+		got := store.spans[i].HTTPStatusCode
+		switch {
+		case c.want == 0 && got != nil:
+			t.Errorf("case %d: status code = %d, want none", i, *got)
+		case c.want != 0 && (got == nil || *got != c.want):
+			t.Errorf("case %d: status code = %v, want %d", i, got, c.want)
+		}
+		if !strings.Contains(string(store.spans[i].AttributesJSON), c.attrs[0].Key) {
+			t.Errorf("case %d: attribute %s no longer in the span attributes", i, c.attrs[0].Key)
+		}
+	}
+}
+
+// fixedQuota lets each service store up to its remaining budget. Like
+// quota.Manager it is safe for the concurrent calls Export makes.
+type fixedQuota struct {
+	mu   sync.Mutex
+	left map[string]int
+}
+
+func (q *fixedQuota) allow(service string, n int) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	accepted := min(n, q.left[service])
+	q.left[service] -= accepted
+	return accepted
+}
+
+func (q *fixedQuota) AllowSpans(service string, n int) int { return q.allow(service, n) }
+func (q *fixedQuota) AllowLogs(service string, n int) int  { return q.allow(service, n) }
+
+func TestExportRejectsOverQuota(t *testing.T) {
+	repo := newTestRepo(t)
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	now := uint64(time.Now().UnixNano())
+	quota := &fixedQuota{left: map[string]int{"noisy": 1, "quiet": 100}}
+
+	span := func(id byte) *tracepb.Span {
+		return &tracepb.Span{TraceId: []byte{id}, SpanId: []byte{id}, Name: "op", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000,
+			Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}}
+	}
+	traces := NewTraceServer(repo, nil, cfg)
+	traces.SetQuota(quota)
+	resp, err := traces.Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{
+			{Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "noisy")}},
+				ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{span(1), span(2), span(3)}}}},
+			{Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "quiet")}},
+				ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{span(4)}}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("trace Export() error = %v", err)
+	}
+	ps := resp.GetPartialSuccess()
+	if ps.GetRejectedSpans() != 2 || !strings.Contains(ps.GetErrorMessage(), "noisy") || strings.Contains(ps.GetErrorMessage(), "quiet") {
+		t.Errorf("partial success = %+v, want 2 rejected spans from noisy", ps)
+	}
+	var spans, errorLogs int64
+	repo.DB().Model(&storage.Span{}).Count(&spans)
+	repo.DB().Model(&storage.Log{}).Count(&errorLogs)
+	if spans != 2 || errorLogs != 2 {
+		t.Errorf("stored %d spans and %d synthesized logs, want 2 each (rejected spans leave no logs)", spans, errorLogs)
+	}
+
+	logs := NewLogsServer(repo, nil, cfg)
+	logs.SetQuota(quota)
+	record := &logspb.LogRecord{TimeUnixNano: now, SeverityText: "INFO", Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "hello"}}}
+	resp2, err := logs.Export(context.Background(), &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "noisy")}},
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{record, record}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("logs Export() error = %v", err)
+	}
+	if ps := resp2.GetPartialSuccess(); ps.GetRejectedLogRecords() != 2 || !strings.Contains(ps.GetErrorMessage(), "daily log quota") {
+		t.Errorf("logs partial success = %+v, want both records rejected", ps)
+	}
+}
+
+// brokenStore fails every batch holding records of the service "broken", with err
+// or else an error that would recur on retry.
+type brokenStore struct {
+	memStore
+	err error
+}
+
+func (b *brokenStore) failure() error {
+	if b.err != nil {
+		return b.err
+	}
+	return errors.New("value too long for column")
+}
+
+func (b *brokenStore) BatchCreateSpans(spans []storage.Span) error {
+	for _, sp := range spans {
+		if sp.ServiceName == "broken" {
+			return b.failure()
+		}
+	}
+	return b.memStore.BatchCreateSpans(spans)
+}
+
+func (b *brokenStore) BatchCreateLogs(logs []storage.Log) error {
+	for _, l := range logs {
+		if l.ServiceName == "broken" {
+			return b.failure()
+		}
+	}
+	return b.memStore.BatchCreateLogs(logs)
+}
+
+func TestExportReportsPartialSuccess(t *testing.T) {
+	store := &brokenStore{}
+	cfg := &config.Config{IngestMinSeverity: "INFO", IngestExcludedServices: "excluded"}
+	now := uint64(time.Now().UnixNano())
+	res := func(service string) *resourcepb.Resource {
+		return &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", service)}}
+	}
+
+	// Enough resources for the fan-out to run them concurrently: 10 accepted, 5 from
+	// an excluded service and one whose batch cannot be stored.
+	spans := func(id byte, n int) []*tracepb.Span {
+		out := make([]*tracepb.Span, n)
+		for i := range out {
+			out[i] = &tracepb.Span{TraceId: []byte{id}, SpanId: []byte{id, byte(i)}, Name: "op", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000}
+		}
+		return out
+	}
+	var resourceSpans []*tracepb.ResourceSpans
+	for i := range 10 {
+		resourceSpans = append(resourceSpans, &tracepb.ResourceSpans{Resource: res(fmt.Sprintf("ok-%d", i)), ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans(byte(i), 1)}}})
+	}
+	for i := range 5 {
+		resourceSpans = append(resourceSpans, &tracepb.ResourceSpans{Resource: res("excluded"), ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans(byte(20+i), 2)}}})
+	}
+	resourceSpans = append(resourceSpans, &tracepb.ResourceSpans{Resource: res("broken"), ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans(30, 12)}}})
+
+	resp, err := NewTraceServer(store, nil, cfg).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{ResourceSpans: resourceSpans})
+	if err != nil {
+		t.Fatalf("trace Export() error = %v", err)
+	}
+	want := "persistence_failed: 12 spans of service(s) broken could not be stored; also service_excluded (10)"
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedSpans() != 22 || ps.GetErrorMessage() != want {
+		t.Errorf("trace partial success = %+v, want 22 rejected and %q", ps, want)
+	}
+	if len(store.spans) != 10 {
+		t.Errorf("stored %d spans, want the 10 accepted", len(store.spans))
+	}
+
+	record := func(severity string) *logspb.LogRecord {
+		return &logspb.LogRecord{TimeUnixNano: now, SeverityText: severity, Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "line " + severity}}}
+	}
+	var resourceLogs []*logspb.ResourceLogs
+	for i := range 10 {
+		resourceLogs = append(resourceLogs, &logspb.ResourceLogs{Resource: res(fmt.Sprintf("ok-%d", i)),
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{record("INFO"), record("DEBUG")}}}})
+	}
+	for range 5 {
+		resourceLogs = append(resourceLogs, &logspb.ResourceLogs{Resource: res("excluded"), ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{record("ERROR")}}}})
+	}
+	resourceLogs = append(resourceLogs, &logspb.ResourceLogs{Resource: res("broken"),
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{record("WARN"), record("ERROR"), record("FATAL")}}}})
+
+	resp2, err := NewLogsServer(store, nil, cfg).Export(context.Background(), &collogspb.ExportLogsServiceRequest{ResourceLogs: resourceLogs})
+	if err != nil {
+		t.Fatalf("logs Export() error = %v", err)
+	}
+	want = "filtered_by_severity: 10 logs below the minimum severity INFO; also persistence_failed (3), service_excluded (5)"
+	if ps := resp2.GetPartialSuccess(); ps.GetRejectedLogRecords() != 18 || ps.GetErrorMessage() != want {
+		t.Errorf("logs partial success = %+v, want 18 rejected and %q", ps, want)
+	}
+	if len(store.logs) != 10 {
+		t.Errorf("stored %d logs, want the 10 accepted", len(store.logs))
+	}
+
+	gauge := func(name string, points int) *metricspb.Metric {
+		dp := make([]*metricspb.NumberDataPoint, points)
+		for i := range dp {
+			dp[i] = &metricspb.NumberDataPoint{TimeUnixNano: now, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1}}
+		}
+		return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: dp}}}
+	}
+	histogram := &metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+		DataPoints: []*metricspb.HistogramDataPoint{{TimeUnixNano: now}, {TimeUnixNano: now}}}}}
+	var resourceMetrics []*metricspb.ResourceMetrics
+	for i := range 10 {
+		resourceMetrics = append(resourceMetrics, &metricspb.ResourceMetrics{Resource: res(fmt.Sprintf("ok-%d", i)),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{gauge("queue_depth", 1)}}}})
+	}
+	for range 5 {
+		resourceMetrics = append(resourceMetrics, &metricspb.ResourceMetrics{Resource: res("excluded"),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{gauge("queue_depth", 1), histogram}}}})
+	}
+	resourceMetrics[0].ScopeMetrics[0].Metrics = append(resourceMetrics[0].ScopeMetrics[0].Metrics, gauge(DerivedMetricPrefix+"requests", 1))
+
+	resp3, err := NewMetricsServer(nil, nil, nil, cfg).Export(context.Background(), &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: resourceMetrics})
+	if err != nil {
+		t.Fatalf("metrics Export() error = %v", err)
+	}
+	want = "service_excluded: 15 data points from service(s) excluded not accepted by the ingest filters; also reserved_name (1)"
+	if ps := resp3.GetPartialSuccess(); ps.GetRejectedDataPoints() != 16 || ps.GetErrorMessage() != want {
+		t.Errorf("metrics partial success = %+v, want 16 rejected and %q", ps, want)
+	}
+
+	// A failure that leaves nothing stored still fails the export, for the sender to retry.
+	if _, err := NewTraceServer(store, nil, cfg).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: resourceSpans[len(resourceSpans)-1:],
+	}); err == nil {
+		t.Error("Export() of only unstorable spans succeeded, want the store's error")
+	}
+}
+
+func TestExportRetriesTransientStoreFailures(t *testing.T) {
+	store := &brokenStore{err: errors.New("database is locked")}
+	now := uint64(time.Now().UnixNano())
+	resource := func(service string, id byte) *tracepb.ResourceSpans {
+		return &tracepb.ResourceSpans{
+			Resource:   &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", service)}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{TraceId: []byte{id}, SpanId: []byte{id}, Name: "op", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000}}}},
+		}
+	}
+	_, err := NewTraceServer(store, nil, &config.Config{}).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{resource("ok", 1), resource("broken", 2)},
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Export() error = %v, want Unavailable for the sender to retry", err)
+	}
+	if exportErrorStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("HTTP status = %d, want 503", exportErrorStatus(err))
+	}
+
+	for err, want := range map[error]bool{
+		errors.New("value too long for column"):                          false,
+		errors.New("UNIQUE constraint failed: spans.id"):                 false,
+		errors.New("Error 1213: Deadlock found when trying to get lock"): true,
+		fmt.Errorf("insert: %w", context.DeadlineExceeded):               true,
+		&net.OpError{Op: "dial", Err: errors.New("refused")}:             true,
+	} {
+		if got := isTransientStoreError(err); got != want {
+			t.Errorf("isTransientStoreError(%q) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestExportDerivesREDMetrics(t *testing.T) {
+	repo := newTestRepo(t)
+	agg := tsdb.NewAggregator(repo, time.Minute)
+	srv := NewTraceServer(repo, nil, &config.Config{})
+	srv.SetDerivedMetrics(agg)
+
+	now := time.Now()
+	span := func(id, parent byte, name string, ms int, code tracepb.Status_StatusCode) *tracepb.Span {
+		s := &tracepb.Span{TraceId: []byte{id}, SpanId: []byte{id, parent}, Name: name,
+			StartTimeUnixNano: uint64(now.UnixNano()), EndTimeUnixNano: uint64(now.Add(time.Duration(ms) * time.Millisecond).UnixNano()),
+			Status: &tracepb.Status{Code: code}}
+		if parent != 0 {
+			s.ParentSpanId = []byte{parent}
+		} else {
+			s.ParentSpanId = make([]byte, 8) // all-zero parent: still a root
+		}
+		return s
+	}
+	_, err := srv.Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{
+				span(1, 0, "GET /cart", 100, tracepb.Status_STATUS_CODE_OK),
+				span(1, 7, "SELECT cart", 80, tracepb.Status_STATUS_CODE_ERROR), // child: not counted
+				span(2, 0, "GET /cart", 300, tracepb.Status_STATUS_CODE_ERROR),
+			}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	agg.Stop() // persists the open window
+
+	var buckets []storage.MetricBucket
+	if err := repo.DB().Order("name").Find(&buckets).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]storage.MetricBucket)
+	for _, b := range buckets {
+		if b.ServiceName != "checkout" || !strings.Contains(string(b.AttributesJSON), `"operation":"GET /cart"`) {
+			t.Errorf("bucket %s: service %q, attributes %s", b.Name, b.ServiceName, b.AttributesJSON)
+		}
+		got[b.Name] = b
+	}
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets, want requests, errors and duration for one operation", len(buckets))
+	}
+	if b := got[DerivedRequestsMetric]; b.Count != 2 || b.Sum != 2 {
+		t.Errorf("requests = %+v, want 2", b)
+	}
+	if b := got[DerivedErrorsMetric]; b.Sum != 1 {
+		t.Errorf("errors = %+v, want 1", b)
+	}
+	if b := got[DerivedDurationMetric]; b.Min != 100 || b.Max != 300 || b.Count != 2 {
+		t.Errorf("duration = %+v, want 100..300 ms over 2 requests", b)
+	}
+
+	// The derived names are reserved for these metrics.
+	metrics := NewMetricsServer(nil, nil, nil, &config.Config{})
+	var received []string
+	metrics.SetMetricCallback(func(raw tsdb.RawMetric) { received = append(received, raw.Name) })
+	gauge := func(name string) *metricspb.Metric {
+		return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{TimeUnixNano: uint64(now.UnixNano())}}}}}
+	}
+	if _, err := metrics.Export(context.Background(), &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{gauge(DerivedRequestsMetric), gauge("http.requests")}}},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0] != "http.requests" {
+		t.Errorf("metrics received = %v, want only http.requests", received)
+	}
+}
+
+func TestExportDerivesNoMetricsForFailedExport(t *testing.T) {
+	repo := newTestRepo(t)
+	agg := tsdb.NewAggregator(repo, time.Minute)
+	srv := NewTraceServer(&brokenStore{err: errors.New("database is locked")}, nil, &config.Config{})
+	srv.SetDerivedMetrics(agg)
+
+	now := uint64(time.Now().UnixNano())
+	_, err := srv.Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource:   &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "broken")}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{1}, Name: "GET /cart", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000}}}},
+		}},
+	})
+	if err == nil {
+		t.Fatal("Export() succeeded, want the store error")
+	}
+	agg.Stop()
+
+	var buckets int64
+	repo.DB().Model(&storage.MetricBucket{}).Count(&buckets)
+	if buckets != 0 {
+		t.Errorf("stored %d derived buckets for an export the sender will retry, want none", buckets)
+	}
+}
+
+func TestExportStoresUnderSenderTenant(t *testing.T) {
+	store := &memStore{}
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	now := uint64(time.Now().UnixNano())
+	ctx := tenant.NewContext(context.Background(), tenant.Identity{Tenant: "team-a"})
+
+	traces := NewTraceServer(store, nil, cfg)
+	_, err := traces.Export(ctx, &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+				TraceId: []byte{7}, SpanId: []byte{1}, Name: "GET /cart", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000,
+			}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("trace Export() error = %v", err)
+	}
+	if _, err := NewLogsServer(store, nil, cfg).Export(context.Background(), logRequest("checkout", time.Now(), "no token")); err != nil {
+		t.Fatalf("logs Export() error = %v", err)
+	}
+
+	if len(store.traces) != 1 || store.traces[0].TenantID != "team-a" || store.spans[0].TenantID != "team-a" {
+		t.Errorf("trace tenant = %q, span tenant = %q; want team-a", store.traces[0].TenantID, store.spans[0].TenantID)
+	}
+	if len(store.logs) != 1 || store.logs[0].TenantID != tenant.Default {
+		t.Errorf("log sent without a token stored under %q, want %q", store.logs[0].TenantID, tenant.Default)
+	}
+}
+
+func TestExportRecordsEnvironment(t *testing.T) {
+	store := &memStore{}
+	cfg := &config.Config{IngestMinSeverity: "DEBUG", IngestDefaultEnv: "unlabelled"}
+	now := uint64(time.Now().UnixNano())
+	resourceSpans := func(traceID byte, attrs ...*commonpb.KeyValue) *tracepb.ResourceSpans {
+		return &tracepb.ResourceSpans{
+			Resource: &resourcepb.Resource{Attributes: append(attrs, strAttr("service.name", "checkout"))},
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+				TraceId: []byte{traceID}, SpanId: []byte{1}, Name: "GET /cart", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000,
+				Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR},
+			}}}},
+		}
+	}
+	_, err := NewTraceServer(store, nil, cfg).Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{
+			resourceSpans(1, strAttr("deployment.environment", "staging")),
+			// The current attribute wins over the deprecated one, in either order.
+			resourceSpans(2, strAttr("deployment.environment.name", "prod"), strAttr("deployment.environment", "production")),
+			resourceSpans(3),
+		},
+	})
+	if err != nil {
+		t.Fatalf("trace Export() error = %v", err)
+	}
+	want := map[string]string{"01": "staging", "02": "prod", "03": "unlabelled"}
+	for _, tr := range store.traces {
+		if tr.Environment != want[tr.TraceID] {
+			t.Errorf("trace %s environment = %q, want %q", tr.TraceID, tr.Environment, want[tr.TraceID])
+		}
+	}
+	for _, sp := range store.spans {
+		if sp.Environment != want[sp.TraceID] {
+			t.Errorf("span of trace %s environment = %q, want %q", sp.TraceID, sp.Environment, want[sp.TraceID])
+		}
+	}
+	for _, l := range store.logs {
+		if l.Environment != want[l.TraceID] {
+			t.Errorf("status log of trace %s environment = %q, want %q", l.TraceID, l.Environment, want[l.TraceID])
+		}
+	}
+
+	store.logs = nil
+	req := logRequest("checkout", time.Now(), "no environment")
+	req.ResourceLogs[0].Resource.Attributes = append(req.ResourceLogs[0].Resource.Attributes, strAttr("deployment.environment", "prod"))
+	req.ResourceLogs = append(req.ResourceLogs, logRequest("checkout", time.Now(), "no environment").ResourceLogs...)
+	if _, err := NewLogsServer(store, nil, &config.Config{IngestMinSeverity: "DEBUG"}).Export(context.Background(), req); err != nil {
+		t.Fatalf("logs Export() error = %v", err)
+	}
+	if len(store.logs) != 2 || store.logs[0].Environment != "prod" || store.logs[1].Environment != "" {
+		t.Errorf("logs = %+v, want one in prod and one without an environment", store.logs)
+	}
+}
+
+func TestExportTruncatesLongBodies(t *testing.T) {
+	store := &memStore{}
+	cfg := &config.Config{IngestMinSeverity: "DEBUG", LogMaxBodyBytes: 10}
+	long := strings.Repeat("ü", 8) // 16 bytes; the limit falls inside the 6th rune
+	req := logRequest("checkout", time.Now(), long, "short")
+	if _, err := NewLogsServer(store, nil, cfg).Export(context.Background(), req); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if n := len(req.ResourceLogs[0].ScopeLogs[0].LogRecords[0].Attributes); n != 0 {
+		t.Errorf("request attributes modified: %d added", n)
+	}
+
+	if len(store.logs) != 2 {
+		t.Fatalf("stored %d logs, want 2", len(store.logs))
+	}
+	cut := store.logs[0]
+	if want := strings.Repeat("ü", 5) + "...[truncated 6 bytes]"; string(cut.Body) != want || !cut.Truncated {
+		t.Errorf("body = %q (truncated %v), want %q", cut.Body, cut.Truncated, want)
+	}
+	if !strings.Contains(string(cut.AttributesJSON), OriginalBodySizeAttr) || !strings.Contains(string(cut.AttributesJSON), "16") {
+		t.Errorf("attributes = %s, want %s of 16", cut.AttributesJSON, OriginalBodySizeAttr)
+	}
+	if kept := store.logs[1]; string(kept.Body) != "short" || kept.Truncated {
+		t.Errorf("short body = %q (truncated %v), want it untouched", kept.Body, kept.Truncated)
+	}
+}
+
+func TestExportDedupesStatusLogs(t *testing.T) {
+	repo := newTestRepo(t)
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	now := time.Now()
+	// The app logged the failure of span 01 itself; span 02 only has an earlier status log.
+	if err := repo.BatchCreateLogs([]storage.Log{
+		{TraceID: "0a", SpanID: "01", TenantID: tenant.Default, Severity: storage.SeverityError, Body: "payment declined", Timestamp: now},
+		{TraceID: "0a", SpanID: "02", TenantID: tenant.Default, Severity: storage.SeverityError, Body: "Span 'charge' failed", Timestamp: now, Synthetic: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := func(spanID byte, events ...*tracepb.Span_Event) *tracepb.Span {
+		ts := uint64(now.UnixNano())
+		return &tracepb.Span{TraceId: []byte{0x0a}, SpanId: []byte{spanID}, Name: "charge", StartTimeUnixNano: ts, EndTimeUnixNano: ts + 1000,
+			Events: events, Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}}
+	}
+	req := &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "payments")}},
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{
+			failed(1), failed(2), failed(3, &tracepb.Span_Event{Name: "exception", TimeUnixNano: uint64(now.UnixNano())}),
+		}}},
+	}}}
+	synthesized := func(dedupe bool) map[string]string {
+		t.Helper()
+		store := &memStore{}
+		traces := NewTraceServer(store, nil, cfg)
+		if dedupe {
+			traces.SetStatusLogDedupe(repo)
+		}
+		if _, err := traces.Export(context.Background(), req); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		sources := map[string]string{}
+		for _, l := range store.logs {
+			if !l.Synthetic {
+				t.Errorf("log of span %s not marked synthetic", l.SpanID)
+			}
+			for _, source := range []string{SourceSpanStatus, SourceSpanEvent} {
+				if strings.Contains(string(l.AttributesJSON), source) {
+					sources[l.SpanID] = source
+				}
+			}
+		}
+		return sources
+	}
+
+	// Without dedupe only the exception event stands in for its span's status.
+	got := synthesized(false)
+	want := map[string]string{"01": SourceSpanStatus, "02": SourceSpanStatus, "03": SourceSpanEvent}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("without dedupe: sources = %v, want %v", got, want)
+	}
+	// With dedupe the app's own log does too; a synthesized one does not count.
+	got = synthesized(true)
+	want = map[string]string{"02": SourceSpanStatus, "03": SourceSpanEvent}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with dedupe: sources = %v, want %v", got, want)
+	}
+}
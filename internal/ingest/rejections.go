@@ -0,0 +1,198 @@
+package ingest
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reasons an export's records are rejected for, reported to the sender in the OTLP
+// partial success.
+const (
+	rejectServiceExcluded    = "service_excluded"     // INGEST_ALLOWED_SERVICES / INGEST_EXCLUDED_SERVICES
+	rejectFilteredBySeverity = "filtered_by_severity" // below INGEST_MIN_SEVERITY
+	rejectOverQuota          = "over_quota"           // the service's daily quota is used up
+	rejectPersistenceFailed  = "persistence_failed"   // the service's batch could not be stored
+	rejectReservedName       = "reserved_name"        // metric named with DerivedMetricPrefix
+	rejectTraceSpanLimit     = "trace_span_limit"     // the trace already has TRACE_MAX_SPANS spans
+)
+
+// rejectReasons lists the reasons in the order a message names them; it also breaks
+// ties for the dominant one.
+var rejectReasons = []string{rejectPersistenceFailed, rejectOverQuota, rejectServiceExcluded, rejectFilteredBySeverity, rejectReservedName, rejectTraceSpanLimit}
+
+type rejection struct {
+	reason  string
+	service string
+	n       int
+}
+
+// rejections tallies the records an export rejected. Like the other per-resource
+// results, each goroutine of the fan-out fills its own and they are merged after
+// the wait, so no lock is needed.
+type rejections []rejection
+
+func (r *rejections) add(reason, service string, n int) {
+	if n > 0 {
+		*r = append(*r, rejection{reason: reason, service: service, n: n})
+	}
+}
+
+// total is the number of rejected records, for the partial success count.
+func (r rejections) total() int64 {
+	var n int64
+	for _, rj := range r {
+		n += int64(rj.n)
+	}
+	return n
+}
+
+// count returns how many records were rejected for reason, and from which services.
+func (r rejections) count(reason string) (int64, []string) {
+	var n int64
+	var services []string
+	for _, rj := range r {
+		if rj.reason == reason {
+			n += int64(rj.n)
+			services = append(services, rj.service)
+		}
+	}
+	slices.Sort(services)
+	return n, slices.Compact(services)
+}
+
+// message explains the rejections to the sender: the reason that rejected the most
+// records, with the services concerned, then the counts of any others. signal names
+// one record ("span", "log", "data point").
+func (r rejections) message(signal string, filters *filterSet) string {
+	dominant, most := "", int64(0)
+	for _, reason := range rejectReasons {
+		if n, _ := r.count(reason); n > most {
+			dominant, most = reason, n
+		}
+	}
+	if dominant == "" {
+		return ""
+	}
+
+	n, services := r.count(dominant)
+	records := plural(n, signal)
+	var detail string
+	switch dominant {
+	case rejectServiceExcluded:
+		detail = fmt.Sprintf("%s from service(s) %s not accepted by the ingest filters", records, strings.Join(services, ", "))
+	case rejectFilteredBySeverity:
+		detail = fmt.Sprintf("%s below the minimum severity %s", records, filters.cfg.MinSeverity)
+	case rejectOverQuota:
+		detail = quotaMessage(signal, services)
+	case rejectPersistenceFailed:
+		detail = fmt.Sprintf("%s of service(s) %s could not be stored", records, strings.Join(services, ", "))
+	case rejectReservedName:
+		detail = fmt.Sprintf("%s of metrics named with the reserved prefix %s", records, DerivedMetricPrefix)
+	case rejectTraceSpanLimit:
+		detail = fmt.Sprintf("%s of trace(s) over the per-trace span limit, counted on the trace but not stored", records)
+	}
+	msg := dominant + ": " + detail
+	var others []string
+	for _, reason := range rejectReasons {
+		if n, _ := r.count(reason); n > 0 && reason != dominant {
+			others = append(others, fmt.Sprintf("%s (%d)", reason, n))
+		}
+	}
+	if len(others) > 0 {
+		msg += "; also " + strings.Join(others, ", ")
+	}
+	return msg
+}
+
+func plural(n int64, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// storeByService stores items in one batch and, if that fails, once per service, so
+// records a single service's batch cannot store do not fail the rest of the export.
+// It returns the stored items and rejections for the others. An error is returned,
+// for the sender to retry, when nothing could be stored or when a service's batch
+// failed transiently: only records that would fail again are rejected.
+func storeByService[T any](items []T, service func(T) string, store func([]T) error) ([]T, rejections, error) {
+	err := store(items)
+	if err == nil {
+		return items, nil, nil
+	}
+	groups := make(map[string][]T)
+	var order []string
+	for _, it := range items {
+		svc := service(it)
+		if _, ok := groups[svc]; !ok {
+			order = append(order, svc)
+		}
+		groups[svc] = append(groups[svc], it)
+	}
+	if len(order) < 2 {
+		return nil, nil, storeError(err)
+	}
+
+	var stored []T
+	var failed rejections
+	for _, svc := range order {
+		if gerr := store(groups[svc]); gerr != nil {
+			logger.Error("❌ Failed to store a service's records", "service", svc, "records", len(groups[svc]), "error", gerr)
+			if isTransientStoreError(gerr) {
+				return nil, nil, storeError(gerr)
+			}
+			failed.add(rejectPersistenceFailed, svc, len(groups[svc]))
+			continue
+		}
+		stored = append(stored, groups[svc]...)
+	}
+	if len(stored) == 0 {
+		return nil, nil, storeError(err)
+	}
+	return stored, failed, nil
+}
+
+// storeError returns err as an Unavailable status when it is transient, which OTLP
+// senders retry, and unchanged otherwise.
+func storeError(err error) error {
+	if isTransientStoreError(err) {
+		return status.Errorf(codes.Unavailable, "store: %v", err)
+	}
+	return err
+}
+
+// isTransientStoreError reports whether a failed write may succeed if retried: a
+// timeout, a lost connection, a lock or deadlock, or a full connection pool.
+func isTransientStoreError(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{
+		"database is locked", "database table is locked", "sqlite_busy", // SQLite
+		"deadlock", "lock wait timeout", "too many connections", // MySQL, SQL Server
+		"could not serialize access", "connection refused", "connection reset", "broken pipe",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// dataPoints counts the points of a metric of any type.
+func dataPoints(m *metricspb.Metric) int {
+	return len(m.GetGauge().GetDataPoints()) + len(m.GetSum().GetDataPoints()) + len(m.GetHistogram().GetDataPoints()) +
+		len(m.GetExponentialHistogram().GetDataPoints()) + len(m.GetSummary().GetDataPoints())
+}
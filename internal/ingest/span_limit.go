@@ -0,0 +1,122 @@
+package ingest
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// DefaultSpanLimitTraces bounds the number of traces a SpanLimiter tracks.
+const DefaultSpanLimitTraces = 50000
+
+// SpanCountStore backs a SpanLimiter: the stored span counts of traces it does not
+// track, and the spans it turned away.
+type SpanCountStore interface {
+	TraceSpanCounts(traceIDs []string) (map[string]int, error)
+	AddDroppedSpans(dropped map[string]int) error
+}
+
+// spanCount is the number of spans received for a trace, stored or not.
+type spanCount struct {
+	traceID string
+	n       int
+}
+
+// SpanLimiter caps the spans stored per trace, so one runaway trace (a retry loop
+// instrumenting every attempt) cannot bloat storage or the trace view. Span counts
+// are kept for recent traces in an LRU; a trace it does not track starts from the
+// count stored in the database, so eviction or a restart does not reset the cap.
+type SpanLimiter struct {
+	store     SpanCountStore
+	maxSpans  int
+	maxTraces int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *spanCount
+	lru     *list.List               // most recently seen first
+}
+
+// NewSpanLimiter creates a limiter storing at most maxSpans spans per trace and
+// tracking up to maxTraces traces (<= 0: DefaultSpanLimitTraces).
+func NewSpanLimiter(store SpanCountStore, maxSpans, maxTraces int) *SpanLimiter {
+	if maxTraces <= 0 {
+		maxTraces = DefaultSpanLimitTraces
+	}
+	return &SpanLimiter{
+		store:     store,
+		maxSpans:  maxSpans,
+		maxTraces: maxTraces,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// Allow reports, index for index, which spans of a batch may be stored: the first
+// maxSpans of each trace. Every span counts against its trace, allowed or not.
+func (l *SpanLimiter) Allow(spans []storage.Span) []bool {
+	// The traces not tracked are looked up in one query, outside the lock.
+	l.mu.Lock()
+	var untracked []string
+	seen := make(map[string]bool)
+	for i := range spans {
+		id := spans[i].TraceID
+		if _, ok := l.entries[id]; !ok && !seen[id] {
+			seen[id] = true
+			untracked = append(untracked, id)
+		}
+	}
+	l.mu.Unlock()
+
+	var stored map[string]int
+	if len(untracked) > 0 {
+		var err error
+		if stored, err = l.store.TraceSpanCounts(untracked); err != nil {
+			logger.Warn("Failed to look up stored span counts; counting from zero", "traces", len(untracked), "error", err)
+		}
+	}
+
+	allow := make([]bool, len(spans))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range spans {
+		c := l.track(spans[i].TraceID, stored)
+		c.n++
+		allow[i] = c.n <= l.maxSpans
+	}
+	return allow
+}
+
+// RecordDropped adds the spans each trace had turned away to its spans_dropped count.
+func (l *SpanLimiter) RecordDropped(dropped map[string]int) {
+	if len(dropped) == 0 {
+		return
+	}
+	if err := l.store.AddDroppedSpans(dropped); err != nil {
+		logger.Error("Failed to save dropped span counts", "traces", len(dropped), "error", err)
+	}
+}
+
+// Len returns the number of tracked traces.
+func (l *SpanLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
+
+// track returns the count of traceID, starting an untracked one from its stored count
+// and evicting the least recently seen trace when full; l.mu must be held.
+func (l *SpanLimiter) track(traceID string, stored map[string]int) *spanCount {
+	if el, ok := l.entries[traceID]; ok {
+		l.lru.MoveToFront(el)
+		return el.Value.(*spanCount)
+	}
+	c := &spanCount{traceID: traceID, n: stored[traceID]}
+	l.entries[traceID] = l.lru.PushFront(c)
+	if l.lru.Len() > l.maxTraces {
+		oldest := l.lru.Back()
+		delete(l.entries, oldest.Value.(*spanCount).traceID)
+		l.lru.Remove(oldest)
+	}
+	return c
+}
@@ -0,0 +1,159 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// retryLoop builds an export of n failing retry spans of one trace, numbered from first.
+func retryLoop(traceID byte, first, n int) *coltracepb.ExportTraceServiceRequest {
+	now := uint64(time.Now().UnixNano())
+	spans := make([]*tracepb.Span, n)
+	for i := range spans {
+		id := first + i
+		spans[i] = &tracepb.Span{
+			TraceId: []byte{traceID}, SpanId: []byte{byte(id >> 8), byte(id)}, ParentSpanId: []byte{0xff},
+			Name: "retry", StartTimeUnixNano: now, EndTimeUnixNano: now + 1000,
+			Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR},
+		}
+	}
+	return &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		Resource:   &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "payments")}},
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans}},
+	}}}
+}
+
+func TestExportCapsSpansPerTrace(t *testing.T) {
+	repo := newTestRepo(t)
+	traces := NewTraceServer(repo, nil, &config.Config{IngestMinSeverity: "DEBUG"})
+	traces.SetSpanLimiter(NewSpanLimiter(repo, 50, 0))
+
+	// An oversized trace across several exports, next to a small one.
+	for batch := range 3 {
+		req := retryLoop(1, batch*40, 40)
+		if batch == 0 {
+			req.ResourceSpans = append(req.ResourceSpans, retryLoop(2, 0, 5).ResourceSpans...)
+		}
+		resp, err := traces.Export(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Export() #%d error = %v", batch, err)
+		}
+		want := []int64{0, 30, 40}[batch]
+		if ps := resp.GetPartialSuccess(); ps.GetRejectedSpans() != want || want > 0 && !strings.HasPrefix(ps.GetErrorMessage(), "trace_span_limit:") {
+			t.Errorf("Export() #%d partial success = %+v, want %d rejected over the span limit", batch, ps, want)
+		}
+	}
+
+	count := func(model any, traceID string) int64 {
+		var n int64
+		repo.DB().Model(model).Where("trace_id = ?", traceID).Count(&n)
+		return n
+	}
+	if spans, logs := count(&storage.Span{}, "01"), count(&storage.Log{}, "01"); spans != 50 || logs != 50 {
+		t.Errorf("stored %d spans and %d synthesized logs of the oversized trace, want 50 each", spans, logs)
+	}
+	if n := count(&storage.Span{}, "02"); n != 5 {
+		t.Errorf("stored %d spans of the small trace, want 5", n)
+	}
+
+	trace, err := repo.GetTrace("01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !trace.Truncated || trace.SpansDropped != 70 || trace.SpansReceived != 50 {
+		t.Errorf("trace = truncated %v, %d dropped, %d received; want truncated, 70 and 50", trace.Truncated, trace.SpansDropped, trace.SpansReceived)
+	}
+	if small, err := repo.GetTrace("02"); err != nil || small.Truncated || small.SpansDropped != 0 {
+		t.Errorf("small trace = %+v, %v; want it untouched", small, err)
+	}
+
+	// A new limiter, as after a restart, starts from the stored count.
+	traces.SetSpanLimiter(NewSpanLimiter(repo, 50, 0))
+	resp, err := traces.Export(context.Background(), retryLoop(1, 200, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetPartialSuccess().GetRejectedSpans() != 10 || count(&storage.Span{}, "01") != 50 {
+		t.Errorf("after a restart: partial success %+v with %d spans stored; want all 10 rejected", resp.GetPartialSuccess(), count(&storage.Span{}, "01"))
+	}
+	if trace, _ := repo.GetTrace("01"); trace.SpansDropped != 80 {
+		t.Errorf("spans_dropped = %d, want 80", trace.SpansDropped)
+	}
+}
+
+// countStore serves stored span counts and records the lookups.
+type countStore struct {
+	stored  map[string]int
+	lookups [][]string
+	dropped map[string]int
+}
+
+func (s *countStore) TraceSpanCounts(ids []string) (map[string]int, error) {
+	s.lookups = append(s.lookups, slices.Clone(ids))
+	out := make(map[string]int)
+	for _, id := range ids {
+		if n, ok := s.stored[id]; ok {
+			out[id] = n
+		}
+	}
+	return out, nil
+}
+
+func (s *countStore) AddDroppedSpans(dropped map[string]int) error {
+	for id, n := range dropped {
+		s.dropped[id] += n
+	}
+	return nil
+}
+
+func TestSpanLimiterTracksRecentTraces(t *testing.T) {
+	store := &countStore{stored: map[string]int{"old": 3}, dropped: map[string]int{}}
+	l := NewSpanLimiter(store, 4, 2)
+	spans := func(ids ...string) []storage.Span {
+		out := make([]storage.Span, len(ids))
+		for i, id := range ids {
+			out[i] = storage.Span{TraceID: id, SpanID: fmt.Sprint(i)}
+		}
+		return out
+	}
+
+	// "old" already has 3 spans stored: one more fits.
+	if got := l.Allow(spans("old", "old", "new")); !slices.Equal(got, []bool{true, false, true}) {
+		t.Errorf("Allow() = %v, want the second span of old over the limit", got)
+	}
+	if len(store.lookups) != 1 || !slices.Equal(store.lookups[0], []string{"old", "new"}) {
+		t.Errorf("lookups = %v, want one for old and new", store.lookups)
+	}
+
+	// Tracked traces are not looked up again.
+	l.Allow(spans("new"))
+	if len(store.lookups) != 1 {
+		t.Errorf("lookups = %v, want none for a tracked trace", store.lookups)
+	}
+
+	// A third trace evicts the least recently seen one, which is looked up again.
+	l.Allow(spans("third"))
+	if l.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", l.Len())
+	}
+	l.Allow(spans("old"))
+	if last := store.lookups[len(store.lookups)-1]; !slices.Equal(last, []string{"old"}) {
+		t.Errorf("last lookup = %v, want the evicted trace", last)
+	}
+
+	l.RecordDropped(map[string]int{"old": 1})
+	if store.dropped["old"] != 1 {
+		t.Errorf("dropped = %v", store.dropped)
+	}
+}
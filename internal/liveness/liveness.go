@@ -0,0 +1,320 @@
+// Package liveness tracks when each service last exported spans, logs and metrics,
+// how far behind its payload timestamps arrive, and flags services that have gone
+// quiet. State is kept in memory on the ingest path and persisted periodically.
+package liveness
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// Signals a service exports.
+const (
+	SignalSpans   = "spans"
+	SignalLogs    = "logs"
+	SignalMetrics = "metrics"
+)
+
+// lagWeight is the weight of a new export in the moving average of the lag.
+const lagWeight = 0.2
+
+// skewWindow is how long the smallest lag counts towards the clock skew estimate.
+const skewWindow = 10 * time.Minute
+
+// Service is the liveness of one service as reported by the API.
+type Service struct {
+	storage.ServiceLiveness
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	SilentSeconds float64   `json:"silent_seconds"`
+	Stale         bool      `json:"stale"`
+}
+
+// Transition is a service going stale or recovering, passed to the callback.
+type Transition struct {
+	TenantID    string    `json:"tenant_id"`
+	ServiceName string    `json:"service_name"`
+	Stale       bool      `json:"stale"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	SilentFor   string    `json:"silent_for,omitempty"` // how long the service was quiet when it went stale
+}
+
+type key struct{ tenant, service string }
+
+// state is the tracked liveness of one service.
+type state struct {
+	row       storage.ServiceLiveness
+	lastSeen  time.Time
+	resumedAt time.Time // first export after going stale; zero while not stale
+	lagSeen   bool
+	// The clock skew estimate is the smallest lag over the current and previous
+	// skew window.
+	skewStart         time.Time
+	skewMin, skewPrev *float64
+}
+
+// Tracker records exports and flags services silent for longer than staleAfter. A
+// stale service is only considered back once it has exported without a gap longer
+// than staleAfter for recoverAfter, so services exporting at about the threshold
+// do not flap between stale and live.
+type Tracker struct {
+	store        storage.LivenessStore
+	interval     time.Duration
+	staleAfter   time.Duration
+	recoverAfter time.Duration
+	now          func() time.Time
+	onTransition func(Transition)
+
+	mu       sync.Mutex
+	started  time.Time // no service is stale until staleAfter past this
+	services map[key]*state
+	dirty    map[key]bool
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates a tracker that persists every interval. staleAfter 0 disables stale
+// detection.
+func New(store storage.LivenessStore, interval, staleAfter, recoverAfter time.Duration) *Tracker {
+	return &Tracker{
+		store:        store,
+		interval:     interval,
+		staleAfter:   staleAfter,
+		recoverAfter: recoverAfter,
+		now:          time.Now,
+		started:      time.Now(),
+		services:     make(map[key]*state),
+		dirty:        make(map[key]bool),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// SetTransitionCallback sets the function called when a service goes stale or
+// recovers.
+func (t *Tracker) SetTransitionCallback(cb func(Transition)) {
+	t.onTransition = cb
+}
+
+// StaleAfter returns the silence after which a service is flagged stale.
+func (t *Tracker) StaleAfter() time.Duration {
+	return t.staleAfter
+}
+
+// Load restores the saved liveness of every service.
+func (t *Tracker) Load() error {
+	rows, err := t.store.ListServiceLiveness()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.started = t.now()
+	for _, row := range rows {
+		st := &state{row: row, lagSeen: true}
+		for _, at := range []*time.Time{row.LastSpanAt, row.LastLogAt, row.LastMetricAt} {
+			if at != nil && at.After(st.lastSeen) {
+				st.lastSeen = *at
+			}
+		}
+		t.services[key{row.TenantID, row.ServiceName}] = st
+	}
+	return nil
+}
+
+// Observe records an export of signal by service. newest is the latest payload
+// timestamp in it; the zero time records the export without a lag.
+func (t *Tracker) Observe(tenant, service, signal string, newest time.Time) {
+	now := t.now().UTC()
+	k := key{tenant, service}
+
+	t.mu.Lock()
+	st := t.services[k]
+	if st == nil {
+		st = &state{row: storage.ServiceLiveness{TenantID: tenant, ServiceName: service}}
+		t.services[k] = st
+	}
+	at := now
+	switch signal {
+	case SignalSpans:
+		st.row.LastSpanAt = &at
+	case SignalLogs:
+		st.row.LastLogAt = &at
+	case SignalMetrics:
+		st.row.LastMetricAt = &at
+	}
+	if !newest.IsZero() {
+		st.observeLag(now, float64(now.Sub(newest))/float64(time.Millisecond))
+	}
+
+	var tr *Transition
+	if st.row.StaleSince != nil {
+		// Recovery restarts after any gap longer than staleAfter.
+		if st.resumedAt.IsZero() || now.Sub(st.lastSeen) > t.staleAfter {
+			st.resumedAt = now
+		}
+		if now.Sub(st.resumedAt) >= t.recoverAfter {
+			st.row.StaleSince, st.resumedAt = nil, time.Time{}
+			tr = &Transition{TenantID: tenant, ServiceName: service, LastSeenAt: now}
+		}
+	}
+	st.lastSeen = now
+	t.dirty[k] = true
+	t.mu.Unlock()
+
+	if tr != nil {
+		slog.Info("Service exporting again", "tenant", tenant, "service", service)
+		t.notify(*tr)
+	}
+}
+
+// observeLag folds one lag into the moving average and the skew window.
+func (st *state) observeLag(now time.Time, lagMs float64) {
+	if st.lagSeen {
+		st.row.LagMs += lagWeight * (lagMs - st.row.LagMs)
+	} else {
+		st.row.LagMs, st.lagSeen = lagMs, true
+	}
+
+	if age := now.Sub(st.skewStart); age >= 2*skewWindow {
+		st.skewPrev, st.skewMin, st.skewStart = nil, nil, now
+	} else if age >= skewWindow {
+		st.skewPrev, st.skewMin, st.skewStart = st.skewMin, nil, now
+	}
+	if st.skewMin == nil || lagMs < *st.skewMin {
+		st.skewMin = &lagMs
+	}
+	skew := *st.skewMin
+	if st.skewPrev != nil && *st.skewPrev < skew {
+		skew = *st.skewPrev
+	}
+	st.row.ClockSkewMs = skew
+}
+
+// Check flags the services silent for longer than staleAfter, calling the
+// transition callback for each.
+func (t *Tracker) Check() {
+	if t.staleAfter <= 0 {
+		return
+	}
+	now := t.now().UTC()
+	var stale []Transition
+
+	t.mu.Lock()
+	for k, st := range t.services {
+		if st.row.StaleSince != nil {
+			continue
+		}
+		// Silence before the tracker started does not count: exports may have been
+		// sent to it while it was down.
+		since := st.lastSeen
+		if t.started.After(since) {
+			since = t.started
+		}
+		if now.Sub(since) <= t.staleAfter {
+			continue
+		}
+		at := now
+		st.row.StaleSince = &at
+		t.dirty[k] = true
+		stale = append(stale, Transition{
+			TenantID:    k.tenant,
+			ServiceName: k.service,
+			Stale:       true,
+			LastSeenAt:  st.lastSeen,
+			SilentFor:   now.Sub(st.lastSeen).Round(time.Second).String(),
+		})
+	}
+	t.mu.Unlock()
+
+	for _, tr := range stale {
+		slog.Warn("Service stopped exporting", "tenant", tr.TenantID, "service", tr.ServiceName, "silent_for", tr.SilentFor)
+		t.notify(tr)
+	}
+}
+
+func (t *Tracker) notify(tr Transition) {
+	if t.onTransition != nil {
+		t.onTransition(tr)
+	}
+}
+
+// Services returns the liveness of the services of tenant ("" = all tenants),
+// ordered by tenant and service.
+func (t *Tracker) Services(tenant string) []Service {
+	now := t.now().UTC()
+	t.mu.Lock()
+	out := make([]Service, 0, len(t.services))
+	for k, st := range t.services {
+		if tenant != "" && k.tenant != tenant {
+			continue
+		}
+		out = append(out, Service{
+			ServiceLiveness: st.row,
+			LastSeenAt:      st.lastSeen,
+			SilentSeconds:   now.Sub(st.lastSeen).Round(time.Second).Seconds(),
+			Stale:           st.row.StaleSince != nil,
+		})
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TenantID != out[j].TenantID {
+			return out[i].TenantID < out[j].TenantID
+		}
+		return out[i].ServiceName < out[j].ServiceName
+	})
+	return out
+}
+
+// Flush persists the services that changed since the last flush.
+func (t *Tracker) Flush() error {
+	t.mu.Lock()
+	rows := make([]storage.ServiceLiveness, 0, len(t.dirty))
+	for k := range t.dirty {
+		rows = append(rows, t.services[k].row)
+	}
+	dirty := t.dirty
+	t.dirty = make(map[key]bool)
+	t.mu.Unlock()
+
+	if err := t.store.SaveServiceLiveness(rows); err != nil {
+		// Mark the rows dirty again so the next flush retries them.
+		t.mu.Lock()
+		for k := range dirty {
+			t.dirty[k] = true
+		}
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Start checks for stale services and persists changes every interval. Blocks until
+// ctx is cancelled or Stop is called; call Flush afterwards to save the final state.
+func (t *Tracker) Start(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			t.Check()
+			if err := t.Flush(); err != nil {
+				slog.Error("Failed to persist service liveness", "error", err)
+			}
+		}
+	}
+}
+
+// Stop signals the loop to exit.
+func (t *Tracker) Stop() {
+	t.stopOnce.Do(func() { close(t.stopCh) })
+}
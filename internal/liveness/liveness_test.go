@@ -0,0 +1,161 @@
+package liveness
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func newTestRepo(t *testing.T) *storage.Repository {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "liveness.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// newTestTracker returns a tracker on a fake clock, stale after 5m and recovered
+// after 1m.
+func newTestTracker(t *testing.T, repo *storage.Repository, clock *time.Time) (*Tracker, *[]Transition) {
+	t.Helper()
+	tr := New(repo, time.Minute, 5*time.Minute, time.Minute)
+	tr.now = func() time.Time { return *clock }
+	if err := tr.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var events []Transition
+	tr.SetTransitionCallback(func(ev Transition) { events = append(events, ev) })
+	return tr, &events
+}
+
+func TestServiceGoesQuietAndReturns(t *testing.T) {
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr, events := newTestTracker(t, newTestRepo(t), &clock)
+
+	tr.Observe("default", "checkout", SignalSpans, clock.Add(-2*time.Second))
+	tr.Observe("default", "checkout", SignalLogs, clock.Add(-time.Second))
+	tr.Observe("default", "cart", SignalMetrics, clock)
+
+	// checkout goes quiet; cart keeps exporting.
+	for i := 0; i < 6; i++ {
+		clock = clock.Add(time.Minute)
+		tr.Observe("default", "cart", SignalMetrics, clock)
+		tr.Check()
+	}
+	if len(*events) != 1 || !(*events)[0].Stale || (*events)[0].ServiceName != "checkout" || (*events)[0].SilentFor != "6m0s" {
+		t.Fatalf("events = %+v, want checkout stale after 6m", *events)
+	}
+	svcs := tr.Services("")
+	if len(svcs) != 2 || svcs[1].ServiceName != "checkout" || !svcs[1].Stale || svcs[1].SilentSeconds != 360 || svcs[0].Stale {
+		t.Fatalf("services = %+v, want checkout stale, cart live", svcs)
+	}
+	// Still quiet: no repeated event.
+	clock = clock.Add(10 * time.Minute)
+	tr.Observe("default", "cart", SignalMetrics, clock)
+	tr.Check()
+	if len(*events) != 1 {
+		t.Errorf("events = %+v, want no repeat while stale", *events)
+	}
+
+	// It returns, and is cleared once it has exported for a minute.
+	tr.Observe("default", "checkout", SignalSpans, clock)
+	if len(*events) != 1 || !tr.Services("")[1].Stale {
+		t.Errorf("cleared on the first export after silence, want recoverAfter first")
+	}
+	clock = clock.Add(30 * time.Second)
+	tr.Observe("default", "checkout", SignalSpans, clock)
+	clock = clock.Add(30 * time.Second)
+	tr.Observe("default", "checkout", SignalSpans, clock)
+	if len(*events) != 2 || (*events)[1].Stale || tr.Services("")[1].Stale {
+		t.Errorf("events = %+v, want checkout recovered", *events)
+	}
+}
+
+func TestFlappingServiceStaysStale(t *testing.T) {
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr, events := newTestTracker(t, newTestRepo(t), &clock)
+
+	// Exports every 6 minutes, just over the 5 minute threshold: flagged once, and
+	// never recovers since every export follows a gap.
+	for i := 0; i < 10; i++ {
+		tr.Observe("default", "batch", SignalSpans, clock)
+		for j := 0; j < 6; j++ {
+			clock = clock.Add(time.Minute)
+			tr.Check()
+		}
+	}
+	if len(*events) != 1 || !(*events)[0].Stale {
+		t.Errorf("events = %+v, want a single stale event", *events)
+	}
+}
+
+func TestLagAndClockSkew(t *testing.T) {
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr, _ := newTestTracker(t, newTestRepo(t), &clock)
+
+	// Payloads arrive 3s to 5s after their timestamps.
+	for _, lag := range []time.Duration{5 * time.Second, 3 * time.Second, 4 * time.Second} {
+		clock = clock.Add(time.Second)
+		tr.Observe("default", "api", SignalSpans, clock.Add(-lag))
+	}
+	s := tr.Services("")[0]
+	if s.ClockSkewMs != 3000 || s.LagMs < 3000 || s.LagMs > 5000 {
+		t.Errorf("lag %vms, skew %vms; want lag between 3s and 5s, skew 3000ms", s.LagMs, s.ClockSkewMs)
+	}
+
+	// An exporter whose clock runs 2 minutes ahead sends future timestamps.
+	tr.Observe("default", "ahead", SignalLogs, clock.Add(2*time.Minute))
+	if s := tr.Services("")[0]; s.ServiceName != "ahead" || s.ClockSkewMs != -120000 {
+		t.Errorf("ahead = %+v, want skew -120000ms", s)
+	}
+
+	// The minimum ages out after two skew windows.
+	clock = clock.Add(2 * skewWindow)
+	tr.Observe("default", "api", SignalSpans, clock.Add(-10*time.Second))
+	if s := tr.Services("")[1]; s.ClockSkewMs != 10000 {
+		t.Errorf("skew after windows = %vms, want 10000", s.ClockSkewMs)
+	}
+	// A record without a timestamp marks the service seen without a lag.
+	tr.Observe("default", "nots", SignalLogs, time.Time{})
+	if s := tr.Services("")[2]; s.ServiceName != "nots" || s.LastLogAt == nil || s.LagMs != 0 {
+		t.Errorf("nots = %+v, want seen without lag", s)
+	}
+}
+
+func TestLivenessPersistsAndScopes(t *testing.T) {
+	repo := newTestRepo(t)
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr, _ := newTestTracker(t, repo, &clock)
+	tr.Observe("acme", "api", SignalSpans, clock.Add(-time.Second))
+	tr.Observe("globex", "api", SignalMetrics, clock)
+	clock = clock.Add(6 * time.Minute)
+	tr.Check()
+	if err := tr.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if got := tr.Services("acme"); len(got) != 1 || got[0].TenantID != "acme" {
+		t.Errorf("acme services = %+v, want only acme's", got)
+	}
+
+	// After a restart the services are remembered, still stale, and the restart's
+	// downtime does not make live services stale at once.
+	clock = clock.Add(time.Hour)
+	tr2, events := newTestTracker(t, repo, &clock)
+	got := tr2.Services("")
+	if len(got) != 2 || !got[0].Stale || got[0].LastSpanAt == nil || got[0].LagMs != 1000 {
+		t.Fatalf("restored = %+v", got)
+	}
+	tr2.Observe("acme", "web", SignalSpans, clock)
+	clock = clock.Add(time.Minute)
+	tr2.Check()
+	if len(*events) != 0 {
+		t.Errorf("events right after restart = %+v, want none", *events)
+	}
+}
@@ -0,0 +1,365 @@
+// Package loadgen generates deterministic OTLP traffic for regression tests and
+// benchmarks. Every trace is derived from the profile seed and its own index, so the
+// same profile always produces the same trace IDs, services, attributes, errors and
+// logs regardless of pacing or concurrency. Requests are built directly from the OTLP
+// protobuf types the ingest layer consumes, without the OpenTelemetry SDK.
+package loadgen
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// scopeName is the instrumentation scope stamped on generated spans and logs.
+const scopeName = "github.com/RandomCodeSpace/otelcontext/internal/loadgen"
+
+// Profile describes the traffic to generate.
+type Profile struct {
+	Seed            uint64
+	TracesPerSec    float64
+	Duration        time.Duration
+	SpansPerTrace   int
+	ErrorRatio      float64 // share of traces with a failed span, 0-1
+	LogsPerTrace    int
+	AttrCardinality int // distinct values of the high-cardinality user.id attribute
+	Services        int
+	BatchSize       int  // traces per export request
+	Concurrency     int  // export requests in flight
+	Burst           bool // send every batch immediately instead of pacing to TracesPerSec
+}
+
+// Profiles are the named presets accepted by cmd/argus-loadgen.
+var Profiles = map[string]Profile{
+	"smoke": {
+		Seed: 1, TracesPerSec: 20, Duration: 5 * time.Second, SpansPerTrace: 4, ErrorRatio: 0.05,
+		LogsPerTrace: 1, AttrCardinality: 10, Services: 3, BatchSize: 10, Concurrency: 1,
+	},
+	"steady": {
+		Seed: 1, TracesPerSec: 200, Duration: time.Minute, SpansPerTrace: 8, ErrorRatio: 0.02,
+		LogsPerTrace: 3, AttrCardinality: 1000, Services: 8, BatchSize: 50, Concurrency: 4,
+	},
+	"backpressure": {
+		Seed: 1, TracesPerSec: 2000, Duration: 30 * time.Second, SpansPerTrace: 12, ErrorRatio: 0.1,
+		LogsPerTrace: 5, AttrCardinality: 10000, Services: 12, BatchSize: 200, Concurrency: 16, Burst: true,
+	},
+}
+
+// withDefaults fills unset fields so a partially specified profile still runs.
+func (p Profile) withDefaults() Profile {
+	if p.TracesPerSec <= 0 {
+		p.TracesPerSec = 10
+	}
+	if p.SpansPerTrace < 1 {
+		p.SpansPerTrace = 1
+	}
+	if p.AttrCardinality < 1 {
+		p.AttrCardinality = 1
+	}
+	if p.Services < 1 {
+		p.Services = 1
+	}
+	if p.BatchSize < 1 {
+		p.BatchSize = 50
+	}
+	if p.Concurrency < 1 {
+		p.Concurrency = 1
+	}
+	p.ErrorRatio = math.Min(math.Max(p.ErrorRatio, 0), 1)
+	return p
+}
+
+// TotalTraces is the number of traces the profile generates.
+func (p Profile) TotalTraces() int {
+	p = p.withDefaults()
+	return int(math.Round(p.TracesPerSec * p.Duration.Seconds()))
+}
+
+// Report summarises what was sent.
+type Report struct {
+	Requests       int64         `json:"requests"`
+	FailedRequests int64         `json:"failed_requests"`
+	Traces         int64         `json:"traces"`
+	Spans          int64         `json:"spans"`
+	ErrorSpans     int64         `json:"error_spans"` // each also yields a synthesized ERROR log on ingest
+	Logs           int64         `json:"logs"`
+	Services       []string      `json:"services"`
+	Elapsed        time.Duration `json:"elapsed"`
+}
+
+// Print writes a human-readable summary of the report.
+func (r *Report) Print(w io.Writer) {
+	secs := r.Elapsed.Seconds()
+	fmt.Fprintf(w, "requests:        %d (%d failed)\n", r.Requests, r.FailedRequests)
+	fmt.Fprintf(w, "traces:          %d (%.1f/s)\n", r.Traces, float64(r.Traces)/math.Max(secs, 1e-9))
+	fmt.Fprintf(w, "spans:           %d (%d with error status)\n", r.Spans, r.ErrorSpans)
+	fmt.Fprintf(w, "logs:            %d (+%d synthesized from error spans)\n", r.Logs, r.ErrorSpans)
+	fmt.Fprintf(w, "services:        %d\n", len(r.Services))
+	fmt.Fprintf(w, "elapsed:         %s\n", r.Elapsed.Round(time.Millisecond))
+}
+
+// Generator sends a profile's traffic to an OTLP gRPC endpoint.
+type Generator struct {
+	profile Profile
+	traces  coltracepb.TraceServiceClient
+	logs    collogspb.LogsServiceClient
+	base    time.Time
+}
+
+// New creates a generator that exports over conn.
+func New(conn grpc.ClientConnInterface, p Profile) *Generator {
+	return &Generator{
+		profile: p.withDefaults(),
+		traces:  coltracepb.NewTraceServiceClient(conn),
+		logs:    collogspb.NewLogsServiceClient(conn),
+	}
+}
+
+// Run generates the whole profile and returns what was sent. It stops early when ctx
+// is cancelled. A failed export is counted in the report but does not abort the run,
+// so backpressure shows up as FailedRequests rather than an error.
+func (g *Generator) Run(ctx context.Context) (*Report, error) {
+	p := g.profile
+	total := p.TotalTraces()
+	g.base = time.Now()
+
+	var (
+		report   Report
+		requests atomic.Int64
+		failed   atomic.Int64
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		services = make(map[string]bool)
+	)
+
+	batches := make(chan int)
+	for range p.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for first := range batches {
+				last := min(first+p.BatchSize, total)
+				batch := g.buildBatch(first, last)
+
+				ok := true
+				requests.Add(1)
+				if _, err := g.traces.Export(ctx, batch.traces); err != nil {
+					failed.Add(1)
+					ok = false
+				}
+				if batch.logCount > 0 {
+					requests.Add(1)
+					if _, err := g.logs.Export(ctx, batch.logs); err != nil {
+						failed.Add(1)
+						ok = false
+					}
+				}
+				if !ok {
+					continue
+				}
+
+				mu.Lock()
+				report.Traces += int64(last - first)
+				report.Spans += batch.spanCount
+				report.ErrorSpans += batch.errorSpans
+				report.Logs += batch.logCount
+				for svc := range batch.services {
+					services[svc] = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	interval := time.Duration(float64(time.Second) * float64(p.BatchSize) / p.TracesPerSec)
+	start := time.Now()
+produce:
+	for i, first := 0, 0; first < total; i, first = i+1, first+p.BatchSize {
+		if !p.Burst {
+			if wait := time.Until(start.Add(time.Duration(i) * interval)); wait > 0 {
+				select {
+				case <-ctx.Done():
+					break produce
+				case <-time.After(wait):
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			break produce
+		case batches <- first:
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	report.Requests = requests.Load()
+	report.FailedRequests = failed.Load()
+	report.Elapsed = time.Since(start)
+	for svc := range services {
+		report.Services = append(report.Services, svc)
+	}
+	sort.Strings(report.Services)
+	return &report, ctx.Err()
+}
+
+// batch is one pair of export requests covering a contiguous range of traces.
+type batch struct {
+	traces     *coltracepb.ExportTraceServiceRequest
+	logs       *collogspb.ExportLogsServiceRequest
+	spanCount  int64
+	errorSpans int64
+	logCount   int64
+	services   map[string]bool
+}
+
+// buildBatch generates traces [first, last), grouping spans and logs by service into
+// one ResourceSpans / ResourceLogs per service.
+func (g *Generator) buildBatch(first, last int) *batch {
+	b := &batch{services: make(map[string]bool)}
+	spansBySvc := make(map[string][]*tracepb.Span)
+	logsBySvc := make(map[string][]*logspb.LogRecord)
+
+	for i := first; i < last; i++ {
+		for _, s := range g.buildTrace(i) {
+			spansBySvc[s.service] = append(spansBySvc[s.service], s.span)
+			logsBySvc[s.service] = append(logsBySvc[s.service], s.logs...)
+			b.spanCount++
+			b.logCount += int64(len(s.logs))
+			if s.span.Status.GetCode() == tracepb.Status_STATUS_CODE_ERROR {
+				b.errorSpans++
+			}
+		}
+	}
+
+	b.traces = &coltracepb.ExportTraceServiceRequest{}
+	b.logs = &collogspb.ExportLogsServiceRequest{}
+	for _, svc := range sortedKeys(spansBySvc) {
+		b.services[svc] = true
+		res := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", svc)}}
+		scope := &commonpb.InstrumentationScope{Name: scopeName}
+		b.traces.ResourceSpans = append(b.traces.ResourceSpans, &tracepb.ResourceSpans{
+			Resource:   res,
+			ScopeSpans: []*tracepb.ScopeSpans{{Scope: scope, Spans: spansBySvc[svc]}},
+		})
+		if len(logsBySvc[svc]) > 0 {
+			b.logs.ResourceLogs = append(b.logs.ResourceLogs, &logspb.ResourceLogs{
+				Resource:  res,
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: scope, LogRecords: logsBySvc[svc]}},
+			})
+		}
+	}
+	return b
+}
+
+// genSpan is a generated span with the service that emits it and its logs.
+type genSpan struct {
+	service string
+	span    *tracepb.Span
+	logs    []*logspb.LogRecord
+}
+
+// operations are the span names drawn for generated spans.
+var operations = []string{"GET /orders", "POST /checkout", "charge", "reserve_stock", "SELECT users", "publish", "render"}
+
+// buildTrace generates trace i. The root span belongs to the first service; every
+// other span is a child of an earlier span and belongs to a service chosen from the
+// seeded stream. A failing trace marks its last span as an error.
+func (g *Generator) buildTrace(i int) []genSpan {
+	p := g.profile
+	rng := rand.New(rand.NewPCG(p.Seed, uint64(i)))
+
+	traceID := make([]byte, 16)
+	binary.BigEndian.PutUint64(traceID[:8], p.Seed)
+	binary.BigEndian.PutUint64(traceID[8:], uint64(i)+1)
+
+	start := g.base.Add(time.Duration(float64(i) / p.TracesPerSec * float64(time.Second)))
+	failing := rng.Float64() < p.ErrorRatio
+	userID := fmt.Sprintf("user-%d", rng.IntN(p.AttrCardinality))
+
+	spans := make([]genSpan, p.SpansPerTrace)
+	for n := range spans {
+		spanID := make([]byte, 8)
+		binary.BigEndian.PutUint64(spanID, rng.Uint64()|1)
+
+		service := serviceName(0)
+		var parent []byte
+		offset := time.Duration(0)
+		if n > 0 {
+			service = serviceName(rng.IntN(p.Services))
+			parentIdx := rng.IntN(n)
+			parent = spans[parentIdx].span.SpanId
+			offset = time.Duration(n) * time.Millisecond
+		}
+		duration := time.Duration(1+rng.IntN(200)) * time.Millisecond
+		spanStart := start.Add(offset)
+
+		span := &tracepb.Span{
+			TraceId:           traceID,
+			SpanId:            spanID,
+			ParentSpanId:      parent,
+			Name:              operations[rng.IntN(len(operations))],
+			Kind:              tracepb.Span_SPAN_KIND_SERVER,
+			StartTimeUnixNano: uint64(spanStart.UnixNano()),
+			EndTimeUnixNano:   uint64(spanStart.Add(duration).UnixNano()),
+			Attributes:        []*commonpb.KeyValue{strAttr("user.id", userID), strAttr("loadgen.trace_index", fmt.Sprint(i))},
+			Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK},
+		}
+		if failing && n == len(spans)-1 {
+			span.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "loadgen: injected failure"}
+		}
+		spans[n] = genSpan{service: service, span: span}
+	}
+
+	for n := range p.LogsPerTrace {
+		owner := &spans[rng.IntN(len(spans))]
+		severity, sevNum := "INFO", logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+		if failing && n == 0 {
+			severity, sevNum = "WARN", logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+		}
+		owner.logs = append(owner.logs, &logspb.LogRecord{
+			// Offset by n so two logs drawn for the same span are not identical records,
+			// which storage would collapse as a retried export.
+			TimeUnixNano:   owner.span.StartTimeUnixNano + uint64(n),
+			SeverityText:   severity,
+			SeverityNumber: sevNum,
+			Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprintf("%s handled for %s", owner.span.Name, userID)}},
+			Attributes:     []*commonpb.KeyValue{strAttr("user.id", userID)},
+			TraceId:        traceID,
+			SpanId:         owner.span.SpanId,
+		})
+	}
+	return spans
+}
+
+func serviceName(n int) string {
+	return fmt.Sprintf("loadgen-svc-%02d", n)
+}
+
+func strAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package loadgen
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// startServer runs the ingest gRPC services on a loopback port backed by a fresh
+// SQLite database.
+func startServer(t *testing.T) (*storage.Repository, *grpc.ClientConn) {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "loadgen.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, ingest.NewTraceServer(repo, nil, cfg))
+	collogspb.RegisterLogsServiceServer(srv, ingest.NewLogsServer(repo, nil, cfg))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return repo, conn
+}
+
+func count(t *testing.T, repo *storage.Repository, model any, where ...any) int64 {
+	t.Helper()
+	var n int64
+	q := repo.DB().Model(model)
+	if len(where) > 0 {
+		q = q.Where(where[0], where[1:]...)
+	}
+	if err := q.Count(&n).Error; err != nil {
+		t.Fatalf("count error = %v", err)
+	}
+	return n
+}
+
+func TestRunRowCountsMatchReport(t *testing.T) {
+	repo, conn := startServer(t)
+	p := Profile{
+		Seed: 7, TracesPerSec: 100, Duration: time.Second, SpansPerTrace: 5, ErrorRatio: 0.2,
+		LogsPerTrace: 2, AttrCardinality: 5, Services: 4, BatchSize: 10, Concurrency: 3, Burst: true,
+	}
+
+	report, err := New(conn, p).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.FailedRequests != 0 || report.Traces != 100 || report.Spans != 500 || report.Logs != 200 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.ErrorSpans == 0 || report.ErrorSpans == report.Traces {
+		t.Errorf("error spans = %d, want roughly 20%% of %d traces", report.ErrorSpans, report.Traces)
+	}
+
+	if got := count(t, repo, &storage.Trace{}); got != report.Traces {
+		t.Errorf("trace rows = %d, want %d", got, report.Traces)
+	}
+	if got := count(t, repo, &storage.Span{}); got != report.Spans {
+		t.Errorf("span rows = %d, want %d", got, report.Spans)
+	}
+	if got := count(t, repo, &storage.Log{}); got != report.Logs+report.ErrorSpans {
+		t.Errorf("log rows = %d, want %d sent + %d synthesized", got, report.Logs, report.ErrorSpans)
+	}
+	if got := count(t, repo, &storage.Log{}, "severity = ?", "ERROR"); got != report.ErrorSpans {
+		t.Errorf("ERROR log rows = %d, want %d", got, report.ErrorSpans)
+	}
+}
+
+func TestBuildTraceIsDeterministic(t *testing.T) {
+	p := Profile{Seed: 42, TracesPerSec: 10, SpansPerTrace: 6, ErrorRatio: 0.5, LogsPerTrace: 3, AttrCardinality: 100, Services: 5}.withDefaults()
+	base := time.Now()
+	a := &Generator{profile: p, base: base}
+	b := &Generator{profile: p, base: base}
+
+	for i := range 20 {
+		x, y := a.buildTrace(i), b.buildTrace(i)
+		for n := range x {
+			if x[n].service != y[n].service || !proto.Equal(x[n].span, y[n].span) || len(x[n].logs) != len(y[n].logs) {
+				t.Fatalf("trace %d span %d differs between runs", i, n)
+			}
+		}
+	}
+
+	other := &Generator{profile: Profile{Seed: 43, SpansPerTrace: 6}.withDefaults(), base: base}
+	if proto.Equal(a.buildTrace(0)[0].span, other.buildTrace(0)[0].span) {
+		t.Error("different seeds produced the same trace")
+	}
+}
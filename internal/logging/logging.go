@@ -0,0 +1,154 @@
+// Package logging sets up the process logger and lets its level be changed at
+// runtime, globally or per component. Components log through Component loggers,
+// which follow the global level unless given an override.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	level slog.LevelVar
+	base  atomic.Pointer[slog.Handler] // nil until Init: the slog default handler is used
+
+	mu         sync.Mutex
+	components = map[string]*component{}
+)
+
+// component is a named logger's level override.
+type component struct {
+	override atomic.Pointer[slog.Level] // nil = follow the global level
+}
+
+func (c *component) Level() slog.Level {
+	if l := c.override.Load(); l != nil {
+		return *l
+	}
+	return level.Level()
+}
+
+// Init installs a text logger writing to w at the given level as the slog default.
+func Init(w io.Writer, l slog.Level) {
+	level.Set(l)
+	// The handler itself lets everything through; loggers check the level first.
+	var h slog.Handler = slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug - 4})
+	base.Store(&h)
+	slog.SetDefault(slog.New(&levelHandler{level: &level}))
+}
+
+// ParseLevel parses DEBUG, INFO, WARN (or WARNING) or ERROR, case-insensitively.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return slog.LevelDebug, nil
+	case "INFO":
+		return slog.LevelInfo, nil
+	case "WARN", "WARNING":
+		return slog.LevelWarn, nil
+	case "ERROR":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want DEBUG, INFO, WARN or ERROR)", s)
+}
+
+// Level returns the global log level.
+func Level() slog.Level { return level.Level() }
+
+// SetLevel changes the global log level.
+func SetLevel(l slog.Level) { level.Set(l) }
+
+// Component returns the logger of a named component, registering the name. Its
+// level is the global one unless overridden with SetComponentLevel.
+func Component(name string) *slog.Logger {
+	mu.Lock()
+	c, ok := components[name]
+	if !ok {
+		c = &component{}
+		components[name] = c
+	}
+	mu.Unlock()
+	return slog.New(&levelHandler{level: c})
+}
+
+// Components returns the registered component names, sorted.
+func Components() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetComponentLevel overrides the level of a registered component; nil removes the
+// override. It returns false for an unknown component.
+func SetComponentLevel(name string, l *slog.Level) bool {
+	mu.Lock()
+	c, ok := components[name]
+	mu.Unlock()
+	if ok {
+		c.override.Store(l)
+	}
+	return ok
+}
+
+// ComponentOverrides returns the components with a level override.
+func ComponentOverrides() map[string]slog.Level {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]slog.Level)
+	for name, c := range components {
+		if l := c.override.Load(); l != nil {
+			out[name] = *l
+		}
+	}
+	return out
+}
+
+// levelHandler filters records by a level that can change at runtime and writes
+// the rest to the handler installed by Init, or to the slog default before Init.
+// Attributes and groups added with With/WithGroup are applied to that handler on
+// each record.
+type levelHandler struct {
+	level slog.Leveler
+	wrap  []func(slog.Handler) slog.Handler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	var out slog.Handler
+	if p := base.Load(); p != nil {
+		out = *p
+	} else {
+		out = slog.Default().Handler()
+	}
+	for _, w := range h.wrap {
+		out = w(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *levelHandler) with(w func(slog.Handler) slog.Handler) slog.Handler {
+	wrap := append(h.wrap[:len(h.wrap):len(h.wrap)], w)
+	return &levelHandler{level: h.level, wrap: wrap}
+}
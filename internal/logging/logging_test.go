@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	Init(&buf, slog.LevelInfo)
+	t.Cleanup(func() { slog.SetDefault(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))) })
+
+	ingest := Component("test-ingest").With("batch", 1)
+	other := Component("test-other")
+
+	logged := func(f func()) bool {
+		buf.Reset()
+		f()
+		return buf.Len() > 0
+	}
+
+	if logged(func() { ingest.Debug("hidden") }) || !logged(func() { slog.Info("shown") }) {
+		t.Fatal("INFO level: want debug dropped and info written")
+	}
+
+	debug := slog.LevelDebug
+	if !SetComponentLevel("test-ingest", &debug) {
+		t.Fatal("SetComponentLevel() = false for a registered component")
+	}
+	if !logged(func() { ingest.Debug("now shown") }) || !strings.Contains(buf.String(), "batch=1") {
+		t.Errorf("override: ingest debug not written with its attributes: %q", buf.String())
+	}
+	if logged(func() { other.Debug("hidden") }) || logged(func() { slog.Debug("hidden") }) {
+		t.Error("override leaked to other loggers")
+	}
+	if got := ComponentOverrides(); len(got) != 1 || got["test-ingest"] != slog.LevelDebug {
+		t.Errorf("ComponentOverrides() = %v", got)
+	}
+
+	// The global level moves components without an override.
+	SetLevel(slog.LevelError)
+	if logged(func() { other.Warn("hidden") }) || !logged(func() { ingest.Warn("shown") }) {
+		t.Error("ERROR level: want other's warning dropped and the overridden component's kept")
+	}
+
+	SetComponentLevel("test-ingest", nil)
+	if logged(func() { ingest.Warn("hidden") }) {
+		t.Error("cleared override: component still below the global level")
+	}
+	if SetComponentLevel("unknown", &debug) {
+		t.Error("SetComponentLevel() = true for an unknown component")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"debug": slog.LevelDebug, " INFO": slog.LevelInfo, "warning": slog.LevelWarn, "Error": slog.LevelError} {
+		if got, err := ParseLevel(in); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+}
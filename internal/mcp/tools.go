@@ -547,9 +547,12 @@ func (s *Server) toolGetStorageStatus() ToolCallResult {
 		"hot_db_size_mb":    float64(s.repo.HotDBSizeBytes()) / 1024 / 1024,
 		"dlq_size_files":    health.DLQSize,
 		"active_conns":      health.ActiveConns,
+		"connections":       health.Connections,
 		"goroutines":        health.Goroutines,
 		"heap_alloc_mb":     health.HeapAllocMB,
+		"heap_inuse_mb":     health.HeapInuseMB,
 		"uptime_seconds":    health.UptimeSeconds,
+		"version":           health.Version,
 		"ingestion_total":   health.IngestionRate,
 		"db_latency_p99_ms": health.DBLatencyP99Ms,
 	}
@@ -0,0 +1,216 @@
+// Package outbox delivers the notifications stored in the outbox table. Anomaly and
+// SLO breach events are written in the same transaction as the change they announce;
+// the dispatcher polls for undelivered ones, broadcasts them to live clients and POSTs
+// them to a webhook, retrying failed deliveries with exponential backoff. A restart
+// between the write and the delivery delays a notification but does not lose it.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+const (
+	batchSize      = 100                // events delivered per query
+	minBackoff     = 5 * time.Second    // wait after the first failed attempt; doubles with each further one
+	maxBackoff     = time.Hour          // longest wait between attempts
+	retention      = 7 * 24 * time.Hour // delivered and dead events are kept this long
+	pruneEvery     = time.Hour
+	webhookTimeout = 10 * time.Second
+)
+
+// WebhookEvent is the body POSTed to the webhook for an outbox event. Receivers can
+// deduplicate on ID, since a delivery whose response is lost is retried.
+type WebhookEvent struct {
+	ID          uint            `json:"id"`
+	Type        string          `json:"type"`
+	TenantID    string          `json:"tenant_id,omitempty"`
+	ServiceName string          `json:"service_name"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// Dispatcher periodically delivers the pending outbox events.
+type Dispatcher struct {
+	store       storage.OutboxStore
+	interval    time.Duration
+	maxAttempts int
+	broadcast   func(storage.OutboxEvent)
+
+	webhookURL   string
+	webhookTypes map[string]bool // event types POSTed; empty = all
+	client       *http.Client
+
+	mu        sync.Mutex
+	lastPrune time.Time
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates a dispatcher that polls every interval and gives an event up after
+// maxAttempts failed deliveries.
+func New(store storage.OutboxStore, interval time.Duration, maxAttempts int) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		client:      &http.Client{Timeout: webhookTimeout},
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// SetBroadcaster sets the function that sends an event to the live clients. It is
+// called on an event's first attempt only, so a webhook retry does not repeat it.
+func (d *Dispatcher) SetBroadcaster(fn func(storage.OutboxEvent)) {
+	d.broadcast = fn
+}
+
+// SetWebhook POSTs the events of the given types (all when none) to url as a
+// WebhookEvent. Any response but 2xx is a failed delivery.
+func (d *Dispatcher) SetWebhook(url string, types []string) {
+	d.webhookURL = url
+	d.webhookTypes = make(map[string]bool, len(types))
+	for _, t := range types {
+		d.webhookTypes[t] = true
+	}
+}
+
+// Start runs the delivery loop, beginning with the events left by a previous run.
+// Blocks until ctx is cancelled or Stop is called.
+func (d *Dispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.RunOnce(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.Error("Outbox: delivery run failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop terminates the delivery loop.
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+	})
+}
+
+// RunOnce attempts every event due at now and returns how many were delivered.
+// Events are handled oldest first, one at a time.
+func (d *Dispatcher) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivered := 0
+	var lastID uint
+	for ctx.Err() == nil {
+		events, err := d.store.PendingOutboxEvents(ctx, now, batchSize)
+		if err != nil {
+			return delivered, err
+		}
+		progressed := false
+		for i := range events {
+			ev := &events[i]
+			if ev.ID <= lastID {
+				continue // already attempted in this run
+			}
+			lastID = ev.ID
+			progressed = true
+			ok, err := d.attempt(ctx, ev, now)
+			if err != nil {
+				return delivered, err
+			}
+			if ok {
+				delivered++
+			}
+		}
+		if !progressed || len(events) < batchSize {
+			break
+		}
+	}
+
+	if now.Sub(d.lastPrune) >= pruneEvery {
+		d.lastPrune = now
+		if _, err := d.store.PruneOutboxEvents(now.Add(-retention)); err != nil {
+			slog.Error("Outbox: failed to prune events", "error", err)
+		}
+	}
+	return delivered, ctx.Err()
+}
+
+// attempt delivers ev once and records the outcome: delivered, retried after a
+// backoff, or dead after the last attempt.
+func (d *Dispatcher) attempt(ctx context.Context, ev *storage.OutboxEvent, now time.Time) (bool, error) {
+	attempts := ev.Attempts + 1
+	if ev.Attempts == 0 && d.broadcast != nil {
+		d.broadcast(*ev)
+	}
+	err := d.post(ctx, ev)
+	if err == nil {
+		return true, d.store.MarkOutboxDelivered(ctx, ev.ID, attempts, now)
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	var retryAt time.Time
+	if attempts < d.maxAttempts {
+		retryAt = now.Add(Backoff(attempts))
+		slog.Warn("Outbox: delivery failed, will retry", "id", ev.ID, "type", ev.Type, "attempt", attempts, "retry_at", retryAt, "error", err)
+	} else {
+		slog.Error("Outbox: delivery failed, giving up", "id", ev.ID, "type", ev.Type, "attempts", attempts, "error", err)
+	}
+	return false, d.store.RecordOutboxFailure(ctx, ev.ID, attempts, err.Error(), now, retryAt)
+}
+
+// post sends ev to the webhook, if it takes events of its type.
+func (d *Dispatcher) post(ctx context.Context, ev *storage.OutboxEvent) error {
+	if d.webhookURL == "" || len(d.webhookTypes) > 0 && !d.webhookTypes[ev.Type] {
+		return nil
+	}
+	body, err := json.Marshal(WebhookEvent{ID: ev.ID, Type: ev.Type, TenantID: ev.TenantID, ServiceName: ev.ServiceName,
+		CreatedAt: ev.CreatedAt, Payload: json.RawMessage(ev.PayloadJSON)})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Backoff is the wait after the given number of failed attempts: 5s after the first,
+// doubling up to an hour.
+func Backoff(attempts int) time.Duration {
+	wait := minBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
@@ -0,0 +1,173 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func openRepo(t *testing.T, dsn string) *storage.Repository {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", dsn)
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	return repo
+}
+
+func TestEventsSurviveARestartBeforeDelivery(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "outbox.db")
+
+	// The anomaly is stored, then the process stops before the dispatcher runs.
+	repo := openRepo(t, dsn)
+	if err := repo.CreateAnomalyEvent(&storage.AnomalyEvent{ServiceName: "checkout", Signal: "error_rate", Value: 0.4, DetectedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var posted []WebhookEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		posted = append(posted, ev)
+	}))
+	defer hook.Close()
+
+	// After the restart, the new dispatcher delivers it.
+	repo = openRepo(t, dsn)
+	defer repo.Close()
+	var broadcast []storage.OutboxEvent
+	d := New(repo, time.Second, 3)
+	d.SetBroadcaster(func(ev storage.OutboxEvent) { broadcast = append(broadcast, ev) })
+	d.SetWebhook(hook.URL, nil)
+
+	delivered, err := d.RunOnce(context.Background(), time.Now())
+	if err != nil || delivered != 1 {
+		t.Fatalf("RunOnce() = %d, %v; want 1 delivered", delivered, err)
+	}
+	if len(broadcast) != 1 || broadcast[0].Type != storage.OutboxAnomaly || broadcast[0].ServiceName != "checkout" {
+		t.Fatalf("broadcast = %+v, want the checkout anomaly", broadcast)
+	}
+	if len(posted) != 1 || posted[0].ID != broadcast[0].ID {
+		t.Fatalf("posted = %+v, want the event once", posted)
+	}
+	var anomaly storage.AnomalyEvent
+	if err := json.Unmarshal(posted[0].Payload, &anomaly); err != nil || anomaly.ID == 0 || anomaly.Signal != "error_rate" {
+		t.Errorf("payload = %s (%v), want the stored anomaly", posted[0].Payload, err)
+	}
+
+	// Delivered events are not sent again.
+	if delivered, err := d.RunOnce(context.Background(), time.Now()); err != nil || delivered != 0 || len(posted) != 1 {
+		t.Errorf("second RunOnce() = %d, %v with %d posts; want nothing new", delivered, err, len(posted))
+	}
+	st, err := repo.GetOutboxStatus(context.Background(), "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Counts[storage.OutboxDelivered] != 1 || st.Counts[storage.OutboxPending] != 0 {
+		t.Errorf("counts = %v, want 1 delivered", st.Counts)
+	}
+}
+
+func TestFailedDeliveriesBackOffUntilDead(t *testing.T) {
+	repo := openRepo(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer repo.Close()
+	if err := repo.CreateSLOBreach(&storage.SLOStatus{SLOID: 1, ServiceName: "checkout", Breached: true, EvaluatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer hook.Close()
+
+	broadcasts := 0
+	d := New(repo, time.Second, 3)
+	d.SetBroadcaster(func(storage.OutboxEvent) { broadcasts++ })
+	d.SetWebhook(hook.URL, []string{storage.OutboxSLOBreach})
+
+	now := time.Now()
+	if delivered, err := d.RunOnce(context.Background(), now); err != nil || delivered != 0 {
+		t.Fatalf("RunOnce() = %d, %v; want a failed delivery", delivered, err)
+	}
+	// Not retried before the backoff has passed
+	if _, err := d.RunOnce(context.Background(), now.Add(Backoff(1)-time.Second)); err != nil || calls.Load() != 1 {
+		t.Fatalf("early retry: %d webhook calls, err %v; want 1", calls.Load(), err)
+	}
+	now = now.Add(Backoff(1))
+	if _, err := d.RunOnce(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(Backoff(2))
+	if _, err := d.RunOnce(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 || broadcasts != 1 {
+		t.Errorf("%d webhook calls and %d broadcasts, want 3 and 1", calls.Load(), broadcasts)
+	}
+
+	st, err := repo.GetOutboxStatus(context.Background(), storage.OutboxDead, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Counts[storage.OutboxDead] != 1 || len(st.Events) != 1 {
+		t.Fatalf("status = %+v, want one dead event", st)
+	}
+	if ev := st.Events[0]; ev.Attempts != 3 || ev.LastError != "webhook returned 502 Bad Gateway" || ev.DeadAt == nil {
+		t.Errorf("dead event = %+v", ev)
+	}
+	if _, err := d.RunOnce(context.Background(), now.Add(24*time.Hour)); err != nil || calls.Load() != 3 {
+		t.Errorf("dead event retried: %d webhook calls, err %v", calls.Load(), err)
+	}
+}
+
+func TestWebhookEventTypes(t *testing.T) {
+	repo := openRepo(t, filepath.Join(t.TempDir(), "outbox.db"))
+	defer repo.Close()
+	if err := repo.CreateAnomalyEvent(&storage.AnomalyEvent{ServiceName: "checkout", Signal: "request_rate", DetectedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls.Add(1) }))
+	defer hook.Close()
+
+	d := New(repo, time.Second, 3)
+	d.SetWebhook(hook.URL, []string{storage.OutboxSLOBreach})
+	if delivered, err := d.RunOnce(context.Background(), time.Now()); err != nil || delivered != 1 {
+		t.Fatalf("RunOnce() = %d, %v; want 1 delivered", delivered, err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("anomaly posted to a webhook taking only %s", storage.OutboxSLOBreach)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  5 * time.Second,
+		2:  10 * time.Second,
+		4:  40 * time.Second,
+		10: 2560 * time.Second,
+		11: time.Hour,
+		50: time.Hour,
+	} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
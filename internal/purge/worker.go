@@ -0,0 +1,113 @@
+// Package purge runs the admin purge jobs in the background, one batch at a time,
+// pausing between batches so ingestion can take the database write lock.
+package purge
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// Worker runs queued purge jobs one after another. Jobs left unfinished by a
+// restart are resumed from their saved progress when the worker starts.
+type Worker struct {
+	store     storage.PurgeJobStore
+	batchSize int
+	pause     time.Duration
+
+	wake     chan struct{}
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates a worker that deletes batchSize rows per batch and sleeps pause
+// between batches.
+func New(store storage.PurgeJobStore, batchSize int, pause time.Duration) *Worker {
+	return &Worker{
+		store:     store,
+		batchSize: batchSize,
+		pause:     pause,
+		wake:      make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start runs unfinished jobs, then waits for Notify. Blocks until ctx is cancelled
+// or Stop is called; the job in progress is left to resume on the next start.
+func (w *Worker) Start(ctx context.Context) {
+	for {
+		w.RunPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stopCh:
+			return
+		case <-w.wake:
+		}
+	}
+}
+
+// Notify tells the worker a job was queued.
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop terminates the worker after its current batch.
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+}
+
+// RunPending runs every pending or interrupted job to the end, oldest first. It
+// returns early when the worker is stopped.
+func (w *Worker) RunPending(ctx context.Context) {
+	for {
+		jobs, err := w.store.ListUnfinishedPurgeJobs()
+		if err != nil {
+			slog.Error("Purge: failed to list jobs", "error", err)
+			return
+		}
+		if len(jobs) == 0 {
+			return
+		}
+		for _, job := range jobs {
+			if job.Status == storage.PurgeRunning {
+				slog.Info("Purge: resuming job", "job_id", job.ID, "phase", job.Phase, "last_id", job.LastID,
+					"logs_purged", job.LogsPurged, "traces_purged", job.TracesPurged)
+			}
+			if !w.run(ctx, job.ID) {
+				return
+			}
+		}
+	}
+}
+
+// run deletes batches of a job until it finishes. It returns false when the worker
+// is stopped first, or when the job could not be run and was left unfinished, in
+// which case it is retried on the next Notify or restart.
+func (w *Worker) run(ctx context.Context, id uint) bool {
+	for {
+		job, err := w.store.RunPurgeBatch(id, w.batchSize)
+		if err != nil {
+			slog.Error("Purge: job failed", "job_id", id, "error", err)
+			return job != nil && job.Finished()
+		}
+		if job.Finished() {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-w.stopCh:
+			return false
+		case <-time.After(w.pause):
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestWorkerResumesAndRunsQueuedJobs(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "purge.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	defer repo.Close()
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	var logs []storage.Log
+	for i := range 12 {
+		logs = append(logs, storage.Log{ServiceName: "api", Body: storage.CompressedText(fmt.Sprint(i)), Timestamp: old})
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	// A job interrupted after its first batch, as found after a restart.
+	interrupted, err := repo.CreatePurgeJob(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RunPurgeBatch(interrupted.ID, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(repo, 5, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Start(ctx)
+	defer w.Stop()
+
+	waitDone := func(id uint) *storage.PurgeJob {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			job, err := repo.GetPurgeJob(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Finished() {
+				return job
+			}
+		}
+		t.Fatalf("job %d did not finish", id)
+		return nil
+	}
+	if job := waitDone(interrupted.ID); job.Status != storage.PurgeDone || job.LogsPurged != 12 {
+		t.Errorf("resumed job = %+v, want done with all 12 logs", job)
+	}
+
+	// A job queued while the worker is idle runs on Notify.
+	if err := repo.BatchCreateLogs([]storage.Log{{ServiceName: "api", Body: "late", Timestamp: old}}); err != nil {
+		t.Fatal(err)
+	}
+	queued, err := repo.CreatePurgeJob(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Notify()
+	if job := waitDone(queued.ID); job.Status != storage.PurgeDone || job.LogsPurged != 1 {
+		t.Errorf("queued job = %+v, want done with 1 log", job)
+	}
+}
@@ -0,0 +1,153 @@
+// Package query parses the TraceQL-lite expressions accepted by
+// /api/traces/query, e.g.
+//
+//	service="payment-service" && duration>500ms && span.attr["http.status_code"]=504
+//
+// into a small AST. It only checks syntax and the field/value pairing; turning
+// the AST into SQL is up to the storage layer.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError is a query that does not parse. Pos is the byte offset of the
+// offending token in the query.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokDuration
+	tokOp     // = != > >= < <=
+	tokAnd    // &&
+	tokOr     // ||
+	tokLParen // (
+	tokRParen // )
+	tokLBrack // [
+	tokRBrack // ]
+)
+
+type token struct {
+	kind tokenKind
+	text string // unquoted for strings
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits a query into tokens, ending with tokEOF.
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			end, text, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{tokString, text, i})
+			i = end
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			i++
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			kind := tokNumber
+			if unit := i; unit < len(src) && isLetter(src[unit:]) {
+				for i < len(src) && isLetter(src[i:]) {
+					_, size := utf8.DecodeRuneInString(src[i:])
+					i += size
+				}
+				kind = tokDuration
+			}
+			toks = append(toks, token{kind, src[start:i], start})
+		case isLetter(src[i:]) || c == '_':
+			start := i
+			for i < len(src) && (isLetter(src[i:]) || src[i] == '_' || src[i] == '.' || src[i] >= '0' && src[i] <= '9') {
+				_, size := utf8.DecodeRuneInString(src[i:])
+				i += size
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case strings.HasPrefix(src[i:], "&&"):
+			toks = append(toks, token{tokAnd, "&&", i})
+			i += 2
+		case strings.HasPrefix(src[i:], "||"):
+			toks = append(toks, token{tokOr, "||", i})
+			i += 2
+		case strings.HasPrefix(src[i:], "!=") || strings.HasPrefix(src[i:], ">=") || strings.HasPrefix(src[i:], "<="):
+			toks = append(toks, token{tokOp, src[i : i+2], i})
+			i += 2
+		case c == '=' || c == '>' || c == '<':
+			toks = append(toks, token{tokOp, src[i : i+1], i})
+			i++
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == '[':
+			toks = append(toks, token{tokLBrack, "[", i})
+			i++
+		case c == ']':
+			toks = append(toks, token{tokRBrack, "]", i})
+			i++
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+// lexString reads the double-quoted string starting at src[start], with Go
+// escapes, and returns the offset just past it.
+func lexString(src string, start int) (int, string, error) {
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			text, err := strconv.Unquote(src[start : i+1])
+			if err != nil {
+				return 0, "", &SyntaxError{Pos: start, Msg: "invalid escape in string"}
+			}
+			return i + 1, text, nil
+		}
+	}
+	return 0, "", &SyntaxError{Pos: start, Msg: "unterminated string"}
+}
+
+func isLetter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r)
+}
@@ -0,0 +1,270 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Grammar:
+//
+//	query      = or
+//	or         = and { "||" and }
+//	and        = primary { "&&" primary }
+//	primary    = "(" or ")" | comparison
+//	comparison = field op value
+//	field      = "service" | "trace_id" | "status" | "duration"
+//	           | "span.name" | "span.service" | "span.attr" "[" string "]"
+//	op         = "=" | "!=" | ">" | ">=" | "<" | "<="
+//	value      = string | number | duration | ident
+//
+// && binds tighter than ||. Durations take a Go unit suffix (500ms, 1.5s, 2m);
+// status compares against ok, error or unset. Only duration and span.attr accept
+// the ordering operators.
+
+// Field is something a comparison can test.
+type Field string
+
+const (
+	FieldService     Field = "service"      // root service of the trace
+	FieldStatus      Field = "status"       // ok, error or unset
+	FieldDuration    Field = "duration"     // trace duration
+	FieldSpanName    Field = "span.name"    // any span's operation name
+	FieldSpanService Field = "span.service" // any span's service
+	FieldSpanAttr    Field = "span.attr"    // any span's attribute, keyed by Comparison.Key
+	FieldTraceID     Field = "trace_id"
+)
+
+// Op is a comparison or boolean operator.
+type Op string
+
+const (
+	OpEq  Op = "="
+	OpNe  Op = "!="
+	OpGt  Op = ">"
+	OpGe  Op = ">="
+	OpLt  Op = "<"
+	OpLe  Op = "<="
+	OpAnd Op = "&&"
+	OpOr  Op = "||"
+)
+
+// Status values accepted by the status field.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+	StatusUnset = "unset"
+)
+
+// Expr is a parsed query: a *Binary or a *Comparison.
+type Expr interface {
+	Pos() int
+}
+
+// Binary joins two expressions with OpAnd or OpOr.
+type Binary struct {
+	Op          Op
+	Left, Right Expr
+	At          int
+}
+
+func (b *Binary) Pos() int { return b.At }
+
+// Comparison tests one field against a value.
+type Comparison struct {
+	Field Field
+	Key   string // attribute key, for FieldSpanAttr
+	Op    Op
+	Value Value
+	At    int
+}
+
+func (c *Comparison) Pos() int { return c.At }
+
+// ValueKind tells which field of a Value is set.
+type ValueKind int
+
+const (
+	KindString   ValueKind = iota // Str, quoted or a bare identifier
+	KindNumber                    // Num, with Str holding the literal
+	KindDuration                  // Dur
+)
+
+// Value is the right-hand side of a comparison.
+type Value struct {
+	Kind ValueKind
+	Str  string
+	Num  float64
+	Dur  time.Duration
+}
+
+// Parse parses a query. Errors are *SyntaxError.
+func Parse(src string) (Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if p.peek().kind == tokEOF {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty query"}
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s, expected && or ||", t)}
+	}
+	return expr, nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s, expected %s", t, what)}
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: OpOr, Left: left, Right: right, At: op.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		op := p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: OpAnd, Left: left, Right: right, At: op.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	ft, err := p.expect(tokIdent, "a field")
+	if err != nil {
+		return nil, err
+	}
+	c := &Comparison{Field: Field(ft.text), At: ft.pos}
+	switch c.Field {
+	case FieldService, FieldTraceID, FieldStatus, FieldDuration, FieldSpanName, FieldSpanService:
+	case FieldSpanAttr:
+		if _, err := p.expect(tokLBrack, "["); err != nil {
+			return nil, err
+		}
+		key, err := p.expect(tokString, "a quoted attribute key")
+		if err != nil {
+			return nil, err
+		}
+		if key.text == "" {
+			return nil, &SyntaxError{Pos: key.pos, Msg: "empty attribute key"}
+		}
+		c.Key = key.text
+		if _, err := p.expect(tokRBrack, "]"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &SyntaxError{Pos: ft.pos, Msg: fmt.Sprintf("unknown field %q", ft.text)}
+	}
+
+	opt, err := p.expect(tokOp, "a comparison operator")
+	if err != nil {
+		return nil, err
+	}
+	c.Op = Op(opt.text)
+	ordered := c.Op != OpEq && c.Op != OpNe
+	if ordered && c.Field != FieldDuration && c.Field != FieldSpanAttr {
+		return nil, &SyntaxError{Pos: opt.pos, Msg: fmt.Sprintf("%s only supports = and !=", c.Field)}
+	}
+
+	vt := p.next()
+	switch vt.kind {
+	case tokString, tokIdent:
+		c.Value = Value{Kind: KindString, Str: vt.text}
+	case tokNumber:
+		n, err := strconv.ParseFloat(vt.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: vt.pos, Msg: fmt.Sprintf("invalid number %s", vt)}
+		}
+		c.Value = Value{Kind: KindNumber, Str: vt.text, Num: n}
+	case tokDuration:
+		d, err := time.ParseDuration(vt.text)
+		if err != nil {
+			return nil, &SyntaxError{Pos: vt.pos, Msg: fmt.Sprintf("invalid duration %s", vt)}
+		}
+		c.Value = Value{Kind: KindDuration, Str: vt.text, Dur: d}
+	default:
+		return nil, &SyntaxError{Pos: vt.pos, Msg: fmt.Sprintf("unexpected %s, expected a value", vt)}
+	}
+
+	switch c.Field {
+	case FieldDuration:
+		if c.Value.Kind != KindDuration {
+			return nil, &SyntaxError{Pos: vt.pos, Msg: "duration needs a value with a unit, e.g. 500ms"}
+		}
+	case FieldStatus:
+		s := strings.ToLower(c.Value.Str)
+		if c.Value.Kind != KindString || s != StatusOK && s != StatusError && s != StatusUnset {
+			return nil, &SyntaxError{Pos: vt.pos, Msg: "status must be ok, error or unset"}
+		}
+		c.Value.Str = s
+	case FieldSpanAttr:
+		if ordered && c.Value.Kind != KindNumber {
+			return nil, &SyntaxError{Pos: vt.pos, Msg: fmt.Sprintf("%s needs a number", c.Op)}
+		}
+	default:
+		if c.Value.Kind == KindDuration {
+			return nil, &SyntaxError{Pos: vt.pos, Msg: fmt.Sprintf("%s does not take a duration", c.Field)}
+		}
+	}
+	return c, nil
+}
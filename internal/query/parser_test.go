@@ -0,0 +1,139 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// render prints an expression fully parenthesized, so tests can assert on shape.
+func render(e Expr) string {
+	switch e := e.(type) {
+	case *Binary:
+		return fmt.Sprintf("(%s %s %s)", render(e.Left), e.Op, render(e.Right))
+	case *Comparison:
+		field := string(e.Field)
+		if e.Key != "" {
+			field += fmt.Sprintf("[%q]", e.Key)
+		}
+		var v string
+		switch e.Value.Kind {
+		case KindString:
+			v = fmt.Sprintf("%q", e.Value.Str)
+		case KindNumber:
+			v = fmt.Sprint(e.Value.Num)
+		case KindDuration:
+			v = e.Value.Dur.String()
+		}
+		return field + string(e.Op) + v
+	}
+	return "?"
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`service="payment-service"`, `service="payment-service"`},
+		{`service = payment`, `service="payment"`},
+		{`duration>500ms`, `duration>500ms`},
+		{`duration <= 1.5s`, `duration<=1.5s`},
+		{`status=ERROR`, `status="error"`},
+		{`status != ok`, `status!="ok"`},
+		{`trace_id="abc123"`, `trace_id="abc123"`},
+		{`span.name="GET /cart"`, `span.name="GET /cart"`},
+		{`span.service!="db"`, `span.service!="db"`},
+		{`span.attr["http.status_code"]=504`, `span.attr["http.status_code"]=504`},
+		{`span.attr["retry"] >= -1`, `span.attr["retry"]>=-1`},
+		{`span.attr["peer"]="a\"b"`, `span.attr["peer"]="a\"b"`},
+		{
+			`service="payment-service" && duration>500ms && status=error && span.attr["http.status_code"]=504`,
+			`(((service="payment-service" && duration>500ms) && status="error") && span.attr["http.status_code"]=504)`,
+		},
+		{`service=a || service=b && status=error`, `(service="a" || (service="b" && status="error"))`},
+		{`(service=a || service=b) && status=error`, `((service="a" || service="b") && status="error")`},
+		{`((duration>1s))`, `duration>1s`},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if s := render(got); s != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, s, tt.want)
+		}
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	e, err := Parse(`duration>2m && span.attr["n"]<3.5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := e.(*Binary)
+	if d := b.Left.(*Comparison).Value; d.Kind != KindDuration || d.Dur != 2*time.Minute {
+		t.Errorf("duration value = %+v, want 2m", d)
+	}
+	if n := b.Right.(*Comparison).Value; n.Kind != KindNumber || n.Num != 3.5 || n.Str != "3.5" {
+		t.Errorf("number value = %+v, want 3.5", n)
+	}
+	if b.Pos() != strings.Index(`duration>2m && span.attr["n"]<3.5`, "&&") {
+		t.Errorf("Binary.Pos() = %d, want the offset of &&", b.Pos())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		pos  int
+		frag string
+	}{
+		{``, 0, "empty query"},
+		{`   `, 0, "empty query"},
+		{`service=`, 8, "expected a value"},
+		{`service`, 7, "expected a comparison operator"},
+		{`=a`, 0, "expected a field"},
+		{`colour=red`, 0, `unknown field "colour"`},
+		{`service="a`, 8, "unterminated string"},
+		{`service="a\q"`, 8, "invalid escape"},
+		{`service=a $`, 10, "unexpected character '$'"},
+		{`service=a service=b`, 10, "expected && or ||"},
+		{`service=a &&`, 12, "expected a field"},
+		{`(service=a`, 10, "expected )"},
+		{`service=a)`, 9, "expected && or ||"},
+		{`service>a`, 7, "service only supports = and !="},
+		{`status=broken`, 7, "status must be ok, error or unset"},
+		{`status=1`, 7, "status must be ok, error or unset"},
+		{`duration>500`, 9, "needs a value with a unit"},
+		{`duration>5parsecs`, 9, "invalid duration"},
+		{`service=5s`, 8, "does not take a duration"},
+		{`span.attr=1`, 9, "expected ["},
+		{`span.attr[key]=1`, 10, "expected a quoted attribute key"},
+		{`span.attr[""]=1`, 10, "empty attribute key"},
+		{`span.attr["k"=1`, 13, "expected ]"},
+		{`span.attr["k"]>"x"`, 15, "> needs a number"},
+		{`duration>1.2.3s`, 9, "invalid duration"},
+		{`span.attr["k"]=1.2.3`, 15, "invalid number"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.in)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q) error = %v, want a *SyntaxError", tt.in, err)
+			continue
+		}
+		if se.Pos != tt.pos || !strings.Contains(se.Msg, tt.frag) {
+			t.Errorf("Parse(%q) = %q at %d, want %q at %d", tt.in, se.Msg, se.Pos, tt.frag, tt.pos)
+		}
+	}
+}
+
+func TestSyntaxErrorMessage(t *testing.T) {
+	err := &SyntaxError{Pos: 4, Msg: "boom"}
+	if got, want := err.Error(), "syntax error at position 4: boom"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -7,21 +7,83 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Entry types. Within one batch, entries are replayed in this order so that spans
+// never arrive before their trace.
+const (
+	TypeTraces  = "traces"
+	TypeSpans   = "spans"
+	TypeLogs    = "logs"
+	TypeMetrics = "metrics"
+)
+
+var typeOrder = map[string]int{TypeTraces: 0, TypeSpans: 1, TypeLogs: 2, TypeMetrics: 3}
+
+// Entry is one typed part of a failed write, e.g. the spans of an export.
+type Entry struct {
+	Type string
+	Data interface{}
+}
+
+// envelope is the on-disk format of an entry.
+type envelope struct {
+	Type string          `json:"type"`
+	Seq  uint64          `json:"seq,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Replay progress states, as published to the progress callback.
+const (
+	ReplayStarted  = "started"
+	ReplayProgress = "progress"
+	ReplayFailure  = "failure"
+	ReplayFinished = "finished"
+)
+
+// progressEvery is how many replayed entries apart progress is published.
+const progressEvery = 100
+
+// Progress describes the current or last replay run.
+type Progress struct {
+	State       string     `json:"state"`
+	Total       int        `json:"total"`    // entries due this run
+	Done        int        `json:"done"`     // replayed and removed
+	Failed      int        `json:"failed"`   // kept for a later run with backoff
+	Deferred    int        `json:"deferred"` // waiting on a failed earlier entry of their batch
+	Dropped     int        `json:"dropped"`  // removed after DLQ_MAX_RETRIES failures
+	Interrupted bool       `json:"interrupted,omitempty"`
+	Entry       string     `json:"entry,omitempty"` // the failed entry of a failure event
+	LastError   string     `json:"last_error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// Status is a snapshot of the queue for GET /api/admin/dlq.
+type Status struct {
+	Files     int            `json:"files"`
+	DiskBytes int64          `json:"disk_bytes"`
+	ByType    map[string]int `json:"by_type"` // files from before entries were typed count as "untyped"
+	Replay    *Progress      `json:"replay"` // current or last run; nil before the first
+}
+
 // DeadLetterQueue provides disk-based resilience for failed database writes.
 // When a batch insert fails, the data is serialized to JSON and written to disk.
 // A background replay worker periodically attempts to re-insert failed batches
 // with exponential backoff, bounded by configurable file count and disk limits.
+// Entries carry a sequence number and are replayed in the order they were queued.
 type DeadLetterQueue struct {
-	dir        string
-	interval   time.Duration
-	replayFn   func(data []byte) error
-	stopCh     chan struct{}
-	wg         sync.WaitGroup
-	mu         sync.Mutex
+	dir      string
+	interval time.Duration
+	replayFn func(entryType string, data []byte) error
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	seq      uint64 // last sequence number handed out; guarded by mu
 
 	// Bounds
 	maxFiles   int   // 0 = unlimited
@@ -31,21 +93,45 @@ type DeadLetterQueue struct {
 	// Per-file retry tracking (in-memory; resets on restart)
 	retries map[string]int
 
+	// Current or last replay run; guarded by mu
+	progress *Progress
+
 	// Metric callbacks (optional, set via SetMetrics)
-	onEnqueue func()
-	onSuccess func()
-	onFailure func()
+	onEnqueue   func()
+	onSuccess   func()
+	onFailure   func()
 	onDiskBytes func(int64)
+
+	// Replay progress callback (optional, set via SetProgressCallback)
+	onProgress func(Progress)
 }
 
 // NewDLQ creates a new Dead Letter Queue.
 // maxFiles/maxDiskMB/maxRetries = 0 means unlimited.
-func NewDLQ(dir string, interval time.Duration, replayFn func(data []byte) error) (*DeadLetterQueue, error) {
+func NewDLQ(dir string, interval time.Duration, replayFn func(entryType string, data []byte) error) (*DeadLetterQueue, error) {
 	return NewDLQWithLimits(dir, interval, replayFn, 0, 0, 0)
 }
 
-// NewDLQWithLimits creates a DLQ with explicit bounds.
-func NewDLQWithLimits(dir string, interval time.Duration, replayFn func(data []byte) error,
+// NewDLQWithLimits creates a DLQ with explicit bounds. replayFn receives the type
+// and the JSON data of each entry; files written before entries were typed are
+// replayed as logs.
+func NewDLQWithLimits(dir string, interval time.Duration, replayFn func(entryType string, data []byte) error,
+	maxFiles int, maxDiskMB int64, maxRetries int) (*DeadLetterQueue, error) {
+	dlq, err := newDLQ(dir, interval, replayFn, maxFiles, maxDiskMB, maxRetries)
+	if err != nil {
+		return nil, err
+	}
+
+	dlq.wg.Add(1)
+	go dlq.replayWorker()
+
+	slog.Info("🔁 DLQ replay worker started", "dir", dir, "interval", interval,
+		"max_files", maxFiles, "max_disk_mb", maxDiskMB, "max_retries", maxRetries)
+	return dlq, nil
+}
+
+// newDLQ creates a DLQ without starting its replay worker.
+func newDLQ(dir string, interval time.Duration, replayFn func(entryType string, data []byte) error,
 	maxFiles int, maxDiskMB int64, maxRetries int) (*DeadLetterQueue, error) {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create DLQ directory %s: %w", dir, err)
@@ -61,12 +147,10 @@ func NewDLQWithLimits(dir string, interval time.Duration, replayFn func(data []b
 		maxRetries: maxRetries,
 		retries:    make(map[string]int),
 	}
-
-	dlq.wg.Add(1)
-	go dlq.replayWorker()
-
-	slog.Info("🔁 DLQ replay worker started", "dir", dir, "interval", interval,
-		"max_files", maxFiles, "max_disk_mb", maxDiskMB, "max_retries", maxRetries)
+	// Continue the sequence of what a previous run left behind.
+	for _, f := range dlq.listFiles() {
+		dlq.seq = max(dlq.seq, f.seq)
+	}
 	return dlq, nil
 }
 
@@ -80,83 +164,164 @@ func (d *DeadLetterQueue) SetMetrics(onEnqueue, onSuccess, onFailure func(), onD
 	d.mu.Unlock()
 }
 
+// SetProgressCallback sets a function called when a replay run starts, every
+// progressEvery entries, on each failed entry and when the run finishes.
+func (d *DeadLetterQueue) SetProgressCallback(fn func(Progress)) {
+	d.mu.Lock()
+	d.onProgress = fn
+	d.mu.Unlock()
+}
+
+// dlqFile is one entry file in the DLQ directory.
+type dlqFile struct {
+	name    string
+	typ     string // "" for files written before entries were typed
+	seq     uint64 // 0 for files written before entries were sequenced
+	size    int64
+	modTime time.Time
+}
+
+// fileName names an entry so that sorting by name is replay order.
+func fileName(seq uint64, typ string) string {
+	return fmt.Sprintf("dlq_%020d_%d_%s.json", seq, typeOrder[typ], typ)
+}
+
+// parseFileName reads the sequence number and type back from an entry file name.
+// Untyped files (batch_<unix nanos>.json) report ok = false.
+func parseFileName(name string) (seq uint64, typ string, ok bool) {
+	var rank int
+	base := strings.TrimSuffix(name, ".json")
+	if n, err := fmt.Sscanf(base, "dlq_%d_%d_%s", &seq, &rank, &typ); err != nil || n != 3 {
+		return 0, "", false
+	}
+	return seq, typ, true
+}
+
+// listFiles returns the entry files in replay order: untyped files first, as they are
+// the oldest, then by sequence number and type.
+func (d *DeadLetterQueue) listFiles() []dlqFile {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		slog.Error("DLQ: failed to read directory", "error", err)
+		return nil
+	}
+	var files []dlqFile
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		f := dlqFile{name: e.Name(), size: info.Size(), modTime: info.ModTime()}
+		f.seq, f.typ, _ = parseFileName(f.name)
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.seq != b.seq {
+			return a.seq < b.seq
+		}
+		if typeOrder[a.typ] != typeOrder[b.typ] {
+			return typeOrder[a.typ] < typeOrder[b.typ]
+		}
+		return a.name < b.name
+	})
+	return files
+}
+
 // DiskBytes returns the current total bytes of files in the DLQ directory.
 func (d *DeadLetterQueue) DiskBytes() int64 {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	entries, _ := os.ReadDir(d.dir)
 	var total int64
-	for _, e := range entries {
-		if !e.IsDir() && filepath.Ext(e.Name()) == ".json" {
-			if info, err := e.Info(); err == nil {
-				total += info.Size()
-			}
-		}
+	for _, f := range d.listFiles() {
+		total += f.size
 	}
 	return total
 }
 
-// Enqueue serializes the given batch to JSON and writes it to disk.
-// Enforces file count and disk size limits (FIFO eviction when exceeded).
-func (d *DeadLetterQueue) Enqueue(batch interface{}) error {
+// Status returns the queued entries by type and the progress of the current or last
+// replay run.
+func (d *DeadLetterQueue) Status() Status {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-
-	data, err := json.Marshal(batch)
-	if err != nil {
-		return fmt.Errorf("DLQ: failed to marshal batch: %w", err)
+	st := Status{ByType: make(map[string]int)}
+	for _, f := range d.listFiles() {
+		st.Files++
+		st.DiskBytes += f.size
+		typ := f.typ
+		if typ == "" {
+			typ = "untyped"
+		}
+		st.ByType[typ]++
 	}
+	if d.progress != nil {
+		p := *d.progress
+		st.Replay = &p
+	}
+	return st
+}
 
-	// Enforce limits before writing a new file.
-	d.enforceLimits(int64(len(data)))
-
-	filename := fmt.Sprintf("batch_%d.json", time.Now().UnixNano())
-	path := filepath.Join(d.dir, filename)
+// Enqueue writes the entries of one failed batch to disk under the next sequence
+// number. Enforces file count and disk size limits (FIFO eviction when exceeded).
+func (d *DeadLetterQueue) Enqueue(entries ...Entry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	if err := os.WriteFile(path, data, 0o644); err != nil {
-		return fmt.Errorf("DLQ: failed to write file %s: %w", path, err)
+	data := make([][]byte, len(entries))
+	var total int64
+	for i, e := range entries {
+		if _, ok := typeOrder[e.Type]; !ok {
+			return fmt.Errorf("DLQ: unknown entry type %q", e.Type)
+		}
+		raw, err := json.Marshal(e.Data)
+		if err != nil {
+			return fmt.Errorf("DLQ: failed to marshal %s: %w", e.Type, err)
+		}
+		data[i], err = json.Marshal(envelope{Type: e.Type, Seq: d.seq + 1, Data: raw})
+		if err != nil {
+			return fmt.Errorf("DLQ: failed to marshal %s: %w", e.Type, err)
+		}
+		total += int64(len(data[i]))
 	}
 
-	slog.Warn("📦 Batch written to DLQ", "file", filename, "bytes", len(data))
-	if d.onEnqueue != nil {
-		d.onEnqueue()
+	// Enforce limits before writing new files.
+	d.enforceLimits(len(entries), total)
+
+	d.seq++
+	for i, e := range entries {
+		filename := fileName(d.seq, e.Type)
+		path := filepath.Join(d.dir, filename)
+		if err := os.WriteFile(path, data[i], 0o644); err != nil {
+			return fmt.Errorf("DLQ: failed to write file %s: %w", path, err)
+		}
+		slog.Warn("📦 Batch written to DLQ", "file", filename, "bytes", len(data[i]))
+		if d.onEnqueue != nil {
+			d.onEnqueue()
+		}
 	}
 	return nil
 }
 
-// enforceLimits removes oldest files to stay within maxFiles and maxDiskMB.
-// Must be called with d.mu held.
-func (d *DeadLetterQueue) enforceLimits(incomingBytes int64) {
+// enforceLimits removes the oldest files to make room for incomingFiles files of
+// incomingBytes within maxFiles and maxDiskMB. Must be called with d.mu held.
+func (d *DeadLetterQueue) enforceLimits(incomingFiles int, incomingBytes int64) {
 	if d.maxFiles == 0 && d.maxDiskMB == 0 {
 		return
 	}
 
-	entries, err := os.ReadDir(d.dir)
-	if err != nil {
-		return
-	}
-
-	// Collect JSON files sorted by name (timestamp-prefixed → chronological).
-	type fileInfo struct {
-		name string
-		size int64
-	}
-	var files []fileInfo
+	files := d.listFiles()
 	var totalBytes int64
-	for _, e := range entries {
-		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
-			continue
-		}
-		if info, err := e.Info(); err == nil {
-			files = append(files, fileInfo{e.Name(), info.Size()})
-			totalBytes += info.Size()
-		}
+	for _, f := range files {
+		totalBytes += f.size
 	}
 
 	maxBytes := d.maxDiskMB * 1024 * 1024
 	i := 0
 	for i < len(files) {
-		overFiles := d.maxFiles > 0 && len(files)-i >= d.maxFiles
+		overFiles := d.maxFiles > 0 && len(files)-i+incomingFiles > d.maxFiles
 		overDisk := maxBytes > 0 && totalBytes+incomingBytes > maxBytes
 
 		if !overFiles && !overDisk {
@@ -177,23 +342,11 @@ func (d *DeadLetterQueue) enforceLimits(incomingBytes int64) {
 func (d *DeadLetterQueue) Size() int {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-
-	entries, err := os.ReadDir(d.dir)
-	if err != nil {
-		slog.Error("DLQ: failed to read directory", "error", err)
-		return 0
-	}
-
-	count := 0
-	for _, e := range entries {
-		if !e.IsDir() && filepath.Ext(e.Name()) == ".json" {
-			count++
-		}
-	}
-	return count
+	return len(d.listFiles())
 }
 
-// Stop gracefully shuts down the replay worker.
+// Stop gracefully shuts down the replay worker. A replay in progress stops after
+// its current entry; the next start continues with the entries left.
 func (d *DeadLetterQueue) Stop() {
 	close(d.stopCh)
 	d.wg.Wait()
@@ -217,35 +370,42 @@ func (d *DeadLetterQueue) replayWorker() {
 	}
 }
 
-// processFiles reads all JSON files in the DLQ directory and attempts to replay them
-// with exponential backoff based on per-file retry count.
+// stopping reports whether Stop has been called.
+func (d *DeadLetterQueue) stopping() bool {
+	select {
+	case <-d.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// processFiles replays the entries that are due, in sequence order, with exponential
+// backoff based on per-file retry count. When an entry fails, the later entries of
+// its batch wait for it.
 func (d *DeadLetterQueue) processFiles() {
 	d.mu.Lock()
-	entries, err := os.ReadDir(d.dir)
+	files := d.listFiles()
 	d.mu.Unlock()
 
-	if err != nil {
-		slog.Error("DLQ: failed to read directory for replay", "error", err)
-		return
-	}
-
-	replayed := 0
-	for _, entry := range entries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+	// Select the due entries. One in backoff holds back the rest of its batch.
+	held := make(map[uint64]bool)
+	var due []dlqFile
+	dropped := 0
+	for _, f := range files {
+		if f.seq > 0 && held[f.seq] {
 			continue
 		}
 
-		name := entry.Name()
-
 		// Check max retries — permanently drop if exceeded.
 		d.mu.Lock()
-		retries := d.retries[name]
+		retries := d.retries[f.name]
 		if d.maxRetries > 0 && retries >= d.maxRetries {
-			path := filepath.Join(d.dir, name)
-			os.Remove(path)
-			delete(d.retries, name)
+			os.Remove(filepath.Join(d.dir, f.name))
+			delete(d.retries, f.name)
 			d.mu.Unlock()
-			slog.Error("DLQ: max retries exceeded, dropping file", "file", name, "retries", retries)
+			dropped++
+			slog.Error("DLQ: max retries exceeded, dropping file", "file", f.name, "retries", retries)
 			continue
 		}
 		d.mu.Unlock()
@@ -258,54 +418,115 @@ func (d *DeadLetterQueue) processFiles() {
 				backoff = maxBackoff
 			}
 			// Skip this file until enough time has elapsed.
-			if info, err := entry.Info(); err == nil {
-				if time.Since(info.ModTime()) < backoff {
-					continue
-				}
+			if time.Since(f.modTime) < backoff {
+				held[f.seq] = true
+				continue
 			}
 		}
+		due = append(due, f)
+	}
+	if len(due) == 0 && dropped == 0 {
+		return
+	}
 
-		path := filepath.Join(d.dir, name)
-		data, err := os.ReadFile(path)
-		if err != nil {
-			slog.Error("DLQ: failed to read file", "file", name, "error", err)
+	p := Progress{State: ReplayStarted, Total: len(due), Dropped: dropped, StartedAt: time.Now()}
+	d.publish(p)
+
+	failed := make(map[uint64]bool)
+	for _, f := range due {
+		if d.stopping() {
+			p.Interrupted = true
+			break
+		}
+		if f.seq > 0 && failed[f.seq] {
+			p.Deferred++
 			continue
 		}
 
-		if err := d.replayFn(data); err != nil {
-			d.mu.Lock()
-			d.retries[name]++
-			newRetries := d.retries[name]
-			cb := d.onFailure
-			d.mu.Unlock()
-			slog.Warn("DLQ: replay failed, backing off", "file", name, "retries", newRetries, "error", err)
-			if cb != nil {
-				cb()
-			}
-			// Touch the file to reset the backoff timer.
-			now := time.Now()
-			os.Chtimes(path, now, now)
+		if err := d.replayFile(f); err != nil {
+			failed[f.seq] = true
+			p.Failed++
+			p.LastError = err.Error()
+			fp := p
+			fp.State, fp.Entry = ReplayFailure, f.name
+			d.publish(fp)
 			continue
 		}
+		p.Done++
+		if p.Done%progressEvery == 0 {
+			p.State = ReplayProgress
+			d.publish(p)
+		}
+	}
+
+	now := time.Now()
+	p.State, p.FinishedAt = ReplayFinished, &now
+	d.publish(p)
+	if p.Done > 0 || p.Interrupted {
+		slog.Info("🔁 DLQ replay cycle complete", "replayed", p.Done, "of", p.Total,
+			"failed", p.Failed, "deferred", p.Deferred, "interrupted", p.Interrupted)
+	}
+}
+
+// replayFile replays one entry file and removes it once stored.
+func (d *DeadLetterQueue) replayFile(f dlqFile) error {
+	path := filepath.Join(d.dir, f.name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("DLQ: failed to read file", "file", f.name, "error", err)
+		return err
+	}
 
-		// Success — remove the file and clear retry counter.
+	typ, payload := TypeLogs, data
+	var env envelope
+	if json.Unmarshal(data, &env) == nil && env.Type != "" {
+		typ, payload = env.Type, env.Data
+	}
+	if err := d.replayFn(typ, payload); err != nil {
 		d.mu.Lock()
-		var successCb func()
-		if err := os.Remove(path); err != nil {
-			slog.Error("DLQ: failed to remove replayed file", "file", name, "error", err)
-		} else {
-			delete(d.retries, name)
-			replayed++
-			successCb = d.onSuccess
-			slog.Info("✅ DLQ file replayed and removed", "file", name)
-		}
+		d.retries[f.name]++
+		newRetries := d.retries[f.name]
+		cb := d.onFailure
 		d.mu.Unlock()
-		if successCb != nil {
-			successCb()
+		slog.Warn("DLQ: replay failed, backing off", "file", f.name, "retries", newRetries, "error", err)
+		if cb != nil {
+			cb()
 		}
+		// Touch the file to reset the backoff timer.
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return err
 	}
 
-	if replayed > 0 {
-		slog.Info("🔁 DLQ replay cycle complete", "replayed", replayed)
+	// Success — remove the file and clear retry counter.
+	d.mu.Lock()
+	var successCb func()
+	if err := os.Remove(path); err != nil {
+		slog.Error("DLQ: failed to remove replayed file", "file", f.name, "error", err)
+	} else {
+		delete(d.retries, f.name)
+		successCb = d.onSuccess
+		slog.Info("✅ DLQ file replayed and removed", "file", f.name)
+	}
+	d.mu.Unlock()
+	if successCb != nil {
+		successCb()
+	}
+	return nil
+}
+
+// publish hands p to the progress callback and records it as the current run's
+// progress; failure events are recorded as progress.
+func (d *DeadLetterQueue) publish(p Progress) {
+	d.mu.Lock()
+	cur := p
+	if cur.State == ReplayFailure {
+		cur.State, cur.Entry = ReplayProgress, ""
+	}
+	d.progress = &cur
+	cb := d.onProgress
+	d.mu.Unlock()
+	if cb != nil {
+		cb(p)
 	}
 }
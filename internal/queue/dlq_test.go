@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recorder is a replay function that records what it was handed, as "type:data".
+type recorder struct {
+	got  []string
+	fail map[string]bool // entries to fail, as "type:data"
+	on   func(entry string)
+}
+
+func (r *recorder) replay(entryType string, data []byte) error {
+	var v string
+	json.Unmarshal(data, &v)
+	entry := entryType + ":" + v
+	if r.on != nil {
+		r.on(entry)
+	}
+	if r.fail[entry] {
+		return errors.New("database is locked")
+	}
+	r.got = append(r.got, entry)
+	return nil
+}
+
+// mixedBacklog queues an untyped file from an older version and three batches, with
+// the parts of the first one out of order.
+func mixedBacklog(t *testing.T, d *DeadLetterQueue) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(d.dir, "batch_1700000000000000000.json"), []byte(`"legacy"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	batches := [][]Entry{
+		{{TypeLogs, "1"}, {TypeSpans, "1"}, {TypeTraces, "1"}},
+		{{TypeMetrics, "2"}},
+		{{TypeSpans, "3"}, {TypeTraces, "3"}},
+	}
+	for _, b := range batches {
+		if err := d.Enqueue(b...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	rec := &recorder{}
+	d, err := newDLQ(t.TempDir(), time.Minute, rec.replay, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Progress
+	d.SetProgressCallback(func(p Progress) { events = append(events, p) })
+	mixedBacklog(t, d)
+
+	d.processFiles()
+	want := []string{"logs:legacy", "traces:1", "spans:1", "logs:1", "metrics:2", "traces:3", "spans:3"}
+	if !reflect.DeepEqual(rec.got, want) {
+		t.Errorf("replayed %v, want %v", rec.got, want)
+	}
+	if d.Size() != 0 {
+		t.Errorf("%d files left, want none", d.Size())
+	}
+	if len(events) != 2 || events[0].State != ReplayStarted || events[0].Total != 7 ||
+		events[1].State != ReplayFinished || events[1].Done != 7 || events[1].FinishedAt == nil {
+		t.Errorf("events = %+v, want started and finished with 7 of 7", events)
+	}
+	if st := d.Status(); st.Replay == nil || st.Replay.State != ReplayFinished || st.Replay.Done != 7 {
+		t.Errorf("status = %+v, want the finished run", st)
+	}
+
+	// An empty queue does not start runs.
+	d.processFiles()
+	if len(events) != 2 {
+		t.Errorf("%d events after an idle run, want none added", len(events)-2)
+	}
+}
+
+func TestReplayFailureHoldsBackItsBatch(t *testing.T) {
+	rec := &recorder{fail: map[string]bool{"traces:1": true}}
+	d, err := newDLQ(t.TempDir(), time.Minute, rec.replay, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Progress
+	d.SetProgressCallback(func(p Progress) { events = append(events, p) })
+	mixedBacklog(t, d)
+
+	d.processFiles()
+	want := []string{"logs:legacy", "metrics:2", "traces:3", "spans:3"}
+	if !reflect.DeepEqual(rec.got, want) {
+		t.Errorf("replayed %v, want %v: the spans and logs of batch 1 wait for its trace", rec.got, want)
+	}
+	if len(events) != 3 || events[1].State != ReplayFailure || events[1].Entry == "" || events[1].LastError == "" {
+		t.Fatalf("events = %+v, want started, one failure, finished", events)
+	}
+	last := events[2]
+	if last.Done != 4 || last.Failed != 1 || last.Deferred != 2 {
+		t.Errorf("finished = %+v, want 4 done, 1 failed, 2 deferred", last)
+	}
+	st := d.Status()
+	if st.Files != 3 || st.ByType[TypeTraces] != 1 || st.ByType[TypeSpans] != 1 || st.ByType[TypeLogs] != 1 {
+		t.Errorf("status = %+v, want batch 1 still queued", st)
+	}
+
+	// While the trace backs off, the rest of its batch stays held.
+	delete(rec.fail, "traces:1")
+	rec.got = nil
+	d.processFiles()
+	if len(rec.got) != 0 {
+		t.Errorf("replayed %v during the backoff, want nothing", rec.got)
+	}
+	d.interval = 0
+	d.processFiles()
+	if want := []string{"traces:1", "spans:1", "logs:1"}; !reflect.DeepEqual(rec.got, want) {
+		t.Errorf("replayed %v after the backoff, want %v", rec.got, want)
+	}
+}
+
+func TestReplayResumesAfterStop(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	d, err := newDLQ(dir, time.Minute, rec.replay, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixedBacklog(t, d)
+	// Shutdown begins while the second entry is being written.
+	rec.on = func(entry string) {
+		if entry == "traces:1" {
+			d.Stop()
+		}
+	}
+	var last Progress
+	d.SetProgressCallback(func(p Progress) { last = p })
+	d.processFiles()
+	if want := []string{"logs:legacy", "traces:1"}; !reflect.DeepEqual(rec.got, want) {
+		t.Fatalf("replayed %v before stopping, want %v", rec.got, want)
+	}
+	if !last.Interrupted || last.Done != 2 || last.Total != 7 {
+		t.Errorf("last event = %+v, want an interrupted run with 2 of 7 done", last)
+	}
+
+	// After a restart, replay continues with the spans of the first batch, and new
+	// batches queue behind what is left.
+	rec.on = nil
+	d, err = newDLQ(dir, time.Minute, rec.replay, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Enqueue(Entry{TypeLogs, "4"}); err != nil {
+		t.Fatal(err)
+	}
+	d.processFiles()
+	want := []string{"logs:legacy", "traces:1", "spans:1", "logs:1", "metrics:2", "traces:3", "spans:3", "logs:4"}
+	if !reflect.DeepEqual(rec.got, want) {
+		t.Errorf("replayed %v, want %v", rec.got, want)
+	}
+}
+
+func TestEnqueueEvictsOldestBatches(t *testing.T) {
+	d, err := newDLQ(t.TempDir(), time.Minute, (&recorder{}).replay, 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Enqueue(Entry{TypeTraces, "1"}, Entry{TypeSpans, "1"})
+	d.Enqueue(Entry{TypeTraces, "2"}, Entry{TypeSpans, "2"})
+	if err := d.Enqueue(Entry{"profiles", "3"}); err == nil {
+		t.Error("Enqueue of an unknown type succeeded")
+	}
+	var names []string
+	for _, f := range d.listFiles() {
+		names = append(names, f.name)
+	}
+	want := []string{fileName(1, TypeSpans), fileName(2, TypeTraces), fileName(2, TypeSpans)}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("files = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,227 @@
+// Package quota enforces per-service daily ingest quotas. Counters are kept in
+// memory on the ingest path and persisted periodically, so a restart within the
+// same UTC day resumes where it left off. Counters reset at UTC midnight.
+package quota
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// dayLayout formats the UTC day a counter belongs to.
+const dayLayout = "2006-01-02"
+
+// ServiceUsage is one service's usage today alongside its configured limits.
+type ServiceUsage struct {
+	storage.QuotaUsage
+	MaxSpansPerDay int64 `json:"max_spans_per_day"`
+	MaxLogsPerDay  int64 `json:"max_logs_per_day"`
+}
+
+// Manager tracks per-service daily usage against the quotas in its store.
+type Manager struct {
+	store    storage.QuotaStore
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	limits  map[string]storage.ServiceQuota
+	day     string
+	usage   map[string]*storage.QuotaUsage
+	dirty   map[string]bool
+	pending []storage.QuotaUsage // previous day's counters not yet persisted
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates a quota manager that persists usage every interval.
+func New(store storage.QuotaStore, interval time.Duration) *Manager {
+	return &Manager{
+		store:    store,
+		interval: interval,
+		now:      time.Now,
+		limits:   make(map[string]storage.ServiceQuota),
+		usage:    make(map[string]*storage.QuotaUsage),
+		dirty:    make(map[string]bool),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Load reads the configured quotas and today's persisted usage.
+func (m *Manager) Load() error {
+	if err := m.Reload(); err != nil {
+		return err
+	}
+	day := m.now().UTC().Format(dayLayout)
+	rows, err := m.store.GetQuotaUsage(day)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.day = day
+	m.usage = make(map[string]*storage.QuotaUsage, len(rows))
+	m.dirty = make(map[string]bool)
+	for i := range rows {
+		m.usage[rows[i].ServiceName] = &rows[i]
+	}
+	return nil
+}
+
+// Reload re-reads the configured quotas, e.g. after they were changed through the API.
+func (m *Manager) Reload() error {
+	quotas, err := m.store.ListServiceQuotas()
+	if err != nil {
+		return err
+	}
+	limits := make(map[string]storage.ServiceQuota, len(quotas))
+	for _, q := range quotas {
+		limits[q.ServiceName] = q
+	}
+	m.mu.Lock()
+	m.limits = limits
+	m.mu.Unlock()
+	return nil
+}
+
+// AllowSpans records n spans from service and returns how many of them fit in its
+// remaining daily quota. The rest are counted as rejected.
+func (m *Manager) AllowSpans(service string, n int) int {
+	return m.allow(service, n, true)
+}
+
+// AllowLogs records n logs from service and returns how many of them fit in its
+// remaining daily quota. The rest are counted as rejected.
+func (m *Manager) AllowLogs(service string, n int) int {
+	return m.allow(service, n, false)
+}
+
+func (m *Manager) allow(service string, n int, spans bool) int {
+	if n <= 0 {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rollover()
+	u := m.usage[service]
+	if u == nil {
+		u = &storage.QuotaUsage{ServiceName: service, Day: m.day}
+		m.usage[service] = u
+	}
+	m.dirty[service] = true
+
+	q := m.limits[service]
+	used, rejected, limit := &u.Logs, &u.RejectedLogs, q.MaxLogsPerDay
+	if spans {
+		used, rejected, limit = &u.Spans, &u.RejectedSpans, q.MaxSpansPerDay
+	}
+
+	accepted := int64(n)
+	if limit > 0 {
+		accepted = max(0, min(accepted, limit-*used))
+	}
+	*used += accepted
+	*rejected += int64(n) - accepted
+	return int(accepted)
+}
+
+// rollover starts fresh counters when the UTC day has changed, keeping the old
+// ones for the next flush. Callers hold m.mu.
+func (m *Manager) rollover() {
+	day := m.now().UTC().Format(dayLayout)
+	if day == m.day {
+		return
+	}
+	for service := range m.dirty {
+		m.pending = append(m.pending, *m.usage[service])
+	}
+	m.day = day
+	m.usage = make(map[string]*storage.QuotaUsage)
+	m.dirty = make(map[string]bool)
+}
+
+// Usage returns today's usage for every service that has ingested data or has a
+// quota configured, ordered by service name.
+func (m *Manager) Usage() []ServiceUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover()
+
+	out := make([]ServiceUsage, 0, len(m.usage)+len(m.limits))
+	for service, u := range m.usage {
+		q := m.limits[service]
+		out = append(out, ServiceUsage{QuotaUsage: *u, MaxSpansPerDay: q.MaxSpansPerDay, MaxLogsPerDay: q.MaxLogsPerDay})
+	}
+	for service, q := range m.limits {
+		if m.usage[service] == nil {
+			out = append(out, ServiceUsage{
+				QuotaUsage:     storage.QuotaUsage{ServiceName: service, Day: m.day},
+				MaxSpansPerDay: q.MaxSpansPerDay,
+				MaxLogsPerDay:  q.MaxLogsPerDay,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ServiceName < out[j].ServiceName })
+	return out
+}
+
+// Flush persists counters that changed since the last flush.
+func (m *Manager) Flush() error {
+	m.mu.Lock()
+	m.rollover()
+	rows := m.pending
+	for service := range m.dirty {
+		rows = append(rows, *m.usage[service])
+	}
+	m.pending = nil
+	m.dirty = make(map[string]bool)
+	m.mu.Unlock()
+
+	if err := m.store.SaveQuotaUsage(rows); err != nil {
+		// Put the rows back so the next flush retries them.
+		m.mu.Lock()
+		for _, u := range rows {
+			if u.Day == m.day {
+				m.dirty[u.ServiceName] = true
+			} else {
+				m.pending = append(m.pending, u)
+			}
+		}
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Start runs the persistence loop. Blocks until ctx is cancelled or Stop is called.
+// Call Flush after ingestion has stopped to persist the final counts.
+func (m *Manager) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			if err := m.Flush(); err != nil {
+				slog.Error("Failed to persist quota usage", "error", err)
+			}
+		}
+	}
+}
+
+// Stop signals the persistence loop to exit.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+}
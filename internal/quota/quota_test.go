@@ -0,0 +1,90 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func newTestRepo(t *testing.T) *storage.Repository {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "quota.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestManagerEnforcesAndResumes(t *testing.T) {
+	repo := newTestRepo(t)
+	if err := repo.UpsertServiceQuota(&storage.ServiceQuota{ServiceName: "noisy", MaxSpansPerDay: 10, MaxLogsPerDay: 5}); err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2026, 3, 1, 22, 0, 0, 0, time.UTC)
+
+	m := New(repo, time.Minute)
+	m.now = func() time.Time { return clock }
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := m.AllowSpans("noisy", 6); got != 6 {
+		t.Errorf("AllowSpans(6) = %d, want 6", got)
+	}
+	if got := m.AllowLogs("noisy", 7); got != 5 {
+		t.Errorf("AllowLogs(7) = %d, want 5", got)
+	}
+	if got := m.AllowSpans("other", 1000); got != 1000 {
+		t.Errorf("unlimited service AllowSpans = %d, want 1000", got)
+	}
+	if err := m.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	// A restart on the same day picks up the persisted counters.
+	m = New(repo, time.Minute)
+	m.now = func() time.Time { return clock }
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.AllowSpans("noisy", 6); got != 4 {
+		t.Errorf("AllowSpans after restart = %d, want remaining 4", got)
+	}
+	usage := m.Usage()
+	if len(usage) != 2 || usage[0].ServiceName != "noisy" || usage[0].Spans != 10 || usage[0].RejectedSpans != 2 ||
+		usage[0].Logs != 5 || usage[0].RejectedLogs != 2 || usage[0].MaxSpansPerDay != 10 {
+		t.Errorf("Usage() = %+v", usage)
+	}
+
+	// UTC midnight resets the counters; the previous day is still persisted.
+	clock = clock.Add(3 * time.Hour)
+	if got := m.AllowSpans("noisy", 3); got != 3 {
+		t.Errorf("AllowSpans after midnight = %d, want 3", got)
+	}
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	prev, err := repo.GetQuotaUsage("2026-03-01")
+	if err != nil || len(prev) != 2 || prev[0].Spans != 10 || prev[0].RejectedSpans != 2 {
+		t.Errorf("previous day usage = %+v, %v", prev, err)
+	}
+	today, err := repo.GetQuotaUsage("2026-03-02")
+	if err != nil || len(today) != 1 || today[0].Spans != 3 {
+		t.Errorf("today usage = %+v, %v", today, err)
+	}
+
+	// Quotas changed through the API apply after Reload.
+	if err := repo.DeleteServiceQuota("noisy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.AllowSpans("noisy", 100); got != 100 {
+		t.Errorf("AllowSpans after quota removal = %d, want 100", got)
+	}
+}
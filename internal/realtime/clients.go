@@ -0,0 +1,88 @@
+package realtime
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ClientInfo describes one connected WebSocket client.
+type ClientInfo struct {
+	ID                 string    `json:"id"`
+	Hub                string    `json:"hub"` // "ws" or "events"
+	RemoteAddr         string    `json:"remote_addr"`
+	ConnectedAt        time.Time `json:"connected_at"`
+	Tenant             string    `json:"tenant,omitempty"`
+	Service            string    `json:"service,omitempty"`     // active service filter; /ws/events only
+	Environment        string    `json:"environment,omitempty"` // active environment filter; /ws/events only
+	MessagesSent       int64     `json:"messages_sent"`
+	MessagesDropped    int64     `json:"messages_dropped"`
+	LastWriteLatencyMs float64   `json:"last_write_latency_ms"`
+}
+
+// ClientTotals aggregates a list of clients.
+type ClientTotals struct {
+	Connected       int            `json:"connected"`
+	ByHub           map[string]int `json:"by_hub"`
+	MessagesSent    int64          `json:"messages_sent"`
+	MessagesDropped int64          `json:"messages_dropped"`
+}
+
+// SummarizeClients adds up the counters of clients.
+func SummarizeClients(clients []ClientInfo) ClientTotals {
+	t := ClientTotals{Connected: len(clients), ByHub: make(map[string]int)}
+	for _, c := range clients {
+		t.ByHub[c.Hub]++
+		t.MessagesSent += c.MessagesSent
+		t.MessagesDropped += c.MessagesDropped
+	}
+	return t
+}
+
+// clientStats is the bookkeeping of one connection. The identity is fixed at accept
+// time; the counters are atomics so the broadcast path updates them without a lock.
+type clientStats struct {
+	id          string
+	remoteAddr  string
+	connectedAt time.Time
+
+	sent      atomic.Int64
+	dropped   atomic.Int64
+	lastWrite atomic.Int64 // duration of the last successful write, ns
+}
+
+func newClientStats(r *http.Request) *clientStats {
+	return &clientStats{id: newClientID(), remoteAddr: r.RemoteAddr, connectedAt: time.Now()}
+}
+
+// wrote records a message written in d.
+func (s *clientStats) wrote(d time.Duration) {
+	s.sent.Add(1)
+	s.lastWrite.Store(int64(d))
+}
+
+func (s *clientStats) info(hub, tenantID, service, env string) ClientInfo {
+	return ClientInfo{
+		ID:                 s.id,
+		Hub:                hub,
+		RemoteAddr:         s.remoteAddr,
+		ConnectedAt:        s.connectedAt,
+		Tenant:             tenantID,
+		Service:            service,
+		Environment:        env,
+		MessagesSent:       s.sent.Load(),
+		MessagesDropped:    s.dropped.Load(),
+		LastWriteLatencyMs: float64(s.lastWrite.Load()) / float64(time.Millisecond),
+	}
+}
+
+// newClientID returns a random (version 4) UUID.
+func newClientID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
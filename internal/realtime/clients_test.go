@@ -0,0 +1,192 @@
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewClientID(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := newClientID()
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("id %q is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestClientStatsConcurrentUpdates(t *testing.T) {
+	s := newClientStats(httptest.NewRequest(http.MethodGet, "/ws", nil))
+	const writers, perWriter = 8, 1000
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				s.wrote(time.Millisecond)
+				if i%10 == 0 {
+					s.dropped.Add(1)
+				}
+			}
+		}()
+	}
+	// Read while the counters move.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			if info := s.info("ws", "", "", ""); info.MessagesSent < 0 || info.MessagesSent > writers*perWriter {
+				t.Errorf("messages_sent = %d mid-update", info.MessagesSent)
+			}
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	info := s.info("ws", "acme", "", "")
+	if info.MessagesSent != writers*perWriter || info.MessagesDropped != writers*perWriter/10 {
+		t.Errorf("sent %d, dropped %d; want %d, %d", info.MessagesSent, info.MessagesDropped, writers*perWriter, writers*perWriter/10)
+	}
+	if info.LastWriteLatencyMs != 1 || info.Tenant != "acme" || info.ID != s.id {
+		t.Errorf("info = %+v", info)
+	}
+}
+
+// TestHubClientsUnderBroadcast connects clients to /ws and /ws/events, lists them
+// while broadcasts are delivered, and force-disconnects one of each.
+func TestHubClientsUnderBroadcast(t *testing.T) {
+	events := NewEventHub(&stubSource{}, nil)
+	ctxHub, stopHub := context.WithCancel(context.Background())
+	go events.Start(ctxHub, time.Hour, 10*time.Millisecond)
+	defer events.Stop()
+	defer stopHub()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", events.HandleLegacyWebSocket)
+	mux.HandleFunc("/ws/events", events.HandleWebSocket)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	const perHub = 5
+	var conns []*websocket.Conn
+	for _, path := range []string{"/ws", "/ws/events?service=checkout"} {
+		for range perHub {
+			c, _, err := websocket.Dial(ctx, base+path, nil)
+			if err != nil {
+				t.Fatalf("dial %s: %v", path, err)
+			}
+			defer c.CloseNow()
+			conns = append(conns, c)
+			go func() { // drain
+				for {
+					if _, _, err := c.Read(ctx); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}
+	waitForClients(t, events, perHub)
+
+	// Broadcast and list concurrently.
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				events.BroadcastLog(LogEntry{ID: uint(i), ServiceName: "checkout"})
+				events.BroadcastEvent("slo_breach", "checkout", i)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				events.Clients()
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		all := events.Clients()
+		delivered := true
+		for _, c := range all {
+			delivered = delivered && c.MessagesSent > 0
+		}
+		if delivered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("clients = %+v, want every client to have been sent messages", all)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ids := make(map[string]bool)
+	for _, c := range events.Clients() {
+		if ids[c.ID] || !uuidPattern.MatchString(c.ID) || c.RemoteAddr == "" || c.ConnectedAt.IsZero() {
+			t.Errorf("client %+v: want a unique UUID, remote address and connect time", c)
+		}
+		ids[c.ID] = true
+		if c.Hub == "events" && c.Service != "checkout" {
+			t.Errorf("events client filter = %q, want checkout", c.Service)
+		}
+	}
+
+	if events.Disconnect("no-such-client") {
+		t.Error("Disconnect of an unknown id reported success")
+	}
+	byHub := clientsByHub(events)
+	if !events.Disconnect(byHub["ws"][0].ID) || !events.Disconnect(byHub["events"][0].ID) {
+		t.Fatal("Disconnect of a connected client failed")
+	}
+	waitForClients(t, events, perHub-1)
+
+	for _, c := range conns {
+		c.CloseNow()
+	}
+	waitForClients(t, events, 0)
+}
+
+func clientsByHub(h *EventHub) map[string][]ClientInfo {
+	byHub := make(map[string][]ClientInfo)
+	for _, c := range h.Clients() {
+		byHub[c.Hub] = append(byHub[c.Hub], c)
+	}
+	return byHub
+}
+
+func waitForClients(t *testing.T, h *EventHub, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		byHub := clientsByHub(h)
+		if len(byHub["ws"]) == want && len(byHub["events"]) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("clients = %d on /ws, %d on /ws/events; want %d each", len(byHub["ws"]), len(byHub["events"]), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
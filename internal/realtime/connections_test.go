@@ -0,0 +1,196 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/coder/websocket"
+)
+
+// testMetrics returns the Metrics shared by this package's tests: telemetry.New
+// registers on the default registry, so it may only run once per test binary.
+var testMetrics = sync.OnceValue(telemetry.New)
+
+// TestConnectionCountsAcrossHubs connects and disconnects clients on /ws, /ws/events
+// and /ws/health at the same time and checks that the per-hub counts in HealthStats
+// never go negative, always add up to the total, and settle back to zero.
+func TestConnectionCountsAcrossHubs(t *testing.T) {
+	m := testMetrics()
+
+	events := NewEventHub(&stubSource{}, func(count int) { m.SetActiveConnections(telemetry.HubEvents, count) })
+	events.SetLegacyConnectionCallback(func(count int) { m.SetActiveConnections(telemetry.HubWS, count) })
+	defer events.Stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", events.HandleLegacyWebSocket)
+	mux.HandleFunc("/ws/events", events.HandleWebSocket)
+	mux.HandleFunc("/ws/health", m.HealthWSHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	const clientsPerHub, rounds = 10, 3
+	hubs := map[string]string{telemetry.HubWS: "/ws", telemetry.HubEvents: "/ws/events", telemetry.HubHealth: "/ws/health"}
+
+	// Sample HealthStats throughout the churn.
+	done := make(chan struct{})
+	sampled := make(chan error, 1)
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			h := m.GetHealthStats()
+			var sum int64
+			for hubName, n := range h.Connections {
+				if n < 0 || n > clientsPerHub {
+					sampled <- fmt.Errorf("%s connections = %d, want 0-%d", hubName, n, clientsPerHub)
+					return
+				}
+				sum += n
+			}
+			if sum != h.ActiveConns {
+				sampled <- fmt.Errorf("active_connections = %d, per-hub counts add up to %d", h.ActiveConns, sum)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	for round := 0; round < rounds; round++ {
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			conns []*websocket.Conn
+		)
+		for _, path := range hubs {
+			for i := 0; i < clientsPerHub; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c, _, err := websocket.Dial(ctx, base+path, nil)
+					if err != nil {
+						t.Errorf("dial %s: %v", path, err)
+						return
+					}
+					mu.Lock()
+					conns = append(conns, c)
+					mu.Unlock()
+				}()
+			}
+		}
+		wg.Wait()
+		waitForConnections(t, m, clientsPerHub)
+
+		for _, c := range conns {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.CloseNow()
+			}()
+		}
+		wg.Wait()
+		waitForConnections(t, m, 0)
+	}
+
+	close(done)
+	if err := <-sampled; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestKeepalivePrunesUnresponsiveClients connects a client that reads, and so answers
+// pings, and one that stops reading to each of /ws, /ws/events and /ws/health, and
+// checks that only the silent ones are disconnected, within the idle timeout.
+func TestKeepalivePrunesUnresponsiveClients(t *testing.T) {
+	m := testMetrics()
+	keepalive := telemetry.Keepalive{Interval: 50 * time.Millisecond, IdleTimeout: 300 * time.Millisecond}
+	m.SetHealthKeepalive(keepalive)
+	t.Cleanup(func() { m.SetHealthKeepalive(telemetry.Keepalive{}) })
+
+	events := NewEventHub(&stubSource{}, func(count int) { m.SetActiveConnections(telemetry.HubEvents, count) })
+	events.SetLegacyConnectionCallback(func(count int) { m.SetActiveConnections(telemetry.HubWS, count) })
+	events.SetKeepalive(keepalive)
+	defer events.Stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", events.HandleLegacyWebSocket)
+	mux.HandleFunc("/ws/events", events.HandleWebSocket)
+	mux.HandleFunc("/ws/health", m.HealthWSHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var conns []*websocket.Conn
+	for _, path := range []string{"/ws", "/ws/events", "/ws/health"} {
+		responsive, _, err := websocket.Dial(ctx, base+path, nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", path, err)
+		}
+		go func() {
+			for {
+				if _, _, err := responsive.Read(ctx); err != nil {
+					return
+				}
+			}
+		}()
+		silent, _, err := websocket.Dial(ctx, base+path, nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", path, err)
+		}
+		conns = append(conns, responsive, silent)
+	}
+	defer func() {
+		for _, c := range conns {
+			c.CloseNow()
+		}
+	}()
+	waitForConnections(t, m, 2)
+
+	start := time.Now()
+	waitForConnections(t, m, 1)
+	if elapsed := time.Since(start); elapsed > keepalive.IdleTimeout+time.Second {
+		t.Errorf("silent clients pruned after %v, want within the %v idle timeout", elapsed, keepalive.IdleTimeout)
+	}
+	if n := len(events.Clients()); n != 2 {
+		t.Errorf("%d clients registered with the event hub, want the 2 responsive ones", n)
+	}
+
+	// Clients answering pings stay connected past the idle timeout.
+	time.Sleep(3 * keepalive.IdleTimeout)
+	waitForConnections(t, m, 1)
+}
+
+// waitForConnections waits until every hub reports want clients.
+func waitForConnections(t *testing.T, m *telemetry.Metrics, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h := m.GetHealthStats()
+		ok := h.ActiveConns == 3*want
+		for _, n := range h.Connections {
+			ok = ok && n == want
+		}
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connections = %v (total %d), want %d per hub", h.Connections, h.ActiveConns, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
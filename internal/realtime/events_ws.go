@@ -3,66 +3,173 @@ package realtime
 import (
 	"context"
 	"encoding/json"
-	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
 	"github.com/coder/websocket"
 	"golang.org/x/sync/errgroup"
 )
 
+// snapshotTimeout bounds the queries behind one snapshot, so a slow database delays
+// a broadcast instead of piling up snapshot work behind it.
+const snapshotTimeout = 10 * time.Second
+
+// maxBatchSize is the number of buffered logs, metrics or traces that triggers a
+// batch flush ahead of the batch interval.
+const maxBatchSize = 100
+
+// clientQueueSize is how many messages may wait for a client's writer before the
+// client is dropped as too slow.
+const clientQueueSize = 256
+
+// Defaults for SetSnapshotLimits and SetIdleRefresh.
+const (
+	defaultSnapshotWorkers  = 4
+	defaultSnapshotBudget   = 4 * time.Second
+	defaultIdleRefreshTicks = 6
+)
+
 // LiveSnapshot is the data payload pushed to all event WS clients.
 type LiveSnapshot struct {
 	Type       string                     `json:"type"`
 	Dashboard  *storage.DashboardStats    `json:"dashboard"`
 	Traffic    []storage.TrafficPoint     `json:"traffic"`
-	Traces     *storage.TracesResponse    `json:"traces"`
+	Traces     *storage.TracesResponse    `json:"traces,omitempty"` // bootstrap only; live updates arrive as "traces" batches
 	ServiceMap *storage.ServiceMapMetrics `json:"service_map"`
+	Seq        uint64                     `json:"seq"`              // last broadcast sequence number sent before this snapshot
+	Resync     bool                       `json:"resync,omitempty"` // since_seq could not be replayed; start over from this snapshot
+}
+
+// SnapshotSource is the storage the hub reads live snapshots from.
+type SnapshotSource interface {
+	storage.DashboardReader
+	storage.TraceReader
 }
 
-// clientFilter tracks a client's active service filter.
-// Empty string = all services (no filter).
+// clientFilter tracks a client's connection, tenant and active service and
+// environment filter. Empty string = all tenants, services or environments (no filter).
 type clientFilter struct {
+	conn    *websocket.Conn
+	stats   *clientStats
+	tenant  string // set from the API token; the client cannot change it
 	service string
+	env     string // deployment.environment
+	legacy  bool   // a /ws client: log and metric batches and AI insights only, without seq
+
+	// Messages wait in out for the client's writer goroutine, which starts once the
+	// bootstrap messages are written, so they always come first. Closing out lets the
+	// writer send what is queued and then close the connection with closeCode.
+	out         chan []byte
+	outMu       sync.Mutex
+	outClosed   bool
+	closeCode   websocket.StatusCode
+	closeReason string
+}
+
+func newClientFilter(conn *websocket.Conn, r *http.Request, tenantID, service string) *clientFilter {
+	return &clientFilter{
+		conn:    conn,
+		stats:   newClientStats(r),
+		tenant:  tenantID,
+		service: service,
+		out:     make(chan []byte, clientQueueSize),
+	}
 }
 
 // EventHub manages WebSocket clients and pushes live data snapshots
 // filtered per-client's selected service. Debounces rapid ingestion
-// bursts and only computes snapshots every flush interval.
+// bursts and only computes snapshots every flush interval. It also serves the
+// legacy /ws stream (see HandleLegacyWebSocket).
 type EventHub struct {
-	repo   *storage.Repository
-	onConn func()
-	onDisc func()
+	repo                     SnapshotSource
+	onConnectionChange       func(count int)     // called with the /ws/events client count whenever it changes
+	onLegacyConnectionChange func(count int)     // the same for /ws
+	onRefresh                func()              // called by NotifyRefresh, e.g. to invalidate cached stats
+	devMode                  bool                // /ws accepts cross-origin connections
+	keepalive                telemetry.Keepalive // pings of /ws and /ws/events clients
+
+	onMessageSent    func(msgType string) // a message of msgType was queued for at least one client
+	onSlowClientDrop func()               // a client was dropped because its queue filled up
+
+	// Periodic snapshots: at most snapshotWorkers service filters are computed at
+	// once, and a flush gives up on what is left after snapshotBudget.
+	snapshotWorkers   int
+	snapshotBudget    time.Duration
+	onSnapshotDone    func(d time.Duration) // called with each snapshot's computation time
+	onSnapshotSkipped func()                // called when a flush could not cover every filter
+
+	// Without ingest, snapshots are still pushed every idleRefreshTicks ticks (0: never)
+	// so the 15-minute window keeps sliding on an idle system.
+	idleRefreshTicks int
+
+	mu        sync.Mutex
+	clients   map[*websocket.Conn]*clientFilter
+	pending   bool
+	flushing  bool // a snapshot flush is in progress
+	idleTicks int  // ticks since the last flush
 
-	mu      sync.Mutex
-	clients map[*websocket.Conn]*clientFilter
-	pending bool
+	// The unfiltered bootstrap snapshot computed when Start begins, served to clients
+	// connecting within one snapshot interval of it.
+	baseline         *LiveSnapshot
+	baselineAt       time.Time
+	snapshotInterval time.Duration
+
+	// Broadcast messages (events and AI insights) carry a sequence number and are
+	// kept for replay to clients reconnecting with ?since_seq=.
+	seq    uint64
+	replay replayBuffer
 
 	// Real-time batching
 	logsCh       chan LogEntry
 	metricsCh    chan MetricEntry
+	tracesCh     chan TraceEntry
+	insightsCh   chan AIInsightMessage
 	logBuffer    []LogEntry
 	metricBuffer []MetricEntry
+	traceBuffer  []TraceEntry
+	logPool      sync.Pool
+	metricPool   sync.Pool
+	tracePool    sync.Pool
 
 	stopOnce sync.Once
 	stopCh   chan struct{}
+	started  atomic.Bool
+	done     chan struct{} // closed when Start returns
+	stopped  bool          // guarded by mu; no writers start after Stop
+	writers  sync.WaitGroup
 }
 
-// NewEventHub creates a new event notification hub.
-func NewEventHub(repo *storage.Repository, onConnect, onDisconnect func()) *EventHub {
-	return &EventHub{
-		repo:         repo,
-		onConn:       onConnect,
-		onDisc:       onDisconnect,
-		clients:      make(map[*websocket.Conn]*clientFilter),
-		logsCh:       make(chan LogEntry, 1000),
-		metricsCh:    make(chan MetricEntry, 1000),
-		logBuffer:    make([]LogEntry, 0, 100),
-		metricBuffer: make([]MetricEntry, 0, 100),
-		stopCh:       make(chan struct{}),
+// NewEventHub creates a new event notification hub. onConnectionChange, if not nil,
+// receives the number of connected clients after each connect and disconnect.
+func NewEventHub(repo SnapshotSource, onConnectionChange func(count int)) *EventHub {
+	h := &EventHub{
+		repo:               repo,
+		onConnectionChange: onConnectionChange,
+		snapshotWorkers:    defaultSnapshotWorkers,
+		snapshotBudget:     defaultSnapshotBudget,
+		idleRefreshTicks:   defaultIdleRefreshTicks,
+		clients:            make(map[*websocket.Conn]*clientFilter),
+		replay:             replayBuffer{size: defaultReplaySize, maxAge: defaultReplayMaxAge},
+		logsCh:             make(chan LogEntry, 1000),
+		metricsCh:          make(chan MetricEntry, 1000),
+		tracesCh:           make(chan TraceEntry, 1000),
+		insightsCh:         make(chan AIInsightMessage, 256),
+		stopCh:             make(chan struct{}),
+		done:               make(chan struct{}),
 	}
+	h.logPool.New = func() any { return make([]LogEntry, 0, maxBatchSize) }
+	h.metricPool.New = func() any { return make([]MetricEntry, 0, maxBatchSize) }
+	h.tracePool.New = func() any { return make([]TraceEntry, 0, maxBatchSize) }
+	h.logBuffer = h.logPool.Get().([]LogEntry)
+	h.metricBuffer = h.metricPool.Get().([]MetricEntry)
+	h.traceBuffer = h.tracePool.Get().([]TraceEntry)
+	return h
 }
 
 // Start begins the periodic flush loops. Call in a goroutine.
@@ -71,41 +178,145 @@ func (h *EventHub) Start(ctx context.Context, snapshotInterval, batchInterval ti
 	batchTicker := time.NewTicker(batchInterval)
 	defer snapshotTicker.Stop()
 	defer batchTicker.Stop()
+	h.started.Store(true)
+	defer close(h.done)
+
+	h.mu.Lock()
+	h.snapshotInterval = snapshotInterval
+	h.mu.Unlock()
+	go h.warmStart(ctx)
 
-	slog.Info("🌐 EventHub started",
+	logger.Info("🌐 EventHub started",
 		"snapshot_interval", snapshotInterval,
-		"batch_interval", batchInterval)
+		"batch_interval", batchInterval,
+		"idle_refresh_ticks", h.idleRefreshTicks)
 
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info("🌐 EventHub stopping via context...")
+			logger.Info("🌐 EventHub stopping via context...")
 			return
 		case <-h.stopCh:
-			slog.Info("🌐 EventHub stopping via signal...")
+			logger.Info("🌐 EventHub stopping via signal...")
+			h.drainBatches()
 			return
 		case <-snapshotTicker.C:
-			h.flushSnapshots()
+			// Flushed off the loop so batches keep flowing while snapshots compute.
+			go h.flushSnapshots()
 		case <-batchTicker.C:
 			h.flushBatches()
 		case entry := <-h.logsCh:
 			h.mu.Lock()
 			h.logBuffer = append(h.logBuffer, entry)
+			full := len(h.logBuffer) >= maxBatchSize
 			h.mu.Unlock()
+			if full {
+				h.flushBatches()
+			}
 		case entry := <-h.metricsCh:
 			h.mu.Lock()
 			h.metricBuffer = append(h.metricBuffer, entry)
+			full := len(h.metricBuffer) >= maxBatchSize
+			h.mu.Unlock()
+			if full {
+				h.flushBatches()
+			}
+		case entry := <-h.tracesCh:
+			h.mu.Lock()
+			h.traceBuffer = append(h.traceBuffer, entry)
+			full := len(h.traceBuffer) >= maxBatchSize
 			h.mu.Unlock()
+			if full {
+				h.flushBatches()
+			}
+		case msg := <-h.insightsCh:
+			h.sendInsight(msg)
 		}
 	}
 }
 
+// SetRefreshCallback sets the function called whenever NotifyRefresh reports new data.
+func (h *EventHub) SetRefreshCallback(cb func()) {
+	h.onRefresh = cb
+}
+
+// SetLegacyConnectionCallback sets the function that receives the number of /ws
+// clients after each connect and disconnect.
+func (h *EventHub) SetLegacyConnectionCallback(cb func(count int)) {
+	h.onLegacyConnectionChange = cb
+}
+
+// SetDevMode controls whether /ws accepts cross-origin connections. Should be true
+// only in development environments.
+func (h *EventHub) SetDevMode(devMode bool) {
+	h.devMode = devMode
+}
+
+// SetKeepalive sets how /ws and /ws/events clients are pinged; clients that stop
+// answering are disconnected and unregistered like any other. Call it before
+// serving requests.
+func (h *EventHub) SetKeepalive(k telemetry.Keepalive) {
+	h.keepalive = k
+}
+
+// SetWSMetrics wires the callbacks counting broadcast messages by type and clients
+// dropped for falling behind.
+func (h *EventHub) SetWSMetrics(onMessageSent func(string), onSlowClientDrop func()) {
+	h.onMessageSent = onMessageSent
+	h.onSlowClientDrop = onSlowClientDrop
+}
+
+// SetSnapshotLimits bounds the periodic snapshot work: at most workers distinct
+// service filters are computed concurrently, and a flush cancels whatever is still
+// running or queued after budget. Non-positive values keep the defaults (4, 4s).
+func (h *EventHub) SetSnapshotLimits(workers int, budget time.Duration) {
+	if workers > 0 {
+		h.snapshotWorkers = workers
+	}
+	if budget > 0 {
+		h.snapshotBudget = budget
+	}
+}
+
+// SetIdleRefresh sets after how many snapshot ticks without new data snapshots are
+// pushed anyway, so the dashboards of an idle system see their window move. 0 turns
+// this off; a negative value keeps the default (6).
+func (h *EventHub) SetIdleRefresh(ticks int) {
+	if ticks >= 0 {
+		h.idleRefreshTicks = ticks
+	}
+}
+
+// SetSnapshotMetrics sets the callbacks that observe each snapshot's computation
+// time and count flushes that were skipped or cut short.
+func (h *EventHub) SetSnapshotMetrics(done func(d time.Duration), skipped func()) {
+	h.onSnapshotDone = done
+	h.onSnapshotSkipped = skipped
+}
+
+// SetReplayBuffer sets how many recent broadcast messages are kept for clients that
+// reconnect with ?since_seq=, and for how long. A size of 0 keeps none, so every
+// resume becomes a resync; a non-positive maxAge keeps the default (5m).
+func (h *EventHub) SetReplayBuffer(size int, maxAge time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size >= 0 {
+		h.replay.size = size
+	}
+	if maxAge > 0 {
+		h.replay.maxAge = maxAge
+	}
+}
+
 // notifyRefresh marks that new data has arrived. The actual snapshot
 // happens on the next snapshotTicker flush.
 func (h *EventHub) NotifyRefresh() {
 	h.mu.Lock()
 	h.pending = true
 	h.mu.Unlock()
+	if h.onRefresh != nil {
+		h.onRefresh()
+	}
 }
 
 // BroadcastLog adds a log entry to the real-time buffer.
@@ -124,240 +335,783 @@ func (h *EventHub) BroadcastMetric(m MetricEntry) {
 	}
 }
 
+// BroadcastTrace adds a new trace summary to the real-time buffer.
+func (h *EventHub) BroadcastTrace(t TraceEntry) {
+	select {
+	case h.tracesCh <- t:
+	default:
+	}
+}
+
+// BroadcastInsight queues an AI insight notification. Dropped if the queue is full
+// so slow AI analysis or slow clients never back up the caller.
+func (h *EventHub) BroadcastInsight(msg AIInsightMessage) {
+	select {
+	case h.insightsCh <- msg:
+	default:
+	}
+}
+
+// BroadcastLogInsight queues the AI insight saved for l; it is the insight callback
+// of the AI service.
+func (h *EventHub) BroadcastLogInsight(l storage.Log, insight string) {
+	msg := NewAIInsightMessage(l.ID, l.TraceID, l.ServiceName, insight)
+	msg.TenantID = l.TenantID
+	h.BroadcastInsight(msg)
+}
+
+// BroadcastEvent pushes a one-off typed message (e.g. "slo_breach") to every client
+// whose service filter matches service. An empty service matches all clients; the
+// environment filter does not apply, as events are not tied to an environment.
+// The message is only queued for each client's writer, so callers never block on
+// slow clients. It is kept for replay whether or not any client is connected.
+//
+// Events sent this way are instance-wide: with multi-tenancy on, only clients
+// connected with the super-admin token receive them.
+func (h *EventHub) BroadcastEvent(eventType, service string, data interface{}) {
+	h.BroadcastTenantEvent("", eventType, service, data)
+}
+
+// BroadcastTenantEvent is BroadcastEvent for an event about one tenant's data. It
+// reaches that tenant's clients and the unscoped ones.
+func (h *EventHub) BroadcastTenantEvent(tenantID, eventType, service string, data interface{}) {
+	h.publish(eventType, tenantID, service, func(seq uint64) ([]byte, error) {
+		return json.Marshal(HubBatch{Type: eventType, Data: data, Seq: seq})
+	})
+}
+
+// publish assigns the next sequence number to a broadcast message for service, keeps
+// the encoded message for replay and queues it for the matching /ws/events clients.
+// Queueing under the lock keeps every client's messages in sequence order.
+func (h *EventHub) publish(msgType, tenantID, service string, encode func(seq uint64) ([]byte, error)) {
+	h.mu.Lock()
+	msg, err := encode(h.seq + 1)
+	if err != nil {
+		h.mu.Unlock()
+		logger.Error("Event WS marshal failed", "error", err)
+		return
+	}
+	h.seq++
+	h.replay.add(replayEntry{seq: h.seq, at: time.Now(), tenant: tenantID, service: service, msg: msg})
+
+	queued := false
+	var slow []*clientFilter
+	for _, cf := range h.clients {
+		if cf.legacy || !cf.matches(tenantID, service) {
+			continue
+		}
+		if cf.push(msg) {
+			queued = true
+		} else {
+			slow = append(slow, cf)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, cf := range slow {
+		h.dropSlow(cf)
+	}
+	if queued {
+		h.reportSent(msgType)
+	}
+}
+
+// matches reports whether a message about tenantID's service is meant for this
+// client.
+func (cf *clientFilter) matches(tenantID, service string) bool {
+	return cf.key().matches(tenantID, service)
+}
+
+// key returns the client's filter.
+func (cf *clientFilter) key() filterKey {
+	return filterKey{tenant: cf.tenant, env: cf.env, service: cf.service}
+}
+
+// hub names the endpoint the client is connected to, as in ClientInfo.
+func (cf *clientFilter) hub() string {
+	if cf.legacy {
+		return "ws"
+	}
+	return "events"
+}
+
 // HandleWebSocket upgrades an HTTP request to a WebSocket connection,
 // registers it as an event client, and listens for filter messages.
+//
+// A client reconnecting with ?since_seq=<last seq it received> is sent the
+// broadcasts it missed after its bootstrap snapshot and before any new ones. When
+// they are no longer buffered, the snapshot carries "resync": true instead.
+//
+// With multi-tenancy on, the client only receives its token's tenant's data. A client
+// that stops answering pings is disconnected (see SetKeepalive).
+//
+// The filter is set with the service and env query parameters, and changed by
+// sending {"service": "...", "environment": "..."}; an empty or missing field
+// removes that part of the filter.
 func (h *EventHub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		InsecureSkipVerify: true,
 	})
 	if err != nil {
-		slog.Error("Event WS accept failed", "error", err)
+		logger.Error("Event WS accept failed", "error", err)
 		return
 	}
 
-	// Check for initial service filter from query params
-	initialService := r.URL.Query().Get("service")
-	h.addClient(conn, initialService)
+	// Check for initial service and environment filter from query params
+	cf := newClientFilter(conn, r, tenant.Scope(r.Context()), r.URL.Query().Get("service"))
+	cf.env = r.URL.Query().Get("env")
+	if v := r.URL.Query().Get("since_seq"); v != "" {
+		h.resumeClient(cf, v)
+	} else {
+		seq := h.addClient(cf)
+		// Send immediate snapshot (including the recent trace list) so the client has data right away
+		h.sendSnapshotTo(cf, seq, false)
+	}
+	// Broadcasts queued meanwhile follow the bootstrap messages.
+	h.startWriter(cf)
 
-	// Send immediate snapshot so the client has data right away
-	h.sendSnapshotTo(conn, initialService)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go h.keepalive.Run(ctx, conn)
 
-	// Read loop: client can send {"service":"xxx"} to change filter
+	// Read loop: client can send {"service":"xxx","environment":"yyy"} to change filter
 	for {
-		_, msg, readErr := conn.Read(r.Context())
+		_, msg, readErr := conn.Read(ctx)
 		if readErr != nil {
 			break
 		}
 		var filterMsg struct {
-			Service string `json:"service"`
+			Service     string `json:"service"`
+			Environment string `json:"environment"`
 		}
 		if json.Unmarshal(msg, &filterMsg) == nil {
-			h.updateClientFilter(conn, filterMsg.Service)
+			h.updateClientFilter(conn, filterMsg.Service, filterMsg.Environment)
 		}
 	}
 
 	h.removeClient(conn)
-	conn.Close(websocket.StatusNormalClosure, "bye")
+	cf.closeOut(websocket.StatusNormalClosure, "bye")
+}
+
+// addClient registers a client and returns the sequence number of the last
+// broadcast it will not receive.
+func (h *EventHub) addClient(cf *clientFilter) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[cf.conn] = cf
+	h.reportConnections(cf.legacy)
+	return h.seq
 }
 
-func (h *EventHub) addClient(c *websocket.Conn, service string) {
+// resumeClient registers a reconnecting client and sends it a bootstrap snapshot
+// followed by the buffered broadcasts after sinceSeq, or a resync snapshot when they
+// are gone. Broadcasts published meanwhile wait in the client's queue.
+func (h *EventHub) resumeClient(cf *clientFilter, sinceSeq string) {
 	h.mu.Lock()
-	h.clients[c] = &clientFilter{service: service}
+	h.clients[cf.conn] = cf
+	h.reportConnections(false)
+	var missed []replayEntry
+	seq, err := strconv.ParseUint(sinceSeq, 10, 64)
+	ok := err == nil
+	if ok {
+		missed, ok = h.replay.since(seq, h.seq, time.Now())
+	}
+	latest := h.seq
 	h.mu.Unlock()
-	if h.onConn != nil {
-		h.onConn()
+
+	h.sendSnapshotTo(cf, latest, !ok)
+	for _, e := range missed {
+		if cf.matches(e.tenant, e.service) && !h.write(cf, e.msg) {
+			return
+		}
 	}
 }
 
-func (h *EventHub) removeClient(c *websocket.Conn) {
+// removeClient unregisters a client. It reports whether the client was registered.
+func (h *EventHub) removeClient(c *websocket.Conn) bool {
 	h.mu.Lock()
+	defer h.mu.Unlock()
+	cf, ok := h.clients[c]
+	if !ok {
+		return false
+	}
 	delete(h.clients, c)
-	h.mu.Unlock()
-	if h.onDisc != nil {
-		h.onDisc()
+	h.reportConnections(cf.legacy)
+	return true
+}
+
+// reportConnections passes the number of /ws clients (legacy) or /ws/events clients
+// to its callback. Callers hold h.mu, so counts are reported in the order they
+// changed.
+func (h *EventHub) reportConnections(legacy bool) {
+	cb := h.onConnectionChange
+	if legacy {
+		cb = h.onLegacyConnectionChange
+	}
+	if cb == nil {
+		return
+	}
+	n := 0
+	for _, cf := range h.clients {
+		if cf.legacy == legacy {
+			n++
+		}
 	}
+	cb(n)
 }
 
-func (h *EventHub) updateClientFilter(c *websocket.Conn, service string) {
+func (h *EventHub) updateClientFilter(c *websocket.Conn, service, env string) {
 	h.mu.Lock()
 	if cf, ok := h.clients[c]; ok {
-		cf.service = service
+		cf.service, cf.env = service, env
 	}
 	h.mu.Unlock()
 }
 
-// flushSnapshots computes per-service snapshots in parallel and pushes to matching clients.
+// flushSnapshots computes per-service snapshots in parallel and pushes to matching
+// clients. Only one flush runs at a time: a tick that finds the previous flush still
+// computing is skipped. So are the service filters a flush could not finish within
+// the snapshot budget. Either way pending stays set, so the next tick retries.
+// Without new data, every idleRefreshTicks-th tick flushes as if there were some.
 func (h *EventHub) flushSnapshots() {
 	h.mu.Lock()
+	if !h.pending && h.idleRefreshTicks > 0 {
+		h.idleTicks++
+		h.pending = h.idleTicks >= h.idleRefreshTicks
+	}
 	if !h.pending {
 		h.mu.Unlock()
 		return
 	}
+	if h.flushing {
+		h.mu.Unlock()
+		logger.Debug("Live snapshot tick skipped, previous flush still running")
+		h.reportSnapshotSkipped()
+		return
+	}
 	h.pending = false
+	h.idleTicks = 0
 
 	if len(h.clients) == 0 {
 		h.mu.Unlock()
 		return
 	}
 
-	// Group clients by service filter
-	groups := make(map[string][]*websocket.Conn)
-	for c, cf := range h.clients {
-		groups[cf.service] = append(groups[cf.service], c)
+	// Group clients by filter. /ws clients get no snapshots.
+	groups := make(map[filterKey][]*clientFilter)
+	for _, cf := range h.clients {
+		if !cf.legacy {
+			groups[cf.key()] = append(groups[cf.key()], cf)
+		}
 	}
+	if len(groups) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	seq := h.seq
+	h.flushing = true
 	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.flushing = false
+		h.mu.Unlock()
+	}()
 
-	// Compute snapshots in parallel using errgroup
-	g, ctx := errgroup.WithContext(context.Background())
-	snapshotMap := make(map[string]*LiveSnapshot)
+	// Compute snapshots with bounded concurrency; the budget cancels the stragglers.
+	ctx, cancel := context.WithTimeout(context.Background(), h.snapshotBudget)
+	defer cancel()
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(h.snapshotWorkers)
+	snapshotMap := make(map[filterKey]*LiveSnapshot)
 	var snapMu sync.Mutex
 
-	for service := range groups {
-		service := service // Capture
+	for key := range groups {
 		g.Go(func() error {
-			snap := h.computeSnapshot(service)
+			if gctx.Err() != nil {
+				return nil // budget spent while queued
+			}
+			started := time.Now()
+			snap := h.computeSnapshot(gctx, key, false)
+			if h.onSnapshotDone != nil {
+				h.onSnapshotDone(time.Since(started))
+			}
 			if snap != nil {
 				snapMu.Lock()
-				snapshotMap[service] = snap
+				snapshotMap[key] = snap
 				snapMu.Unlock()
 			}
 			return nil
 		})
 	}
+	g.Wait()
 
-	if err := g.Wait(); err != nil {
-		slog.Error("❌ Parallel snapshot computation failed", "error", err)
+	if len(snapshotMap) < len(groups) {
+		logger.Warn("Live snapshot budget exceeded, retrying the rest next tick",
+			"computed", len(snapshotMap), "filters", len(groups), "budget", h.snapshotBudget)
+		h.mu.Lock()
+		h.pending = true
+		h.mu.Unlock()
+		h.reportSnapshotSkipped()
 	}
 
 	// Broadcast memoized snapshots to matching clients
-	for service, clients := range groups {
-		snap, ok := snapshotMap[service]
+	queued := false
+	for key, clients := range groups {
+		snap, ok := snapshotMap[key]
 		if !ok {
 			continue
 		}
 
+		snap.Seq = seq
 		msg, err := json.Marshal(snap)
 		if err != nil {
-			slog.Error("Event WS marshal failed", "error", err)
+			logger.Error("Event WS marshal failed", "error", err)
 			continue
 		}
 
-		for _, conn := range clients {
-			writeCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
-			if err := conn.Write(writeCtx, websocket.MessageText, msg); err != nil {
-				slog.Debug("Event WS send failed, removing client", "error", err)
-				h.removeClient(conn)
-				conn.Close(websocket.StatusGoingAway, "write error")
-			}
-			cancel()
+		for _, cf := range clients {
+			queued = h.deliver(cf, msg) || queued
 		}
 	}
+	if queued {
+		h.reportSent("live_snapshot")
+	}
+}
+
+// filterKey identifies the clients that share snapshots and batches.
+type filterKey struct {
+	tenant  string
+	env     string
+	service string
 }
 
-// flushBatches flushes buffered logs and metrics to clients, respecting filters.
+// matches reports whether a message about tenantID's service is meant for clients
+// with this filter. An empty service on either side matches every service, but a
+// client scoped to a tenant only receives messages for that tenant.
+func (k filterKey) matches(tenantID, service string) bool {
+	if k.tenant != "" && k.tenant != tenantID {
+		return false
+	}
+	return service == "" || k.service == "" || k.service == service
+}
+
+// matchesData is matches for data ingested from env: with an environment filter,
+// data from other environments or without one is not meant for the clients.
+func (k filterKey) matchesData(tenantID, env, service string) bool {
+	return (k.env == "" || k.env == env) && k.matches(tenantID, service)
+}
+
+func (h *EventHub) reportSnapshotSkipped() {
+	if h.onSnapshotSkipped != nil {
+		h.onSnapshotSkipped()
+	}
+}
+
+// flushBatches flushes buffered logs, metrics and trace summaries to clients, respecting
+// filters. Clients with the same filter share the encoded batches; /ws clients get
+// the logs and metrics only.
 func (h *EventHub) flushBatches() {
 	h.mu.Lock()
 	logs := h.logBuffer
-	h.logBuffer = make([]LogEntry, 0, 100)
+	h.logBuffer = h.logPool.Get().([]LogEntry)
 	metrics := h.metricBuffer
-	h.metricBuffer = make([]MetricEntry, 0, 100)
-	clients := make(map[*websocket.Conn]*clientFilter)
-	for c, cf := range h.clients {
-		clients[c] = cf
+	h.metricBuffer = h.metricPool.Get().([]MetricEntry)
+	traces := h.traceBuffer
+	h.traceBuffer = h.tracePool.Get().([]TraceEntry)
+	type target struct {
+		cf  *clientFilter
+		key filterKey
+	}
+	targets := make([]target, 0, len(h.clients))
+	for _, cf := range h.clients {
+		targets = append(targets, target{cf: cf, key: cf.key()})
 	}
 	h.mu.Unlock()
+	defer func() {
+		h.logPool.Put(logs[:0])
+		h.metricPool.Put(metrics[:0])
+		h.tracePool.Put(traces[:0])
+	}()
 
-	if len(logs) == 0 && len(metrics) == 0 {
+	if len(logs) == 0 && len(metrics) == 0 && len(traces) == 0 {
 		return
 	}
 
-	for conn, filter := range clients {
-		// 1. Filter Logs
-		clientLogs := make([]LogEntry, 0)
-		for _, l := range logs {
-			if filter.service == "" || filter.service == l.ServiceName {
-				clientLogs = append(clientLogs, l)
+	type batches struct{ logs, metrics, traces []byte }
+	encoded := make(map[filterKey]batches)
+	var sentLogs, sentMetrics, sentTraces bool
+	for _, t := range targets {
+		b, ok := encoded[t.key]
+		if !ok {
+			key := t.key
+			b = batches{
+				logs: encodeBatch("logs", logs, func(l LogEntry) bool { return key.matchesData(l.TenantID, l.Environment, l.ServiceName) }),
+				// Metrics carry no environment; the environment filter passes them all.
+				metrics: encodeBatch("metrics", metrics, func(m MetricEntry) bool { return key.matches(m.TenantID, m.ServiceName) }),
+				traces:  encodeBatch("traces", traces, func(e TraceEntry) bool { return key.matchesData(e.TenantID, e.Environment, e.ServiceName) }),
 			}
+			encoded[t.key] = b
+		}
+		if b.logs != nil {
+			sentLogs = h.deliver(t.cf, b.logs) || sentLogs
 		}
+		if b.metrics != nil {
+			sentMetrics = h.deliver(t.cf, b.metrics) || sentMetrics
+		}
+		if b.traces != nil && !t.cf.legacy {
+			sentTraces = h.deliver(t.cf, b.traces) || sentTraces
+		}
+	}
+	if sentLogs {
+		h.reportSent("logs")
+	}
+	if sentMetrics {
+		h.reportSent("metrics")
+	}
+	if sentTraces {
+		h.reportSent("traces")
+	}
+}
 
-		// 2. Filter Metrics
-		clientMetrics := make([]MetricEntry, 0)
-		for _, m := range metrics {
-			if filter.service == "" || filter.service == m.ServiceName {
-				clientMetrics = append(clientMetrics, m)
-			}
+// encodeBatch encodes the entries for which match is true as a batch of batchType.
+// It returns nil when there are none.
+func encodeBatch[E any](batchType string, entries []E, match func(E) bool) []byte {
+	matched := make([]E, 0)
+	for _, e := range entries {
+		if match(e) {
+			matched = append(matched, e)
 		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	msg, err := json.Marshal(HubBatch{Type: batchType, Data: matched})
+	if err != nil {
+		logger.Error("Event WS marshal failed", "error", err, "type", batchType)
+		return nil
+	}
+	return msg
+}
+
+// sendInsight delivers an AI insight to clients whose service filter matches the log's
+// service. /ws clients get it without a sequence number, as before /ws/events existed.
+func (h *EventHub) sendInsight(msg AIInsightMessage) {
+	h.publish(msg.Type, msg.TenantID, msg.ServiceName, func(seq uint64) ([]byte, error) {
+		msg.Seq = seq
+		return json.Marshal(msg)
+	})
 
-		// 3. Send Batches
-		if len(clientLogs) > 0 {
-			h.sendBatch(conn, "logs", clientLogs)
+	msg.Seq = 0
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Event WS marshal failed", "error", err)
+		return
+	}
+	h.mu.Lock()
+	var targets []*clientFilter
+	for _, cf := range h.clients {
+		if cf.legacy && cf.matches(msg.TenantID, msg.ServiceName) {
+			targets = append(targets, cf)
 		}
-		if len(clientMetrics) > 0 {
-			h.sendBatch(conn, "metrics", clientMetrics)
+	}
+	h.mu.Unlock()
+	queued := false
+	for _, cf := range targets {
+		queued = h.deliver(cf, data) || queued
+	}
+	if queued {
+		h.reportSent(msg.Type)
+	}
+}
+
+// deliver queues msg for the client, dropping the client if it cannot keep up. It
+// reports whether msg was queued.
+func (h *EventHub) deliver(cf *clientFilter, msg []byte) bool {
+	if cf.push(msg) {
+		return true
+	}
+	h.dropSlow(cf)
+	return false
+}
+
+// push queues msg for the client's writer without blocking. It returns false only
+// when the queue is full; a message for a client that is closing is discarded.
+func (cf *clientFilter) push(msg []byte) bool {
+	cf.outMu.Lock()
+	defer cf.outMu.Unlock()
+	if cf.outClosed {
+		return true
+	}
+	select {
+	case cf.out <- msg:
+		return true
+	default:
+		cf.stats.dropped.Add(1)
+		return false
+	}
+}
+
+// dropSlow removes a client whose queue filled up. Its writer still sends what is
+// queued before closing the connection.
+func (h *EventHub) dropSlow(cf *clientFilter) {
+	if !h.removeClient(cf.conn) {
+		return // already dropped by another broadcast
+	}
+	logger.Warn("Slow WebSocket client removed", "id", cf.stats.id, "hub", cf.hub())
+	if h.onSlowClientDrop != nil {
+		h.onSlowClientDrop()
+	}
+	cf.closeOut(websocket.StatusGoingAway, "too slow")
+}
+
+// closeOut closes the client's queue. Its writer sends what is queued, then closes
+// the connection with code and reason.
+func (cf *clientFilter) closeOut(code websocket.StatusCode, reason string) {
+	cf.outMu.Lock()
+	defer cf.outMu.Unlock()
+	if cf.outClosed {
+		return
+	}
+	cf.outClosed = true
+	cf.closeCode, cf.closeReason = code, reason
+	close(cf.out)
+}
+
+func (h *EventHub) reportSent(msgType string) {
+	if h.onMessageSent != nil {
+		h.onMessageSent(msgType)
+	}
+}
+
+// startWriter starts the goroutine writing the client's queued messages, or closes
+// the connection if the hub has stopped.
+func (h *EventHub) startWriter(cf *clientFilter) {
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+		cf.conn.Close(websocket.StatusGoingAway, "server shutting down")
+		return
+	}
+	h.writers.Add(1)
+	h.mu.Unlock()
+	go h.writeLoop(cf)
+}
+
+func (h *EventHub) writeLoop(cf *clientFilter) {
+	defer h.writers.Done()
+	for msg := range cf.out {
+		if !h.write(cf, msg) {
+			return
 		}
 	}
+	cf.outMu.Lock()
+	code, reason := cf.closeCode, cf.closeReason
+	cf.outMu.Unlock()
+	cf.conn.Close(code, reason)
 }
 
-func (h *EventHub) sendBatch(conn *websocket.Conn, batchType string, data interface{}) {
-	msg, _ := json.Marshal(HubBatch{Type: batchType, Data: data})
+// write sends msg to the client, dropping the client if that fails. It reports
+// whether the write succeeded. Only the bootstrap path and the client's writer call
+// it, one after the other.
+func (h *EventHub) write(cf *clientFilter, msg []byte) bool {
+	if err := cf.send(msg); err != nil {
+		logger.Debug("Event WS send failed, removing client", "error", err)
+		h.removeClient(cf.conn)
+		cf.closeOut(websocket.StatusGoingAway, "write error")
+		cf.conn.Close(websocket.StatusGoingAway, "write error")
+		return false
+	}
+	return true
+}
+
+// send writes msg to the client's connection and records it in the client's stats.
+func (cf *clientFilter) send(msg []byte) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	if err := conn.Write(ctx, websocket.MessageText, msg); err != nil {
-		h.removeClient(conn)
-		conn.Close(websocket.StatusGoingAway, "write error")
+	start := time.Now()
+	if err := cf.conn.Write(ctx, websocket.MessageText, msg); err != nil {
+		cf.stats.dropped.Add(1)
+		return err
+	}
+	cf.stats.wrote(time.Since(start))
+	return nil
+}
+
+// Clients lists the connected clients.
+func (h *EventHub) Clients() []ClientInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := make([]ClientInfo, 0, len(h.clients))
+	for _, cf := range h.clients {
+		clients = append(clients, cf.stats.info(cf.hub(), cf.tenant, cf.service, cf.env))
 	}
+	return clients
 }
 
-// sendSnapshotTo sends a snapshot to a single client.
-func (h *EventHub) sendSnapshotTo(conn *websocket.Conn, service string) {
-	snapshot := h.computeSnapshot(service)
+// Disconnect closes the connection of the client with the given ID. It reports
+// whether such a client was connected.
+func (h *EventHub) Disconnect(id string) bool {
+	h.mu.Lock()
+	var target *clientFilter
+	for _, cf := range h.clients {
+		if cf.stats.id == id {
+			target = cf
+			break
+		}
+	}
+	h.mu.Unlock()
+	if target == nil {
+		return false
+	}
+	go target.conn.Close(websocket.StatusPolicyViolation, "disconnected by admin")
+	return true
+}
+
+// sendSnapshotTo sends a bootstrap snapshot (with the recent trace list) to a single
+// client. seq is the last broadcast the client is not sent separately; resync marks
+// the snapshot as replacing broadcasts that could not be replayed.
+func (h *EventHub) sendSnapshotTo(cf *clientFilter, seq uint64, resync bool) {
+	key := cf.key()
+	snapshot := h.cachedBaseline(key)
+	if snapshot == nil {
+		queryCtx, cancelQuery := context.WithTimeout(context.Background(), snapshotTimeout)
+		defer cancelQuery()
+		snapshot = h.computeSnapshot(queryCtx, key, true)
+	}
 	if snapshot == nil {
 		return
 	}
+	snapshot.Seq, snapshot.Resync = seq, resync
 	msg, err := json.Marshal(snapshot)
 	if err != nil {
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	h.write(cf, msg)
+}
+
+// warmStart computes the unfiltered bootstrap snapshot as soon as the hub starts.
+// The dashboards reconnecting after a restart share it rather than each querying the
+// whole window, and the first tick pushes fresh snapshots without waiting for ingest.
+func (h *EventHub) warmStart(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
 	defer cancel()
-	conn.Write(ctx, websocket.MessageText, msg)
+	started := time.Now()
+	snap := h.computeSnapshot(ctx, filterKey{}, true)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending = true
+	if snap == nil {
+		logger.Warn("🌐 EventHub warm-start snapshot not computed", "error", ctx.Err())
+		return
+	}
+	h.baseline, h.baselineAt = snap, time.Now()
+	logger.Info("🌐 EventHub warm-start snapshot cached", "duration", time.Since(started))
+}
+
+// cachedBaseline returns a copy of the warm-start snapshot for an unfiltered client,
+// or nil when the client is filtered or the snapshot is older than one interval.
+func (h *EventHub) cachedBaseline(key filterKey) *LiveSnapshot {
+	if key != (filterKey{}) {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.baseline == nil || time.Since(h.baselineAt) >= h.snapshotInterval {
+		return nil
+	}
+	snap := *h.baseline
+	return &snap
 }
 
-// computeSnapshot queries the DB for the last 15 minutes of data,
-// optionally filtered by a single service name.
-func (h *EventHub) computeSnapshot(service string) *LiveSnapshot {
+// computeSnapshot queries the DB for the last 15 minutes of data matching key:
+// of one tenant or all, optionally of one environment and a single service name.
+// The 25-row trace list is only included for bootstrap; afterwards clients receive
+// incremental "traces" batches. It returns nil if ctx ends first, rather than a
+// partial snapshot.
+func (h *EventHub) computeSnapshot(ctx context.Context, key filterKey, includeTraces bool) *LiveSnapshot {
+	repo := h.repo
+	if scoper, ok := repo.(storage.TenantScoper); ok && key.tenant != "" {
+		repo = scoper.ForTenant(key.tenant)
+	}
+	if scoper, ok := repo.(storage.EnvironmentScoper); ok && key.env != "" {
+		repo = scoper.ForEnvironment(key.env)
+	}
+
 	now := time.Now()
 	start := now.Add(-15 * time.Minute)
 
 	var serviceNames []string
-	if service != "" {
-		serviceNames = []string{service}
+	if key.service != "" {
+		serviceNames = []string{key.service}
 	}
 
 	snapshot := &LiveSnapshot{Type: "live_snapshot"}
 
-	if stats, err := h.repo.GetDashboardStats(start, now, serviceNames); err == nil {
+	if stats, err := repo.GetDashboardStatsContext(ctx, start, now, serviceNames); err == nil {
 		snapshot.Dashboard = stats
 	}
 
-	if traffic, err := h.repo.GetTrafficMetrics(start, now, serviceNames); err == nil {
+	if traffic, err := repo.GetTrafficMetrics(start, now, serviceNames); err == nil {
 		snapshot.Traffic = traffic
 	}
 
-	if traces, err := h.repo.GetTracesFiltered(start, now, serviceNames, "", "", 25, 0, "timestamp", "desc"); err == nil {
-		snapshot.Traces = traces
+	if includeTraces {
+		if traces, err := repo.GetTracesFilteredContext(ctx, start, now, serviceNames, "", "", 25, 0, "timestamp", "desc"); err == nil {
+			snapshot.Traces = traces
+		}
 	}
 
-	if smap, err := h.repo.GetServiceMapMetrics(start, now); err == nil {
+	if smap, err := repo.GetServiceMapMetricsContext(ctx, start, now); err == nil {
 		snapshot.ServiceMap = smap
 	}
 
+	if ctx.Err() != nil {
+		return nil
+	}
 	return snapshot
 }
 
+// Stop ends Start after batching the logs, metrics and traces it has queued, lets
+// every client's writer send what is queued for it, and closes the connections with
+// a going-away close frame.
 func (h *EventHub) Stop() {
 	h.stopOnce.Do(func() {
 		close(h.stopCh)
+		if h.started.Load() {
+			<-h.done
+		}
+		h.mu.Lock()
+		h.stopped = true
+		clients := make([]*clientFilter, 0, len(h.clients))
+		for _, cf := range h.clients {
+			clients = append(clients, cf)
+		}
+		h.mu.Unlock()
+		for _, cf := range clients {
+			cf.closeOut(websocket.StatusGoingAway, "server shutting down")
+		}
+		h.writers.Wait()
+		logger.Info("🛑 WebSocket hubs stopped")
 	})
 }
 
+// drainBatches moves what is still queued on the entry channels into the batches and
+// sends them.
+func (h *EventHub) drainBatches() {
+	h.mu.Lock()
+	for {
+		select {
+		case entry := <-h.logsCh:
+			h.logBuffer = append(h.logBuffer, entry)
+		case entry := <-h.metricsCh:
+			h.metricBuffer = append(h.metricBuffer, entry)
+		case entry := <-h.tracesCh:
+			h.traceBuffer = append(h.traceBuffer, entry)
+		default:
+			h.mu.Unlock()
+			h.flushBatches()
+			return
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"github.com/coder/websocket"
+)
+
+// stubSource is a SnapshotSource standing in for an alternative backend. Methods the
+// hub does not call are left to the embedded nil interface.
+type stubSource struct {
+	SnapshotSource
+	mu         sync.Mutex // snapshots for concurrent clients call in parallel
+	services   [][]string
+	trafficErr error
+}
+
+func (s *stubSource) GetDashboardStatsContext(_ context.Context, start, end time.Time, serviceNames []string) (*storage.DashboardStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services = append(s.services, serviceNames)
+	return &storage.DashboardStats{TotalTraces: 42}, nil
+}
+
+func (s *stubSource) GetTrafficMetrics(start, end time.Time, serviceNames []string) ([]storage.TrafficPoint, error) {
+	if s.trafficErr != nil {
+		return nil, s.trafficErr
+	}
+	return []storage.TrafficPoint{{Count: 3}}, nil
+}
+
+func (s *stubSource) GetTracesFilteredContext(_ context.Context, start, end time.Time, serviceNames []string, status, search string, limit, offset int, sortBy, orderBy string) (*storage.TracesResponse, error) {
+	return &storage.TracesResponse{Total: 1}, nil
+}
+
+func (s *stubSource) GetServiceMapMetricsContext(_ context.Context, start, end time.Time) (*storage.ServiceMapMetrics, error) {
+	return &storage.ServiceMapMetrics{}, nil
+}
+
+func TestComputeSnapshotReadsFromSource(t *testing.T) {
+	src := &stubSource{}
+	h := NewEventHub(src, nil)
+
+	snap := h.computeSnapshot(context.Background(), filterKey{service: "checkout"}, true)
+	if snap.Dashboard == nil || snap.Dashboard.TotalTraces != 42 {
+		t.Errorf("dashboard = %+v", snap.Dashboard)
+	}
+	if len(snap.Traffic) != 1 || snap.Traces == nil || snap.ServiceMap == nil {
+		t.Errorf("snapshot = %+v, want traffic, traces and service map", snap)
+	}
+	if len(src.services) != 1 || len(src.services[0]) != 1 || src.services[0][0] != "checkout" {
+		t.Errorf("service filter passed to source = %v", src.services)
+	}
+
+	if snap := h.computeSnapshot(context.Background(), filterKey{}, false); snap.Traces != nil {
+		t.Error("traces included without bootstrap")
+	}
+}
+
+func TestComputeSnapshotSkipsFailedQueries(t *testing.T) {
+	h := NewEventHub(&stubSource{trafficErr: errors.New("backend down")}, nil)
+
+	snap := h.computeSnapshot(context.Background(), filterKey{}, false)
+	if snap.Traffic != nil {
+		t.Errorf("traffic = %v, want nil after a failed query", snap.Traffic)
+	}
+	if snap.Dashboard == nil || snap.ServiceMap == nil {
+		t.Error("a failed traffic query dropped the rest of the snapshot")
+	}
+}
+
+// loadSource records how many dashboard queries run at once. Each takes delay
+// unless its context ends first.
+type loadSource struct {
+	stubSource
+	delay          time.Duration
+	inFlight, peak atomic.Int32
+	calls          atomic.Int32
+}
+
+func (s *loadSource) GetDashboardStatsContext(ctx context.Context, start, end time.Time, serviceNames []string) (*storage.DashboardStats, error) {
+	s.calls.Add(1)
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for p := s.peak.Load(); n > p && !s.peak.CompareAndSwap(p, n); p = s.peak.Load() {
+	}
+	select {
+	case <-time.After(s.delay):
+		return &storage.DashboardStats{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// connectFilteredClients opens n event clients, each filtered to its own service,
+// and waits until the hub has registered all of them and their bootstrap snapshots
+// have been computed.
+func connectFilteredClients(t *testing.T, h *EventHub, src *loadSource, n int) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+	t.Cleanup(srv.Close)
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+	for i := 0; i < n; i++ {
+		conn, _, err := websocket.Dial(context.Background(), fmt.Sprintf("%s?service=svc-%d", base, i), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				if _, _, err := conn.Read(context.Background()); err != nil {
+					return
+				}
+			}
+		}()
+		t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.mu.Lock()
+		registered := len(h.clients)
+		h.mu.Unlock()
+		if registered == n && src.calls.Load() >= int32(n) && src.inFlight.Load() == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d clients registered", registered, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFlushSnapshotsBoundsConcurrency(t *testing.T) {
+	const filters, workers = 40, 4
+	src := &loadSource{delay: 20 * time.Millisecond}
+	h := NewEventHub(src, nil)
+	h.SetSnapshotLimits(workers, 10*time.Second)
+	var observed atomic.Int32
+	h.SetSnapshotMetrics(func(time.Duration) { observed.Add(1) }, func() { t.Error("flush reported as skipped") })
+	connectFilteredClients(t, h, src, filters)
+
+	// Bootstrap snapshots on connect are not part of the bounded flush.
+	src.peak.Store(0)
+	src.calls.Store(0)
+
+	h.NotifyRefresh()
+	h.flushSnapshots()
+
+	if got := src.calls.Load(); got != filters {
+		t.Errorf("dashboard queries = %d, want one per filter (%d)", got, filters)
+	}
+	if peak := src.peak.Load(); peak > workers || peak < 2 {
+		t.Errorf("peak concurrent queries = %d, want 2..%d", peak, workers)
+	}
+	if observed.Load() != filters {
+		t.Errorf("observed %d snapshot durations, want %d", observed.Load(), filters)
+	}
+	if h.pending {
+		t.Error("pending still set after a complete flush")
+	}
+}
+
+func TestFlushSnapshotsBudgetKeepsPending(t *testing.T) {
+	src := &loadSource{delay: 300 * time.Millisecond}
+	h := NewEventHub(src, nil)
+	h.SetSnapshotLimits(2, 50*time.Millisecond)
+	var skipped atomic.Int32
+	h.SetSnapshotMetrics(nil, func() { skipped.Add(1) })
+	connectFilteredClients(t, h, src, 6)
+	src.calls.Store(0)
+
+	h.NotifyRefresh()
+	started := time.Now()
+	h.flushSnapshots()
+
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("flush took %v, want it cut off near the 50ms budget", elapsed)
+	}
+	if got := src.calls.Load(); got > 2 {
+		t.Errorf("dashboard queries = %d, want only the first 2 to start before the budget ran out", got)
+	}
+	if !h.pending || skipped.Load() != 1 {
+		t.Errorf("pending = %v, skipped = %d; want the tick retried and counted", h.pending, skipped.Load())
+	}
+
+	// A tick arriving while a flush is running is skipped and also keeps pending.
+	h.mu.Lock()
+	h.flushing = true
+	h.mu.Unlock()
+	src.calls.Store(0)
+	h.flushSnapshots()
+	if src.calls.Load() != 0 || !h.pending || skipped.Load() != 2 {
+		t.Errorf("overlapping tick: calls = %d, pending = %v, skipped = %d", src.calls.Load(), h.pending, skipped.Load())
+	}
+}
+
+func TestIdleRefreshForcesSnapshots(t *testing.T) {
+	src := &loadSource{}
+	h := NewEventHub(src, nil)
+	h.SetIdleRefresh(3)
+	connectFilteredClients(t, h, src, 1)
+	src.calls.Store(0)
+
+	for tick := 1; tick <= 7; tick++ {
+		h.flushSnapshots()
+		if want := int32(tick / 3); src.calls.Load() != want {
+			t.Fatalf("after %d idle ticks: %d snapshots, want %d", tick, src.calls.Load(), want)
+		}
+	}
+
+	// Ingest restarts the count.
+	h.NotifyRefresh()
+	h.flushSnapshots() // flushes for the new data
+	h.flushSnapshots()
+	h.flushSnapshots()
+	if got := src.calls.Load(); got != 3 {
+		t.Errorf("snapshots = %d, want 3: two idle ticks since the ingest flush", got)
+	}
+
+	h.SetIdleRefresh(0)
+	for range 10 {
+		h.flushSnapshots()
+	}
+	if got := src.calls.Load(); got != 3 {
+		t.Errorf("snapshots with idle refresh off = %d, want still 3", got)
+	}
+}
+
+// windowSource reports the end of the queried window as the dashboard's trace count,
+// so a client can tell which window a snapshot covers.
+type windowSource struct {
+	stubSource
+	calls atomic.Int32
+}
+
+func (s *windowSource) GetDashboardStatsContext(_ context.Context, start, end time.Time, serviceNames []string) (*storage.DashboardStats, error) {
+	s.calls.Add(1)
+	return &storage.DashboardStats{TotalTraces: end.UnixNano()}, nil
+}
+
+func TestStartCachesBaselineSnapshot(t *testing.T) {
+	src := &windowSource{}
+	h := NewEventHub(src, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Start(ctx, time.Hour, time.Hour)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for src.calls.Load() == 0 || h.cachedBaseline(filterKey{}) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no baseline snapshot computed at start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Unfiltered clients share the baseline; a filtered one gets its own snapshot.
+	for range 3 {
+		var snap LiveSnapshot
+		if err := json.Unmarshal(dialRaw(t, http.HandlerFunc(h.HandleWebSocket), "")(), &snap); err != nil {
+			t.Fatal(err)
+		}
+		if snap.Type != "live_snapshot" || snap.Dashboard == nil || snap.Traces == nil {
+			t.Fatalf("bootstrap = %+v, want the cached snapshot with traces", snap)
+		}
+	}
+	if got := src.calls.Load(); got != 1 {
+		t.Errorf("dashboard queries = %d, want only the one at start", got)
+	}
+	dialRaw(t, http.HandlerFunc(h.HandleWebSocket), "?service=checkout")()
+	if got := src.calls.Load(); got != 2 {
+		t.Errorf("dashboard queries = %d, want a second for the filtered client", got)
+	}
+}
+
+func TestIdleHubSnapshotsFollowTheClock(t *testing.T) {
+	src := &windowSource{}
+	h := NewEventHub(src, nil)
+	h.SetIdleRefresh(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Start(ctx, 20*time.Millisecond, time.Hour)
+
+	// Nothing is ever ingested, yet snapshots keep arriving and their window moves.
+	next := dialRaw(t, http.HandlerFunc(h.HandleWebSocket), "")
+	var last int64
+	for i := range 4 {
+		var snap LiveSnapshot
+		if err := json.Unmarshal(next(), &snap); err != nil {
+			t.Fatal(err)
+		}
+		if snap.Type != "live_snapshot" || snap.Dashboard == nil {
+			t.Fatalf("message %d = %+v, want a live snapshot", i, snap)
+		}
+		end := time.Unix(0, snap.Dashboard.TotalTraces)
+		if snap.Dashboard.TotalTraces <= last || time.Since(end) > time.Second {
+			t.Errorf("snapshot %d covers a window ending %v, want a newer one ending now", i, end)
+		}
+		last = snap.Dashboard.TotalTraces
+	}
+}
+
+// dialEvents connects to the hub with the given query and returns a function that
+// reads the next message's type, seq and resync flag.
+func dialEvents(t *testing.T, h *EventHub, query string) func() (string, uint64, bool) {
+	t.Helper()
+	read := dialRaw(t, http.HandlerFunc(h.HandleWebSocket), query)
+	return func() (string, uint64, bool) {
+		t.Helper()
+		data := read()
+		var msg struct {
+			Type   string `json:"type"`
+			Seq    uint64 `json:"seq"`
+			Resync bool   `json:"resync"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg.Type, msg.Seq, msg.Resync
+	}
+}
+
+// dialRaw connects a WebSocket client to handler and returns a function that reads
+// the next message.
+func dialRaw(t *testing.T, handler http.Handler, query string) func() []byte {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close(websocket.StatusNormalClosure, "") })
+	return func() []byte {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return data
+	}
+}
+
+// asTenant authenticates every request to handler as a client of tenantID, as the
+// API server does for tenant tokens.
+func asTenant(tenantID string, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(tenant.NewContext(r.Context(), tenant.Identity{Tenant: tenantID})))
+	})
+}
+
+func TestResumeReplaysMissedBroadcasts(t *testing.T) {
+	h := NewEventHub(&stubSource{}, nil)
+	// Broadcast while no client is connected, as while a laptop sleeps.
+	h.BroadcastEvent("anomaly", "checkout", "a")
+	h.BroadcastEvent("slo_breach", "payments", "b") // filtered out below
+	h.BroadcastEvent("anomaly", "", "c")
+	h.sendInsight(NewAIInsightMessage(1, "t", "checkout", "d"))
+
+	next := dialEvents(t, h, "?service=checkout&since_seq=1")
+	if typ, seq, resync := next(); typ != "live_snapshot" || resync || seq != 4 {
+		t.Fatalf("first message = %s seq %d resync %v, want a live_snapshot at seq 4", typ, seq, resync)
+	}
+	for _, want := range []struct {
+		typ string
+		seq uint64
+	}{{"anomaly", 3}, {"ai_insight", 4}} {
+		if typ, seq, _ := next(); typ != want.typ || seq != want.seq {
+			t.Errorf("replayed %s seq %d, want %s seq %d", typ, seq, want.typ, want.seq)
+		}
+	}
+
+	// Live flow resumes after the replay.
+	h.BroadcastEvent("anomaly", "checkout", "e")
+	if typ, seq, _ := next(); typ != "anomaly" || seq != 5 {
+		t.Errorf("live message = %s seq %d, want anomaly seq 5", typ, seq)
+	}
+}
+
+func TestResumeResyncsAfterOverflow(t *testing.T) {
+	h := NewEventHub(&stubSource{}, nil)
+	h.SetReplayBuffer(2, time.Hour)
+	for i := 0; i < 5; i++ {
+		h.BroadcastEvent("anomaly", "", i)
+	}
+
+	// Seq 2 and 3 have been evicted, so seq 1 can no longer be resumed from.
+	next := dialEvents(t, h, "?since_seq=1")
+	if typ, seq, resync := next(); typ != "live_snapshot" || !resync || seq != 5 {
+		t.Fatalf("first message = %s seq %d resync %v, want a resync snapshot at seq 5", typ, seq, resync)
+	}
+	h.BroadcastEvent("anomaly", "", "live")
+	if typ, seq, _ := next(); typ != "anomaly" || seq != 6 {
+		t.Errorf("after resync got %s seq %d, want the live anomaly seq 6 and nothing replayed", typ, seq)
+	}
+
+	// A seq from before a restart is ahead of the hub's and also resyncs.
+	next = dialEvents(t, h, "?since_seq=99")
+	if _, _, resync := next(); !resync {
+		t.Error("since_seq ahead of the hub did not resync")
+	}
+	// The newest entries are still replayable.
+	next = dialEvents(t, h, "?since_seq=4")
+	if _, _, resync := next(); resync {
+		t.Error("since_seq within the buffer resynced")
+	}
+	if typ, seq, _ := next(); typ != "anomaly" || seq != 5 {
+		t.Errorf("replayed %s seq %d, want anomaly seq 5", typ, seq)
+	}
+}
+
+func TestEventClientsOnlyReceiveTheirTenant(t *testing.T) {
+	h := NewEventHub(&stubSource{}, nil)
+	h.BroadcastTenantEvent("beta", "log_repeat", "cart", "b")
+	h.BroadcastTenantEvent("alpha", "log_repeat", "cart", "a")
+	h.BroadcastEvent("slo_breach", "", "instance-wide")
+
+	read := dialRaw(t, asTenant("alpha", h.HandleWebSocket), "?since_seq=0")
+	var snap LiveSnapshot
+	if err := json.Unmarshal(read(), &snap); err != nil || snap.Type != "live_snapshot" {
+		t.Fatalf("first message = %+v, %v; want a live_snapshot", snap, err)
+	}
+	var event HubBatch
+	if err := json.Unmarshal(read(), &event); err != nil || event.Seq != 2 || event.Data != "a" {
+		t.Fatalf("replayed %+v, want only alpha's event (seq 2)", event)
+	}
+
+	h.mu.Lock()
+	h.logBuffer = append(h.logBuffer,
+		LogEntry{ID: 1, ServiceName: "cart", TenantID: "beta"},
+		LogEntry{ID: 2, ServiceName: "cart", TenantID: "alpha"})
+	h.traceBuffer = append(h.traceBuffer, TraceEntry{TraceID: "beta-trace", ServiceName: "cart", TenantID: "beta"})
+	h.mu.Unlock()
+	h.flushBatches()
+
+	var batch struct {
+		Type string     `json:"type"`
+		Data []LogEntry `json:"data"`
+	}
+	if err := json.Unmarshal(read(), &batch); err != nil || batch.Type != "logs" || len(batch.Data) != 1 || batch.Data[0].ID != 2 {
+		t.Fatalf("batch = %+v, %v; want alpha's log only", batch, err)
+	}
+
+	// Nothing else reached the client: the next message is the one sent now.
+	h.BroadcastTenantEvent("alpha", "log_repeat", "cart", "next")
+	if err := json.Unmarshal(read(), &event); err != nil || event.Data != "next" {
+		t.Errorf("next message = %+v, want the new alpha event", event)
+	}
+}
+
+func TestEventClientsFilterByEnvironment(t *testing.T) {
+	h := NewEventHub(&stubSource{}, nil)
+	read := dialRaw(t, http.HandlerFunc(h.HandleWebSocket), "?service=cart&env=prod")
+	if err := json.Unmarshal(read(), &LiveSnapshot{}); err != nil {
+		t.Fatal(err)
+	}
+	flush := func() {
+		h.mu.Lock()
+		h.logBuffer = append(h.logBuffer,
+			LogEntry{ID: 1, ServiceName: "cart", Environment: "prod"},
+			LogEntry{ID: 2, ServiceName: "cart", Environment: "staging"},
+			LogEntry{ID: 3, ServiceName: "cart"},
+			LogEntry{ID: 4, ServiceName: "checkout", Environment: "prod"})
+		h.traceBuffer = append(h.traceBuffer,
+			TraceEntry{TraceID: "prod-trace", ServiceName: "cart", Environment: "prod"},
+			TraceEntry{TraceID: "staging-trace", ServiceName: "cart", Environment: "staging"})
+		h.mu.Unlock()
+		h.flushBatches()
+	}
+	readBatch := func(v any) string {
+		t.Helper()
+		batch := struct {
+			Type string `json:"type"`
+			Data any    `json:"data"`
+		}{Data: v}
+		if err := json.Unmarshal(read(), &batch); err != nil {
+			t.Fatal(err)
+		}
+		return batch.Type
+	}
+
+	flush()
+	var logs []LogEntry
+	if typ := readBatch(&logs); typ != "logs" || len(logs) != 1 || logs[0].ID != 1 {
+		t.Fatalf("%s batch = %+v, want the prod cart log only", typ, logs)
+	}
+	var traces []TraceEntry
+	if typ := readBatch(&traces); typ != "traces" || len(traces) != 1 || traces[0].TraceID != "prod-trace" {
+		t.Fatalf("%s batch = %+v, want the prod trace only", typ, traces)
+	}
+
+	// Events are not tied to an environment and reach the client anyway.
+	h.BroadcastEvent("anomaly", "cart", "a")
+	var event HubBatch
+	if err := json.Unmarshal(read(), &event); err != nil || event.Type != "anomaly" {
+		t.Fatalf("message = %+v, %v; want the anomaly", event, err)
+	}
+
+	// A filter message replaces both parts of the filter.
+	h.mu.Lock()
+	var conns []*websocket.Conn
+	for conn := range h.clients {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+	for _, conn := range conns {
+		h.updateClientFilter(conn, "", "staging")
+	}
+	flush()
+	logs = nil
+	if typ := readBatch(&logs); typ != "logs" || len(logs) != 1 || logs[0].ID != 2 {
+		t.Errorf("%s batch after the filter change = %+v, want the staging log only", typ, logs)
+	}
+}
@@ -0,0 +1,126 @@
+package realtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dialLegacy connects a /ws client to h and waits until the hub has registered it.
+func dialLegacy(t *testing.T, h *EventHub, handler http.Handler) func() []byte {
+	t.Helper()
+	before := len(clientsByHub(h)["ws"])
+	read := dialRaw(t, handler, "")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(clientsByHub(h)["ws"]) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("/ws client did not register")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return read
+}
+
+// TestLegacyPayloadsMatchGolden checks that /ws clients receive byte for byte what
+// the standalone /ws hub used to send. The golden files were recorded from it.
+func TestLegacyPayloadsMatchGolden(t *testing.T) {
+	h := NewEventHub(&stubSource{}, nil)
+	read := dialLegacy(t, h, http.HandlerFunc(h.HandleLegacyWebSocket))
+	// Events and trace batches are not part of the /ws stream.
+	h.BroadcastEvent("anomaly", "", "skipped")
+
+	at := time.Date(2026, 3, 14, 15, 9, 26, 535000000, time.UTC)
+	h.mu.Lock()
+	h.logBuffer = append(h.logBuffer,
+		LogEntry{ID: 7, TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Severity: "ERROR",
+			Body: `payment declined: "card <expired>" & retry`, BodyType: "string", ServiceName: "payment-service",
+			AttributesJSON: `{"http.status_code":402}`, Timestamp: at, TenantID: "acme"},
+		LogEntry{ID: 8, Severity: "INFO", Body: "order created", ServiceName: "order-service",
+			AttributesJSON: "{}", AIInsight: "looks fine", Truncated: true, Timestamp: at.Add(time.Millisecond)})
+	h.traceBuffer = append(h.traceBuffer, TraceEntry{TraceID: "skipped", ServiceName: "order-service"})
+	h.mu.Unlock()
+	h.flushBatches()
+	assertGolden(t, "ws_logs", read())
+
+	h.mu.Lock()
+	h.metricBuffer = append(h.metricBuffer, MetricEntry{Name: "http.server.duration", ServiceName: "order-service", Value: 12.5,
+		Timestamp: at, Attributes: map[string]interface{}{"http.route": "/orders", "http.status_code": 200, "ok": true}})
+	h.mu.Unlock()
+	h.flushBatches()
+	assertGolden(t, "ws_metrics", read())
+
+	msg := NewAIInsightMessage(7, "4bf92f3577b34da6a3ce929d0e0e4736", "payment-service", "The card expired; ask for a new one.")
+	msg.TenantID = "acme"
+	h.sendInsight(msg)
+	assertGolden(t, "ws_ai_insight", read())
+}
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	want, err := os.ReadFile(filepath.Join("testdata", name+".golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s payload:\n got %s\nwant %s", name, got, want)
+	}
+}
+
+func TestLegacyClientsOnlyReceiveTheirTenant(t *testing.T) {
+	h := NewEventHub(&stubSource{}, nil)
+	readAlpha := dialLegacy(t, h, asTenant("alpha", h.HandleLegacyWebSocket))
+	readAll := dialLegacy(t, h, http.HandlerFunc(h.HandleLegacyWebSocket))
+
+	h.mu.Lock()
+	h.logBuffer = append(h.logBuffer, LogEntry{ID: 1, TenantID: "beta"}, LogEntry{ID: 2, TenantID: "alpha"})
+	h.mu.Unlock()
+	h.flushBatches()
+	ids := func(data []byte) (ids []uint) {
+		var batch struct {
+			Data []LogEntry `json:"data"`
+		}
+		json.Unmarshal(data, &batch)
+		for _, l := range batch.Data {
+			ids = append(ids, l.ID)
+		}
+		return ids
+	}
+	if got := ids(readAlpha()); len(got) != 1 || got[0] != 2 {
+		t.Errorf("alpha client received logs %v, want [2]", got)
+	}
+	if got := ids(readAll()); len(got) != 2 {
+		t.Errorf("unscoped client received logs %v, want both", got)
+	}
+}
+
+func TestSlowClientIsDropped(t *testing.T) {
+	h := NewEventHub(&stubSource{}, nil)
+	var legacyCount, sent, slow atomic.Int32
+	h.SetLegacyConnectionCallback(func(n int) { legacyCount.Store(int32(n)) })
+	h.SetWSMetrics(func(string) { sent.Add(1) }, func() { slow.Add(1) })
+
+	// Without a writer nothing drains the client's queue.
+	cf := newClientFilter(nil, httptest.NewRequest(http.MethodGet, "/ws", nil), "", "")
+	cf.legacy = true
+	h.addClient(cf)
+	for i := range clientQueueSize + 2 {
+		h.sendInsight(NewAIInsightMessage(uint(i), "t", "checkout", "x"))
+	}
+
+	if legacyCount.Load() != 0 || len(h.Clients()) != 0 {
+		t.Errorf("%d /ws clients, %d listed; want the slow one removed", legacyCount.Load(), len(h.Clients()))
+	}
+	if slow.Load() != 1 || sent.Load() != clientQueueSize {
+		t.Errorf("slow drops = %d, messages sent = %d; want 1, %d", slow.Load(), sent.Load(), clientQueueSize)
+	}
+	if cf.stats.dropped.Load() != 1 || !cf.outClosed || len(cf.out) != clientQueueSize {
+		t.Errorf("dropped %d, closed %v, %d queued; want the full queue kept for the writer to send",
+			cf.stats.dropped.Load(), cf.outClosed, len(cf.out))
+	}
+}
@@ -0,0 +1,64 @@
+package realtime
+
+import "time"
+
+// Defaults for SetReplayBuffer.
+const (
+	defaultReplaySize   = 256
+	defaultReplayMaxAge = 5 * time.Minute
+)
+
+// replayEntry is one sequenced broadcast message, kept so a reconnecting client can
+// receive what it missed.
+type replayEntry struct {
+	seq     uint64
+	at      time.Time
+	tenant  string // "" = instance-wide
+	service string // "" = all services
+	msg     []byte
+}
+
+// replayBuffer holds the most recent broadcast messages, oldest first, bounded by
+// count and age.
+type replayBuffer struct {
+	size    int
+	maxAge  time.Duration
+	entries []replayEntry
+	dropped uint64 // highest sequence number no longer held
+}
+
+func (b *replayBuffer) add(e replayEntry) {
+	b.entries = append(b.entries, e)
+	if over := len(b.entries) - b.size; over > 0 {
+		b.dropped = b.entries[over-1].seq
+		b.entries = append(b.entries[:0:0], b.entries[over:]...)
+	}
+	b.prune(e.at)
+}
+
+// prune drops the entries older than maxAge.
+func (b *replayBuffer) prune(now time.Time) {
+	n := 0
+	for n < len(b.entries) && now.Sub(b.entries[n].at) > b.maxAge {
+		n++
+	}
+	if n > 0 {
+		b.dropped = b.entries[n-1].seq
+		b.entries = b.entries[n:]
+	}
+}
+
+// since returns the entries after seq. ok is false when the buffer no longer holds
+// all of them, or when seq is ahead of latest, as it is after a server restart.
+func (b *replayBuffer) since(seq, latest uint64, now time.Time) (entries []replayEntry, ok bool) {
+	b.prune(now)
+	if seq > latest || seq < b.dropped {
+		return nil, false
+	}
+	for _, e := range b.entries {
+		if e.seq > seq {
+			entries = append(entries, e)
+		}
+	}
+	return entries, true
+}
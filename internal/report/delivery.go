@@ -0,0 +1,94 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sender delivers a rendered report to one destination.
+type Sender interface {
+	// Channel names the destination kind for logs and metrics, e.g. "webhook".
+	Channel() string
+	Send(ctx context.Context, r *Report, html string) error
+}
+
+// WebhookSender POSTs the report as JSON.
+type WebhookSender struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookSender returns a sender for url with a 30s timeout.
+func NewWebhookSender(url string) *WebhookSender {
+	return &WebhookSender{URL: url, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (w *WebhookSender) Channel() string { return "webhook" }
+
+func (w *WebhookSender) Send(ctx context.Context, r *Report, _ string) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPSender emails the HTML report. Username empty means no authentication.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (s *SMTPSender) Channel() string { return "smtp" }
+
+func (s *SMTPSender) Send(_ context.Context, r *Report, html string) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	subject := fmt.Sprintf("OtelContext daily report %s: %d requests, %.2f%% errors",
+		r.End.Add(-time.Minute).Format("2006-01-02"), r.TotalRequests, r.ErrorRate)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(html, "\n", "\r\n"))
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	if err := smtp.SendMail(addr, auth, s.From, s.To, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp delivery to %s failed: %w", addr, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package report
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+)
+
+// Generator builds reports and delivers them to every configured sender.
+type Generator struct {
+	store      storage.ReportReader
+	senders    []Sender
+	retries    int           // extra attempts per sender after a failure
+	retryDelay time.Duration // wait before the first retry; doubles each time
+	metrics    *telemetry.Metrics
+	loc        *time.Location // day boundaries of scheduled reports
+
+	runMu    sync.Mutex // one run at a time
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// Delivery is the outcome of sending one report to one sender.
+type Delivery struct {
+	Channel   string `json:"channel"`
+	Delivered bool   `json:"delivered"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Result is a generated report and how its delivery went.
+type Result struct {
+	Report     *Report    `json:"report"`
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+// New creates a generator reading from store. With no senders, reports are only
+// returned by Run.
+func New(store storage.ReportReader, senders ...Sender) *Generator {
+	return &Generator{
+		store:      store,
+		senders:    senders,
+		retries:    3,
+		retryDelay: 5 * time.Second,
+		loc:        time.UTC,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// SetMetrics enables delivery counters.
+func (g *Generator) SetMetrics(m *telemetry.Metrics) { g.metrics = m }
+
+// SetLocation sets the time zone whose calendar days scheduled reports cover.
+func (g *Generator) SetLocation(loc *time.Location) {
+	if loc != nil {
+		g.loc = loc
+	}
+}
+
+// SetRetries sets how many times a failed delivery is retried.
+func (g *Generator) SetRetries(n int) {
+	if n >= 0 {
+		g.retries = n
+	}
+}
+
+// Run builds the report for the day in loc ending at end and delivers it. Delivery
+// failures are reported in the result, not as an error.
+func (g *Generator) Run(ctx context.Context, end time.Time, loc *time.Location) (*Result, error) {
+	g.runMu.Lock()
+	defer g.runMu.Unlock()
+
+	rep, err := Build(g.store, end, loc)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Report: rep, Deliveries: []Delivery{}}
+	if len(g.senders) == 0 {
+		return res, nil
+	}
+	html, err := rep.HTML()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range g.senders {
+		res.Deliveries = append(res.Deliveries, g.deliver(ctx, s, rep, html))
+	}
+	return res, nil
+}
+
+// deliver sends to s, retrying with exponential backoff.
+func (g *Generator) deliver(ctx context.Context, s Sender, rep *Report, html string) Delivery {
+	d := Delivery{Channel: s.Channel()}
+	delay := g.retryDelay
+	for {
+		d.Attempts++
+		err := s.Send(ctx, rep, html)
+		if err == nil {
+			d.Delivered = true
+			g.record(d.Channel, "success")
+			slog.Info("📨 Report delivered", "channel", d.Channel, "attempts", d.Attempts)
+			return d
+		}
+		d.Error = err.Error()
+		if d.Attempts > g.retries {
+			g.record(d.Channel, "failure")
+			slog.Error("Report delivery failed", "channel", d.Channel, "attempts", d.Attempts, "error", err)
+			return d
+		}
+		g.record(d.Channel, "retry")
+		slog.Warn("Report delivery failed, retrying", "channel", d.Channel, "attempt", d.Attempts, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			d.Error = ctx.Err().Error()
+			g.record(d.Channel, "failure")
+			return d
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (g *Generator) record(channel, result string) {
+	if g.metrics != nil {
+		g.metrics.RecordReportDelivery(channel, result)
+	}
+}
+
+// Start runs a report, covering the last full day in the generator's time zone,
+// each time sched fires. Blocks until ctx is cancelled or Stop is called.
+func (g *Generator) Start(ctx context.Context, sched *Schedule) {
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			slog.Warn("Report schedule never fires; scheduled reports disabled")
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-g.stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if _, err := g.Run(ctx, StartOfDay(time.Now(), g.loc), g.loc); err != nil {
+			slog.Error("Scheduled report failed", "error", err)
+		}
+	}
+}
+
+// Stop terminates the schedule loop.
+func (g *Generator) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stopCh)
+	})
+}
+
+// StartOfDay returns midnight in loc of t's day, which is the end of the previous day.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,149 @@
+// Package report builds the daily digest (request volume, error rate against the day
+// before, top failing services and p99 latency per service) and delivers it by
+// webhook and/or email, on a cron schedule or on demand.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// topFailing is how many services the report lists as failing the most.
+const topFailing = 5
+
+// Report is the digest for the day ending at End. Error rates are percentages;
+// ErrorRateChange is in percentage points against the day before Start.
+type Report struct {
+	Start              time.Time        `json:"start"`
+	End                time.Time        `json:"end"`
+	GeneratedAt        time.Time        `json:"generated_at"`
+	TotalRequests      int64            `json:"total_requests"`
+	TotalErrors        int64            `json:"total_errors"`
+	ErrorRate          float64          `json:"error_rate"`
+	PreviousErrorRate  float64          `json:"previous_error_rate"`
+	ErrorRateChange    float64          `json:"error_rate_change"`
+	TopFailingServices []ServiceSummary `json:"top_failing_services"`
+	Services           []ServiceSummary `json:"services"`
+}
+
+// ServiceSummary is one service's traffic over the report period.
+type ServiceSummary struct {
+	ServiceName string  `json:"service_name"`
+	Requests    int64   `json:"requests"`
+	Errors      int64   `json:"errors"`
+	ErrorRate   float64 `json:"error_rate"`
+	P99Ms       float64 `json:"p99_ms"`
+}
+
+// Build assembles the report for the day ending at end from trace aggregates. The
+// day is a calendar day in loc (nil: UTC), so across a DST change it covers 23 or
+// 25 hours; Start and End are reported in loc.
+func Build(store storage.ReportReader, end time.Time, loc *time.Location) (*Report, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	end = end.In(loc)
+	start := end.AddDate(0, 0, -1)
+	rep := &Report{Start: start, End: end, GeneratedAt: time.Now().UTC()}
+
+	traffic, err := store.GetServiceTraffic(start, end)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := store.GetServiceTraffic(start.AddDate(0, 0, -1), start)
+	if err != nil {
+		return nil, err
+	}
+	latencies, err := store.GetServiceLatencyPercentiles(start, end, 99)
+	if err != nil {
+		return nil, err
+	}
+	p99 := make(map[string]float64, len(latencies))
+	for _, l := range latencies {
+		p99[l.ServiceName] = l.PercentileMs
+	}
+
+	rep.Services = make([]ServiceSummary, 0, len(traffic))
+	for _, t := range traffic {
+		rep.TotalRequests += t.Count
+		rep.TotalErrors += t.ErrorCount
+		rep.Services = append(rep.Services, ServiceSummary{
+			ServiceName: t.ServiceName,
+			Requests:    t.Count,
+			Errors:      t.ErrorCount,
+			ErrorRate:   percent(t.ErrorCount, t.Count),
+			P99Ms:       p99[t.ServiceName],
+		})
+	}
+	sort.Slice(rep.Services, func(i, j int) bool { return rep.Services[i].ServiceName < rep.Services[j].ServiceName })
+
+	var prevRequests, prevErrors int64
+	for _, t := range previous {
+		prevRequests += t.Count
+		prevErrors += t.ErrorCount
+	}
+	rep.ErrorRate = percent(rep.TotalErrors, rep.TotalRequests)
+	rep.PreviousErrorRate = percent(prevErrors, prevRequests)
+	rep.ErrorRateChange = math.Round((rep.ErrorRate-rep.PreviousErrorRate)*100) / 100
+
+	rep.TopFailingServices = []ServiceSummary{}
+	for _, s := range rep.Services {
+		if s.Errors > 0 {
+			rep.TopFailingServices = append(rep.TopFailingServices, s)
+		}
+	}
+	sort.SliceStable(rep.TopFailingServices, func(i, j int) bool {
+		return rep.TopFailingServices[i].Errors > rep.TopFailingServices[j].Errors
+	})
+	if len(rep.TopFailingServices) > topFailing {
+		rep.TopFailingServices = rep.TopFailingServices[:topFailing]
+	}
+	return rep, nil
+}
+
+// percent returns n/total as a percentage rounded to two decimals.
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*10000) / 100
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ts": func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2>OtelContext daily report</h2>
+<p>{{ts .Start}} &ndash; {{ts .End}}</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th align="left">Total requests</th><td>{{.TotalRequests}}</td></tr>
+<tr><th align="left">Errors</th><td>{{.TotalErrors}}</td></tr>
+<tr><th align="left">Error rate</th><td>{{printf "%.2f" .ErrorRate}}% ({{printf "%+.2f" .ErrorRateChange}} pts vs previous day)</td></tr>
+</table>
+<h3>Top failing services</h3>
+{{if .TopFailingServices}}<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Service</th><th>Errors</th><th>Requests</th><th>Error rate</th></tr>
+{{range .TopFailingServices}}<tr><td>{{.ServiceName}}</td><td>{{.Errors}}</td><td>{{.Requests}}</td><td>{{printf "%.2f" .ErrorRate}}%</td></tr>
+{{end}}</table>{{else}}<p>No failed requests.</p>{{end}}
+<h3>Latency per service</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Service</th><th>Requests</th><th>p99 (ms)</th></tr>
+{{range .Services}}<tr><td>{{.ServiceName}}</td><td>{{.Requests}}</td><td>{{printf "%.1f" .P99Ms}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// HTML renders the report as a simple HTML page for email.
+func (r *Report) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, r); err != nil {
+		return "", fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.String(), nil
+}
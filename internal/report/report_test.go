@@ -0,0 +1,190 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// fakeStore returns fixed traffic for the report day and the day before it.
+type fakeStore struct {
+	end              time.Time
+	current, earlier []storage.ServiceTraffic
+	latency          []storage.ServiceLatency
+}
+
+func (f *fakeStore) GetServiceTraffic(start, end time.Time) ([]storage.ServiceTraffic, error) {
+	if end.Equal(f.end) {
+		return f.current, nil
+	}
+	return f.earlier, nil
+}
+
+func (f *fakeStore) GetServiceLatencyPercentiles(start, end time.Time, p float64) ([]storage.ServiceLatency, error) {
+	return f.latency, nil
+}
+
+func newFakeStore() *fakeStore {
+	end := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	return &fakeStore{
+		end: end,
+		current: []storage.ServiceTraffic{
+			{ServiceName: "payments", Count: 100, ErrorCount: 10},
+			{ServiceName: "checkout", Count: 300, ErrorCount: 30},
+			{ServiceName: "search", Count: 600},
+		},
+		earlier: []storage.ServiceTraffic{{ServiceName: "checkout", Count: 1000, ErrorCount: 20}},
+		latency: []storage.ServiceLatency{
+			{ServiceName: "checkout", Count: 300, PercentileMs: 420},
+			{ServiceName: "search", Count: 600, PercentileMs: 35.5},
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	store := newFakeStore()
+	rep, err := Build(store, store.end, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Start.Equal(store.end.Add(-24 * time.Hour)) {
+		t.Errorf("Start = %s, want 24h before end", rep.Start)
+	}
+	if rep.TotalRequests != 1000 || rep.TotalErrors != 40 || rep.ErrorRate != 4 {
+		t.Errorf("totals = %d requests, %d errors, %.2f%%; want 1000, 40, 4%%", rep.TotalRequests, rep.TotalErrors, rep.ErrorRate)
+	}
+	if rep.PreviousErrorRate != 2 || rep.ErrorRateChange != 2 {
+		t.Errorf("previous = %.2f%%, change = %.2f pts; want 2%% and +2", rep.PreviousErrorRate, rep.ErrorRateChange)
+	}
+	if len(rep.TopFailingServices) != 2 || rep.TopFailingServices[0].ServiceName != "checkout" || rep.TopFailingServices[1].ServiceName != "payments" {
+		t.Errorf("top failing = %+v, want checkout then payments", rep.TopFailingServices)
+	}
+	if len(rep.Services) != 3 || rep.Services[0].ServiceName != "checkout" || rep.Services[0].P99Ms != 420 || rep.Services[1].P99Ms != 0 {
+		t.Errorf("services = %+v, want sorted by name with p99 attached", rep.Services)
+	}
+
+	html, err := rep.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<td>checkout</td>", "4.00%", "2.00 pts vs previous day", "420.0"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML missing %q", want)
+		}
+	}
+}
+
+func TestBuildDSTDays(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	for _, tt := range []struct {
+		day   time.Time // any time on the report day
+		hours float64
+	}{
+		{time.Date(2026, 3, 8, 12, 0, 0, 0, ny), 23},  // clocks go forward
+		{time.Date(2026, 11, 1, 12, 0, 0, 0, ny), 25}, // clocks go back
+		{time.Date(2026, 6, 1, 12, 0, 0, 0, ny), 24},
+	} {
+		end := StartOfDay(tt.day.AddDate(0, 0, 1), ny)
+		store := newFakeStore()
+		store.end = end
+		rep, err := Build(store, end, ny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rep.End.Sub(rep.Start).Hours(); got != tt.hours {
+			t.Errorf("%s: report covers %vh, want %vh", tt.day.Format("2006-01-02"), got, tt.hours)
+		}
+		if y, m, d := rep.Start.Date(); rep.Start.Hour() != 0 || d != tt.day.Day() || m != tt.day.Month() || y != tt.day.Year() {
+			t.Errorf("%s: report starts %s, want local midnight of that day", tt.day.Format("2006-01-02"), rep.Start)
+		}
+		if rep.TotalRequests != 1000 {
+			t.Errorf("%s: total requests = %d, want the current day's traffic", tt.day.Format("2006-01-02"), rep.TotalRequests)
+		}
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	// 20:00 UTC on March 9 is already March 10 in Tokyo.
+	got := StartOfDay(time.Date(2026, 3, 9, 20, 0, 0, 0, time.UTC), tokyo)
+	if want := time.Date(2026, 3, 10, 0, 0, 0, 0, tokyo); !got.Equal(want) {
+		t.Errorf("StartOfDay() = %s, want %s", got, want)
+	}
+}
+
+// flakySender fails a fixed number of times before succeeding.
+type flakySender struct {
+	failures int
+	calls    int
+}
+
+func (f *flakySender) Channel() string { return "flaky" }
+
+func (f *flakySender) Send(context.Context, *Report, string) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestRunRetriesDelivery(t *testing.T) {
+	store := newFakeStore()
+
+	ok := &flakySender{failures: 2}
+	broken := &flakySender{failures: 10}
+	g := New(store, ok, broken)
+	g.retryDelay = time.Millisecond
+	g.SetRetries(2)
+
+	res, err := g.Run(context.Background(), store.end, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Deliveries) != 2 {
+		t.Fatalf("got %d deliveries, want 2", len(res.Deliveries))
+	}
+	if d := res.Deliveries[0]; !d.Delivered || d.Attempts != 3 {
+		t.Errorf("first sender = %+v, want delivered on the third attempt", d)
+	}
+	if d := res.Deliveries[1]; d.Delivered || d.Attempts != 3 || d.Error == "" {
+		t.Errorf("second sender = %+v, want failed after 3 attempts with an error", d)
+	}
+}
+
+func TestWebhookSender(t *testing.T) {
+	var got Report
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		if got.TotalRequests == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	w := NewWebhookSender(srv.URL)
+	if err := w.Send(context.Background(), &Report{TotalRequests: 42}, ""); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got.TotalRequests != 42 {
+		t.Errorf("webhook received total_requests = %d, want 42", got.TotalRequests)
+	}
+	if err := w.Send(context.Background(), &Report{}, ""); err == nil {
+		t.Error("Send() succeeded on a 502 response, want error")
+	}
+}
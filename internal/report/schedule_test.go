@@ -0,0 +1,46 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr, after, want string
+	}{
+		{"0 7 * * *", "2026-03-10T06:59:30Z", "2026-03-10T07:00:00Z"},
+		{"0 7 * * *", "2026-03-10T07:00:00Z", "2026-03-11T07:00:00Z"},
+		{"@daily", "2026-12-31T12:00:00Z", "2027-01-01T00:00:00Z"},
+		{"*/15 * * * *", "2026-03-10T10:16:00Z", "2026-03-10T10:30:00Z"},
+		{"30 8 * * 1-5", "2026-03-13T09:00:00Z", "2026-03-16T08:30:00Z"}, // Friday → Monday
+		{"0 0 1,15 * *", "2026-03-02T00:00:00Z", "2026-03-15T00:00:00Z"},
+		{"0 6 * * 7", "2026-03-10T00:00:00Z", "2026-03-15T06:00:00Z"}, // 7 = Sunday
+		{"0 0 29 2 *", "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) error = %v", tt.expr, err)
+		}
+		if got := s.Next(at(tt.after)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.after, got.Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{"", "0 7 * *", "60 * * * *", "0 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want error", expr)
+		}
+	}
+}
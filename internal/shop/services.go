@@ -0,0 +1,303 @@
+package shop
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/pkg/argusotel"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// service is one service of the topology. Its handlers port the programs in test/;
+// their failure chances are scaled by the chaos level.
+type service struct {
+	name      string
+	providers *argusotel.Providers
+	tracer    trace.Tracer
+	meter     metric.Meter
+	log       *slog.Logger
+	client    *http.Client
+	urls      map[string]string
+	chaos     float64
+	srv       *http.Server
+
+	orders metric.Int64Counter
+	stock  *stock
+}
+
+func newService(name string, p *argusotel.Providers, urls map[string]string, chaos float64) *service {
+	s := &service{
+		name:      name,
+		providers: p,
+		tracer:    p.TracerProvider.Tracer(name),
+		meter:     p.MeterProvider.Meter(name),
+		log:       p.Logger,
+		urls:      urls,
+		chaos:     chaos,
+	}
+	if s.log == nil {
+		s.log = slog.New(slog.DiscardHandler)
+	}
+	s.client = &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport,
+			otelhttp.WithTracerProvider(p.TracerProvider),
+			otelhttp.WithMeterProvider(p.MeterProvider),
+			otelhttp.WithPropagators(argusotel.Propagator())),
+	}
+
+	mux := http.NewServeMux()
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, otelhttp.NewHandler(h, pattern,
+			otelhttp.WithTracerProvider(p.TracerProvider),
+			otelhttp.WithMeterProvider(p.MeterProvider),
+			otelhttp.WithPropagators(argusotel.Propagator())))
+	}
+	switch name {
+	case "order-service":
+		s.orders, _ = s.meter.Int64Counter("orders_processed_total", metric.WithDescription("Total number of orders processed"))
+		handle("POST /order", s.handleOrder)
+	case "payment-service":
+		handle("POST /pay", s.handlePay)
+	case "inventory-service":
+		s.stock = newStock(s.meter)
+		handle("POST /check", s.handleCheck)
+	case "auth-service":
+		handle("POST /validate", s.handleValidate)
+	case "user-service":
+		handle("GET /user", s.handleUser)
+	case "shipping-service":
+		handle("POST /ship", s.handleShip)
+	case "notification-service":
+		handle("POST /notify", s.handleNotify)
+	}
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return s
+}
+
+// chance reports whether an event that the programs in test/ inject percent% of the
+// time happens, at the configured chaos level.
+func (s *service) chance(percent float64) bool {
+	return rand.Float64()*100 < percent*s.chaos
+}
+
+// call sends a request to another service and fails on any non-200 answer.
+func (s *service) call(ctx context.Context, method, service, path string) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.urls[service]+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", service, resp.StatusCode)
+	}
+	return nil
+}
+
+// fail records err on span, logs it and answers with status.
+func (s *service) fail(ctx context.Context, w http.ResponseWriter, span trace.Span, status int, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	s.log.ErrorContext(ctx, err.Error(), "status", status)
+	http.Error(w, err.Error(), status)
+}
+
+func (s *service) handleOrder(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "process_order")
+	defer span.End()
+
+	orderID := fmt.Sprintf("ORD-%d", rand.IntN(100000))
+	span.SetAttributes(attribute.String("order.id", orderID))
+	s.log.InfoContext(ctx, "Order received", "order_id", orderID)
+
+	if s.chance(30) {
+		latency := time.Duration(100+rand.IntN(700)) * time.Millisecond
+		span.AddEvent("chaos_latency_injected", trace.WithAttributes(attribute.String("latency", latency.String())))
+		time.Sleep(latency)
+	}
+	if err := s.call(ctx, http.MethodPost, "auth-service", "/validate"); err != nil {
+		s.fail(ctx, w, span, http.StatusUnauthorized, fmt.Errorf("auth failed: %w", err))
+		return
+	}
+	if err := s.call(ctx, http.MethodPost, "payment-service", "/pay"); err != nil {
+		s.fail(ctx, w, span, http.StatusBadGateway, fmt.Errorf("payment failed: %w", err))
+		return
+	}
+	// Shipping and notification failures do not fail the order.
+	if err := s.call(ctx, http.MethodPost, "shipping-service", "/ship"); err != nil {
+		span.AddEvent("shipping_delayed", trace.WithAttributes(attribute.String("warning", err.Error())))
+		s.log.WarnContext(ctx, "Shipping delayed", "order_id", orderID, "error", err)
+	}
+	if err := s.call(ctx, http.MethodPost, "notification-service", "/notify"); err != nil {
+		s.log.WarnContext(ctx, "Notification not sent", "order_id", orderID, "error", err)
+	}
+
+	s.orders.Add(ctx, 1)
+	s.log.InfoContext(ctx, "Order placed", "order_id", orderID)
+	w.Write([]byte("Order Placed Successfully"))
+}
+
+func (s *service) handlePay(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "process_payment")
+	defer span.End()
+
+	if s.chance(10) {
+		time.Sleep(time.Duration(500+rand.IntN(1000)) * time.Millisecond)
+		s.fail(ctx, w, span, http.StatusGatewayTimeout, fmt.Errorf("payment gateway timeout"))
+		return
+	}
+	if err := s.call(ctx, http.MethodPost, "auth-service", "/validate"); err != nil {
+		s.fail(ctx, w, span, http.StatusUnauthorized, fmt.Errorf("auth failed: %w", err))
+		return
+	}
+	if err := s.call(ctx, http.MethodPost, "inventory-service", "/check"); err != nil {
+		span.AddEvent("inventory_check_degraded", trace.WithAttributes(attribute.String("warning", err.Error())))
+		s.log.WarnContext(ctx, "Inventory check degraded", "error", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.log.InfoContext(ctx, "Payment processed")
+	w.Write([]byte("Payment Processed"))
+}
+
+func (s *service) handleValidate(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "validate_token")
+	defer span.End()
+
+	time.Sleep(30 * time.Millisecond)
+	if s.chance(5) {
+		s.fail(ctx, w, span, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+		return
+	}
+	if err := s.call(ctx, http.MethodGet, "user-service", "/user"); err != nil {
+		s.fail(ctx, w, span, http.StatusForbidden, fmt.Errorf("user lookup failed: %w", err))
+		return
+	}
+	w.Write([]byte("Token Valid"))
+}
+
+func (s *service) handleUser(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "fetch_user")
+	defer span.End()
+
+	userID := fmt.Sprintf("USR-%d", rand.IntN(1000))
+	span.SetAttributes(attribute.String("user.id", userID))
+	if s.chance(15) {
+		s.fail(ctx, w, span, http.StatusServiceUnavailable, fmt.Errorf("redis timeout fetching %s", userID))
+		return
+	}
+	time.Sleep(10 * time.Millisecond)
+	w.Write([]byte("User Found"))
+}
+
+func (s *service) handleShip(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "dispatch_shipment")
+	defer span.End()
+
+	// Carriers are slow whatever the chaos level.
+	time.Sleep(time.Duration(200+rand.IntN(1300)) * time.Millisecond)
+	if s.chance(5) {
+		s.fail(ctx, w, span, http.StatusGatewayTimeout, fmt.Errorf("carrier API timeout"))
+		return
+	}
+	s.log.InfoContext(ctx, "Shipment dispatched")
+	w.Write([]byte("Shipment Dispatched"))
+}
+
+func (s *service) handleNotify(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "send_notification")
+	defer span.End()
+
+	time.Sleep(15 * time.Millisecond)
+	if s.chance(2) {
+		s.fail(ctx, w, span, http.StatusInternalServerError, fmt.Errorf("SMTP error"))
+		return
+	}
+	w.Write([]byte("Notification Sent"))
+}
+
+// Inventory keeps real stock levels. Most checks go to a few hot SKUs, which
+// serializes them on the SKU lock the way a hot row does in a database.
+const (
+	skuCount     = 500
+	hotSKUs      = 10
+	hotShare     = 0.8 // share of checks that go to a hot SKU
+	restockLevel = 100
+)
+
+type stock struct {
+	items map[string]*stockItem // fixed after newStock
+
+	checks    metric.Int64Counter
+	depletion metric.Int64Counter
+}
+
+type stockItem struct {
+	mu       sync.Mutex
+	quantity int
+}
+
+func newStock(meter metric.Meter) *stock {
+	st := &stock{items: make(map[string]*stockItem, skuCount)}
+	for i := range skuCount {
+		st.items[fmt.Sprintf("SKU-%d", i)] = &stockItem{quantity: 10 + rand.IntN(restockLevel)}
+	}
+	st.checks, _ = meter.Int64Counter("stock_check_count", metric.WithDescription("Total stock checks received"))
+	st.depletion, _ = meter.Int64Counter("stock_depletion_count", metric.WithDescription("Times a SKU ran out of stock"))
+	return st
+}
+
+func (s *service) handleCheck(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "check_inventory")
+	defer span.End()
+
+	sku := fmt.Sprintf("SKU-%d", hotSKUs+rand.IntN(skuCount-hotSKUs))
+	if rand.Float64() < hotShare {
+		sku = fmt.Sprintf("SKU-%d", rand.IntN(hotSKUs))
+	}
+	span.SetAttributes(attribute.String("inventory.sku", sku), attribute.String("inventory.warehouse", "us-west-2"))
+	s.stock.checks.Add(ctx, 1)
+
+	if s.chance(5) {
+		lock := time.Duration(2000+rand.IntN(3000)) * time.Millisecond
+		span.AddEvent("database_lock_contention", trace.WithAttributes(
+			attribute.String("lock_duration", lock.String()), attribute.String("table", "inventory_items")))
+		time.Sleep(lock)
+		span.SetAttributes(attribute.String("error.type", "database_lock"))
+		s.fail(ctx, w, span, http.StatusServiceUnavailable, fmt.Errorf("database lock timeout: inventory_items locked for %s", lock))
+		return
+	}
+
+	item := s.stock.items[sku]
+	waitStart := time.Now()
+	item.mu.Lock()
+	span.SetAttributes(attribute.Int64("inventory.lock_wait_ms", time.Since(waitStart).Milliseconds()))
+	time.Sleep(20 * time.Millisecond) // the stock query
+	want := 1 + rand.IntN(3)
+	if item.quantity < want {
+		item.quantity = 0
+		s.stock.depletion.Add(ctx, 1, metric.WithAttributes(attribute.String("sku", sku)))
+		span.AddEvent("restock", trace.WithAttributes(attribute.Int("quantity", restockLevel)))
+		s.log.WarnContext(ctx, "SKU out of stock, restocking", "sku", sku)
+		time.Sleep(100 * time.Millisecond)
+		item.quantity = restockLevel
+	}
+	item.quantity -= want
+	left := item.quantity
+	item.mu.Unlock()
+
+	span.SetAttributes(attribute.Int("inventory.reserved", want), attribute.Int("inventory.quantity_available", left))
+	w.Write([]byte("Inventory Available"))
+}
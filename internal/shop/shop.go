@@ -0,0 +1,209 @@
+// Package shop runs the example shop of test/ — order, payment, inventory, auth,
+// user, shipping and notification services — inside one process. Each service has
+// its own tracer, meter and logger exporting OTLP to an OtelContext endpoint under
+// its own service name, so the topology looks to OtelContext as if it ran as seven
+// programs. Drive sends traffic through it.
+//
+// Unlike internal/demo, which builds OTLP requests itself, the services here are real
+// HTTP servers instrumented with pkg/argusotel and otelhttp.
+package shop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/pkg/argusotel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Services lists the services in port order: with a BasePort of 9001 each listens on
+// the port its program in test/ uses.
+var Services = []string{
+	"order-service", "payment-service", "inventory-service", "auth-service",
+	"user-service", "shipping-service", "notification-service",
+}
+
+// maxInFlight bounds the requests Drive has outstanding; ticks beyond it are skipped.
+const maxInFlight = 64
+
+// Config describes a demo topology.
+type Config struct {
+	Endpoint string // OTLP gRPC endpoint of OtelContext, e.g. localhost:4317
+	Host     string // interface the services listen on; default 127.0.0.1
+	BasePort int    // the services listen on BasePort, BasePort+1, ...; 0 picks free ports
+
+	// ChaosLevel scales how often failures and slowdowns are injected: 1 is the rate
+	// of the programs in test/, 0 injects none, 2 twice as many.
+	ChaosLevel float64
+
+	RPS            float64       // requests per second sent by Drive
+	MetricInterval time.Duration // metric export interval; default 5s
+	LogWriter      io.Writer     // where service logs are printed besides exported; default stderr
+}
+
+// Topology is a running demo.
+type Topology struct {
+	cfg      Config
+	services []*service
+	urls     map[string]string // service name -> base URL
+}
+
+// Start starts every service. Call Shutdown to stop them and flush their telemetry.
+func Start(ctx context.Context, cfg Config) (*Topology, error) {
+	if cfg.Host == "" {
+		cfg.Host = "127.0.0.1"
+	}
+	if cfg.MetricInterval <= 0 {
+		cfg.MetricInterval = 5 * time.Second
+	}
+	t := &Topology{cfg: cfg, urls: make(map[string]string, len(Services))}
+
+	// Every service listens before any starts, so each knows where its peers are.
+	listeners := make([]net.Listener, 0, len(Services))
+	for i, name := range Services {
+		port := 0
+		if cfg.BasePort > 0 {
+			port = cfg.BasePort + i
+		}
+		lis, err := net.Listen("tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(port)))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		listeners = append(listeners, lis)
+		t.urls[name] = "http://" + lis.Addr().String()
+	}
+
+	for i, name := range Services {
+		opts := []argusotel.Option{
+			argusotel.WithInsecure(),
+			argusotel.WithMetricInterval(cfg.MetricInterval),
+			argusotel.WithResourceAttributes(attribute.String("deployment.environment", "demo")),
+		}
+		if cfg.LogWriter != nil {
+			opts = append(opts, argusotel.WithLogWriter(cfg.LogWriter))
+		}
+		p, err := argusotel.New(ctx, name, cfg.Endpoint, opts...)
+		if err != nil {
+			for _, l := range listeners[i:] {
+				l.Close()
+			}
+			t.Shutdown(ctx)
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		s := newService(name, p, t.urls, cfg.ChaosLevel)
+		t.services = append(t.services, s)
+		go s.srv.Serve(listeners[i])
+	}
+	return t, nil
+}
+
+// URL returns the base URL of a service, e.g. http://127.0.0.1:9001.
+func (t *Topology) URL(service string) string {
+	return t.urls[service]
+}
+
+// Shutdown stops the services and flushes their traces, metrics and logs.
+func (t *Topology) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, s := range t.services {
+		errs = append(errs, s.srv.Shutdown(ctx))
+	}
+	for _, s := range t.services {
+		errs = append(errs, s.providers.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// entryPoints are the requests Drive sends, weighted as in test/run_simulation.ps1.
+// An order fans out to every service.
+var entryPoints = []struct {
+	service, method, path string
+	weight                int
+}{
+	{"order-service", http.MethodPost, "/order", 6},
+	{"payment-service", http.MethodPost, "/pay", 2},
+	{"inventory-service", http.MethodPost, "/check", 2},
+	{"auth-service", http.MethodPost, "/validate", 1},
+	{"notification-service", http.MethodPost, "/notify", 1},
+}
+
+// DriveStats counts the requests Drive sent.
+type DriveStats struct {
+	Sent    int64 // requests sent
+	Failed  int64 // of which answered with an error status or not at all
+	Skipped int64 // ticks with maxInFlight requests still outstanding
+}
+
+// Drive sends requests to the entry points at the configured rate until ctx ends,
+// then waits for the outstanding ones.
+func (t *Topology) Drive(ctx context.Context) DriveStats {
+	var stats DriveStats
+	if t.cfg.RPS <= 0 {
+		<-ctx.Done()
+		return stats
+	}
+	total := 0
+	for _, e := range entryPoints {
+		total += e.weight
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / t.cfg.RPS))
+	defer ticker.Stop()
+
+	var sent, failed, skipped atomic.Int64
+	var wg sync.WaitGroup
+	inFlight := make(chan struct{}, maxInFlight)
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return DriveStats{Sent: sent.Load(), Failed: failed.Load(), Skipped: skipped.Load()}
+		case <-ticker.C:
+		}
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			skipped.Add(1)
+			continue
+		}
+
+		pick := rand.IntN(total)
+		e := entryPoints[0]
+		for _, e = range entryPoints {
+			if pick < e.weight {
+				break
+			}
+			pick -= e.weight
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			sent.Add(1)
+			// Not tied to ctx: a request already sent is allowed to finish.
+			req, _ := http.NewRequest(e.method, t.urls[e.service]+e.path, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				failed.Add(1)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				failed.Add(1)
+			}
+		}()
+	}
+}
@@ -0,0 +1,157 @@
+package shop
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/api"
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// startArgus runs the OTLP ingest services and the HTTP API over a fresh SQLite
+// database, and returns the gRPC endpoint and the API base URL.
+func startArgus(t *testing.T) (endpoint, apiURL string) {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "shop.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	agg := tsdb.NewAggregator(repo, time.Second)
+	go agg.Start(ctx)
+	t.Cleanup(func() { agg.Stop(); cancel() })
+
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, ingest.NewTraceServer(repo, nil, cfg))
+	collogspb.RegisterLogsServiceServer(srv, ingest.NewLogsServer(repo, nil, cfg))
+	colmetricspb.RegisterMetricsServiceServer(srv, ingest.NewMetricsServer(repo, nil, agg, cfg))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	mux := http.NewServeMux()
+	api.NewServer(repo, nil, nil).RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return lis.Addr().String(), ts.URL
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", url, resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("GET %s: %v in %s", url, err, body)
+	}
+}
+
+// TestTopologyEndToEnd drives the shop for a few seconds against an in-process
+// OtelContext and checks through the API that every service's traces, logs and
+// metrics arrived.
+func TestTopologyEndToEnd(t *testing.T) {
+	endpoint, apiURL := startArgus(t)
+
+	ctx := context.Background()
+	begin := time.Now().UTC()
+	topology, err := Start(ctx, Config{
+		Endpoint:       endpoint,
+		ChaosLevel:     1,
+		RPS:            50,
+		MetricInterval: 500 * time.Millisecond,
+		LogWriter:      io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	driveCtx, stop := context.WithTimeout(ctx, 3*time.Second)
+	defer stop()
+	stats := topology.Drive(driveCtx)
+	// Generous: under the race detector SQLite ingest trails the exporters.
+	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := topology.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if stats.Sent < 100 || stats.Failed == 0 || stats.Failed == stats.Sent {
+		t.Fatalf("stats = %+v, want 100 or more requests, some failed by chaos", stats)
+	}
+	// Let the aggregator flush the last metric window.
+	time.Sleep(2 * time.Second)
+
+	var traces struct {
+		Total int64 `json:"total"`
+	}
+	getJSON(t, apiURL+"/api/traces?limit=1", &traces)
+	if traces.Total < stats.Sent/2 {
+		t.Errorf("traces = %d, want most of the %d requests sent", traces.Total, stats.Sent)
+	}
+	var logs struct {
+		Total int64 `json:"total"`
+	}
+	getJSON(t, apiURL+"/api/logs?limit=1", &logs)
+	if logs.Total == 0 {
+		t.Error("no logs stored")
+	}
+
+	// The service map is built from spans; trace rows name only the service a trace
+	// was first seen from.
+	var serviceMap struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	}
+	getJSON(t, apiURL+"/api/metrics/service-map", &serviceMap)
+	var services []string
+	for _, n := range serviceMap.Nodes {
+		services = append(services, n.Name)
+	}
+	for _, name := range Services {
+		if !slices.Contains(services, name) {
+			t.Errorf("service map nodes = %v, missing %s", services, name)
+		}
+	}
+
+	var metrics []string
+	getJSON(t, apiURL+"/api/metadata/metrics?names_only=true", &metrics)
+	for _, name := range []string{"orders_processed_total", "stock_check_count"} {
+		if !slices.Contains(metrics, name) {
+			t.Errorf("metrics = %v, missing %s", metrics, name)
+		}
+	}
+	var buckets []json.RawMessage
+	getJSON(t, apiURL+"/api/metrics?name=stock_check_count&service_name=inventory-service&start="+
+		begin.Add(-time.Minute).Format(time.RFC3339)+"&end="+time.Now().UTC().Add(time.Minute).Format(time.RFC3339), &buckets)
+	if len(buckets) == 0 {
+		t.Error("no stock_check_count buckets stored")
+	}
+}
@@ -0,0 +1,59 @@
+// Package shutdown runs the steps of a graceful shutdown in order, under one
+// deadline, and reports the steps that did not finish.
+package shutdown
+
+import (
+	"context"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/logging"
+)
+
+var logger = logging.Component("shutdown")
+
+// Step is one stage of a shutdown. Run should return when its work is done; the ctx
+// it is given expires with the shutdown deadline.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Sequence is an ordered list of shutdown steps.
+type Sequence struct {
+	steps []Step
+}
+
+// Add appends a step.
+func (s *Sequence) Add(name string, run func(ctx context.Context) error) {
+	s.steps = append(s.steps, Step{Name: name, Run: run})
+}
+
+// Run runs the steps one after another and logs how long each took. A failing step
+// is logged and the next one runs. When ctx ends while a step is running, Run stops
+// waiting for it and returns the names of that step and of the steps that never
+// started; the caller should then exit without waiting further.
+func (s *Sequence) Run(ctx context.Context) (unfinished []string) {
+	start := time.Now()
+	for i, step := range s.steps {
+		began := time.Now()
+		done := make(chan error, 1)
+		go func() { done <- step.Run(ctx) }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				logger.Error("Shutdown step failed", "step", step.Name, "duration", time.Since(began), "error", err)
+			} else {
+				logger.Info("Shutdown step done", "step", step.Name, "duration", time.Since(began))
+			}
+		case <-ctx.Done():
+			for _, rest := range s.steps[i:] {
+				unfinished = append(unfinished, rest.Name)
+			}
+			logger.Error("Shutdown step did not finish in time", "step", step.Name, "duration", time.Since(began))
+			return unfinished
+		}
+	}
+	logger.Info("Shutdown sequence done", "steps", len(s.steps), "duration", time.Since(start))
+	return nil
+}
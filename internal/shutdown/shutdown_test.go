@@ -0,0 +1,224 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestSequenceRunsStepsInOrder(t *testing.T) {
+	var order []string
+	var seq Sequence
+	for _, name := range []string{"a", "b", "c"} {
+		seq.Add(name, func(context.Context) error {
+			order = append(order, name)
+			if name == "b" {
+				return errors.New("b failed")
+			}
+			return nil
+		})
+	}
+	if unfinished := seq.Run(context.Background()); unfinished != nil {
+		t.Errorf("unfinished = %v, want none", unfinished)
+	}
+	if !reflect.DeepEqual(order, []string{"a", "b", "c"}) {
+		t.Errorf("ran %v, want a, b, c: a failing step does not stop the sequence", order)
+	}
+}
+
+func TestSequenceReportsUnfinishedSteps(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+
+	var seq Sequence
+	seq.Add("quick", func(context.Context) error { return nil })
+	seq.Add("stuck", func(context.Context) error { <-block; return nil })
+	seq.Add("never", func(context.Context) error { t.Error("step after a timeout ran"); return nil })
+	if got := seq.Run(ctx); !reflect.DeepEqual(got, []string{"stuck", "never"}) {
+		t.Errorf("unfinished = %v, want stuck and never", got)
+	}
+}
+
+func strAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+// TestShutdownKeepsAcceptedData runs the ingest pipeline in-process, exports to it,
+// sends the process SIGTERM and shuts down in the order main does. Everything
+// accepted before the signal must be stored, including metric points still
+// aggregating in memory and logs still queued for fan-out.
+func TestShutdownKeepsAcceptedData(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "shutdown.db")
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", dsn)
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+
+	// A window far longer than the test: only the shutdown flush persists metrics.
+	agg := tsdb.NewAggregator(repo, time.Hour)
+	ctxAgg, cancelAgg := context.WithCancel(context.Background())
+	defer cancelAgg()
+	go agg.Start(ctxAgg)
+
+	var fannedOut atomic.Int64
+	dispatcher := ingest.NewLogDispatcher(0, func(batch []storage.Log) {
+		time.Sleep(time.Millisecond) // slower than ingest, so batches queue up
+		fannedOut.Add(int64(len(batch)))
+	})
+	ctxDispatch, cancelDispatch := context.WithCancel(context.Background())
+	dispatchDone := make(chan struct{})
+	go func() {
+		dispatcher.Start(ctxDispatch)
+		close(dispatchDone)
+	}()
+
+	cfg := &config.Config{IngestMinSeverity: "DEBUG"}
+	logsServer := ingest.NewLogsServer(repo, nil, cfg)
+	logsServer.SetLogCallback(dispatcher.Dispatch)
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, ingest.NewTraceServer(repo, nil, cfg))
+	collogspb.RegisterLogsServiceServer(srv, logsServer)
+	colmetricspb.RegisterMetricsServiceServer(srv, ingest.NewMetricsServer(repo, nil, agg, cfg))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	const exports, perExport = 20, 5
+	resource := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{strAttr("service.name", "checkout")}}
+	now := uint64(time.Now().UnixNano())
+	ctx := context.Background()
+	for i := range exports {
+		var logs []*logspb.LogRecord
+		for j := range perExport {
+			logs = append(logs, &logspb.LogRecord{TimeUnixNano: now + uint64(i*perExport+j), SeverityText: "INFO",
+				Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprintf("log %d.%d", i, j)}}})
+		}
+		if _, err := collogspb.NewLogsServiceClient(conn).Export(ctx, &collogspb.ExportLogsServiceRequest{
+			ResourceLogs: []*logspb.ResourceLogs{{Resource: resource, ScopeLogs: []*logspb.ScopeLogs{{LogRecords: logs}}}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		traceID := []byte(fmt.Sprintf("trace-%010d", i))
+		if _, err := coltracepb.NewTraceServiceClient(conn).Export(ctx, &coltracepb.ExportTraceServiceRequest{
+			ResourceSpans: []*tracepb.ResourceSpans{{Resource: resource, ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{
+				TraceId: traceID, SpanId: []byte("span0001"), Name: "GET /cart",
+				StartTimeUnixNano: now, EndTimeUnixNano: now + uint64(time.Millisecond),
+			}}}}}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := colmetricspb.NewMetricsServiceClient(conn).Export(ctx, &colmetricspb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricspb.ResourceMetrics{{Resource: resource, ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: "queue_depth",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{{
+					TimeUnixNano: now, Value: &metricspb.NumberDataPoint_AsInt{AsInt: int64(i)},
+					Attributes: []*commonpb.KeyValue{strAttr("queue", fmt.Sprint(i))},
+				}}}},
+			}}}}}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-signals:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM not received")
+	}
+
+	var seq Sequence
+	seq.Add("listeners", func(context.Context) error {
+		srv.GracefulStop()
+		return nil
+	})
+	seq.Add("ingest dispatch", func(context.Context) error {
+		cancelDispatch()
+		<-dispatchDone
+		return nil
+	})
+	seq.Add("flush", func(context.Context) error {
+		agg.Stop()
+		return nil
+	})
+	seq.Add("database", func(context.Context) error {
+		return repo.Close()
+	})
+	ctxShutdown, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if unfinished := seq.Run(ctxShutdown); unfinished != nil {
+		t.Fatalf("unfinished steps: %v", unfinished)
+	}
+
+	if _, err := collogspb.NewLogsServiceClient(conn).Export(ctx, &collogspb.ExportLogsServiceRequest{}); err == nil {
+		t.Error("export after shutdown accepted")
+	}
+	if got := fannedOut.Load(); got != exports*perExport {
+		t.Errorf("fanned out %d logs, want %d", got, exports*perExport)
+	}
+
+	reopened, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for _, c := range []struct {
+		model any
+		want  int64
+	}{
+		{&storage.Log{}, exports * perExport},
+		{&storage.Span{}, exports},
+		{&storage.MetricBucket{}, exports},
+	} {
+		var n int64
+		if err := reopened.DB().Model(c.model).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n != c.want {
+			t.Errorf("%T rows = %d, want %d", c.model, n, c.want)
+		}
+	}
+}
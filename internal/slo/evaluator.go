@@ -0,0 +1,141 @@
+// Package slo evaluates operation-level latency SLOs against persisted spans.
+// Each tick computes, per SLO, the observed latency at the target percentile,
+// the share of spans within the threshold, and the error budget burn rate.
+package slo
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// statusRetention is how long evaluation history is kept.
+const statusRetention = 7 * 24 * time.Hour
+
+// Evaluator periodically evaluates all SLOs and persists an SLOStatus per SLO.
+type Evaluator struct {
+	repo     *storage.Repository
+	interval time.Duration
+
+	mu       sync.Mutex
+	breached map[uint]bool // last known breach state per SLO ID
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates an SLO evaluator that runs every interval.
+func New(repo *storage.Repository, interval time.Duration) *Evaluator {
+	return &Evaluator{
+		repo:     repo,
+		interval: interval,
+		breached: make(map[uint]bool),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start runs the evaluation loop. Blocks until ctx is cancelled or Stop is called.
+func (e *Evaluator) Start(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.stopCh:
+			return
+		case <-ticker.C:
+			e.EvaluateOnce()
+		}
+	}
+}
+
+// Stop terminates the evaluation loop.
+func (e *Evaluator) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+	})
+}
+
+// EvaluateOnce evaluates every SLO once and returns the recorded statuses.
+func (e *Evaluator) EvaluateOnce() []storage.SLOStatus {
+	slos, err := e.repo.ListSLOs()
+	if err != nil {
+		slog.Error("SLO: failed to list SLOs", "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	statuses := make([]storage.SLOStatus, 0, len(slos))
+	for _, s := range slos {
+		st, err := e.evaluate(s, now)
+		if err != nil {
+			slog.Error("SLO: evaluation failed", "slo_id", s.ID, "service", s.ServiceName, "operation", s.Operation, "error", err)
+			continue
+		}
+		e.mu.Lock()
+		wasBreached := e.breached[s.ID]
+		e.breached[s.ID] = st.Breached
+		e.mu.Unlock()
+
+		// A transition into breach is stored with its outbox event, which notifies
+		// the live clients and the webhook
+		create := e.repo.CreateSLOStatus
+		if st.Breached && !wasBreached {
+			create = e.repo.CreateSLOBreach
+		}
+		if err := create(&st); err != nil {
+			slog.Error("SLO: failed to persist status", "slo_id", s.ID, "error", err)
+		}
+		statuses = append(statuses, st)
+
+		if st.Breached && !wasBreached {
+			slog.Warn("🚨 SLO breached",
+				"service", s.ServiceName, "operation", s.Operation,
+				"percentile", s.Percentile, "threshold_ms", s.ThresholdMs, "actual_ms", st.ActualMs)
+		}
+	}
+
+	if _, err := e.repo.PruneSLOStatuses(now.Add(-statusRetention)); err != nil {
+		slog.Error("SLO: failed to prune status history", "error", err)
+	}
+	return statuses
+}
+
+// evaluate computes a single SLO's status over its window ending at now.
+func (e *Evaluator) evaluate(s storage.SLO, now time.Time) (storage.SLOStatus, error) {
+	window := time.Duration(s.WindowMinutes) * time.Minute
+	stats, err := e.repo.GetOperationLatencyStats(s.ServiceName, s.Operation, now.Add(-window), now, s.Percentile, s.ThresholdMs)
+	if err != nil {
+		return storage.SLOStatus{}, err
+	}
+
+	st := storage.SLOStatus{
+		SLOID:         s.ID,
+		ServiceName:   s.ServiceName,
+		Operation:     s.Operation,
+		ActualMs:      stats.PercentileMs,
+		CompliancePct: 100,
+		SampleCount:   stats.Total,
+		EvaluatedAt:   now,
+	}
+	if stats.Total == 0 {
+		return st, nil
+	}
+
+	compliance := float64(stats.WithinTarget) / float64(stats.Total)
+	st.CompliancePct = math.Round(compliance*10000) / 100
+
+	// The error budget is the share of spans allowed above the threshold, e.g. 5% for p95.
+	budget := 1 - s.Percentile/100
+	if budget > 0 {
+		st.BurnRate = math.Round((1-compliance)/budget*100) / 100
+	}
+	st.Breached = stats.PercentileMs > s.ThresholdMs
+	return st, nil
+}
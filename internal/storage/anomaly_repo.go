@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+// ServiceTraffic is the number of traces, and of failed traces, one service received
+// in a time range.
+type ServiceTraffic struct {
+	ServiceName string `json:"service_name"`
+	Count       int64  `json:"count"`
+	ErrorCount  int64  `json:"error_count"`
+}
+
+// AnomalyFilter selects anomaly events for listing.
+type AnomalyFilter struct {
+	ServiceName string
+	Since       time.Time
+	Limit       int
+	Offset      int
+}
+
+// GetServiceTraffic returns per-service trace and error counts for traces started in
+// [start, end). Errors are counted with the same status match as GetTrafficMetrics.
+func (r *Repository) GetServiceTraffic(start, end time.Time) ([]ServiceTraffic, error) {
+	var rows []ServiceTraffic
+	err := r.db.Model(&Trace{}).
+		Select("service_name, COUNT(*) AS count, SUM(CASE WHEN UPPER(status) LIKE '%ERROR%' THEN 1 ELSE 0 END) AS error_count").
+		Where("timestamp >= ? AND timestamp < ?", start, end).
+		Group("service_name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service traffic: %w", err)
+	}
+	return rows, nil
+}
+
+// CreateAnomalyEvent records a detected anomaly, and an outbox event announcing it.
+func (r *Repository) CreateAnomalyEvent(ev *AnomalyEvent) error {
+	if err := r.createAnnounced(ev, OutboxAnomaly, "", ev.ServiceName); err != nil {
+		return fmt.Errorf("failed to create anomaly event: %w", err)
+	}
+	return nil
+}
+
+// ListAnomalyEvents returns anomaly events matching the filter, newest first, along
+// with the total match count.
+func (r *Repository) ListAnomalyEvents(filter AnomalyFilter) ([]AnomalyEvent, int64, error) {
+	var events []AnomalyEvent
+	var total int64
+
+	base := r.db.Model(&AnomalyEvent{})
+	if filter.ServiceName != "" {
+		base = base.Where("service_name = ?", filter.ServiceName)
+	}
+	if !filter.Since.IsZero() {
+		base = base.Where("detected_at >= ?", filter.Since)
+	}
+
+	var g errgroup.Group
+	g.Go(func() error {
+		return base.Session(&gorm.Session{}).Count(&total).Error
+	})
+	g.Go(func() error {
+		return base.Session(&gorm.Session{}).
+			Order("detected_at desc, id desc").
+			Limit(filter.Limit).
+			Offset(filter.Offset).
+			Find(&events).Error
+	})
+	if err := g.Wait(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list anomaly events: %w", err)
+	}
+	return events, total, nil
+}
+
+// PruneAnomalyEvents deletes anomaly events detected before the given time.
+func (r *Repository) PruneAnomalyEvents(olderThan time.Time) (int64, error) {
+	result := r.db.Where("detected_at < ?", olderThan).Delete(&AnomalyEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune anomaly events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetServiceTraffic(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	var traces []Trace
+	for i := 0; i < 10; i++ {
+		status := "STATUS_CODE_OK"
+		if i < 3 {
+			status = "STATUS_CODE_ERROR"
+		}
+		traces = append(traces, Trace{TraceID: fmt.Sprintf("c%d", i), ServiceName: "checkout", Status: status, Timestamp: now.Add(-30 * time.Second)})
+	}
+	traces = append(traces,
+		Trace{TraceID: "p1", ServiceName: "payments", Status: "STATUS_CODE_OK", Timestamp: now.Add(-10 * time.Second)},
+		Trace{TraceID: "old", ServiceName: "payments", Status: "STATUS_CODE_ERROR", Timestamp: now.Add(-time.Hour)},
+	)
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatalf("BatchCreateTraces() error = %v", err)
+	}
+
+	rows, err := repo.GetServiceTraffic(now.Add(-time.Minute), now)
+	if err != nil {
+		t.Fatalf("GetServiceTraffic() error = %v", err)
+	}
+	got := make(map[string]ServiceTraffic)
+	for _, r := range rows {
+		got[r.ServiceName] = r
+	}
+	if c := got["checkout"]; c.Count != 10 || c.ErrorCount != 3 {
+		t.Errorf("checkout = %+v, want 10 requests and 3 errors", c)
+	}
+	if p := got["payments"]; p.Count != 1 || p.ErrorCount != 0 {
+		t.Errorf("payments = %+v, want 1 request and no errors", p)
+	}
+}
+
+func TestListAnomalyEvents(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	for i, svc := range []string{"checkout", "payments", "checkout"} {
+		ev := &AnomalyEvent{ServiceName: svc, Signal: "request_rate", DetectedAt: now.Add(time.Duration(i) * time.Minute)}
+		if err := repo.CreateAnomalyEvent(ev); err != nil {
+			t.Fatalf("CreateAnomalyEvent() error = %v", err)
+		}
+	}
+
+	events, total, err := repo.ListAnomalyEvents(AnomalyFilter{ServiceName: "checkout", Limit: 10})
+	if err != nil {
+		t.Fatalf("ListAnomalyEvents() error = %v", err)
+	}
+	if total != 2 || len(events) != 2 || !events[0].DetectedAt.After(events[1].DetectedAt) {
+		t.Errorf("events = %+v (total %d), want 2 newest first", events, total)
+	}
+
+	if _, total, _ := repo.ListAnomalyEvents(AnomalyFilter{Since: now.Add(90 * time.Second), Limit: 10}); total != 1 {
+		t.Errorf("total since +90s = %d, want 1", total)
+	}
+}
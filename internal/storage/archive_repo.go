@@ -87,11 +87,14 @@ func (r *Repository) DeleteTracesByIDs(ids []uint) error {
 	}
 	// Delete associated spans and logs first to avoid FK issues
 	traceIDs := make([]string, 0)
-	r.db.Model(&Trace{}).Where("id IN ?", ids).Pluck("trace_id", &traceIDs)
+	r.primary().Model(&Trace{}).Where("id IN ?", ids).Pluck("trace_id", &traceIDs)
 
 	if len(traceIDs) > 0 {
 		r.db.Where("trace_id IN ?", traceIDs).Delete(&Span{})
+		deleteLogAttributes(r.db, r.db.Model(&Log{}).Where("trace_id IN ?", traceIDs))
 		r.db.Where("trace_id IN ?", traceIDs).Delete(&Log{})
+		r.db.Where("trace_id IN ?", traceIDs).Delete(&TraceAnnotation{})
+		r.db.Where("trace_id IN ?", traceIDs).Delete(&SpanLink{})
 	}
 
 	return r.db.Where("id IN ?", ids).Delete(&Trace{}).Error
@@ -102,6 +105,9 @@ func (r *Repository) DeleteLogsByIDs(ids []uint) error {
 	if len(ids) == 0 {
 		return nil
 	}
+	if err := deleteLogAttributes(r.db, r.db.Model(&Log{}).Where("id IN ?", ids)); err != nil {
+		return err
+	}
 	return r.db.Where("id IN ?", ids).Delete(&Log{}).Error
 }
 
@@ -116,21 +122,22 @@ func (r *Repository) DeleteMetricsByIDs(ids []uint) error {
 // HotDBSizeBytes returns an approximate size of the hot DB in bytes.
 // For SQLite this reads the file size. For others it queries pg_database_size / information_schema.
 func (r *Repository) HotDBSizeBytes() int64 {
+	db := r.primary()
 	switch r.driver {
 	case "sqlite", "":
 		var pageCount, pageSize int64
-		r.db.Raw("PRAGMA page_count").Scan(&pageCount)
-		r.db.Raw("PRAGMA page_size").Scan(&pageSize)
+		db.Raw("PRAGMA page_count").Scan(&pageCount)
+		db.Raw("PRAGMA page_size").Scan(&pageSize)
 		return pageCount * pageSize
 
 	case "postgres", "postgresql":
 		var size int64
-		r.db.Raw("SELECT pg_database_size(current_database())").Scan(&size)
+		db.Raw("SELECT pg_database_size(current_database())").Scan(&size)
 		return size
 
 	case "mysql":
 		var size int64
-		r.db.Raw(`SELECT SUM(data_length + index_length) FROM information_schema.tables
+		db.Raw(`SELECT SUM(data_length + index_length) FROM information_schema.tables
 			WHERE table_schema = DATABASE()`).Scan(&size)
 		return size
 
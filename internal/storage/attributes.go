@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Attributes are stored as a plain JSON object, {"http.method": "GET", "retries": 2},
+// with kvlists as nested objects and arrays as lists. Earlier releases stored
+// json.Marshal of the OTLP KeyValue protos instead:
+//
+//	[{"key":"http.method","value":{"Value":{"StringValue":"GET"}}}]
+//
+// Rows of that shape are converted when read, so clients only ever see the plain one.
+
+// legacyKeyValue and legacyAnyValue decode the protobuf structs as encoding/json
+// wrote them: the oneof wrapper holds exactly one field named after its variant.
+type legacyKeyValue struct {
+	Key   string          `json:"key"`
+	Value *legacyAnyValue `json:"value"`
+}
+
+type legacyAnyValue struct {
+	Value map[string]json.RawMessage `json:"Value"`
+}
+
+// cleanAttributes returns raw converted to a plain JSON object when it is a legacy
+// KeyValue list, and raw itself otherwise.
+func cleanAttributes(raw string) string {
+	trimmed := strings.TrimSpace(raw)
+	if !strings.HasPrefix(trimmed, "[") {
+		return raw
+	}
+	var list []legacyKeyValue
+	if json.Unmarshal([]byte(trimmed), &list) != nil {
+		return raw
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	out := make(map[string]any, len(list))
+	for _, kv := range list {
+		out[kv.Key] = kv.Value.plain()
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return raw
+	}
+	return string(b)
+}
+
+func (v *legacyAnyValue) plain() any {
+	if v == nil {
+		return nil
+	}
+	for variant, x := range v.Value {
+		switch variant {
+		case "ArrayValue", "KvlistValue":
+			var list struct {
+				Values json.RawMessage `json:"values"`
+			}
+			if json.Unmarshal(x, &list) != nil {
+				return nil
+			}
+			if variant == "ArrayValue" {
+				var values []*legacyAnyValue
+				json.Unmarshal(list.Values, &values)
+				out := make([]any, len(values))
+				for i, e := range values {
+					out[i] = e.plain()
+				}
+				return out
+			}
+			var kvs []legacyKeyValue
+			json.Unmarshal(list.Values, &kvs)
+			out := make(map[string]any, len(kvs))
+			for _, kv := range kvs {
+				out[kv.Key] = kv.Value.plain()
+			}
+			return out
+		default:
+			// StringValue, IntValue, DoubleValue, BoolValue and BytesValue (already
+			// base64) are JSON scalars as they are
+			var scalar any
+			dec := json.NewDecoder(bytes.NewReader(x))
+			dec.UseNumber() // keep int64 values exact
+			if dec.Decode(&scalar) != nil {
+				return nil
+			}
+			return scalar
+		}
+	}
+	return nil
+}
+
+// AfterFind converts legacy attributes of a span read from the database.
+func (s *Span) AfterFind(*gorm.DB) error {
+	s.AttributesJSON = CompressedText(cleanAttributes(string(s.AttributesJSON)))
+	return nil
+}
+
+// AfterFind converts legacy attributes of a span link read from the database.
+func (l *SpanLink) AfterFind(*gorm.DB) error {
+	l.AttributesJSON = CompressedText(cleanAttributes(string(l.AttributesJSON)))
+	return nil
+}
+
+// AfterFind converts legacy attributes of a log read from the database.
+func (l *Log) AfterFind(*gorm.DB) error {
+	l.AttributesJSON = CompressedText(cleanAttributes(string(l.AttributesJSON)))
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanAttributes(t *testing.T) {
+	for _, tc := range []struct{ name, in, want string }{
+		{"string", `[{"key":"s","value":{"Value":{"StringValue":"x"}}}]`, `{"s":"x"}`},
+		{"int", `[{"key":"i","value":{"Value":{"IntValue":9223372036854775807}}}]`, `{"i":9223372036854775807}`},
+		{"double", `[{"key":"d","value":{"Value":{"DoubleValue":1.5}}}]`, `{"d":1.5}`},
+		{"bool", `[{"key":"b","value":{"Value":{"BoolValue":false}}}]`, `{"b":false}`},
+		{"bytes", `[{"key":"y","value":{"Value":{"BytesValue":"aGk="}}}]`, `{"y":"aGk="}`},
+		{"array", `[{"key":"a","value":{"Value":{"ArrayValue":{"values":[{"Value":{"IntValue":0}},{"Value":{"ArrayValue":{}}}]}}}}]`, `{"a":[0,[]]}`},
+		{"kvlist", `[{"key":"k","value":{"Value":{"KvlistValue":{"values":[{"key":"n","value":{"Value":null}},` +
+			`{"key":"o","value":{"Value":{"KvlistValue":{"values":[{"key":"p","value":{"Value":{"StringValue":"q"}}}]}}}}]}}}}]`,
+			`{"k":{"n":null,"o":{"p":"q"}}}`},
+		{"no value", `[{"key":"e"}]`, `{"e":null}`},
+		{"empty list", `[]`, ``},
+		{"plain object", `{"s":"x"}`, `{"s":"x"}`},
+		{"not JSON", `[oops`, `[oops`},
+		{"empty", ``, ``},
+	} {
+		if got := cleanAttributes(tc.in); got != tc.want {
+			t.Errorf("%s: cleanAttributes() = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLegacyAttributesConvertedOnRead(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	const legacy = `[{"key":"http.method","value":{"Value":{"StringValue":"GET"}}},{"key":"retries","value":{"Value":{"IntValue":2}}}]`
+	const clean = `{"http.method":"GET","retries":2}`
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "t1", ServiceName: "api", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]Span{
+		{TraceID: "t1", SpanID: "s1", ServiceName: "api", StartTime: now, AttributesJSON: legacy},
+		{TraceID: "t1", SpanID: "s2", ServiceName: "api", StartTime: now, AttributesJSON: clean},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs([]Log{{TraceID: "t1", ServiceName: "api", Body: "hi", Timestamp: now, AttributesJSON: legacy}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := repo.GetTrace("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range tr.Spans {
+		if s.AttributesJSON != clean {
+			t.Errorf("span %s attributes = %s, want %s", s.SpanID, s.AttributesJSON, clean)
+		}
+	}
+	if len(tr.Logs) != 1 || tr.Logs[0].AttributesJSON != clean {
+		t.Errorf("logs = %+v, want the attributes as %s", tr.Logs, clean)
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+// AuditFilter selects audit entries for listing.
+type AuditFilter struct {
+	Start  time.Time
+	End    time.Time
+	Limit  int
+	Offset int
+}
+
+// CreateAuditEntry records a call to an admin endpoint.
+func (r *Repository) CreateAuditEntry(e *AuditEntry) error {
+	if err := r.db.Create(e).Error; err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries returns audit entries in [Start, End], newest first, along with
+// the total match count. Zero bounds are open.
+func (r *Repository) ListAuditEntries(filter AuditFilter) ([]AuditEntry, int64, error) {
+	var entries []AuditEntry
+	var total int64
+
+	base := r.db.Model(&AuditEntry{})
+	if !filter.Start.IsZero() {
+		base = base.Where("timestamp >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		base = base.Where("timestamp <= ?", filter.End)
+	}
+
+	var g errgroup.Group
+	g.Go(func() error {
+		return base.Session(&gorm.Session{}).Count(&total).Error
+	})
+	g.Go(func() error {
+		return base.Session(&gorm.Session{}).
+			Order("timestamp desc, id desc").
+			Limit(filter.Limit).
+			Offset(filter.Offset).
+			Find(&entries).Error
+	})
+	if err := g.Wait(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	return entries, total, nil
+}
+
+// PruneAuditEntries deletes audit entries recorded before the given time.
+func (r *Repository) PruneAuditEntries(olderThan time.Time) (int64, error) {
+	result := r.db.Where("timestamp < ?", olderThan).Delete(&AuditEntry{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune audit entries: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrBackupUnsupported is returned by Backup and Restore for drivers other than SQLite;
+// server databases have their own backup tooling.
+var ErrBackupUnsupported = errors.New("backup and restore are only supported for the sqlite driver; use the database's own backup tools")
+
+// ErrInvalidBackup is returned by Restore when the file is not a sound OtelContext
+// SQLite database.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// RestoreResult reports what Restore loaded, per table.
+type RestoreResult struct {
+	Tables   map[string]int64 `json:"tables"` // rows restored
+	Duration float64          `json:"duration_seconds"`
+}
+
+func (r *Repository) isSQLite() bool {
+	return r.driver == "sqlite" || r.driver == ""
+}
+
+// Backup writes a consistent snapshot of the database to a new file in dir and returns
+// its path; the caller removes it. The snapshot is taken with VACUUM INTO, which reads
+// in a single transaction, so with WAL ingestion carries on while it is written.
+func (r *Repository) Backup(ctx context.Context, dir string) (string, error) {
+	if !r.isSQLite() {
+		return "", ErrBackupUnsupported
+	}
+	f, err := os.CreateTemp(dir, "otelcontext-backup-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	path := f.Name()
+	f.Close()
+	os.Remove(path) // VACUUM INTO refuses to overwrite a file
+
+	start := time.Now()
+	slog.Info("Database backup started", "path", path)
+	if err := r.db.WithContext(ctx).Exec("VACUUM INTO ?", path).Error; err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	var size int64
+	if fi, err := os.Stat(path); err == nil {
+		size = fi.Size()
+	}
+	slog.Info("Database backup written", "path", path, "bytes", size, "duration", time.Since(start))
+	return path, nil
+}
+
+// Restore replaces the contents of every OtelContext table with those of the backup at
+// path. The backup is checked first with PRAGMA integrity_check. It is then attached
+// and copied over in a single transaction, so readers see either the old data or the
+// restored data, and the connection pool stays usable throughout: nothing has to be
+// reopened. Columns missing from an older backup get their defaults; tables missing
+// from it are left empty. Ingestion waits for the transaction to commit.
+func (r *Repository) Restore(ctx context.Context, path string) (*RestoreResult, error) {
+	if !r.isSQLite() {
+		return nil, ErrBackupUnsupported
+	}
+	start := time.Now()
+	if err := verifyBackup(ctx, path); err != nil {
+		return nil, err
+	}
+	tables, err := r.tableNames()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RestoreResult{Tables: make(map[string]int64, len(tables))}
+	slog.Warn("Database restore started", "path", path, "tables", len(tables))
+	err = r.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("ATTACH DATABASE ? AS restore_src", path).Error; err != nil {
+			return fmt.Errorf("failed to attach backup: %w", err)
+		}
+		defer conn.Exec("DETACH DATABASE restore_src")
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("PRAGMA defer_foreign_keys = ON").Error; err != nil {
+				return err
+			}
+			// Children before parents, then parents first on the way back in.
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Exec(`DELETE FROM main."` + tables[i] + `"`).Error; err != nil {
+					return fmt.Errorf("failed to clear %s: %w", tables[i], err)
+				}
+			}
+			for _, table := range tables {
+				cols, err := sharedColumns(tx, table)
+				if err != nil {
+					return err
+				}
+				if len(cols) == 0 {
+					continue // not in this backup
+				}
+				list := strings.Join(cols, ", ")
+				result := tx.Exec(fmt.Sprintf(`INSERT INTO main."%s" (%s) SELECT %s FROM restore_src."%s"`, table, list, list, table))
+				if result.Error != nil {
+					return fmt.Errorf("failed to restore %s: %w", table, result.Error)
+				}
+				res.Tables[table] = result.RowsAffected
+				slog.Info("Restored table", "table", table, "rows", result.RowsAffected)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Duration = time.Since(start).Seconds()
+	slog.Warn("Database restore finished", "path", path, "duration", time.Since(start))
+	return res, nil
+}
+
+// sharedColumns returns the quoted columns of table present both in the live database
+// and in the attached backup; none when the backup lacks the table.
+func sharedColumns(tx *gorm.DB, table string) ([]string, error) {
+	var src []string
+	if err := tx.Raw("SELECT name FROM pragma_table_info(?, 'restore_src')", table).Scan(&src).Error; err != nil {
+		return nil, fmt.Errorf("failed to read backup columns of %s: %w", table, err)
+	}
+	inBackup := make(map[string]bool, len(src))
+	for _, c := range src {
+		inBackup[c] = true
+	}
+	var live []string
+	if err := tx.Raw("SELECT name FROM pragma_table_info(?, 'main')", table).Scan(&live).Error; err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	var cols []string
+	for _, c := range live {
+		if inBackup[c] {
+			cols = append(cols, `"`+c+`"`)
+		}
+	}
+	return cols, nil
+}
+
+// verifyBackup opens the file read-only and checks that it is an intact SQLite
+// database holding OtelContext's tables.
+func verifyBackup(ctx context.Context, path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	db, err := gorm.Open(sqlite.Open("file:"+abs+"?mode=ro"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	db = db.WithContext(ctx)
+
+	var lines []string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&lines).Error; err != nil {
+		return fmt.Errorf("%w: not a SQLite database (%v)", ErrInvalidBackup, err)
+	}
+	if len(lines) != 1 || lines[0] != "ok" {
+		if len(lines) > 5 {
+			lines = append(lines[:5], "...")
+		}
+		return fmt.Errorf("%w: integrity check failed: %s", ErrInvalidBackup, strings.Join(lines, "; "))
+	}
+	if !db.Migrator().HasTable(&Trace{}) {
+		return fmt.Errorf("%w: no traces table; not an OtelContext database", ErrInvalidBackup)
+	}
+	return nil
+}
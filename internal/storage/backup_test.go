@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupAndRestoreSQLite(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "kept", ServiceName: "cart", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]Span{{TraceID: "kept", SpanID: "s1", ServiceName: "cart", OperationName: "GET /cart", StartTime: now, EndTime: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs([]Log{{TraceID: "kept", ServiceName: "cart", Severity: "INFO", Body: "hello", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := repo.Backup(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	// Changes after the backup are undone by the restore.
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "later", ServiceName: "auth", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.PurgeLogs(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.Restore(ctx, path)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if res.Tables["traces"] != 1 || res.Tables["spans"] != 1 || res.Tables["logs"] != 1 {
+		t.Errorf("restored rows = %v, want one trace, span and log", res.Tables)
+	}
+	var ids []string
+	repo.db.Model(&Trace{}).Pluck("trace_id", &ids)
+	if len(ids) != 1 || ids[0] != "kept" {
+		t.Errorf("traces after restore = %v, want [kept]", ids)
+	}
+	logs, _, err := repo.GetLogsV2Context(ctx, LogFilter{Limit: 10})
+	if err != nil || len(logs) != 1 || string(logs[0].Body) != "hello" {
+		t.Errorf("logs after restore = %v (%v), want the backed-up log", logs, err)
+	}
+	// The pool is still usable for writes.
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "after", ServiceName: "cart", Timestamp: now}}); err != nil {
+		t.Errorf("write after restore: %v", err)
+	}
+}
+
+func TestRestoreRejectsInvalidBackups(t *testing.T) {
+	repo := newTestRepository(t)
+	dir := t.TempDir()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("definitely not a database, just some bytes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	foreign := filepath.Join(dir, "foreign.db")
+	db, err := NewDatabase("sqlite", foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY)")
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	for _, path := range []string{garbage, foreign} {
+		if _, err := repo.Restore(context.Background(), path); !errors.Is(err, ErrInvalidBackup) {
+			t.Errorf("Restore(%s) error = %v, want ErrInvalidBackup", filepath.Base(path), err)
+		}
+	}
+
+	repo.driver = "postgres"
+	if _, err := repo.Backup(context.Background(), dir); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("Backup() on postgres error = %v, want ErrBackupUnsupported", err)
+	}
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tables whose inserts are batched, each sized on its own: a batch of metric buckets
+// takes a fraction of the time of a batch of logs with large bodies.
+const (
+	BatchTableLogs    = "logs"
+	BatchTableSpans   = "spans"
+	BatchTableTraces  = "traces"
+	BatchTableMetrics = "metric_buckets"
+)
+
+var batchTables = []string{BatchTableLogs, BatchTableSpans, BatchTableTraces, BatchTableMetrics}
+
+// DefaultBatchSize returns the insert batch size used for driver unless configured.
+// MySQL and Postgres handle large multi-row inserts well; SQL Server caps a statement
+// at 2100 parameters, about 100 spans.
+func DefaultBatchSize(driver string) int {
+	switch strings.ToLower(driver) {
+	case "mysql":
+		return 2000
+	case "postgres", "postgresql":
+		return 1000
+	case "sqlserver", "mssql":
+		return 100
+	default:
+		return 500
+	}
+}
+
+// batchIncrease is the number of rows an adaptive batch grows by after a batch that
+// was full and within the target latency.
+const batchIncrease = 50
+
+// BatchSizer picks the number of rows per insert statement. A fixed sizer always
+// returns the same size. An adaptive one adjusts it between min and max from the
+// observed latency per batch (AIMD): it grows by batchIncrease after a full batch
+// that met the target, and halves after a batch that missed it.
+type BatchSizer struct {
+	mu       sync.Mutex
+	size     int
+	min, max int
+	target   time.Duration // 0 = fixed
+	onChange func(size int)
+}
+
+// NewBatchSizer returns a sizer that always uses size.
+func NewBatchSizer(size int) *BatchSizer {
+	return &BatchSizer{size: size, min: size, max: size}
+}
+
+// NewAdaptiveBatchSizer returns a sizer starting at size, clamped to [min, max], that
+// aims for batches taking at most target.
+func NewAdaptiveBatchSizer(size, min, max int, target time.Duration) *BatchSizer {
+	b := &BatchSizer{min: min, max: max, target: target}
+	b.size = b.clamp(size)
+	return b
+}
+
+// Size returns the current batch size.
+func (b *BatchSizer) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Adaptive reports whether the size follows observed latency.
+func (b *BatchSizer) Adaptive() bool {
+	return b.target > 0
+}
+
+// Observe records an insert of rows split into batches that took elapsed in all,
+// and returns the batch size to use next.
+func (b *BatchSizer) Observe(rows, batches int, elapsed time.Duration) int {
+	if b.target <= 0 || batches <= 0 {
+		return b.Size()
+	}
+	b.mu.Lock()
+	prev := b.size
+	switch {
+	case elapsed/time.Duration(batches) > b.target:
+		b.size = b.clamp(b.size / 2)
+	case rows >= b.size:
+		// A partial batch says nothing about how a bigger one would do.
+		b.size = b.clamp(b.size + batchIncrease)
+	}
+	size, cb := b.size, b.onChange
+	b.mu.Unlock()
+	if size != prev && cb != nil {
+		cb(size)
+	}
+	return size
+}
+
+func (b *BatchSizer) clamp(n int) int {
+	if n < b.min {
+		return b.min
+	}
+	if n > b.max {
+		return b.max
+	}
+	return n
+}
+
+// SetBatchSizing sets the sizer for each batched table; newSizer is called once per
+// table. Repositories created by ForTenant share the sizers.
+func (r *Repository) SetBatchSizing(newSizer func() *BatchSizer) {
+	sizers := make(map[string]*BatchSizer, len(batchTables))
+	for _, table := range batchTables {
+		b := newSizer()
+		if r.metrics != nil {
+			table := table
+			r.metrics.SetDBBatchSize(table, b.Size())
+			b.onChange = func(size int) { r.metrics.SetDBBatchSize(table, size) }
+		}
+		sizers[table] = b
+	}
+	r.batchSizers = sizers
+}
+
+// batchSizer returns the sizer of table, or a fixed one at the driver's default when
+// none is set.
+func (r *Repository) batchSizer(table string) *BatchSizer {
+	if b := r.batchSizers[table]; b != nil {
+		return b
+	}
+	return NewBatchSizer(DefaultBatchSize(r.driver))
+}
+
+// createInBatches inserts n rows into table with db, in batches sized by the table's
+// sizer, and feeds the time taken back into it.
+func (r *Repository) createInBatches(db *gorm.DB, table string, rows any, n int) *gorm.DB {
+	b := r.batchSizer(table)
+	size := b.Size()
+	now := r.clock
+	if now == nil {
+		now = time.Now
+	}
+	start := now()
+	res := db.CreateInBatches(rows, size)
+	if res.Error == nil && b.Adaptive() {
+		b.Observe(n, (n+size-1)/size, now().Sub(start))
+	}
+	return res
+}
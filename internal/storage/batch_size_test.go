@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixedBatchSizer(t *testing.T) {
+	b := NewBatchSizer(500)
+	if got := b.Observe(500, 1, time.Hour); got != 500 || b.Adaptive() {
+		t.Errorf("fixed sizer moved to %d", got)
+	}
+	if DefaultBatchSize("mysql") != 2000 || DefaultBatchSize("mssql") != 100 || DefaultBatchSize("") != 500 {
+		t.Error("unexpected driver defaults")
+	}
+}
+
+func TestAdaptiveBatchSizerAIMD(t *testing.T) {
+	var changes []int
+	b := NewAdaptiveBatchSizer(500, 100, 700, 100*time.Millisecond)
+	b.onChange = func(size int) { changes = append(changes, size) }
+
+	// Full batches within the target grow the size additively, up to max.
+	for i := 0; i < 3; i++ {
+		b.Observe(1000, 2, 150*time.Millisecond)
+	}
+	if got := b.Size(); got != 650 {
+		t.Fatalf("after 3 fast batches size = %d, want 650", got)
+	}
+	for i := 0; i < 5; i++ {
+		b.Observe(b.Size(), 1, 10*time.Millisecond)
+	}
+	if got := b.Size(); got != 700 {
+		t.Fatalf("size = %d, want capped at 700", got)
+	}
+	// A partial batch, however fast, does not grow it.
+	b.Observe(10, 1, time.Millisecond)
+
+	// A slow batch halves it, down to min.
+	b.Observe(2100, 3, 450*time.Millisecond)
+	if got := b.Size(); got != 350 {
+		t.Fatalf("after a slow batch size = %d, want 350", got)
+	}
+	b.Observe(350, 1, time.Second)
+	b.Observe(175, 1, time.Second)
+	if got := b.Size(); got != 100 {
+		t.Fatalf("size = %d, want floored at 100", got)
+	}
+
+	want := []int{550, 600, 650, 700, 350, 175, 100}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestRepositoryAdaptsBatchSize(t *testing.T) {
+	repo := newTestRepository(t)
+	// Each insert appears to take 100ms: 33ms per batch of 100, over the 20ms target.
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo.clock = func() time.Time {
+		clock = clock.Add(100 * time.Millisecond)
+		return clock
+	}
+	repo.SetBatchSizing(func() *BatchSizer { return NewAdaptiveBatchSizer(100, 10, 1000, 20*time.Millisecond) })
+
+	logs := make([]Log, 300)
+	for i := range logs {
+		logs[i] = Log{ServiceName: "api", Body: CompressedText(fmt.Sprintf("line %d", i)), Timestamp: clock}
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.batchSizer(BatchTableLogs).Size(); got != 50 {
+		t.Errorf("logs batch size = %d, want halved to 50", got)
+	}
+	if got := repo.batchSizer(BatchTableSpans).Size(); got != 100 {
+		t.Errorf("spans batch size = %d, want untouched", got)
+	}
+	var n int64
+	repo.db.Model(&Log{}).Count(&n)
+	if n != 300 {
+		t.Errorf("stored %d logs, want 300", n)
+	}
+
+	// Tenant-scoped repositories share the sizers.
+	if scoped := repo.withTenant("acme"); scoped.batchSizer(BatchTableLogs) != repo.batchSizer(BatchTableLogs) {
+		t.Error("tenant repository has its own sizer")
+	}
+}
+
+// benchRepositories opens the databases for batch insert benchmarks: a temporary SQLite
+// file, plus BENCH_DB_DRIVER at BENCH_DB_DSN when set, e.g. BENCH_DB_DRIVER=mysql.
+func benchRepositories(b *testing.B) map[string]*Repository {
+	b.Helper()
+	repos := make(map[string]*Repository)
+	open := func(driver, dsn string) {
+		db, err := NewDatabase(driver, dsn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := createSchema(db, driver); err != nil {
+			b.Fatal(err)
+		}
+		repo := &Repository{db: db, driver: driver}
+		b.Cleanup(func() { repo.Close() })
+		repos[driver] = repo
+	}
+	open("sqlite", filepath.Join(b.TempDir(), "bench.db"))
+	if driver := os.Getenv("BENCH_DB_DRIVER"); driver != "" && driver != "sqlite" {
+		open(driver, os.Getenv("BENCH_DB_DSN"))
+	}
+	return repos
+}
+
+// BenchmarkBatchInsert inserts 2000 rows per iteration through the batch insert
+// paths at several batch sizes and payload sizes. Compare rows/s across batch sizes to
+// pick DB_BATCH_SIZE for a driver.
+func BenchmarkBatchInsert(b *testing.B) {
+	const rows = 2000
+	for driver, repo := range benchRepositories(b) {
+		for _, size := range []int{100, 500, 2000} {
+			repo.SetBatchSizing(func() *BatchSizer { return NewBatchSizer(size) })
+			for _, payload := range []int{128, 16 << 10} {
+				body := strings.Repeat("x", payload)
+				name := fmt.Sprintf("%s/batch=%d/payload=%d", driver, size, payload)
+
+				b.Run("logs/"+name, func(b *testing.B) {
+					seq := 0
+					for b.Loop() {
+						logs := make([]Log, rows)
+						for i := range logs {
+							seq++
+							logs[i] = Log{ServiceName: "bench", Severity: "INFO", Body: CompressedText(body),
+								AttributesJSON: CompressedText(fmt.Sprintf(`{"seq":%d}`, seq)), Timestamp: time.Now()}
+						}
+						if err := repo.BatchCreateLogs(logs); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "rows/s")
+				})
+				b.Run("spans/"+name, func(b *testing.B) {
+					seq := 0
+					for b.Loop() {
+						spans := make([]Span, rows)
+						for i := range spans {
+							seq++
+							spans[i] = Span{TraceID: fmt.Sprintf("t%d", seq/20), SpanID: fmt.Sprintf("s%d", seq),
+								ServiceName: "bench", OperationName: "GET /x", AttributesJSON: CompressedText(body),
+								StartTime: time.Now(), Duration: 1000}
+						}
+						if err := repo.BatchCreateSpans(spans); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "rows/s")
+				})
+			}
+			b.Run(fmt.Sprintf("metrics/%s/batch=%d", driver, size), func(b *testing.B) {
+				for b.Loop() {
+					buckets := make([]MetricBucket, rows)
+					for i := range buckets {
+						buckets[i] = MetricBucket{Name: "cpu", ServiceName: "bench", TimeBucket: time.Now(), Count: 1, Sum: float64(i)}
+					}
+					if err := repo.BatchCreateMetrics(buckets); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "rows/s")
+			})
+		}
+	}
+}
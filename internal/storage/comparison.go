@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxCompareOffset bounds how far back a time-shift comparison may look.
+const MaxCompareOffset = 90 * 24 * time.Hour
+
+// ParseCompareOffset parses a comparison offset: a Go duration ("90m", "24h") or a
+// number of days ("7d"). It must be a positive whole number of minutes, so shifted
+// traffic buckets line up with the current ones, of at most MaxCompareOffset.
+func ParseCompareOffset(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid offset %q", s)
+		}
+	}
+	if d <= 0 || d > MaxCompareOffset || d%time.Minute != 0 {
+		return 0, fmt.Errorf("offset must be a whole number of minutes between 1m and %dd", MaxCompareOffset/(24*time.Hour))
+	}
+	return d, nil
+}
+
+// TimeShift is the comparison window of a time-shift query: the requested range
+// moved back by Offset.
+type TimeShift struct {
+	Offset time.Duration
+	// RetainedSince is the oldest time still fully stored (zero: unknown, assume
+	// everything is). A comparison window starting before it is not compared.
+	RetainedSince time.Time
+}
+
+// beyondRetention reports whether the window starting at start, shifted back,
+// reaches into purged data.
+func (s TimeShift) beyondRetention(start time.Time) bool {
+	return !s.RetainedSince.IsZero() && start.Add(-s.Offset).Before(s.RetainedSince)
+}
+
+// PercentChange returns the change from previous to current in percent. It is nil
+// when previous is 0 and current is not, where no percentage exists; no change
+// from 0 is 0.
+func PercentChange(current, previous float64) *float64 {
+	var pct float64
+	switch {
+	case previous != 0:
+		pct = roundRate((current - previous) / previous * 100)
+	case current != 0:
+		return nil
+	}
+	return &pct
+}
+
+// DashboardDeltas holds the percent change of each DashboardStats field against the
+// comparison window; see PercentChange. All are null without a comparison.
+type DashboardDeltas struct {
+	TotalTraces     *float64 `json:"total_traces"`
+	TotalLogs       *float64 `json:"total_logs"`
+	ErrorLogs       *float64 `json:"error_logs"`
+	TotalErrors     *float64 `json:"total_errors"`
+	RollupErrors    *float64 `json:"rollup_errors"`
+	AvgLatencyMs    *float64 `json:"avg_latency_ms"`
+	ErrorRate       *float64 `json:"error_rate"`
+	RollupErrorRate *float64 `json:"rollup_error_rate"`
+	ActiveServices  *float64 `json:"active_services"`
+	P99Latency      *float64 `json:"p99_latency"`
+}
+
+// CompareDashboardStats returns the percent change of every field from previous to
+// current.
+func CompareDashboardStats(current, previous *DashboardStats) DashboardDeltas {
+	return DashboardDeltas{
+		TotalTraces:     PercentChange(float64(current.TotalTraces), float64(previous.TotalTraces)),
+		TotalLogs:       PercentChange(float64(current.TotalLogs), float64(previous.TotalLogs)),
+		ErrorLogs:       PercentChange(float64(current.ErrorLogs), float64(previous.ErrorLogs)),
+		TotalErrors:     PercentChange(float64(current.TotalErrors), float64(previous.TotalErrors)),
+		RollupErrors:    PercentChange(float64(current.RollupErrors), float64(previous.RollupErrors)),
+		AvgLatencyMs:    PercentChange(current.AvgLatencyMs, previous.AvgLatencyMs),
+		ErrorRate:       PercentChange(current.ErrorRate, previous.ErrorRate),
+		RollupErrorRate: PercentChange(current.RollupErrorRate, previous.RollupErrorRate),
+		ActiveServices:  PercentChange(float64(current.ActiveServices), float64(previous.ActiveServices)),
+		P99Latency:      PercentChange(float64(current.P99Latency), float64(previous.P99Latency)),
+	}
+}
+
+// DashboardComparison is dashboard stats for a range next to the same range
+// CompareOffset earlier.
+type DashboardComparison struct {
+	Current         *DashboardStats `json:"current"`
+	Comparison      *DashboardStats `json:"comparison"` // null when beyond retention
+	Deltas          DashboardDeltas `json:"deltas"`
+	CompareOffset   string          `json:"compare_offset"`
+	ComparisonStart time.Time       `json:"comparison_start"`
+	ComparisonEnd   time.Time       `json:"comparison_end"`
+	BeyondRetention bool            `json:"beyond_retention"` // the comparison window reaches purged data
+}
+
+// UseErrorMode makes TotalErrors and ErrorRate follow the given error mode; the
+// rollup counts stay as they are.
+func (s *DashboardStats) UseErrorMode(mode string) {
+	if mode == ErrorModeRollup {
+		s.TotalErrors = s.RollupErrors
+		s.ErrorRate = s.RollupErrorRate
+	}
+}
+
+// ExcludeSyntheticLogs leaves the logs synthesized from spans out of TotalLogs and
+// ErrorLogs, counting only what the apps exported.
+func (s *DashboardStats) ExcludeSyntheticLogs() {
+	s.TotalLogs -= s.SyntheticLogs
+	s.ErrorLogs -= s.SyntheticErrorLogs
+	s.SyntheticLogs, s.SyntheticErrorLogs = 0, 0
+}
+
+// DashboardView is how dashboard stats are presented: which errors count, and
+// whether synthesized logs do.
+type DashboardView struct {
+	ErrorMode        string
+	ExcludeSynthetic bool
+}
+
+// Apply presents s as v describes.
+func (v DashboardView) Apply(s *DashboardStats) {
+	s.UseErrorMode(v.ErrorMode)
+	if v.ExcludeSynthetic {
+		s.ExcludeSyntheticLogs()
+	}
+}
+
+// GetDashboardComparison reads dashboard stats from src for [start, end] and for the
+// same range shifted back by shift.Offset, both presented as view, and the percent
+// change between them.
+func GetDashboardComparison(ctx context.Context, src DashboardReader, start, end time.Time, serviceNames []string, shift TimeShift, view DashboardView) (*DashboardComparison, error) {
+	current, err := src.GetDashboardStatsContext(ctx, start, end, serviceNames)
+	if err != nil {
+		return nil, err
+	}
+	view.Apply(current)
+	c := &DashboardComparison{
+		Current:         current,
+		CompareOffset:   shift.Offset.String(),
+		ComparisonStart: start.Add(-shift.Offset),
+		ComparisonEnd:   end.Add(-shift.Offset),
+		BeyondRetention: shift.beyondRetention(start),
+	}
+	if c.BeyondRetention {
+		return c, nil
+	}
+	if c.Comparison, err = src.GetDashboardStatsContext(ctx, c.ComparisonStart, c.ComparisonEnd, serviceNames); err != nil {
+		return nil, err
+	}
+	view.Apply(c.Comparison)
+	c.Deltas = CompareDashboardStats(current, c.Comparison)
+	return c, nil
+}
+
+// TrafficDeltas holds the percent change of the traffic totals; see PercentChange.
+type TrafficDeltas struct {
+	Count      *float64 `json:"count"`
+	ErrorCount *float64 `json:"error_count"`
+}
+
+// TrafficComparison is per-minute traffic for a range next to the same range
+// CompareOffset earlier. Comparison points are shifted forward by the offset so
+// their timestamps match the current buckets they overlay.
+type TrafficComparison struct {
+	Current         []TrafficPoint `json:"current"`
+	Comparison      []TrafficPoint `json:"comparison"` // null when beyond retention
+	Deltas          TrafficDeltas  `json:"deltas"`
+	CompareOffset   string         `json:"compare_offset"`
+	BeyondRetention bool           `json:"beyond_retention"`
+}
+
+// GetTrafficComparison reads traffic from src for [start, end] and for the same range
+// shifted back by shift.Offset, and the percent change of the totals.
+func GetTrafficComparison(src DashboardReader, start, end time.Time, serviceNames []string, shift TimeShift) (*TrafficComparison, error) {
+	current, err := src.GetTrafficMetrics(start, end, serviceNames)
+	if err != nil {
+		return nil, err
+	}
+	c := &TrafficComparison{
+		Current:         current,
+		CompareOffset:   shift.Offset.String(),
+		BeyondRetention: shift.beyondRetention(start),
+	}
+	if c.Current == nil {
+		c.Current = []TrafficPoint{}
+	}
+	if c.BeyondRetention {
+		return c, nil
+	}
+	previous, err := src.GetTrafficMetrics(start.Add(-shift.Offset), end.Add(-shift.Offset), serviceNames)
+	if err != nil {
+		return nil, err
+	}
+	c.Comparison = make([]TrafficPoint, len(previous))
+	for i, p := range previous {
+		p.Timestamp = p.Timestamp.Add(shift.Offset)
+		c.Comparison[i] = p
+	}
+	cur, prev := trafficTotals(current), trafficTotals(previous)
+	c.Deltas = TrafficDeltas{
+		Count:      PercentChange(float64(cur.Count), float64(prev.Count)),
+		ErrorCount: PercentChange(float64(cur.ErrorCount), float64(prev.ErrorCount)),
+	}
+	return c, nil
+}
+
+func trafficTotals(points []TrafficPoint) TrafficPoint {
+	var t TrafficPoint
+	for _, p := range points {
+		t.Count += p.Count
+		t.ErrorCount += p.ErrorCount
+	}
+	return t
+}
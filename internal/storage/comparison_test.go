@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		current, previous float64
+		want              string // "nil" for no percentage
+	}{
+		{15, 10, "50"},
+		{5, 10, "-50"},
+		{0, 10, "-100"},
+		{10, 10, "0"},
+		{0, 0, "0"},    // no change from nothing
+		{7, 0, "nil"},  // growth from zero has no percentage
+		{-1, 0, "nil"}, // nor does any change from zero
+		{1, 3, "-66.6667"},
+	}
+	for _, tt := range tests {
+		got := "nil"
+		if p := PercentChange(tt.current, tt.previous); p != nil {
+			got = fmt.Sprint(*p)
+		}
+		if got != tt.want {
+			t.Errorf("PercentChange(%v, %v) = %s, want %s", tt.current, tt.previous, got, tt.want)
+		}
+	}
+}
+
+func TestParseCompareOffset(t *testing.T) {
+	for in, want := range map[string]time.Duration{"24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "90m": 90 * time.Minute, "90d": MaxCompareOffset} {
+		if got, err := ParseCompareOffset(in); err != nil || got != want {
+			t.Errorf("ParseCompareOffset(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0h", "-24h", "30s", "91d", "1.5d", "yesterday"} {
+		if _, err := ParseCompareOffset(in); err == nil {
+			t.Errorf("ParseCompareOffset(%q) succeeded", in)
+		}
+	}
+}
+
+func TestGetDashboardComparison(t *testing.T) {
+	repo := newTestRepository(t)
+	end := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-time.Hour)
+	day := 24 * time.Hour
+
+	var traces []Trace
+	add := func(at time.Time, n, errors int) {
+		for i := range n {
+			status := "STATUS_CODE_OK"
+			if i < errors {
+				status = "STATUS_CODE_ERROR"
+			}
+			traces = append(traces, Trace{TraceID: fmt.Sprintf("t%d", len(traces)), ServiceName: "api", Status: status, Duration: 10000, Timestamp: at})
+		}
+	}
+	add(start.Add(10*time.Minute), 20, 4)     // now: 20 traces, 4 errors
+	add(start.Add(10*time.Minute-day), 10, 0) // yesterday: 10 traces, no errors
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := GetDashboardComparison(context.Background(), repo, start, end, nil, TimeShift{Offset: day}, DashboardView{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Current.TotalTraces != 20 || c.Comparison == nil || c.Comparison.TotalTraces != 10 {
+		t.Fatalf("current %+v, comparison %+v", c.Current, c.Comparison)
+	}
+	if !c.ComparisonStart.Equal(start.Add(-day)) || c.CompareOffset != "24h0m0s" || c.BeyondRetention {
+		t.Errorf("comparison window = %v (%s), beyond retention %v", c.ComparisonStart, c.CompareOffset, c.BeyondRetention)
+	}
+	if *c.Deltas.TotalTraces != 100 || c.Deltas.TotalErrors != nil || c.Deltas.ErrorRate != nil || *c.Deltas.AvgLatencyMs != 0 {
+		t.Errorf("deltas = traces %v, errors %v, error rate %v, latency %v; want +100%%, nil, nil, 0",
+			c.Deltas.TotalTraces, c.Deltas.TotalErrors, c.Deltas.ErrorRate, *c.Deltas.AvgLatencyMs)
+	}
+
+	// The comparison window starts before the retained data: nothing is compared.
+	shift := TimeShift{Offset: day, RetainedSince: start.Add(-12 * time.Hour)}
+	c, err = GetDashboardComparison(context.Background(), repo, start, end, nil, shift, DashboardView{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.BeyondRetention || c.Comparison != nil || c.Deltas.TotalTraces != nil || c.Current.TotalTraces != 20 {
+		t.Errorf("beyond retention: %+v, want the current stats only, with null comparison and deltas", c)
+	}
+}
+
+func TestGetTrafficComparison(t *testing.T) {
+	repo := newTestRepository(t)
+	end := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-10 * time.Minute)
+	week := 7 * 24 * time.Hour
+
+	traces := []Trace{
+		{TraceID: "now-1", ServiceName: "api", Status: "STATUS_CODE_ERROR", Timestamp: start.Add(2 * time.Minute)},
+		{TraceID: "now-2", ServiceName: "api", Status: "STATUS_CODE_OK", Timestamp: start.Add(2 * time.Minute)},
+		{TraceID: "now-3", ServiceName: "api", Status: "STATUS_CODE_OK", Timestamp: start.Add(5 * time.Minute)},
+		{TraceID: "old-1", ServiceName: "api", Status: "STATUS_CODE_OK", Timestamp: start.Add(2*time.Minute - week)},
+		{TraceID: "old-2", ServiceName: "api", Status: "STATUS_CODE_OK", Timestamp: start.Add(5*time.Minute + 30*time.Second - week)},
+	}
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := GetTrafficComparison(repo, start, end, nil, TimeShift{Offset: week})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Current) != 2 || len(c.Comparison) != 2 {
+		t.Fatalf("current %v, comparison %v; want two buckets each", c.Current, c.Comparison)
+	}
+	for i := range c.Current {
+		if !c.Comparison[i].Timestamp.Equal(c.Current[i].Timestamp) {
+			t.Errorf("bucket %d: comparison at %v, current at %v; want them aligned", i, c.Comparison[i].Timestamp, c.Current[i].Timestamp)
+		}
+	}
+	if *c.Deltas.Count != 50 || c.Deltas.ErrorCount != nil {
+		t.Errorf("deltas = count %v, errors %v; want +50%% and nil (errors from zero)", *c.Deltas.Count, c.Deltas.ErrorCount)
+	}
+
+	c, err = GetTrafficComparison(repo, start, end, nil, TimeShift{Offset: week, RetainedSince: end.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.BeyondRetention || c.Comparison != nil || c.Deltas.Count != nil {
+		t.Errorf("beyond retention: %+v", c)
+	}
+}
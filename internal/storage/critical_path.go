@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// CriticalPath finds the spans that determined a trace's end-to-end latency. Walking
+// back from the end of the root span, it follows the child that finished last, then
+// the child that finished last before that one started, and so on; while no child on
+// the path is running the parent is waiting on itself, and that time is the parent's.
+// Children running in parallel with the path do not contribute. The path starts at
+// the root span that ends last; spans outside its tree are left out.
+//
+// It returns the microseconds each span contributes, indexed like spans (0 for spans
+// off the path), and the path's length, which is the root span's duration.
+func CriticalPath(spans []Span) (contributions []int64, totalUs int64) {
+	contributions = make([]int64, len(spans))
+	index := make(map[*Span]int, len(spans))
+	for i := range spans {
+		index[&spans[i]] = i
+	}
+
+	var root *SpanNode
+	for _, n := range BuildSpanTree(spans) {
+		if root != nil && (n.Orphan && !root.Orphan || !spanEnd(n.Span).After(spanEnd(root.Span))) {
+			continue
+		}
+		root = n
+	}
+	if root == nil {
+		return contributions, 0
+	}
+	walkCriticalPath(root, root.Span.StartTime, spanEnd(root.Span), func(s *Span, d time.Duration) {
+		contributions[index[s]] += d.Microseconds()
+	})
+	return contributions, root.Span.Duration
+}
+
+// walkCriticalPath attributes the part of the critical path within [from, to] that
+// runs through n and its descendants.
+func walkCriticalPath(n *SpanNode, from, to time.Time, add func(*Span, time.Duration)) {
+	if n.Span.StartTime.After(from) {
+		from = n.Span.StartTime
+	}
+	if end := spanEnd(n.Span); end.Before(to) {
+		to = end
+	}
+	if !to.After(from) {
+		return
+	}
+
+	// Children by end time, latest first. Walking back, the first child that started
+	// before the current point is the one the parent last waited for; children passed
+	// over started after that point, so they never qualify later either.
+	children := append([]*SpanNode(nil), n.Children...)
+	sort.SliceStable(children, func(i, j int) bool { return spanEnd(children[i].Span).After(spanEnd(children[j].Span)) })
+
+	t := to
+	for _, c := range children {
+		if !t.After(from) {
+			break
+		}
+		if !c.Span.StartTime.Before(t) {
+			continue
+		}
+		end := spanEnd(c.Span)
+		if end.After(t) {
+			end = t
+		}
+		if !end.After(from) {
+			break
+		}
+		add(n.Span, t.Sub(end))
+		walkCriticalPath(c, from, end, add)
+		t = c.Span.StartTime
+	}
+	if t.After(from) {
+		add(n.Span, t.Sub(from))
+	}
+}
+
+func spanEnd(s *Span) time.Time {
+	return s.StartTime.Add(time.Duration(s.Duration) * time.Microsecond)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// waterfall builds spans from (id, parent, start, end) in milliseconds from t0.
+func waterfall(rows ...[4]any) []Span {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	spans := make([]Span, len(rows))
+	for i, r := range rows {
+		start, end := r[2].(int), r[3].(int)
+		spans[i] = Span{SpanID: r[0].(string), ParentSpanID: r[1].(string),
+			StartTime: t0.Add(time.Duration(start) * time.Millisecond), Duration: int64(end-start) * 1000}
+	}
+	return spans
+}
+
+func assertCriticalPath(t *testing.T, spans []Span, wantTotalMs int64, wantMs map[string]int64) {
+	t.Helper()
+	got, total := CriticalPath(spans)
+	if total != wantTotalMs*1000 {
+		t.Errorf("total = %dµs, want %dms", total, wantTotalMs)
+	}
+	var sum int64
+	for i, s := range spans {
+		sum += got[i]
+		if got[i] != wantMs[s.SpanID]*1000 {
+			t.Errorf("span %s contributes %dµs, want %dms", s.SpanID, got[i], wantMs[s.SpanID])
+		}
+	}
+	if sum != total {
+		t.Errorf("contributions sum to %dµs, want the total %dµs", sum, total)
+	}
+}
+
+func TestCriticalPathSequential(t *testing.T) {
+	// root waits 10ms, calls a then b, then works 10ms more.
+	spans := waterfall(
+		[4]any{"root", "", 0, 100},
+		[4]any{"b", "root", 40, 90},
+		[4]any{"a", "root", 10, 40},
+	)
+	assertCriticalPath(t, spans, 100, map[string]int64{"root": 20, "a": 30, "b": 50})
+}
+
+func TestCriticalPathParallel(t *testing.T) {
+	// a and b run in parallel; only the slower one is on the path.
+	spans := waterfall(
+		[4]any{"root", "", 0, 100},
+		[4]any{"a", "root", 0, 80},
+		[4]any{"b", "root", 0, 60},
+	)
+	assertCriticalPath(t, spans, 100, map[string]int64{"root": 20, "a": 80})
+}
+
+func TestCriticalPathMixed(t *testing.T) {
+	// a (with a1) runs in parallel with b; c follows b. Walking back from 100ms: c
+	// until 60, then b until 20, then a, which a1 kept busy from 10 to 20.
+	spans := waterfall(
+		[4]any{"root", "", 0, 100},
+		[4]any{"a", "root", 0, 50},
+		[4]any{"a1", "a", 10, 45},
+		[4]any{"b", "root", 20, 60},
+		[4]any{"c", "root", 60, 95},
+		[4]any{"d", "c", 65, 70},
+	)
+	assertCriticalPath(t, spans, 100, map[string]int64{"root": 5, "c": 30, "d": 5, "b": 40, "a1": 10, "a": 10})
+}
+
+func TestCriticalPathClampsAsyncChildren(t *testing.T) {
+	// A fire-and-forget child outliving its parent only counts while the parent runs;
+	// orphans and spans of other roots are off the path.
+	spans := waterfall(
+		[4]any{"root", "", 0, 50},
+		[4]any{"async", "root", 30, 200},
+		[4]any{"early", "root", -10, 10},
+		[4]any{"orphan", "missing", 0, 500},
+		[4]any{"other", "", 0, 20},
+	)
+	assertCriticalPath(t, spans, 50, map[string]int64{"root": 20, "async": 20, "early": 10})
+
+	if got, total := CriticalPath(nil); len(got) != 0 || total != 0 {
+		t.Errorf("empty trace: %v, %d", got, total)
+	}
+}
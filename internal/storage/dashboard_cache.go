@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// dashboardCacheRetention is how long an entry is kept at least, so an idle system
+// keeps serving fixed ranges from memory.
+const dashboardCacheRetention = time.Minute
+
+// DashboardCache wraps a Backend and memoizes GetDashboardStats, which runs several
+// aggregate queries and is requested with identical arguments by the REST handler and
+// every live snapshot group. Requests are keyed by their time range rounded to the TTL
+// and the service set; concurrent misses on one key share a single computation.
+//
+// A cached result is served for up to ttl after ingest has invalidated it, so
+// dashboards lag new data by at most ttl. While nothing is ingested, results stay
+// valid for as long as they are retained, since the data behind them is unchanged.
+// Purges and remaps made through the cache clear it, so they show at once.
+type DashboardCache struct {
+	Backend
+	ttl    time.Duration
+	now    func() time.Time
+	onHit  func()
+	onMiss func()
+
+	group singleflight.Group
+
+	mu      sync.Mutex
+	gen     uint64 // bumped by Invalidate
+	epoch   uint64 // bumped by Clear; results computed in an earlier epoch are dropped
+	entries map[string]dashboardEntry
+}
+
+type dashboardEntry struct {
+	stats      *DashboardStats
+	computedAt time.Time
+	gen        uint64
+}
+
+// NewDashboardCache wraps b with a dashboard stats cache.
+func NewDashboardCache(b Backend, ttl time.Duration) *DashboardCache {
+	return &DashboardCache{
+		Backend: b,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]dashboardEntry),
+	}
+}
+
+// SetMetrics sets the functions called on every cache hit and miss.
+func (c *DashboardCache) SetMetrics(onHit, onMiss func()) {
+	c.onHit = onHit
+	c.onMiss = onMiss
+}
+
+// Invalidate marks cached results as outdated by newly ingested data. They are
+// still served until they are ttl old.
+func (c *DashboardCache) Invalidate() {
+	c.mu.Lock()
+	c.gen++
+	c.mu.Unlock()
+}
+
+// Clear drops every cached result, for changes to data already counted that must
+// show at once rather than within ttl.
+func (c *DashboardCache) Clear() {
+	c.mu.Lock()
+	c.gen++
+	c.epoch++
+	clear(c.entries)
+	c.mu.Unlock()
+}
+
+// PurgeLogs purges through the wrapped backend and clears the cache.
+func (c *DashboardCache) PurgeLogs(olderThan time.Time) (int64, error) {
+	defer c.Clear()
+	return c.Backend.PurgeLogs(olderThan)
+}
+
+// PurgeTraces purges through the wrapped backend and clears the cache.
+func (c *DashboardCache) PurgeTraces(olderThan time.Time) (int64, error) {
+	defer c.Clear()
+	return c.Backend.PurgeTraces(olderThan)
+}
+
+// PurgeService purges through the wrapped backend and clears the cache.
+func (c *DashboardCache) PurgeService(service string, before time.Time) (*ServicePurgeResult, error) {
+	defer c.Clear()
+	return c.Backend.PurgeService(service, before)
+}
+
+// RemapService remaps through the wrapped backend and clears the cache.
+func (c *DashboardCache) RemapService(from, to string) (*ServiceRemapResult, error) {
+	defer c.Clear()
+	return c.Backend.RemapService(from, to)
+}
+
+// RunPurgeBatch runs a purge job batch through the wrapped backend and clears the
+// cache.
+func (c *DashboardCache) RunPurgeBatch(id uint, batchSize int) (*PurgeJob, error) {
+	defer c.Clear()
+	return c.Backend.RunPurgeBatch(id, batchSize)
+}
+
+// GetDashboardStats is GetDashboardStatsContext without a deadline.
+func (c *DashboardCache) GetDashboardStats(start, end time.Time, serviceNames []string) (*DashboardStats, error) {
+	return c.GetDashboardStatsContext(context.Background(), start, end, serviceNames)
+}
+
+// GetDashboardStatsContext returns cached stats for the range and services when
+// fresh, computing them once otherwise. Callers receive their own copy.
+//
+// A shared computation is not bound to any one caller's context, so a caller that
+// gives up does not fail the others waiting on it; it just stops waiting.
+func (c *DashboardCache) GetDashboardStatsContext(ctx context.Context, start, end time.Time, serviceNames []string) (*DashboardStats, error) {
+	return c.stats(ctx, c.Backend, "", "", start, end, serviceNames)
+}
+
+// ForTenant returns the cache over one tenant's data. Tenant views share c's entries
+// under keys of their own, so Invalidate covers all of them. If the wrapped backend
+// cannot be scoped, c is returned.
+func (c *DashboardCache) ForTenant(tenant string) Backend {
+	scoper, ok := c.Backend.(TenantScoper)
+	if tenant == "" || !ok {
+		return c
+	}
+	return &scopedDashboardCache{Backend: scoper.ForTenant(tenant), cache: c, tenant: tenant}
+}
+
+// ForEnvironment returns the cache over one environment's data, as ForTenant does
+// for a tenant.
+func (c *DashboardCache) ForEnvironment(env string) Backend {
+	scoper, ok := c.Backend.(EnvironmentScoper)
+	if env == "" || !ok {
+		return c
+	}
+	return &scopedDashboardCache{Backend: scoper.ForEnvironment(env), cache: c, env: env}
+}
+
+// scopedDashboardCache is a DashboardCache view of one tenant, environment or both.
+type scopedDashboardCache struct {
+	Backend
+	cache  *DashboardCache
+	tenant string
+	env    string
+}
+
+func (s *scopedDashboardCache) GetDashboardStatsContext(ctx context.Context, start, end time.Time, serviceNames []string) (*DashboardStats, error) {
+	return s.cache.stats(ctx, s.Backend, s.tenant, s.env, start, end, serviceNames)
+}
+
+func (s *scopedDashboardCache) PurgeLogs(olderThan time.Time) (int64, error) {
+	defer s.cache.Clear()
+	return s.Backend.PurgeLogs(olderThan)
+}
+
+func (s *scopedDashboardCache) PurgeTraces(olderThan time.Time) (int64, error) {
+	defer s.cache.Clear()
+	return s.Backend.PurgeTraces(olderThan)
+}
+
+func (s *scopedDashboardCache) PurgeService(service string, before time.Time) (*ServicePurgeResult, error) {
+	defer s.cache.Clear()
+	return s.Backend.PurgeService(service, before)
+}
+
+func (s *scopedDashboardCache) RemapService(from, to string) (*ServiceRemapResult, error) {
+	defer s.cache.Clear()
+	return s.Backend.RemapService(from, to)
+}
+
+func (s *scopedDashboardCache) RunPurgeBatch(id uint, batchSize int) (*PurgeJob, error) {
+	defer s.cache.Clear()
+	return s.Backend.RunPurgeBatch(id, batchSize)
+}
+
+// ForEnvironment narrows a tenant's view to env.
+func (s *scopedDashboardCache) ForEnvironment(env string) Backend {
+	scoper, ok := s.Backend.(EnvironmentScoper)
+	if env == "" || !ok {
+		return s
+	}
+	return &scopedDashboardCache{Backend: scoper.ForEnvironment(env), cache: s.cache, tenant: s.tenant, env: env}
+}
+
+// stats serves GetDashboardStatsContext for the tenant and environment b is scoped to.
+func (c *DashboardCache) stats(ctx context.Context, b Backend, tenant, env string, start, end time.Time, serviceNames []string) (*DashboardStats, error) {
+	key := tenant + "|" + env + "|" + c.key(start, end, serviceNames)
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	fresh := ok && (e.gen == c.gen || c.now().Sub(e.computedAt) < c.ttl)
+	epoch := c.epoch
+	c.mu.Unlock()
+	if fresh {
+		if c.onHit != nil {
+			c.onHit()
+		}
+		return copyStats(e.stats), nil
+	}
+	if c.onMiss != nil {
+		c.onMiss()
+	}
+
+	// Callers after a Clear do not join a computation started before it
+	ch := c.group.DoChan(key+"|"+strconv.FormatUint(epoch, 10), func() (interface{}, error) {
+		c.mu.Lock()
+		gen := c.gen
+		c.mu.Unlock()
+		computedAt := c.now()
+
+		stats, err := b.GetDashboardStatsContext(context.WithoutCancel(ctx), start, end, serviceNames)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if c.epoch == epoch {
+			c.entries[key] = dashboardEntry{stats: stats, computedAt: computedAt, gen: gen}
+		}
+		c.evictLocked(computedAt)
+		c.mu.Unlock()
+		return stats, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return copyStats(res.Val.(*DashboardStats)), nil
+	}
+}
+
+// key rounds the range to the TTL so requests for "the last 15 minutes" made a moment
+// apart share an entry.
+func (c *DashboardCache) key(start, end time.Time, serviceNames []string) string {
+	bucket := max(c.ttl, time.Second)
+	services := slices.Clone(serviceNames)
+	slices.Sort(services)
+	return start.Truncate(bucket).Format(time.RFC3339) + "|" + end.Truncate(bucket).Format(time.RFC3339) + "|" + strings.Join(services, ",")
+}
+
+// evictLocked drops entries past their retention; relative ranges such as "the
+// last 15 minutes" move to a new key every bucket. Callers hold c.mu.
+func (c *DashboardCache) evictLocked(now time.Time) {
+	retention := max(dashboardCacheRetention, 2*c.ttl)
+	for k, e := range c.entries {
+		if now.Sub(e.computedAt) > retention {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// copyStats returns a copy callers may adjust (e.g. for error_mode) without
+// affecting other readers of the cached value.
+func copyStats(s *DashboardStats) *DashboardStats {
+	cp := *s
+	return &cp
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+)
+
+// countingStats serves DashboardStats whose TotalTraces is the version of the
+// underlying data at the time of the query.
+type countingStats struct {
+	Backend
+	version atomic.Int64
+	calls   atomic.Int64
+	release chan struct{} // if set, queries block until it is closed
+}
+
+func (b *countingStats) GetDashboardStatsContext(_ context.Context, start, end time.Time, serviceNames []string) (*DashboardStats, error) {
+	b.calls.Add(1)
+	if b.release != nil {
+		<-b.release
+	}
+	return &DashboardStats{TotalTraces: b.version.Load()}, nil
+}
+
+func TestDashboardCacheSharesConcurrentMisses(t *testing.T) {
+	src := &countingStats{release: make(chan struct{})}
+	c := NewDashboardCache(src, 5*time.Second)
+	end := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetDashboardStats(end.Add(-15*time.Minute), end, []string{"b", "a"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(src.release)
+	wg.Wait()
+
+	if n := src.calls.Load(); n != 1 {
+		t.Errorf("20 concurrent callers ran %d queries, want 1", n)
+	}
+	// Service order does not matter for the key.
+	c.GetDashboardStats(end.Add(-15*time.Minute), end, []string{"a", "b"})
+	if n := src.calls.Load(); n != 1 {
+		t.Errorf("reordered services missed the cache (%d queries)", n)
+	}
+}
+
+func TestDashboardCacheCallerGivesUp(t *testing.T) {
+	src := &countingStats{release: make(chan struct{})}
+	c := NewDashboardCache(src, 5*time.Second)
+	end := time.Now()
+
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := c.GetDashboardStats(end.Add(-time.Hour), end, nil)
+		waiting <- err
+	}()
+	for src.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A caller that gives up returns at once without failing the shared query.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetDashboardStatsContext(ctx, end.Add(-time.Hour), end, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetDashboardStatsContext() error = %v, want context.DeadlineExceeded", err)
+	}
+	close(src.release)
+	if err := <-waiting; err != nil {
+		t.Errorf("GetDashboardStats() error = %v", err)
+	}
+	if n := src.calls.Load(); n != 1 {
+		t.Errorf("ran %d queries, want 1", n)
+	}
+}
+
+func TestDashboardCacheStalenessBoundedByTTL(t *testing.T) {
+	const ttl = 5 * time.Second
+	src := &countingStats{}
+	c := NewDashboardCache(src, ttl)
+	var hits, misses int
+	c.SetMetrics(func() { hits++ }, func() { misses++ })
+
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return clock }
+	start, end := clock.Add(-time.Hour), clock
+
+	// changedAt[v] is when the data reached version v.
+	changedAt := map[int64]time.Time{0: clock}
+	for step := 0; step < 200; step++ {
+		if step%7 == 3 {
+			v := src.version.Add(1)
+			changedAt[v] = clock
+			c.Invalidate()
+		}
+		got, err := c.GetDashboardStats(start, end, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Served data may only be outdated if the newer version is younger than ttl.
+		if newer, ok := changedAt[got.TotalTraces+1]; ok && clock.Sub(newer) >= ttl {
+			t.Fatalf("at +%v served version %d, but version %d arrived %v ago", clock.Sub(changedAt[0]), got.TotalTraces, got.TotalTraces+1, clock.Sub(newer))
+		}
+		clock = clock.Add(700 * time.Millisecond)
+	}
+	if hits == 0 || misses == 0 || int64(hits+misses) != 200 || int64(misses) != src.calls.Load() {
+		t.Errorf("hits = %d, misses = %d, queries = %d", hits, misses, src.calls.Load())
+	}
+
+	// Without new data the cached value is reused beyond the TTL.
+	clock = clock.Add(ttl)
+	c.GetDashboardStats(start, end, nil)
+	calls := src.calls.Load()
+	clock = clock.Add(3 * ttl)
+	c.GetDashboardStats(start, end, nil)
+	if src.calls.Load() != calls {
+		t.Errorf("queried again without new data")
+	}
+}
+
+func TestDashboardCacheReturnsCopies(t *testing.T) {
+	c := NewDashboardCache(&countingStats{}, time.Minute)
+	end := time.Now()
+	first, _ := c.GetDashboardStats(end.Add(-time.Hour), end, nil)
+	first.TotalErrors = 99
+	second, _ := c.GetDashboardStats(end.Add(-time.Hour), end, nil)
+	if second.TotalErrors != 0 {
+		t.Errorf("caller mutation leaked into the cache: TotalErrors = %d", second.TotalErrors)
+	}
+}
+
+func TestDashboardCacheClearedByPurgeAndRemap(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	var traces []Trace
+	for i, svc := range []string{"junk", "junk", "old", "keep"} {
+		id := fmt.Sprintf("t%d", i)
+		traces = append(traces, Trace{TraceID: id, ServiceName: svc, Timestamp: now.Add(-time.Duration(i) * time.Minute)})
+	}
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+	c := NewDashboardCache(repo, time.Minute)
+	start, end := now.Add(-time.Hour), now.Add(time.Minute)
+	total := func(services ...string) int64 {
+		t.Helper()
+		stats, err := c.GetDashboardStats(start, end, services)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats.TotalTraces
+	}
+
+	if n := total(); n != 4 {
+		t.Fatalf("TotalTraces = %d, want 4", n)
+	}
+	if _, err := c.PurgeService("junk", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := total(); n != 2 {
+		t.Errorf("TotalTraces after purging a service = %d, want 2", n)
+	}
+
+	if n := total("old"); n != 1 {
+		t.Fatalf("TotalTraces of old = %d, want 1", n)
+	}
+	if _, err := c.ForTenant(tenant.Default).RemapService("old", "keep"); err != nil {
+		t.Fatal(err)
+	}
+	if n := total("old"); n != 0 {
+		t.Errorf("TotalTraces of old after remapping it = %d, want 0", n)
+	}
+}
+
+func TestDashboardCacheClearDropsRunningQuery(t *testing.T) {
+	src := &countingStats{release: make(chan struct{})}
+	c := NewDashboardCache(src, time.Minute)
+	end := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		c.GetDashboardStats(end.Add(-time.Hour), end, nil)
+		close(done)
+	}()
+	for src.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Clear()
+	src.version.Add(1)
+	close(src.release)
+	<-done
+
+	// The query started before Clear read the data as it was before the change.
+	got, _ := c.GetDashboardStats(end.Add(-time.Hour), end, nil)
+	if got.TotalTraces != 1 || src.calls.Load() != 2 {
+		t.Errorf("after Clear got version %d from %d queries, want version 1 from 2", got.TotalTraces, src.calls.Load())
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SDK exporters retry batches that time out, so the same span or log can arrive
+// more than once. Spans are unique on (trace_id, span_id) and logs on a hash of
+// their content; inserts skip rows that already exist, the way traces always have.
+
+const (
+	spanDedupIndex = "idx_spans_trace_span"
+	logDedupIndex  = "idx_logs_dedup_key"
+
+	// dedupBatch bounds the rows touched per statement while migrating existing
+	// data, so a large table is never locked for long.
+	dedupBatch = 1000
+)
+
+// ignoreDuplicates makes the next Create skip rows that violate a unique index.
+func (r *Repository) ignoreDuplicates() *gorm.DB {
+	return ignoreDuplicates(r.db, r.driver)
+}
+
+func ignoreDuplicates(db *gorm.DB, driver string) *gorm.DB {
+	if strings.ToLower(driver) == "mysql" {
+		return db.Clauses(clause.Insert{Modifier: "IGNORE"})
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true})
+}
+
+// logDedupKey identifies a log record by content. A retried export carries the
+// same trace and span IDs, nanosecond timestamp, body and attributes, while
+// separate records practically never agree on all of them. Records of tenants
+// other than the default one also hash their tenant, so two teams sending the same
+// record both keep it; keys of the default tenant are unchanged from before
+// multi-tenancy. The same goes for the environment.
+func logDedupKey(l *Log) string {
+	h := sha256.New()
+	if l.TenantID != "" && l.TenantID != tenant.Default {
+		h.Write([]byte(l.TenantID))
+		h.Write([]byte{0})
+	}
+	if l.Environment != "" {
+		h.Write([]byte("environment=" + l.Environment))
+		h.Write([]byte{0})
+	}
+	for _, part := range []string{
+		l.TraceID, l.SpanID, l.ServiceName, l.Severity,
+		strconv.FormatInt(l.Timestamp.UnixNano(), 10),
+		string(l.Body), string(l.AttributesJSON),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// recordDuplicates counts records skipped because they were already stored.
+func (r *Repository) recordDuplicates(signal string, n int64) {
+	if n <= 0 {
+		return
+	}
+	if r.metrics != nil {
+		r.metrics.RecordDuplicatesSkipped(signal, int(n))
+	}
+	slog.Debug("Skipped duplicate records", "signal", signal, "count", n)
+}
+
+// migrateDedupIndexes removes duplicates from databases created before the unique
+// indexes existed, so AutoMigrate can create them. It runs once per index.
+func migrateDedupIndexes(db *gorm.DB) error {
+	m := db.Migrator()
+	if m.HasTable(&Span{}) && !m.HasIndex(&Span{}, spanDedupIndex) {
+		slog.Info("Removing duplicate spans before adding unique index", "index", spanDedupIndex)
+		var ids []uint
+		if err := db.Raw(`SELECT s.id FROM spans s JOIN (
+			SELECT trace_id, span_id, MIN(id) AS keep_id FROM spans GROUP BY trace_id, span_id HAVING COUNT(*) > 1
+		) d ON s.trace_id = d.trace_id AND s.span_id = d.span_id AND s.id <> d.keep_id`).Scan(&ids).Error; err != nil {
+			return fmt.Errorf("failed to find duplicate spans: %w", err)
+		}
+		if err := deleteInBatches(db, &Span{}, ids); err != nil {
+			return fmt.Errorf("failed to delete duplicate spans: %w", err)
+		}
+		slog.Info("Duplicate spans removed", "count", len(ids))
+	}
+
+	if m.HasTable(&Log{}) && !m.HasIndex(&Log{}, logDedupIndex) {
+		if !m.HasColumn(&Log{}, "DedupKey") {
+			if err := m.AddColumn(&Log{}, "DedupKey"); err != nil {
+				return fmt.Errorf("failed to add logs.dedup_key: %w", err)
+			}
+		}
+		slog.Info("Computing log dedup keys before adding unique index", "index", logDedupIndex)
+		if err := backfillLogDedupKeys(db); err != nil {
+			return err
+		}
+		var ids []uint
+		if err := db.Raw(`SELECT l.id FROM logs l JOIN (
+			SELECT dedup_key, MIN(id) AS keep_id FROM logs GROUP BY dedup_key HAVING COUNT(*) > 1
+		) d ON l.dedup_key = d.dedup_key AND l.id <> d.keep_id`).Scan(&ids).Error; err != nil {
+			return fmt.Errorf("failed to find duplicate logs: %w", err)
+		}
+		for start := 0; start < len(ids); start += dedupBatch {
+			chunk := ids[start:min(start+dedupBatch, len(ids))]
+			if err := db.Where("log_id IN ?", chunk).Delete(&LogAttribute{}).Error; err != nil {
+				return fmt.Errorf("failed to delete attributes of duplicate logs: %w", err)
+			}
+		}
+		if err := deleteInBatches(db, &Log{}, ids); err != nil {
+			return fmt.Errorf("failed to delete duplicate logs: %w", err)
+		}
+		slog.Info("Duplicate logs removed", "count", len(ids))
+	}
+	return nil
+}
+
+// backfillLogDedupKeys computes dedup_key for logs stored without one, dedupBatch
+// rows per transaction.
+func backfillLogDedupKeys(db *gorm.DB) error {
+	var lastID uint
+	for {
+		var batch []Log
+		if err := db.Where("id > ? AND (dedup_key IS NULL OR dedup_key = '')", lastID).
+			Order("id").Limit(dedupBatch).Find(&batch).Error; err != nil {
+			return fmt.Errorf("failed to read logs for dedup keys: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			for i := range batch {
+				if err := tx.Model(&Log{}).Where("id = ?", batch[i].ID).
+					Update("dedup_key", logDedupKey(&batch[i])).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to backfill log dedup keys: %w", err)
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// deleteInBatches deletes the rows of model with the given IDs, dedupBatch at a time.
+func deleteInBatches(db *gorm.DB, model any, ids []uint) error {
+	for start := 0; start < len(ids); start += dedupBatch {
+		if err := db.Where("id IN ?", ids[start:min(start+dedupBatch, len(ids))]).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
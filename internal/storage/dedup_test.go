@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestBatchCreateSkipsRetriedRecords(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.SetLogAttributeKeys([]string{"user.id"})
+	dups := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dups_test"}, []string{"signal"})
+	repo.metrics = &telemetry.Metrics{IngestDuplicates: dups}
+	now := time.Now()
+
+	spans := []Span{
+		{TraceID: "t1", SpanID: "a", StartTime: now},
+		{TraceID: "t1", SpanID: "b", StartTime: now},
+		{TraceID: "t1", SpanID: "a", StartTime: now}, // duplicated within the batch
+	}
+	logs := func() []Log {
+		return []Log{
+			{TraceID: "t1", SpanID: "a", Severity: "ERROR", Body: "boom", AttributesJSON: `{"user.id":"u1"}`, Timestamp: now},
+			{TraceID: "t1", SpanID: "a", Severity: "ERROR", Body: "boom again", Timestamp: now},
+		}
+	}
+	first := logs()
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// The exporter times out and sends the same batches again.
+	retry := logs()
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs(retry); err != nil {
+		t.Fatal(err)
+	}
+
+	var spanCount, logCount, attrCount int64
+	repo.db.Model(&Span{}).Count(&spanCount)
+	repo.db.Model(&Log{}).Count(&logCount)
+	repo.db.Model(&LogAttribute{}).Count(&attrCount)
+	if spanCount != 2 || logCount != 2 || attrCount != 1 {
+		t.Errorf("stored %d spans, %d logs, %d attributes; want 2, 2, 1", spanCount, logCount, attrCount)
+	}
+	for i := range retry {
+		if retry[i].ID != first[i].ID || retry[i].ID == 0 {
+			t.Errorf("retried log %d got ID %d, want stored ID %d", i, retry[i].ID, first[i].ID)
+		}
+	}
+
+	for signal, want := range map[string]float64{"spans": 4, "logs": 2} {
+		var m dto.Metric
+		dups.WithLabelValues(signal).Write(&m)
+		if got := m.GetCounter().GetValue(); got != want {
+			t.Errorf("%s duplicates counted = %v, want %v", signal, got, want)
+		}
+	}
+}
+
+// Databases created before the unique indexes existed are deduplicated on startup.
+func TestMigrateDedupIndexesOnExistingData(t *testing.T) {
+	repo := newTestRepository(t)
+	m := repo.db.Migrator()
+	if err := m.DropIndex(&Span{}, spanDedupIndex); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DropIndex(&Log{}, logDedupIndex); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DropColumn(&Log{}, "DedupKey"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	oldSpans := []Span{
+		{TraceID: "t1", SpanID: "a", StartTime: now},
+		{TraceID: "t1", SpanID: "a", StartTime: now},
+		{TraceID: "t1", SpanID: "b", StartTime: now},
+	}
+	if err := repo.db.Create(&oldSpans).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.db.Omit("DedupKey").Create(&[]Log{
+		{TraceID: "t1", Body: "boom", Timestamp: now},
+		{TraceID: "t1", Body: "boom", Timestamp: now},
+		{TraceID: "t1", Body: "other", Timestamp: now},
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	repo.db.Create(&[]LogAttribute{{LogID: 1, Key: "k", Value: "v"}, {LogID: 2, Key: "k", Value: "v"}})
+
+	if err := migrateBaseline(repo.db, "sqlite"); err != nil {
+		t.Fatalf("migrateBaseline() error = %v", err)
+	}
+	if !m.HasIndex(&Span{}, spanDedupIndex) || !m.HasIndex(&Log{}, logDedupIndex) {
+		t.Fatal("unique indexes not created")
+	}
+
+	var spanIDs, logIDs, attrLogIDs []uint
+	repo.db.Model(&Span{}).Order("id").Pluck("id", &spanIDs)
+	repo.db.Model(&Log{}).Order("id").Pluck("id", &logIDs)
+	repo.db.Model(&LogAttribute{}).Pluck("log_id", &attrLogIDs)
+	if len(spanIDs) != 2 || spanIDs[0] != oldSpans[0].ID {
+		t.Errorf("spans after migration = %v, want the first copy of a and b", spanIDs)
+	}
+	if len(logIDs) != 2 || logIDs[0] != 1 || len(attrLogIDs) != 1 || attrLogIDs[0] != 1 {
+		t.Errorf("logs after migration = %v (attributes of %v), want logs 1 and 3, attributes of 1", logIDs, attrLogIDs)
+	}
+
+	// New copies of migrated rows are recognized.
+	if err := repo.BatchCreateLogs([]Log{{TraceID: "t1", Body: "boom", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	repo.db.Model(&Log{}).Count(&count)
+	if count != 2 {
+		t.Errorf("log count after re-sending a migrated log = %d, want 2", count)
+	}
+}
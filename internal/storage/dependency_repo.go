@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Defaults for DependencyQuery thresholds.
+const (
+	DefaultDependencyErrorRateDelta = 0.05 // +5 percentage points
+	DefaultDependencyLatencyChange  = 0.5  // p95 up by half
+	DefaultDependencyMinCalls       = 10
+)
+
+// DefaultDependencyWindow and MaxDependencyWindow bound the window compared
+// against the one before it.
+const (
+	DefaultDependencyWindow = time.Hour
+	MaxDependencyWindow     = 24 * time.Hour
+)
+
+// DependencyQuery selects the downstream dependencies of a service over a window
+// [Start, End) and the preceding window of equal length.
+type DependencyQuery struct {
+	Service string
+	Start   time.Time
+	End     time.Time
+
+	// A dependency is degraded when, with at least MinCalls calls in the current
+	// window, its error rate rose by more than ErrorRateDelta (absolute, 0-1) or its
+	// p95 latency by more than LatencyChange (relative, 0.5 = +50%).
+	ErrorRateDelta float64
+	LatencyChange  float64
+	MinCalls       int64
+}
+
+// DependencyWindow is the calls from a service to one dependency in one window.
+type DependencyWindow struct {
+	CallCount    int64   `json:"call_count"`
+	ErrorCount   int64   `json:"error_count"`
+	ErrorRate    float64 `json:"error_rate"` // 0-1
+	P95LatencyMs float64 `json:"p95_latency_ms"`
+}
+
+// DependencyHealth compares the calls to one dependency with the previous window.
+type DependencyHealth struct {
+	Target            string           `json:"target"`
+	Current           DependencyWindow `json:"current"`
+	Previous          DependencyWindow `json:"previous"`
+	ErrorRateDelta    float64          `json:"error_rate_delta"`     // current - previous
+	P95LatencyDeltaMs float64          `json:"p95_latency_delta_ms"` // current - previous
+	P95LatencyChange  float64          `json:"p95_latency_change"`   // relative; 0 without previous calls
+	Degraded          bool             `json:"degraded"`
+	Reasons           []string         `json:"reasons,omitempty"` // "error_rate", "latency"
+}
+
+// DependencyHealthResult lists the dependencies of a service, degraded ones first.
+type DependencyHealthResult struct {
+	Service       string             `json:"service"`
+	Start         time.Time          `json:"start"`
+	End           time.Time          `json:"end"`
+	PreviousStart time.Time          `json:"previous_start"`
+	Dependencies  []DependencyHealth `json:"dependencies"`
+}
+
+// dependencyCalls collects the latencies and errors of one window.
+type dependencyCalls struct {
+	latencies []float64 // ms
+	errors    int64
+}
+
+// GetServiceDependenciesContext compares the calls from q.Service to each service it
+// calls, as on the service map (a span of the target whose parent span belongs to
+// q.Service), between the current window and the one before it. Both windows are read
+// with one joined span query, newest first, so past serviceMapSpanLimit calls it is
+// the oldest of the previous window that are left out. Latency is the caller's CLIENT span when there is one,
+// else the callee's span; a call failed when either span has error status.
+func (r *Repository) GetServiceDependenciesContext(ctx context.Context, q DependencyQuery) (*DependencyHealthResult, error) {
+	window := q.End.Sub(q.Start)
+	prevStart := q.Start.Add(-window)
+
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+	rows, err := db.Model(&Span{}).
+		Select("spans.service_name, spans.start_time, spans.duration, spans.has_error, p.kind, p.duration, p.has_error").
+		Joins("JOIN spans AS p ON p.trace_id = spans.trace_id AND p.span_id = spans.parent_span_id").
+		Where("p.service_name = ? AND spans.service_name <> ?", q.Service, q.Service).
+		Where("spans.start_time >= ? AND spans.start_time < ?", prevStart, q.End).
+		Order("spans.start_time DESC").
+		Limit(serviceMapSpanLimit).
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dependencies: %w", err)
+	}
+	defer rows.Close()
+
+	current := make(map[string]*dependencyCalls)
+	previous := make(map[string]*dependencyCalls)
+	for rows.Next() {
+		var (
+			target, parentKind   string
+			start                time.Time
+			duration, parentDur  int64
+			failed, parentFailed bool
+		)
+		if err := rows.Scan(&target, &start, &duration, &failed, &parentKind, &parentDur, &parentFailed); err != nil {
+			return nil, fmt.Errorf("failed to scan dependency row: %w", err)
+		}
+		calls := previous
+		if !start.Before(q.Start) {
+			calls = current
+		}
+		c, ok := calls[target]
+		if !ok {
+			c = &dependencyCalls{}
+			calls[target] = c
+		}
+		if parentKind == SpanKindClient {
+			duration = parentDur
+		}
+		c.latencies = append(c.latencies, float64(duration)/1000.0)
+		if failed || parentFailed {
+			c.errors++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dependencies: %w", err)
+	}
+
+	deps := make([]DependencyHealth, 0, len(current))
+	for target, c := range current {
+		d := DependencyHealth{Target: target, Current: c.window()}
+		if p, ok := previous[target]; ok {
+			d.Previous = p.window()
+		}
+		d.evaluate(q)
+		deps = append(deps, d)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Degraded != deps[j].Degraded {
+			return deps[i].Degraded
+		}
+		if deps[i].Current.CallCount != deps[j].Current.CallCount {
+			return deps[i].Current.CallCount > deps[j].Current.CallCount
+		}
+		return deps[i].Target < deps[j].Target
+	})
+
+	return &DependencyHealthResult{
+		Service:       q.Service,
+		Start:         q.Start,
+		End:           q.End,
+		PreviousStart: prevStart,
+		Dependencies:  deps,
+	}, nil
+}
+
+// window summarizes the collected calls.
+func (c *dependencyCalls) window() DependencyWindow {
+	n := int64(len(c.latencies))
+	w := DependencyWindow{CallCount: n, ErrorCount: c.errors}
+	if n == 0 {
+		return w
+	}
+	w.ErrorRate = roundRate(float64(c.errors) / float64(n))
+	slices.Sort(c.latencies)
+	idx := int(math.Ceil(0.95*float64(n))) - 1
+	w.P95LatencyMs = math.Round(c.latencies[max(idx, 0)]*100) / 100
+	return w
+}
+
+// evaluate fills in the deltas and the degraded flag.
+func (d *DependencyHealth) evaluate(q DependencyQuery) {
+	d.ErrorRateDelta = roundRate(d.Current.ErrorRate - d.Previous.ErrorRate)
+	d.P95LatencyDeltaMs = math.Round((d.Current.P95LatencyMs-d.Previous.P95LatencyMs)*100) / 100
+	if d.Previous.CallCount > 0 && d.Previous.P95LatencyMs > 0 {
+		d.P95LatencyChange = roundRate(d.P95LatencyDeltaMs / d.Previous.P95LatencyMs)
+	}
+	if d.Current.CallCount < q.MinCalls {
+		return
+	}
+	if d.ErrorRateDelta > q.ErrorRateDelta {
+		d.Reasons = append(d.Reasons, "error_rate")
+	}
+	if d.Previous.CallCount > 0 && d.P95LatencyChange > q.LatencyChange {
+		d.Reasons = append(d.Reasons, "latency")
+	}
+	d.Degraded = len(d.Reasons) > 0
+}
+
+// roundRate rounds a ratio to four decimals.
+func roundRate(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
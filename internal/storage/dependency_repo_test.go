@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetServiceDependencies(t *testing.T) {
+	repo := newTestRepository(t)
+	end := time.Now().Truncate(time.Second)
+	start := end.Add(-time.Hour)
+
+	var spans []Span
+	n := 0
+	// call adds a checkout span calling target at ts: a CLIENT span of checkout
+	// taking clientMs, and the target's SERVER span under it.
+	call := func(target string, ts time.Time, clientMs int64, failed bool) {
+		n++
+		traceID := fmt.Sprintf("%032x", n)
+		parent := fmt.Sprintf("%016x", 2*n)
+		spans = append(spans,
+			Span{TraceID: traceID, SpanID: parent, ServiceName: "checkout", Kind: SpanKindClient, StartTime: ts, Duration: clientMs * 1000, HasError: failed},
+			Span{TraceID: traceID, SpanID: fmt.Sprintf("%016x", 2*n+1), ParentSpanID: parent, ServiceName: target, Kind: SpanKindServer, StartTime: ts, Duration: clientMs * 500},
+		)
+	}
+	for i := range 20 {
+		prev := start.Add(-time.Duration(i+1) * time.Minute)
+		cur := start.Add(time.Duration(i+1) * time.Minute)
+		// payment: 0% → 25% errors, latency unchanged.
+		call("payment", prev, 100, false)
+		call("payment", cur, 100, i%4 == 0)
+		// inventory: p95 100ms → 300ms, no errors.
+		call("inventory", prev, 100, false)
+		ms := int64(100)
+		if i >= 15 {
+			ms = 300
+		}
+		call("inventory", cur, ms, false)
+		// shipping: steady.
+		call("shipping", prev, 50, false)
+		call("shipping", cur, 55, false)
+	}
+	// new-dep: only three calls now, nothing before; below MinCalls.
+	for i := range 3 {
+		call("new-dep", start.Add(time.Duration(i)*time.Second), 10, true)
+	}
+	// A call into checkout, and one too old for either window, are not counted.
+	spans = append(spans,
+		Span{TraceID: "ff", SpanID: "f1", ServiceName: "frontend", StartTime: start.Add(time.Minute), Duration: 1000},
+		Span{TraceID: "ff", SpanID: "f2", ParentSpanID: "f1", ServiceName: "checkout", StartTime: start.Add(time.Minute), Duration: 1000},
+	)
+	call("shipping", start.Add(-2*time.Hour-time.Minute), 5000, true)
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.GetServiceDependenciesContext(context.Background(), DependencyQuery{
+		Service:        "checkout",
+		Start:          start,
+		End:            end,
+		ErrorRateDelta: DefaultDependencyErrorRateDelta,
+		LatencyChange:  DefaultDependencyLatencyChange,
+		MinCalls:       DefaultDependencyMinCalls,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.PreviousStart.Equal(start.Add(-time.Hour)) {
+		t.Errorf("PreviousStart = %v, want %v", res.PreviousStart, start.Add(-time.Hour))
+	}
+	byTarget := make(map[string]DependencyHealth)
+	var order []string
+	for _, d := range res.Dependencies {
+		byTarget[d.Target] = d
+		order = append(order, d.Target)
+	}
+	if fmt.Sprint(order) != "[inventory payment shipping new-dep]" {
+		t.Errorf("order = %v, want degraded first, then by calls", order)
+	}
+
+	pay := byTarget["payment"]
+	if pay.Current.CallCount != 20 || pay.Current.ErrorCount != 5 || pay.Current.ErrorRate != 0.25 || pay.Previous.ErrorRate != 0 {
+		t.Errorf("payment windows = %+v / %+v", pay.Current, pay.Previous)
+	}
+	if pay.ErrorRateDelta != 0.25 || !pay.Degraded || fmt.Sprint(pay.Reasons) != "[error_rate]" {
+		t.Errorf("payment = %+v, want degraded on error_rate +0.25", pay)
+	}
+	if pay.Current.P95LatencyMs != 100 || pay.P95LatencyChange != 0 {
+		t.Errorf("payment latency = %+v, want p95 100ms unchanged (caller's CLIENT span)", pay)
+	}
+
+	inv := byTarget["inventory"]
+	if inv.Current.P95LatencyMs != 300 || inv.Previous.P95LatencyMs != 100 || inv.P95LatencyDeltaMs != 200 || inv.P95LatencyChange != 2 {
+		t.Errorf("inventory = %+v, want p95 100 → 300ms (+200ms, change 2)", inv)
+	}
+	if !inv.Degraded || fmt.Sprint(inv.Reasons) != "[latency]" {
+		t.Errorf("inventory = %+v, want degraded on latency", inv)
+	}
+
+	ship := byTarget["shipping"]
+	if ship.Degraded || ship.Previous.CallCount != 20 || ship.P95LatencyChange != 0.1 {
+		t.Errorf("shipping = %+v, want healthy with 20 previous calls and +10%% p95", ship)
+	}
+
+	nd := byTarget["new-dep"]
+	if nd.Degraded || nd.Current.ErrorRate != 1 || nd.ErrorRateDelta != 1 || nd.Previous.CallCount != 0 {
+		t.Errorf("new-dep = %+v, want 100%% errors but not flagged below MinCalls", nd)
+	}
+	if _, ok := byTarget["checkout"]; ok {
+		t.Error("checkout listed as its own dependency")
+	}
+}
+
+func TestDependencyWindowP95(t *testing.T) {
+	c := &dependencyCalls{errors: 1}
+	for i := 20; i >= 1; i-- {
+		c.latencies = append(c.latencies, float64(i))
+	}
+	w := c.window()
+	if w.CallCount != 20 || w.P95LatencyMs != 19 || w.ErrorRate != 0.05 {
+		t.Errorf("window = %+v, want 20 calls, p95 19ms (nearest rank), error rate 0.05", w)
+	}
+	if w := (&dependencyCalls{}).window(); w != (DependencyWindow{}) {
+		t.Errorf("empty window = %+v", w)
+	}
+}
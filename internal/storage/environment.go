@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// environmentSetting is the statement setting that holds the environment of a
+// scoped session.
+const environmentSetting = "otelcontext:environment"
+
+// environmentTables are the tables whose rows carry the deployment environment they
+// were ingested from.
+var environmentTables = map[string]bool{"traces": true, "spans": true, "logs": true}
+
+// environmentKey is the context key of the environment a session is limited to.
+type environmentKey struct{}
+
+// EnvironmentScoper narrows a backend to one deployment environment.
+type EnvironmentScoper interface {
+	ForEnvironment(env string) Backend
+}
+
+// ForEnvironment returns a repository that only reads the traces, spans and logs
+// ingested from env, the deployment.environment resource attribute. It composes
+// with ForTenant and shares the connection pool with r. An empty env returns r.
+//
+// Like the tenant scope, the condition is added by GORM callbacks; it applies to
+// reads only, so ingest and the admin operations are unaffected.
+func (r *Repository) ForEnvironment(env string) Backend {
+	if env == "" {
+		return r
+	}
+	scoped := *r
+	scoped.environment = env
+	scoped.db = r.db.Set(environmentSetting, env).WithContext(scoped.scopeContext(context.Background()))
+	return &scoped
+}
+
+// GetEnvironments returns the distinct environments seen in traces and logs,
+// sorted. Data ingested without one is not listed.
+func (r *Repository) GetEnvironments() ([]string, error) {
+	seen := make(map[string]bool)
+	for _, model := range []any{&Trace{}, &Log{}} {
+		var envs []string
+		if err := r.db.Model(model).Distinct("environment").Where("environment <> ?", "").Pluck("environment", &envs).Error; err != nil {
+			return nil, fmt.Errorf("failed to get environments: %w", err)
+		}
+		for _, env := range envs {
+			seen[env] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(seen)), nil
+}
+
+// statementEnvironment returns the environment a statement is limited to, or "".
+func statementEnvironment(db *gorm.DB) string {
+	if v, ok := db.Get(environmentSetting); ok {
+		if env, _ := v.(string); env != "" {
+			return env
+		}
+	}
+	if db.Statement.Context != nil {
+		env, _ := db.Statement.Context.Value(environmentKey{}).(string)
+		return env
+	}
+	return ""
+}
+
+// registerEnvironmentScope installs the callbacks behind ForEnvironment.
+func registerEnvironmentScope(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("environment:scope_query", scopeToEnvironment),
+		cb.Row().Before("gorm:row").Register("environment:scope_row", scopeToEnvironment),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register environment callbacks: %w", err)
+		}
+	}
+	return nil
+}
+
+// scopeToEnvironment adds "environment = ?" to reads of the environment tables.
+func scopeToEnvironment(db *gorm.DB) {
+	stmt := db.Statement
+	if stmt.SQL.Len() > 0 || !environmentTables[stmt.Table] {
+		return
+	}
+	if env := statementEnvironment(db); env != "" {
+		andWhere(stmt, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "environment"}, Value: env})
+	}
+}
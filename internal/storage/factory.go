@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -51,24 +52,27 @@ func NewDatabase(driver, dsn string) (*gorm.DB, error) {
 			driver = "sqlite"
 			log.Println("DB_DRIVER not set, defaulting to sqlite (OtelContext.db)")
 		}
-		dialector = sqlite.Open(dsn)
+		dialector = sqlite.Open(sqliteDSN(dsn))
 
 	default:
 		return nil, fmt.Errorf("unsupported database driver: %s", driver)
 	}
 
 	db, err := gorm.Open(dialector, &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Error),
+		Logger:  logger.Default.LogMode(logger.Error),
+		NowFunc: func() time.Time { return time.Now().UTC() },
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database (%s): %w", driver, err)
 	}
-
-	// SQLite pragmas must be set via Exec (glebarez/sqlite doesn't support _pragma DSN params)
-	if strings.ToLower(driver) == "sqlite" || driver == "" {
-		db.Exec("PRAGMA journal_mode=WAL")
-		db.Exec("PRAGMA busy_timeout=5000")
-		db.Exec("PRAGMA synchronous=NORMAL")
+	if err := registerTenantScope(db); err != nil {
+		return nil, err
+	}
+	if err := registerEnvironmentScope(db); err != nil {
+		return nil, err
+	}
+	if err := registerUTC(db); err != nil {
+		return nil, err
 	}
 
 	// Configure Connection Pool — configurable via env vars for non-SQLite drivers.
@@ -76,10 +80,16 @@ func NewDatabase(driver, dsn string) (*gorm.DB, error) {
 	if err == nil {
 		switch strings.ToLower(driver) {
 		case "sqlite", "":
-			sqlDB.SetMaxIdleConns(1)
-			sqlDB.SetMaxOpenConns(1)
+			// WAL lets readers run alongside the single active writer, so allow a few
+			// connections. In-memory databases are per-connection and must stay at one.
+			maxOpen := getEnvPoolInt("SQLITE_MAX_OPEN_CONNS", 4)
+			if isSQLiteMemory(dsn) || maxOpen < 1 {
+				maxOpen = 1
+			}
+			sqlDB.SetMaxIdleConns(maxOpen)
+			sqlDB.SetMaxOpenConns(maxOpen)
 			sqlDB.SetConnMaxLifetime(time.Hour)
-			log.Printf("📊 SQLite Optimization: MaxOpen=1, WAL Mode=Enabled")
+			log.Printf("📊 SQLite Optimization: MaxOpen=%d, WAL Mode=Enabled", maxOpen)
 		default:
 			maxOpen := getEnvPoolInt("DB_MAX_OPEN_CONNS", 50)
 			maxIdle := getEnvPoolInt("DB_MAX_IDLE_CONNS", 10)
@@ -94,6 +104,59 @@ func NewDatabase(driver, dsn string) (*gorm.DB, error) {
 	return db, nil
 }
 
+// sqliteDSN appends per-connection pragmas to a SQLite DSN. Each pragma can be
+// overridden by including it in the DSN (e.g. "?_pragma=synchronous(FULL)") or
+// via env: SQLITE_JOURNAL_MODE, SQLITE_BUSY_TIMEOUT_MS, SQLITE_SYNCHRONOUS,
+// SQLITE_CACHE_SIZE_KB. Writers use BEGIN IMMEDIATE so lock upgrades wait on
+// busy_timeout instead of failing with SQLITE_BUSY.
+func sqliteDSN(dsn string) string {
+	defaults := []struct {
+		name  string
+		value string
+	}{
+		{"journal_mode", getEnvPoolString("SQLITE_JOURNAL_MODE", "WAL")},
+		{"busy_timeout", strconv.Itoa(getEnvPoolInt("SQLITE_BUSY_TIMEOUT_MS", 5000))},
+		{"synchronous", getEnvPoolString("SQLITE_SYNCHRONOUS", "NORMAL")},
+		// Negative cache_size is in KiB rather than pages.
+		{"cache_size", strconv.Itoa(-getEnvPoolInt("SQLITE_CACHE_SIZE_KB", 64000))},
+	}
+
+	base, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return dsn
+	}
+
+	existing := make(map[string]bool)
+	for _, p := range params["_pragma"] {
+		name, _, _ := strings.Cut(p, "(")
+		name, _, _ = strings.Cut(name, "=")
+		existing[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	for _, d := range defaults {
+		if !existing[d.name] {
+			params.Add("_pragma", fmt.Sprintf("%s(%s)", d.name, d.value))
+		}
+	}
+	if params.Get("_txlock") == "" {
+		params.Set("_txlock", "immediate")
+	}
+
+	return base + "?" + params.Encode()
+}
+
+// isSQLiteMemory reports whether the DSN refers to an in-memory database.
+func isSQLiteMemory(dsn string) bool {
+	return strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+func getEnvPoolString(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
 func getEnvPoolInt(key string, fallback int) int {
 	if v, ok := os.LookupEnv(key); ok {
 		if i, err := strconv.Atoi(v); err == nil {
@@ -112,26 +175,93 @@ func getEnvPoolDuration(key string, fallback time.Duration) time.Duration {
 	return fallback
 }
 
-// AutoMigrateModels runs GORM auto-migration for all OtelContext models.
-func AutoMigrateModels(db *gorm.DB, driver string) error {
-	// Disable FK checks during migration for MySQL
-	if strings.ToLower(driver) == "mysql" {
+// allModels lists every table OtelContext owns, in migration order.
+var allModels = []interface{}{
+	&Trace{}, &Span{}, &Log{}, &MetricBucket{}, &SLO{}, &SLOStatus{}, &AnomalyEvent{}, &ServiceQuota{},
+	&QuotaUsage{}, &LogAttribute{}, &TraceAnnotation{}, &ServiceMapSnapshot{}, &SpanLink{},
+	&AuditEntry{}, &InsightFeedback{}, &PurgeJob{}, &ServiceLiveness{}, &ReplicaHeartbeat{},
+	&MetricCatalog{}, &ServiceMetadata{}, &OutboxEvent{}, &Investigation{}, &GraphSnapshot{},
+}
+
+// createSchema creates the tables of a new database at the current schema, which
+// MigrateSchema then records at the latest version.
+func createSchema(db *gorm.DB, driver string) error {
+	mysql := strings.ToLower(driver) == "mysql"
+	if mysql {
+		db.Exec("SET FOREIGN_KEY_CHECKS = 0")
+	}
+	if err := db.AutoMigrate(allModels...); err != nil {
+		return fmt.Errorf("failed to create database schema: %w", err)
+	}
+	warnMissingIndexes(db)
+	if mysql {
+		dropIngestForeignKeys(db)
+	}
+	return nil
+}
+
+// baselineModels are the tables of the baseline schema migration. The list is
+// frozen: tables added since have migrations of their own.
+var baselineModels = []interface{}{
+	&Trace{}, &Span{}, &Log{}, &MetricBucket{}, &SLO{}, &SLOStatus{}, &AnomalyEvent{}, &ServiceQuota{},
+	&QuotaUsage{}, &LogAttribute{}, &TraceAnnotation{}, &ServiceMapSnapshot{}, &SpanLink{},
+	&AuditEntry{}, &InsightFeedback{}, &PurgeJob{}, &ServiceLiveness{}, &ReplicaHeartbeat{},
+	&MetricCatalog{}, &ServiceMetadata{},
+}
+
+// migrateBaseline is schema migration 1: what releases before versioned migrations
+// ran on every start, applied once to bring their databases to the baseline. Do not
+// change it; later model changes are migrations of their own, written to skip what
+// AutoMigrate here already added.
+func migrateBaseline(db *gorm.DB, driver string) error {
+	mysql := strings.ToLower(driver) == "mysql"
+	if mysql {
 		db.Exec("SET FOREIGN_KEY_CHECKS = 0")
 		log.Println("🔓 Disabled foreign key checks for migration")
 	}
 
-	if err := db.AutoMigrate(&Trace{}, &Span{}, &Log{}, &MetricBucket{}); err != nil {
+	if err := migrateDedupIndexes(db); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(baselineModels...); err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	warnMissingIndexes(db)
+
+	// Rows ingested before scope columns existed have NULL scope; normalize them so
+	// equality filters and string scans behave the same for old and new data.
+	for _, table := range []string{"spans", "logs"} {
+		if err := db.Exec("UPDATE " + table + " SET scope_name = '' WHERE scope_name IS NULL").Error; err != nil {
+			return fmt.Errorf("failed to backfill %s.scope_name: %w", table, err)
+		}
+		if err := db.Exec("UPDATE " + table + " SET scope_version = '' WHERE scope_version IS NULL").Error; err != nil {
+			return fmt.Errorf("failed to backfill %s.scope_version: %w", table, err)
+		}
+	}
 
-	// Drop foreign keys that AutoMigrate may have created (MySQL)
-	if strings.ToLower(driver) == "mysql" {
-		db.Exec("ALTER TABLE spans DROP FOREIGN KEY fk_traces_spans")
-		db.Exec("ALTER TABLE logs DROP FOREIGN KEY fk_traces_logs")
-		db.Exec("SET FOREIGN_KEY_CHECKS = 1")
-		log.Println("🔓 Dropped FK constraints for async ingestion compatibility")
+	// Traces stored before has_error existed only know their own status; carry it
+	// over so rollup error counts never drop below root-only counts.
+	if err := db.Exec("UPDATE traces SET has_error = ? WHERE has_error = ? AND status LIKE ?", true, false, "%ERROR%").Error; err != nil {
+		return fmt.Errorf("failed to backfill traces.has_error: %w", err)
 	}
 
+	if err := normalizeLogSeverities(db); err != nil {
+		return err
+	}
+
+	if mysql {
+		dropIngestForeignKeys(db)
+	}
 	return nil
 }
 
+// dropIngestForeignKeys drops the foreign keys AutoMigrate creates on MySQL, since
+// spans and logs may arrive before their trace, and turns FK checks back on.
+func dropIngestForeignKeys(db *gorm.DB) {
+	db.Exec("ALTER TABLE spans DROP FOREIGN KEY fk_traces_spans")
+	db.Exec("ALTER TABLE logs DROP FOREIGN KEY fk_traces_logs")
+	db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+	log.Println("🔓 Dropped FK constraints for async ingestion compatibility")
+}
+
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	dsn := sqliteDSN("test.db?_pragma=synchronous(FULL)")
+	if !strings.HasPrefix(dsn, "test.db?") {
+		t.Fatalf("dsn = %q, want test.db base preserved", dsn)
+	}
+	for _, want := range []string{"journal_mode%28WAL%29", "busy_timeout%285000%29", "synchronous%28FULL%29", "cache_size", "_txlock=immediate"} {
+		if !strings.Contains(dsn, want) {
+			t.Errorf("dsn %q missing %q", dsn, want)
+		}
+	}
+	if strings.Contains(dsn, "synchronous%28NORMAL%29") {
+		t.Errorf("dsn %q should keep the explicit synchronous override", dsn)
+	}
+}
+
+// TestSQLiteConcurrentReadWrite hammers a file-backed SQLite database with
+// concurrent writers and readers; none of them may fail with SQLITE_BUSY.
+func TestSQLiteConcurrentReadWrite(t *testing.T) {
+	repo := newTestRepository(t)
+
+	const writers, readers, iterations = 4, 8, 25
+	errCh := make(chan error, (writers+readers)*iterations)
+	var wg sync.WaitGroup
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				logs := make([]Log, 20)
+				for j := range logs {
+					logs[j] = Log{ServiceName: fmt.Sprintf("svc-%d", w), Severity: "INFO", Body: "stress", Timestamp: time.Now()}
+				}
+				if err := repo.BatchCreateLogs(logs); err != nil {
+					errCh <- err
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				if _, _, err := repo.GetLogsV2(LogFilter{Limit: 50}); err != nil {
+					errCh <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		t.Errorf("concurrent access failed: %v", err)
+	}
+
+	var count int64
+	repo.db.Model(&Log{}).Count(&count)
+	if want := int64(writers * iterations * 20); count != want {
+		t.Errorf("log count = %d, want %d", count, want)
+	}
+
+	var mode string
+	repo.db.Raw("PRAGMA journal_mode").Scan(&mode)
+	if !strings.EqualFold(mode, "wal") {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+}
+
+func TestIsSQLiteMemory(t *testing.T) {
+	if !isSQLiteMemory(":memory:") || !isSQLiteMemory("file:x?mode=memory&cache=shared") {
+		t.Error("expected in-memory DSNs to be detected")
+	}
+	if isSQLiteMemory(filepath.Join("data", "OtelContext.db")) {
+		t.Error("file DSN detected as in-memory")
+	}
+}
+
+func TestBaselineBackfillsNullScope(t *testing.T) {
+	repo := newTestRepository(t)
+	if err := repo.BatchCreateSpans([]Span{{TraceID: "t1", SpanID: "s1", ServiceName: "legacy", StartTime: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a row written before the scope columns existed.
+	repo.db.Exec("UPDATE spans SET scope_name = NULL, scope_version = NULL")
+
+	if err := migrateBaseline(repo.db, "sqlite"); err != nil {
+		t.Fatalf("migrateBaseline() error = %v", err)
+	}
+	var nulls int64
+	repo.db.Model(&Span{}).Where("scope_name IS NULL OR scope_version IS NULL").Count(&nulls)
+	if nulls != 0 {
+		t.Errorf("%d spans still have NULL scope after migration", nulls)
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+// FlamegraphNode is one frame in the nested format consumed by d3-flamegraph. Value
+// is the frame's self time in microseconds (render with selfValue(true)).
+type FlamegraphNode struct {
+	Name     string            `json:"name"`
+	Value    int64             `json:"value"`
+	Children []*FlamegraphNode `json:"children"`
+}
+
+// FlamegraphRootName names the synthetic frame that holds a trace's root spans and
+// any spans whose parent is missing.
+const FlamegraphRootName = "trace"
+
+// BuildFlamegraph turns the spans of a trace into a flamegraph under a synthetic root.
+// Frames are named "service: operation". With merge, sibling frames of the same name
+// are combined, summing their values and merging their children the same way.
+func BuildFlamegraph(spans []Span, merge bool) *FlamegraphNode {
+	root := &FlamegraphNode{Name: FlamegraphRootName, Children: []*FlamegraphNode{}}
+	for _, n := range BuildSpanTree(spans) {
+		root.Children = append(root.Children, flameFrame(n))
+	}
+	if merge {
+		mergeFrames(root)
+	}
+	return root
+}
+
+func flameFrame(n *SpanNode) *FlamegraphNode {
+	f := &FlamegraphNode{
+		Name:     n.Span.ServiceName + ": " + n.Span.OperationName,
+		Value:    selfTime(n),
+		Children: make([]*FlamegraphNode, 0, len(n.Children)),
+	}
+	for _, c := range n.Children {
+		f.Children = append(f.Children, flameFrame(c))
+	}
+	return f
+}
+
+// mergeFrames combines same-named siblings below f, keeping first-seen order.
+func mergeFrames(f *FlamegraphNode) {
+	byName := make(map[string]*FlamegraphNode, len(f.Children))
+	merged := f.Children[:0]
+	for _, c := range f.Children {
+		if m, ok := byName[c.Name]; ok {
+			m.Value += c.Value
+			m.Children = append(m.Children, c.Children...)
+			continue
+		}
+		byName[c.Name] = c
+		merged = append(merged, c)
+	}
+	f.Children = merged
+	for _, c := range f.Children {
+		mergeFrames(c)
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var flameBase = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// flameSpan starts at offset µs after flameBase and lasts duration µs.
+func flameSpan(id, parent, service, op string, offset, duration int64) Span {
+	return Span{
+		TraceID:       "t1",
+		SpanID:        id,
+		ParentSpanID:  parent,
+		ServiceName:   service,
+		OperationName: op,
+		StartTime:     flameBase.Add(time.Duration(offset) * time.Microsecond),
+		Duration:      duration,
+	}
+}
+
+func TestBuildFlamegraph(t *testing.T) {
+	spans := []Span{
+		flameSpan("a", "", "api", "GET /orders", 0, 1000),
+		// Two concurrent queries overlapping for 100µs: 500µs of api's time is covered.
+		flameSpan("b", "a", "db", "SELECT", 100, 300),
+		flameSpan("c", "a", "db", "SELECT", 300, 300),
+		flameSpan("d", "c", "db", "fsync", 350, 50),
+		// Parent not in the trace (e.g. sampled out upstream).
+		flameSpan("e", "missing", "worker", "consume", 2000, 400),
+	}
+
+	root := BuildFlamegraph(spans, false)
+	if root.Name != FlamegraphRootName || len(root.Children) != 2 {
+		t.Fatalf("root = %s with %d children, want the api root and the orphan", root.Name, len(root.Children))
+	}
+	api, orphan := root.Children[0], root.Children[1]
+	if api.Name != "api: GET /orders" || api.Value != 500 || len(api.Children) != 2 {
+		t.Errorf("api frame = %s value %d with %d children, want self time 500 and 2 children", api.Name, api.Value, len(api.Children))
+	}
+	if c := api.Children[1]; c.Value != 250 || len(c.Children) != 1 || c.Children[0].Value != 50 {
+		t.Errorf("second SELECT = value %d, want 250 with an fsync child of 50", c.Value)
+	}
+	if orphan.Name != "worker: consume" || orphan.Value != 400 {
+		t.Errorf("orphan frame = %s value %d", orphan.Name, orphan.Value)
+	}
+
+	merged := BuildFlamegraph(spans, true).Children[0]
+	if len(merged.Children) != 1 {
+		t.Fatalf("merged api frame has %d children, want 1", len(merged.Children))
+	}
+	if sel := merged.Children[0]; sel.Name != "db: SELECT" || sel.Value != 300+250 || len(sel.Children) != 1 {
+		t.Errorf("merged SELECT = value %d with %d children, want 550 and the fsync child", sel.Value, len(sel.Children))
+	}
+}
+
+func TestBuildFlamegraphDeepAndCyclic(t *testing.T) {
+	const depth = 2000
+	var spans []Span
+	for i := 0; i < depth; i++ {
+		parent := ""
+		if i > 0 {
+			parent = fmt.Sprintf("s%d", i-1)
+		}
+		// Each span covers its child completely except for 1µs at the end.
+		spans = append(spans, flameSpan(fmt.Sprintf("s%d", i), parent, "svc", "op", int64(i), int64(depth-i)))
+	}
+	// A parent cycle must not hide its spans or loop forever.
+	spans = append(spans,
+		flameSpan("x", "y", "svc", "x", 0, 10),
+		flameSpan("y", "x", "svc", "y", 5, 10),
+	)
+
+	root := BuildFlamegraph(spans, false)
+	frames, levels := 0, 0
+	var walk func(f *FlamegraphNode, level int)
+	walk = func(f *FlamegraphNode, level int) {
+		frames++
+		levels = max(levels, level)
+		if f.Value != 1 && f.Name == "svc: op" {
+			t.Errorf("frame at level %d has self time %d, want 1", level, f.Value)
+		}
+		for _, c := range f.Children {
+			walk(c, level+1)
+		}
+	}
+	for _, c := range root.Children {
+		walk(c, 1)
+	}
+	if frames != depth+2 || levels != depth {
+		t.Errorf("frames = %d, depth = %d; want %d frames, depth %d", frames, levels, depth+2, depth)
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ExpectedIndex is an index the trace, span and log searches rely on.
+type ExpectedIndex struct {
+	Table   string   `json:"table"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+// expectedIndexes are declared on the models, so createSchema creates them on
+// every driver; the audit finds those lost to a failed migration or a manual DROP
+// INDEX. Without the composite ones MySQL resorts to index merges or full scans for
+// "service X in the last hour" on a large table.
+var expectedIndexes = []ExpectedIndex{
+	{"traces", "idx_traces_service_timestamp", []string{"service_name", "timestamp"}},
+	{"traces", "idx_traces_status_timestamp", []string{"status", "timestamp"}},
+	{"logs", "idx_logs_service_timestamp", []string{"service_name", "timestamp"}},
+	{"logs", "idx_logs_severity_timestamp", []string{"severity", "timestamp"}},
+	{"logs", "idx_logs_trace_id", []string{"trace_id"}},
+	{"spans", "idx_spans_trace_id", []string{"trace_id"}},
+	{"spans", "idx_spans_service_start", []string{"service_name", "start_time"}},
+	{"spans", "idx_spans_operation_start", []string{"operation_name", "start_time"}},
+	{"spans", "idx_spans_span_id", []string{"span_id"}},
+}
+
+// IndexAudit lists the indexes of OtelContext's tables and the expected ones missing.
+type IndexAudit struct {
+	Driver  string          `json:"driver"`
+	Indexes []IndexInfo     `json:"indexes"`
+	Missing []ExpectedIndex `json:"missing"`
+}
+
+// IndexInfo is an existing index. Primary keys are left out.
+type IndexInfo struct {
+	Table    string   `json:"table"`
+	Name     string   `json:"name"`
+	Columns  []string `json:"columns"`
+	Unique   bool     `json:"unique"`
+	Expected bool     `json:"expected"` // serves one of the expected indexes
+}
+
+// AuditIndexes reports the indexes of every table and flags expected indexes that are
+// missing. An index under another name counts when its leading columns match.
+func (r *Repository) AuditIndexes() (*IndexAudit, error) {
+	audit, err := auditIndexes(r.primary())
+	if err != nil {
+		return nil, err
+	}
+	audit.Driver = r.driver
+	return audit, nil
+}
+
+func auditIndexes(db *gorm.DB) (*IndexAudit, error) {
+	// The SQLite migrator logs its PRAGMA queries at debug level; keep them quiet.
+	db = db.Session(&gorm.Session{Logger: logger.Discard})
+	m := db.Migrator()
+	audit := &IndexAudit{Indexes: []IndexInfo{}, Missing: []ExpectedIndex{}}
+	found := make(map[string]bool, len(expectedIndexes)) // by expected index name
+	for _, model := range allModels {
+		if !m.HasTable(model) {
+			continue
+		}
+		indexes, err := m.GetIndexes(model)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes of %T: %w", model, err)
+		}
+		for _, idx := range indexes {
+			if pk, _ := idx.PrimaryKey(); pk {
+				continue
+			}
+			unique, _ := idx.Unique()
+			info := IndexInfo{Table: idx.Table(), Name: idx.Name(), Columns: idx.Columns(), Unique: unique}
+			for _, want := range expectedIndexes {
+				if want.Table == info.Table && len(info.Columns) >= len(want.Columns) &&
+					slices.Equal(info.Columns[:len(want.Columns)], want.Columns) {
+					info.Expected = true
+					found[want.Name] = true
+				}
+			}
+			audit.Indexes = append(audit.Indexes, info)
+		}
+	}
+	sort.Slice(audit.Indexes, func(i, j int) bool {
+		a, b := audit.Indexes[i], audit.Indexes[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Name < b.Name
+	})
+	for _, want := range expectedIndexes {
+		if !found[want.Name] {
+			audit.Missing = append(audit.Missing, want)
+		}
+	}
+	return audit, nil
+}
+
+// warnMissingIndexes logs expected indexes AutoMigrate did not leave behind.
+func warnMissingIndexes(db *gorm.DB) {
+	audit, err := auditIndexes(db)
+	if err != nil {
+		slog.Warn("Index audit failed", "error", err)
+		return
+	}
+	for _, idx := range audit.Missing {
+		slog.Warn("Expected index is missing", "table", idx.Table, "index", idx.Name, "columns", idx.Columns)
+	}
+}
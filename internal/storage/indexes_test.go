@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAutoMigrateCreatesExpectedIndexes(t *testing.T) {
+	repo := newTestRepository(t)
+	// A second migration over the same database must not fail or duplicate anything.
+	if err := migrateBaseline(repo.db, "sqlite"); err != nil {
+		t.Fatalf("second migrateBaseline() error = %v", err)
+	}
+
+	audit, err := repo.AuditIndexes()
+	if err != nil {
+		t.Fatalf("AuditIndexes() error = %v", err)
+	}
+	if len(audit.Missing) != 0 {
+		t.Errorf("missing = %+v, want none", audit.Missing)
+	}
+	byName := make(map[string]IndexInfo)
+	for _, idx := range audit.Indexes {
+		if _, dup := byName[idx.Name]; dup {
+			t.Errorf("index %s listed twice", idx.Name)
+		}
+		byName[idx.Name] = idx
+	}
+	for _, want := range expectedIndexes {
+		got, ok := byName[want.Name]
+		if !ok || got.Table != want.Table || strings.Join(got.Columns, ",") != strings.Join(want.Columns, ",") || !got.Expected {
+			t.Errorf("%s = %+v, want %v on %s", want.Name, got, want.Columns, want.Table)
+		}
+	}
+	if idx := byName["idx_logs_scope_name"]; idx.Expected {
+		t.Errorf("idx_logs_scope_name flagged as expected")
+	}
+}
+
+// queryPlan returns SQLite's plan for query, one step per line.
+func queryPlan(t *testing.T, repo *Repository, query string, args ...any) string {
+	t.Helper()
+	var steps []struct{ Detail string }
+	if err := repo.db.Raw("EXPLAIN QUERY PLAN "+query, args...).Scan(&steps).Error; err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN error = %v", err)
+	}
+	var lines []string
+	for _, s := range steps {
+		lines = append(lines, s.Detail)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestServiceTimestampIndexQueryPlan(t *testing.T) {
+	repo := newTestRepository(t)
+	const query = "SELECT id FROM logs WHERE service_name = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp DESC"
+	args := []any{"checkout", "2026-01-01", "2026-01-02"}
+
+	if plan := queryPlan(t, repo, query, args...); !strings.Contains(plan, "idx_logs_service_timestamp") {
+		t.Fatalf("plan with the composite index:\n%s", plan)
+	}
+
+	if err := repo.db.Exec("DROP INDEX idx_logs_service_timestamp").Error; err != nil {
+		t.Fatal(err)
+	}
+	plan := queryPlan(t, repo, query, args...)
+	if strings.Contains(plan, "idx_logs_service_timestamp") {
+		t.Fatalf("plan still uses the dropped index:\n%s", plan)
+	}
+	audit, err := repo.AuditIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audit.Missing) != 1 || audit.Missing[0].Name != "idx_logs_service_timestamp" {
+		t.Errorf("missing = %+v, want idx_logs_service_timestamp", audit.Missing)
+	}
+
+	// Migrating again puts it back.
+	if err := migrateBaseline(repo.db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if plan := queryPlan(t, repo, query, args...); !strings.Contains(plan, "idx_logs_service_timestamp") {
+		t.Errorf("plan after re-migration:\n%s", plan)
+	}
+}
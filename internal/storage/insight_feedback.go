@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Insight ratings.
+const (
+	InsightHelpful   = "helpful"
+	InsightUnhelpful = "unhelpful"
+)
+
+// DefaultInsightSuppressAfter is how many unhelpful ratings suppress analysis of an
+// error fingerprint.
+const DefaultInsightSuppressAfter = 3
+
+const maxFeedbackComment = 1024
+
+// ErrInvalidFeedback is returned for feedback with an unknown rating or an
+// oversized comment.
+var ErrInvalidFeedback = errors.New("invalid feedback")
+
+// Variable parts of log bodies, replaced before fingerprinting so that the same
+// error with a different ID, count or value fingerprints the same.
+var (
+	fingerprintUUID   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	fingerprintHex    = regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|[0-9a-fA-F]{8,})\b`)
+	fingerprintQuoted = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	fingerprintNumber = regexp.MustCompile(`\d+(?:\.\d+)?`)
+	fingerprintSpace  = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeErrorBody replaces the variable parts of a log body — UUIDs, hex IDs,
+// quoted values and numbers — with placeholders.
+func NormalizeErrorBody(body string) string {
+	body = fingerprintUUID.ReplaceAllString(body, "<uuid>")
+	body = fingerprintHex.ReplaceAllString(body, "<hex>")
+	body = fingerprintQuoted.ReplaceAllString(body, "<str>")
+	body = fingerprintNumber.ReplaceAllString(body, "<n>")
+	return strings.TrimSpace(fingerprintSpace.ReplaceAllString(body, " "))
+}
+
+// ErrorFingerprint identifies an error of a service by its normalized body.
+func ErrorFingerprint(service, body string) string {
+	sum := sha256.Sum256([]byte(service + "\x00" + NormalizeErrorBody(body)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// InsightSuppression reports whether AI analysis of an error fingerprint is
+// suppressed: after SuppressAfter unhelpful ratings. SuppressAfter 0 never suppresses.
+type InsightSuppression struct {
+	Fingerprint   string `json:"fingerprint"`
+	Unhelpful     int64  `json:"unhelpful"`
+	SuppressAfter int    `json:"suppress_after"`
+	Suppressed    bool   `json:"suppressed"`
+}
+
+// CreateInsightFeedback stores a rating of the insight on log f.LogID, filling in
+// the log's service, fingerprint and current insight. It returns
+// gorm.ErrRecordNotFound when the log does not exist and ErrInvalidFeedback for a bad
+// rating or comment.
+func (r *Repository) CreateInsightFeedback(f *InsightFeedback) error {
+	switch {
+	case f.Rating != InsightHelpful && f.Rating != InsightUnhelpful:
+		return fmt.Errorf("%w: rating must be %s or %s", ErrInvalidFeedback, InsightHelpful, InsightUnhelpful)
+	case len(f.Comment) > maxFeedbackComment:
+		return fmt.Errorf("%w: comment exceeds %d bytes", ErrInvalidFeedback, maxFeedbackComment)
+	}
+
+	l, err := r.GetLog(f.LogID)
+	if err != nil {
+		return fmt.Errorf("failed to look up log: %w", err)
+	}
+	f.TenantID = l.TenantID
+	f.ServiceName = l.ServiceName
+	f.Fingerprint = ErrorFingerprint(l.ServiceName, string(l.Body))
+	f.Insight = string(l.AIInsight)
+	if err := r.db.Create(f).Error; err != nil {
+		return fmt.Errorf("failed to create insight feedback: %w", err)
+	}
+	return nil
+}
+
+// GetInsightSuppression counts the unhelpful ratings of a fingerprint against
+// suppressAfter.
+func (r *Repository) GetInsightSuppression(fingerprint string, suppressAfter int) (InsightSuppression, error) {
+	s := InsightSuppression{Fingerprint: fingerprint, SuppressAfter: suppressAfter}
+	if err := r.db.Model(&InsightFeedback{}).
+		Where("fingerprint = ? AND rating = ?", fingerprint, InsightUnhelpful).
+		Count(&s.Unhelpful).Error; err != nil {
+		return s, fmt.Errorf("failed to count insight feedback: %w", err)
+	}
+	s.Suppressed = suppressAfter > 0 && s.Unhelpful >= int64(suppressAfter)
+	return s, nil
+}
+
+// InsightFeedbackSummary aggregates the ratings of one service's insights.
+type InsightFeedbackSummary struct {
+	ServiceName  string  `json:"service_name"`
+	Helpful      int64   `json:"helpful"`
+	Unhelpful    int64   `json:"unhelpful"`
+	HelpfulRate  float64 `json:"helpful_rate"` // 0-1
+	Fingerprints int64   `json:"fingerprints"` // distinct errors rated
+	Suppressed   int64   `json:"suppressed"`   // fingerprints at or over suppressAfter
+}
+
+// GetInsightFeedbackSummary aggregates ratings per service, most rated first.
+func (r *Repository) GetInsightFeedbackSummary(suppressAfter int) ([]InsightFeedbackSummary, error) {
+	type row struct {
+		ServiceName string
+		Fingerprint string
+		Helpful     int64
+		Unhelpful   int64
+	}
+	var rows []row
+	if err := r.db.Model(&InsightFeedback{}).
+		Select("service_name, fingerprint, "+
+			"SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) AS helpful, "+
+			"SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) AS unhelpful", InsightHelpful, InsightUnhelpful).
+		Group("service_name, fingerprint").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to summarize insight feedback: %w", err)
+	}
+
+	byService := make(map[string]*InsightFeedbackSummary)
+	var out []*InsightFeedbackSummary
+	for _, row := range rows {
+		s, ok := byService[row.ServiceName]
+		if !ok {
+			s = &InsightFeedbackSummary{ServiceName: row.ServiceName}
+			byService[row.ServiceName] = s
+			out = append(out, s)
+		}
+		s.Helpful += row.Helpful
+		s.Unhelpful += row.Unhelpful
+		s.Fingerprints++
+		if suppressAfter > 0 && row.Unhelpful >= int64(suppressAfter) {
+			s.Suppressed++
+		}
+	}
+	summaries := make([]InsightFeedbackSummary, 0, len(out))
+	for _, s := range out {
+		if total := s.Helpful + s.Unhelpful; total > 0 {
+			s.HelpfulRate = roundRate(float64(s.Helpful) / float64(total))
+		}
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		ti, tj := summaries[i].Helpful+summaries[i].Unhelpful, summaries[j].Helpful+summaries[j].Unhelpful
+		if ti != tj {
+			return ti > tj
+		}
+		return summaries[i].ServiceName < summaries[j].ServiceName
+	})
+	return summaries, nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestErrorFingerprint(t *testing.T) {
+	a := ErrorFingerprint("api", `user 42 not found: id=5f0c9a2e-1b3d-4c5e-8f70-123456789abc "alice"`)
+	b := ErrorFingerprint("api", `user 7 not found:  id=0a1b2c3d-4e5f-6071-8293-a4b5c6d7e8f9 "bob"`)
+	if a != b {
+		t.Errorf("fingerprints differ for the same error: %s vs %s", a, b)
+	}
+	if ErrorFingerprint("web", "user 42 not found") == ErrorFingerprint("api", "user 42 not found") {
+		t.Error("same fingerprint across services")
+	}
+	if got := NormalizeErrorBody("timeout after 30.5s on 0xdeadbeef"); got != "timeout after <n>s on <hex>" {
+		t.Errorf("NormalizeErrorBody() = %q", got)
+	}
+}
+
+func TestInsightFeedbackSuppression(t *testing.T) {
+	repo := newTestRepository(t)
+	logs := []Log{
+		{ServiceName: "api", Severity: "ERROR", Body: "db timeout after 30s", Timestamp: time.Now()},
+		{ServiceName: "api", Severity: "ERROR", Body: "db timeout after 45s", Timestamp: time.Now()},
+		{ServiceName: "web", Severity: "ERROR", Body: "render failed", Timestamp: time.Now()},
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.CreateInsightFeedback(&InsightFeedback{LogID: logs[0].ID, Rating: "meh"}); !errors.Is(err, ErrInvalidFeedback) {
+		t.Errorf("bad rating: err = %v, want ErrInvalidFeedback", err)
+	}
+	if err := repo.CreateInsightFeedback(&InsightFeedback{LogID: 9999, Rating: InsightHelpful}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("missing log: err = %v, want ErrRecordNotFound", err)
+	}
+
+	rate := func(id uint, rating string) InsightFeedback {
+		t.Helper()
+		f := InsightFeedback{LogID: id, Rating: rating}
+		if err := repo.CreateInsightFeedback(&f); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	f := rate(logs[0].ID, InsightUnhelpful)
+	rate(logs[1].ID, InsightUnhelpful) // same error, different duration
+	rate(logs[2].ID, InsightHelpful)
+	if f.ServiceName != "api" || f.Fingerprint == "" {
+		t.Fatalf("feedback = %+v, want the log's service and fingerprint", f)
+	}
+
+	s, err := repo.GetInsightSuppression(f.Fingerprint, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Unhelpful != 2 || s.Suppressed {
+		t.Errorf("after 2 unhelpful: %+v, want not suppressed", s)
+	}
+	rate(logs[0].ID, InsightUnhelpful)
+	if s, _ = repo.GetInsightSuppression(f.Fingerprint, 3); !s.Suppressed {
+		t.Errorf("after 3 unhelpful: %+v, want suppressed", s)
+	}
+	if s, _ = repo.GetInsightSuppression(f.Fingerprint, 0); s.Suppressed {
+		t.Error("suppressAfter 0 suppressed")
+	}
+
+	summary, err := repo.GetInsightFeedbackSummary(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 2 || summary[0].ServiceName != "api" || summary[0].Unhelpful != 3 || summary[0].Suppressed != 1 || summary[0].Fingerprints != 1 {
+		t.Fatalf("summary = %+v", summary)
+	}
+	if summary[1].ServiceName != "web" || summary[1].HelpfulRate != 1 {
+		t.Errorf("web summary = %+v", summary[1])
+	}
+}
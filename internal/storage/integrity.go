@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrIntegrityUnsupported is returned by CheckIntegrity for drivers without a check.
+var ErrIntegrityUnsupported = errors.New("integrity checks are not supported for this database driver")
+
+// IntegrityReport is the outcome of CheckIntegrity.
+type IntegrityReport struct {
+	Driver string `json:"driver"`
+	Check  string `json:"check"` // what ran, e.g. "PRAGMA quick_check" or "CHECK TABLE"
+	// OK reports whether the database is consistent — after the repair, if one ran.
+	OK       bool     `json:"ok"`
+	Problems []string `json:"problems,omitempty"`
+	// Reindexed is set when indexes were rebuilt; ProblemsAfterRepair then holds
+	// whatever a second check still found.
+	Reindexed           bool     `json:"reindexed"`
+	ProblemsAfterRepair []string `json:"problems_after_repair,omitempty"`
+}
+
+// integrityChecker is one driver's consistency check and index rebuild.
+type integrityChecker struct {
+	name    func(quick bool) string
+	check   func(db *gorm.DB, tables []string, quick bool) ([]string, error)
+	reindex func(db *gorm.DB, tables []string) error
+}
+
+// CheckIntegrity runs the driver's consistency check over OtelContext's tables:
+// PRAGMA integrity_check (quick_check when quick) on SQLite, CHECK TABLE on MySQL,
+// and on PostgreSQL index validity plus amcheck's bt_index_check when the extension
+// is installed. With repair, indexes are rebuilt afterwards and checked again.
+//
+// The check can take minutes on a large database and is not bound by the query
+// timeout; cancel ctx to abandon it.
+func (r *Repository) CheckIntegrity(ctx context.Context, quick, repair bool) (*IntegrityReport, error) {
+	var c integrityChecker
+	switch r.driver {
+	case "sqlite", "":
+		c = sqliteIntegrity
+	case "postgres", "postgresql":
+		c = postgresIntegrity
+	case "mysql":
+		c = mysqlIntegrity
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrIntegrityUnsupported, r.driver)
+	}
+
+	tables, err := r.tableNames()
+	if err != nil {
+		return nil, err
+	}
+	db := r.primary().WithContext(ctx)
+	report := &IntegrityReport{Driver: r.driver, Check: c.name(quick)}
+	if report.Problems, err = c.check(db, tables, quick); err != nil {
+		return nil, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	report.OK = len(report.Problems) == 0
+	if !repair {
+		return report, nil
+	}
+
+	if err := c.reindex(db, tables); err != nil {
+		return nil, fmt.Errorf("failed to rebuild indexes: %w", err)
+	}
+	report.Reindexed = true
+	if report.ProblemsAfterRepair, err = c.check(db, tables, quick); err != nil {
+		return nil, fmt.Errorf("failed to re-check database integrity: %w", err)
+	}
+	report.OK = len(report.ProblemsAfterRepair) == 0
+	slog.Info("Database indexes rebuilt", "driver", r.driver, "problems_before", len(report.Problems), "problems_after", len(report.ProblemsAfterRepair))
+	return report, nil
+}
+
+// tableNames returns the table names of allModels.
+func (r *Repository) tableNames() ([]string, error) {
+	names := make([]string, 0, len(allModels))
+	for _, m := range allModels {
+		stmt := &gorm.Statement{DB: r.db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, fmt.Errorf("failed to resolve table for %T: %w", m, err)
+		}
+		names = append(names, stmt.Schema.Table)
+	}
+	return names, nil
+}
+
+// sqliteIntegrity checks the whole database file; SQLite answers a single "ok" row
+// when it finds nothing wrong.
+var sqliteIntegrity = integrityChecker{
+	name: func(quick bool) string {
+		if quick {
+			return "PRAGMA quick_check"
+		}
+		return "PRAGMA integrity_check"
+	},
+	check: func(db *gorm.DB, _ []string, quick bool) ([]string, error) {
+		stmt := "PRAGMA integrity_check"
+		if quick {
+			stmt = "PRAGMA quick_check"
+		}
+		var lines []string
+		if err := db.Raw(stmt).Scan(&lines).Error; err != nil {
+			return nil, err
+		}
+		if len(lines) == 1 && lines[0] == "ok" {
+			return nil, nil
+		}
+		return lines, nil
+	},
+	reindex: func(db *gorm.DB, _ []string) error {
+		return db.Exec("REINDEX").Error
+	},
+}
+
+// mysqlIntegrity runs CHECK TABLE and rebuilds with OPTIMIZE TABLE, which InnoDB
+// carries out as a table recreate plus analyze.
+var mysqlIntegrity = integrityChecker{
+	name: func(quick bool) string {
+		if quick {
+			return "CHECK TABLE QUICK"
+		}
+		return "CHECK TABLE"
+	},
+	check: func(db *gorm.DB, tables []string, quick bool) ([]string, error) {
+		stmt := "CHECK TABLE " + strings.Join(tables, ", ")
+		if quick {
+			stmt += " QUICK"
+		}
+		var rows []mysqlAdminRow
+		if err := db.Raw(stmt).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		var problems []string
+		for _, row := range rows {
+			if strings.EqualFold(row.MsgType, "status") && (row.MsgText == "OK" || row.MsgText == "Table is already up to date") {
+				continue
+			}
+			if strings.EqualFold(row.MsgType, "note") {
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s: %s", row.Table, row.MsgType, row.MsgText))
+		}
+		return problems, nil
+	},
+	reindex: func(db *gorm.DB, tables []string) error {
+		var rows []mysqlAdminRow
+		if err := db.Raw("OPTIMIZE TABLE " + strings.Join(tables, ", ")).Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if strings.EqualFold(row.MsgType, "error") {
+				return fmt.Errorf("%s: %s", row.Table, row.MsgText)
+			}
+		}
+		return nil
+	},
+}
+
+// mysqlAdminRow is one result row of CHECK TABLE or OPTIMIZE TABLE.
+type mysqlAdminRow struct {
+	Table   string `gorm:"column:Table"`
+	Op      string `gorm:"column:Op"`
+	MsgType string `gorm:"column:Msg_type"`
+	MsgText string `gorm:"column:Msg_text"`
+}
+
+// postgresIntegrity reports indexes left invalid (e.g. by an interrupted build) and,
+// when the amcheck extension is installed, verifies every B-tree index with
+// bt_index_check — cross-checking against the heap unless quick. Without amcheck a
+// full check reads every table instead, which surfaces unreadable heap pages.
+var postgresIntegrity = integrityChecker{
+	name: func(quick bool) string {
+		if quick {
+			return "pg_index validity, bt_index_check if amcheck is installed"
+		}
+		return "pg_index validity, bt_index_check with heapallindexed if amcheck is installed, else table scans"
+	},
+	check: func(db *gorm.DB, tables []string, quick bool) ([]string, error) {
+		var indexes []struct {
+			Name  string
+			Table string
+			Valid bool
+			Btree bool
+		}
+		err := db.Raw(`SELECT ic.relname AS name, tc.relname AS "table", i.indisvalid AS valid, am.amname = 'btree' AS btree
+			FROM pg_index i
+			JOIN pg_class ic ON ic.oid = i.indexrelid
+			JOIN pg_class tc ON tc.oid = i.indrelid
+			JOIN pg_am am ON am.oid = ic.relam
+			WHERE tc.relname IN ? AND pg_table_is_visible(tc.oid)
+			ORDER BY tc.relname, ic.relname`, tables).Scan(&indexes).Error
+		if err != nil {
+			return nil, err
+		}
+
+		var hasAmcheck bool
+		if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'amcheck')").Scan(&hasAmcheck).Error; err != nil {
+			return nil, err
+		}
+
+		var problems []string
+		for _, idx := range indexes {
+			if !idx.Valid {
+				problems = append(problems, fmt.Sprintf("index %s on %s is invalid", idx.Name, idx.Table))
+				continue
+			}
+			if hasAmcheck && idx.Btree {
+				if err := db.Exec("SELECT bt_index_check(?::regclass, ?)", idx.Name, !quick).Error; err != nil {
+					if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+						return nil, err
+					}
+					problems = append(problems, fmt.Sprintf("index %s on %s: %v", idx.Name, idx.Table, err))
+				}
+			}
+		}
+		if !hasAmcheck && !quick {
+			for _, table := range tables {
+				if err := db.Exec("SELECT count(*) FROM " + table).Error; err != nil {
+					if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+						return nil, err
+					}
+					problems = append(problems, fmt.Sprintf("table %s: %v", table, err))
+				}
+			}
+		}
+		return problems, nil
+	},
+	reindex: func(db *gorm.DB, tables []string) error {
+		for _, table := range tables {
+			if err := db.Exec("REINDEX TABLE " + table).Error; err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+		}
+		return nil
+	},
+}
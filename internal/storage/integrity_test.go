@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCheckIntegritySQLite(t *testing.T) {
+	repo := newTestRepository(t)
+	for _, quick := range []bool{true, false} {
+		report, err := repo.CheckIntegrity(context.Background(), quick, false)
+		if err != nil {
+			t.Fatalf("CheckIntegrity(quick=%v) error = %v", quick, err)
+		}
+		if !report.OK || len(report.Problems) != 0 || report.Reindexed {
+			t.Errorf("CheckIntegrity(quick=%v) = %+v, want a clean report", quick, report)
+		}
+	}
+}
+
+func TestCheckIntegritySQLiteRepairsIndex(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "integrity.db")
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", dsn)
+	repo, err := NewRepository(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := repo.BatchCreateLogs([]Log{
+		{ServiceName: "cart", Severity: "INFO", Body: "a", Timestamp: now},
+		{ServiceName: "auth", Severity: "ERROR", Body: "b", Timestamp: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Point an index's definition at another column, so its entries no longer match
+	// the rows — the same shape of damage a torn write leaves behind.
+	var sql string
+	if err := repo.db.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = 'logs' AND sql LIKE '%service_name%' LIMIT 1").Scan(&sql).Error; err != nil || sql == "" {
+		t.Fatalf("no service_name index on logs (%v)", err)
+	}
+	name, on, _ := strings.Cut(sql, " ON ")
+	damaged := name + " ON " + strings.ReplaceAll(on, "service_name", "severity")
+	err = repo.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("PRAGMA writable_schema = ON").Error; err != nil {
+			return err
+		}
+		return conn.Exec("UPDATE sqlite_master SET sql = ? WHERE sql = ?", damaged, sql).Error
+	})
+	if err != nil {
+		t.Skipf("cannot rewrite sqlite_master here: %v", err)
+	}
+	repo.Close()
+
+	// Reopen so every connection loads the altered schema.
+	repo, err = NewRepository(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	report, err := repo.CheckIntegrity(context.Background(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || len(report.Problems) == 0 {
+		t.Fatalf("CheckIntegrity() = %+v, want problems for the damaged index", report)
+	}
+
+	report, err = repo.CheckIntegrity(context.Background(), false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Reindexed || !report.OK || len(report.Problems) == 0 || len(report.ProblemsAfterRepair) != 0 {
+		t.Errorf("CheckIntegrity(repair) = %+v, want problems fixed by the rebuild", report)
+	}
+}
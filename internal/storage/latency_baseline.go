@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OperationKey identifies the spans of one operation of one service.
+type OperationKey struct {
+	ServiceName   string `json:"service_name"`
+	OperationName string `json:"operation_name"`
+}
+
+// OperationBaseline is the historical latency distribution of one operation, kept
+// as a histogram over baselineBoundsUs so any span can be placed in it.
+type OperationBaseline struct {
+	Count int64   `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+
+	counts []int64 // spans per bucket; bucket i ends at baselineBoundsUs[i], the last is open
+}
+
+// baselineBoundsUs are the upper edges of the baseline duration buckets: 100µs, then
+// a quarter wider each up to about two minutes, so percentiles read off the histogram
+// are within a few percent. Longer spans fall in a final open bucket.
+var baselineBoundsUs = func() []int64 {
+	var bounds []int64
+	for us := 100.0; us < 150e6; us *= 1.25 {
+		bounds = append(bounds, int64(us))
+	}
+	return bounds
+}()
+
+// baselineBucketExpr computes a span's bucket in SQL, so the database returns one row
+// per operation and bucket rather than every duration.
+var baselineBucketExpr = func() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i, ub := range baselineBoundsUs {
+		fmt.Fprintf(&b, " WHEN duration < %d THEN %d", ub, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(baselineBoundsUs))
+	return b.String()
+}()
+
+// baselineBucketBounds returns the edges of bucket i in microseconds; hi is 0 for the
+// open last bucket.
+func baselineBucketBounds(i int) (lo, hi int64) {
+	if i > 0 {
+		lo = baselineBoundsUs[i-1]
+	}
+	if i < len(baselineBoundsUs) {
+		hi = baselineBoundsUs[i]
+	}
+	return lo, hi
+}
+
+// newOperationBaseline builds a baseline from its bucket counts.
+func newOperationBaseline(counts []int64) *OperationBaseline {
+	b := &OperationBaseline{counts: counts}
+	for _, n := range counts {
+		b.Count += n
+	}
+	b.P50Ms = roundRate(float64(b.percentileUs(50)) / 1000)
+	b.P95Ms = roundRate(float64(b.percentileUs(95)) / 1000)
+	return b
+}
+
+// percentileUs estimates the duration at percentile p (0-100), interpolating within
+// the bucket holding that rank. In the open last bucket it is the bucket's start.
+func (b *OperationBaseline) percentileUs(p float64) int64 {
+	if b.Count == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(b.Count)
+	var seen int64
+	for i, n := range b.counts {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lo, hi := baselineBucketBounds(i)
+		if hi == 0 {
+			return lo
+		}
+		return lo + int64((rank-float64(seen))/float64(n)*float64(hi-lo))
+	}
+	lo, _ := baselineBucketBounds(len(b.counts) - 1)
+	return lo
+}
+
+// PercentileOf returns the position (0-100) of a duration in microseconds within the
+// baseline: the share of baseline spans that were faster, interpolated within its
+// bucket.
+func (b *OperationBaseline) PercentileOf(durationUs int64) float64 {
+	if b.Count == 0 {
+		return 0
+	}
+	var below float64
+	for i, n := range b.counts {
+		lo, hi := baselineBucketBounds(i)
+		if hi != 0 && durationUs >= hi {
+			below += float64(n)
+			continue
+		}
+		if hi != 0 && durationUs > lo {
+			below += float64(n) * float64(durationUs-lo) / float64(hi-lo)
+		}
+		break
+	}
+	return roundRate(below / float64(b.Count) * 100)
+}
+
+// GetOperationBaselines returns the latency baselines of ops over spans started in
+// [start, end], in one grouped query. Operations without spans in the window are
+// returned with a zero Count.
+func (r *Repository) GetOperationBaselines(ops []OperationKey, start, end time.Time) (map[OperationKey]*OperationBaseline, error) {
+	out := make(map[OperationKey]*OperationBaseline, len(ops))
+	if len(ops) == 0 {
+		return out, nil
+	}
+	services, operations := make([]string, 0, len(ops)), make([]string, 0, len(ops))
+	wanted := make(map[OperationKey]bool, len(ops))
+	for _, op := range ops {
+		if !wanted[op] {
+			wanted[op] = true
+			services = append(services, op.ServiceName)
+			operations = append(operations, op.OperationName)
+		}
+	}
+
+	var rows []struct {
+		ServiceName   string
+		OperationName string
+		Bucket        int
+		Count         int64
+	}
+	if err := r.db.Model(&Span{}).
+		Select("service_name, operation_name, "+baselineBucketExpr+" AS bucket, COUNT(*) AS count").
+		Where("start_time BETWEEN ? AND ?", start, end).
+		Where("service_name IN ? AND operation_name IN ?", services, operations).
+		Group("service_name, operation_name, " + baselineBucketExpr).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get operation baselines: %w", err)
+	}
+
+	// The IN lists also match other pairings of the services and operations asked for.
+	counts := make(map[OperationKey][]int64, len(wanted))
+	for _, row := range rows {
+		key := OperationKey{ServiceName: row.ServiceName, OperationName: row.OperationName}
+		if !wanted[key] || row.Bucket < 0 || row.Bucket > len(baselineBoundsUs) {
+			continue
+		}
+		if counts[key] == nil {
+			counts[key] = make([]int64, len(baselineBoundsUs)+1)
+		}
+		counts[key][row.Bucket] += row.Count
+	}
+	for key := range wanted {
+		if c := counts[key]; c != nil {
+			out[key] = newOperationBaseline(c)
+		} else {
+			out[key] = &OperationBaseline{}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGetOperationBaselines(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now().UTC()
+
+	// GET /cart on cart: 1..100 ms. POST /pay on payment: 50 spans of 200ms.
+	var spans []Span
+	for i := 1; i <= 100; i++ {
+		spans = append(spans, Span{TraceID: "t1", SpanID: fmt.Sprintf("c%d", i), ServiceName: "cart",
+			OperationName: "GET /cart", Duration: int64(i) * 1000, StartTime: now.Add(-time.Hour)})
+	}
+	for i := 0; i < 50; i++ {
+		spans = append(spans, Span{TraceID: "t2", SpanID: fmt.Sprintf("p%d", i), ServiceName: "payment",
+			OperationName: "POST /pay", Duration: 200_000, StartTime: now.Add(-time.Hour)})
+	}
+	// Outside the window, and another pairing of the same names.
+	spans = append(spans,
+		Span{TraceID: "t3", SpanID: "old", ServiceName: "cart", OperationName: "GET /cart", Duration: 9_000_000, StartTime: now.Add(-10 * 24 * time.Hour)},
+		Span{TraceID: "t3", SpanID: "x", ServiceName: "cart", OperationName: "POST /pay", Duration: 1000, StartTime: now.Add(-time.Hour)},
+	)
+	if err := repo.db.Create(&spans).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cart := OperationKey{ServiceName: "cart", OperationName: "GET /cart"}
+	pay := OperationKey{ServiceName: "payment", OperationName: "POST /pay"}
+	unknown := OperationKey{ServiceName: "cart", OperationName: "DELETE /cart"}
+	got, err := repo.GetOperationBaselines([]OperationKey{cart, pay, unknown, cart}, now.Add(-7*24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d baselines, want 3: %v", len(got), got)
+	}
+
+	c := got[cart]
+	if c.Count != 100 {
+		t.Errorf("cart count = %d, want 100", c.Count)
+	}
+	// Histogram estimates are within a bucket width (25%) of the exact values.
+	if math.Abs(c.P50Ms-50) > 50*0.25 || math.Abs(c.P95Ms-95) > 95*0.25 {
+		t.Errorf("cart p50/p95 = %v/%v ms, want about 50/95", c.P50Ms, c.P95Ms)
+	}
+	if p := c.PercentileOf(10_000); math.Abs(p-10) > 3 {
+		t.Errorf("PercentileOf(10ms) = %v, want about 10", p)
+	}
+	if p := c.PercentileOf(1_000_000); p != 100 {
+		t.Errorf("PercentileOf(1s) = %v, want 100", p)
+	}
+	if p := c.PercentileOf(0); p != 0 {
+		t.Errorf("PercentileOf(0) = %v, want 0", p)
+	}
+
+	p := got[pay]
+	if p.Count != 50 || math.Abs(p.P95Ms-200) > 200*0.25 {
+		t.Errorf("payment = %+v, want 50 spans around 200ms", p)
+	}
+	if u := got[unknown]; u == nil || u.Count != 0 || u.PercentileOf(1000) != 0 {
+		t.Errorf("unknown operation = %+v, want an empty baseline", u)
+	}
+}
+
+func TestBaselineBucketsCoverDurations(t *testing.T) {
+	// Every bound is above the previous one, and the open last bucket starts past two minutes.
+	for i := 1; i < len(baselineBoundsUs); i++ {
+		if baselineBoundsUs[i] <= baselineBoundsUs[i-1] {
+			t.Fatalf("bound %d = %d, not above %d", i, baselineBoundsUs[i], baselineBoundsUs[i-1])
+		}
+	}
+	if last := baselineBoundsUs[len(baselineBoundsUs)-1]; last < 120_000_000 {
+		t.Errorf("last bound = %dµs, want at least 2 minutes", last)
+	}
+	// A span in the open bucket is reported at the bucket's start.
+	b := newOperationBaseline(append(make([]int64, len(baselineBoundsUs)), 4))
+	if want := float64(baselineBoundsUs[len(baselineBoundsUs)-1]) / 1000; b.P95Ms != want {
+		t.Errorf("p95 in open bucket = %v, want %v", b.P95Ms, want)
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// StatusClassUnknown is the class of spans without a valid HTTP status code.
+const StatusClassUnknown = "unknown"
+
+// rootParentSpanIDs are the parent span IDs ingest stores for a root span.
+var rootParentSpanIDs = []string{"", "0000000000000000"}
+
+// LatencyByStatus is root-span latency per time bucket, split by HTTP status class.
+type LatencyByStatus struct {
+	StepSeconds int64                 `json:"step_seconds"` // nominal, as in LatencyHeatmap
+	Buckets     []LatencyStatusBucket `json:"buckets"`
+}
+
+// LatencyStatusBucket covers [Start, End). Classes holds only the classes seen in it.
+type LatencyStatusBucket struct {
+	Start   time.Time               `json:"start"`
+	End     time.Time               `json:"end"`
+	Classes map[string]LatencyStats `json:"classes"` // "2xx", "4xx", "5xx", ... or "unknown"
+}
+
+// LatencyStats summarizes the durations of one status class in one bucket.
+type LatencyStats struct {
+	Count int64   `json:"count"`
+	AvgMs float64 `json:"avg_ms"`
+	P95Ms float64 `json:"p95_ms"` // nearest rank
+}
+
+// HTTPStatusClass returns the class of an HTTP status code, e.g. "5xx" for 503, or
+// StatusClassUnknown for nil and codes outside 100-599.
+func HTTPStatusClass(code *int) string {
+	if code == nil || *code < 100 || *code > 599 {
+		return StatusClassUnknown
+	}
+	return fmt.Sprintf("%dxx", *code/100)
+}
+
+// GetLatencyByStatus buckets the root spans started in [start, end] by time and HTTP
+// status class. Time buckets are sized and aligned as in GetLatencyHistogram.
+func (r *Repository) GetLatencyByStatus(start, end time.Time, serviceNames []string, loc *time.Location) (*LatencyByStatus, error) {
+	step := heatmapStep(end.Sub(start))
+	bounds := bucketBounds(start, end, step, loc)
+	durations := make([]map[string][]int64, len(bounds)-1) // microseconds, by bucket and class
+
+	query := r.db.Model(&Span{}).
+		Select("start_time, duration, http_status_code").
+		Where("start_time BETWEEN ? AND ?", start, end).
+		Where("parent_span_id IN ?", rootParentSpanIDs)
+	if len(serviceNames) > 0 {
+		query = query.Where("service_name IN ?", serviceNames)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latency by status: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row struct {
+			StartTime      time.Time
+			Duration       int64
+			HTTPStatusCode *int
+		}
+		if err := r.db.ScanRows(rows, &row); err != nil {
+			return nil, fmt.Errorf("failed to scan latency by status row: %w", err)
+		}
+		i := bucketIndex(bounds, row.StartTime)
+		if i < 0 {
+			continue
+		}
+		if durations[i] == nil {
+			durations[i] = make(map[string][]int64)
+		}
+		class := HTTPStatusClass(row.HTTPStatusCode)
+		durations[i][class] = append(durations[i][class], row.Duration)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read latency by status rows: %w", err)
+	}
+
+	res := &LatencyByStatus{StepSeconds: int64(step / time.Second), Buckets: make([]LatencyStatusBucket, len(durations))}
+	for i, byClass := range durations {
+		b := LatencyStatusBucket{Start: bounds[i], End: bounds[i+1], Classes: make(map[string]LatencyStats, len(byClass))}
+		for class, us := range byClass {
+			b.Classes[class] = latencyStats(us)
+		}
+		res.Buckets[i] = b
+	}
+	return res, nil
+}
+
+// latencyStats summarizes durations in microseconds; it sorts us.
+func latencyStats(us []int64) LatencyStats {
+	n := len(us)
+	if n == 0 {
+		return LatencyStats{}
+	}
+	slices.Sort(us)
+	var sum int64
+	for _, d := range us {
+		sum += d
+	}
+	idx := int(math.Ceil(0.95*float64(n))) - 1
+	return LatencyStats{
+		Count: int64(n),
+		AvgMs: math.Round(float64(sum)/float64(n)/10) / 100,
+		P95Ms: math.Round(float64(us[max(idx, 0)])/10) / 100,
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHTTPStatusClass(t *testing.T) {
+	code := func(c int) *int { return &c }
+	for _, c := range []struct {
+		code *int
+		want string
+	}{
+		{nil, StatusClassUnknown},
+		{code(200), "2xx"},
+		{code(204), "2xx"},
+		{code(302), "3xx"},
+		{code(404), "4xx"},
+		{code(599), "5xx"},
+		{code(99), StatusClassUnknown},
+		{code(600), StatusClassUnknown},
+	} {
+		if got := HTTPStatusClass(c.code); got != c.want {
+			t.Errorf("HTTPStatusClass(%v) = %q, want %q", c.code, got, c.want)
+		}
+	}
+}
+
+func TestGetLatencyByStatus(t *testing.T) {
+	repo := newTestRepository(t)
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour) // one-minute buckets
+
+	var spans []Span
+	n := 0
+	add := func(at time.Time, service, parent string, durationUs int64, status *int) {
+		n++
+		spans = append(spans, Span{
+			TraceID: fmt.Sprintf("t%d", n), SpanID: fmt.Sprintf("s%d", n), ParentSpanID: parent, ServiceName: service,
+			OperationName: "GET /", StartTime: at, EndTime: at.Add(time.Duration(durationUs) * time.Microsecond),
+			Duration: durationUs, HTTPStatusCode: status,
+		})
+	}
+	code := func(c int) *int { return &c }
+
+	// First minute: twenty successes of 1..20ms, one slow 503, two without a usable code.
+	for i := 1; i <= 20; i++ {
+		add(start.Add(time.Duration(i)*time.Second), "web", "", int64(i)*1000, code(200))
+	}
+	add(start.Add(30*time.Second), "web", "", 900_000, code(503))
+	add(start.Add(40*time.Second), "web", "", 5_000, nil)
+	add(start.Add(41*time.Second), "web", "", 7_000, code(42))
+	// Not counted: a child span, another service, a span before the window.
+	add(start.Add(time.Second), "web", "00f067aa0ba902b7", 1_000, code(404))
+	add(start.Add(time.Second), "worker", "", 1_000, code(200))
+	add(start.Add(-time.Second), "web", "", 1_000, code(200))
+	// Sixth minute: a root span stored with an all-zero parent ID.
+	add(start.Add(5*time.Minute+time.Second), "web", "0000000000000000", 7_500, code(404))
+
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.GetLatencyByStatus(start, end, []string{"web"}, nil)
+	if err != nil {
+		t.Fatalf("GetLatencyByStatus() error = %v", err)
+	}
+	if res.StepSeconds != 60 {
+		t.Errorf("StepSeconds = %d, want 60", res.StepSeconds)
+	}
+	if len(res.Buckets) < 60 || !res.Buckets[0].Start.Equal(start) || !res.Buckets[0].End.Equal(start.Add(time.Minute)) {
+		t.Fatalf("buckets = %d starting %v, want one per minute from %v", len(res.Buckets), res.Buckets[0].Start, start)
+	}
+
+	want := map[string]LatencyStats{
+		"2xx":              {Count: 20, AvgMs: 10.5, P95Ms: 19}, // nearest rank: the 19th of 20
+		"5xx":              {Count: 1, AvgMs: 900, P95Ms: 900},
+		StatusClassUnknown: {Count: 2, AvgMs: 6, P95Ms: 7},
+	}
+	if got := res.Buckets[0].Classes; !reflect.DeepEqual(got, want) {
+		t.Errorf("first minute = %+v, want %+v", got, want)
+	}
+	if got := res.Buckets[5].Classes; !reflect.DeepEqual(got, map[string]LatencyStats{"4xx": {Count: 1, AvgMs: 7.5, P95Ms: 7.5}}) {
+		t.Errorf("sixth minute = %+v, want one 4xx of 7.5ms", got)
+	}
+	if got := res.Buckets[1].Classes; len(got) != 0 {
+		t.Errorf("empty minute = %+v, want no classes", got)
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+)
+
+// ListServiceLiveness returns the saved liveness of every service.
+func (r *Repository) ListServiceLiveness() ([]ServiceLiveness, error) {
+	var rows []ServiceLiveness
+	if err := r.db.Order("tenant_id, service_name").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list service liveness: %w", err)
+	}
+	return rows, nil
+}
+
+// SaveServiceLiveness creates or replaces the liveness rows of the given services.
+func (r *Repository) SaveServiceLiveness(rows []ServiceLiveness) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tenant_id"}, {Name: "service_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"last_span_at", "last_log_at", "last_metric_at", "lag_ms", "clock_skew_ms", "stale_since",
+		}),
+	}).Create(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to save service liveness: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrAttributeNotIndexed is returned when a log query filters on an attribute key
+// outside the indexed allowlist.
+var ErrAttributeNotIndexed = errors.New("attribute is not indexed")
+
+// maxLogAttributeValue bounds indexed values; longer values are truncated, so
+// filters only match them by their prefix.
+const maxLogAttributeValue = 255
+
+// AttributeFilter matches logs whose attribute Key equals Value.
+type AttributeFilter struct {
+	Key   string
+	Value string
+}
+
+// SetLogAttributeKeys sets the allowlist of log attribute keys that BatchCreateLogs
+// copies into log_attributes and that GetLogsV2 can filter on.
+func (r *Repository) SetLogAttributeKeys(keys []string) {
+	r.logAttrKeys = make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			r.logAttrKeys[k] = true
+		}
+	}
+}
+
+// createLogAttributes indexes the allowlisted attributes of freshly inserted logs.
+// Failures are logged rather than returned: the logs are already stored, and a retry
+// of the whole batch would duplicate them.
+func (r *Repository) createLogAttributes(logs []Log) {
+	if len(r.logAttrKeys) == 0 {
+		return
+	}
+	var rows []LogAttribute
+	for _, l := range logs {
+		for k, v := range indexedAttributes(string(l.AttributesJSON), r.logAttrKeys) {
+			rows = append(rows, LogAttribute{LogID: l.ID, Key: k, Value: v})
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	if err := r.ignoreDuplicates().CreateInBatches(rows, 500).Error; err != nil {
+		slog.Warn("Failed to index log attributes", "rows", len(rows), "error", err)
+	}
+}
+
+// whereLogAttributes restricts q to logs matching every filter, each resolved through
+// the (attr_key, attr_value) index.
+func (r *Repository) whereLogAttributes(q *gorm.DB, filters []AttributeFilter) (*gorm.DB, error) {
+	for _, f := range filters {
+		if !r.logAttrKeys[f.Key] {
+			return nil, fmt.Errorf("%w: %q", ErrAttributeNotIndexed, f.Key)
+		}
+		sub := r.db.Model(&LogAttribute{}).Select("log_id").
+			Where("attr_key = ? AND attr_value = ?", f.Key, truncateAttr(f.Value))
+		q = q.Where("id IN (?)", sub)
+	}
+	return q, nil
+}
+
+// deleteLogAttributes removes the index rows of the logs selected by logs, which
+// must be a query on the logs table. Call it before deleting those logs.
+func deleteLogAttributes(db *gorm.DB, logs *gorm.DB) error {
+	return db.Where("log_id IN (?)", logs.Select("id")).Delete(&LogAttribute{}).Error
+}
+
+// indexedAttributes extracts the allowlisted keys from a stored attributes JSON
+// object; a legacy KeyValue list is converted first.
+func indexedAttributes(raw string, keys map[string]bool) map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+	raw = strings.TrimSpace(cleanAttributes(raw))
+	if raw == "" {
+		return nil
+	}
+	out := make(map[string]string)
+	var obj map[string]json.RawMessage
+	if json.Unmarshal([]byte(raw), &obj) != nil {
+		return nil
+	}
+	for k, v := range obj {
+		if keys[k] {
+			if s, ok := scalarString(v); ok {
+				out[k] = truncateAttr(s)
+			}
+		}
+	}
+	return out
+}
+
+// scalarString renders a JSON string, number or boolean the way a user would type it
+// in a filter; other JSON values are not indexed.
+func scalarString(v json.RawMessage) (string, bool) {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return "", false
+	}
+	switch v[0] {
+	case '"':
+		var s string
+		if json.Unmarshal(v, &s) != nil {
+			return "", false
+		}
+		return s, true
+	case '{', '[', 'n':
+		return "", false
+	default:
+		return string(v), true
+	}
+}
+
+func truncateAttr(s string) string {
+	if len(s) > maxLogAttributeValue {
+		return s[:maxLogAttributeValue]
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Bounds of a log context query.
+const (
+	DefaultLogContextWindow = time.Minute
+	MaxLogContextWindow     = 10 * time.Minute
+	DefaultLogContextLimit  = 200
+	MaxLogContextLimit      = 1000
+)
+
+// LogContextQuery selects the logs around a target point in time.
+type LogContextQuery struct {
+	Target      time.Time
+	Window      time.Duration // how far either side of Target to look; defaults to DefaultLogContextWindow
+	ServiceName string        // optional
+	Limit       int           // rows per page; defaults to DefaultLogContextLimit
+
+	// Older continues towards older logs from the given row, Newer towards newer
+	// ones; both stay within the window around Target. With neither set the page
+	// is balanced around Target. Older takes precedence when both are set.
+	Older *LogCursor
+	Newer *LogCursor
+}
+
+// LogContextPage is a page of logs around a target, in chronological order.
+type LogContextPage struct {
+	Logs []Log `json:"logs"`
+	// Before and After count the rows on the page older than the target and at or
+	// after it.
+	Before int `json:"before"`
+	After  int `json:"after"`
+	// OlderCursor and NewerCursor continue the page in either direction; they are
+	// empty when the window holds nothing further that way.
+	OlderCursor string `json:"older_cursor,omitempty"`
+	NewerCursor string `json:"newer_cursor,omitempty"`
+}
+
+// GetLogContext returns up to q.Limit logs within q.Window of q.Target. The logs
+// before and after the target are read by two bounded queries; on the first page
+// the limit is split evenly between them, and a side with fewer rows than its half
+// leaves the rest to the other.
+func (r *Repository) GetLogContext(ctx context.Context, q LogContextQuery) (*LogContextPage, error) {
+	if q.Window <= 0 {
+		q.Window = DefaultLogContextWindow
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultLogContextLimit
+	}
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+
+	base := func() *gorm.DB {
+		b := db.Model(&Log{}).Where("timestamp BETWEEN ? AND ?", q.Target.Add(-q.Window), q.Target.Add(q.Window))
+		if q.ServiceName != "" {
+			b = b.Where("service_name = ?", q.ServiceName)
+		}
+		return b
+	}
+	// Each side reads one row past what it may return, to tell whether more remain.
+	older := func(limit int, c *LogCursor) ([]Log, error) {
+		b := base()
+		if c != nil {
+			// Expanded form of (timestamp, id) < (?, ?); SQL Server has no row-value comparison.
+			b = b.Where("timestamp < ? OR (timestamp = ? AND id < ?)", c.Timestamp, c.Timestamp, c.ID)
+		} else {
+			b = b.Where("timestamp < ?", q.Target)
+		}
+		var logs []Log
+		if err := b.Order("timestamp desc, id desc").Limit(limit + 1).Find(&logs).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch log context: %w", err)
+		}
+		return logs, nil
+	}
+	newer := func(limit int, c *LogCursor) ([]Log, error) {
+		b := base()
+		if c != nil {
+			b = b.Where("timestamp > ? OR (timestamp = ? AND id > ?)", c.Timestamp, c.Timestamp, c.ID)
+		} else {
+			b = b.Where("timestamp >= ?", q.Target)
+		}
+		var logs []Log
+		if err := b.Order("timestamp asc, id asc").Limit(limit + 1).Find(&logs).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch log context: %w", err)
+		}
+		return logs, nil
+	}
+
+	var before, after []Log
+	var err error
+	olderLeft, newerLeft := false, false
+	switch {
+	case q.Older != nil:
+		if before, err = older(q.Limit, q.Older); err != nil {
+			return nil, err
+		}
+		olderLeft = len(before) > q.Limit
+		before = before[:min(len(before), q.Limit)]
+		newerLeft = len(before) > 0
+	case q.Newer != nil:
+		if after, err = newer(q.Limit, q.Newer); err != nil {
+			return nil, err
+		}
+		newerLeft = len(after) > q.Limit
+		after = after[:min(len(after), q.Limit)]
+		olderLeft = len(after) > 0
+	default:
+		if before, err = older(q.Limit, nil); err != nil {
+			return nil, err
+		}
+		if after, err = newer(q.Limit, nil); err != nil {
+			return nil, err
+		}
+		nBefore, nAfter := q.Limit/2, q.Limit-q.Limit/2
+		if len(after) < nAfter {
+			nBefore += nAfter - len(after)
+		}
+		if len(before) < nBefore {
+			nAfter += nBefore - len(before)
+		}
+		nBefore, nAfter = min(nBefore, len(before)), min(nAfter, len(after))
+		olderLeft, newerLeft = len(before) > nBefore, len(after) > nAfter
+		before, after = before[:nBefore], after[:nAfter]
+	}
+
+	page := &LogContextPage{Logs: make([]Log, 0, len(before)+len(after))}
+	for i := len(before) - 1; i >= 0; i-- {
+		page.Logs = append(page.Logs, before[i])
+	}
+	page.Logs = append(page.Logs, after...)
+	for _, l := range page.Logs {
+		if l.Timestamp.Before(q.Target) {
+			page.Before++
+		} else {
+			page.After++
+		}
+	}
+	if n := len(page.Logs); n > 0 {
+		if olderLeft {
+			page.OlderCursor = LogCursorAfter(page.Logs[0]).String()
+		}
+		if newerLeft {
+			page.NewerCursor = LogCursorAfter(page.Logs[n-1]).String()
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetLogContext(t *testing.T) {
+	repo := newTestRepository(t)
+	target := time.Now().UTC().Truncate(time.Second)
+
+	// 10 logs before the target and 3 at or after it, one second apart, plus noise
+	// from another service and from outside the window.
+	var logs []Log
+	for i := -10; i < 3; i++ {
+		logs = append(logs, Log{ServiceName: "cart", Severity: "INFO", Body: "tick", Timestamp: target.Add(time.Duration(i) * time.Second)})
+	}
+	logs = append(logs,
+		Log{ServiceName: "auth", Severity: "INFO", Body: "other", Timestamp: target},
+		Log{ServiceName: "cart", Severity: "INFO", Body: "stale", Timestamp: target.Add(-2 * time.Minute)},
+	)
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	q := LogContextQuery{Target: target, ServiceName: "cart"}
+
+	// Both sides can fill their half.
+	q.Limit = 6
+	page, err := repo.GetLogContext(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLogContext(t, page, target, -3, 3)
+	if page.Before != 3 || page.After != 3 || page.OlderCursor == "" || page.NewerCursor != "" {
+		t.Errorf("limit 6: before %d, after %d, older %q, newer %q", page.Before, page.After, page.OlderCursor, page.NewerCursor)
+	}
+
+	// The newer side runs short, so the older side takes the rest of the limit.
+	q.Limit = 8
+	page, err = repo.GetLogContext(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLogContext(t, page, target, -5, 3)
+
+	// Load older from the page's cursor until the window runs out.
+	q.Older, err = ParseLogCursor(page.OlderCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Limit = 5
+	page, err = repo.GetLogContext(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLogContext(t, page, target, -10, -5)
+	if page.OlderCursor != "" || page.NewerCursor == "" {
+		t.Errorf("last older page: older %q, newer %q; want only a newer cursor", page.OlderCursor, page.NewerCursor)
+	}
+
+	// Load newer from the first row after the target.
+	q.Older = nil
+	first, err := repo.GetLogContext(ctx, LogContextQuery{Target: target, ServiceName: "cart", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLogContext(t, first, target, 0, 1)
+	if q.Newer, err = ParseLogCursor(first.NewerCursor); err != nil {
+		t.Fatalf("first newer cursor %q: %v", first.NewerCursor, err)
+	}
+	q.Limit = 1
+	page, err = repo.GetLogContext(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLogContext(t, page, target, 1, 2)
+	if page.NewerCursor == "" {
+		t.Error("one more newer log remains, want a newer cursor")
+	}
+
+	// A narrower window leaves out the older logs.
+	page, err = repo.GetLogContext(ctx, LogContextQuery{Target: target, Window: 2 * time.Second, ServiceName: "cart", Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLogContext(t, page, target, -2, 3)
+}
+
+// assertLogContext checks that page holds the logs at target+from seconds up to, but
+// excluding, target+to seconds, in order.
+func assertLogContext(t *testing.T, page *LogContextPage, target time.Time, from, to int) {
+	t.Helper()
+	if len(page.Logs) != to-from {
+		t.Fatalf("got %d logs, want %d (seconds %d..%d)", len(page.Logs), to-from, from, to)
+	}
+	for i, l := range page.Logs {
+		if want := target.Add(time.Duration(from+i) * time.Second); !l.Timestamp.Equal(want) {
+			t.Errorf("log %d at %s, want %s", i, l.Timestamp, want)
+		}
+	}
+}
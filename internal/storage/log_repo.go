@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -12,22 +17,181 @@ import (
 // LogFilter defines criteria for searching logs.
 type LogFilter struct {
 	ServiceName string
-	Severity    string
+	Severity    string // any recognised spelling, e.g. "warning", matches the canonical value
 	Search      string
 	TraceID     string
+	ScopeName   string
+	Attributes  []AttributeFilter // all must match; keys must be indexed
+	HasTrace    *bool             // true: the trace is stored; false: trace_id set but not stored
+	Synthetic   *bool             // true: only logs synthesized from spans; false: only logs the apps exported
 	StartTime   time.Time
 	EndTime     time.Time
 	Limit       int
 	Offset      int
+	// Cursor continues a keyset traversal after the given row; Offset is ignored
+	// when it is set.
+	Cursor *LogCursor
+	// Fields are the JSON fields to load, e.g. timestamp,severity,body; empty loads
+	// all. id and timestamp are always loaded so the page can be continued.
+	Fields []string
+	// Summary cuts bodies to a LogPreviewRunes preview and, unless Fields says
+	// otherwise, leaves attributes_json and ai_insight unread.
+	Summary bool
 }
 
-// BatchCreateLogs inserts multiple logs in batches.
+// LogCursor identifies a position in the (timestamp desc, id desc) log order.
+type LogCursor struct {
+	Timestamp time.Time
+	ID        uint
+}
+
+// LogCursorAfter returns the cursor that continues after l.
+func LogCursorAfter(l Log) *LogCursor {
+	return &LogCursor{Timestamp: l.Timestamp, ID: l.ID}
+}
+
+// String encodes the cursor as an opaque URL-safe token.
+func (c LogCursor) String() string {
+	raw := strconv.FormatInt(c.Timestamp.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseLogCursor decodes a token produced by LogCursor.String.
+func ParseLogCursor(s string) (*LogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	ts, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.New("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, errors.New("malformed cursor timestamp")
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("malformed cursor id")
+	}
+	return &LogCursor{Timestamp: time.Unix(0, nanos).UTC(), ID: uint(n)}, nil
+}
+
+// BatchCreateLogs inserts multiple logs in batches. Logs already stored with the
+// same content, e.g. from a retried export, are skipped; their ID is set to that of
+// the stored row.
 func (r *Repository) BatchCreateLogs(logs []Log) error {
 	if len(logs) == 0 {
 		return nil
 	}
-	if err := r.db.CreateInBatches(logs, 500).Error; err != nil {
-		return fmt.Errorf("failed to batch create logs: %w", err)
+	byKey := make(map[string]*Log, len(logs))
+	unique := make([]Log, 0, len(logs))
+	for i := range logs {
+		if r.tenant != "" {
+			logs[i].TenantID = r.tenant
+		}
+		logs[i].DedupKey = logDedupKey(&logs[i])
+		if _, dup := byKey[logs[i].DedupKey]; !dup {
+			byKey[logs[i].DedupKey] = nil
+			unique = append(unique, logs[i])
+		}
+	}
+	res := r.createInBatches(r.ignoreDuplicates(), BatchTableLogs, unique, len(unique))
+	if res.Error != nil {
+		return fmt.Errorf("failed to batch create logs: %w", res.Error)
+	}
+	skipped := int64(len(logs)) - res.RowsAffected
+
+	if res.RowsAffected < int64(len(unique)) {
+		// The IDs handed back for a partially skipped insert can't be matched to rows,
+		// so read them back by key.
+		if err := r.resolveLogIDs(unique); err != nil {
+			return err
+		}
+	}
+	for i := range unique {
+		byKey[unique[i].DedupKey] = &unique[i]
+	}
+	for i := range logs {
+		logs[i].ID = byKey[logs[i].DedupKey].ID
+	}
+	r.createLogAttributes(logs)
+	r.recordDuplicates("logs", skipped)
+	return nil
+}
+
+// LogSpanKey identifies the span a log was written under.
+type LogSpanKey struct {
+	TraceID string
+	SpanID  string
+}
+
+// SpansWithErrorLogs returns which of spans already have an ERROR log of tenantID's
+// that the app exported itself, as opposed to one synthesized from a span.
+func (r *Repository) SpansWithErrorLogs(ctx context.Context, tenantID string, spans []LogSpanKey) (map[LogSpanKey]bool, error) {
+	found := make(map[LogSpanKey]bool)
+	if len(spans) == 0 {
+		return found, nil
+	}
+	traceIDs := make([]string, 0, len(spans))
+	for _, s := range spans {
+		traceIDs = append(traceIDs, s.TraceID)
+	}
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+	var rows []LogSpanKey
+	if err := db.Model(&Log{}).
+		Select("DISTINCT trace_id, span_id").
+		Where("tenant_id = ? AND trace_id IN ? AND severity = ? AND synthetic = ?", tenantID, traceIDs, SeverityError, false).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up error logs: %w", err)
+	}
+	wanted := make(map[LogSpanKey]bool, len(spans))
+	for _, s := range spans {
+		wanted[s] = true
+	}
+	for _, row := range rows {
+		if wanted[row] {
+			found[row] = true
+		}
+	}
+	return found, nil
+}
+
+// AddLogRepeats adds to the repeat counts of stored logs, keyed by log ID.
+func (r *Repository) AddLogRepeats(repeats map[uint]int64) error {
+	if len(repeats) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for id, n := range repeats {
+			if err := tx.Model(&Log{}).Where("id = ?", id).
+				UpdateColumn("repeat_count", gorm.Expr("repeat_count + ?", n)).Error; err != nil {
+				return fmt.Errorf("failed to update log repeat count: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// resolveLogIDs sets each log's ID to that of the stored row with its dedup key.
+func (r *Repository) resolveLogIDs(logs []Log) error {
+	ids := make(map[string]uint, len(logs))
+	for start := 0; start < len(logs); start += 500 {
+		keys := make([]string, 0, 500)
+		for _, l := range logs[start:min(start+500, len(logs))] {
+			keys = append(keys, l.DedupKey)
+		}
+		var rows []Log
+		if err := r.primary().Select("id", "dedup_key").Where("dedup_key IN ?", keys).Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to resolve log IDs: %w", err)
+		}
+		for _, row := range rows {
+			ids[row.DedupKey] = row.ID
+		}
+	}
+	for i := range logs {
+		logs[i].ID = ids[logs[i].DedupKey]
 	}
 	return nil
 }
@@ -52,21 +216,78 @@ func (r *Repository) GetRecentLogs(limit int) ([]Log, error) {
 
 // GetLogsV2 performs advanced filtering and search on logs.
 // COUNT and SELECT are run in parallel via errgroup for reduced latency.
+// With filter.Cursor set the page is read by keyset on (timestamp, id) instead of
+// OFFSET, so deep pages cost the same as the first and logs ingested mid-traversal
+// never shift later pages. total always counts the whole filter.
 func (r *Repository) GetLogsV2(filter LogFilter) ([]Log, int64, error) {
+	return r.GetLogsV2Context(context.Background(), filter)
+}
+
+// GetLogsV2Context is GetLogsV2 with its queries bound to ctx.
+func (r *Repository) GetLogsV2Context(ctx context.Context, filter LogFilter) ([]Log, int64, error) {
 	var logs []Log
 	var total int64
 
-	base := r.db.Model(&Log{})
+	columns, err := projectionColumns(logFieldColumns, filter.Fields, "id", "timestamp")
+	if err != nil {
+		return nil, 0, err
+	}
+	if columns == nil && filter.Summary {
+		columns = logSummaryColumns
+	}
+
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+	base, err := r.filteredLogs(db, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Run COUNT and SELECT in parallel using independent sessions.
+	var g errgroup.Group
+	g.Go(func() error {
+		return base.Session(&gorm.Session{}).Count(&total).Error
+	})
+	g.Go(func() error {
+		page := logsPage(base.Session(&gorm.Session{}), filter)
+		if columns != nil {
+			page = page.Select(columns)
+		}
+		return page.Find(&logs).Error
+	})
+	if err := g.Wait(); err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch logs: %w", err)
+	}
+
+	if filter.Summary {
+		for i := range logs {
+			body, cut := PreviewText(string(logs[i].Body), LogPreviewRunes)
+			logs[i].Body, logs[i].BodyPreview = CompressedText(body), cut
+		}
+	}
+	return logs, total, nil
+}
+
+// filteredLogs applies every LogFilter criterion except paging to a query on db.
+func (r *Repository) filteredLogs(db *gorm.DB, filter LogFilter) (*gorm.DB, error) {
+	base := db.Model(&Log{})
 
 	if filter.ServiceName != "" {
 		base = base.Where("service_name = ?", filter.ServiceName)
 	}
 	if filter.Severity != "" {
-		base = base.Where("severity = ?", filter.Severity)
+		severity := filter.Severity
+		if c, ok := CanonicalSeverity(severity); ok {
+			severity = c
+		}
+		base = base.Where("severity = ?", severity)
 	}
 	if filter.TraceID != "" {
 		base = base.Where("trace_id = ?", filter.TraceID)
 	}
+	if filter.ScopeName != "" {
+		base = base.Where("scope_name = ?", filter.ScopeName)
+	}
 	if !filter.StartTime.IsZero() {
 		base = base.Where("timestamp >= ?", filter.StartTime)
 	}
@@ -77,38 +298,70 @@ func (r *Repository) GetLogsV2(filter LogFilter) ([]Log, int64, error) {
 		search := "%" + filter.Search + "%"
 		base = base.Where("body LIKE ? OR trace_id LIKE ?", search, search)
 	}
+	if filter.HasTrace != nil {
+		stored := r.db.Model(&Trace{}).Select("trace_id")
+		if *filter.HasTrace {
+			base = base.Where("trace_id IN (?)", stored)
+		} else {
+			base = base.Where("trace_id <> '' AND trace_id NOT IN (?)", stored)
+		}
+	}
+	if filter.Synthetic != nil {
+		base = base.Where("synthetic = ?", *filter.Synthetic)
+	}
+	return r.whereLogAttributes(base, filter.Attributes)
+}
 
-	// Run COUNT and SELECT in parallel using independent sessions.
-	var g errgroup.Group
-	g.Go(func() error {
-		return base.Session(&gorm.Session{}).Count(&total).Error
-	})
-	g.Go(func() error {
-		return base.Session(&gorm.Session{}).
-			Order("timestamp desc").
-			Limit(filter.Limit).
-			Offset(filter.Offset).
-			Find(&logs).Error
-	})
-	if err := g.Wait(); err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch logs: %w", err)
+// AttachTraceSummaries sets Trace on every log that has a trace ID, fetching all the
+// referenced traces in a single query.
+func (r *Repository) AttachTraceSummaries(logs []Log) error {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, l := range logs {
+		if l.TraceID != "" && !seen[l.TraceID] {
+			seen[l.TraceID] = true
+			ids = append(ids, l.TraceID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
 	}
 
-	return logs, total, nil
+	var traces []Trace
+	if err := r.db.Select("trace_id", "duration", "status", "service_name").
+		Where("trace_id IN ?", ids).Find(&traces).Error; err != nil {
+		return fmt.Errorf("failed to fetch trace summaries: %w", err)
+	}
+	byID := make(map[string]*LogTrace, len(traces))
+	for _, t := range traces {
+		byID[t.TraceID] = &LogTrace{
+			Exists:      true,
+			DurationMs:  float64(t.Duration) / 1000.0, // µs → ms
+			Status:      t.Status,
+			ServiceName: t.ServiceName,
+		}
+	}
+	for i := range logs {
+		if logs[i].TraceID == "" {
+			continue
+		}
+		if s, ok := byID[logs[i].TraceID]; ok {
+			logs[i].Trace = s
+		} else {
+			logs[i].Trace = &LogTrace{}
+		}
+	}
+	return nil
 }
 
-// GetLogContext returns logs surrounding a specific timestamp (+/- 1 minute).
-func (r *Repository) GetLogContext(targetTime time.Time) ([]Log, error) {
-	start := targetTime.Add(-1 * time.Minute)
-	end := targetTime.Add(1 * time.Minute)
-
-	var logs []Log
-	if err := r.db.Where("timestamp BETWEEN ? AND ?", start, end).
-		Order("timestamp asc").
-		Find(&logs).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch log context: %w", err)
+// logsPage orders q newest first and selects the page filter asks for.
+func logsPage(q *gorm.DB, filter LogFilter) *gorm.DB {
+	q = q.Order("timestamp desc, id desc").Limit(filter.Limit)
+	if c := filter.Cursor; c != nil {
+		// Expanded form of (timestamp, id) < (?, ?); SQL Server has no row-value comparison.
+		return q.Where("timestamp < ? OR (timestamp = ? AND id < ?)", c.Timestamp, c.Timestamp, c.ID)
 	}
-	return logs, nil
+	return q.Offset(filter.Offset)
 }
 
 // UpdateLogInsight updates the AI insight for a specific log.
@@ -121,6 +374,9 @@ func (r *Repository) UpdateLogInsight(logID uint, insight string) error {
 
 // PurgeLogs deletes logs older than the given timestamp.
 func (r *Repository) PurgeLogs(olderThan time.Time) (int64, error) {
+	if err := deleteLogAttributes(r.db, r.db.Model(&Log{}).Where("timestamp < ?", olderThan)); err != nil {
+		return 0, fmt.Errorf("failed to purge log attributes: %w", err)
+	}
 	result := r.db.Where("timestamp < ?", olderThan).Delete(&Log{})
 	if result.Error != nil {
 		return 0, fmt.Errorf("failed to purge logs: %w", result.Error)
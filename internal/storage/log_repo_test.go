@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// pageAllLogs walks filter by cursor and returns the IDs in order. before runs
+// ahead of each page after the first, so tests can ingest mid-traversal.
+func pageAllLogs(t *testing.T, repo *Repository, filter LogFilter, before func(page int)) []uint {
+	t.Helper()
+	var ids []uint
+	for page := 0; ; page++ {
+		if page > 0 && before != nil {
+			before(page)
+		}
+		logs, _, err := repo.GetLogsV2(filter)
+		if err != nil {
+			t.Fatalf("GetLogsV2(page %d) error = %v", page, err)
+		}
+		for _, l := range logs {
+			ids = append(ids, l.ID)
+		}
+		if len(logs) < filter.Limit {
+			return ids
+		}
+		// Round-trip through the wire format, as the API does.
+		c, err := ParseLogCursor(LogCursorAfter(logs[len(logs)-1]).String())
+		if err != nil {
+			t.Fatalf("ParseLogCursor() error = %v", err)
+		}
+		filter.Cursor = c
+	}
+}
+
+func TestGetLogsV2Cursor(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// seed stores 30 logs over 10 distinct timestamps, so pages split inside
+	// equal-timestamp runs, and returns the IDs matching keep, newest first.
+	seed := func(t *testing.T, repo *Repository, keep func(Log) bool) []uint {
+		var logs []Log
+		for i := 0; i < 30; i++ {
+			sev := "INFO"
+			if i%3 == 0 {
+				sev = "ERROR"
+			}
+			flow := "cart"
+			if i%2 == 0 {
+				flow = "checkout"
+			}
+			logs = append(logs, Log{
+				TraceID:     fmt.Sprintf("trace-%02d-%s", i, flow),
+				Severity:    sev,
+				ServiceName: "svc",
+				Body:        CompressedText(fmt.Sprintf("log %d", i)),
+				Timestamp:   base.Add(time.Duration(i/3) * time.Second),
+			})
+		}
+		if err := repo.BatchCreateLogs(logs); err != nil {
+			t.Fatal(err)
+		}
+		var want []uint
+		for i := len(logs) - 1; i >= 0; i-- {
+			if keep(logs[i]) {
+				want = append(want, logs[i].ID)
+			}
+		}
+		return want
+	}
+
+	tests := []struct {
+		name   string
+		filter LogFilter
+		keep   func(Log) bool
+	}{
+		{"severity", LogFilter{Severity: "INFO", Limit: 4}, func(l Log) bool { return l.Severity == "INFO" }},
+		{"search", LogFilter{Search: "checkout", Limit: 4}, func(l Log) bool { return strings.HasSuffix(l.TraceID, "checkout") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			want := seed(t, repo, tt.keep)
+
+			// Ingest newer matching logs while paging; none may leak into the traversal.
+			n := 0
+			got := pageAllLogs(t, repo, tt.filter, func(page int) {
+				n++
+				late := Log{TraceID: fmt.Sprintf("late-%s-%d-checkout", tt.name, n), Severity: "INFO", ServiceName: "svc", Timestamp: time.Now()}
+				if err := repo.BatchCreateLogs([]Log{late}); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if n == 0 {
+				t.Fatal("traversal fit on one page; test does not exercise the cursor")
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("cursor traversal = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseLogCursor(t *testing.T) {
+	c := LogCursor{Timestamp: time.Unix(1700000000, 123456789), ID: 42}
+	got, err := ParseLogCursor(c.String())
+	if err != nil {
+		t.Fatalf("ParseLogCursor() error = %v", err)
+	}
+	if !got.Timestamp.Equal(c.Timestamp) || got.ID != c.ID {
+		t.Errorf("round trip = %+v, want %+v", got, c)
+	}
+	for _, bad := range []string{"!!", "nocolon", "x:1", "1:y"} {
+		token := bad
+		if bad != "!!" {
+			token = base64.RawURLEncoding.EncodeToString([]byte(bad))
+		}
+		if _, err := ParseLogCursor(token); err == nil {
+			t.Errorf("ParseLogCursor(%q) accepted malformed input", bad)
+		}
+	}
+}
+
+func TestGetLogsV2AttributeFilter(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.SetLogAttributeKeys([]string{"user.id", "http.status_code"})
+	base := time.Now().Add(-time.Hour)
+
+	// Attributes as ingest stores them (json.Marshal of OTLP KeyValues) and as a plain object.
+	otlpAttrs := func(user string, status int) CompressedText {
+		return CompressedText(fmt.Sprintf(`[{"key":"user.id","value":{"Value":{"StringValue":%q}}},{"key":"http.status_code","value":{"Value":{"IntValue":%d}}},{"key":"body.size","value":{"Value":{"IntValue":5}}}]`, user, status))
+	}
+	logs := []Log{
+		{Severity: "ERROR", ServiceName: "api", AttributesJSON: otlpAttrs("u1", 500), Timestamp: base},
+		{Severity: "INFO", ServiceName: "api", AttributesJSON: otlpAttrs("u1", 200), Timestamp: base.Add(time.Second)},
+		{Severity: "ERROR", ServiceName: "api", AttributesJSON: otlpAttrs("u2", 500), Timestamp: base.Add(2 * time.Second)},
+		{Severity: "ERROR", ServiceName: "api", AttributesJSON: `{"user.id":"u1","http.status_code":503}`, Timestamp: base.Add(3 * time.Second)},
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := LogFilter{
+		Severity:   "ERROR",
+		StartTime:  base.Add(-time.Minute),
+		EndTime:    base.Add(time.Minute),
+		Attributes: []AttributeFilter{{Key: "user.id", Value: "u1"}},
+		Limit:      10,
+	}
+	got, total, err := repo.GetLogsV2(filter)
+	if err != nil {
+		t.Fatalf("GetLogsV2() error = %v", err)
+	}
+	if total != 2 || len(got) != 2 || got[0].ID != logs[3].ID || got[1].ID != logs[0].ID {
+		t.Errorf("user.id=u1 errors = %d rows (total %d), want logs 4 and 1", len(got), total)
+	}
+
+	filter.Attributes = append(filter.Attributes, AttributeFilter{Key: "http.status_code", Value: "500"})
+	if got, _, _ := repo.GetLogsV2(filter); len(got) != 1 || got[0].ID != logs[0].ID {
+		t.Errorf("user.id=u1 status=500 = %v, want log 1 only", got)
+	}
+
+	if _, _, err := repo.GetLogsV2(LogFilter{Attributes: []AttributeFilter{{Key: "body.size", Value: "5"}}, Limit: 10}); !errors.Is(err, ErrAttributeNotIndexed) {
+		t.Errorf("filter on unindexed key: err = %v, want ErrAttributeNotIndexed", err)
+	}
+
+	// The attribute lookup must go through its index, and logs must never be scanned
+	// without one, even combined with severity and time filters.
+	q, err := repo.filteredLogs(repo.db, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := logsPage(q.Session(&gorm.Session{DryRun: true}), filter).Find(&[]Log{}).Statement
+	rows, err := repo.db.Raw("EXPLAIN QUERY PLAN "+stmt.SQL.String(), stmt.Vars...).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+	joined := strings.Join(plan, "\n")
+	if !strings.Contains(joined, "idx_log_attributes_lookup") {
+		t.Errorf("attribute subquery does not use idx_log_attributes_lookup:\n%s", joined)
+	}
+	for _, step := range plan {
+		if strings.HasPrefix(step, "SCAN logs") && !strings.Contains(step, "INDEX") {
+			t.Errorf("full scan of logs in plan:\n%s", joined)
+		}
+	}
+}
+
+func TestLogTraceLinks(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	if err := repo.BatchCreateTraces([]Trace{
+		{TraceID: "live", ServiceName: "checkout", Duration: 1500, Status: "STATUS_CODE_ERROR", Timestamp: now},
+		{TraceID: "purged", ServiceName: "checkout", Timestamp: now.Add(-48 * time.Hour)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.PurgeTraces(now.Add(-24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	logs := []Log{
+		{TraceID: "live", Severity: "ERROR", Timestamp: now},
+		{TraceID: "live", Severity: "INFO", Timestamp: now.Add(time.Second)},
+		{TraceID: "purged", Severity: "ERROR", Timestamp: now.Add(2 * time.Second)},
+		{TraceID: "never-ingested", Severity: "ERROR", Timestamp: now.Add(3 * time.Second)},
+		{Severity: "ERROR", Timestamp: now.Add(4 * time.Second)},
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(hasTrace bool) string {
+		t.Helper()
+		got, _, err := repo.GetLogsV2(LogFilter{Severity: "ERROR", HasTrace: &hasTrace, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, l := range got {
+			out = append(out, l.TraceID)
+		}
+		return fmt.Sprint(out)
+	}
+	if got := ids(false); got != "[never-ingested purged]" {
+		t.Errorf("orphaned error logs = %s, want [never-ingested purged]", got)
+	}
+	if got := ids(true); got != "[live]" {
+		t.Errorf("linked error logs = %s, want [live]", got)
+	}
+
+	page, _, err := repo.GetLogsV2(LogFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := 0
+	repo.db.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) { queries++ })
+	if err := repo.AttachTraceSummaries(page); err != nil {
+		t.Fatal(err)
+	}
+	if queries != 1 {
+		t.Errorf("AttachTraceSummaries ran %d queries for %d logs, want 1", queries, len(page))
+	}
+	for _, l := range page {
+		switch {
+		case l.TraceID == "":
+			if l.Trace != nil {
+				t.Errorf("log without trace_id got summary %+v", l.Trace)
+			}
+		case l.TraceID == "live":
+			if l.Trace == nil || !l.Trace.Exists || l.Trace.DurationMs != 1.5 || l.Trace.Status != "STATUS_CODE_ERROR" || l.Trace.ServiceName != "checkout" {
+				t.Errorf("live trace summary = %+v", l.Trace)
+			}
+		default:
+			if l.Trace == nil || l.Trace.Exists {
+				t.Errorf("trace %q summary = %+v, want exists=false", l.TraceID, l.Trace)
+			}
+		}
+	}
+}
+
+func TestSyntheticLogs(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	if err := repo.BatchCreateLogs([]Log{
+		{TraceID: "t1", SpanID: "s1", Severity: SeverityError, Body: "payment declined", Timestamp: now},
+		{TraceID: "t1", SpanID: "s1", Severity: SeverityError, Body: "Span 'charge' failed", Synthetic: true, Timestamp: now.Add(time.Second)},
+		{TraceID: "t1", SpanID: "s2", Severity: SeverityError, Body: "Span 'refund' failed", Synthetic: true, Timestamp: now.Add(2 * time.Second)},
+		{TraceID: "t1", SpanID: "s2", Severity: SeverityInfo, Body: "retrying", Timestamp: now.Add(3 * time.Second)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := func(synthetic *bool) string {
+		t.Helper()
+		got, _, err := repo.GetLogsV2(LogFilter{Synthetic: synthetic, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, l := range got {
+			out = append(out, string(l.Body))
+		}
+		return strings.Join(out, "|")
+	}
+	yes, no := true, false
+	if got, want := bodies(nil), "retrying|Span 'refund' failed|Span 'charge' failed|payment declined"; got != want {
+		t.Errorf("all logs = %s, want %s", got, want)
+	}
+	if got, want := bodies(&yes), "Span 'refund' failed|Span 'charge' failed"; got != want {
+		t.Errorf("synthetic logs = %s, want %s", got, want)
+	}
+	if got, want := bodies(&no), "retrying|payment declined"; got != want {
+		t.Errorf("app logs = %s, want %s", got, want)
+	}
+
+	stats, err := repo.GetDashboardStats(now.Add(-time.Minute), now.Add(time.Minute), nil)
+	if err != nil {
+		t.Fatalf("GetDashboardStats() error = %v", err)
+	}
+	if stats.TotalLogs != 4 || stats.ErrorLogs != 3 || stats.SyntheticLogs != 2 || stats.SyntheticErrorLogs != 2 {
+		t.Errorf("stats = %+v, want 4 logs, 3 errors, 2 of each synthetic", stats)
+	}
+	DashboardView{ExcludeSynthetic: true}.Apply(stats)
+	if stats.TotalLogs != 2 || stats.ErrorLogs != 1 {
+		t.Errorf("without synthetic logs: %d logs, %d errors; want 2 and 1", stats.TotalLogs, stats.ErrorLogs)
+	}
+
+	// Only the app's own ERROR log counts as the failure being logged.
+	logged, err := repo.SpansWithErrorLogs(context.Background(), "default", []LogSpanKey{{"t1", "s1"}, {"t1", "s2"}, {"t2", "s1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[LogSpanKey]bool{{"t1", "s1"}: true}; !reflect.DeepEqual(logged, want) {
+		t.Errorf("SpansWithErrorLogs() = %v, want %v", logged, want)
+	}
+}
+
+func TestGetLogsV2Summary(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	long := strings.Repeat("ü", LogPreviewRunes+50)
+	logs := []Log{
+		{Severity: "ERROR", Body: CompressedText(long), AttributesJSON: `{"k":"v"}`, AIInsight: "retry storm", Timestamp: now},
+		{Severity: "INFO", Body: "short", Timestamp: now.Add(time.Second)},
+		{Severity: "WARN", Timestamp: now.Add(2 * time.Second)},
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	// A row written before bodies were compressed.
+	if err := repo.db.Exec("UPDATE logs SET body = ? WHERE id = ?", []byte(long), logs[2].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := repo.GetLogsV2(LogFilter{Summary: true, Limit: 10})
+	if err != nil || len(got) != 3 {
+		t.Fatalf("GetLogsV2() = %d logs, %v", len(got), err)
+	}
+	want := strings.Repeat("ü", LogPreviewRunes) + "…"
+	for _, l := range []Log{got[0], got[2]} {
+		if string(l.Body) != want || !l.BodyPreview {
+			t.Errorf("log %d: body %q (preview %v), want %d runes and an ellipsis", l.ID, l.Body, l.BodyPreview, LogPreviewRunes)
+		}
+	}
+	if string(got[1].Body) != "short" || got[1].BodyPreview {
+		t.Errorf("short body = %q (preview %v), want it whole", got[1].Body, got[1].BodyPreview)
+	}
+	if got[2].AttributesJSON != "" || got[2].AIInsight != "" || got[2].Severity != "ERROR" {
+		t.Errorf("summary row = %+v, want attributes and insight left unread", got[2])
+	}
+
+	// Explicit fields still win, and the full view is unchanged.
+	got, _, _ = repo.GetLogsV2(LogFilter{Summary: true, Fields: []string{"attributes_json"}, Limit: 1, Offset: 2})
+	if got[0].AttributesJSON != `{"k":"v"}` {
+		t.Errorf("fields=attributes_json in summary mode: %q", got[0].AttributesJSON)
+	}
+	got, _, _ = repo.GetLogsV2(LogFilter{Limit: 1, Offset: 2})
+	if string(got[0].Body) != long || got[0].AIInsight != "retry storm" {
+		t.Errorf("full view = %+v, want the whole row", got[0])
+	}
+}
+
+// BenchmarkGetLogsV2 reads 10k rows with compressed 2 KB bodies and attributes in
+// full and in summary mode; compare B/op and allocs/op.
+func BenchmarkGetLogsV2(b *testing.B) {
+	b.Setenv("DB_DRIVER", "sqlite")
+	b.Setenv("DB_DSN", filepath.Join(b.TempDir(), "bench.db"))
+	repo, err := NewRepository(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer repo.Close()
+
+	const rows = 10000
+	now := time.Now()
+	body := strings.Repeat("connection reset by peer while reading response; ", 40)
+	attrs := `{"http.url":"` + strings.Repeat("/api/v1/orders", 100) + `"}`
+	logs := make([]Log, rows)
+	for i := range logs {
+		logs[i] = Log{ServiceName: "bench", Severity: "ERROR", Body: CompressedText(fmt.Sprint(i, body)),
+			AttributesJSON: CompressedText(attrs), AIInsight: CompressedText(body), Timestamp: now.Add(time.Duration(i) * time.Millisecond)}
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, summary := range []bool{false, true} {
+		name := "full"
+		if summary {
+			name = "summary"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := repo.GetLogsV2(LogFilter{Summary: summary, Limit: rows}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
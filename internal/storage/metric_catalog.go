@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm/clause"
+)
+
+// GetMetricCatalog returns the catalog entry of every metric, by name, restricted to
+// the metrics serviceName reports when it is set.
+func (r *Repository) GetMetricCatalog(serviceName string) ([]MetricCatalog, error) {
+	var rows []MetricCatalog
+	if err := r.db.Order("name ASC, tenant_id ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get metric catalog: %w", err)
+	}
+	out := rows[:0]
+	for _, row := range rows {
+		row.decodeServices()
+		if serviceName == "" || slices.Contains(row.Services, serviceName) {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// SaveMetricCatalog merges entries into the catalog. Services add to those already
+// recorded; cardinality and last seen are replaced; type, unit and description are
+// only replaced when the entry has them.
+func (r *Repository) SaveMetricCatalog(entries []MetricCatalog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	var existing []MetricCatalog
+	if err := r.primary().Where("name IN ?", names).Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to read metric catalog: %w", err)
+	}
+	known := make(map[[2]string]*MetricCatalog, len(existing))
+	for i := range existing {
+		existing[i].decodeServices()
+		known[[2]string{existing[i].TenantID, existing[i].Name}] = &existing[i]
+	}
+
+	rows := make([]MetricCatalog, len(entries))
+	for i, e := range entries {
+		if e.TenantID == "" {
+			e.TenantID = "default"
+		}
+		e.Services = slices.Clone(e.Services)
+		if old := known[[2]string{e.TenantID, e.Name}]; old != nil {
+			e.Type = cmp.Or(e.Type, old.Type)
+			e.Unit = cmp.Or(e.Unit, old.Unit)
+			e.Description = cmp.Or(e.Description, old.Description)
+			e.Services = append(e.Services, old.Services...)
+			if old.LastSeen.After(e.LastSeen) {
+				e.LastSeen = old.LastSeen
+			}
+		}
+		e.Services = uniqueSorted(e.Services)
+		data, _ := json.Marshal(e.Services)
+		e.ServicesJSON = string(data)
+		e.LastSeen = e.LastSeen.UTC()
+		rows[i] = e
+	}
+
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "unit", "description", "services_json", "cardinality", "last_seen"}),
+	}).Create(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to save metric catalog: %w", err)
+	}
+	return nil
+}
+
+func (m *MetricCatalog) decodeServices() {
+	m.Services = []string{}
+	if m.ServicesJSON != "" {
+		json.Unmarshal([]byte(m.ServicesJSON), &m.Services)
+	}
+}
+
+func uniqueSorted(in []string) []string {
+	out := make([]string, 0, len(in))
+	slices.Sort(in)
+	for i, s := range in {
+		if s != "" && (i == 0 || s != in[i-1]) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"math"
@@ -24,6 +26,59 @@ type LatencyPoint struct {
 	Duration  int64     `json:"duration"` // Microseconds
 }
 
+// LatencyHeatmap is a 2D histogram of trace durations: one row per time bucket,
+// one column per logarithmic duration bucket. Bound arrays hold bucket edges, so
+// TimeBounds has len(Counts)+1 entries and DurationBoundsMs has len(Counts[i])+1.
+// Durations beyond the last bound are counted in the last column.
+type LatencyHeatmap struct {
+	StepSeconds      int64       `json:"step_seconds"` // nominal: day buckets across a DST change are 23 or 25 hours
+	TimeBounds       []time.Time `json:"time_bounds"`
+	DurationBoundsMs []float64   `json:"duration_bounds_ms"`
+	Counts           [][]int64   `json:"counts"` // [time bucket][duration bucket]
+	Total            int64       `json:"total"`
+}
+
+// heatmapDurationBoundsMs are the duration bucket edges: [0,1) ms, then powers of two up to ~16s.
+var heatmapDurationBoundsMs = func() []float64 {
+	bounds := []float64{0}
+	for ms := 1.0; ms <= 16384; ms *= 2 {
+		bounds = append(bounds, ms)
+	}
+	return bounds
+}()
+
+// heatmapSteps are the candidate time bucket widths; the smallest one yielding at most
+// heatmapMaxTimeBuckets columns is used.
+var heatmapSteps = []time.Duration{
+	10 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute, 15 * time.Minute,
+	30 * time.Minute, time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+const heatmapMaxTimeBuckets = 60
+
+// heatmapStep picks the time bucket width for a window.
+func heatmapStep(window time.Duration) time.Duration {
+	for _, step := range heatmapSteps {
+		if window/step <= heatmapMaxTimeBuckets {
+			return step
+		}
+	}
+	return heatmapSteps[len(heatmapSteps)-1]
+}
+
+// heatmapDurationBucket maps a duration in microseconds to its duration bucket index.
+func heatmapDurationBucket(durationUs int64) int {
+	ms := float64(durationUs) / 1000.0
+	if ms < 1 {
+		return 0
+	}
+	idx := int(math.Floor(math.Log2(ms))) + 1
+	if last := len(heatmapDurationBoundsMs) - 2; idx > last {
+		idx = last
+	}
+	return idx
+}
+
 // ServiceError represents error counts per service.
 type ServiceError struct {
 	ServiceName string  `json:"service_name"`
@@ -36,9 +91,14 @@ type ServiceError struct {
 type DashboardStats struct {
 	TotalTraces        int64          `json:"total_traces"`
 	TotalLogs          int64          `json:"total_logs"`
+	ErrorLogs          int64          `json:"error_logs"`
+	SyntheticLogs      int64          `json:"synthetic_logs"`       // of total_logs, synthesized from spans
+	SyntheticErrorLogs int64          `json:"synthetic_error_logs"` // of error_logs, synthesized from spans
 	TotalErrors        int64          `json:"total_errors"`
+	RollupErrors       int64          `json:"rollup_errors"` // traces with any failed span
 	AvgLatencyMs       float64        `json:"avg_latency_ms"`
 	ErrorRate          float64        `json:"error_rate"`
+	RollupErrorRate    float64        `json:"rollup_error_rate"`
 	ActiveServices     int64          `json:"active_services"`
 	P99Latency         int64          `json:"p99_latency"`
 	TopFailingServices []ServiceError `json:"top_failing_services"`
@@ -49,7 +109,16 @@ func (r *Repository) BatchCreateMetrics(buckets []MetricBucket) error {
 	if len(buckets) == 0 {
 		return nil
 	}
-	if err := r.db.CreateInBatches(buckets, 500).Error; err != nil {
+	// Buckets replayed from the DLQ carry their exemplars decoded, as JSON round-trips
+	// them; encode them again for the column.
+	for i := range buckets {
+		if buckets[i].ExemplarsJSON == "" && len(buckets[i].Exemplars) > 0 {
+			if data, err := json.Marshal(buckets[i].Exemplars); err == nil {
+				buckets[i].ExemplarsJSON = CompressedText(data)
+			}
+		}
+	}
+	if err := r.createInBatches(r.db, BatchTableMetrics, buckets, len(buckets)).Error; err != nil {
 		return fmt.Errorf("failed to batch create metrics: %w", err)
 	}
 	return nil
@@ -68,9 +137,42 @@ func (r *Repository) GetMetricBuckets(start, end time.Time, serviceName string,
 	if err := query.Order("time_bucket ASC").Find(&buckets).Error; err != nil {
 		return nil, fmt.Errorf("failed to get metric buckets: %w", err)
 	}
+	for i := range buckets {
+		if buckets[i].ExemplarsJSON != "" {
+			// A corrupt column only loses the exemplars, not the bucket.
+			_ = json.Unmarshal([]byte(buckets[i].ExemplarsJSON), &buckets[i].Exemplars)
+		}
+	}
 	return buckets, nil
 }
 
+// DeleteMetricBuckets hard-deletes aggregated metric buckets with a time bucket in
+// [start, end), in batches of purgeBatchSize.
+func (r *Repository) DeleteMetricBuckets(start, end time.Time) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		if err := r.primary().Model(&MetricBucket{}).
+			Where("time_bucket >= ? AND time_bucket < ?", start, end).
+			Limit(purgeBatchSize).Pluck("id", &ids).Error; err != nil {
+			return total, fmt.Errorf("failed to select metric buckets: %w", err)
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		result := r.db.Where("id IN ?", ids).Delete(&MetricBucket{})
+		if result.Error != nil {
+			return total, fmt.Errorf("failed to delete metric buckets: %w", result.Error)
+		}
+		total += result.RowsAffected
+
+		if len(ids) < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
 // GetMetricNames returns a list of distinct metric names, optionally filtered by service.
 func (r *Repository) GetMetricNames(serviceName string) ([]string, error) {
 	var names []string
@@ -86,9 +188,16 @@ func (r *Repository) GetMetricNames(serviceName string) ([]string, error) {
 
 // GetDashboardStats calculates high-level metrics for the dashboard.
 func (r *Repository) GetDashboardStats(start, end time.Time, serviceNames []string) (*DashboardStats, error) {
+	return r.GetDashboardStatsContext(context.Background(), start, end, serviceNames)
+}
+
+// GetDashboardStatsContext is GetDashboardStats with its queries bound to ctx.
+func (r *Repository) GetDashboardStatsContext(ctx context.Context, start, end time.Time, serviceNames []string) (*DashboardStats, error) {
 	var stats DashboardStats
 
-	baseQuery := r.db.Model(&Trace{}).Where("timestamp BETWEEN ? AND ?", start, end)
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+	baseQuery := db.Model(&Trace{}).Where("timestamp BETWEEN ? AND ?", start, end)
 	if len(serviceNames) > 0 {
 		baseQuery = baseQuery.Where("service_name IN ?", serviceNames)
 	}
@@ -99,14 +208,31 @@ func (r *Repository) GetDashboardStats(start, end time.Time, serviceNames []stri
 	}
 
 	// 2. Total Logs
-	logQuery := r.db.Model(&Log{}).Where("timestamp BETWEEN ? AND ?", start, end)
+	logQuery := db.Model(&Log{}).Where("timestamp BETWEEN ? AND ?", start, end)
 	if len(serviceNames) > 0 {
 		logQuery = logQuery.Where("service_name IN ?", serviceNames)
 	}
-	if err := logQuery.Count(&stats.TotalLogs).Error; err != nil {
+	if err := logQuery.Session(&gorm.Session{}).Count(&stats.TotalLogs).Error; err != nil {
 		return nil, fmt.Errorf("failed to count logs: %w", err)
 	}
 
+	// 2b. Error logs, and how many of the logs were synthesized from spans
+	type logCounts struct {
+		ErrorLogs          int64
+		SyntheticLogs      int64
+		SyntheticErrorLogs int64
+	}
+	var lc logCounts
+	if err := logQuery.Session(&gorm.Session{}).
+		Select("COALESCE(SUM(CASE WHEN severity = ? THEN 1 ELSE 0 END), 0) as error_logs, "+
+			"COALESCE(SUM(CASE WHEN synthetic THEN 1 ELSE 0 END), 0) as synthetic_logs, "+
+			"COALESCE(SUM(CASE WHEN synthetic AND severity = ? THEN 1 ELSE 0 END), 0) as synthetic_error_logs",
+			SeverityError, SeverityError).
+		Scan(&lc).Error; err != nil {
+		return nil, fmt.Errorf("failed to count error logs: %w", err)
+	}
+	stats.ErrorLogs, stats.SyntheticLogs, stats.SyntheticErrorLogs = lc.ErrorLogs, lc.SyntheticLogs, lc.SyntheticErrorLogs
+
 	// 3. Total Errors (traces with error status)
 	if err := baseQuery.Session(&gorm.Session{}).
 		Where("status LIKE ?", "%ERROR%").
@@ -114,8 +240,17 @@ func (r *Repository) GetDashboardStats(start, end time.Time, serviceNames []stri
 		return nil, fmt.Errorf("failed to count error traces: %w", err)
 	}
 
+	// 3b. Rollup Errors (traces with any failed span, including soft failures under a
+	// successful root)
+	if err := baseQuery.Session(&gorm.Session{}).
+		Where("has_error = ?", true).
+		Count(&stats.RollupErrors).Error; err != nil {
+		return nil, fmt.Errorf("failed to count rollup error traces: %w", err)
+	}
+
 	if stats.TotalTraces > 0 {
 		stats.ErrorRate = (float64(stats.TotalErrors) / float64(stats.TotalTraces)) * 100
+		stats.RollupErrorRate = (float64(stats.RollupErrors) / float64(stats.TotalTraces)) * 100
 	}
 
 	// 4. Average Latency (microseconds → milliseconds)
@@ -232,7 +367,7 @@ func (r *Repository) GetTrafficMetrics(start, end time.Time, serviceNames []stri
 
 	for ts, b := range buckets {
 		points = append(points, TrafficPoint{
-			Timestamp:  time.Unix(ts, 0),
+			Timestamp:  time.Unix(ts, 0).UTC(),
 			Count:      b.count,
 			ErrorCount: b.errorCount,
 		})
@@ -246,6 +381,7 @@ func (r *Repository) GetTrafficMetrics(start, end time.Time, serviceNames []stri
 }
 
 // GetLatencyHeatmap returns trace duration and timestamps for heatmap rendering.
+// It is capped at 2000 points; prefer GetLatencyHistogram.
 func (r *Repository) GetLatencyHeatmap(start, end time.Time, serviceNames []string) ([]LatencyPoint, error) {
 	var points []LatencyPoint
 	query := r.db.Model(&Trace{}).
@@ -262,6 +398,56 @@ func (r *Repository) GetLatencyHeatmap(start, end time.Time, serviceNames []stri
 	return points, nil
 }
 
+// GetLatencyHistogram buckets every trace in [start, end] into a LatencyHeatmap. Rows are
+// streamed rather than loaded, so there is no cap on the number of traces counted.
+// Time buckets are aligned in loc (nil: UTC); see bucketBounds.
+func (r *Repository) GetLatencyHistogram(start, end time.Time, serviceNames []string, loc *time.Location) (*LatencyHeatmap, error) {
+	step := heatmapStep(end.Sub(start))
+	bounds := bucketBounds(start, end, step, loc)
+	numTime := len(bounds) - 1
+	numDur := len(heatmapDurationBoundsMs) - 1
+
+	hm := &LatencyHeatmap{
+		StepSeconds:      int64(step / time.Second),
+		TimeBounds:       bounds,
+		DurationBoundsMs: heatmapDurationBoundsMs,
+		Counts:           make([][]int64, numTime),
+	}
+	for i := range hm.Counts {
+		hm.Counts[i] = make([]int64, numDur)
+	}
+
+	query := r.db.Model(&Trace{}).
+		Select("timestamp, duration").
+		Where("timestamp BETWEEN ? AND ?", start, end)
+	if len(serviceNames) > 0 {
+		query = query.Where("service_name IN ?", serviceNames)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latency histogram: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p LatencyPoint
+		if err := r.db.ScanRows(rows, &p); err != nil {
+			return nil, fmt.Errorf("failed to scan latency histogram row: %w", err)
+		}
+		t := bucketIndex(bounds, p.Timestamp)
+		if t < 0 {
+			continue
+		}
+		hm.Counts[t][heatmapDurationBucket(p.Duration)]++
+		hm.Total++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read latency histogram rows: %w", err)
+	}
+	return hm, nil
+}
+
 // GetServices returns a list of all distinct service names seen in traces.
 func (r *Repository) GetServices() ([]string, error) {
 	var services []string
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHeatmapDurationBucket(t *testing.T) {
+	cases := []struct {
+		us   int64
+		want int
+	}{
+		{0, 0},
+		{999, 0},
+		{1000, 1},    // [1,2) ms
+		{3000, 2},    // [2,4) ms
+		{100_000, 7}, // [64,128) ms
+		{60_000_000, len(heatmapDurationBoundsMs) - 2},
+	}
+	for _, c := range cases {
+		if got := heatmapDurationBucket(c.us); got != c.want {
+			t.Errorf("heatmapDurationBucket(%d) = %d, want %d", c.us, got, c.want)
+		}
+	}
+}
+
+func TestGetLatencyHistogram(t *testing.T) {
+	repo := newTestRepository(t)
+	end := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-30 * time.Minute)
+
+	// More than the legacy 2000-point cap, spread across the window.
+	var traces []Trace
+	for i := 0; i < 2500; i++ {
+		traces = append(traces, Trace{
+			TraceID:     fmt.Sprintf("t%d", i),
+			ServiceName: "api",
+			Duration:    5000, // 5ms
+			Timestamp:   start.Add(time.Duration(i%1800) * time.Second),
+		})
+	}
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatalf("BatchCreateTraces() error = %v", err)
+	}
+
+	hm, err := repo.GetLatencyHistogram(start, end, nil, nil)
+	if err != nil {
+		t.Fatalf("GetLatencyHistogram() error = %v", err)
+	}
+	if hm.Total != 2500 {
+		t.Errorf("Total = %d, want 2500", hm.Total)
+	}
+	if hm.StepSeconds != 30 {
+		t.Errorf("StepSeconds = %d, want 30", hm.StepSeconds)
+	}
+	if len(hm.TimeBounds) != len(hm.Counts)+1 || len(hm.DurationBoundsMs) != len(hm.Counts[0])+1 {
+		t.Errorf("bounds do not match counts: %d time bounds / %d rows, %d duration bounds / %d cols",
+			len(hm.TimeBounds), len(hm.Counts), len(hm.DurationBoundsMs), len(hm.Counts[0]))
+	}
+	var inFiveMs int64
+	for _, row := range hm.Counts {
+		inFiveMs += row[3] // [4,8) ms
+	}
+	if inFiveMs != 2500 {
+		t.Errorf("count in [4,8) ms bucket = %d, want 2500", inFiveMs)
+	}
+}
+
+func TestGetTrafficByService(t *testing.T) {
+	repo := newTestRepository(t)
+	end := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-10 * time.Minute)
+
+	// checkout: 6 requests, cart: 4, three small services: 1 each.
+	var traces []Trace
+	add := func(service string, n int, at time.Duration, status string) {
+		for i := 0; i < n; i++ {
+			traces = append(traces, Trace{TraceID: fmt.Sprintf("%s-%d-%d", service, at, i), ServiceName: service,
+				Status: status, Timestamp: start.Add(at)})
+		}
+	}
+	add("checkout", 4, time.Minute, "STATUS_CODE_OK")
+	add("checkout", 2, 5*time.Minute, "STATUS_CODE_ERROR")
+	add("cart", 4, 2*time.Minute, "STATUS_CODE_OK")
+	add("auth", 1, time.Minute, "STATUS_CODE_ERROR")
+	add("email", 1, 9*time.Minute, "STATUS_CODE_OK")
+	add("search", 1, 9*time.Minute, "STATUS_CODE_OK")
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetTrafficByService(start, end, nil, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.StepSeconds != 60 || len(got.Series) != 3 || got.OtherServices != 3 {
+		t.Fatalf("got step %ds, %d series, %d other services; want 60s, top 2 + other of 3", got.StepSeconds, len(got.Series), got.OtherServices)
+	}
+	names := []string{got.Series[0].ServiceName, got.Series[1].ServiceName, got.Series[2].ServiceName}
+	if names[0] != "checkout" || names[1] != "cart" || names[2] != TrafficOtherSeries || !got.Series[2].Other {
+		t.Errorf("series = %v, want checkout, cart, other", names)
+	}
+	for _, s := range got.Series {
+		if len(s.Points) != 11 || !s.Points[0].Timestamp.Equal(start) {
+			t.Errorf("%s: %d points from %v, want 11 zero-filled points from the start", s.ServiceName, len(s.Points), s.Points[0].Timestamp)
+		}
+	}
+	checkout, other := got.Series[0], got.Series[2]
+	if checkout.Count != 6 || checkout.ErrorCount != 2 || checkout.Points[1].Count != 4 || checkout.Points[5].ErrorCount != 2 || checkout.Points[2].Count != 0 {
+		t.Errorf("checkout = %+v", checkout)
+	}
+	if other.Count != 3 || other.ErrorCount != 1 || other.Points[1].Count != 1 || other.Points[9].Count != 2 {
+		t.Errorf("other = %+v", other)
+	}
+
+	// Restricted to services that fit: no rollup.
+	got, err = repo.GetTrafficByService(start, end, []string{"cart", "auth"}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Series) != 2 || got.OtherServices != 0 || got.Series[1].ServiceName != "auth" {
+		t.Errorf("filtered = %+v, want cart and auth only", got)
+	}
+
+	// A day is too many minutes: the step widens.
+	if step := trafficStep(24 * time.Hour); step != 5*time.Minute {
+		t.Errorf("trafficStep(24h) = %v, want 5m", step)
+	}
+}
+
+func TestMetricBucketExemplarsRoundTrip(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now().Truncate(time.Minute)
+	buckets := []MetricBucket{
+		{Name: "latency", ServiceName: "checkout", TimeBucket: now, Count: 1, AttributesJSON: "{}",
+			ExemplarsJSON: `[{"trace_id":"abc","span_id":"def","value":900,"timestamp":"2024-01-01T00:00:00Z"}]`},
+		{Name: "latency", ServiceName: "checkout", TimeBucket: now.Add(time.Minute), Count: 1, AttributesJSON: "{}"},
+	}
+	if err := repo.BatchCreateMetrics(buckets); err != nil {
+		t.Fatalf("BatchCreateMetrics() error = %v", err)
+	}
+
+	got, err := repo.GetMetricBuckets(now.Add(-time.Minute), now.Add(2*time.Minute), "checkout", "latency")
+	if err != nil {
+		t.Fatalf("GetMetricBuckets() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(got))
+	}
+	if ex := got[0].Exemplars; len(ex) != 1 || ex[0].TraceID != "abc" || ex[0].SpanID != "def" || ex[0].Value != 900 {
+		t.Errorf("exemplars = %+v", ex)
+	}
+	if len(got[1].Exemplars) != 0 {
+		t.Errorf("bucket without exemplars decoded %+v", got[1].Exemplars)
+	}
+}
+
+func TestMetricBucketExemplarsSurviveDLQReplay(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now().Truncate(time.Minute)
+	exemplars := []Exemplar{{TraceID: "abc", SpanID: "def", Value: 900, Timestamp: now}}
+	data, _ := json.Marshal(exemplars)
+	// As the aggregator spills a batch to the DLQ and the replay decodes it
+	spilled, err := json.Marshal([]MetricBucket{{Name: "latency", ServiceName: "checkout", TimeBucket: now, Count: 1,
+		AttributesJSON: "{}", Exemplars: exemplars, ExemplarsJSON: CompressedText(data)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replayed []MetricBucket
+	if err := json.Unmarshal(spilled, &replayed); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateMetrics(replayed); err != nil {
+		t.Fatalf("BatchCreateMetrics() error = %v", err)
+	}
+
+	got, err := repo.GetMetricBuckets(now.Add(-time.Minute), now.Add(time.Minute), "checkout", "latency")
+	if err != nil || len(got) != 1 {
+		t.Fatalf("GetMetricBuckets() = %+v, %v; want one bucket", got, err)
+	}
+	if ex := got[0].Exemplars; len(ex) != 1 || ex[0].TraceID != "abc" || ex[0].Value != 900 {
+		t.Errorf("exemplars after replay = %+v, want the spilled one", ex)
+	}
+}
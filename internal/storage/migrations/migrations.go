@@ -0,0 +1,191 @@
+// Package migrations applies versioned schema changes in order and records each in
+// the schema_migrations table, so every change runs once per database.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one schema change.
+type Migration struct {
+	Version int // unique, > 0; migrations run in ascending order
+	Name    string
+	Up      func(db *gorm.DB) error
+	// NoTx runs Up outside a transaction, for steps that commit in batches of their
+	// own so a large backfill or index build does not hold one write transaction.
+	NoTx bool
+	// Idempotent steps are run again after failing part-way, instead of leaving the
+	// database dirty.
+	Idempotent bool
+}
+
+// Record is a row of schema_migrations.
+type Record struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	Dirty     bool      `gorm:"not null;default:false" json:"dirty"` // started but not finished
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
+
+// TableName keeps the table name independent of the type name.
+func (Record) TableName() string { return "schema_migrations" }
+
+var (
+	// ErrDirty means a migration that ran outside a transaction failed or was
+	// interrupted; the database must be checked before anything else runs.
+	ErrDirty = errors.New("schema migration did not finish")
+	// ErrTooNew means a newer release has migrated the database.
+	ErrTooNew = errors.New("database schema is newer than this binary")
+)
+
+// Runner applies a fixed list of migrations to a database.
+type Runner struct {
+	db         *gorm.DB
+	migrations []Migration
+	txDDL      bool
+}
+
+// New returns a runner for migrations. txDDL says whether the driver can roll back
+// schema changes (MySQL cannot); without it every migration is tracked as NoTx.
+func New(db *gorm.DB, txDDL bool, migrations ...Migration) (*Runner, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up == nil {
+			return nil, fmt.Errorf("migration %d (%s): version must be > 0 and Up set", m.Version, m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migration version %d is used twice", m.Version)
+		}
+	}
+	return &Runner{db: db, migrations: sorted, txDDL: txDDL}, nil
+}
+
+// Latest returns the highest version the runner knows, 0 if none.
+func (r *Runner) Latest() int {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// Status returns the recorded migrations, including any this binary does not know,
+// and the known ones not applied yet. A dirty migration counts as applied.
+func (r *Runner) Status() (applied []Record, pending []Migration, err error) {
+	if r.db.Migrator().HasTable(&Record{}) {
+		if err := r.db.Order("version").Find(&applied).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+	}
+	done := make(map[int]bool, len(applied))
+	for _, rec := range applied {
+		done[rec.Version] = true
+	}
+	for _, m := range r.migrations {
+		if !done[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return applied, pending, nil
+}
+
+// Up applies the pending migrations in order and returns how many ran. It refuses to
+// run anything when the database has versions newer than this binary, or a dirty
+// migration that is not idempotent.
+func (r *Runner) Up() (int, error) {
+	if err := r.createTable(); err != nil {
+		return 0, err
+	}
+	applied, _, err := r.Status()
+	if err != nil {
+		return 0, err
+	}
+	records := make(map[int]Record, len(applied))
+	for _, rec := range applied {
+		records[rec.Version] = rec
+		if rec.Version > r.Latest() {
+			return 0, fmt.Errorf("%w: it is at version %d (%s), this binary knows up to %d",
+				ErrTooNew, rec.Version, rec.Name, r.Latest())
+		}
+	}
+	for _, m := range r.migrations {
+		if rec, ok := records[m.Version]; ok && rec.Dirty && !m.Idempotent {
+			return 0, fmt.Errorf("%w: migration %d (%s) started at %s; check the database, then delete its schema_migrations row to run it again",
+				ErrDirty, m.Version, m.Name, rec.AppliedAt.Format(time.RFC3339))
+		}
+	}
+
+	n := 0
+	for _, m := range r.migrations {
+		if rec, ok := records[m.Version]; ok && !rec.Dirty {
+			continue
+		}
+		if err := r.apply(m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Baseline records every migration as applied without running it, for a database
+// whose schema was just created at the latest version.
+func (r *Runner) Baseline() error {
+	if err := r.createTable(); err != nil {
+		return err
+	}
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, m := range r.migrations {
+			if err := tx.Save(&Record{Version: m.Version, Name: m.Name, AppliedAt: now}).Error; err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Runner) createTable() error {
+	if r.db.Migrator().HasTable(&Record{}) {
+		return nil
+	}
+	if err := r.db.Migrator().CreateTable(&Record{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (r *Runner) apply(m Migration) error {
+	start := time.Now()
+	rec := Record{Version: m.Version, Name: m.Name, AppliedAt: start}
+	var err error
+	if r.txDDL && !m.NoTx {
+		err = r.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Save(&rec).Error
+		})
+	} else {
+		// Marked dirty first, so an interruption is noticed on the next start
+		rec.Dirty = true
+		if err := r.db.Save(&rec).Error; err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+		if err = m.Up(r.db); err == nil {
+			rec.Dirty = false
+			err = r.db.Save(&rec).Error
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("schema migration %d (%s) failed: %w", m.Version, m.Name, err)
+	}
+	slog.Info("Applied schema migration", "version", m.Version, "name", m.Name, "took", time.Since(start).Round(time.Millisecond))
+	return nil
+}
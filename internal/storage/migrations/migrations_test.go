@@ -0,0 +1,146 @@
+package migrations
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func exec(sql string) func(*gorm.DB) error {
+	return func(db *gorm.DB) error { return db.Exec(sql).Error }
+}
+
+func TestUpAppliesInOrderOnce(t *testing.T) {
+	db := openDB(t)
+	var ran []int
+	step := func(v int, sql string) Migration {
+		return Migration{Version: v, Name: sql, Up: func(db *gorm.DB) error {
+			ran = append(ran, v)
+			return db.Exec(sql).Error
+		}}
+	}
+	r, err := New(db, true,
+		step(2, "ALTER TABLE widgets ADD COLUMN color TEXT"),
+		step(1, "CREATE TABLE widgets (id INTEGER PRIMARY KEY)"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := r.Up(); err != nil || n != 2 {
+		t.Fatalf("Up() = %d, %v; want 2 applied", n, err)
+	}
+	if n, err := r.Up(); err != nil || n != 0 {
+		t.Fatalf("second Up() = %d, %v; want nothing to do", n, err)
+	}
+	if len(ran) != 2 || ran[0] != 1 || ran[1] != 2 {
+		t.Errorf("ran %v, want [1 2]", ran)
+	}
+	applied, pending, err := r.Status()
+	if err != nil || len(applied) != 2 || len(pending) != 0 || applied[1].Name != "ALTER TABLE widgets ADD COLUMN color TEXT" {
+		t.Errorf("Status() = %+v, %+v, %v", applied, pending, err)
+	}
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	db := openDB(t)
+	r, _ := New(db, true, Migration{Version: 1, Name: "half", Up: func(db *gorm.DB) error {
+		if err := db.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY)").Error; err != nil {
+			return err
+		}
+		return errors.New("backfill failed")
+	}})
+
+	if _, err := r.Up(); err == nil {
+		t.Fatal("Up() succeeded, want the migration's error")
+	}
+	if db.Migrator().HasTable("widgets") {
+		t.Error("table created by the failed migration was kept")
+	}
+	if applied, _, _ := r.Status(); len(applied) != 0 {
+		t.Errorf("failed migration recorded: %+v", applied)
+	}
+}
+
+func TestUpDirty(t *testing.T) {
+	db := openDB(t)
+	failing := Migration{Version: 1, Name: "backfill", NoTx: true, Up: func(*gorm.DB) error { return errors.New("interrupted") }}
+	r, _ := New(db, true, failing)
+	if _, err := r.Up(); err == nil {
+		t.Fatal("Up() succeeded, want the migration's error")
+	}
+
+	fixed := Migration{Version: 1, Name: "backfill", NoTx: true, Up: exec("SELECT 1")}
+	r, _ = New(db, true, fixed)
+	if _, err := r.Up(); !errors.Is(err, ErrDirty) {
+		t.Fatalf("Up() after an unfinished migration = %v, want ErrDirty", err)
+	}
+
+	fixed.Idempotent = true
+	r, _ = New(db, true, fixed)
+	if n, err := r.Up(); err != nil || n != 1 {
+		t.Fatalf("Up() of an idempotent dirty migration = %d, %v; want it run again", n, err)
+	}
+	if applied, _, _ := r.Status(); len(applied) != 1 || applied[0].Dirty {
+		t.Errorf("records = %+v, want one clean record", applied)
+	}
+}
+
+func TestUpRefusesNewerDatabase(t *testing.T) {
+	db := openDB(t)
+	newer, _ := New(db, true,
+		Migration{Version: 1, Name: "one", Up: exec("SELECT 1")},
+		Migration{Version: 2, Name: "two", Up: exec("SELECT 1")},
+	)
+	if _, err := newer.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := false
+	older, _ := New(db, true, Migration{Version: 1, Name: "one", Up: func(*gorm.DB) error { ran = true; return nil }})
+	if _, err := older.Up(); !errors.Is(err, ErrTooNew) {
+		t.Fatalf("Up() = %v, want ErrTooNew", err)
+	}
+	if ran {
+		t.Error("a migration ran against a newer database")
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	db := openDB(t)
+	ran := false
+	r, _ := New(db, true, Migration{Version: 1, Name: "one", Up: func(*gorm.DB) error { ran = true; return nil }})
+	if err := r.Baseline(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Up(); err != nil || n != 0 || ran {
+		t.Errorf("Up() after Baseline() = %d, %v (ran %v); want nothing run", n, err, ran)
+	}
+}
+
+func TestNewRejectsDuplicateVersions(t *testing.T) {
+	if _, err := New(nil, true,
+		Migration{Version: 1, Name: "a", Up: exec("SELECT 1")},
+		Migration{Version: 1, Name: "b", Up: exec("SELECT 1")},
+	); err == nil {
+		t.Error("New() accepted two migrations with the same version")
+	}
+}
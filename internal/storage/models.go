@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -60,47 +61,148 @@ func (ct *CompressedText) Scan(value interface{}) error {
 
 // Trace represents a complete distributed trace.
 type Trace struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	TraceID     string         `gorm:"uniqueIndex;size:32;not null" json:"trace_id"`
-	ServiceName string         `gorm:"size:255;index" json:"service_name"`
-	Duration    int64          `gorm:"index" json:"duration"` // Microseconds
-	DurationMs  float64        `gorm:"-" json:"duration_ms"`
-	SpanCount   int            `gorm:"-" json:"span_count"`
-	Operation   string         `gorm:"-" json:"operation"`
-	Status      string         `gorm:"size:50" json:"status"`
-	Timestamp   time.Time      `gorm:"index" json:"timestamp"`
-	Spans       []Span         `gorm:"foreignKey:TraceID;references:TraceID;constraint:false" json:"spans,omitempty"`
-	Logs        []Log          `gorm:"foreignKey:TraceID;references:TraceID;constraint:false" json:"logs,omitempty"`
-	CreatedAt   time.Time      `json:"-"`
-	UpdatedAt   time.Time      `json:"-"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          uint              `gorm:"primaryKey" json:"id"`
+	TraceID     string            `gorm:"uniqueIndex;size:32;not null" json:"trace_id"`
+	TenantID    string            `gorm:"size:64;not null;default:'default';index" json:"tenant_id"`
+	Environment string            `gorm:"size:64;not null;default:'';index" json:"environment"` // deployment.environment of the root span's resource
+	ServiceName string            `gorm:"size:255;index;index:idx_traces_service_timestamp,priority:1" json:"service_name"`
+	Duration    int64             `gorm:"index" json:"duration"` // Microseconds
+	DurationMs  float64           `gorm:"-" json:"duration_ms"`
+	SpanCount   int               `gorm:"-" json:"span_count"`
+	Operation   string            `gorm:"-" json:"operation"`
+	LogMatches  int64             `gorm:"-" json:"log_matches,omitempty"` // set by GetTracesByLogsContext
+	Status      string            `gorm:"size:50;index:idx_traces_status_timestamp,priority:1" json:"status"`
+	HasError    bool              `gorm:"index;not null;default:false" json:"has_error"` // any span of the trace failed, not just the one Status came from
+	Timestamp   time.Time         `gorm:"index;index:idx_traces_service_timestamp,priority:2;index:idx_traces_status_timestamp,priority:2" json:"timestamp"`
+	Spans       []Span            `gorm:"foreignKey:TraceID;references:TraceID;constraint:false" json:"spans,omitempty"`
+	Logs        []Log             `gorm:"foreignKey:TraceID;references:TraceID;constraint:false" json:"logs,omitempty"`
+	Annotations []TraceAnnotation `gorm:"foreignKey:TraceID;references:TraceID;constraint:false" json:"annotations,omitempty"`
+	CreatedAt   time.Time         `json:"-"`
+	UpdatedAt   time.Time         `gorm:"index" json:"-"` // bumped when spans arrive; the reconciler's cursor
+	DeletedAt   gorm.DeletedAt    `gorm:"index" json:"-"`
+
+	// Counted at ingest. Completeness, MissingParents and IdlePercentage are set by
+	// the reconciler once the trace has settled; see ReconcileTraceCompleteness.
+	SpansReceived  int      `gorm:"not null;default:0" json:"spans_received"`
+	SpansDropped   int      `gorm:"not null;default:0" json:"spans_dropped"`                      // received past TRACE_MAX_SPANS and not stored
+	Truncated      bool     `gorm:"not null;default:false" json:"truncated"`                      // SpansDropped > 0
+	Completeness   string   `gorm:"size:16;not null;default:'unknown';index" json:"completeness"` // TraceComplete, TracePartial or TraceCompletenessUnknown
+	MissingParents int      `gorm:"not null;default:0" json:"missing_parents"`                    // spans whose parent span was never received
+	IdlePercentage *float64 `json:"idle_percentage"`                                              // TraceTimeline.IdlePercentage; null until reconciled
+}
+
+// TraceAnnotation is a user-supplied tag on a trace, e.g. investigated, root_cause or
+// ticket=INC-1234. Annotations are deleted together with their trace.
+type TraceAnnotation struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TraceID   string    `gorm:"size:32;not null;index;index:idx_trace_annotations_lookup,priority:3" json:"trace_id"`
+	Key       string    `gorm:"column:annotation_key;size:64;not null;index:idx_trace_annotations_lookup,priority:1" json:"key"`
+	Value     string    `gorm:"column:annotation_value;size:255;index:idx_trace_annotations_lookup,priority:2" json:"value"`
+	Author    string    `gorm:"size:128" json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsightFeedback is a user's rating of the AI insight on an error log. Fingerprint
+// groups the ratings of logs with the same normalized body (see ErrorFingerprint).
+type InsightFeedback struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TenantID    string    `gorm:"size:64;not null;default:'default';index" json:"tenant_id"`
+	LogID       uint      `gorm:"not null;index" json:"log_id"`
+	ServiceName string    `gorm:"size:255;not null;index" json:"service_name"`
+	Fingerprint string    `gorm:"size:16;not null;index:idx_insight_feedback_fp,priority:1" json:"fingerprint"`
+	Rating      string    `gorm:"size:16;not null;index:idx_insight_feedback_fp,priority:2" json:"rating"`
+	Comment     string    `gorm:"size:1024" json:"comment,omitempty"`
+	Insight     string    `gorm:"type:text" json:"insight"` // as rated; a later analysis may replace the log's
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // Span represents a single operation within a trace.
 type Span struct {
 	ID             uint           `gorm:"primaryKey" json:"id"`
-	TraceID        string         `gorm:"index;size:32;not null" json:"trace_id"`
-	SpanID         string         `gorm:"size:16;not null" json:"span_id"`
+	TraceID        string         `gorm:"index;uniqueIndex:idx_spans_trace_span,priority:1;size:32;not null" json:"trace_id"`
+	SpanID         string         `gorm:"uniqueIndex:idx_spans_trace_span,priority:2;index:idx_spans_span_id;size:16;not null" json:"span_id"`
+	TenantID       string         `gorm:"size:64;not null;default:'default';index" json:"tenant_id"`
+	Environment    string         `gorm:"size:64;not null;default:'';index" json:"environment"` // deployment.environment resource attribute; "" when absent
 	ParentSpanID   string         `gorm:"size:16" json:"parent_span_id"`
-	OperationName  string         `gorm:"size:255;index" json:"operation_name"`
-	StartTime      time.Time      `json:"start_time"`
+	OperationName  string         `gorm:"size:255;index;index:idx_spans_operation_start,priority:1" json:"operation_name"`
+	Kind           string         `gorm:"size:20" json:"span_kind"` // SERVER, CLIENT, PRODUCER, CONSUMER, INTERNAL ("" if unset)
+	StartTime      time.Time      `gorm:"index:idx_spans_service_start,priority:2;index:idx_spans_operation_start,priority:2" json:"start_time"`
 	EndTime        time.Time      `json:"end_time"`
-	Duration       int64          `json:"duration"`                           // Microseconds
-	ServiceName    string         `gorm:"size:255;index" json:"service_name"` // Originating service
-	AttributesJSON CompressedText `gorm:"type:blob" json:"attributes_json"`   // Compressed JSON string
+	Duration       int64          `json:"duration"`                                                                    // Microseconds
+	ServiceName    string         `gorm:"size:255;index;index:idx_spans_service_start,priority:1" json:"service_name"` // Originating service
+	ScopeName      string         `gorm:"size:255;index" json:"scope_name"`                                            // Instrumentation scope, e.g. go.opentelemetry.io/contrib/.../otelhttp
+	ScopeVersion   string         `gorm:"size:64;index" json:"scope_version"`
+	HasError       bool           `gorm:"not null;default:false" json:"has_error"`
+	HTTPStatusCode *int           `gorm:"index" json:"http_status_code,omitempty"` // http.response.status_code or http.status_code; nil when absent
+	AttributesJSON CompressedText `gorm:"type:blob" json:"attributes_json"`        // Compressed JSON string
+	Links          []SpanLink     `gorm:"-" json:"links,omitempty"`                // stored by BatchCreateSpans, loaded by GetTrace
+}
+
+// SpanLink is an OTLP link from a span to a span of another (or the same) trace, e.g.
+// from a message consumer to the producer that enqueued the message. Links are
+// deleted together with the linking span's trace.
+type SpanLink struct {
+	ID             uint           `gorm:"primaryKey" json:"-"`
+	TraceID        string         `gorm:"size:32;not null;index;uniqueIndex:idx_span_links_key,priority:1" json:"trace_id"`
+	SpanID         string         `gorm:"size:16;not null;uniqueIndex:idx_span_links_key,priority:2" json:"span_id"`
+	LinkedTraceID  string         `gorm:"size:32;not null;index;uniqueIndex:idx_span_links_key,priority:3" json:"linked_trace_id"`
+	LinkedSpanID   string         `gorm:"size:16;not null;uniqueIndex:idx_span_links_key,priority:4" json:"linked_span_id"`
+	AttributesJSON CompressedText `gorm:"type:blob" json:"attributes_json"`
 }
 
 // Log represents a log entry associated with a trace.
 type Log struct {
-	ID             uint           `gorm:"primaryKey" json:"id"`
+	ID             uint           `gorm:"primaryKey;index:idx_logs_timestamp_id,priority:2" json:"id"`
 	TraceID        string         `gorm:"index;size:32" json:"trace_id"`
 	SpanID         string         `gorm:"size:16" json:"span_id"`
-	Severity       string         `gorm:"size:50;index" json:"severity"`
+	TenantID       string         `gorm:"size:64;not null;default:'default';index" json:"tenant_id"`
+	Environment    string         `gorm:"size:64;not null;default:'';index" json:"environment"`                       // deployment.environment resource attribute; "" when absent
+	Severity       string         `gorm:"size:50;index;index:idx_logs_severity_timestamp,priority:1" json:"severity"` // canonical: TRACE, DEBUG, INFO, WARN, ERROR or FATAL
+	RawSeverity    string         `gorm:"size:50" json:"raw_severity,omitempty"`                                      // as received, e.g. "warning" or "SEVERITY_NUMBER_WARN"
 	Body           CompressedText `gorm:"type:blob" json:"body"`
-	ServiceName    string         `gorm:"size:255;index" json:"service_name"`
+	BodyType       string         `gorm:"size:16" json:"body_type,omitempty"`      // OTLP body variant, e.g. "kvlist" for a JSON-encoded map
+	Truncated      bool           `gorm:"not null;default:false" json:"truncated"` // body cut to LOG_MAX_BODY_BYTES at ingest
+	ServiceName    string         `gorm:"size:255;index;index:idx_logs_service_timestamp,priority:1" json:"service_name"`
+	ScopeName      string         `gorm:"size:255;index" json:"scope_name"`
+	ScopeVersion   string         `gorm:"size:64;index" json:"scope_version"`
 	AttributesJSON CompressedText `gorm:"type:blob" json:"attributes_json"`
 	AIInsight      CompressedText `gorm:"type:blob" json:"ai_insight"` // Populated by AI analysis
-	Timestamp      time.Time      `gorm:"index" json:"timestamp"`
+	Timestamp      time.Time      `gorm:"index;index:idx_logs_timestamp_id,priority:1;index:idx_logs_service_timestamp,priority:2;index:idx_logs_severity_timestamp,priority:2" json:"timestamp"`
+	DedupKey       string         `gorm:"size:32;uniqueIndex:idx_logs_dedup_key" json:"-"` // content hash; retried exports are stored once
+	RepeatCount    int64          `gorm:"not null;default:0" json:"repeat_count"`          // identical records folded into this one at ingest
+	Synthetic      bool           `gorm:"not null;default:false;index" json:"synthetic"`   // made from a span's status or events, not exported by the app
+	BodyPreview    bool           `gorm:"-" json:"body_preview,omitempty"`                 // Body is a LogPreviewRunes preview; GET /api/logs/{id} has it all
+	Trace          *LogTrace      `gorm:"-" json:"trace,omitempty"`                        // set by AttachTraceSummaries
+}
+
+// Body types of Log.BodyType, named after the OTLP AnyValue variants. Bodies of type
+// kvlist, array and bytes are stored JSON-encoded.
+const (
+	BodyTypeEmpty  = "empty"
+	BodyTypeString = "string"
+	BodyTypeBool   = "bool"
+	BodyTypeInt    = "int"
+	BodyTypeDouble = "double"
+	BodyTypeBytes  = "bytes"
+	BodyTypeArray  = "array"
+	BodyTypeKvlist = "kvlist"
+)
+
+// LogTrace summarizes the trace a log refers to, so clients can tell live trace links
+// from ones whose trace was purged or never ingested.
+type LogTrace struct {
+	Exists      bool    `json:"exists"`
+	DurationMs  float64 `json:"duration_ms,omitempty"`
+	Status      string  `json:"status,omitempty"`
+	ServiceName string  `json:"service_name,omitempty"`
+}
+
+// LogAttribute indexes one allowlisted attribute of a log so attribute filters are
+// index lookups rather than scans over the compressed attributes blob.
+type LogAttribute struct {
+	LogID uint   `gorm:"primaryKey;autoIncrement:false;index:idx_log_attributes_lookup,priority:3" json:"log_id"`
+	Key   string `gorm:"column:attr_key;primaryKey;size:255;index:idx_log_attributes_lookup,priority:1" json:"key"`
+	Value string `gorm:"column:attr_value;size:255;index:idx_log_attributes_lookup,priority:2" json:"value"`
 }
 
 // MetricBucket represents aggregated metric data over a time window (e.g., 10s).
@@ -108,11 +210,228 @@ type MetricBucket struct {
 	ID             uint           `gorm:"primaryKey" json:"id"`
 	Name           string         `gorm:"size:255;index;not null" json:"name"`
 	ServiceName    string         `gorm:"size:255;index;not null" json:"service_name"`
+	TenantID       string         `gorm:"size:64;not null;default:'default';index" json:"tenant_id"`
 	TimeBucket     time.Time      `gorm:"index;not null" json:"time_bucket"`
 	Min            float64        `json:"min"`
 	Max            float64        `json:"max"`
 	Sum            float64        `json:"sum"`
 	Count          int64          `json:"count"`
 	AttributesJSON CompressedText `gorm:"type:blob" json:"attributes_json"` // Grouped attributes
+	ExemplarsJSON  CompressedText `gorm:"type:blob" json:"-"`               // JSON-encoded Exemplars
+	Exemplars      []Exemplar     `gorm:"-" json:"exemplars,omitempty"`     // highest-value sampled points, filled on read
+}
+
+// Exemplar links a metric point to the trace that produced it.
+type Exemplar struct {
+	TraceID   string    `json:"trace_id"`
+	SpanID    string    `json:"span_id"`
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SLO declares a latency objective for one operation, e.g. "POST /order p95 < 800ms".
+type SLO struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `gorm:"size:255" json:"name"`
+	ServiceName   string    `gorm:"size:255;index;not null" json:"service_name"`
+	Operation     string    `gorm:"size:255;not null" json:"operation"`
+	Percentile    float64   `gorm:"not null" json:"percentile"`   // e.g. 95 for p95
+	ThresholdMs   float64   `gorm:"not null" json:"threshold_ms"` // latency target at Percentile
+	WindowMinutes int       `gorm:"not null" json:"window_minutes"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ServiceQuota caps how much telemetry one service may ingest per UTC day.
+// Zero leaves that signal unlimited.
+type ServiceQuota struct {
+	ServiceName    string    `gorm:"primaryKey;size:255" json:"service_name"`
+	MaxSpansPerDay int64     `gorm:"not null;default:0" json:"max_spans_per_day"`
+	MaxLogsPerDay  int64     `gorm:"not null;default:0" json:"max_logs_per_day"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ServiceMetadata is what the service catalog says about a service: who owns it, how
+// critical it is and where its runbooks are. A service may have metadata before it
+// reports any telemetry.
+type ServiceMetadata struct {
+	ServiceName string        `gorm:"primaryKey;size:255" json:"service_name"`
+	Owner       string        `gorm:"size:255" json:"owner"`
+	Team        string        `gorm:"size:255" json:"team"`
+	Tier        string        `gorm:"size:32" json:"tier"` // one of ServiceTiers, or empty
+	Description string        `gorm:"size:1024" json:"description"`
+	LinksJSON   string        `gorm:"type:text" json:"-"`
+	Links       []ServiceLink `gorm:"-" json:"links"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// TableName keeps the GORM default from depending on how "metadata" pluralizes.
+func (ServiceMetadata) TableName() string { return "service_metadata" }
+
+// ServiceLink is a titled link from a service to its runbook, dashboard or repository.
+type ServiceLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
 }
 
+// QuotaUsage counts what one service ingested, and what was rejected over quota,
+// on one UTC day.
+type QuotaUsage struct {
+	ServiceName   string `gorm:"primaryKey;size:255" json:"service_name"`
+	Day           string `gorm:"primaryKey;size:10" json:"day"` // YYYY-MM-DD
+	Spans         int64  `gorm:"not null;default:0" json:"spans"`
+	RejectedSpans int64  `gorm:"not null;default:0" json:"rejected_spans"`
+	Logs          int64  `gorm:"not null;default:0" json:"logs"`
+	RejectedLogs  int64  `gorm:"not null;default:0" json:"rejected_logs"`
+}
+
+// ServiceLiveness is when one service of one tenant last exported each signal, with
+// the lag and clock skew observed on its exports. The liveness tracker keeps it in
+// memory and saves it periodically, so quiet services are remembered across restarts.
+type ServiceLiveness struct {
+	TenantID     string     `gorm:"primaryKey;size:64" json:"tenant_id"`
+	ServiceName  string     `gorm:"primaryKey;size:255" json:"service_name"`
+	LastSpanAt   *time.Time `json:"last_span_at"`
+	LastLogAt    *time.Time `json:"last_log_at"`
+	LastMetricAt *time.Time `json:"last_metric_at"`
+	LagMs        float64    `gorm:"not null;default:0" json:"lag_ms"`        // moving average of ingest time minus payload time
+	ClockSkewMs  float64    `gorm:"not null;default:0" json:"clock_skew_ms"` // smallest recent lag; negative = exporter clock ahead
+	StaleSince   *time.Time `json:"stale_since"`                             // nil while the service is exporting
+}
+
+// MetricCatalog describes one metric name of one tenant: what its exporters say about
+// it, which services report it, and how many series it had in the last aggregation
+// window. The TSDB aggregator updates it on every flush.
+type MetricCatalog struct {
+	TenantID     string    `gorm:"primaryKey;size:64" json:"tenant_id"`
+	Name         string    `gorm:"primaryKey;size:255" json:"name"`
+	Type         string    `gorm:"size:32" json:"type"` // gauge, sum or histogram
+	Unit         string    `gorm:"size:64" json:"unit"`
+	Description  string    `gorm:"size:1024" json:"description"`
+	ServicesJSON string    `gorm:"type:text" json:"-"`
+	Services     []string  `gorm:"-" json:"services"`
+	Cardinality  int64     `gorm:"not null;default:0" json:"cardinality"` // distinct service and attribute sets in the last window
+	LastSeen     time.Time `gorm:"index;not null" json:"last_seen"`
+}
+
+// TableName keeps the catalog a single table, like the endpoint it backs.
+func (MetricCatalog) TableName() string { return "metric_catalog" }
+
+// ReplicaHeartbeat is a single row the primary rewrites periodically when a read
+// replica is configured. How old it is on the replica is the replication lag.
+type ReplicaHeartbeat struct {
+	ID     uint      `gorm:"primaryKey;autoIncrement:false"`
+	BeatAt time.Time `gorm:"not null"`
+}
+
+// SLOStatus is the outcome of evaluating an SLO over its window.
+type SLOStatus struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	SLOID         uint      `gorm:"index;not null" json:"slo_id"`
+	ServiceName   string    `gorm:"size:255" json:"service_name"`
+	Operation     string    `gorm:"size:255" json:"operation"`
+	ActualMs      float64   `json:"actual_ms"`      // observed latency at the SLO percentile
+	CompliancePct float64   `json:"compliance_pct"` // share of spans within threshold
+	BurnRate      float64   `json:"burn_rate"`      // error budget consumption rate (1 = exactly on budget)
+	Breached      bool      `json:"breached"`
+	SampleCount   int64     `json:"sample_count"`
+	EvaluatedAt   time.Time `gorm:"index" json:"evaluated_at"`
+}
+
+// AnomalyEvent records a service signal that deviated from its rolling baseline for
+// several consecutive evaluation intervals.
+type AnomalyEvent struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ServiceName    string    `gorm:"size:255;index;not null" json:"service_name"`
+	Signal         string    `gorm:"size:32;not null" json:"signal"` // "request_rate" (req/min) or "error_rate" (0-1)
+	Value          float64   `json:"value"`                          // observed value in the latest interval
+	BaselineMean   float64   `json:"baseline_mean"`
+	BaselineStdDev float64   `json:"baseline_stddev"` // after applying the sparse-data floor
+	Sigma          float64   `json:"sigma"`           // (value - mean) / stddev; negative for drops
+	Intervals      int       `json:"intervals"`       // consecutive deviating intervals
+	SampleCount    int64     `json:"sample_count"`    // requests in the latest interval
+	DetectedAt     time.Time `gorm:"index" json:"detected_at"`
+}
+
+// AuditEntry records one call to a mutating admin endpoint: who made it, with which
+// parameters, and what it did.
+type AuditEntry struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Timestamp    time.Time `gorm:"index;not null" json:"timestamp"`
+	RemoteAddr   string    `gorm:"size:128" json:"remote_addr"`
+	Principal    string    `gorm:"size:255" json:"principal,omitempty"` // authenticated user, when known
+	Method       string    `gorm:"size:16;not null" json:"method"`
+	Path         string    `gorm:"size:512;not null" json:"path"`
+	Params       string    `gorm:"size:2048" json:"params,omitempty"` // query string, sensitive values redacted
+	Status       int       `json:"status"`
+	RowsAffected *int64    `json:"rows_affected,omitempty"` // nil when the action reports none
+}
+
+// ServiceMapSnapshot is the service map computed over the WindowSeconds ending at
+// Timestamp. Snapshots have their own retention, so past topology stays viewable
+// after the spans it was computed from are purged.
+type ServiceMapSnapshot struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Timestamp     time.Time      `gorm:"index;not null" json:"timestamp"`
+	WindowSeconds int64          `json:"window_seconds"`
+	MapJSON       CompressedText `gorm:"type:blob" json:"-"`
+}
+
+// PurgeJob is a background purge of the logs and traces older than Cutoff. Its
+// progress is saved with every batch it deletes, so a restart resumes it where it
+// stopped.
+type PurgeJob struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Tenant       string     `gorm:"size:64;index" json:"tenant,omitempty"` // empty: all tenants
+	Status       string     `gorm:"size:16;not null;index" json:"status"`
+	Cutoff       time.Time  `gorm:"not null" json:"cutoff"`
+	Phase        string     `gorm:"size:16;not null" json:"phase"` // table being purged: logs, then traces
+	LastID       uint       `json:"last_id"`                       // highest ID deleted so far in Phase
+	LogsPurged   int64      `json:"logs_purged"`
+	TracesPurged int64      `json:"traces_purged"`
+	Error        string     `gorm:"size:1024" json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// Investigation is a persisted record of an automated error investigation, written
+// by GraphRAG.
+type Investigation struct {
+	ID               string          `gorm:"primaryKey;size:64" json:"id"`
+	CreatedAt        time.Time       `json:"created_at"`
+	Status           string          `gorm:"size:20" json:"status"`   // detected, triaged, resolved
+	Severity         string          `gorm:"size:20" json:"severity"` // critical, warning, info
+	TriggerService   string          `gorm:"size:255;index" json:"trigger_service"`
+	TriggerOperation string          `gorm:"size:255" json:"trigger_operation"`
+	ErrorMessage     string          `gorm:"type:text" json:"error_message"`
+	RootService      string          `gorm:"size:255" json:"root_service"`
+	RootOperation    string          `gorm:"size:255" json:"root_operation"`
+	CausalChain      json.RawMessage `gorm:"type:text" json:"causal_chain"`
+	TraceIDs         json.RawMessage `gorm:"type:text" json:"trace_ids"`
+	ErrorLogs        json.RawMessage `gorm:"type:text" json:"error_logs"`
+	AnomalousMetrics json.RawMessage `gorm:"type:text" json:"anomalous_metrics"`
+	AffectedServices json.RawMessage `gorm:"type:text" json:"affected_services"`
+	SpanChain        json.RawMessage `gorm:"type:text" json:"span_chain"`
+}
+
+// TableName overrides GORM's default table name.
+func (Investigation) TableName() string {
+	return "investigations"
+}
+
+// GraphSnapshot is a periodic snapshot of the service topology, written by GraphRAG.
+type GraphSnapshot struct {
+	ID             string          `gorm:"primaryKey;size:64" json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Nodes          json.RawMessage `gorm:"type:text" json:"nodes"`
+	Edges          json.RawMessage `gorm:"type:text" json:"edges"`
+	ServiceCount   int             `json:"service_count"`
+	TotalCalls     int64           `json:"total_calls"`
+	AvgHealthScore float64         `json:"avg_health_score"`
+}
+
+// TableName overrides GORM's default table name.
+func (GraphSnapshot) TableName() string {
+	return "graph_snapshots"
+}
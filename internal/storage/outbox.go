@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Outbox event types, named after the /ws/events message they are broadcast as.
+const (
+	OutboxAnomaly   = "anomaly"
+	OutboxSLOBreach = "slo_breach"
+)
+
+// Outbox event states.
+const (
+	OutboxPending   = "pending"   // not delivered yet; retried until MaxAttempts
+	OutboxDelivered = "delivered" // delivered
+	OutboxDead      = "dead"      // gave up after the last attempt failed
+)
+
+// OutboxEvent is a notification stored in the same transaction as the change it
+// announces, and delivered from there by the outbox dispatcher, so a restart between
+// the two delays the notification instead of losing it.
+type OutboxEvent struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	TenantID      string     `gorm:"size:64" json:"tenant_id,omitempty"` // "" = every tenant's clients
+	Type          string     `gorm:"size:64;not null" json:"type"`
+	ServiceName   string     `gorm:"size:255" json:"service_name"`
+	PayloadJSON   string     `gorm:"type:text;not null" json:"payload_json"`
+	CreatedAt     time.Time  `gorm:"index;not null" json:"created_at"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index;not null" json:"next_attempt_at"` // pending events are delivered once this has passed
+	LastError     string     `gorm:"size:1024" json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `gorm:"index" json:"delivered_at,omitempty"`
+	DeadAt        *time.Time `gorm:"index" json:"dead_at,omitempty"`
+}
+
+// State returns OutboxPending, OutboxDelivered or OutboxDead.
+func (e *OutboxEvent) State() string {
+	switch {
+	case e.DeliveredAt != nil:
+		return OutboxDelivered
+	case e.DeadAt != nil:
+		return OutboxDead
+	}
+	return OutboxPending
+}
+
+// OutboxStatus is the outbox as reported by GET /api/admin/outbox.
+type OutboxStatus struct {
+	Counts map[string]int64 `json:"counts"` // events per state
+	Events []OutboxEvent    `json:"events"` // newest first
+}
+
+// createAnnounced inserts row and an outbox event of eventType carrying it, in one
+// transaction. The payload is encoded after the insert, so it has the row's ID.
+func (r *Repository) createAnnounced(row any, eventType, tenantID, service string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(row).Error; err != nil {
+			return err
+		}
+		payload, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Create(&OutboxEvent{TenantID: tenantID, Type: eventType, ServiceName: service,
+			PayloadJSON: string(payload), CreatedAt: now, NextAttemptAt: now}).Error
+	})
+}
+
+// PendingOutboxEvents returns up to limit pending events due at now, oldest first.
+func (r *Repository) PendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := r.db.WithContext(ctx).
+		Where("delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?", now).
+		Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending outbox events: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxDelivered records the delivery of an event after attempts tries.
+func (r *Repository) MarkOutboxDelivered(ctx context.Context, id uint, attempts int, at time.Time) error {
+	err := r.db.WithContext(ctx).Model(&OutboxEvent{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"attempts": attempts, "delivered_at": at, "last_error": ""}).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event delivered: %w", err)
+	}
+	return nil
+}
+
+// RecordOutboxFailure records a failed delivery attempt, the attempts-th, and when to
+// retry. A zero retryAt gives up: the event is dead as of at.
+func (r *Repository) RecordOutboxFailure(ctx context.Context, id uint, attempts int, errMsg string, at, retryAt time.Time) error {
+	if len(errMsg) > 1024 {
+		errMsg = errMsg[:1024]
+	}
+	cols := map[string]interface{}{"attempts": attempts, "last_error": errMsg}
+	if retryAt.IsZero() {
+		cols["dead_at"] = at
+	} else {
+		cols["next_attempt_at"] = retryAt
+	}
+	if err := r.db.WithContext(ctx).Model(&OutboxEvent{}).Where("id = ?", id).UpdateColumns(cols).Error; err != nil {
+		return fmt.Errorf("failed to record outbox delivery failure: %w", err)
+	}
+	return nil
+}
+
+// PruneOutboxEvents deletes the delivered and dead events created before olderThan.
+// Pending events are kept however old.
+func (r *Repository) PruneOutboxEvents(olderThan time.Time) (int64, error) {
+	result := r.db.Where("created_at < ? AND (delivered_at IS NOT NULL OR dead_at IS NOT NULL)", olderThan).Delete(&OutboxEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune outbox events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// GetOutboxStatus counts the events per state and lists up to limit of them in the
+// given state (any state when empty), newest first.
+func (r *Repository) GetOutboxStatus(ctx context.Context, state string, limit int) (*OutboxStatus, error) {
+	db := r.db.WithContext(ctx)
+	st := &OutboxStatus{Counts: map[string]int64{OutboxPending: 0, OutboxDelivered: 0, OutboxDead: 0}}
+	for s, cond := range outboxStates {
+		var n int64
+		if err := db.Model(&OutboxEvent{}).Where(cond).Count(&n).Error; err != nil {
+			return nil, fmt.Errorf("failed to count outbox events: %w", err)
+		}
+		st.Counts[s] = n
+	}
+	q := db.Order("id DESC").Limit(limit)
+	if state != "" {
+		q = q.Where(outboxStates[state])
+	}
+	if err := q.Find(&st.Events).Error; err != nil {
+		return nil, fmt.Errorf("failed to list outbox events: %w", err)
+	}
+	return st, nil
+}
+
+// outboxStates are the conditions selecting the events in each state.
+var outboxStates = map[string]string{
+	OutboxPending:   "delivered_at IS NULL AND dead_at IS NULL",
+	OutboxDelivered: "delivered_at IS NOT NULL",
+	OutboxDead:      "dead_at IS NOT NULL",
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCreateAnomalyEventIsAtomicWithItsOutboxEvent(t *testing.T) {
+	repo := newTestRepository(t)
+	if err := repo.CreateAnomalyEvent(&AnomalyEvent{ServiceName: "checkout", Signal: "error_rate", DetectedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := repo.PendingOutboxEvents(context.Background(), time.Now(), 10)
+	if err != nil || len(events) != 1 || events[0].Type != OutboxAnomaly || events[0].State() != OutboxPending {
+		t.Fatalf("PendingOutboxEvents() = %+v, %v; want the anomaly", events, err)
+	}
+
+	// Without the outbox table the anomaly is not stored either
+	if err := repo.db.Migrator().DropTable(&OutboxEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateAnomalyEvent(&AnomalyEvent{ServiceName: "cart", Signal: "error_rate", DetectedAt: time.Now()}); err == nil {
+		t.Fatal("CreateAnomalyEvent() succeeded without an outbox")
+	}
+	var n int64
+	repo.db.Model(&AnomalyEvent{}).Where("service_name = ?", "cart").Count(&n)
+	if n != 0 {
+		t.Errorf("%d anomalies stored without their outbox event", n)
+	}
+}
+
+func TestPruneOutboxEventsKeepsPending(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	for range 3 {
+		if err := repo.CreateSLOBreach(&SLOStatus{SLOID: 1, ServiceName: "checkout", Breached: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := repo.PendingOutboxEvents(ctx, time.Now(), 10)
+	if err != nil || len(events) != 3 {
+		t.Fatalf("PendingOutboxEvents() = %d events, %v; want 3", len(events), err)
+	}
+	now := time.Now()
+	if err := repo.MarkOutboxDelivered(ctx, events[0].ID, 1, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RecordOutboxFailure(ctx, events[1].ID, 5, "refused", now, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := repo.PruneOutboxEvents(now.Add(time.Minute))
+	if err != nil || n != 2 {
+		t.Fatalf("PruneOutboxEvents() = %d, %v; want the delivered and dead events", n, err)
+	}
+	st, err := repo.GetOutboxStatus(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Events) != 1 || st.Events[0].ID != events[2].ID || st.Counts[OutboxPending] != 1 {
+		t.Errorf("status = %+v, want the pending event only", st)
+	}
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TracePathSeparator joins the services of a path, e.g. "order>payment>inventory".
+const TracePathSeparator = ">"
+
+// DefaultMaxSpansPerTrace caps the spans read per trace when reconstructing paths.
+const DefaultMaxSpansPerTrace = 1000
+
+// TracePath aggregates every trace in a window that crossed the same services in the
+// same order.
+type TracePath struct {
+	Path          string   `json:"path"` // services joined by TracePathSeparator
+	Services      []string `json:"services"`
+	Count         int64    `json:"count"`
+	ErrorCount    int64    `json:"error_count"`
+	ErrorRate     float64  `json:"error_rate"` // 0-1
+	AvgDurationMs float64  `json:"avg_duration_ms"`
+}
+
+// TracePathsResult is the top-N paths of a window plus how much data they cover.
+type TracePathsResult struct {
+	Paths           []TracePath `json:"paths"`
+	DistinctPaths   int         `json:"distinct_paths"`
+	TracesScanned   int64       `json:"traces_scanned"`
+	TruncatedTraces int64       `json:"truncated_traces"` // traces with more spans than the per-trace cap
+}
+
+// TracePathQuery selects and ranks trace paths.
+type TracePathQuery struct {
+	Start            time.Time
+	End              time.Time
+	ServiceName      string // only paths that include this service
+	SortBy           string // "count" (default), "errors", "error_rate" or "duration"
+	Limit            int
+	MaxSpansPerTrace int
+}
+
+// pathAgg accumulates one path while streaming.
+type pathAgg struct {
+	services   []string
+	count      int64
+	errorCount int64
+	durationUs int64
+}
+
+// GetTracePaths reconstructs, for every trace started in the window, the order in which
+// it first reached each service, and aggregates identical paths. Spans are streamed
+// grouped by trace and ordered by start time, so only one trace is held in memory at a
+// time; at most MaxSpansPerTrace spans of a trace are considered.
+func (r *Repository) GetTracePaths(q TracePathQuery) (*TracePathsResult, error) {
+	if q.MaxSpansPerTrace <= 0 {
+		q.MaxSpansPerTrace = DefaultMaxSpansPerTrace
+	}
+
+	rows, err := r.db.Table("spans").
+		Select("spans.trace_id, spans.service_name, traces.status, traces.duration").
+		Joins("JOIN traces ON traces.trace_id = spans.trace_id").
+		Where("traces.timestamp BETWEEN ? AND ?", q.Start, q.End).
+		Where("traces.deleted_at IS NULL").
+		Order("spans.trace_id, spans.start_time, spans.id").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trace paths: %w", err)
+	}
+	defer rows.Close()
+
+	result := &TracePathsResult{}
+	paths := make(map[string]*pathAgg)
+
+	var (
+		currentID  string
+		services   []string
+		seen       = make(map[string]bool)
+		spanCount  int
+		status     string
+		durationUs int64
+	)
+	flush := func() {
+		if currentID == "" || len(services) == 0 {
+			return
+		}
+		result.TracesScanned++
+		if spanCount > q.MaxSpansPerTrace {
+			result.TruncatedTraces++
+		}
+		key := strings.Join(services, TracePathSeparator)
+		agg, ok := paths[key]
+		if !ok {
+			agg = &pathAgg{services: append([]string(nil), services...)}
+			paths[key] = agg
+		}
+		agg.count++
+		agg.durationUs += durationUs
+		if strings.Contains(strings.ToUpper(status), "ERROR") {
+			agg.errorCount++
+		}
+	}
+
+	for rows.Next() {
+		var traceID, service, traceStatus string
+		var traceDuration int64
+		if err := rows.Scan(&traceID, &service, &traceStatus, &traceDuration); err != nil {
+			return nil, fmt.Errorf("failed to scan trace path row: %w", err)
+		}
+		if traceID != currentID {
+			flush()
+			currentID, status, durationUs = traceID, traceStatus, traceDuration
+			services = services[:0]
+			clear(seen)
+			spanCount = 0
+		}
+		spanCount++
+		if spanCount > q.MaxSpansPerTrace || service == "" || seen[service] {
+			continue
+		}
+		seen[service] = true
+		services = append(services, service)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trace paths: %w", err)
+	}
+	flush()
+
+	out := make([]TracePath, 0, len(paths))
+	for key, agg := range paths {
+		if q.ServiceName != "" && !slices.Contains(agg.services, q.ServiceName) {
+			continue
+		}
+		out = append(out, TracePath{
+			Path:          key,
+			Services:      agg.services,
+			Count:         agg.count,
+			ErrorCount:    agg.errorCount,
+			ErrorRate:     float64(agg.errorCount) / float64(agg.count),
+			AvgDurationMs: float64(agg.durationUs) / float64(agg.count) / 1000.0,
+		})
+	}
+	result.DistinctPaths = len(out)
+
+	sortTracePaths(out, q.SortBy)
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	result.Paths = out
+	return result, nil
+}
+
+// sortTracePaths orders paths by the requested metric, descending, with the path
+// string as tie-breaker so equal rankings are stable between calls.
+func sortTracePaths(paths []TracePath, sortBy string) {
+	less := func(a, b TracePath) (bool, bool) {
+		switch sortBy {
+		case "errors":
+			return a.ErrorCount > b.ErrorCount, a.ErrorCount != b.ErrorCount
+		case "error_rate":
+			return a.ErrorRate > b.ErrorRate, a.ErrorRate != b.ErrorRate
+		case "duration":
+			return a.AvgDurationMs > b.AvgDurationMs, a.AvgDurationMs != b.AvgDurationMs
+		default:
+			return a.Count > b.Count, a.Count != b.Count
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if before, decided := less(paths[i], paths[j]); decided {
+			return before
+		}
+		if paths[i].Count != paths[j].Count {
+			return paths[i].Count > paths[j].Count
+		}
+		return paths[i].Path < paths[j].Path
+	})
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seedPath writes one trace whose spans start in the order of services.
+func seedPath(t *testing.T, repo *Repository, traceID, status string, durationUs int64, ts time.Time, services ...string) {
+	t.Helper()
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: traceID, ServiceName: services[0], Status: status, Duration: durationUs, Timestamp: ts}}); err != nil {
+		t.Fatalf("BatchCreateTraces() error = %v", err)
+	}
+	spans := make([]Span, len(services))
+	for i, svc := range services {
+		spans[i] = Span{TraceID: traceID, SpanID: fmt.Sprintf("%s-%d", traceID, i), ServiceName: svc, StartTime: ts.Add(time.Duration(i) * time.Millisecond)}
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatalf("BatchCreateSpans() error = %v", err)
+	}
+}
+
+func TestGetTracePaths(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	ts := now.Add(-time.Minute)
+
+	// order calls payment twice; repeat visits do not change the path.
+	seedPath(t, repo, "t1", "STATUS_CODE_OK", 100_000, ts, "order", "payment", "payment", "inventory")
+	seedPath(t, repo, "t2", "STATUS_CODE_ERROR", 300_000, ts, "order", "payment", "inventory", "order")
+	seedPath(t, repo, "t3", "STATUS_CODE_ERROR", 50_000, ts, "order", "payment", "auth")
+	seedPath(t, repo, "old", "STATUS_CODE_OK", 1_000, now.Add(-2*time.Hour), "order", "auth")
+
+	res, err := repo.GetTracePaths(TracePathQuery{Start: now.Add(-time.Hour), End: now})
+	if err != nil {
+		t.Fatalf("GetTracePaths() error = %v", err)
+	}
+	if res.TracesScanned != 3 || res.DistinctPaths != 2 || len(res.Paths) != 2 {
+		t.Fatalf("result = %+v, want 3 traces over 2 paths", res)
+	}
+	top := res.Paths[0]
+	if top.Path != "order>payment>inventory" || top.Count != 2 || top.ErrorCount != 1 || top.AvgDurationMs != 200 {
+		t.Errorf("top path = %+v", top)
+	}
+
+	byRate, err := repo.GetTracePaths(TracePathQuery{Start: now.Add(-time.Hour), End: now, SortBy: "error_rate"})
+	if err != nil {
+		t.Fatalf("GetTracePaths() error = %v", err)
+	}
+	if byRate.Paths[0].Path != "order>payment>auth" || byRate.Paths[0].ErrorRate != 1 {
+		t.Errorf("error_rate order = %+v", byRate.Paths)
+	}
+
+	filtered, err := repo.GetTracePaths(TracePathQuery{Start: now.Add(-time.Hour), End: now, ServiceName: "auth"})
+	if err != nil {
+		t.Fatalf("GetTracePaths() error = %v", err)
+	}
+	if len(filtered.Paths) != 1 || filtered.Paths[0].Path != "order>payment>auth" {
+		t.Errorf("service filter = %+v", filtered.Paths)
+	}
+}
+
+func TestGetTracePathsSpanCap(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	seedPath(t, repo, "wide", "STATUS_CODE_OK", 1_000, now.Add(-time.Minute), "gateway", "search", "ranking", "ads")
+
+	res, err := repo.GetTracePaths(TracePathQuery{Start: now.Add(-time.Hour), End: now, MaxSpansPerTrace: 2})
+	if err != nil {
+		t.Fatalf("GetTracePaths() error = %v", err)
+	}
+	if res.TruncatedTraces != 1 || len(res.Paths) != 1 || res.Paths[0].Path != "gateway>search" {
+		t.Errorf("result = %+v, want one truncated gateway>search path", res)
+	}
+}
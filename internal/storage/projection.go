@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrUnknownField is returned when a field projection names a field the listing
+// does not have.
+var ErrUnknownField = errors.New("unknown field")
+
+// traceFieldColumns maps the JSON fields of a trace listing to the columns they
+// need. Virtual fields are derived after the query: duration_ms from duration, and
+// span_count and operation from a span summary keyed by trace_id.
+var traceFieldColumns = map[string][]string{
+	"id":              {"id"},
+	"trace_id":        {"trace_id"},
+	"tenant_id":       {"tenant_id"},
+	"environment":     {"environment"},
+	"service_name":    {"service_name"},
+	"duration":        {"duration"},
+	"duration_ms":     {"duration"},
+	"span_count":      {"trace_id"},
+	"operation":       {"trace_id"},
+	"status":          {"status"},
+	"has_error":       {"has_error"},
+	"timestamp":       {"timestamp"},
+	"spans_received":  {"spans_received"},
+	"spans_dropped":   {"spans_dropped"},
+	"truncated":       {"truncated"},
+	"completeness":    {"completeness"},
+	"missing_parents": {"missing_parents"},
+	"idle_percentage": {"idle_percentage"},
+}
+
+// logFieldColumns maps the JSON fields of a log listing to the columns they need;
+// trace, the summary attached on request, is looked up by trace_id.
+var logFieldColumns = map[string][]string{
+	"id":              {"id"},
+	"trace_id":        {"trace_id"},
+	"span_id":         {"span_id"},
+	"tenant_id":       {"tenant_id"},
+	"environment":     {"environment"},
+	"severity":        {"severity"},
+	"raw_severity":    {"raw_severity"},
+	"body":            {"body"},
+	"body_type":       {"body_type"},
+	"truncated":       {"truncated"},
+	"synthetic":       {"synthetic"},
+	"service_name":    {"service_name"},
+	"scope_name":      {"scope_name"},
+	"scope_version":   {"scope_version"},
+	"attributes_json": {"attributes_json"},
+	"ai_insight":      {"ai_insight"},
+	"timestamp":       {"timestamp"},
+	"repeat_count":    {"repeat_count"},
+	"body_preview":    {"body"},
+	"trace":           {"trace_id"},
+}
+
+// logSummaryColumns are the columns a log listing in summary mode reads: all but the
+// attributes and the AI insight, which are only decompressed for a single log.
+var logSummaryColumns = []string{
+	"id", "trace_id", "span_id", "tenant_id", "environment", "severity", "raw_severity", "body", "body_type",
+	"truncated", "synthetic", "service_name", "scope_name", "scope_version", "timestamp", "repeat_count",
+}
+
+// projectionColumns returns the columns to select for fields plus the always
+// required ones, or nil (every column) when fields is empty.
+func projectionColumns(known map[string][]string, fields []string, required ...string) ([]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	cols := slices.Clone(required)
+	for _, f := range fields {
+		need, ok := known[f]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownField, f)
+		}
+		for _, c := range need {
+			if !slices.Contains(cols, c) {
+				cols = append(cols, c)
+			}
+		}
+	}
+	return cols, nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueryTracesFields(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "t1", ServiceName: "svc", Duration: 1500, Status: "STATUS_CODE_OK", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]Span{
+		{TraceID: "t1", SpanID: "s1", OperationName: "GET /a", ServiceName: "svc", StartTime: now, EndTime: now},
+		{TraceID: "t1", SpanID: "s2", OperationName: "GET /b", ServiceName: "svc", StartTime: now, EndTime: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := repo.QueryTraces(TraceFilter{Limit: 10, Fields: []string{"duration_ms", "span_count", "operation"}})
+	if err != nil {
+		t.Fatalf("QueryTraces() error = %v", err)
+	}
+	if len(resp.Traces) != 1 || resp.Total != 1 {
+		t.Fatalf("got %d traces (total %d), want 1", len(resp.Traces), resp.Total)
+	}
+	got := resp.Traces[0]
+	if got.DurationMs != 1.5 || got.SpanCount != 2 || got.Operation != "GET /a" {
+		t.Errorf("virtual fields = %v ms, %d spans, %q; want 1.5, 2, GET /a", got.DurationMs, got.SpanCount, got.Operation)
+	}
+	if got.ServiceName != "" || got.Status != "" || !got.Timestamp.IsZero() {
+		t.Errorf("unrequested columns loaded: %+v", got)
+	}
+
+	resp, err = repo.QueryTraces(TraceFilter{Limit: 10, Fields: []string{"status"}})
+	if err != nil {
+		t.Fatalf("QueryTraces(status) error = %v", err)
+	}
+	if got := resp.Traces[0]; got.Status != "STATUS_CODE_OK" || got.SpanCount != 0 || got.TraceID != "" {
+		t.Errorf("status projection = %+v, want status only and no span summary", got)
+	}
+
+	if _, err := repo.QueryTraces(TraceFilter{Fields: []string{"spans"}}); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("unknown field error = %v, want ErrUnknownField", err)
+	}
+}
+
+func TestGetLogsV2Fields(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var logs []Log
+	for i := range 7 {
+		logs = append(logs, Log{
+			ServiceName: "svc",
+			Severity:    "INFO",
+			Body:        CompressedText(fmt.Sprintf("line %d", i)),
+			Timestamp:   base.Add(time.Duration(i/2) * time.Second),
+		})
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := LogFilter{Limit: 3, Fields: []string{"body"}}
+	page, _, err := repo.GetLogsV2(filter)
+	if err != nil {
+		t.Fatalf("GetLogsV2() error = %v", err)
+	}
+	if page[0].Body == "" || page[0].ServiceName != "" || page[0].Severity != "" {
+		t.Errorf("projected log = %+v, want body only", page[0])
+	}
+	// id and timestamp are loaded regardless, so cursor paging still visits every row once.
+	if ids := pageAllLogs(t, repo, filter, nil); len(ids) != len(logs) {
+		t.Errorf("paged %d logs with a projection, want %d", len(ids), len(logs))
+	}
+
+	if _, _, err := repo.GetLogsV2(LogFilter{Fields: []string{"body", "nope"}}); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("unknown field error = %v, want ErrUnknownField", err)
+	}
+}
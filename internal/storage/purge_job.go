@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purge job states.
+const (
+	PurgePending   = "pending"
+	PurgeRunning   = "running"
+	PurgeDone      = "done"
+	PurgeFailed    = "failed"
+	PurgeCancelled = "cancelled"
+)
+
+// Purge job phases, in the order they run.
+const (
+	PurgePhaseLogs   = "logs"
+	PurgePhaseTraces = "traces"
+)
+
+// DefaultPurgeBatchSize is how many rows a purge job deletes per batch.
+const DefaultPurgeBatchSize = 10000
+
+// ErrPurgeJobFinished is returned when cancelling a job that is no longer running.
+var ErrPurgeJobFinished = errors.New("purge job already finished")
+
+// Finished reports whether the job has stopped for good.
+func (j *PurgeJob) Finished() bool {
+	return j.Status == PurgeDone || j.Status == PurgeFailed || j.Status == PurgeCancelled
+}
+
+// purgeJobs queries the purge jobs visible to the repository: those of its tenant,
+// or all of them when it is not scoped.
+func (r *Repository) purgeJobs() *gorm.DB {
+	q := r.primary().Model(&PurgeJob{})
+	if r.tenant != "" {
+		q = q.Where("tenant = ?", r.tenant)
+	}
+	return q
+}
+
+// CountPurgeable counts the logs and traces older than cutoff.
+func (r *Repository) CountPurgeable(cutoff time.Time) (int64, error) {
+	var logs, traces int64
+	if err := r.db.Model(&Log{}).Where("timestamp < ?", cutoff).Count(&logs).Error; err != nil {
+		return 0, fmt.Errorf("failed to count purgeable logs: %w", err)
+	}
+	if err := r.db.Model(&Trace{}).Where("timestamp < ?", cutoff).Count(&traces).Error; err != nil {
+		return 0, fmt.Errorf("failed to count purgeable traces: %w", err)
+	}
+	return logs + traces, nil
+}
+
+// CreatePurgeJob queues a purge of the logs and traces older than cutoff, limited
+// to the repository's tenant.
+func (r *Repository) CreatePurgeJob(cutoff time.Time) (*PurgeJob, error) {
+	job := &PurgeJob{Tenant: r.tenant, Status: PurgePending, Cutoff: cutoff, Phase: PurgePhaseLogs}
+	if err := r.db.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create purge job: %w", err)
+	}
+	return job, nil
+}
+
+// GetPurgeJob returns a purge job. Jobs of other tenants are not found.
+func (r *Repository) GetPurgeJob(id uint) (*PurgeJob, error) {
+	var job PurgeJob
+	if err := r.purgeJobs().Where("id = ?", id).First(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to get purge job: %w", err)
+	}
+	return &job, nil
+}
+
+// ListUnfinishedPurgeJobs returns the pending and running jobs, oldest first. After
+// a restart the running ones are those that were interrupted.
+func (r *Repository) ListUnfinishedPurgeJobs() ([]PurgeJob, error) {
+	var jobs []PurgeJob
+	if err := r.purgeJobs().Where("status IN ?", []string{PurgePending, PurgeRunning}).
+		Order("id").Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list purge jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// CancelPurgeJob stops a pending or running job after its current batch. Rows
+// already deleted stay deleted. It returns ErrPurgeJobFinished, with the job, when
+// the job has already stopped.
+func (r *Repository) CancelPurgeJob(id uint) (*PurgeJob, error) {
+	res := r.purgeJobs().Where("id = ? AND status IN ?", id, []string{PurgePending, PurgeRunning}).
+		Updates(map[string]interface{}{"status": PurgeCancelled, "finished_at": time.Now().UTC()})
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to cancel purge job: %w", res.Error)
+	}
+	job, err := r.GetPurgeJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected == 0 {
+		return job, ErrPurgeJobFinished
+	}
+	slog.Info("Purge job cancelled", "job_id", id, "logs_purged", job.LogsPurged, "traces_purged", job.TracesPurged)
+	return job, nil
+}
+
+// RunPurgeBatch deletes the next batch of up to batchSize rows of a job and saves
+// its progress in the same transaction, so an interrupted job resumes after the
+// last batch it committed. It returns the updated job, which is finished once
+// nothing is left to delete. A failed batch marks the job failed.
+func (r *Repository) RunPurgeBatch(id uint, batchSize int) (*PurgeJob, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultPurgeBatchSize
+	}
+	job, err := r.GetPurgeJob(id)
+	if err != nil || job.Finished() {
+		return job, err
+	}
+	if job.Status == PurgePending {
+		if err := r.purgeJobs().Where("id = ? AND status = ?", id, PurgePending).
+			Update("status", PurgeRunning).Error; err != nil {
+			return job, fmt.Errorf("failed to start purge job: %w", err)
+		}
+		job.Status = PurgeRunning
+	}
+
+	// The data is deleted as the job's tenant, whoever runs the batch.
+	data := r.withTenant(job.Tenant)
+	var more bool
+	if job.Phase == PurgePhaseLogs {
+		more, err = data.purgeLogBatch(job, batchSize)
+	} else {
+		more, err = data.purgeTraceBatch(job, batchSize)
+	}
+	if err != nil {
+		r.finishPurgeJob(job, PurgeFailed, err.Error())
+		return job, fmt.Errorf("purge job %d failed in phase %s: %w", id, job.Phase, err)
+	}
+	if !more {
+		r.finishPurgeJob(job, PurgeDone, "")
+		slog.Info("Purge job completed", "job_id", id, "cutoff", job.Cutoff,
+			"logs_purged", job.LogsPurged, "traces_purged", job.TracesPurged)
+	}
+	return job, nil
+}
+
+// finishPurgeJob moves a running job to its final status. A job cancelled meanwhile
+// keeps its cancelled status.
+func (r *Repository) finishPurgeJob(job *PurgeJob, status, errMsg string) {
+	now := time.Now().UTC()
+	res := r.db.Model(&PurgeJob{}).Where("id = ? AND status = ?", job.ID, PurgeRunning).
+		Updates(map[string]interface{}{"status": status, "error": errMsg, "finished_at": now})
+	if res.Error != nil {
+		slog.Error("Failed to finish purge job", "job_id", job.ID, "status", status, "error", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		job.Status, job.Error, job.FinishedAt = status, errMsg, &now
+	}
+}
+
+// savePurgeProgress records the job's phase, cursor and counters.
+func savePurgeProgress(tx *gorm.DB, job *PurgeJob) error {
+	return tx.Model(&PurgeJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"phase":         job.Phase,
+		"last_id":       job.LastID,
+		"logs_purged":   job.LogsPurged,
+		"traces_purged": job.TracesPurged,
+	}).Error
+}
+
+// purgeLogBatch deletes the next batch of expired logs after job.LastID. Once none
+// are left it moves the job on to the traces phase.
+func (r *Repository) purgeLogBatch(job *PurgeJob, batchSize int) (bool, error) {
+	var ids []uint
+	if err := r.primary().Model(&Log{}).Where("timestamp < ? AND id > ?", job.Cutoff, job.LastID).
+		Order("id").Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+		return false, err
+	}
+	if len(ids) == 0 {
+		job.Phase, job.LastID = PurgePhaseTraces, 0
+		return true, savePurgeProgress(r.db, job)
+	}
+	return true, r.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteLogAttributes(tx, tx.Model(&Log{}).Where("id IN ?", ids)); err != nil {
+			return err
+		}
+		res := tx.Where("id IN ?", ids).Delete(&Log{})
+		if res.Error != nil {
+			return res.Error
+		}
+		job.LogsPurged += res.RowsAffected
+		job.LastID = ids[len(ids)-1]
+		return savePurgeProgress(tx, job)
+	})
+}
+
+// purgeTraceBatch deletes the next batch of expired traces after job.LastID the way
+// PurgeTraces does, archiving them first when an archiver is set. It reports false
+// once none are left.
+func (r *Repository) purgeTraceBatch(job *PurgeJob, batchSize int) (bool, error) {
+	var batch []Trace
+	q := r.primary().Where("timestamp < ? AND id > ?", job.Cutoff, job.LastID).Order("id").Limit(batchSize)
+	if r.purgeArchiver != nil {
+		q = q.Preload("Spans").Preload("Logs")
+	} else {
+		q = q.Select("id", "trace_id")
+	}
+	if err := q.Find(&batch).Error; err != nil {
+		return false, err
+	}
+	if len(batch) == 0 {
+		return false, nil
+	}
+	if r.purgeArchiver != nil {
+		if err := r.purgeArchiver(batch); err != nil {
+			return false, fmt.Errorf("failed to archive traces: %w", err)
+		}
+	}
+
+	ids := make([]uint, len(batch))
+	for i, t := range batch {
+		ids[i] = t.ID
+	}
+	return true, r.db.Transaction(func(tx *gorm.DB) error {
+		if r.purgeArchiver != nil {
+			if err := deleteArchivedTraces(tx, batch); err != nil {
+				return err
+			}
+		} else {
+			if err := deleteTraceAnnotations(tx, tx.Model(&Trace{}).Where("id IN ?", ids)); err != nil {
+				return err
+			}
+			if err := deleteSpanLinks(tx, tx.Model(&Trace{}).Where("id IN ?", ids)); err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", ids).Delete(&Trace{}).Error; err != nil {
+				return err
+			}
+		}
+		job.TracesPurged += int64(len(batch))
+		job.LastID = ids[len(ids)-1]
+		return savePurgeProgress(tx, job)
+	})
+}
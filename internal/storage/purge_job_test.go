@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// seedPurgeData stores old logs and traces due for purging and a few recent ones.
+func seedPurgeData(t *testing.T, repo *Repository, oldLogs, oldTraces int) {
+	t.Helper()
+	old, now := time.Now().Add(-30*24*time.Hour), time.Now()
+	var logs []Log
+	for i := range oldLogs {
+		logs = append(logs, Log{ServiceName: "api", Severity: "INFO", Body: CompressedText(fmt.Sprintf("old %d", i)), Timestamp: old})
+	}
+	logs = append(logs, Log{ServiceName: "api", Severity: "INFO", Body: "recent", Timestamp: now})
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	var traces []Trace
+	for i := range oldTraces {
+		traces = append(traces, Trace{TraceID: fmt.Sprintf("old-%d", i), ServiceName: "api", Timestamp: old})
+	}
+	traces = append(traces, Trace{TraceID: "recent", ServiceName: "api", Timestamp: now})
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openRepository(t *testing.T, path string) *Repository {
+	t.Helper()
+	db, err := NewDatabase("sqlite", path)
+	if err != nil {
+		t.Fatalf("NewDatabase() error = %v", err)
+	}
+	if err := createSchema(db, "sqlite"); err != nil {
+		t.Fatalf("createSchema() error = %v", err)
+	}
+	return &Repository{db: db, driver: "sqlite"}
+}
+
+func TestPurgeJobResumesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "purge.db")
+	repo := openRepository(t, path)
+	seedPurgeData(t, repo, 25, 7)
+
+	cutoff := time.Now().Add(-24 * time.Hour)
+	if n, err := repo.CountPurgeable(cutoff); err != nil || n != 32 {
+		t.Fatalf("CountPurgeable() = %d, %v; want 32", n, err)
+	}
+	job, err := repo.CreatePurgeJob(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if job, err = repo.RunPurgeBatch(job.ID, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != PurgeRunning || job.Phase != PurgePhaseLogs || job.LogsPurged != 20 {
+		t.Fatalf("after two batches: %+v, want 20 logs purged and still running", job)
+	}
+	repo.Close()
+
+	// The restarted process finds the interrupted job with its saved progress.
+	repo = openRepository(t, path)
+	defer repo.Close()
+	jobs, err := repo.ListUnfinishedPurgeJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].LogsPurged != 20 || jobs[0].LastID == 0 {
+		t.Fatalf("unfinished jobs = %+v, want the one job with its progress", jobs)
+	}
+	for i := 0; !job.Finished(); i++ {
+		if i > 10 {
+			t.Fatal("job did not finish")
+		}
+		if job, err = repo.RunPurgeBatch(jobs[0].ID, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != PurgeDone || job.LogsPurged != 25 || job.TracesPurged != 7 || job.FinishedAt == nil {
+		t.Errorf("finished job = %+v, want done with 25 logs and 7 traces", job)
+	}
+
+	var logs, traces int64
+	repo.db.Model(&Log{}).Count(&logs)
+	repo.db.Model(&Trace{}).Count(&traces)
+	if logs != 1 || traces != 1 {
+		t.Errorf("left %d logs and %d traces, want the recent one of each", logs, traces)
+	}
+	if jobs, _ = repo.ListUnfinishedPurgeJobs(); len(jobs) != 0 {
+		t.Errorf("unfinished jobs = %+v, want none", jobs)
+	}
+}
+
+func TestCancelPurgeJob(t *testing.T) {
+	repo := newTestRepository(t)
+	seedPurgeData(t, repo, 15, 0)
+
+	job, err := repo.CreatePurgeJob(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RunPurgeBatch(job.ID, 10); err != nil {
+		t.Fatal(err)
+	}
+	if job, err = repo.CancelPurgeJob(job.ID); err != nil || job.Status != PurgeCancelled {
+		t.Fatalf("CancelPurgeJob() = %+v, %v", job, err)
+	}
+	if job, err = repo.RunPurgeBatch(job.ID, 10); err != nil || job.Status != PurgeCancelled || job.LogsPurged != 10 {
+		t.Errorf("batch after cancel = %+v, %v; want the job left cancelled", job, err)
+	}
+	if _, err := repo.CancelPurgeJob(job.ID); !errors.Is(err, ErrPurgeJobFinished) {
+		t.Errorf("second cancel: err = %v, want ErrPurgeJobFinished", err)
+	}
+	if _, err := repo.CancelPurgeJob(999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("unknown job: err = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestPurgeJobTenantScope(t *testing.T) {
+	repo := newTestRepository(t)
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	for _, tn := range []string{"acme", "globex"} {
+		if err := repo.ForTenant(tn).BatchCreateLogs([]Log{{ServiceName: "api", Body: CompressedText(tn), Timestamp: old}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job, err := repo.ForTenant("acme").CreatePurgeJob(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ForTenant("globex").GetPurgeJob(job.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("other tenant's job: err = %v, want ErrRecordNotFound", err)
+	}
+	// The worker runs jobs through the unscoped repository; the job's tenant still applies.
+	for !job.Finished() {
+		if job, err = repo.RunPurgeBatch(job.ID, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var left []Log
+	repo.db.Find(&left)
+	if job.LogsPurged != 1 || len(left) != 1 || left[0].TenantID != "globex" {
+		t.Errorf("purged %d logs, left %+v; want only acme's log purged", job.LogsPurged, left)
+	}
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize bounds each DELETE so SQLite releases the write lock between batches.
+const purgeBatchSize = 5000
+
+// ServicePurgeResult reports how many rows PurgeService removed per table.
+type ServicePurgeResult struct {
+	Traces        int64 `json:"traces"`
+	Spans         int64 `json:"spans"`
+	Logs          int64 `json:"logs"`
+	MetricBuckets int64 `json:"metric_buckets"`
+}
+
+// PurgeService hard-deletes all traces, spans, logs and metric buckets of a single service.
+// If before is non-zero, only rows older than it are removed. Deletes run in batches of
+// purgeBatchSize so concurrent ingestion is not blocked for the whole purge.
+func (r *Repository) PurgeService(service string, before time.Time) (*ServicePurgeResult, error) {
+	if service == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+
+	res := &ServicePurgeResult{}
+	var err error
+
+	if res.Spans, err = r.purgeInBatches(&Span{}, service, "start_time", before); err != nil {
+		return res, fmt.Errorf("failed to purge spans: %w", err)
+	}
+	if res.Logs, err = r.purgeInBatches(&Log{}, service, "timestamp", before); err != nil {
+		return res, fmt.Errorf("failed to purge logs: %w", err)
+	}
+	if res.Traces, err = r.purgeInBatches(&Trace{}, service, "timestamp", before); err != nil {
+		return res, fmt.Errorf("failed to purge traces: %w", err)
+	}
+	if res.MetricBuckets, err = r.purgeInBatches(&MetricBucket{}, service, "time_bucket", before); err != nil {
+		return res, fmt.Errorf("failed to purge metric buckets: %w", err)
+	}
+
+	slog.Info("Service purged", "service", service, "before", before,
+		"traces", res.Traces, "spans", res.Spans, "logs", res.Logs, "metric_buckets", res.MetricBuckets)
+	return res, nil
+}
+
+// purgeInBatches repeatedly selects up to purgeBatchSize primary keys matching the
+// service (and optional time bound) and deletes them until none remain.
+func (r *Repository) purgeInBatches(model interface{}, service, timeColumn string, before time.Time) (int64, error) {
+	var total int64
+	for {
+		q := r.primary().Unscoped().Model(model).Where("service_name = ?", service)
+		if !before.IsZero() {
+			q = q.Where(timeColumn+" < ?", before)
+		}
+
+		var ids []uint
+		if err := q.Limit(purgeBatchSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		switch model.(type) {
+		case *Log:
+			if err := deleteLogAttributes(r.db, r.db.Model(&Log{}).Where("id IN ?", ids)); err != nil {
+				return total, err
+			}
+		case *Trace:
+			if err := deleteTraceAnnotations(r.db, r.db.Unscoped().Model(&Trace{}).Where("id IN ?", ids)); err != nil {
+				return total, err
+			}
+			if err := deleteSpanLinks(r.db, r.db.Unscoped().Model(&Trace{}).Where("id IN ?", ids)); err != nil {
+				return total, err
+			}
+		}
+		result := r.db.Unscoped().Where("id IN ?", ids).Delete(model)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+
+		if len(ids) < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// purgeTracesArchived hands each batch of expired traces to the purge archiver and only
+// deletes it once the archive has been written. An archive failure aborts the purge,
+// leaving that batch and everything after it in place.
+func (r *Repository) purgeTracesArchived(olderThan time.Time) (int64, error) {
+	var total int64
+	for {
+		var batch []Trace
+		if err := r.primary().Preload("Spans").Preload("Logs").
+			Where("timestamp < ?", olderThan).
+			Order("id").Limit(purgeBatchSize).
+			Find(&batch).Error; err != nil {
+			return total, fmt.Errorf("failed to load traces for purge: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		if err := r.purgeArchiver(batch); err != nil {
+			return total, fmt.Errorf("failed to archive traces, purge aborted: %w", err)
+		}
+
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			return deleteArchivedTraces(tx, batch)
+		})
+		if err != nil {
+			return total, fmt.Errorf("failed to purge traces: %w", err)
+		}
+		total += int64(len(batch))
+
+		if len(batch) < purgeBatchSize {
+			break
+		}
+	}
+	slog.Info("Traces archived and purged", "count", total, "cutoff", olderThan)
+	return total, nil
+}
+
+// deleteArchivedTraces hard-deletes archived traces together with their spans, logs,
+// annotations and links, all of which the archive holds.
+func deleteArchivedTraces(tx *gorm.DB, batch []Trace) error {
+	ids := make([]uint, len(batch))
+	traceIDs := make([]string, len(batch))
+	for i, t := range batch {
+		ids[i] = t.ID
+		traceIDs[i] = t.TraceID
+	}
+	if err := tx.Where("trace_id IN ?", traceIDs).Delete(&Span{}).Error; err != nil {
+		return err
+	}
+	if err := deleteLogAttributes(tx, tx.Model(&Log{}).Where("trace_id IN ?", traceIDs)); err != nil {
+		return err
+	}
+	if err := tx.Where("trace_id IN ?", traceIDs).Delete(&Log{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("trace_id IN ?", traceIDs).Delete(&TraceAnnotation{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("trace_id IN ?", traceIDs).Delete(&SpanLink{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&Trace{}).Error
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPurgeService(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	var traces []Trace
+	var spans []Span
+	for i := 0; i < 3; i++ {
+		for _, svc := range []string{"junk", "keep"} {
+			id := fmt.Sprintf("%s-%d", svc, i)
+			ts := now.Add(-time.Duration(i) * time.Hour)
+			traces = append(traces, Trace{TraceID: id, ServiceName: svc, Timestamp: ts})
+			spans = append(spans, Span{TraceID: id, SpanID: id, ServiceName: svc, StartTime: ts})
+		}
+	}
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the two older junk rows fall before the cutoff.
+	res, err := repo.PurgeService("junk", now.Add(-30*time.Minute))
+	if err != nil {
+		t.Fatalf("PurgeService() error = %v", err)
+	}
+	if res.Traces != 2 || res.Spans != 2 {
+		t.Errorf("result = %+v, want 2 traces and 2 spans", res)
+	}
+
+	res, err = repo.PurgeService("junk", time.Time{})
+	if err != nil {
+		t.Fatalf("PurgeService() error = %v", err)
+	}
+	if res.Traces != 1 || res.Spans != 1 {
+		t.Errorf("result = %+v, want remaining 1 trace and 1 span", res)
+	}
+
+	var remaining int64
+	repo.db.Unscoped().Model(&Trace{}).Count(&remaining)
+	if remaining != 3 {
+		t.Errorf("remaining traces = %d, want 3 (other service untouched)", remaining)
+	}
+
+	if _, err := repo.PurgeService("", time.Time{}); err == nil {
+		t.Error("expected error for empty service")
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListServiceQuotas returns all configured quotas ordered by service.
+func (r *Repository) ListServiceQuotas() ([]ServiceQuota, error) {
+	var quotas []ServiceQuota
+	if err := r.db.Order("service_name").Find(&quotas).Error; err != nil {
+		return nil, fmt.Errorf("failed to list service quotas: %w", err)
+	}
+	return quotas, nil
+}
+
+// UpsertServiceQuota creates or replaces the quota of q.ServiceName.
+func (r *Repository) UpsertServiceQuota(q *ServiceQuota) error {
+	if q.ServiceName == "" {
+		return fmt.Errorf("service name is required")
+	}
+	if err := r.db.Save(q).Error; err != nil {
+		return fmt.Errorf("failed to save service quota: %w", err)
+	}
+	return nil
+}
+
+// DeleteServiceQuota removes the quota of service. It returns gorm.ErrRecordNotFound
+// when the service has none.
+func (r *Repository) DeleteServiceQuota(service string) error {
+	res := r.db.Where("service_name = ?", service).Delete(&ServiceQuota{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete service quota: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("failed to delete service quota: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// GetQuotaUsage returns the persisted usage counters of every service for day
+// (YYYY-MM-DD, UTC).
+func (r *Repository) GetQuotaUsage(day string) ([]QuotaUsage, error) {
+	var usage []QuotaUsage
+	if err := r.db.Where("day = ?", day).Order("service_name").Find(&usage).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return usage, nil
+}
+
+// SaveQuotaUsage writes usage counters, replacing any stored row for the same
+// service and day.
+func (r *Repository) SaveQuotaUsage(usage []QuotaUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "service_name"}, {Name: "day"}},
+		DoUpdates: clause.AssignmentColumns([]string{"spans", "rejected_spans", "logs", "rejected_logs"}),
+	}).Create(&usage).Error
+	if err != nil {
+		return fmt.Errorf("failed to save quota usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// ServiceRemapResult reports how many rows RemapService renamed per table.
+type ServiceRemapResult struct {
+	Traces        int64 `json:"traces"`
+	Spans         int64 `json:"spans"`
+	Logs          int64 `json:"logs"`
+	MetricBuckets int64 `json:"metric_buckets"`
+}
+
+// RemapService renames a service across traces, spans, logs and metric buckets. It is the
+// retroactive counterpart of INGEST_SERVICE_ALIASES. Updates run in batches of
+// purgeBatchSize so ingestion keeps flowing while a large service is renamed.
+func (r *Repository) RemapService(from, to string) (*ServiceRemapResult, error) {
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("both source and target service names are required")
+	}
+	if from == to {
+		return nil, fmt.Errorf("source and target service names are identical")
+	}
+
+	res := &ServiceRemapResult{}
+	var err error
+
+	if res.Traces, err = r.remapInBatches(&Trace{}, from, to); err != nil {
+		return res, fmt.Errorf("failed to remap traces: %w", err)
+	}
+	if res.Spans, err = r.remapInBatches(&Span{}, from, to); err != nil {
+		return res, fmt.Errorf("failed to remap spans: %w", err)
+	}
+	if res.Logs, err = r.remapInBatches(&Log{}, from, to); err != nil {
+		return res, fmt.Errorf("failed to remap logs: %w", err)
+	}
+	if res.MetricBuckets, err = r.remapInBatches(&MetricBucket{}, from, to); err != nil {
+		return res, fmt.Errorf("failed to remap metric buckets: %w", err)
+	}
+
+	slog.Info("Service remapped", "from", from, "to", to,
+		"traces", res.Traces, "spans", res.Spans, "logs", res.Logs, "metric_buckets", res.MetricBuckets)
+	return res, nil
+}
+
+// remapInBatches repeatedly selects up to purgeBatchSize primary keys still carrying the
+// old service name and rewrites them until none remain.
+func (r *Repository) remapInBatches(model interface{}, from, to string) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		if err := r.primary().Unscoped().Model(model).Where("service_name = ?", from).
+			Limit(purgeBatchSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		result := r.db.Unscoped().Model(model).Where("id IN ?", ids).Update("service_name", to)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+
+		if len(ids) < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemapService(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "t1", ServiceName: "payments", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]Span{{TraceID: "t1", SpanID: "s1", ServiceName: "payments", StartTime: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs([]Log{{TraceID: "t1", ServiceName: "payments", Body: "ok", Timestamp: now}, {ServiceName: "orders", Body: "ok", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.RemapService("payments", "payment-service")
+	if err != nil {
+		t.Fatalf("RemapService() error = %v", err)
+	}
+	if res.Traces != 1 || res.Spans != 1 || res.Logs != 1 {
+		t.Errorf("RemapService() = %+v, want 1 trace, 1 span, 1 log", res)
+	}
+
+	var n int64
+	repo.db.Model(&Log{}).Where("service_name = ?", "orders").Count(&n)
+	if n != 1 {
+		t.Errorf("unrelated service was touched: orders logs = %d", n)
+	}
+	repo.db.Model(&Span{}).Where("service_name = ?", "payments").Count(&n)
+	if n != 0 {
+		t.Errorf("spans still under old name: %d", n)
+	}
+
+	if _, err := repo.RemapService("a", "a"); err == nil {
+		t.Error("RemapService() with identical names should fail")
+	}
+}
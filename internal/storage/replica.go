@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// ReplicaCheckInterval is how often MonitorReplica measures the replica's lag.
+const ReplicaCheckInterval = 5 * time.Second
+
+// readPrimarySetting is the statement setting that keeps a read on the primary when a
+// read replica is set.
+const readPrimarySetting = "otelcontext:read_primary"
+
+// replicaPool is the connection pool read statements are switched to when a read
+// replica is set. Queries go to the replica while it is healthy, and to the primary
+// when it is not or a query on it fails; statements that write always go to the
+// primary.
+type replicaPool struct {
+	primary gorm.ConnPool
+	replica *sql.DB
+	db      *gorm.DB // the replica, for the heartbeat read
+	driver  string
+	maxLag  time.Duration
+	now     func() time.Time
+
+	healthy atomic.Bool
+	lagNs   atomic.Int64
+}
+
+func (p *replicaPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.primary.PrepareContext(ctx, query)
+}
+
+func (p *replicaPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.primary.ExecContext(ctx, query, args...)
+}
+
+func (p *replicaPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if p.healthy.Load() {
+		rows, err := p.replica.QueryContext(ctx, query, args...)
+		if err == nil || ctx.Err() != nil {
+			return rows, err
+		}
+		p.fail(err)
+	}
+	return p.primary.QueryContext(ctx, query, args...)
+}
+
+func (p *replicaPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if p.healthy.Load() {
+		row := p.replica.QueryRowContext(ctx, query, args...)
+		if row.Err() == nil || ctx.Err() != nil {
+			return row
+		}
+		p.fail(row.Err())
+	}
+	return p.primary.QueryRowContext(ctx, query, args...)
+}
+
+// fail sends reads to the primary until the next check finds the replica healthy.
+func (p *replicaPool) fail(err error) {
+	if p.healthy.Swap(false) {
+		slog.Warn("Read replica query failed, reading from the primary", "error", err)
+	}
+}
+
+// registerReplicaRouting switches the read statements of db to p. Statements in a
+// transaction, or marked with readPrimarySetting, stay on the primary.
+func registerReplicaRouting(db *gorm.DB, p *replicaPool) error {
+	route := func(d *gorm.DB) {
+		// In a transaction the pool is the *sql.Tx.
+		if d.Statement.ConnPool != p.primary {
+			return
+		}
+		if v, ok := d.Get(readPrimarySetting); ok && v == true {
+			return
+		}
+		d.Statement.ConnPool = p
+	}
+	// Drivers that report errors while reading rows, such as SQLite, get past the
+	// pool's fallback; run those queries again on the primary.
+	retry := func(d *gorm.DB) {
+		if d.Statement.ConnPool != gorm.ConnPool(p) || d.Error == nil ||
+			errors.Is(d.Error, gorm.ErrRecordNotFound) || d.Statement.Context.Err() != nil {
+			return
+		}
+		p.fail(d.Error)
+		d.Error = nil
+		d.Statement.ConnPool = p.primary
+		callbacks.Query(d)
+	}
+	// Put the primary back, so a later write built on the same statement cannot be
+	// sent to the replica pool.
+	restore := func(d *gorm.DB) {
+		if d.Statement.ConnPool == gorm.ConnPool(p) {
+			d.Statement.ConnPool = p.primary
+		}
+	}
+	query, row := db.Callback().Query(), db.Callback().Row()
+	for _, err := range []error{
+		query.Before("gorm:query").Register("replica:route", route),
+		query.After("gorm:query").Register("replica:retry", retry),
+		query.After("gorm:after_query").Register("replica:restore", restore),
+		row.Before("gorm:row").Register("replica:route_row", route),
+		row.After("gorm:row").Register("replica:restore_row", restore),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register read replica routing: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetReadReplica sends the repository's reads to the database at dsn, a replica of
+// the primary on the same driver. Writes, reads in a transaction and the reads that
+// decide what to write next stay on the primary. Reads fall back to the primary while
+// the replica fails or lags more than maxLag; call MonitorReplica to keep checking.
+func (r *Repository) SetReadReplica(dsn string, maxLag time.Duration) error {
+	primary, err := r.db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	replicaDB, err := NewDatabase(r.driver, dsn)
+	if err != nil {
+		return fmt.Errorf("read replica: %w", err)
+	}
+	replica, err := replicaDB.DB()
+	if err != nil {
+		return fmt.Errorf("read replica: %w", err)
+	}
+	p := &replicaPool{primary: primary, replica: replica, db: replicaDB, driver: r.driver, maxLag: maxLag, now: time.Now}
+	if err := registerReplicaRouting(r.db, p); err != nil {
+		replica.Close()
+		return err
+	}
+	r.replica = p
+	r.CheckReplica(context.Background())
+	return nil
+}
+
+// primary returns a session whose reads stay on the primary. Reads that pick the
+// rows to update or delete next use it: a lagging replica would hand back rows
+// already dealt with.
+func (r *Repository) primary() *gorm.DB {
+	if r.replica == nil {
+		return r.db
+	}
+	return r.db.Set(readPrimarySetting, true)
+}
+
+// CheckReplica measures the replica's lag and sends reads to it only while it is
+// within the maximum. It is a no-op without a replica.
+func (r *Repository) CheckReplica(ctx context.Context) {
+	p := r.replica
+	if p == nil {
+		return
+	}
+	lag, err := r.replicaLag(ctx)
+	ok := err == nil && lag <= p.maxLag
+	p.lagNs.Store(int64(lag))
+	if was := p.healthy.Swap(ok); was != ok {
+		switch {
+		case ok:
+			slog.Info("Read replica caught up, reading from it again", "lag", lag)
+		case err != nil:
+			slog.Warn("Read replica check failed, reading from the primary", "error", err)
+		default:
+			slog.Warn("Read replica lags behind, reading from the primary", "lag", lag, "max_lag", p.maxLag)
+		}
+	}
+}
+
+// ReplicaStatus reports whether a read replica is set, whether reads currently go to
+// it, and its last measured lag.
+func (r *Repository) ReplicaStatus() (configured, healthy bool, lag time.Duration) {
+	if r.replica == nil {
+		return false, false, 0
+	}
+	return true, r.replica.healthy.Load(), time.Duration(r.replica.lagNs.Load())
+}
+
+// MonitorReplica checks the replica every interval until ctx is cancelled.
+func (r *Repository) MonitorReplica(ctx context.Context, interval time.Duration) {
+	if r.replica == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckReplica(ctx)
+		}
+	}
+}
+
+// replicaLag returns how far the replica is behind the primary. On MySQL the
+// replica's own report is used when it has one; otherwise the primary writes a
+// heartbeat and the lag is the age of the heartbeat the replica has.
+func (r *Repository) replicaLag(ctx context.Context) (time.Duration, error) {
+	p := r.replica
+	if strings.ToLower(p.driver) == "mysql" {
+		if lag, ok, err := mysqlReplicaLag(ctx, p.replica); ok || err != nil {
+			return lag, err
+		}
+	}
+
+	beat := ReplicaHeartbeat{ID: 1, BeatAt: p.now().UTC()}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&beat).Error; err != nil {
+		return 0, fmt.Errorf("failed to write replica heartbeat: %w", err)
+	}
+	var seen ReplicaHeartbeat
+	if err := p.db.WithContext(ctx).First(&seen, 1).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errors.New("no replica heartbeat yet")
+		}
+		return 0, fmt.Errorf("failed to read replica heartbeat: %w", err)
+	}
+	lag := beat.BeatAt.Sub(seen.BeatAt)
+	if lag < 0 {
+		lag = 0
+	}
+	return lag, nil
+}
+
+// mysqlReplicaLag reads Seconds_Behind_Source from SHOW REPLICA STATUS (MySQL 8.0.22+)
+// or Seconds_Behind_Master from SHOW SLAVE STATUS. ok is false when neither is
+// available, e.g. without the REPLICATION CLIENT privilege or on managed replicas.
+func mysqlReplicaLag(ctx context.Context, db *sql.DB) (lag time.Duration, ok bool, err error) {
+	for _, stmt := range []string{"SHOW REPLICA STATUS", "SHOW SLAVE STATUS"} {
+		rows, qerr := db.QueryContext(ctx, stmt)
+		if qerr != nil {
+			continue
+		}
+		lag, ok, err = scanSecondsBehind(rows)
+		rows.Close()
+		if ok || err != nil {
+			return lag, ok, err
+		}
+	}
+	return 0, false, nil
+}
+
+func scanSecondsBehind(rows *sql.Rows) (time.Duration, bool, error) {
+	cols, err := rows.Columns()
+	if err != nil || !rows.Next() {
+		return 0, false, nil
+	}
+	vals := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return 0, false, nil
+	}
+	for i, col := range cols {
+		if col != "Seconds_Behind_Source" && col != "Seconds_Behind_Master" {
+			continue
+		}
+		if !vals[i].Valid {
+			return 0, true, errors.New("replication is not running")
+		}
+		secs, err := strconv.ParseInt(vals[i].String, 10, 64)
+		if err != nil {
+			return 0, false, nil
+		}
+		return time.Duration(secs) * time.Second, true, nil
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newReplicatedRepository returns a repository on a primary SQLite file with reads
+// sent to a second file standing in for its replica, and the replica's handle. The
+// files hold different rows, so each read shows where it went.
+func newReplicatedRepository(t *testing.T) (*Repository, *gorm.DB) {
+	t.Helper()
+	repo := newTestRepository(t)
+	path := filepath.Join(t.TempDir(), "replica.db")
+	replica, err := NewDatabase("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createSchema(replica, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if db, err := replica.DB(); err == nil {
+			db.Close()
+		}
+	})
+
+	now := time.Now().UTC()
+	if err := repo.db.Create(&Trace{TraceID: "on-primary", ServiceName: "api", Timestamp: now}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Create(&Trace{TraceID: "on-replica", ServiceName: "api", Timestamp: now}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Replication is up to date.
+	if err := replica.Create(&ReplicaHeartbeat{ID: 1, BeatAt: now}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetReadReplica(path, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	return repo, replica
+}
+
+// readsFrom reports which database GetTrace read.
+func readsFrom(t *testing.T, r *Repository) string {
+	t.Helper()
+	if _, err := r.GetTrace("on-replica"); err == nil {
+		return "replica"
+	}
+	if _, err := r.GetTrace("on-primary"); err == nil {
+		return "primary"
+	}
+	t.Fatal("trace found in neither database")
+	return ""
+}
+
+func TestReadReplicaSplitsReadsAndWrites(t *testing.T) {
+	repo, replica := newReplicatedRepository(t)
+	if configured, healthy, _ := repo.ReplicaStatus(); !configured || !healthy {
+		t.Fatalf("replica configured=%v healthy=%v, want both", configured, healthy)
+	}
+	if got := readsFrom(t, repo); got != "replica" {
+		t.Errorf("read from the %s, want the replica", got)
+	}
+	if got := readsFrom(t, repo.withTenant("default")); got != "replica" {
+		t.Errorf("tenant repository read from the %s, want the replica", got)
+	}
+
+	// Writes go to the primary.
+	if err := repo.BatchCreateLogs([]Log{{ServiceName: "api", Body: "hello", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.db.Model(&Trace{}).Where("trace_id = ?", "on-primary").Update("service_name", "renamed").Error; err != nil {
+		t.Fatal(err)
+	}
+	var n, logs, renamed int64
+	repo.primary().Model(&Log{}).Count(&logs)
+	repo.primary().Model(&Trace{}).Where("service_name = ?", "renamed").Count(&renamed)
+	replica.Model(&Log{}).Count(&n)
+	if logs != 1 || renamed != 1 || n != 0 {
+		t.Errorf("primary has %d logs and %d renamed traces, replica %d logs; want 1, 1, 0", logs, renamed, n)
+	}
+
+	// Reads that decide what to write, and reads in a transaction, use the primary.
+	if ids, _ := repo.ExistingTraceIDs([]string{"on-primary", "on-replica"}); !ids["on-primary"] || ids["on-replica"] {
+		t.Errorf("ExistingTraceIDs = %v, want the primary's", ids)
+	}
+	repo.db.Transaction(func(tx *gorm.DB) error {
+		var tr Trace
+		if err := tx.Where("trace_id = ?", "on-primary").First(&tr).Error; err != nil {
+			t.Errorf("read in a transaction: %v, want the primary's trace", err)
+		}
+		return nil
+	})
+}
+
+func TestReadReplicaFallsBack(t *testing.T) {
+	repo, replica := newReplicatedRepository(t)
+	ctx := context.Background()
+
+	// The replica stops applying changes: its heartbeat falls behind.
+	replica.Model(&ReplicaHeartbeat{}).Where("id = 1").Update("beat_at", time.Now().UTC().Add(-2*time.Minute))
+	repo.CheckReplica(ctx)
+	if _, healthy, lag := repo.ReplicaStatus(); healthy || lag < 2*time.Minute {
+		t.Errorf("healthy=%v lag=%v, want a lagging replica", healthy, lag)
+	}
+	if got := readsFrom(t, repo); got != "primary" {
+		t.Errorf("lagging replica: read from the %s, want the primary", got)
+	}
+
+	// It catches up.
+	replica.Model(&ReplicaHeartbeat{}).Where("id = 1").Update("beat_at", time.Now().UTC())
+	repo.CheckReplica(ctx)
+	if got := readsFrom(t, repo); got != "replica" {
+		t.Errorf("caught up: read from the %s, want the replica", got)
+	}
+
+	// A failing replica query is retried on the primary, and later reads stay there.
+	if err := replica.Exec("DROP TABLE traces").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetTrace("on-primary"); err != nil {
+		t.Errorf("GetTrace after a replica failure: %v, want the primary's trace", err)
+	}
+	if _, healthy, _ := repo.ReplicaStatus(); healthy {
+		t.Error("replica still healthy after a failed query")
+	}
+}
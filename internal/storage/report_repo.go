@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ServiceLatency is one service's trace latency at a percentile over a time range.
+type ServiceLatency struct {
+	ServiceName  string  `json:"service_name"`
+	Count        int64   `json:"count"`
+	PercentileMs float64 `json:"percentile_ms"`
+}
+
+// GetServiceLatencyPercentiles returns, per service, the trace duration at percentile
+// p (0-100) for traces started in [start, end). One grouped query counts the traces
+// of every service per baseline bucket, and each percentile is interpolated within
+// its bucket, so no durations are sorted or loaded into memory.
+func (r *Repository) GetServiceLatencyPercentiles(start, end time.Time, p float64) ([]ServiceLatency, error) {
+	var buckets []struct {
+		ServiceName string
+		Bucket      int
+		Count       int64
+	}
+	if err := r.db.Model(&Trace{}).
+		Select("service_name, "+baselineBucketExpr+" AS bucket, COUNT(*) AS count").
+		Where("timestamp >= ? AND timestamp < ?", start, end).
+		Group("service_name, " + baselineBucketExpr).
+		Scan(&buckets).Error; err != nil {
+		return nil, fmt.Errorf("failed to get service latency buckets: %w", err)
+	}
+
+	counts := make(map[string][]int64)
+	for _, b := range buckets {
+		if b.Bucket < 0 || b.Bucket > len(baselineBoundsUs) {
+			continue
+		}
+		if counts[b.ServiceName] == nil {
+			counts[b.ServiceName] = make([]int64, len(baselineBoundsUs)+1)
+		}
+		counts[b.ServiceName][b.Bucket] += b.Count
+	}
+	rows := make([]ServiceLatency, 0, len(counts))
+	for service, c := range counts {
+		h := newOperationBaseline(c)
+		rows = append(rows, ServiceLatency{ServiceName: service, Count: h.Count, PercentileMs: float64(h.percentileUs(p)) / 1000.0})
+	}
+	slices.SortFunc(rows, func(a, b ServiceLatency) int { return strings.Compare(a.ServiceName, b.ServiceName) })
+	return rows, nil
+}
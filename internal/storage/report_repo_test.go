@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGetServiceLatencyPercentiles(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	var traces []Trace
+	for i := 1; i <= 100; i++ {
+		traces = append(traces, Trace{TraceID: fmt.Sprintf("c%d", i), ServiceName: "checkout",
+			Duration: int64(i) * 1000, Timestamp: now.Add(-time.Minute)})
+	}
+	traces = append(traces,
+		Trace{TraceID: "p1", ServiceName: "payments", Duration: 5000, Timestamp: now.Add(-time.Minute)},
+		Trace{TraceID: "old", ServiceName: "payments", Duration: 900000, Timestamp: now.Add(-2 * time.Hour)},
+	)
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatalf("BatchCreateTraces() error = %v", err)
+	}
+
+	rows, err := repo.GetServiceLatencyPercentiles(now.Add(-time.Hour), now, 99)
+	if err != nil {
+		t.Fatalf("GetServiceLatencyPercentiles() error = %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d services, want 2: %+v", len(rows), rows)
+	}
+	// Histogram estimates are within a bucket width (25%) of the exact values.
+	if c := rows[0]; c.ServiceName != "checkout" || c.Count != 100 || math.Abs(c.PercentileMs-99) > 99*0.25 {
+		t.Errorf("checkout = %+v, want 100 traces and p99 about 99ms", c)
+	}
+	if p := rows[1]; p.ServiceName != "payments" || p.Count != 1 || math.Abs(p.PercentileMs-5) > 5*0.25 {
+		t.Errorf("payments = %+v, want 1 trace and p99 about 5ms (older trace excluded)", p)
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -12,12 +13,45 @@ import (
 
 // Repository wraps the GORM database handle for all data access operations.
 type Repository struct {
-	db      *gorm.DB
-	driver  string
-	metrics *telemetry.Metrics
+	db            *gorm.DB
+	driver        string
+	metrics       *telemetry.Metrics
+	purgeArchiver func([]Trace) error    // optional; called by PurgeTraces before each batch is deleted
+	logAttrKeys   map[string]bool        // log attribute keys indexed in log_attributes
+	queryTimeout  time.Duration          // bound on *Context reads; 0 = none
+	tenant        string                 // set by ForTenant; "" = all tenants
+	environment   string                 // set by ForEnvironment; "" = all environments
+	batchSizers   map[string]*BatchSizer // insert batch size per table; nil = driver default
+	clock         func() time.Time       // times insert batches; nil = time.Now
+	replica       *replicaPool           // set by SetReadReplica; nil = reads on the primary
+	slowQueries   *SlowQueryLog          // set by SetSlowQueryLog; nil = not kept
 }
 
-// NewRepository initializes the database connection using environment variables and migrates the schema.
+// SetQueryTimeout bounds every query made by the *Context read methods. The deadline
+// is applied on top of the caller's context, so whichever ends first wins. Postgres
+// and MySQL cancel the statement on the server; SQLite stops between result rows.
+func (r *Repository) SetQueryTimeout(d time.Duration) {
+	r.queryTimeout = d
+}
+
+// withContext returns a session bound to ctx and the configured query timeout.
+// The returned cancel must be called once the queries are done.
+func (r *Repository) withContext(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if r.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.queryTimeout)
+	}
+	return r.db.WithContext(r.scopeContext(ctx)), cancel
+}
+
+// SetPurgeArchiver installs a hook that receives every batch of traces (with spans and logs
+// preloaded) before PurgeTraces deletes it. If the hook fails, the batch is kept and the purge stops.
+func (r *Repository) SetPurgeArchiver(fn func([]Trace) error) {
+	r.purgeArchiver = fn
+}
+
+// NewRepository initializes the database connection using environment variables and
+// applies pending schema migrations.
 func NewRepository(metrics *telemetry.Metrics) (*Repository, error) {
 	driver := os.Getenv("DB_DRIVER")
 	dsn := os.Getenv("DB_DSN")
@@ -32,33 +66,16 @@ func NewRepository(metrics *telemetry.Metrics) (*Repository, error) {
 		driver = "sqlite"
 	}
 
-	if err := AutoMigrateModels(db, driver); err != nil {
+	if _, err := MigrateSchema(db, driver); err != nil {
 		return nil, err
 	}
 
-	// Register GORM Callback for DB Latency Metrics
-	if metrics != nil {
-		db.Callback().Query().Before("gorm:query").Register("telemetry:before_query", func(d *gorm.DB) {
-			d.Set("telemetry:start_time", time.Now())
-		})
-		db.Callback().Query().After("gorm:query").Register("telemetry:after_query", func(d *gorm.DB) {
-			if start, ok := d.Get("telemetry:start_time"); ok {
-				duration := time.Since(start.(time.Time)).Seconds()
-				metrics.ObserveDBLatency(duration)
-			}
-		})
-		db.Callback().Create().Before("gorm:create").Register("telemetry:before_create", func(d *gorm.DB) {
-			d.Set("telemetry:start_time", time.Now())
-		})
-		db.Callback().Create().After("gorm:create").Register("telemetry:after_create", func(d *gorm.DB) {
-			if start, ok := d.Get("telemetry:start_time"); ok {
-				duration := time.Since(start.(time.Time)).Seconds()
-				metrics.ObserveDBLatency(duration)
-			}
-		})
-	}
-
-	return &Repository{db: db, driver: driver, metrics: metrics}, nil
+	// Register GORM callbacks for DB latency metrics and the slow query log
+	repo := &Repository{db: db, driver: driver, metrics: metrics}
+	if err := repo.registerTelemetry(); err != nil {
+		return nil, err
+	}
+	return repo, nil
 }
 
 // Stats aggregation and DB management
@@ -100,10 +117,10 @@ func (r *Repository) GetStats() (map[string]interface{}, error) {
 
 	// Estimate DB size (SQLite only; 0 for other drivers).
 	var dbSizeMB float64
-	if r.driver == "sqlite" {
+	if r.driver == "sqlite" && r.tenant == "" { // the file holds every tenant's data
 		var pageCount, pageSize int64
-		r.db.Raw("PRAGMA page_count").Scan(&pageCount)
-		r.db.Raw("PRAGMA page_size").Scan(&pageSize)
+		r.primary().Raw("PRAGMA page_count").Scan(&pageCount)
+		r.primary().Raw("PRAGMA page_size").Scan(&pageSize)
 		dbSizeMB = float64(pageCount*pageSize) / (1024 * 1024)
 	}
 
@@ -138,6 +155,9 @@ func (r *Repository) Close() error {
 	if err != nil {
 		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
 	}
+	if r.replica != nil {
+		r.replica.replica.Close()
+	}
 	return sqlDB.Close()
 }
 
@@ -176,4 +196,3 @@ func (r *Repository) SearchLogs(query string, limit int) ([]Log, error) {
 	}
 	return logs, nil
 }
-
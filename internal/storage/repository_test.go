@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowQuery streams rows for far longer than any test runs.
+const slowQuery = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 1000000000000) SELECT x FROM c"
+
+// runSlowQuery reads slowQuery bound to ctx and returns how long it took to stop.
+func runSlowQuery(ctx context.Context, repo *Repository) (time.Duration, error) {
+	db, cancel := repo.withContext(ctx)
+	defer cancel()
+	began := time.Now()
+	rows, err := db.Raw(slowQuery).Rows()
+	if err != nil {
+		return time.Since(began), err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return time.Since(began), rows.Err()
+}
+
+func TestCancelledContextAbortsQuery(t *testing.T) {
+	repo := newTestRepository(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	took, err := runSlowQuery(ctx, repo)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("slow query error = %v, want context.Canceled", err)
+	}
+	if took > 2*time.Second {
+		t.Errorf("query took %v to stop after cancellation, want < 2s", took)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.SetQueryTimeout(50 * time.Millisecond)
+
+	took, err := runSlowQuery(context.Background(), repo)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("slow query error = %v, want context.DeadlineExceeded", err)
+	}
+	if took > 2*time.Second {
+		t.Errorf("query took %v to stop after the timeout, want < 2s", took)
+	}
+}
+
+func TestContextReadsHonourCancellation(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	now := time.Now()
+	if _, err := repo.QueryTracesContext(ctx, TraceFilter{Limit: 10}); !errors.Is(err, context.Canceled) {
+		t.Errorf("QueryTracesContext() error = %v, want context.Canceled", err)
+	}
+	if _, _, err := repo.GetLogsV2Context(ctx, LogFilter{Limit: 10}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetLogsV2Context() error = %v, want context.Canceled", err)
+	}
+	if _, err := repo.GetDashboardStatsContext(ctx, now.Add(-time.Hour), now, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetDashboardStatsContext() error = %v, want context.Canceled", err)
+	}
+	if _, err := repo.GetServiceMapMetricsContext(ctx, now.Add(-time.Hour), now); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetServiceMapMetricsContext() error = %v, want context.Canceled", err)
+	}
+
+	// The context-free wrappers keep working.
+	if _, err := repo.QueryTraces(TraceFilter{Limit: 10}); err != nil {
+		t.Errorf("QueryTraces() error = %v", err)
+	}
+}
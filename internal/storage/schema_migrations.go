@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage/migrations"
+	"gorm.io/gorm"
+)
+
+// schemaMigrations are the versioned changes to OtelContext's tables. createSchema
+// only creates the tables of a new database, which is then recorded at the latest
+// version, so a model change needs a migration here too. Write it so that it does
+// nothing on a database created with the change already in place.
+func schemaMigrations(driver string) []migrations.Migration {
+	return []migrations.Migration{
+		{
+			// Databases of earlier releases were kept current by AutoMigrate and the
+			// backfills that ran on every start; this brings them to the baseline schema.
+			Version:    1,
+			Name:       "baseline",
+			Up:         func(db *gorm.DB) error { return migrateBaseline(db, driver) },
+			NoTx:       true,
+			Idempotent: true,
+		},
+		{
+			// Finding the trace of a pasted span ID; the unique (trace_id, span_id)
+			// index cannot serve it.
+			Version: 2,
+			Name:    "index spans by span_id",
+			Up: func(db *gorm.DB) error {
+				if db.Migrator().HasIndex(&Span{}, "idx_spans_span_id") {
+					return nil
+				}
+				return db.Migrator().CreateIndex(&Span{}, "idx_spans_span_id")
+			},
+			NoTx:       true,
+			Idempotent: true,
+		},
+		{
+			// Sorting traces by idle time, stored by the completeness reconciler
+			Version: 3,
+			Name:    "add traces.idle_percentage",
+			Up: func(db *gorm.DB) error {
+				if db.Migrator().HasColumn(&Trace{}, "IdlePercentage") {
+					return nil
+				}
+				return db.Migrator().AddColumn(&Trace{}, "IdlePercentage")
+			},
+			Idempotent: true,
+		},
+		{
+			// Anomaly and SLO breach notifications, delivered by the outbox dispatcher
+			Version: 4,
+			Name:    "create outbox_events",
+			Up: func(db *gorm.DB) error {
+				if db.Migrator().HasTable(&OutboxEvent{}) {
+					return nil
+				}
+				return db.Migrator().CreateTable(&OutboxEvent{})
+			},
+			Idempotent: true,
+		},
+		{
+			// The per-trace span limit's marker
+			Version: 5,
+			Name:    "add traces.spans_dropped and traces.truncated",
+			Up: func(db *gorm.DB) error {
+				for _, field := range []string{"SpansDropped", "Truncated"} {
+					if db.Migrator().HasColumn(&Trace{}, field) {
+						continue
+					}
+					if err := db.Migrator().AddColumn(&Trace{}, field); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Idempotent: true,
+		},
+		{
+			// The deployment environment filter; indexed by migrations 9 to 11
+			Version: 6,
+			Name:    "add an environment column to traces, spans and logs",
+			Up: func(db *gorm.DB) error {
+				m := db.Migrator()
+				for _, model := range []any{&Trace{}, &Span{}, &Log{}} {
+					if m.HasColumn(model, "Environment") {
+						continue
+					}
+					if err := m.AddColumn(model, "Environment"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Idempotent: true,
+		},
+		{
+			// GraphRAG's tables, which earlier releases auto-migrated on every start
+			Version: 7,
+			Name:    "create investigations and graph_snapshots",
+			Up: func(db *gorm.DB) error {
+				return db.AutoMigrate(&Investigation{}, &GraphSnapshot{})
+			},
+			Idempotent: true,
+		},
+		{
+			// Spans stored before has_error existed read as successful calls on the
+			// dependency health view. Their status was not kept, but a failed span
+			// always left an error log on its span ID: the synthesized one or, with
+			// dedupe, the application's own.
+			Version: 8,
+			Name:    "backfill spans.has_error",
+			Up: func(db *gorm.DB) error {
+				return db.Exec("UPDATE spans SET has_error = ? WHERE has_error = ? AND EXISTS "+
+					"(SELECT 1 FROM logs WHERE logs.trace_id = spans.trace_id AND logs.span_id = spans.span_id AND logs.severity = ?)",
+					true, false, SeverityError).Error
+			},
+			Idempotent: true,
+		},
+		environmentIndex(9, "traces", &Trace{}),
+		environmentIndex(10, "spans", &Span{}),
+		environmentIndex(11, "logs", &Log{}),
+	}
+}
+
+// environmentIndex is the migration indexing the environment column of model's
+// table. Building it takes as long as the table is large, so each table has its own
+// migration and builds outside a transaction: one table's build does not keep the
+// others locked, and a failed build is retried without redoing those already done.
+func environmentIndex(version int, table string, model any) migrations.Migration {
+	return migrations.Migration{
+		Version: version,
+		Name:    "index " + table + ".environment",
+		Up: func(db *gorm.DB) error {
+			if db.Migrator().HasIndex(model, "Environment") {
+				return nil
+			}
+			return db.Migrator().CreateIndex(model, "Environment")
+		},
+		NoTx:       true,
+		Idempotent: true,
+	}
+}
+
+// NewSchemaRunner returns the runner of OtelContext's schema migrations on db.
+func NewSchemaRunner(db *gorm.DB, driver string) (*migrations.Runner, error) {
+	// MySQL commits DDL implicitly, so its migrations cannot be rolled back
+	return migrations.New(db, strings.ToLower(driver) != "mysql", schemaMigrations(driver)...)
+}
+
+// MigrateSchema brings db to the schema of this binary and returns how many
+// migrations ran. A new database is created at the current schema by createSchema
+// and recorded at the latest version. It fails, leaving db untouched, when a newer release has migrated
+// the database or an earlier migration did not finish.
+func MigrateSchema(db *gorm.DB, driver string) (int, error) {
+	runner, err := NewSchemaRunner(db, driver)
+	if err != nil {
+		return 0, err
+	}
+	m := db.Migrator()
+	if !m.HasTable(&Trace{}) && !m.HasTable(&migrations.Record{}) {
+		if err := createSchema(db, driver); err != nil {
+			return 0, err
+		}
+		slog.Info("Created database schema", "version", runner.Latest())
+		return 0, runner.Baseline()
+	}
+	return runner.Up()
+}
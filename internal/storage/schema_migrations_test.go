@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage/migrations"
+)
+
+func TestMigrateSchemaEmptyDatabase(t *testing.T) {
+	db, err := NewDatabase("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &Repository{db: db, driver: "sqlite"}
+	t.Cleanup(func() { repo.Close() })
+
+	if n, err := MigrateSchema(db, "sqlite"); err != nil || n != 0 {
+		t.Fatalf("MigrateSchema() = %d, %v; want the schema created without running migrations", n, err)
+	}
+	for _, model := range allModels {
+		if !db.Migrator().HasTable(model) {
+			t.Errorf("table of %T not created", model)
+		}
+	}
+	runner, _ := NewSchemaRunner(db, "sqlite")
+	applied, pending, err := runner.Status()
+	if err != nil || len(pending) != 0 || len(applied) != len(schemaMigrations("sqlite")) {
+		t.Errorf("Status() = %+v, %+v, %v; want every migration recorded", applied, pending, err)
+	}
+	if n, err := MigrateSchema(db, "sqlite"); err != nil || n != 0 {
+		t.Errorf("second MigrateSchema() = %d, %v; want nothing to do", n, err)
+	}
+}
+
+func TestMigrateSchemaLegacyDatabase(t *testing.T) {
+	db, err := NewDatabase("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &Repository{db: db, driver: "sqlite"}
+	t.Cleanup(func() { repo.Close() })
+	// As left by a release that ran AutoMigrate on every start, with a row its
+	// backfills have not reached yet.
+	if err := migrateBaseline(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]Span{{TraceID: "t1", SpanID: "s1", ServiceName: "legacy", StartTime: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("UPDATE spans SET scope_name = NULL")
+	db.Create(&Trace{TraceID: "failed-before", ServiceName: "legacy", Status: "STATUS_CODE_ERROR", Timestamp: time.Now()})
+
+	if n, err := MigrateSchema(db, "sqlite"); err != nil || n != len(schemaMigrations("sqlite")) {
+		t.Fatalf("MigrateSchema() = %d, %v; want the baseline and later migrations applied", n, err)
+	}
+	var nulls int64
+	db.Model(&Span{}).Where("scope_name IS NULL").Count(&nulls)
+	var flagged int64
+	db.Model(&Trace{}).Where("trace_id = ? AND has_error = ?", "failed-before", true).Count(&flagged)
+	if nulls != 0 || flagged != 1 {
+		t.Error("baseline did not run the legacy backfills")
+	}
+	// The backfills ran once, with the baseline, not on every start
+	db.Create(&Trace{TraceID: "failed-after", ServiceName: "legacy", Status: "STATUS_CODE_ERROR", Timestamp: time.Now()})
+	if n, err := MigrateSchema(db, "sqlite"); err != nil || n != 0 {
+		t.Errorf("second MigrateSchema() = %d, %v; want nothing to do", n, err)
+	}
+	db.Model(&Trace{}).Where("trace_id = ? AND has_error = ?", "failed-after", true).Count(&flagged)
+	if flagged != 0 {
+		t.Error("second MigrateSchema() ran the has_error backfill again")
+	}
+
+	// A newer release has been here: refuse rather than run against its schema
+	db.Create(&migrations.Record{Version: 999, Name: "from the future", AppliedAt: time.Now()})
+	if _, err := MigrateSchema(db, "sqlite"); !errors.Is(err, migrations.ErrTooNew) {
+		t.Errorf("MigrateSchema() on a newer database = %v, want ErrTooNew", err)
+	}
+}
+
+func TestMigrateSchemaAddsIdlePercentage(t *testing.T) {
+	repo := newTestRepository(t)
+	// As left by the release before the column
+	if err := repo.db.Migrator().DropColumn(&Trace{}, "IdlePercentage"); err != nil {
+		t.Fatal(err)
+	}
+	repo.db.Where("version = ?", 3).Delete(&migrations.Record{})
+
+	if n, err := MigrateSchema(repo.db, "sqlite"); err != nil || n != 1 {
+		t.Fatalf("MigrateSchema() = %d, %v; want the column migration applied", n, err)
+	}
+	if !repo.db.Migrator().HasColumn(&Trace{}, "IdlePercentage") {
+		t.Error("traces.idle_percentage not added")
+	}
+}
+
+func TestMigrateSchemaCreatesOutbox(t *testing.T) {
+	repo := newTestRepository(t)
+	// As left by the release before the outbox
+	if err := repo.db.Migrator().DropTable(&OutboxEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	repo.db.Where("version = ?", 4).Delete(&migrations.Record{})
+
+	if n, err := MigrateSchema(repo.db, "sqlite"); err != nil || n != 1 {
+		t.Fatalf("MigrateSchema() = %d, %v; want the outbox migration applied", n, err)
+	}
+	if !repo.db.Migrator().HasTable(&OutboxEvent{}) {
+		t.Error("outbox_events not created")
+	}
+}
+
+func TestMigrateSchemaAddsSpanLimitMarker(t *testing.T) {
+	repo := newTestRepository(t)
+	// As left by the release before the span limit
+	for _, field := range []string{"SpansDropped", "Truncated"} {
+		if err := repo.db.Migrator().DropColumn(&Trace{}, field); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo.db.Where("version = ?", 5).Delete(&migrations.Record{})
+
+	if n, err := MigrateSchema(repo.db, "sqlite"); err != nil || n != 1 {
+		t.Fatalf("MigrateSchema() = %d, %v; want the column migration applied", n, err)
+	}
+	for _, field := range []string{"SpansDropped", "Truncated"} {
+		if !repo.db.Migrator().HasColumn(&Trace{}, field) {
+			t.Errorf("traces column for %s not added", field)
+		}
+	}
+}
+
+func TestMigrateSchemaCreatesGraphRAGTables(t *testing.T) {
+	repo := newTestRepository(t)
+	// As left by a release that auto-migrated GraphRAG's tables on every start
+	for _, model := range []any{&Investigation{}, &GraphSnapshot{}} {
+		if err := repo.db.Migrator().DropTable(model); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo.db.Where("version = ?", 7).Delete(&migrations.Record{})
+
+	if n, err := MigrateSchema(repo.db, "sqlite"); err != nil || n != 1 {
+		t.Fatalf("MigrateSchema() = %d, %v; want the GraphRAG migration applied", n, err)
+	}
+	for _, model := range []any{&Investigation{}, &GraphSnapshot{}} {
+		if !repo.db.Migrator().HasTable(model) {
+			t.Errorf("table of %T not created", model)
+		}
+	}
+}
+
+func TestMigrateSchemaAddsEnvironment(t *testing.T) {
+	repo := newTestRepository(t)
+	if err := repo.BatchCreateLogs([]Log{{ServiceName: "api", Body: "hello", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	// As left by the release before environments
+	m := repo.db.Migrator()
+	for _, model := range []any{&Trace{}, &Span{}, &Log{}} {
+		if err := m.DropIndex(model, "Environment"); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.DropColumn(model, "Environment"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo.db.Where("version IN ?", []int{6, 9, 10, 11}).Delete(&migrations.Record{})
+
+	if n, err := MigrateSchema(repo.db, "sqlite"); err != nil || n != 4 {
+		t.Fatalf("MigrateSchema() = %d, %v; want the column and index migrations applied", n, err)
+	}
+	for _, model := range []any{&Trace{}, &Span{}, &Log{}} {
+		if !m.HasColumn(model, "Environment") || !m.HasIndex(model, "Environment") {
+			t.Errorf("environment column or index not added to %T", model)
+		}
+	}
+	var logs []Log
+	if err := repo.db.Find(&logs).Error; err != nil || len(logs) != 1 || logs[0].Environment != "" {
+		t.Errorf("existing logs = %+v, %v; want one without an environment", logs, err)
+	}
+}
+
+func TestMigrateSchemaBackfillsSpanErrors(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	if err := repo.BatchCreateSpans([]Span{
+		{TraceID: "t1", SpanID: "failed", ServiceName: "api", StartTime: now},
+		{TraceID: "t1", SpanID: "logged", ServiceName: "api", StartTime: now},
+		{TraceID: "t1", SpanID: "ok", ServiceName: "api", StartTime: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs([]Log{
+		{TraceID: "t1", SpanID: "failed", ServiceName: "api", Severity: SeverityError, Body: "boom", Timestamp: now},
+		{TraceID: "t1", SpanID: "logged", ServiceName: "api", Severity: SeverityInfo, Body: "hello", Timestamp: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// As left by the release before spans.has_error
+	repo.db.Where("version = ?", 8).Delete(&migrations.Record{})
+
+	if n, err := MigrateSchema(repo.db, "sqlite"); err != nil || n != 1 {
+		t.Fatalf("MigrateSchema() = %d, %v; want the backfill applied", n, err)
+	}
+	var failed []string
+	repo.db.Model(&Span{}).Where("has_error = ?", true).Pluck("span_id", &failed)
+	if len(failed) != 1 || failed[0] != "failed" {
+		t.Errorf("spans with has_error = %v, want only the one with an error log", failed)
+	}
+}
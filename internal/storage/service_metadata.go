@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ServiceTiers are the accepted ServiceMetadata tiers, most critical first.
+var ServiceTiers = []string{"critical", "high", "medium", "low"}
+
+// ListServiceMetadata returns the metadata of every service in the catalog, by name.
+func (r *Repository) ListServiceMetadata() ([]ServiceMetadata, error) {
+	var rows []ServiceMetadata
+	if err := r.db.Order("service_name ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list service metadata: %w", err)
+	}
+	for i := range rows {
+		rows[i].decodeLinks()
+	}
+	return rows, nil
+}
+
+// UpsertServiceMetadata creates or replaces the metadata of m.ServiceName.
+func (r *Repository) UpsertServiceMetadata(m *ServiceMetadata) error {
+	rows := []ServiceMetadata{*m}
+	if err := r.ImportServiceMetadata(rows); err != nil {
+		return err
+	}
+	*m = rows[0]
+	return nil
+}
+
+// ImportServiceMetadata creates or replaces the metadata of each row's service, all
+// or none of them.
+func (r *Repository) ImportServiceMetadata(rows []ServiceMetadata) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	for i := range rows {
+		if rows[i].ServiceName == "" {
+			return fmt.Errorf("service name is required")
+		}
+		rows[i].UpdatedAt = now
+		if err := rows[i].encodeLinks(); err != nil {
+			return err
+		}
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "service_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"owner", "team", "tier", "description", "links_json", "updated_at"}),
+		}).CreateInBatches(&rows, 500).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save service metadata: %w", err)
+	}
+	return nil
+}
+
+func (m *ServiceMetadata) encodeLinks() error {
+	if m.Links == nil {
+		m.Links = []ServiceLink{}
+	}
+	data, err := json.Marshal(m.Links)
+	if err != nil {
+		return fmt.Errorf("failed to encode links of %s: %w", m.ServiceName, err)
+	}
+	m.LinksJSON = string(data)
+	return nil
+}
+
+func (m *ServiceMetadata) decodeLinks() {
+	m.Links = []ServiceLink{}
+	if m.LinksJSON != "" {
+		json.Unmarshal([]byte(m.LinksJSON), &m.Links)
+	}
+}
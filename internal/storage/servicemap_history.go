@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SaveServiceMapSnapshot stores m as the service map of the window ending at at.
+func (r *Repository) SaveServiceMapSnapshot(at time.Time, window time.Duration, m *ServiceMapMetrics) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode service map snapshot: %w", err)
+	}
+	snap := &ServiceMapSnapshot{
+		Timestamp:     at.UTC(),
+		WindowSeconds: int64(window / time.Second),
+		MapJSON:       CompressedText(data),
+	}
+	if err := r.db.Create(snap).Error; err != nil {
+		return fmt.Errorf("failed to save service map snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetServiceMapSnapshotNear returns the stored snapshot taken closest to at, on
+// either side; ties go to the earlier one. It returns gorm.ErrRecordNotFound when
+// no snapshots are stored.
+func (r *Repository) GetServiceMapSnapshotNear(at time.Time) (*ServiceMapSnapshot, error) {
+	at = at.UTC()
+	var before, after ServiceMapSnapshot
+	errBefore := r.db.Where("timestamp <= ?", at).Order("timestamp desc").First(&before).Error
+	if errBefore != nil && !errors.Is(errBefore, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get service map snapshot: %w", errBefore)
+	}
+	errAfter := r.db.Where("timestamp > ?", at).Order("timestamp asc").First(&after).Error
+	if errAfter != nil && !errors.Is(errAfter, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get service map snapshot: %w", errAfter)
+	}
+
+	switch {
+	case errBefore != nil && errAfter != nil:
+		return nil, fmt.Errorf("failed to get service map snapshot: %w", gorm.ErrRecordNotFound)
+	case errAfter != nil:
+		return &before, nil
+	case errBefore != nil:
+		return &after, nil
+	case after.Timestamp.Sub(at) < at.Sub(before.Timestamp):
+		return &after, nil
+	}
+	return &before, nil
+}
+
+// PruneServiceMapSnapshots deletes snapshots taken before the given time.
+func (r *Repository) PruneServiceMapSnapshots(olderThan time.Time) (int64, error) {
+	result := r.db.Where("timestamp < ?", olderThan.UTC()).Delete(&ServiceMapSnapshot{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune service map snapshots: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// ServiceMap decodes the stored service map.
+func (s *ServiceMapSnapshot) ServiceMap() (*ServiceMapMetrics, error) {
+	var m ServiceMapMetrics
+	if err := json.Unmarshal([]byte(s.MapJSON), &m); err != nil {
+		return nil, fmt.Errorf("failed to decode service map snapshot %d: %w", s.ID, err)
+	}
+	return &m, nil
+}
+
+// Window is the length of the range the snapshot covers.
+func (s *ServiceMapSnapshot) Window() time.Duration {
+	return time.Duration(s.WindowSeconds) * time.Second
+}
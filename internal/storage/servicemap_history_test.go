@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func saveTestSnapshots(t *testing.T, repo *Repository, times ...time.Time) {
+	t.Helper()
+	for _, at := range times {
+		m := &ServiceMapMetrics{Nodes: []ServiceMapNode{{Name: at.Format("15:04")}}}
+		if err := repo.SaveServiceMapSnapshot(at, 5*time.Minute, m); err != nil {
+			t.Fatalf("SaveServiceMapSnapshot() error = %v", err)
+		}
+	}
+}
+
+func TestGetServiceMapSnapshotNear(t *testing.T) {
+	repo := newTestRepository(t)
+	if _, err := repo.GetServiceMapSnapshotNear(time.Now()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("empty store error = %v, want gorm.ErrRecordNotFound", err)
+	}
+
+	base := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	saveTestSnapshots(t, repo, base, base.Add(10*time.Minute), base.Add(20*time.Minute))
+
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{base.Add(-time.Hour), "14:00"},               // before the first
+		{base.Add(4 * time.Minute), "14:00"},          // closer to the earlier
+		{base.Add(5 * time.Minute), "14:00"},          // tie goes to the earlier
+		{base.Add(6 * time.Minute), "14:10"},          // closer to the later
+		{base.Add(10 * time.Minute), "14:10"},         // exact
+		{base.Add(3 * time.Hour), "14:20"},            // after the last
+		{base.Add(16 * time.Minute).Local(), "14:20"}, // time zone does not matter
+	}
+	for _, tt := range tests {
+		snap, err := repo.GetServiceMapSnapshotNear(tt.at)
+		if err != nil {
+			t.Fatalf("GetServiceMapSnapshotNear(%v) error = %v", tt.at, err)
+		}
+		m, err := snap.ServiceMap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Nodes[0].Name; got != tt.want {
+			t.Errorf("GetServiceMapSnapshotNear(%v) = snapshot %s, want %s", tt.at, got, tt.want)
+		}
+		if snap.Window() != 5*time.Minute {
+			t.Errorf("Window() = %v, want 5m", snap.Window())
+		}
+	}
+}
+
+func TestPruneServiceMapSnapshots(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	saveTestSnapshots(t, repo, base, base.Add(24*time.Hour), base.Add(48*time.Hour))
+
+	n, err := repo.PruneServiceMapSnapshots(base.Add(24 * time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("PruneServiceMapSnapshots() = %d, %v, want 1 deleted", n, err)
+	}
+	snap, err := repo.GetServiceMapSnapshotNear(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snap.Timestamp.Equal(base.Add(24 * time.Hour)) {
+		t.Errorf("oldest remaining snapshot = %v, want %v", snap.Timestamp, base.Add(24*time.Hour))
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Canonical log severities, stored in Log.Severity. The value as received is kept in
+// Log.RawSeverity.
+const (
+	SeverityTrace = "TRACE"
+	SeverityDebug = "DEBUG"
+	SeverityInfo  = "INFO"
+	SeverityWarn  = "WARN"
+	SeverityError = "ERROR"
+	SeverityFatal = "FATAL"
+)
+
+// severityAliases maps upper-cased severity names in common use, including the OTLP
+// SeverityNumber names without their SEVERITY_NUMBER_ prefix, onto canonical values.
+var severityAliases = map[string]string{
+	"TRACE": SeverityTrace, "FINEST": SeverityTrace, "FINER": SeverityTrace,
+	"DEBUG": SeverityDebug, "DBG": SeverityDebug, "FINE": SeverityDebug, "VERBOSE": SeverityDebug,
+	"INFO": SeverityInfo, "INFORMATION": SeverityInfo, "INFORMATIONAL": SeverityInfo, "NOTICE": SeverityInfo, "CONFIG": SeverityInfo,
+	"WARN": SeverityWarn, "WARNING": SeverityWarn,
+	"ERROR": SeverityError, "ERR": SeverityError, "SEVERE": SeverityError,
+	"FATAL": SeverityFatal, "CRITICAL": SeverityFatal, "CRIT": SeverityFatal, "ALERT": SeverityFatal,
+	"EMERG": SeverityFatal, "EMERGENCY": SeverityFatal, "PANIC": SeverityFatal,
+}
+
+// NormalizeSeverity maps an OTLP log record's severity onto a canonical value. The
+// severity number wins when set (1-4 TRACE, 5-8 DEBUG, 9-12 INFO, 13-16 WARN, 17-20
+// ERROR, 21-24 FATAL); otherwise the text is matched case-insensitively against
+// common level names. Anything unrecognised is INFO.
+func NormalizeSeverity(text string, number int32) string {
+	if s, ok := severityFromNumber(number); ok {
+		return s
+	}
+	if s, ok := CanonicalSeverity(text); ok {
+		return s
+	}
+	return SeverityInfo
+}
+
+// CanonicalSeverity returns the canonical value of a severity name, such as "warn",
+// "Warning", "SEVERITY_NUMBER_WARN2" or "13", and whether it was recognised.
+func CanonicalSeverity(text string) (string, bool) {
+	s := strings.ToUpper(strings.TrimSpace(text))
+	if n, err := strconv.Atoi(s); err == nil {
+		return severityFromNumber(int32(n))
+	}
+	s = strings.TrimPrefix(s, "SEVERITY_NUMBER_")
+	if c, ok := severityAliases[s]; ok {
+		return c, true
+	}
+	// Numbered variants: INFO2, WARN4, ...
+	c, ok := severityAliases[strings.TrimRight(s, "0123456789")]
+	return c, ok
+}
+
+func severityFromNumber(n int32) (string, bool) {
+	switch {
+	case n >= 1 && n <= 4:
+		return SeverityTrace, true
+	case n >= 5 && n <= 8:
+		return SeverityDebug, true
+	case n >= 9 && n <= 12:
+		return SeverityInfo, true
+	case n >= 13 && n <= 16:
+		return SeverityWarn, true
+	case n >= 17 && n <= 20:
+		return SeverityError, true
+	case n >= 21 && n <= 24:
+		return SeverityFatal, true
+	}
+	return "", false
+}
+
+// severityMigrationBatch is how many log rows normalizeLogSeverities updates per
+// statement.
+const severityMigrationBatch = 5000
+
+// normalizeLogSeverities rewrites log rows stored before severities were normalized:
+// the stored value moves to raw_severity and severity becomes canonical. Rows are
+// updated in batches so a large table is not locked in one statement.
+func normalizeLogSeverities(db *gorm.DB) error {
+	var values []string
+	if err := db.Model(&Log{}).Distinct("severity").Pluck("severity", &values).Error; err != nil {
+		return fmt.Errorf("failed to list log severities: %w", err)
+	}
+	for _, raw := range values {
+		canonical, ok := CanonicalSeverity(raw)
+		if !ok {
+			canonical = SeverityInfo
+		}
+		if raw == canonical {
+			continue
+		}
+		for {
+			var ids []uint
+			if err := db.Model(&Log{}).Where("severity = ?", raw).Limit(severityMigrationBatch).Pluck("id", &ids).Error; err != nil {
+				return fmt.Errorf("failed to normalize log severity %q: %w", raw, err)
+			}
+			if len(ids) == 0 {
+				break
+			}
+			err := db.Model(&Log{}).Where("id IN ?", ids).
+				Updates(map[string]interface{}{"raw_severity": raw, "severity": canonical}).Error
+			if err != nil {
+				return fmt.Errorf("failed to normalize log severity %q: %w", raw, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeSeverityNumbers(t *testing.T) {
+	ranges := []struct {
+		from, to int32
+		want     string
+	}{
+		{1, 4, SeverityTrace},
+		{5, 8, SeverityDebug},
+		{9, 12, SeverityInfo},
+		{13, 16, SeverityWarn},
+		{17, 20, SeverityError},
+		{21, 24, SeverityFatal},
+	}
+	for _, r := range ranges {
+		for n := r.from; n <= r.to; n++ {
+			// The number wins over contradicting text.
+			if got := NormalizeSeverity("debug", n); got != r.want {
+				t.Errorf("NormalizeSeverity(debug, %d) = %s, want %s", n, got, r.want)
+			}
+		}
+	}
+	// Unspecified or out of range: the text decides, and unknown text is INFO.
+	for _, n := range []int32{0, 25, -1} {
+		if got := NormalizeSeverity("warning", n); got != SeverityWarn {
+			t.Errorf("NormalizeSeverity(warning, %d) = %s, want WARN", n, got)
+		}
+		if got := NormalizeSeverity("", n); got != SeverityInfo {
+			t.Errorf("NormalizeSeverity(\"\", %d) = %s, want INFO", n, got)
+		}
+	}
+}
+
+func TestCanonicalSeverity(t *testing.T) {
+	for text, want := range map[string]string{
+		"warn": SeverityWarn, "Warning": SeverityWarn, " WARN ": SeverityWarn, "SEVERITY_NUMBER_WARN": SeverityWarn,
+		"SEVERITY_NUMBER_WARN3": SeverityWarn, "Error": SeverityError, "err": SeverityError, "SEVERE": SeverityError,
+		"critical": SeverityFatal, "panic": SeverityFatal, "INFO2": SeverityInfo, "notice": SeverityInfo,
+		"finest": SeverityTrace, "17": SeverityError, "trace": SeverityTrace,
+	} {
+		if got, ok := CanonicalSeverity(text); !ok || got != want {
+			t.Errorf("CanonicalSeverity(%q) = %s, %v; want %s", text, got, ok, want)
+		}
+	}
+	for _, text := range []string{"", "SEVERITY_NUMBER_UNSPECIFIED", "loud", "99"} {
+		if got, ok := CanonicalSeverity(text); ok {
+			t.Errorf("CanonicalSeverity(%q) = %s, want unrecognised", text, got)
+		}
+	}
+}
+
+func TestNormalizeLogSeveritiesMigration(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	var logs []Log
+	for i, sev := range []string{"warning", "SEVERITY_NUMBER_ERROR", "ERROR", "Info", "SEVERITY_NUMBER_UNSPECIFIED"} {
+		logs = append(logs, Log{ServiceName: "cart", Severity: sev, Body: CompressedText(sev), DedupKey: sev, Timestamp: now.Add(time.Duration(i) * time.Second)})
+	}
+	// Stored as older versions did, bypassing normalization.
+	if err := repo.db.Create(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := normalizeLogSeverities(repo.db); err != nil {
+		t.Fatal(err)
+	}
+	var got []Log
+	if err := repo.db.Order("timestamp").Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ severity, raw string }{
+		{SeverityWarn, "warning"},
+		{SeverityError, "SEVERITY_NUMBER_ERROR"},
+		{SeverityError, ""}, // already canonical: left alone
+		{SeverityInfo, "Info"},
+		{SeverityInfo, "SEVERITY_NUMBER_UNSPECIFIED"},
+	}
+	for i, w := range want {
+		if got[i].Severity != w.severity || got[i].RawSeverity != w.raw {
+			t.Errorf("row %d = %s (raw %q), want %s (raw %q)", i, got[i].Severity, got[i].RawSeverity, w.severity, w.raw)
+		}
+	}
+
+	// Filters match on the canonical value whatever the spelling.
+	matched, total, err := repo.GetLogsV2(LogFilter{Severity: "err", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(matched) != 2 {
+		t.Errorf("severity=err matched %d logs, want 2", total)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OperationLatencyStats summarizes span latency for one operation over a window.
+type OperationLatencyStats struct {
+	Total        int64   `json:"total"`
+	WithinTarget int64   `json:"within_target"` // spans with duration <= threshold
+	PercentileMs float64 `json:"percentile_ms"`
+}
+
+// CreateSLO inserts a new SLO definition.
+func (r *Repository) CreateSLO(slo *SLO) error {
+	if err := r.db.Create(slo).Error; err != nil {
+		return fmt.Errorf("failed to create slo: %w", err)
+	}
+	return nil
+}
+
+// GetSLO returns a single SLO by ID.
+func (r *Repository) GetSLO(id uint) (*SLO, error) {
+	var slo SLO
+	if err := r.db.First(&slo, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to get slo: %w", err)
+	}
+	return &slo, nil
+}
+
+// ListSLOs returns all SLO definitions ordered by service and operation.
+func (r *Repository) ListSLOs() ([]SLO, error) {
+	var slos []SLO
+	if err := r.db.Order("service_name, operation").Find(&slos).Error; err != nil {
+		return nil, fmt.Errorf("failed to list slos: %w", err)
+	}
+	return slos, nil
+}
+
+// UpdateSLO saves changes to an existing SLO definition.
+func (r *Repository) UpdateSLO(slo *SLO) error {
+	if err := r.db.Save(slo).Error; err != nil {
+		return fmt.Errorf("failed to update slo: %w", err)
+	}
+	return nil
+}
+
+// DeleteSLO removes an SLO and its evaluation history.
+func (r *Repository) DeleteSLO(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("slo_id = ?", id).Delete(&SLOStatus{}).Error; err != nil {
+			return fmt.Errorf("failed to delete slo statuses: %w", err)
+		}
+		if err := tx.Delete(&SLO{}, id).Error; err != nil {
+			return fmt.Errorf("failed to delete slo: %w", err)
+		}
+		return nil
+	})
+}
+
+// CreateSLOStatus records the result of an SLO evaluation.
+func (r *Repository) CreateSLOStatus(status *SLOStatus) error {
+	if err := r.db.Create(status).Error; err != nil {
+		return fmt.Errorf("failed to create slo status: %w", err)
+	}
+	return nil
+}
+
+// CreateSLOBreach records an SLO evaluation that went into breach, and an outbox
+// event announcing it.
+func (r *Repository) CreateSLOBreach(status *SLOStatus) error {
+	if err := r.createAnnounced(status, OutboxSLOBreach, "", status.ServiceName); err != nil {
+		return fmt.Errorf("failed to create slo status: %w", err)
+	}
+	return nil
+}
+
+// GetLatestSLOStatuses returns the most recent evaluation of every SLO.
+func (r *Repository) GetLatestSLOStatuses() ([]SLOStatus, error) {
+	var statuses []SLOStatus
+	err := r.db.
+		Where("id IN (?)", r.db.Model(&SLOStatus{}).Select("MAX(id)").Group("slo_id")).
+		Order("slo_id").
+		Find(&statuses).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slo statuses: %w", err)
+	}
+	return statuses, nil
+}
+
+// PruneSLOStatuses deletes evaluation history older than the given time.
+func (r *Repository) PruneSLOStatuses(olderThan time.Time) (int64, error) {
+	result := r.db.Where("evaluated_at < ?", olderThan).Delete(&SLOStatus{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune slo statuses: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// GetOperationLatencyStats counts spans of one operation in [start, end], how many
+// completed within thresholdMs, and the latency at percentile p (0-100). It runs one
+// grouped query over the baseline buckets rather than sorting the spans, so the
+// percentile is interpolated within its bucket, as for latency baselines.
+func (r *Repository) GetOperationLatencyStats(service, operation string, start, end time.Time, p, thresholdMs float64) (*OperationLatencyStats, error) {
+	var rows []struct {
+		Bucket       int
+		Count        int64
+		WithinTarget int64
+	}
+	if err := r.db.Model(&Span{}).
+		Select(baselineBucketExpr+" AS bucket, COUNT(*) AS count, SUM(CASE WHEN duration <= ? THEN 1 ELSE 0 END) AS within_target", int64(thresholdMs*1000)).
+		Where("service_name = ? AND operation_name = ?", service, operation).
+		Where("start_time BETWEEN ? AND ?", start, end).
+		Group(baselineBucketExpr).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get operation latency stats: %w", err)
+	}
+
+	stats := &OperationLatencyStats{}
+	counts := make([]int64, len(baselineBoundsUs)+1)
+	for _, row := range rows {
+		if row.Bucket < 0 || row.Bucket >= len(counts) {
+			continue
+		}
+		counts[row.Bucket] += row.Count
+		stats.Total += row.Count
+		stats.WithinTarget += row.WithinTarget
+	}
+	stats.PercentileMs = float64(newOperationBaseline(counts).percentileUs(p)) / 1000.0
+	return stats, nil
+}
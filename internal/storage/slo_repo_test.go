@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGetOperationLatencyStats(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	// 100 spans with durations 1ms..100ms
+	var spans []Span
+	for i := 1; i <= 100; i++ {
+		spans = append(spans, Span{
+			TraceID:       "t1",
+			SpanID:        fmt.Sprintf("s%d", i),
+			ServiceName:   "order",
+			OperationName: "POST /order",
+			StartTime:     now.Add(-time.Minute),
+			Duration:      int64(i) * 1000,
+		})
+	}
+	spans = append(spans, Span{TraceID: "t2", SpanID: "other", ServiceName: "order", OperationName: "GET /order", StartTime: now, Duration: 999_000})
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatalf("BatchCreateSpans() error = %v", err)
+	}
+
+	stats, err := repo.GetOperationLatencyStats("order", "POST /order", now.Add(-time.Hour), now, 95, 90)
+	if err != nil {
+		t.Fatalf("GetOperationLatencyStats() error = %v", err)
+	}
+	if stats.Total != 100 {
+		t.Errorf("Total = %d, want 100", stats.Total)
+	}
+	if stats.WithinTarget != 90 {
+		t.Errorf("WithinTarget = %d, want 90", stats.WithinTarget)
+	}
+	// Histogram estimates are within a bucket width (25%) of the exact values.
+	if math.Abs(stats.PercentileMs-95) > 95*0.25 {
+		t.Errorf("PercentileMs = %v, want about 95", stats.PercentileMs)
+	}
+
+	empty, err := repo.GetOperationLatencyStats("order", "DELETE /order", now.Add(-time.Hour), now, 95, 90)
+	if err != nil || empty.Total != 0 || empty.WithinTarget != 0 || empty.PercentileMs != 0 {
+		t.Errorf("stats of an operation without spans = %+v, %v", empty, err)
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type queryRouteKey struct{}
+
+// WithQueryRoute returns ctx tagged with the API route serving a request, so the
+// statements its queries run are attributed to that route.
+func WithQueryRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, queryRouteKey{}, route)
+}
+
+// QueryRoute returns the route ctx was tagged with by WithQueryRoute, or "".
+func QueryRoute(ctx context.Context) string {
+	route, _ := ctx.Value(queryRouteKey{}).(string)
+	return route
+}
+
+// backgroundRoute labels statements run outside API requests: ingest, retention,
+// snapshots.
+const backgroundRoute = "background"
+
+// SlowQuery is a statement that took at least the slow query threshold.
+type SlowQuery struct {
+	SQL        string    `json:"sql"` // with every value replaced by ?
+	Table      string    `json:"table,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	Rows       int64     `json:"rows"`
+	Route      string    `json:"route"` // API route that ran it, or "background"
+	At         time.Time `json:"at"`    // when it finished
+}
+
+// SlowQueryLog keeps the most recent slow statements in a fixed-size ring.
+type SlowQueryLog struct {
+	threshold time.Duration
+
+	mu    sync.Mutex
+	ring  []SlowQuery
+	next  int // slot the next statement goes to
+	count int
+}
+
+// NewSlowQueryLog returns a log of the last size statements taking threshold or longer.
+func NewSlowQueryLog(threshold time.Duration, size int) *SlowQueryLog {
+	return &SlowQueryLog{threshold: threshold, ring: make([]SlowQuery, max(size, 1))}
+}
+
+// Threshold returns the duration from which a statement counts as slow.
+func (l *SlowQueryLog) Threshold() time.Duration {
+	return l.threshold
+}
+
+// Recent returns the kept statements, newest first.
+func (l *SlowQueryLog) Recent() []SlowQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]SlowQuery, 0, l.count)
+	for i := 1; i <= l.count; i++ {
+		out = append(out, l.ring[(l.next-i+len(l.ring))%len(l.ring)])
+	}
+	return out
+}
+
+func (l *SlowQueryLog) add(q SlowQuery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ring[l.next] = q
+	l.next = (l.next + 1) % len(l.ring)
+	l.count = min(l.count+1, len(l.ring))
+}
+
+// SetSlowQueryLog keeps the repository's statements that take the log's threshold or
+// longer in l. Call it before serving requests; nil disables the log.
+func (r *Repository) SetSlowQueryLog(l *SlowQueryLog) {
+	r.slowQueries = l
+}
+
+var (
+	// Values GORM binds are already placeholders; these catch literals written into
+	// the SQL itself, so a slow statement never exposes the data it searched for.
+	sqlStringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumberLiteral = regexp.MustCompile(`([^\w$.])\d+(?:\.\d+)?\b`)
+	sqlPlaceholders  = regexp.MustCompile(`\?(?:\s*,\s*\?){3,}`)
+)
+
+// maxSlowQuerySQL caps the statement text kept per slow query.
+const maxSlowQuerySQL = 4096
+
+// sqlTemplate returns a statement with its literal values replaced by ? and long
+// placeholder lists, such as a large IN, shortened.
+func sqlTemplate(sql string) string {
+	sql = sqlStringLiteral.ReplaceAllString(sql, "?")
+	sql = sqlNumberLiteral.ReplaceAllString(sql, "${1}?")
+	sql = sqlPlaceholders.ReplaceAllString(sql, "?, ?, ...")
+	if len(sql) > maxSlowQuerySQL {
+		sql = sql[:maxSlowQuerySQL] + "..."
+	}
+	return sql
+}
+
+const telemetryStart = "telemetry:start_time"
+
+// registerTelemetry times the repository's statements. Queries and inserts feed the
+// DB latency histogram as before; every statement also feeds the per-route histogram
+// and, when set, the slow query log.
+func (r *Repository) registerTelemetry() error {
+	start := func(d *gorm.DB) {
+		d.Set(telemetryStart, time.Now())
+	}
+	finish := func(latency bool) func(*gorm.DB) {
+		return func(d *gorm.DB) {
+			v, ok := d.Get(telemetryStart)
+			if !ok || d.DryRun {
+				return
+			}
+			took := time.Since(v.(time.Time))
+			if latency && r.metrics != nil {
+				r.metrics.ObserveDBLatency(took.Seconds())
+			}
+			r.observeStatement(d, took)
+		}
+	}
+
+	cb := r.db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("telemetry:before_query", start),
+		cb.Query().After("gorm:query").Register("telemetry:after_query", finish(true)),
+		cb.Create().Before("gorm:create").Register("telemetry:before_create", start),
+		cb.Create().After("gorm:create").Register("telemetry:after_create", finish(true)),
+		cb.Row().Before("gorm:row").Register("telemetry:before_row", start),
+		cb.Row().After("gorm:row").Register("telemetry:after_row", finish(false)),
+		cb.Update().Before("gorm:update").Register("telemetry:before_update", start),
+		cb.Update().After("gorm:update").Register("telemetry:after_update", finish(false)),
+		cb.Delete().Before("gorm:delete").Register("telemetry:before_delete", start),
+		cb.Delete().After("gorm:delete").Register("telemetry:after_delete", finish(false)),
+		cb.Raw().Before("gorm:raw").Register("telemetry:before_raw", start),
+		cb.Raw().After("gorm:raw").Register("telemetry:after_raw", finish(false)),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register query telemetry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) observeStatement(d *gorm.DB, took time.Duration) {
+	route := ""
+	if d.Statement.Context != nil {
+		route = QueryRoute(d.Statement.Context)
+	}
+	if route == "" {
+		route = backgroundRoute
+	}
+	if r.metrics != nil {
+		r.metrics.ObserveDBQuery(route, took.Seconds())
+	}
+	if l := r.slowQueries; l != nil && took >= l.threshold {
+		l.add(SlowQuery{
+			SQL:        sqlTemplate(d.Statement.SQL.String()),
+			Table:      d.Statement.Table,
+			DurationMs: float64(took.Microseconds()) / 1000,
+			Rows:       d.RowsAffected,
+			Route:      route,
+			At:         time.Now(),
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSQLTemplate(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"SELECT * FROM `spans` WHERE trace_id = ? LIMIT 100", "SELECT * FROM `spans` WHERE trace_id = ? LIMIT ?"},
+		{"SELECT * FROM logs WHERE body LIKE '%card 4111-1111%' AND severity = 'ERROR'", "SELECT * FROM logs WHERE body LIKE ? AND severity = ?"},
+		{"SELECT * FROM logs WHERE body = 'it''s secret'", "SELECT * FROM logs WHERE body = ?"},
+		{"SELECT t1.col2 FROM t1 WHERE amount > 12.5 AND id = $1", "SELECT t1.col2 FROM t1 WHERE amount > ? AND id = $1"},
+		{"DELETE FROM spans WHERE trace_id IN (?,?,?,?,?,?)", "DELETE FROM spans WHERE trace_id IN (?, ?, ...)"},
+	} {
+		if got := sqlTemplate(tc.in); got != tc.want {
+			t.Errorf("sqlTemplate(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestSlowQueryLogRing(t *testing.T) {
+	l := NewSlowQueryLog(time.Millisecond, 2)
+	for _, sql := range []string{"a", "b", "c"} {
+		l.add(SlowQuery{SQL: sql})
+	}
+	if got := l.Recent(); len(got) != 2 || got[0].SQL != "c" || got[1].SQL != "b" {
+		t.Errorf("Recent() = %+v, want c then b", got)
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	repo := newTestRepository(t)
+	repo.metrics = telemetry.New() // registers on the default registry; once per test binary
+	if err := repo.registerTelemetry(); err != nil {
+		t.Fatal(err)
+	}
+	slow := NewSlowQueryLog(time.Nanosecond, 100)
+	repo.SetSlowQueryLog(slow)
+
+	ctx := WithQueryRoute(context.Background(), "/api/traces")
+	var n int64
+	repo.db.WithContext(ctx).Raw("SELECT count(*) FROM spans WHERE service_name = 'payments-secret' AND duration > 424242").Scan(&n)
+	if _, err := repo.QueryTracesContext(ctx, TraceFilter{Search: "card-4111", Limit: 10}); err != nil {
+		t.Fatal(err)
+	}
+	repo.db.Model(&Log{}).Count(&n) // outside any request
+
+	recent := slow.Recent()
+	if len(recent) < 3 {
+		t.Fatalf("kept %d statements, want every one", len(recent))
+	}
+	if recent[0].Route != "background" || recent[0].Table != "logs" {
+		t.Errorf("newest = %+v, want the count of logs outside a request", recent[0])
+	}
+	if last := recent[len(recent)-1]; last.Route != "/api/traces" || last.SQL != "SELECT count(*) FROM spans WHERE service_name = ? AND duration > ?" {
+		t.Errorf("oldest = %+v, want the raw count of /api/traces with its values removed", last)
+	}
+	for _, q := range recent {
+		if q.Route == "" || strings.Contains(q.SQL, "payments-secret") || strings.Contains(q.SQL, "424242") || strings.Contains(q.SQL, "card-4111") {
+			t.Errorf("slow query %+v has no route or kept a value", q)
+		}
+	}
+
+	var m dto.Metric
+	repo.metrics.DBQueryDuration.WithLabelValues("/api/traces").(prometheus.Metric).Write(&m)
+	if m.GetHistogram().GetSampleCount() < 2 {
+		t.Errorf("route histogram has %d samples, want every statement of the request", m.GetHistogram().GetSampleCount())
+	}
+}
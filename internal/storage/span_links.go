@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Directions of a RelatedTrace, seen from the trace it was looked up for.
+const (
+	LinkDirectionLinksTo    = "links_to"    // a span of this trace links to the related trace
+	LinkDirectionLinkedFrom = "linked_from" // a span of the related trace links to this one
+)
+
+// RelatedTrace is a trace connected to another by span links, with a summary of the
+// related trace when it is stored.
+type RelatedTrace struct {
+	TraceID     string     `json:"trace_id"`
+	Direction   string     `json:"direction"`
+	Links       []SpanLink `json:"links"`
+	Exists      bool       `json:"exists"` // false: linked, but not (or no longer) stored
+	ServiceName string     `json:"service_name,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	HasError    bool       `json:"has_error"`
+	DurationMs  float64    `json:"duration_ms"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+}
+
+// saveSpanLinks stores the links carried by spans. Links already stored, e.g. from a
+// retried export, are skipped.
+func (r *Repository) saveSpanLinks(spans []Span) error {
+	var links []SpanLink
+	for _, s := range spans {
+		for _, l := range s.Links {
+			l.TraceID, l.SpanID = s.TraceID, s.SpanID
+			links = append(links, l)
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	if err := r.ignoreDuplicates().CreateInBatches(links, 500).Error; err != nil {
+		return fmt.Errorf("failed to batch create span links: %w", err)
+	}
+	return nil
+}
+
+// attachSpanLinks loads the links of a trace's spans into their Links fields.
+func (r *Repository) attachSpanLinks(traceID string, spans []Span) error {
+	var links []SpanLink
+	if err := r.db.Where("trace_id = ?", traceID).Order("id").Find(&links).Error; err != nil {
+		return fmt.Errorf("failed to get span links: %w", err)
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	bySpan := make(map[string][]SpanLink)
+	for _, l := range links {
+		bySpan[l.SpanID] = append(bySpan[l.SpanID], l)
+	}
+	for i := range spans {
+		spans[i].Links = bySpan[spans[i].SpanID]
+	}
+	return nil
+}
+
+// GetRelatedTraces returns the traces connected to traceID by span links in either
+// direction, each with the links that connect them. A trace linked both ways appears
+// once per direction. Results are ordered by direction, then trace ID.
+//
+// Span links have no tenant of their own. A tenant-scoped repository only returns
+// links of a trace the tenant can see, to traces it can see, so Exists is always
+// true there.
+func (r *Repository) GetRelatedTraces(traceID string) ([]RelatedTrace, error) {
+	if r.tenant != "" {
+		var traces int64
+		if err := r.db.Model(&Trace{}).Where("trace_id = ?", traceID).Count(&traces).Error; err != nil {
+			return nil, fmt.Errorf("failed to look up trace: %w", err)
+		}
+		if traces == 0 {
+			return []RelatedTrace{}, nil
+		}
+	}
+
+	var links []SpanLink
+	if err := r.db.Where("trace_id = ? OR linked_trace_id = ?", traceID, traceID).Order("id").Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to get span links: %w", err)
+	}
+
+	type key struct{ traceID, direction string }
+	byKey := make(map[key]*RelatedTrace)
+	var ids []string
+	for _, l := range links {
+		// A link between two spans of traceID itself relates it to no other trace.
+		if l.TraceID == traceID && l.LinkedTraceID == traceID {
+			continue
+		}
+		k := key{l.LinkedTraceID, LinkDirectionLinksTo}
+		if l.LinkedTraceID == traceID {
+			k = key{l.TraceID, LinkDirectionLinkedFrom}
+		}
+		rt, ok := byKey[k]
+		if !ok {
+			rt = &RelatedTrace{TraceID: k.traceID, Direction: k.direction}
+			byKey[k] = rt
+			ids = append(ids, k.traceID)
+		}
+		rt.Links = append(rt.Links, l)
+	}
+
+	summaries := make(map[string]Trace)
+	for start := 0; start < len(ids); start += traceIDChunkSize {
+		var traces []Trace
+		chunk := ids[start:min(start+traceIDChunkSize, len(ids))]
+		if err := r.db.Select("trace_id", "service_name", "status", "has_error", "duration", "timestamp").
+			Where("trace_id IN ?", chunk).Find(&traces).Error; err != nil {
+			return nil, fmt.Errorf("failed to get linked traces: %w", err)
+		}
+		for _, t := range traces {
+			summaries[t.TraceID] = t
+		}
+	}
+
+	related := make([]RelatedTrace, 0, len(byKey))
+	for _, rt := range byKey {
+		t, ok := summaries[rt.TraceID]
+		if !ok && r.tenant != "" {
+			continue // not stored, or another tenant's
+		}
+		if ok {
+			rt.Exists = true
+			rt.ServiceName = t.ServiceName
+			rt.Status = t.Status
+			rt.HasError = t.HasError
+			rt.DurationMs = float64(t.Duration) / 1000.0 // µs → ms
+			rt.Timestamp = &t.Timestamp
+		}
+		related = append(related, *rt)
+	}
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Direction != related[j].Direction {
+			return related[i].Direction > related[j].Direction // links_to first
+		}
+		return related[i].TraceID < related[j].TraceID
+	})
+	return related, nil
+}
+
+// deleteSpanLinks removes the links of the traces selected by traces, which must be a
+// query on the traces table. Call it before deleting those traces.
+func deleteSpanLinks(db *gorm.DB, traces *gorm.DB) error {
+	return db.Where("trace_id IN (?)", traces.Select("trace_id")).Delete(&SpanLink{}).Error
+}
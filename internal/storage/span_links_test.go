@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// storeProducerConsumer stores a producer trace and a consumer trace whose CONSUMER
+// span links back to the PRODUCER span, as a messaging instrumentation would.
+func storeProducerConsumer(t *testing.T, repo *Repository, now time.Time) {
+	t.Helper()
+	if err := repo.BatchCreateTraces([]Trace{
+		{TraceID: "producer", ServiceName: "orders", Status: "STATUS_CODE_OK", Duration: 2000, Timestamp: now},
+		{TraceID: "consumer", ServiceName: "billing", Status: "STATUS_CODE_ERROR", HasError: true, Duration: 5000, Timestamp: now.Add(time.Second)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	spans := []Span{
+		{TraceID: "producer", SpanID: "p1", OperationName: "orders publish", Kind: SpanKindProducer, ServiceName: "orders", StartTime: now, EndTime: now},
+		{TraceID: "consumer", SpanID: "c1", OperationName: "orders process", Kind: SpanKindConsumer, ServiceName: "billing", StartTime: now, EndTime: now,
+			Links: []SpanLink{
+				{LinkedTraceID: "producer", LinkedSpanID: "p1", AttributesJSON: `{"messaging.operation":"process"}`},
+				{LinkedTraceID: "expired", LinkedSpanID: "e1"},
+			}},
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	// A retried export stores the links only once.
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpanLinksProducerConsumer(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	storeProducerConsumer(t, repo, now)
+
+	consumer, err := repo.GetTrace("consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if links := consumer.Spans[0].Links; len(links) != 2 || links[0].LinkedTraceID != "producer" || links[0].LinkedSpanID != "p1" ||
+		links[0].AttributesJSON != `{"messaging.operation":"process"}` {
+		t.Fatalf("consumer span links = %+v", links)
+	}
+
+	related, err := repo.GetRelatedTraces("consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 2 {
+		t.Fatalf("consumer related = %+v, want producer and the expired trace", related)
+	}
+	if p := related[1]; p.TraceID != "producer" || p.Direction != LinkDirectionLinksTo || !p.Exists ||
+		p.ServiceName != "orders" || p.DurationMs != 2 || len(p.Links) != 1 {
+		t.Errorf("producer = %+v", p)
+	}
+	if e := related[0]; e.TraceID != "expired" || e.Exists || e.Timestamp != nil {
+		t.Errorf("expired = %+v, want a link without a stored trace", e)
+	}
+
+	related, err = repo.GetRelatedTraces("producer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 1 || related[0].TraceID != "consumer" || related[0].Direction != LinkDirectionLinkedFrom ||
+		!related[0].HasError || related[0].Links[0].SpanID != "c1" {
+		t.Errorf("producer related = %+v, want the consumer linking to it", related)
+	}
+}
+
+func TestRelatedTracesStayWithinTenant(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	storeProducerConsumer(t, repo.withTenant("alpha"), now)
+	if err := repo.withTenant("beta").BatchCreateTraces([]Trace{{TraceID: "other", ServiceName: "shipping", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.withTenant("beta").BatchCreateSpans([]Span{{TraceID: "other", SpanID: "o1", OperationName: "orders process",
+		ServiceName: "shipping", StartTime: now, EndTime: now,
+		Links: []SpanLink{{LinkedTraceID: "producer", LinkedSpanID: "p1", AttributesJSON: `{"secret":"beta"}`}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	alpha := repo.ForTenant("alpha")
+	related, err := alpha.GetRelatedTraces("producer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 1 || related[0].TraceID != "consumer" {
+		t.Errorf("alpha producer related = %+v, want only alpha's consumer", related)
+	}
+	if related, err = alpha.GetRelatedTraces("consumer"); err != nil || len(related) != 1 || related[0].TraceID != "producer" {
+		t.Errorf("alpha consumer related = %+v, %v; want the producer without the unstored trace", related, err)
+	}
+	if related, err = repo.ForTenant("beta").GetRelatedTraces("producer"); err != nil || len(related) != 0 {
+		t.Errorf("beta related for alpha's trace = %+v, %v; want none", related, err)
+	}
+	if related, err = repo.ForTenant("beta").GetRelatedTraces("other"); err != nil || len(related) != 0 {
+		t.Errorf("beta related = %+v, %v; want none, the producer is alpha's", related, err)
+	}
+}
+
+func TestPurgeServiceDeletesSpanLinks(t *testing.T) {
+	repo := newTestRepository(t)
+	storeProducerConsumer(t, repo, time.Now().UTC())
+
+	if _, err := repo.PurgeService("billing", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	repo.db.Model(&SpanLink{}).Count(&n)
+	if n != 0 {
+		t.Errorf("%d span links left after purging the linking trace", n)
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+// SpanFilter defines criteria for listing individual spans.
+type SpanFilter struct {
+	ServiceName   string
+	OperationName string
+	TraceID       string
+	ScopeName     string
+	ScopeVersion  string
+	StartTime     time.Time
+	EndTime       time.Time
+	Limit         int
+	Offset        int
+}
+
+// GetSpans returns spans matching the filter, newest first, along with the total match count.
+func (r *Repository) GetSpans(filter SpanFilter) ([]Span, int64, error) {
+	var spans []Span
+	var total int64
+
+	base := r.db.Model(&Span{})
+	if filter.ServiceName != "" {
+		base = base.Where("service_name = ?", filter.ServiceName)
+	}
+	if filter.OperationName != "" {
+		base = base.Where("operation_name = ?", filter.OperationName)
+	}
+	if filter.TraceID != "" {
+		base = base.Where("trace_id = ?", filter.TraceID)
+	}
+	if filter.ScopeName != "" {
+		base = base.Where("scope_name = ?", filter.ScopeName)
+	}
+	if filter.ScopeVersion != "" {
+		base = base.Where("scope_version = ?", filter.ScopeVersion)
+	}
+	if !filter.StartTime.IsZero() {
+		base = base.Where("start_time >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		base = base.Where("start_time <= ?", filter.EndTime)
+	}
+
+	var g errgroup.Group
+	g.Go(func() error {
+		return base.Session(&gorm.Session{}).Count(&total).Error
+	})
+	g.Go(func() error {
+		return base.Session(&gorm.Session{}).
+			Order("start_time desc").
+			Limit(filter.Limit).
+			Offset(filter.Offset).
+			Find(&spans).Error
+	})
+	if err := g.Wait(); err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch spans: %w", err)
+	}
+	return spans, total, nil
+}
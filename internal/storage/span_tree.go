@@ -0,0 +1,85 @@
+package storage
+
+import "sort"
+
+// SpanNode is a span with its child spans, ordered by start time.
+type SpanNode struct {
+	Span     *Span
+	Children []*SpanNode
+	Orphan   bool // the parent span is not part of the trace
+}
+
+// BuildSpanTree links spans into trees by parent span ID and returns the top-level
+// nodes ordered by start time: root spans first, then orphans whose parent is missing
+// (e.g. not yet ingested, sampled out or purged). Spans caught in a parent cycle are
+// treated as orphans, so every span appears exactly once.
+func BuildSpanTree(spans []Span) []*SpanNode {
+	nodes := make([]*SpanNode, len(spans))
+	byID := make(map[string]int, len(spans))
+	for i := range spans {
+		nodes[i] = &SpanNode{Span: &spans[i]}
+		if _, dup := byID[spans[i].SpanID]; !dup {
+			byID[spans[i].SpanID] = i
+		}
+	}
+
+	children := make(map[int][]int)
+	var roots, orphans []int
+	for i, s := range spans {
+		p, ok := byID[s.ParentSpanID]
+		switch {
+		case isRootSpanID(s.ParentSpanID):
+			roots = append(roots, i)
+		case !ok || p == i:
+			orphans = append(orphans, i)
+		default:
+			children[p] = append(children[p], i)
+		}
+	}
+
+	attached := make([]bool, len(spans))
+	var attach func(i int) *SpanNode
+	attach = func(i int) *SpanNode {
+		attached[i] = true
+		n := nodes[i]
+		for _, c := range children[i] {
+			if !attached[c] {
+				n.Children = append(n.Children, attach(c))
+			}
+		}
+		sortSpanNodes(n.Children)
+		return n
+	}
+
+	var top, rest []*SpanNode
+	for _, i := range roots {
+		top = append(top, attach(i))
+	}
+	for _, i := range orphans {
+		nodes[i].Orphan = true
+		rest = append(rest, attach(i))
+	}
+	// Whatever is still unattached hangs off a parent cycle.
+	for i := range spans {
+		if !attached[i] {
+			nodes[i].Orphan = true
+			rest = append(rest, attach(i))
+		}
+	}
+	sortSpanNodes(top)
+	sortSpanNodes(rest)
+	return append(top, rest...)
+}
+
+func isRootSpanID(id string) bool {
+	for _, c := range id {
+		if c != '0' {
+			return false
+		}
+	}
+	return true
+}
+
+func sortSpanNodes(nodes []*SpanNode) {
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Span.StartTime.Before(nodes[j].Span.StartTime) })
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// The interfaces below split the Repository by consumer so that ingest, tsdb,
+// realtime and api can run against another backend (e.g. an analytics store such as
+// ClickHouse). *Repository implements all of them; an alternative backend only needs
+// the ones its consumers use, or Backend to serve everything.
+
+// TraceWriter persists traces and their spans. Traces are always written before the
+// spans that reference them.
+type TraceWriter interface {
+	BatchCreateTraces(traces []Trace) error
+	BatchCreateSpans(spans []Span) error
+}
+
+// LogWriter persists log records.
+type LogWriter interface {
+	BatchCreateLogs(logs []Log) error
+}
+
+// MetricWriter persists aggregated metric buckets.
+type MetricWriter interface {
+	BatchCreateMetrics(buckets []MetricBucket) error
+}
+
+// MetricCatalogWriter records what is known about each metric name.
+type MetricCatalogWriter interface {
+	SaveMetricCatalog(entries []MetricCatalog) error
+}
+
+// TraceReader serves trace and span queries.
+type TraceReader interface {
+	GetTrace(traceID string) (*Trace, error)
+	LookupTraceIDContext(ctx context.Context, id string) (traceID, kind string, err error)
+	GetRelatedTraces(traceID string) ([]RelatedTrace, error)
+	ExistingTraceIDs(traceIDs []string) (map[string]bool, error)
+	GetTracesFilteredContext(ctx context.Context, start, end time.Time, serviceNames []string, status, search string, limit, offset int, sortBy, orderBy string) (*TracesResponse, error)
+	QueryTracesContext(ctx context.Context, filter TraceFilter) (*TracesResponse, error)
+	GetTracesByLogsContext(ctx context.Context, logFilter LogFilter, traceFilter TraceFilter, maxTraces int) (*TracesByLogsResponse, error)
+	GetSpans(filter SpanFilter) ([]Span, int64, error)
+	GetTracePaths(q TracePathQuery) (*TracePathsResult, error)
+	GetOperationBaselines(ops []OperationKey, start, end time.Time) (map[OperationKey]*OperationBaseline, error)
+}
+
+// LogReader serves log queries.
+type LogReader interface {
+	GetLog(id uint) (*Log, error)
+	GetLogsV2Context(ctx context.Context, filter LogFilter) ([]Log, int64, error)
+	AttachTraceSummaries(logs []Log) error
+	GetLogContext(ctx context.Context, q LogContextQuery) (*LogContextPage, error)
+}
+
+// DashboardReader serves the aggregated views behind the dashboard, charts and
+// service map.
+type DashboardReader interface {
+	GetDashboardStatsContext(ctx context.Context, start, end time.Time, serviceNames []string) (*DashboardStats, error)
+	GetTrafficMetrics(start, end time.Time, serviceNames []string) ([]TrafficPoint, error)
+	GetTrafficByService(start, end time.Time, serviceNames []string, top int, loc *time.Location) (*TrafficByService, error)
+	GetLatencyHeatmap(start, end time.Time, serviceNames []string) ([]LatencyPoint, error)
+	GetLatencyHistogram(start, end time.Time, serviceNames []string, loc *time.Location) (*LatencyHeatmap, error)
+	GetLatencyByStatus(start, end time.Time, serviceNames []string, loc *time.Location) (*LatencyByStatus, error)
+	GetServiceMapMetricsContext(ctx context.Context, start, end time.Time) (*ServiceMapMetrics, error)
+	GetServiceMapContext(ctx context.Context, start, end time.Time, f ServiceMapFilter) (*ServiceMapMetrics, error)
+	GetServiceDependenciesContext(ctx context.Context, q DependencyQuery) (*DependencyHealthResult, error)
+	GetMetricBuckets(start, end time.Time, serviceName string, metricName string) ([]MetricBucket, error)
+	GetMetricNames(serviceName string) ([]string, error)
+	GetMetricCatalog(serviceName string) ([]MetricCatalog, error)
+	GetServices() ([]string, error)
+	GetEnvironments() ([]string, error)
+}
+
+// SLOStore manages SLO definitions and their evaluated status.
+type SLOStore interface {
+	CreateSLO(slo *SLO) error
+	GetSLO(id uint) (*SLO, error)
+	ListSLOs() ([]SLO, error)
+	UpdateSLO(slo *SLO) error
+	DeleteSLO(id uint) error
+	GetLatestSLOStatuses() ([]SLOStatus, error)
+}
+
+// QuotaStore manages per-service ingest quotas and their persisted daily usage.
+type QuotaStore interface {
+	ListServiceQuotas() ([]ServiceQuota, error)
+	UpsertServiceQuota(q *ServiceQuota) error
+	DeleteServiceQuota(service string) error
+	GetQuotaUsage(day string) ([]QuotaUsage, error)
+	SaveQuotaUsage(usage []QuotaUsage) error
+}
+
+// ServiceMetadataStore manages the owner, tier and links of services.
+type ServiceMetadataStore interface {
+	ListServiceMetadata() ([]ServiceMetadata, error)
+	UpsertServiceMetadata(m *ServiceMetadata) error
+	ImportServiceMetadata(rows []ServiceMetadata) error
+}
+
+// AnnotationStore manages user annotations on traces.
+type AnnotationStore interface {
+	CreateTraceAnnotation(a *TraceAnnotation) error
+	DeleteTraceAnnotations(traceID string, f AnnotationFilter) (int64, error)
+}
+
+// InsightFeedbackStore records ratings of AI insights and the suppression they drive.
+type InsightFeedbackStore interface {
+	CreateInsightFeedback(f *InsightFeedback) error
+	GetInsightSuppression(fingerprint string, suppressAfter int) (InsightSuppression, error)
+	GetInsightFeedbackSummary(suppressAfter int) ([]InsightFeedbackSummary, error)
+}
+
+// PurgeJobStore runs background purges in batches, with progress that survives a
+// restart.
+type PurgeJobStore interface {
+	CountPurgeable(cutoff time.Time) (int64, error)
+	CreatePurgeJob(cutoff time.Time) (*PurgeJob, error)
+	GetPurgeJob(id uint) (*PurgeJob, error)
+	ListUnfinishedPurgeJobs() ([]PurgeJob, error)
+	CancelPurgeJob(id uint) (*PurgeJob, error)
+	RunPurgeBatch(id uint, batchSize int) (*PurgeJob, error)
+}
+
+// LivenessStore persists when each service last exported, for the liveness tracker.
+type LivenessStore interface {
+	ListServiceLiveness() ([]ServiceLiveness, error)
+	SaveServiceLiveness(rows []ServiceLiveness) error
+}
+
+// AnomalyReader lists detected anomaly events.
+type AnomalyReader interface {
+	ListAnomalyEvents(filter AnomalyFilter) ([]AnomalyEvent, int64, error)
+}
+
+// AnomalyStore is what the anomaly detector reads traffic from and records the
+// anomalies it finds in.
+type AnomalyStore interface {
+	GetServiceTraffic(start, end time.Time) ([]ServiceTraffic, error)
+	CreateAnomalyEvent(ev *AnomalyEvent) error
+	PruneAnomalyEvents(olderThan time.Time) (int64, error)
+}
+
+// ReportReader serves the per-service aggregates behind scheduled reports.
+type ReportReader interface {
+	GetServiceTraffic(start, end time.Time) ([]ServiceTraffic, error)
+	GetServiceLatencyPercentiles(start, end time.Time, p float64) ([]ServiceLatency, error)
+}
+
+// ServiceMapHistoryStore keeps periodic service map snapshots for viewing past topology.
+type ServiceMapHistoryStore interface {
+	SaveServiceMapSnapshot(at time.Time, window time.Duration, m *ServiceMapMetrics) error
+	GetServiceMapSnapshotNear(at time.Time) (*ServiceMapSnapshot, error)
+	PruneServiceMapSnapshots(olderThan time.Time) (int64, error)
+}
+
+// TraceCompletenessStore decides which traces are missing spans.
+type TraceCompletenessStore interface {
+	ReconcileTraceCompleteness(ctx context.Context, after CompletenessCursor, until time.Time, limit int) (*CompletenessBatch, error)
+}
+
+// OutboxStore holds the notifications waiting for the outbox dispatcher.
+type OutboxStore interface {
+	PendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]OutboxEvent, error)
+	MarkOutboxDelivered(ctx context.Context, id uint, attempts int, at time.Time) error
+	RecordOutboxFailure(ctx context.Context, id uint, attempts int, errMsg string, at, retryAt time.Time) error
+	PruneOutboxEvents(olderThan time.Time) (int64, error)
+	GetOutboxStatus(ctx context.Context, state string, limit int) (*OutboxStatus, error)
+}
+
+// AuditStore records and lists calls to the admin endpoints.
+type AuditStore interface {
+	CreateAuditEntry(e *AuditEntry) error
+	ListAuditEntries(filter AuditFilter) ([]AuditEntry, int64, error)
+}
+
+// AdminStore covers statistics and the destructive maintenance operations.
+type AdminStore interface {
+	GetStats() (map[string]interface{}, error)
+	PurgeLogs(olderThan time.Time) (int64, error)
+	PurgeTraces(olderThan time.Time) (int64, error)
+	PurgeService(service string, before time.Time) (*ServicePurgeResult, error)
+	RemapService(from, to string) (*ServiceRemapResult, error)
+	DeleteMetricBuckets(start, end time.Time) (int64, error)
+	VacuumDB() error
+	CheckIntegrity(ctx context.Context, quick, repair bool) (*IntegrityReport, error)
+	Backup(ctx context.Context, dir string) (string, error)
+	Restore(ctx context.Context, path string) (*RestoreResult, error)
+	AuditIndexes() (*IndexAudit, error)
+}
+
+// Backend is everything a storage backend provides to the API server and ingest.
+type Backend interface {
+	TraceWriter
+	LogWriter
+	MetricWriter
+	TraceReader
+	LogReader
+	DashboardReader
+	SLOStore
+	QuotaStore
+	ServiceMetadataStore
+	AnnotationStore
+	InsightFeedbackStore
+	AnomalyReader
+	ServiceMapHistoryStore
+	AuditStore
+	AdminStore
+	PurgeJobStore
+	LivenessStore
+	OutboxStore
+}
+
+var (
+	_ TraceWriter     = (*Repository)(nil)
+	_ LogWriter       = (*Repository)(nil)
+	_ MetricWriter    = (*Repository)(nil)
+	_ TraceReader     = (*Repository)(nil)
+	_ LogReader       = (*Repository)(nil)
+	_ DashboardReader = (*Repository)(nil)
+	_ SLOStore        = (*Repository)(nil)
+	_ QuotaStore      = (*Repository)(nil)
+	_ AnnotationStore = (*Repository)(nil)
+	_ AnomalyReader   = (*Repository)(nil)
+	_ AnomalyStore    = (*Repository)(nil)
+	_ ReportReader    = (*Repository)(nil)
+	_ AuditStore      = (*Repository)(nil)
+	_ AdminStore      = (*Repository)(nil)
+	_ Backend         = (*Repository)(nil)
+	_ TenantScoper    = (*Repository)(nil)
+	_ TenantScoper    = (*DashboardCache)(nil)
+
+	_ EnvironmentScoper = (*Repository)(nil)
+	_ EnvironmentScoper = (*DashboardCache)(nil)
+
+	_ ServiceMapHistoryStore = (*Repository)(nil)
+	_ InsightFeedbackStore   = (*Repository)(nil)
+	_ PurgeJobStore          = (*Repository)(nil)
+	_ LivenessStore          = (*Repository)(nil)
+	_ MetricCatalogWriter    = (*Repository)(nil)
+	_ ServiceMetadataStore   = (*Repository)(nil)
+	_ TraceCompletenessStore = (*Repository)(nil)
+	_ OutboxStore            = (*Repository)(nil)
+)
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantSetting is the statement setting that holds the tenant of a scoped session.
+const tenantSetting = "otelcontext:tenant"
+
+// tenantTables are the tables whose rows belong to a tenant. The other tables hold
+// instance-wide configuration and derived state, which only the super-admin sees
+// when multi-tenancy is on.
+var tenantTables = map[string]bool{"traces": true, "spans": true, "logs": true, "metric_buckets": true, "metric_catalog": true,
+	"insight_feedbacks": true}
+
+// TenantScoper narrows a backend to one tenant's data.
+type TenantScoper interface {
+	ForTenant(tenant string) Backend
+}
+
+// ForTenant returns a repository that only reads, updates and deletes the rows of
+// tenant in the tenant tables, and stores new rows under it. It shares the
+// connection pool with r. An empty tenant returns r.
+//
+// Scoping is applied by GORM callbacks to every statement built from a model or
+// table name, so the repository methods need no tenant conditions of their own.
+// Raw SQL is not rewritten; the few raw reads left only look up rows by IDs that a
+// scoped query returned.
+func (r *Repository) ForTenant(t string) Backend {
+	return r.withTenant(t)
+}
+
+// withTenant is ForTenant returning the concrete repository.
+func (r *Repository) withTenant(t string) *Repository {
+	if t == "" {
+		return r
+	}
+	scoped := *r
+	scoped.tenant = t
+	scoped.db = r.db.Set(tenantSetting, t).WithContext(scoped.scopeContext(context.Background()))
+	return &scoped
+}
+
+// scopeContext adds the repository's tenant and environment to ctx, so that
+// statements GORM runs in a fresh session, such as preloads, stay scoped.
+func (r *Repository) scopeContext(ctx context.Context) context.Context {
+	if r.environment != "" {
+		ctx = context.WithValue(ctx, environmentKey{}, r.environment)
+	}
+	if r.tenant == "" {
+		return ctx
+	}
+	return tenant.NewContext(ctx, tenant.Identity{Tenant: r.tenant})
+}
+
+// statementTenant returns the tenant a statement is limited to, or "".
+func statementTenant(db *gorm.DB) string {
+	if v, ok := db.Get(tenantSetting); ok {
+		if t, _ := v.(string); t != "" {
+			return t
+		}
+	}
+	if db.Statement.Context != nil {
+		return tenant.Scope(db.Statement.Context)
+	}
+	return ""
+}
+
+// registerTenantScope installs the callbacks behind ForTenant.
+func registerTenantScope(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("tenant:scope_query", scopeToTenant),
+		cb.Row().Before("gorm:row").Register("tenant:scope_row", scopeToTenant),
+		cb.Update().Before("gorm:update").Register("tenant:scope_update", scopeToTenant),
+		cb.Delete().Before("gorm:delete").Register("tenant:scope_delete", scopeToTenant),
+		cb.Create().Before("gorm:create").Register("tenant:assign", assignTenant),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register tenant callbacks: %w", err)
+		}
+	}
+	return nil
+}
+
+// scopeToTenant adds "tenant_id = ?" to statements on tenant tables.
+func scopeToTenant(db *gorm.DB) {
+	stmt := db.Statement
+	if stmt.SQL.Len() > 0 || !tenantTables[stmt.Table] {
+		return
+	}
+	t := statementTenant(db)
+	if t == "" {
+		return
+	}
+	andWhere(stmt, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Value: t})
+}
+
+// andWhere adds cond to the statement's conditions. The existing ones are grouped
+// first, so an OR among them cannot bypass cond.
+func andWhere(stmt *gorm.Statement, cond clause.Expression) {
+	c, ok := stmt.Clauses["WHERE"]
+	if !ok {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{cond}})
+		return
+	}
+	where, _ := c.Expression.(clause.Where)
+	exprs := []clause.Expression{cond}
+	if len(where.Exprs) > 0 {
+		exprs = []clause.Expression{clause.AndConditions{Exprs: where.Exprs}, cond}
+	}
+	c.Expression = clause.Where{Exprs: exprs}
+	stmt.Clauses["WHERE"] = c
+}
+
+// assignTenant stores rows created through a scoped session under its tenant,
+// whatever TenantID they carried.
+func assignTenant(db *gorm.DB) {
+	stmt := db.Statement
+	if stmt.Schema == nil || !tenantTables[stmt.Table] || stmt.Schema.LookUpField("TenantID") == nil {
+		return
+	}
+	if t := statementTenant(db); t != "" {
+		stmt.SetColumn("TenantID", t, true)
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestForTenantIsolatesTelemetry(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, tn := range []string{"alpha", "beta"} {
+		id := tn + "-trace"
+		if err := repo.BatchCreateTraces([]Trace{{TraceID: id, TenantID: tn, ServiceName: tn + "-api", Timestamp: now}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateSpans([]Span{{TraceID: id, SpanID: "s1", TenantID: tn, ServiceName: tn + "-api", OperationName: "GET /", StartTime: now, EndTime: now}}); err != nil {
+			t.Fatal(err)
+		}
+		// Same content in both tenants: each keeps its own copy.
+		if err := repo.BatchCreateLogs([]Log{{TraceID: id, TenantID: tn, ServiceName: "shared", Severity: "ERROR", Body: "boom", Timestamp: now}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateMetrics([]MetricBucket{{Name: "cpu", TenantID: tn, ServiceName: "shared", TimeBucket: now, Count: 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Rows stored without a tenant belong to the default one.
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "legacy", ServiceName: "old", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+
+	alpha := repo.ForTenant("alpha")
+	traces, err := alpha.QueryTracesContext(ctx, TraceFilter{Limit: 10})
+	if err != nil || traces.Total != 1 || traces.Traces[0].TraceID != "alpha-trace" {
+		t.Fatalf("alpha traces = %+v, %v; want only alpha-trace", traces, err)
+	}
+	if _, err := alpha.GetTrace("beta-trace"); err == nil {
+		t.Error("alpha can read beta-trace")
+	}
+	trace, err := alpha.GetTrace("alpha-trace")
+	if err != nil || len(trace.Spans) != 1 || len(trace.Logs) != 1 {
+		t.Errorf("alpha-trace = %+v, %v; want its span and log preloaded", trace, err)
+	}
+
+	// Search matches body OR trace_id; the OR must not widen the scope.
+	logs, total, err := alpha.GetLogsV2Context(ctx, LogFilter{Search: "beta", Limit: 10})
+	if err != nil || total != 0 {
+		t.Errorf("alpha search for beta = %d logs (%v), want 0", total, err)
+	}
+	logs, total, err = alpha.GetLogsV2Context(ctx, LogFilter{Search: "alpha", Limit: 10})
+	if err != nil || total != 1 || logs[0].TenantID != "alpha" {
+		t.Errorf("alpha logs = %+v (%d, %v), want alpha's", logs, total, err)
+	}
+
+	buckets, err := alpha.GetMetricBuckets(now.Add(-time.Minute), now.Add(time.Minute), "shared", "cpu")
+	if err != nil || len(buckets) != 1 || buckets[0].TenantID != "alpha" {
+		t.Errorf("alpha metric buckets = %+v, %v", buckets, err)
+	}
+	services, _ := alpha.GetServices()
+	if len(services) != 1 || services[0] != "alpha-api" {
+		t.Errorf("alpha services = %v, want [alpha-api]", services)
+	}
+	if def, _ := repo.ForTenant("default").GetServices(); len(def) != 1 || def[0] != "old" {
+		t.Errorf("default services = %v, want [old]", def)
+	}
+	if all, _ := repo.GetServices(); len(all) != 3 {
+		t.Errorf("unscoped services = %v, want all three", all)
+	}
+
+	// Deletes and creates stay within the tenant.
+	if n, err := alpha.PurgeLogs(now.Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("alpha PurgeLogs = %d, %v; want 1", n, err)
+	}
+	if _, total, _ := repo.ForTenant("beta").GetLogsV2Context(ctx, LogFilter{Limit: 10}); total != 1 {
+		t.Errorf("beta logs after alpha purge = %d, want 1", total)
+	}
+	if err := alpha.BatchCreateLogs([]Log{{TenantID: "beta", ServiceName: "x", Severity: "INFO", Body: "imported", Timestamp: now}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := alpha.GetLogsV2Context(ctx, LogFilter{ServiceName: "x", Limit: 10}); total != 1 {
+		t.Errorf("log created through alpha's scope not visible to alpha")
+	}
+}
+
+func TestTenantMigrationDefaultsExistingRows(t *testing.T) {
+	repo := newTestRepository(t)
+	m := repo.db.Migrator()
+	if err := m.DropIndex(&Log{}, "idx_logs_tenant_id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DropColumn(&Log{}, "TenantID"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.db.Exec("INSERT INTO logs (service_name, severity, timestamp) VALUES ('old', 'INFO', ?)", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateBaseline(repo.db, "sqlite"); err != nil {
+		t.Fatalf("migrateBaseline() error = %v", err)
+	}
+	var tenants []string
+	repo.db.Model(&Log{}).Pluck("tenant_id", &tenants)
+	if len(tenants) != 1 || tenants[0] != "default" {
+		t.Errorf("tenant_id of a pre-existing log = %v, want [default]", tenants)
+	}
+}
+
+func TestForEnvironmentComposesWithForTenant(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, row := range []struct{ tenant, env string }{{"alpha", "prod"}, {"alpha", "staging"}, {"beta", "prod"}} {
+		id := row.tenant + "-" + row.env
+		if err := repo.BatchCreateTraces([]Trace{{TraceID: id, TenantID: row.tenant, Environment: row.env, ServiceName: "api", Timestamp: now}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateSpans([]Span{{TraceID: id, SpanID: "s1", TenantID: row.tenant, Environment: row.env, ServiceName: "api", StartTime: now, EndTime: now}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.BatchCreateLogs([]Log{{TraceID: id, TenantID: row.tenant, Environment: row.env, ServiceName: "api", Severity: "ERROR", Body: "boom", Timestamp: now}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alphaProd := repo.ForTenant("alpha").(EnvironmentScoper).ForEnvironment("prod")
+	traces, err := alphaProd.QueryTracesContext(ctx, TraceFilter{Limit: 10})
+	if err != nil || traces.Total != 1 || traces.Traces[0].TraceID != "alpha-prod" {
+		t.Fatalf("alpha prod traces = %+v, %v; want only alpha-prod", traces, err)
+	}
+	if _, err := alphaProd.GetTrace("alpha-staging"); err == nil {
+		t.Error("alpha prod can read alpha-staging")
+	}
+	if trace, err := alphaProd.GetTrace("alpha-prod"); err != nil || len(trace.Spans) != 1 || len(trace.Logs) != 1 {
+		t.Errorf("alpha-prod = %+v, %v; want its span and log preloaded", trace, err)
+	}
+
+	// Either order gives the same scope.
+	betaProd := repo.ForEnvironment("prod").(TenantScoper).ForTenant("beta")
+	if _, total, err := betaProd.GetLogsV2Context(ctx, LogFilter{Limit: 10}); err != nil || total != 1 {
+		t.Errorf("beta prod logs = %d, %v; want 1", total, err)
+	}
+
+	if envs, err := repo.ForTenant("beta").GetEnvironments(); err != nil || len(envs) != 1 || envs[0] != "prod" {
+		t.Errorf("beta environments = %v, %v; want [prod]", envs, err)
+	}
+	if envs, _ := repo.GetEnvironments(); len(envs) != 2 {
+		t.Errorf("environments = %v, want prod and staging", envs)
+	}
+}
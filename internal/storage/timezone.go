@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// bucketBounds returns the boundaries of the buckets of width step covering
+// [start, end], aligned in loc (nil: UTC): one more than the number of buckets, the
+// last being the end of the final bucket. Day buckets run from local midnight to
+// local midnight, so a day with a DST change has 23 or 25 hours; shorter buckets
+// have a fixed width, aligned to loc's offset at start. Bounds are in loc.
+func bucketBounds(start, end time.Time, step time.Duration, loc *time.Location) []time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	var bounds []time.Time
+	if step >= 24*time.Hour {
+		days := int(step / (24 * time.Hour))
+		y, m, d := start.In(loc).Date()
+		for i := 0; ; i += days {
+			t := time.Date(y, m, d+i, 0, 0, 0, 0, loc)
+			bounds = append(bounds, t)
+			if t.After(end) {
+				return bounds
+			}
+		}
+	}
+	_, off := start.In(loc).Zone()
+	shift := time.Duration(off) * time.Second
+	for t := start.Add(shift).Truncate(step).Add(-shift).In(loc); ; t = t.Add(step) {
+		bounds = append(bounds, t)
+		if t.After(end) {
+			return bounds
+		}
+	}
+}
+
+// bucketIndex returns the bucket of bounds holding t, or -1 when t is outside them.
+func bucketIndex(bounds []time.Time, t time.Time) int {
+	i := sort.Search(len(bounds), func(i int) bool { return bounds[i].After(t) }) - 1
+	if i >= len(bounds)-1 {
+		return -1
+	}
+	return i
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBucketBoundsDSTDays(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata unavailable:", err)
+	}
+	hours := func(bounds []time.Time) []float64 {
+		var out []float64
+		for i := 1; i < len(bounds); i++ {
+			out = append(out, bounds[i].Sub(bounds[i-1]).Hours())
+		}
+		return out
+	}
+
+	cases := []struct {
+		name       string
+		start, end time.Time
+		want       []float64
+	}{
+		{"spring forward", time.Date(2026, 3, 7, 12, 0, 0, 0, ny), time.Date(2026, 3, 9, 12, 0, 0, 0, ny), []float64{24, 23, 24}},
+		{"fall back", time.Date(2026, 10, 31, 12, 0, 0, 0, ny), time.Date(2026, 11, 2, 12, 0, 0, 0, ny), []float64{24, 25, 24}},
+	}
+	for _, c := range cases {
+		bounds := bucketBounds(c.start, c.end, 24*time.Hour, ny)
+		if got := hours(bounds); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s: day bucket hours = %v, want %v", c.name, got, c.want)
+		}
+		for _, b := range bounds {
+			if b.Location() != ny || b.Hour() != 0 || b.Minute() != 0 {
+				t.Errorf("%s: bound %v is not local midnight", c.name, b)
+			}
+		}
+	}
+
+	// Hour buckets over a local day: 23 on the spring-forward day, 25 on the fall-back day.
+	for day, want := range map[int]int{8: 23, 1: 25} {
+		month := time.March
+		if day == 1 {
+			month = time.November
+		}
+		start := time.Date(2026, month, day, 0, 0, 0, 0, ny)
+		end := time.Date(2026, month, day+1, 0, 0, 0, 0, ny).Add(-time.Nanosecond)
+		if n := len(bucketBounds(start, end, time.Hour, ny)) - 1; n != want {
+			t.Errorf("%v: %d hour buckets, want %d", start.Format("2006-01-02"), n, want)
+		}
+	}
+}
+
+func TestBucketIndex(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bounds := bucketBounds(start, start.Add(3*time.Hour-time.Second), time.Hour, nil)
+	if len(bounds) != 4 {
+		t.Fatalf("len(bounds) = %d, want 4", len(bounds))
+	}
+	cases := map[time.Duration]int{-time.Second: -1, 0: 0, 90 * time.Minute: 1, 3*time.Hour - time.Second: 2, 3 * time.Hour: -1}
+	for at, want := range cases {
+		if got := bucketIndex(bounds, start.Add(at)); got != want {
+			t.Errorf("bucketIndex(+%v) = %d, want %d", at, got, want)
+		}
+	}
+}
+
+// Times written and queried in a non-UTC local zone are stored and compared as UTC.
+func TestStorageNormalizesToUTC(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata unavailable:", err)
+	}
+	orig := time.Local
+	time.Local = ny
+	t.Cleanup(func() { time.Local = orig })
+
+	repo := newTestRepository(t)
+	// 23:30 local is 04:30 UTC the next day: compared as text with its offset, it would
+	// sort before an 01:00 UTC bound.
+	at := time.Date(2026, 3, 7, 23, 30, 0, 0, ny)
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "late", ServiceName: "api", Timestamp: at}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored Trace
+	if err := repo.db.Where("trace_id = ?", "late").First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Timestamp.Equal(at) {
+		t.Errorf("stored timestamp = %v, want %v", stored.Timestamp, at)
+	}
+
+	var n int64
+	if err := repo.db.Model(&Trace{}).Where("timestamp >= ?", time.Date(2026, 3, 8, 1, 0, 0, 0, time.UTC)).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("traces after 01:00 UTC = %d, want 1", n)
+	}
+	if err := repo.db.Model(&Trace{}).Where("timestamp < ?", time.Date(2026, 3, 7, 23, 0, 0, 0, ny)).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("traces before 23:00 local = %d, want 0", n)
+	}
+}
+
+func TestGetTrafficByServiceInZone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata unavailable:", err)
+	}
+	repo := newTestRepository(t)
+	// The spring-forward day: 23 hours, 276 five-minute buckets.
+	start := time.Date(2026, 3, 8, 0, 0, 0, 0, ny)
+	end := time.Date(2026, 3, 9, 0, 0, 0, 0, ny).Add(-time.Second)
+	traces := []Trace{
+		{TraceID: "a", ServiceName: "api", Timestamp: start.Add(time.Minute)},
+		{TraceID: "b", ServiceName: "api", Timestamp: time.Date(2026, 3, 8, 3, 2, 0, 0, ny)},
+	}
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetTrafficByService(start, end, nil, 0, ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.StepSeconds != 300 || len(got.Series) != 1 {
+		t.Fatalf("got step %ds, %d series; want 300s, 1", got.StepSeconds, len(got.Series))
+	}
+	pts := got.Series[0].Points
+	if len(pts) != 23*12 {
+		t.Errorf("%d points, want %d", len(pts), 23*12)
+	}
+	if !pts[0].Timestamp.Equal(start) || pts[0].Timestamp.Location() != ny || pts[0].Count != 1 {
+		t.Errorf("first point = %+v, want 1 request at local midnight", pts[0])
+	}
+	// 02:00-03:00 does not exist, so 03:00 EDT starts the third hour of the day.
+	if pts[24].Count != 1 || pts[24].Timestamp.Hour() != 3 {
+		t.Errorf("point 24 = %+v, want 1 request at 03:00", pts[24])
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Bounds on trace annotations.
+const (
+	MaxAnnotationsPerTrace = 50
+	maxAnnotationKey       = 64
+	maxAnnotationValue     = 255
+	maxAnnotationAuthor    = 128
+)
+
+// ErrInvalidAnnotation is returned for annotations that are empty or over a size or
+// count limit.
+var ErrInvalidAnnotation = errors.New("invalid annotation")
+
+// AnnotationFilter matches traces that carry the annotation Key, and, when Value is
+// set, with that value.
+type AnnotationFilter struct {
+	Key   string
+	Value string
+}
+
+// CreateTraceAnnotation adds a to its trace. It returns gorm.ErrRecordNotFound when
+// the trace does not exist and ErrInvalidAnnotation when a limit is exceeded.
+func (r *Repository) CreateTraceAnnotation(a *TraceAnnotation) error {
+	a.Key = strings.TrimSpace(a.Key)
+	switch {
+	case a.Key == "":
+		return fmt.Errorf("%w: key is required", ErrInvalidAnnotation)
+	case len(a.Key) > maxAnnotationKey:
+		return fmt.Errorf("%w: key exceeds %d bytes", ErrInvalidAnnotation, maxAnnotationKey)
+	case len(a.Value) > maxAnnotationValue:
+		return fmt.Errorf("%w: value exceeds %d bytes", ErrInvalidAnnotation, maxAnnotationValue)
+	case len(a.Author) > maxAnnotationAuthor:
+		return fmt.Errorf("%w: author exceeds %d bytes", ErrInvalidAnnotation, maxAnnotationAuthor)
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Write-lock the trace row first, so concurrent annotations of one trace are
+		// counted and inserted one after another instead of all passing the cap check.
+		// A no-op update locks on every driver, where FOR UPDATE is not portable.
+		if err := tx.Model(&Trace{}).Where("trace_id = ?", a.TraceID).UpdateColumn("trace_id", gorm.Expr("trace_id")).Error; err != nil {
+			return fmt.Errorf("failed to lock trace: %w", err)
+		}
+		var traces int64
+		if err := tx.Model(&Trace{}).Where("trace_id = ?", a.TraceID).Count(&traces).Error; err != nil {
+			return fmt.Errorf("failed to look up trace: %w", err)
+		}
+		if traces == 0 {
+			return fmt.Errorf("failed to annotate trace: %w", gorm.ErrRecordNotFound)
+		}
+		var existing int64
+		if err := tx.Model(&TraceAnnotation{}).Where("trace_id = ?", a.TraceID).Count(&existing).Error; err != nil {
+			return fmt.Errorf("failed to count annotations: %w", err)
+		}
+		if existing >= MaxAnnotationsPerTrace {
+			return fmt.Errorf("%w: trace already has %d annotations", ErrInvalidAnnotation, MaxAnnotationsPerTrace)
+		}
+		if err := tx.Create(a).Error; err != nil {
+			return fmt.Errorf("failed to create annotation: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteTraceAnnotations removes the trace's annotations with the given key, and the
+// given value if set. It returns gorm.ErrRecordNotFound when none matched.
+func (r *Repository) DeleteTraceAnnotations(traceID string, f AnnotationFilter) (int64, error) {
+	if r.tenant != "" {
+		// Annotations have no tenant of their own; they belong to their trace's.
+		var traces int64
+		if err := r.db.Model(&Trace{}).Where("trace_id = ?", traceID).Count(&traces).Error; err != nil {
+			return 0, fmt.Errorf("failed to look up trace: %w", err)
+		}
+		if traces == 0 {
+			return 0, fmt.Errorf("failed to delete annotations: %w", gorm.ErrRecordNotFound)
+		}
+	}
+	q := r.db.Where("trace_id = ? AND annotation_key = ?", traceID, f.Key)
+	if f.Value != "" {
+		q = q.Where("annotation_value = ?", f.Value)
+	}
+	res := q.Delete(&TraceAnnotation{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete annotations: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return 0, fmt.Errorf("failed to delete annotations: %w", gorm.ErrRecordNotFound)
+	}
+	return res.RowsAffected, nil
+}
+
+// whereAnnotations restricts a traces query to traces matching every filter.
+func (r *Repository) whereAnnotations(q *gorm.DB, filters []AnnotationFilter) *gorm.DB {
+	for _, f := range filters {
+		sub := r.db.Model(&TraceAnnotation{}).Select("trace_id").Where("annotation_key = ?", f.Key)
+		if f.Value != "" {
+			sub = sub.Where("annotation_value = ?", f.Value)
+		}
+		q = q.Where("trace_id IN (?)", sub)
+	}
+	return q
+}
+
+// deleteTraceAnnotations removes the annotations of the traces selected by traces,
+// which must be a query on the traces table. Call it before deleting those traces.
+func deleteTraceAnnotations(db *gorm.DB, traces *gorm.DB) error {
+	return db.Where("trace_id IN (?)", traces.Select("trace_id")).Delete(&TraceAnnotation{}).Error
+}
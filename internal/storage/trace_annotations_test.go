@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestTraceAnnotations(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	if err := repo.BatchCreateTraces([]Trace{
+		{TraceID: "t-old", ServiceName: "checkout", Timestamp: now.Add(-48 * time.Hour)},
+		{TraceID: "t-new", ServiceName: "checkout", Timestamp: now.Add(-time.Minute)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []TraceAnnotation{
+		{TraceID: "t-old", Key: "root_cause", Author: "sam"},
+		{TraceID: "t-old", Key: "ticket", Value: "INC-1"},
+		{TraceID: "t-new", Key: "ticket", Value: "INC-2"},
+	} {
+		if err := repo.CreateTraceAnnotation(&a); err != nil {
+			t.Fatalf("CreateTraceAnnotation(%s) error = %v", a.Key, err)
+		}
+	}
+
+	tr, err := repo.GetTrace("t-old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Annotations) != 2 || tr.Annotations[0].Author != "sam" || tr.Annotations[0].CreatedAt.IsZero() {
+		t.Errorf("GetTrace annotations = %+v, want root_cause by sam and ticket", tr.Annotations)
+	}
+
+	list := func(filters ...AnnotationFilter) []string {
+		t.Helper()
+		res, err := repo.QueryTraces(TraceFilter{Annotations: filters, Limit: 10, SortBy: "trace_id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, tr := range res.Traces {
+			ids = append(ids, tr.TraceID)
+		}
+		return ids
+	}
+	for _, tt := range []struct {
+		filters []AnnotationFilter
+		want    string
+	}{
+		{[]AnnotationFilter{{Key: "root_cause"}}, "[t-old]"},
+		{[]AnnotationFilter{{Key: "ticket"}}, "[t-new t-old]"},
+		{[]AnnotationFilter{{Key: "ticket", Value: "INC-2"}}, "[t-new]"},
+		{[]AnnotationFilter{{Key: "ticket"}, {Key: "root_cause"}}, "[t-old]"},
+		{[]AnnotationFilter{{Key: "ticket", Value: "INC-3"}}, "[]"},
+	} {
+		if got := fmt.Sprint(list(tt.filters...)); got != tt.want {
+			t.Errorf("annotation filter %+v = %s, want %s", tt.filters, got, tt.want)
+		}
+	}
+
+	if _, err := repo.DeleteTraceAnnotations("t-new", AnnotationFilter{Key: "ticket", Value: "INC-9"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("deleting a missing annotation: err = %v, want ErrRecordNotFound", err)
+	}
+	if n, err := repo.DeleteTraceAnnotations("t-new", AnnotationFilter{Key: "ticket"}); err != nil || n != 1 {
+		t.Errorf("DeleteTraceAnnotations() = %d, %v; want 1", n, err)
+	}
+}
+
+func TestTraceAnnotationLimits(t *testing.T) {
+	repo := newTestRepository(t)
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "t1", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range []TraceAnnotation{
+		{TraceID: "t1", Key: "  "},
+		{TraceID: "t1", Key: strings.Repeat("k", maxAnnotationKey+1)},
+		{TraceID: "t1", Key: "note", Value: strings.Repeat("v", maxAnnotationValue+1)},
+	} {
+		if err := repo.CreateTraceAnnotation(&a); !errors.Is(err, ErrInvalidAnnotation) {
+			t.Errorf("CreateTraceAnnotation(key %d bytes, value %d bytes) err = %v, want ErrInvalidAnnotation", len(a.Key), len(a.Value), err)
+		}
+	}
+	if err := repo.CreateTraceAnnotation(&TraceAnnotation{TraceID: "nope", Key: "k"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("annotating a missing trace: err = %v, want ErrRecordNotFound", err)
+	}
+
+	for i := 0; i < MaxAnnotationsPerTrace; i++ {
+		if err := repo.CreateTraceAnnotation(&TraceAnnotation{TraceID: "t1", Key: fmt.Sprintf("k%d", i)}); err != nil {
+			t.Fatalf("annotation %d: %v", i, err)
+		}
+	}
+	if err := repo.CreateTraceAnnotation(&TraceAnnotation{TraceID: "t1", Key: "one-too-many"}); !errors.Is(err, ErrInvalidAnnotation) {
+		t.Errorf("annotation over the cap: err = %v, want ErrInvalidAnnotation", err)
+	}
+}
+
+func TestTraceAnnotationCapUnderConcurrency(t *testing.T) {
+	repo := newTestRepository(t)
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "t1", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MaxAnnotationsPerTrace-3; i++ {
+		if err := repo.CreateTraceAnnotation(&TraceAnnotation{TraceID: "t1", Key: fmt.Sprintf("k%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := range 20 {
+		wg.Go(func() {
+			errs <- repo.CreateTraceAnnotation(&TraceAnnotation{TraceID: "t1", Key: fmt.Sprintf("race%d", i)})
+		})
+	}
+	wg.Wait()
+	close(errs)
+	var created int
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrInvalidAnnotation):
+			t.Errorf("CreateTraceAnnotation() = %v, want success or the cap", err)
+		}
+	}
+	var total int64
+	repo.db.Model(&TraceAnnotation{}).Where("trace_id = ?", "t1").Count(&total)
+	if created != 3 || total != MaxAnnotationsPerTrace {
+		t.Errorf("created %d, %d in total; want 3 more, reaching exactly %d", created, total, MaxAnnotationsPerTrace)
+	}
+}
+
+// Annotations go away with their trace, whichever way the trace is purged.
+func TestTraceAnnotationsCascadeOnPurge(t *testing.T) {
+	now := time.Now()
+	seed := func(t *testing.T) *Repository {
+		repo := newTestRepository(t)
+		if err := repo.BatchCreateTraces([]Trace{
+			{TraceID: "old", ServiceName: "noisy", Timestamp: now.Add(-48 * time.Hour)},
+			{TraceID: "new", ServiceName: "quiet", Timestamp: now},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{"old", "new"} {
+			if err := repo.CreateTraceAnnotation(&TraceAnnotation{TraceID: id, Key: "investigated"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return repo
+	}
+	remaining := func(t *testing.T, repo *Repository) string {
+		var ids []string
+		repo.db.Model(&TraceAnnotation{}).Order("trace_id").Pluck("trace_id", &ids)
+		return fmt.Sprint(ids)
+	}
+
+	t.Run("retention", func(t *testing.T) {
+		repo := seed(t)
+		if _, err := repo.PurgeTraces(now.Add(-24 * time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if got := remaining(t, repo); got != "[new]" {
+			t.Errorf("annotations after purge = %s, want [new]", got)
+		}
+	})
+	t.Run("archived", func(t *testing.T) {
+		repo := seed(t)
+		repo.SetPurgeArchiver(func([]Trace) error { return nil })
+		if _, err := repo.PurgeTraces(now.Add(-24 * time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if got := remaining(t, repo); got != "[new]" {
+			t.Errorf("annotations after archived purge = %s, want [new]", got)
+		}
+	})
+	t.Run("archive refused", func(t *testing.T) {
+		repo := seed(t)
+		repo.SetPurgeArchiver(func([]Trace) error { return errors.New("disk full") })
+		if _, err := repo.PurgeTraces(now.Add(-24 * time.Hour)); err == nil {
+			t.Fatal("purge succeeded although archiving failed")
+		}
+		if got := remaining(t, repo); got != "[new old]" {
+			t.Errorf("annotations after refused purge = %s, want both kept", got)
+		}
+	})
+	t.Run("service", func(t *testing.T) {
+		repo := seed(t)
+		if _, err := repo.PurgeService("noisy", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := remaining(t, repo); got != "[new]" {
+			t.Errorf("annotations after service purge = %s, want [new]", got)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trace completeness, as set by ReconcileTraceCompleteness.
+const (
+	TraceCompletenessUnknown = "unknown"  // not checked yet, or no spans stored
+	TraceComplete            = "complete" // every span's parent was received
+	TracePartial             = "partial"  // some span's parent is missing: sampled out, dropped or still in flight
+)
+
+// CompletenessCursor is where a reconciler left off: the last trace it checked, in
+// UpdatedAt, ID order. The zero cursor starts from the oldest trace.
+type CompletenessCursor struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint      `json:"id"`
+}
+
+// CompletenessBatch is the outcome of one ReconcileTraceCompleteness call.
+type CompletenessBatch struct {
+	Checked int                // traces checked; fewer than the limit once caught up
+	Partial int                // of them found partial
+	Next    CompletenessCursor // where the next call continues
+}
+
+// recordSpansReceived adds a stored batch of spans to the spans_received counts of
+// their traces. Bumping updated_at hands the traces to the reconciler again.
+func (r *Repository) recordSpansReceived(spans []Span) error {
+	perTrace := make(map[string]int)
+	for _, s := range spans {
+		perTrace[s.TraceID]++
+	}
+	// One UPDATE per distinct count; most batches carry a handful.
+	byCount := make(map[int][]string)
+	for id, n := range perTrace {
+		byCount[n] = append(byCount[n], id)
+	}
+	for n, ids := range byCount {
+		for start := 0; start < len(ids); start += traceIDChunkSize {
+			chunk := ids[start:min(start+traceIDChunkSize, len(ids))]
+			if err := r.db.Model(&Trace{}).Where("trace_id IN ?", chunk).
+				Update("spans_received", gorm.Expr("spans_received + ?", n)).Error; err != nil {
+				return fmt.Errorf("failed to count received spans: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ReconcileTraceCompleteness checks up to limit traces modified after the cursor and
+// no later than until, oldest first. A trace is partial when one of its spans names
+// a parent span the trace does not have, complete otherwise, and stays unknown while
+// it has no spans. Its idle percentage (see ComputeTraceTimeline) is stored alongside.
+// Callers keep until a settling window behind ingest so spans still on their way are
+// not taken for missing.
+//
+// The result is written without touching updated_at, so a trace is only checked
+// again once more spans arrive for it.
+func (r *Repository) ReconcileTraceCompleteness(ctx context.Context, after CompletenessCursor, until time.Time, limit int) (*CompletenessBatch, error) {
+	// Spans may not have reached a replica yet.
+	db := r.primary().WithContext(ctx)
+	var traces []Trace
+	if err := db.Select("id", "trace_id", "updated_at").
+		Where("updated_at <= ?", until).
+		Where("updated_at > ? OR (updated_at = ? AND id > ?)", after.UpdatedAt, after.UpdatedAt, after.ID).
+		Order("updated_at, id").Limit(limit).
+		Find(&traces).Error; err != nil {
+		return nil, fmt.Errorf("failed to list modified traces: %w", err)
+	}
+	batch := &CompletenessBatch{Checked: len(traces), Next: after}
+	if len(traces) == 0 {
+		return batch, nil
+	}
+	last := traces[len(traces)-1]
+	batch.Next = CompletenessCursor{UpdatedAt: last.UpdatedAt, ID: last.ID}
+
+	ids := make([]string, len(traces))
+	for i, t := range traces {
+		ids[i] = t.TraceID
+	}
+	var spans []Span
+	if err := db.Select("trace_id", "span_id", "parent_span_id", "start_time", "duration").
+		Where("trace_id IN ?", ids).Find(&spans).Error; err != nil {
+		return nil, fmt.Errorf("failed to load spans of modified traces: %w", err)
+	}
+	type traceSpans struct {
+		ids     map[string]bool
+		parents []string
+		spans   []Span
+	}
+	byTrace := make(map[string]*traceSpans, len(traces))
+	for _, s := range spans {
+		ts := byTrace[s.TraceID]
+		if ts == nil {
+			ts = &traceSpans{ids: make(map[string]bool)}
+			byTrace[s.TraceID] = ts
+		}
+		ts.ids[s.SpanID] = true
+		if s.ParentSpanID != "" {
+			ts.parents = append(ts.parents, s.ParentSpanID)
+		}
+		ts.spans = append(ts.spans, s)
+	}
+
+	// Group the updates by outcome: most traces are complete with nothing missing.
+	type outcome struct {
+		completeness string
+		missing      int
+	}
+	byOutcome := make(map[outcome][]uint)
+	idle := make(map[uint]float64, len(traces))
+	for _, t := range traces {
+		o := outcome{completeness: TraceCompletenessUnknown}
+		if ts := byTrace[t.TraceID]; ts != nil {
+			idle[t.ID] = ComputeTraceTimeline(ts.spans).IdlePercentage
+			for _, p := range ts.parents {
+				if !ts.ids[p] {
+					o.missing++
+				}
+			}
+			o.completeness = TraceComplete
+			if o.missing > 0 {
+				o.completeness = TracePartial
+				batch.Partial++
+			}
+		}
+		byOutcome[o] = append(byOutcome[o], t.ID)
+	}
+	for o, traceIDs := range byOutcome {
+		if err := db.Model(&Trace{}).Where("id IN ?", traceIDs).
+			UpdateColumns(map[string]interface{}{"completeness": o.completeness, "missing_parents": o.missing}).Error; err != nil {
+			return nil, fmt.Errorf("failed to store trace completeness: %w", err)
+		}
+	}
+	if err := storeIdlePercentages(db, idle); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// storeIdlePercentages sets the idle_percentage of traces by ID. The values differ
+// from trace to trace, so each chunk is one UPDATE with a CASE over the IDs.
+func storeIdlePercentages(db *gorm.DB, idle map[uint]float64) error {
+	ids := make([]uint, 0, len(idle))
+	for id := range idle {
+		ids = append(ids, id)
+	}
+	for start := 0; start < len(ids); start += traceIDChunkSize {
+		chunk := ids[start:min(start+traceIDChunkSize, len(ids))]
+		args := make([]any, 0, 2*len(chunk))
+		for _, id := range chunk {
+			args = append(args, id, idle[id])
+		}
+		expr := gorm.Expr("CASE id "+strings.Repeat("WHEN ? THEN ? ", len(chunk))+"END", args...)
+		if err := db.Model(&Trace{}).Where("id IN ?", chunk).UpdateColumn("idle_percentage", expr).Error; err != nil {
+			return fmt.Errorf("failed to store trace idle time: %w", err)
+		}
+	}
+	return nil
+}
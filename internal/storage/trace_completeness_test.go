@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// storeTrace writes a trace row and the given spans, each as {spanID, parentSpanID}.
+func storeTrace(t *testing.T, repo *Repository, traceID string, spans ...[2]string) {
+	t.Helper()
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: traceID, ServiceName: "checkout", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	storeSpans(t, repo, traceID, spans...)
+}
+
+func storeSpans(t *testing.T, repo *Repository, traceID string, spans ...[2]string) {
+	t.Helper()
+	rows := make([]Span, len(spans))
+	for i, s := range spans {
+		rows[i] = Span{TraceID: traceID, SpanID: s[0], ParentSpanID: s[1], OperationName: "op", ServiceName: "checkout", StartTime: time.Now()}
+	}
+	if err := repo.BatchCreateSpans(rows); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func traceCompleteness(t *testing.T, repo *Repository, traceID string) Trace {
+	t.Helper()
+	var tr Trace
+	if err := repo.db.Where("trace_id = ?", traceID).First(&tr).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestReconcileTraceCompleteness(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	storeTrace(t, repo, "complete", [2]string{"a", ""}, [2]string{"b", "a"}, [2]string{"c", "b"})
+	// The payment span "p" is withheld: its child arrives, it does not.
+	storeTrace(t, repo, "partial", [2]string{"r", ""}, [2]string{"q", "p"}, [2]string{"s", "p"})
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "nospans", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := repo.ReconcileTraceCompleteness(ctx, CompletenessCursor{}, time.Now(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Checked != 3 || batch.Partial != 1 {
+		t.Fatalf("batch = %+v, want 3 checked, 1 partial", batch)
+	}
+	for id, want := range map[string]struct {
+		completeness      string
+		received, missing int
+	}{
+		"complete": {TraceComplete, 3, 0},
+		"partial":  {TracePartial, 3, 2},
+		"nospans":  {TraceCompletenessUnknown, 0, 0},
+	} {
+		if got := traceCompleteness(t, repo, id); got.Completeness != want.completeness || got.SpansReceived != want.received || got.MissingParents != want.missing {
+			t.Errorf("%s: completeness %s, spans_received %d, missing_parents %d; want %+v",
+				id, got.Completeness, got.SpansReceived, got.MissingParents, want)
+		}
+	}
+
+	// Nothing changed since: the next run has nothing to do.
+	next, err := repo.ReconcileTraceCompleteness(ctx, batch.Next, time.Now(), 100)
+	if err != nil || next.Checked != 0 {
+		t.Fatalf("rerun = %+v, %v; want nothing checked", next, err)
+	}
+
+	// The withheld span finally arrives; only that trace is checked again.
+	time.Sleep(10 * time.Millisecond)
+	storeSpans(t, repo, "partial", [2]string{"p", "r"})
+	next, err = repo.ReconcileTraceCompleteness(ctx, next.Next, time.Now(), 100)
+	if err != nil || next.Checked != 1 || next.Partial != 0 {
+		t.Fatalf("after the late span = %+v, %v; want the one trace checked, now complete", next, err)
+	}
+	if got := traceCompleteness(t, repo, "partial"); got.Completeness != TraceComplete || got.SpansReceived != 4 || got.MissingParents != 0 {
+		t.Errorf("partial trace after the late span = %s, %d received, %d missing", got.Completeness, got.SpansReceived, got.MissingParents)
+	}
+
+	// A retried export stores nothing and is not counted again.
+	storeSpans(t, repo, "complete", [2]string{"a", ""}, [2]string{"b", "a"})
+	if got := traceCompleteness(t, repo, "complete"); got.SpansReceived != 3 {
+		t.Errorf("spans_received after a duplicate export = %d, want 3", got.SpansReceived)
+	}
+}
+
+func TestReconcileTraceCompletenessWaitsForSettling(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	storeTrace(t, repo, "old", [2]string{"a", ""})
+	settled := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	storeTrace(t, repo, "fresh", [2]string{"x", "missing"})
+
+	batch, err := repo.ReconcileTraceCompleteness(ctx, CompletenessCursor{}, settled, 100)
+	if err != nil || batch.Checked != 1 {
+		t.Fatalf("batch = %+v, %v; want only the settled trace", batch, err)
+	}
+	if got := traceCompleteness(t, repo, "fresh"); got.Completeness != TraceCompletenessUnknown {
+		t.Errorf("unsettled trace completeness = %s, want unknown", got.Completeness)
+	}
+
+	// Paging: one trace per call still reaches every trace once.
+	var cursor CompletenessCursor
+	seen := 0
+	for range 5 {
+		b, err := repo.ReconcileTraceCompleteness(ctx, cursor, time.Now(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Checked == 0 {
+			break
+		}
+		seen += b.Checked
+		cursor = b.Next
+	}
+	if seen != 2 {
+		t.Errorf("paged through %d traces, want 2", seen)
+	}
+	if got := traceCompleteness(t, repo, "fresh"); got.Completeness != TracePartial {
+		t.Errorf("fresh trace completeness = %s, want partial", got.Completeness)
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of ID recognized by ParseExactID.
+const (
+	IDKindTrace = "trace" // 32 hex digits
+	IDKindSpan  = "span"  // 16 hex digits
+)
+
+// ErrNotAnID is returned by LookupTraceIDContext for input that is neither a full
+// trace ID nor a full span ID.
+var ErrNotAnID = errors.New("not a 32-character trace ID or 16-character span ID")
+
+// ParseExactID reports whether s, ignoring surrounding space and case, is a whole
+// trace or span ID, and returns it in the lowercase form IDs are stored in. kind is
+// "" for anything else, including partial IDs.
+func ParseExactID(s string) (id, kind string) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", ""
+		}
+	}
+	switch len(s) {
+	case 32:
+		return s, IDKindTrace
+	case 16:
+		return s, IDKindSpan
+	}
+	return "", ""
+}
+
+// whereExactID limits a query on traces to the trace with the given ID, or the trace
+// owning the given span, by indexed equality.
+func whereExactID(db, query *gorm.DB, id, kind string) *gorm.DB {
+	if kind == IDKindSpan {
+		return query.Where("trace_id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&Span{}).Select("trace_id").Where("span_id = ?", id))
+	}
+	return query.Where("trace_id = ?", id)
+}
+
+// LookupTraceIDContext resolves a pasted trace or span ID to the ID of its trace.
+// kind says which of the two id was. It returns ErrNotAnID for other input and
+// gorm.ErrRecordNotFound when no stored trace matches.
+func (r *Repository) LookupTraceIDContext(ctx context.Context, id string) (traceID, kind string, err error) {
+	id, kind = ParseExactID(id)
+	if kind == "" {
+		return "", "", ErrNotAnID
+	}
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+
+	var ids []string
+	if err := whereExactID(db, db.Model(&Trace{}), id, kind).Limit(1).Pluck("trace_id", &ids).Error; err != nil {
+		return "", "", fmt.Errorf("failed to look up %s ID: %w", kind, err)
+	}
+	if len(ids) == 0 {
+		return "", kind, gorm.ErrRecordNotFound
+	}
+	return ids[0], kind, nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestParseExactID(t *testing.T) {
+	for _, tc := range []struct{ in, id, kind string }{
+		{"4bf92f3577b34da6a3ce929d0e0e4736", "4bf92f3577b34da6a3ce929d0e0e4736", IDKindTrace},
+		{" 4BF92F3577B34DA6A3CE929D0E0E4736\n", "4bf92f3577b34da6a3ce929d0e0e4736", IDKindTrace},
+		{"00F067AA0BA902B7", "00f067aa0ba902b7", IDKindSpan},
+		{"4bf92f3577b34da6", "4bf92f3577b34da6", IDKindSpan},
+		{"4bf92f3577b34da6a3ce", "", ""},                 // partial trace ID
+		{"4bf92f3577b34da6a3ce929d0e0e473g", "", ""},     // not hex
+		{"4bf92f35-77b3-4da6-a3ce-929d0e0e4736", "", ""}, // UUID form
+		{"4bf92f3577b34da6a3ce929d0e0e47360", "", ""},    // one digit too many
+		{"", "", ""},
+	} {
+		if id, kind := ParseExactID(tc.in); id != tc.id || kind != tc.kind {
+			t.Errorf("ParseExactID(%q) = %q, %q; want %q, %q", tc.in, id, kind, tc.id, tc.kind)
+		}
+	}
+}
+
+func TestTraceSearchByExactID(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	const (
+		traceA = "4bf92f3577b34da6a3ce929d0e0e4736"
+		traceB = "4bf92f3577b34da6a3ce929d0e0e9999" // shares a long prefix with traceA
+		spanA  = "00f067aa0ba902b7"
+	)
+	if err := repo.BatchCreateTraces([]Trace{
+		{TraceID: traceA, ServiceName: "api", Timestamp: now},
+		{TraceID: traceB, ServiceName: "api", Timestamp: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateSpans([]Span{
+		{TraceID: traceA, SpanID: spanA, ServiceName: "api", OperationName: "GET /", StartTime: now},
+		{TraceID: traceB, SpanID: "a3ce929d0e0e9999", ServiceName: "api", OperationName: "GET /", StartTime: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// QueryTracesContext runs its count and page queries concurrently.
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+	repo.db.Callback().Query().After("gorm:query").Register("test:traces", func(db *gorm.DB) {
+		if db.Statement.Table == "traces" && !db.DryRun {
+			mu.Lock()
+			queries = append(queries, db.Statement.SQL.String())
+			mu.Unlock()
+		}
+	})
+	search := func(s string) []string {
+		t.Helper()
+		mu.Lock()
+		queries = nil
+		mu.Unlock()
+		resp, err := repo.QueryTracesContext(context.Background(), TraceFilter{Search: s, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, tr := range resp.Traces {
+			ids = append(ids, tr.TraceID)
+		}
+		return ids
+	}
+	usedLike := func() bool { return strings.Contains(strings.Join(queries, " "), "LIKE") }
+
+	if ids := search(strings.ToUpper(traceA)); len(ids) != 1 || ids[0] != traceA || usedLike() {
+		t.Errorf("search by trace ID = %v with %q, want only %s by equality", ids, queries, traceA)
+	}
+	if ids := search(strings.ToUpper(spanA)); len(ids) != 1 || ids[0] != traceA || usedLike() {
+		t.Errorf("search by span ID = %v with %q, want the owning trace by equality", ids, queries)
+	}
+	if ids := search("4bf92f3577b34da6a3ce"); len(ids) != 2 || !usedLike() {
+		t.Errorf("search by partial ID = %v with %q, want both traces by substring", ids, queries)
+	}
+
+	if id, kind, err := repo.LookupTraceIDContext(context.Background(), strings.ToUpper(spanA)); err != nil || id != traceA || kind != IDKindSpan {
+		t.Errorf("LookupTraceIDContext(span) = %q, %q, %v; want %s", id, kind, err, traceA)
+	}
+	if id, kind, err := repo.LookupTraceIDContext(context.Background(), traceB); err != nil || id != traceB || kind != IDKindTrace {
+		t.Errorf("LookupTraceIDContext(trace) = %q, %q, %v; want %s", id, kind, err, traceB)
+	}
+	if _, _, err := repo.LookupTraceIDContext(context.Background(), "ffffffffffffffff"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("LookupTraceIDContext(unknown span) error = %v, want ErrRecordNotFound", err)
+	}
+	if _, _, err := repo.LookupTraceIDContext(context.Background(), "4bf92f"); !errors.Is(err, ErrNotAnID) {
+		t.Errorf("LookupTraceIDContext(partial) error = %v, want ErrNotAnID", err)
+	}
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/query"
+	"gorm.io/gorm"
+)
+
+// MaxQuerySpanScan bounds the spans read to evaluate one span.attr comparison.
+// Span attributes are stored compressed, so they are matched in Go rather than in
+// SQL; the most recent spans in the time range are scanned first.
+const MaxQuerySpanScan = 100_000
+
+// queryOps whitelists the SQL operators a query comparison may use.
+var queryOps = map[query.Op]string{
+	query.OpEq: "=",
+	query.OpNe: "<>",
+	query.OpGt: ">",
+	query.OpGe: ">=",
+	query.OpLt: "<",
+	query.OpLe: "<=",
+}
+
+// queryStatusPatterns maps query status values to the stored status they match,
+// the same substring match as TraceFilter.Status.
+var queryStatusPatterns = map[string]string{
+	query.StatusOK:    "%OK%",
+	query.StatusError: "%ERROR%",
+	query.StatusUnset: "%UNSET%",
+}
+
+// whereTraceQuery translates a parsed query into a grouped condition on the
+// traces table. Span conditions become trace_id subqueries; start and end, when
+// set, bound the spans scanned for span.attr. The traces a span.attr comparison
+// matches are stored in ids, which may be nil for queries without one.
+func (r *Repository) whereTraceQuery(db *gorm.DB, e query.Expr, start, end time.Time, ids *traceIDTable) (*gorm.DB, error) {
+	cond := db.Session(&gorm.Session{NewDB: true})
+	switch e := e.(type) {
+	case *query.Binary:
+		left, err := r.whereTraceQuery(db, e.Left, start, end, ids)
+		if err != nil {
+			return nil, err
+		}
+		right, err := r.whereTraceQuery(db, e.Right, start, end, ids)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == query.OpOr {
+			return cond.Where(left).Or(right), nil
+		}
+		return cond.Where(left).Where(right), nil
+
+	case *query.Comparison:
+		op, ok := queryOps[e.Op]
+		if !ok {
+			return nil, fmt.Errorf("unsupported operator %q", e.Op)
+		}
+		spans := db.Session(&gorm.Session{NewDB: true}).Model(&Span{}).Select("trace_id")
+		switch e.Field {
+		case query.FieldService:
+			return cond.Where("service_name "+op+" ?", e.Value.Str), nil
+		case query.FieldTraceID:
+			return cond.Where("trace_id "+op+" ?", e.Value.Str), nil
+		case query.FieldStatus:
+			like := "LIKE"
+			if e.Op == query.OpNe {
+				like = "NOT LIKE"
+			}
+			return cond.Where("status "+like+" ?", queryStatusPatterns[e.Value.Str]), nil
+		case query.FieldDuration:
+			return cond.Where("duration "+op+" ?", e.Value.Dur.Microseconds()), nil
+		case query.FieldSpanName:
+			return cond.Where("trace_id IN (?)", spans.Where("operation_name "+op+" ?", e.Value.Str)), nil
+		case query.FieldSpanService:
+			return cond.Where("trace_id IN (?)", spans.Where("service_name "+op+" ?", e.Value.Str)), nil
+		case query.FieldSpanAttr:
+			matched, err := traceIDsWithSpanAttr(db, e, start, end)
+			if err != nil {
+				return nil, err
+			}
+			if len(matched) == 0 {
+				return cond.Where("1 = 0"), nil
+			}
+			if ids == nil {
+				return nil, errors.New("span.attr comparison without a trace ID table")
+			}
+			return ids.in(matched)
+		}
+		return nil, fmt.Errorf("unsupported field %q", e.Field)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", e)
+}
+
+// hasSpanAttr reports whether e compares a span attribute.
+func hasSpanAttr(e query.Expr) bool {
+	switch e := e.(type) {
+	case *query.Binary:
+		return hasSpanAttr(e.Left) || hasSpanAttr(e.Right)
+	case *query.Comparison:
+		return e.Field == query.FieldSpanAttr
+	}
+	return false
+}
+
+// traceIDTable is a temporary table holding the traces span.attr comparisons
+// matched, one set per comparison. There can be as many as MaxQuerySpanScan, far
+// more than a statement may bind (2100 parameters on SQL Server, 32766 on SQLite).
+// The table belongs to the connection of db, which every statement using it must
+// run on.
+type traceIDTable struct {
+	db   *gorm.DB
+	name string
+	sets int
+}
+
+// traceIDRow is a row of a traceIDTable.
+type traceIDRow struct {
+	SetID   int
+	TraceID string
+}
+
+// traceIDTableSeq names traceIDTables, so that one left behind on a pooled
+// connection by a failed drop cannot collide with the next.
+var traceIDTableSeq atomic.Int64
+
+// newTraceIDTable creates an empty traceIDTable on conn, a single connection.
+func newTraceIDTable(conn *gorm.DB, driver string) (*traceIDTable, error) {
+	name := fmt.Sprintf("query_trace_ids_%d", traceIDTableSeq.Add(1))
+	create := "CREATE TEMPORARY TABLE " + name
+	if driver == "sqlserver" {
+		name = "#" + name
+		create = "CREATE TABLE " + name
+	}
+	if err := conn.Exec(create + " (set_id INT NOT NULL, trace_id VARCHAR(32) NOT NULL, PRIMARY KEY (set_id, trace_id))").Error; err != nil {
+		return nil, fmt.Errorf("failed to create trace ID table: %w", err)
+	}
+	return &traceIDTable{db: conn, name: name}, nil
+}
+
+// in stores traceIDs, which must be distinct, as a new set and returns the condition
+// matching trace_id against it.
+func (t *traceIDTable) in(traceIDs []string) (*gorm.DB, error) {
+	t.sets++
+	rows := make([]traceIDRow, len(traceIDs))
+	for i, id := range traceIDs {
+		rows[i] = traceIDRow{SetID: t.sets, TraceID: id}
+	}
+	if err := t.db.Table(t.name).CreateInBatches(rows, traceIDChunkSize).Error; err != nil {
+		return nil, fmt.Errorf("failed to store matched trace IDs: %w", err)
+	}
+	return t.db.Session(&gorm.Session{NewDB: true}).
+		Where("trace_id IN (SELECT trace_id FROM "+t.name+" WHERE set_id = ?)", t.sets), nil
+}
+
+// drop removes the table from its connection, which goes back to the pool.
+func (t *traceIDTable) drop() {
+	if err := t.db.Exec("DROP TABLE " + t.name).Error; err != nil {
+		slog.Warn("Failed to drop trace ID table", "table", t.name, "error", err)
+	}
+}
+
+// traceIDsWithSpanAttr returns the traces with a span whose attribute c.Key
+// satisfies c, among the last MaxQuerySpanScan spans in the time range.
+func traceIDsWithSpanAttr(db *gorm.DB, c *query.Comparison, start, end time.Time) ([]string, error) {
+	q := db.Session(&gorm.Session{NewDB: true}).Model(&Span{}).
+		Select("trace_id", "attributes_json").Order("id DESC").Limit(MaxQuerySpanScan)
+	if !start.IsZero() && !end.IsZero() {
+		q = q.Where("start_time BETWEEN ? AND ?", start, end)
+	}
+	rows, err := q.Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan spans: %w", err)
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{c.Key: true}
+	seen := make(map[string]bool)
+	var ids []string
+	for rows.Next() {
+		var s Span
+		if err := db.ScanRows(rows, &s); err != nil {
+			return nil, fmt.Errorf("failed to scan spans: %w", err)
+		}
+		if seen[s.TraceID] {
+			continue
+		}
+		v, ok := indexedAttributes(string(s.AttributesJSON), keys)[c.Key]
+		if ok && matchAttr(v, c.Op, c.Value) {
+			seen[s.TraceID] = true
+			ids = append(ids, s.TraceID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan spans: %w", err)
+	}
+	return ids, nil
+}
+
+// matchAttr compares a stored attribute value with a query value: numerically
+// when the query value is a number and the attribute parses as one, otherwise as
+// strings (only = and != then).
+func matchAttr(got string, op query.Op, want query.Value) bool {
+	if want.Kind == query.KindNumber {
+		n, err := strconv.ParseFloat(got, 64)
+		if err != nil {
+			return op == query.OpNe
+		}
+		switch op {
+		case query.OpEq:
+			return n == want.Num
+		case query.OpNe:
+			return n != want.Num
+		case query.OpGt:
+			return n > want.Num
+		case query.OpGe:
+			return n >= want.Num
+		case query.OpLt:
+			return n < want.Num
+		case query.OpLe:
+			return n <= want.Num
+		}
+		return false
+	}
+	switch op {
+	case query.OpEq:
+		return got == want.Str
+	case query.OpNe:
+		return got != want.Str
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/query"
+	"gorm.io/gorm"
+)
+
+func mustParse(t *testing.T, q string) query.Expr {
+	t.Helper()
+	e, err := query.Parse(q)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", q, err)
+	}
+	return e
+}
+
+func TestTraceQuerySQL(t *testing.T) {
+	repo := newTestRepository(t)
+	tests := []struct {
+		q    string
+		want []string // fragments of the WHERE clause, in order
+	}{
+		{`service="payment"`, []string{"service_name = ?"}},
+		{`service!=payment`, []string{"service_name <> ?"}},
+		{`trace_id="abc"`, []string{"trace_id = ?"}},
+		{`duration>=500ms`, []string{"duration >= ?"}},
+		{`status=error`, []string{"status LIKE ?"}},
+		{`status!=ok`, []string{"status NOT LIKE ?"}},
+		{`span.name="GET /cart"`, []string{"trace_id IN (SELECT `trace_id` FROM `spans` WHERE operation_name = ?"}},
+		{`span.service!="db"`, []string{"trace_id IN (SELECT `trace_id` FROM `spans` WHERE service_name <> ?"}},
+		{`service=a && duration<1s`, []string{"(service_name = ? AND duration < ?)"}},
+		{`service=a || service=b && status=error`, []string{"(service_name = ? OR (service_name = ? AND status LIKE ?))"}},
+		{`(service=a || service=b) && status=error`, []string{"((service_name = ? OR service_name = ?) AND status LIKE ?)"}},
+		{`span.attr["k"]="v"`, []string{"1 = 0"}}, // no spans stored
+	}
+	for _, tt := range tests {
+		cond, err := repo.whereTraceQuery(repo.db, mustParse(t, tt.q), time.Time{}, time.Time{}, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.q, err)
+			continue
+		}
+		stmt := repo.db.Session(&gorm.Session{DryRun: true}).Model(&Trace{}).Where(cond).Find(&[]Trace{}).Statement
+		sql := stmt.SQL.String()
+		rest := sql
+		for _, frag := range tt.want {
+			i := strings.Index(rest, frag)
+			if i < 0 {
+				t.Errorf("%s: SQL %q lacks %q", tt.q, sql, frag)
+				break
+			}
+			rest = rest[i+len(frag):]
+		}
+	}
+}
+
+func TestTraceQueryBindsValues(t *testing.T) {
+	repo := newTestRepository(t)
+	cond, err := repo.whereTraceQuery(repo.db, mustParse(t, `duration>1.5s && status=error && service="x' OR 1=1 --"`), time.Time{}, time.Time{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := repo.db.Session(&gorm.Session{DryRun: true}).Model(&Trace{}).Where(cond).Find(&[]Trace{}).Statement
+	if got := fmt.Sprint(stmt.Vars); got != "[1500000 %ERROR% x' OR 1=1 --]" {
+		t.Errorf("bound vars = %s, want the duration in µs, the status pattern and the raw service", got)
+	}
+	if strings.Contains(stmt.SQL.String(), "1=1") {
+		t.Errorf("value leaked into SQL: %s", stmt.SQL.String())
+	}
+}
+
+func TestGetTracesByQuery(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	traces := []Trace{
+		{TraceID: "t-slow-err", ServiceName: "payment-service", Timestamp: now.Add(-3 * time.Minute), Duration: 900_000, Status: "STATUS_CODE_ERROR"},
+		{TraceID: "t-fast-err", ServiceName: "payment-service", Timestamp: now.Add(-2 * time.Minute), Duration: 100_000, Status: "STATUS_CODE_ERROR"},
+		{TraceID: "t-slow-ok", ServiceName: "payment-service", Timestamp: now.Add(-time.Minute), Duration: 700_000, Status: "STATUS_CODE_OK"},
+		{TraceID: "t-other", ServiceName: "frontend", Timestamp: now, Duration: 800_000, Status: "STATUS_CODE_ERROR"},
+	}
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+	attrs := func(code int) CompressedText {
+		return CompressedText(fmt.Sprintf(`[{"key":"http.status_code","value":{"Value":{"IntValue":%d}}}]`, code))
+	}
+	var spans []Span
+	for i, tr := range traces {
+		code := 200
+		if tr.TraceID == "t-slow-err" || tr.TraceID == "t-other" {
+			code = 504
+		}
+		spans = append(spans,
+			Span{TraceID: tr.TraceID, SpanID: fmt.Sprintf("%016x", 2*i), ServiceName: tr.ServiceName, OperationName: "charge", StartTime: tr.Timestamp, AttributesJSON: attrs(code)},
+			Span{TraceID: tr.TraceID, SpanID: fmt.Sprintf("%016x", 2*i+1), ServiceName: "db", OperationName: "SELECT", StartTime: tr.Timestamp},
+		)
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(q string) string {
+		t.Helper()
+		res, err := repo.QueryTraces(TraceFilter{Query: mustParse(t, q), Limit: 10, SortBy: "trace_id"})
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		var ids []string
+		for _, tr := range res.Traces {
+			ids = append(ids, tr.TraceID)
+		}
+		if int(res.Total) != len(ids) {
+			t.Errorf("%s: total %d for %d traces", q, res.Total, len(ids))
+		}
+		return fmt.Sprint(ids)
+	}
+	for _, tt := range []struct{ q, want string }{
+		{`service="payment-service" && duration>500ms && status=error && span.attr["http.status_code"]=504`, "[t-slow-err]"},
+		{`service="payment-service" && duration>500ms`, "[t-slow-err t-slow-ok]"},
+		{`status=error && span.attr["http.status_code"]>=500`, "[t-other t-slow-err]"},
+		{`span.attr["http.status_code"]<300`, "[t-fast-err t-slow-ok]"},
+		{`span.attr["http.status_code"]="504"`, "[t-other t-slow-err]"},
+		{`span.attr["missing"]=1`, "[]"},
+		{`service=frontend || status=ok`, "[t-other t-slow-ok]"},
+		{`span.service=db && span.name=charge && duration<=100ms`, "[t-fast-err]"},
+		{`trace_id="t-other"`, "[t-other]"},
+	} {
+		if got := list(tt.q); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestGetTracesByQueryManyMatches(t *testing.T) {
+	repo := newTestRepository(t)
+	// More matching traces than SQLite binds in one statement (32766)
+	const n = 40_000
+	now := time.Now()
+	traces := make([]Trace, n)
+	spans := make([]Span, n)
+	for i := range n {
+		id := fmt.Sprintf("%032x", i)
+		traces[i] = Trace{TraceID: id, ServiceName: "web", Timestamp: now}
+		spans[i] = Span{TraceID: id, SpanID: fmt.Sprintf("%016x", i), ServiceName: "web", OperationName: "GET", StartTime: now,
+			AttributesJSON: `{"http.status_code":200}`}
+	}
+	// Small batches: the SQLite driver binds parameters in quadratic time
+	if err := repo.db.CreateInBatches(traces, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.db.CreateInBatches(spans, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		q     string
+		total int64
+	}{
+		{`span.attr["http.status_code"]=200`, n},
+		{`span.attr["http.status_code"]=200 && span.attr["http.status_code"]<300 && trace_id!="` + traces[0].TraceID + `"`, n - 1},
+		{`span.attr["http.status_code"]=404 || service=web`, n},
+	} {
+		res, err := repo.QueryTraces(TraceFilter{Query: mustParse(t, tt.q), Limit: 10, SortBy: "trace_id"})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.q, err)
+		}
+		if res.Total != tt.total || len(res.Traces) != 10 {
+			t.Errorf("%s: total %d with %d on the page, want %d with 10", tt.q, res.Total, len(res.Traces), tt.total)
+		}
+	}
+}
+
+func TestMatchAttr(t *testing.T) {
+	num := query.Value{Kind: query.KindNumber, Num: 504, Str: "504"}
+	str := query.Value{Kind: query.KindString, Str: "GET"}
+	for _, tt := range []struct {
+		got  string
+		op   query.Op
+		want query.Value
+		ok   bool
+	}{
+		{"504", query.OpEq, num, true},
+		{"504.0", query.OpEq, num, true},
+		{"500", query.OpLt, num, true},
+		{"500", query.OpGe, num, false},
+		{"n/a", query.OpEq, num, false},
+		{"n/a", query.OpNe, num, true},
+		{"GET", query.OpEq, str, true},
+		{"POST", query.OpNe, str, true},
+		{"GET", query.OpGt, str, false},
+	} {
+		if got := matchAttr(tt.got, tt.op, tt.want); got != tt.ok {
+			t.Errorf("matchAttr(%q, %s, %+v) = %v, want %v", tt.got, tt.op, tt.want, got, tt.ok)
+		}
+	}
+}
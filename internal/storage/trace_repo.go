@@ -1,15 +1,17 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/RandomCodeSpace/otelcontext/internal/query"
 	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 // TracesResponse represents the response for the traces endpoint with pagination
@@ -26,6 +28,8 @@ type ServiceMapNode struct {
 	TotalTraces  int64   `json:"total_traces"`
 	ErrorCount   int64   `json:"error_count"`
 	AvgLatencyMs float64 `json:"avg_latency_ms"`
+
+	Metadata *ServiceMetadata `json:"metadata,omitempty"` // from the service catalog, added by the API
 }
 
 // ServiceMapEdge represents a connection between two services.
@@ -43,15 +47,34 @@ type ServiceMapMetrics struct {
 	Edges []ServiceMapEdge `json:"edges"`
 }
 
-// BatchCreateSpans inserts multiple spans in batches.
+// BatchCreateSpans inserts multiple spans in batches, together with their links, and
+// counts them in their traces' spans_received. Spans already stored (same trace and
+// span ID), e.g. from a retried export, are skipped; when the whole batch was, the
+// counts are left alone.
 func (r *Repository) BatchCreateSpans(spans []Span) error {
 	if len(spans) == 0 {
 		return nil
 	}
-	if err := r.db.CreateInBatches(spans, 500).Error; err != nil {
-		return fmt.Errorf("failed to batch create spans: %w", err)
+	type spanKey struct{ trace, span string }
+	seen := make(map[spanKey]bool, len(spans))
+	unique := make([]Span, 0, len(spans))
+	for _, s := range spans {
+		if k := (spanKey{s.TraceID, s.SpanID}); !seen[k] {
+			seen[k] = true
+			unique = append(unique, s)
+		}
 	}
-	return nil
+	res := r.createInBatches(r.ignoreDuplicates(), BatchTableSpans, unique, len(unique))
+	if res.Error != nil {
+		return fmt.Errorf("failed to batch create spans: %w", res.Error)
+	}
+	r.recordDuplicates("spans", int64(len(spans))-res.RowsAffected)
+	if res.RowsAffected > 0 {
+		if err := r.recordSpansReceived(unique); err != nil {
+			return err
+		}
+	}
+	return r.saveSpanLinks(unique)
 }
 
 // BatchCreateTraces inserts traces, skipping duplicates.
@@ -59,29 +82,112 @@ func (r *Repository) BatchCreateTraces(traces []Trace) error {
 	if len(traces) == 0 {
 		return nil
 	}
-	if strings.ToLower(r.driver) == "mysql" {
-		return r.db.Clauses(clause.Insert{Modifier: "IGNORE"}).Create(&traces).Error
+	if err := r.createInBatches(r.ignoreDuplicates(), BatchTableTraces, traces, len(traces)).Error; err != nil {
+		return err
+	}
+	return r.rollupTraceErrors(traces)
+}
+
+// rollupTraceErrors flags traces with a failed span as HasError. The insert above
+// skips rows whose trace already exists, so an error span arriving after the trace
+// row was written (or after a successful sibling in the same batch) is applied here.
+func (r *Repository) rollupTraceErrors(traces []Trace) error {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, t := range traces {
+		if t.HasError && !seen[t.TraceID] {
+			seen[t.TraceID] = true
+			ids = append(ids, t.TraceID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := r.db.Model(&Trace{}).
+		Where("trace_id IN ? AND has_error = ?", ids, false).
+		Update("has_error", true).Error; err != nil {
+		return fmt.Errorf("failed to roll up trace errors: %w", err)
 	}
-	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&traces).Error
+	return nil
+}
+
+// TraceSpanCounts returns the number of spans stored for each of the given traces
+// that exists, from its spans_received count.
+func (r *Repository) TraceSpanCounts(traceIDs []string) (map[string]int, error) {
+	counts := make(map[string]int, len(traceIDs))
+	for start := 0; start < len(traceIDs); start += traceIDChunkSize {
+		chunk := traceIDs[start:min(start+traceIDChunkSize, len(traceIDs))]
+		var rows []Trace
+		// Spans may not have reached a replica yet.
+		if err := r.primary().Select("trace_id", "spans_received").Where("trace_id IN ?", chunk).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to count trace spans: %w", err)
+		}
+		for _, t := range rows {
+			counts[t.TraceID] = t.SpansReceived
+		}
+	}
+	return counts, nil
+}
+
+// AddDroppedSpans adds to the spans_dropped count of each trace the spans received
+// but not stored, and marks the traces truncated.
+func (r *Repository) AddDroppedSpans(dropped map[string]int) error {
+	// One UPDATE per distinct count, as in recordSpansReceived
+	byCount := make(map[int][]string)
+	for id, n := range dropped {
+		byCount[n] = append(byCount[n], id)
+	}
+	for n, ids := range byCount {
+		for start := 0; start < len(ids); start += traceIDChunkSize {
+			chunk := ids[start:min(start+traceIDChunkSize, len(ids))]
+			if err := r.db.Model(&Trace{}).Where("trace_id IN ?", chunk).UpdateColumns(map[string]interface{}{
+				"spans_dropped": gorm.Expr("spans_dropped + ?", n),
+				"truncated":     true,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to count dropped spans: %w", err)
+			}
+		}
+	}
+	return nil
 }
 
 // CreateTrace inserts a new trace, skipping if it already exists.
 func (r *Repository) CreateTrace(trace Trace) error {
-	if strings.ToLower(r.driver) == "mysql" {
-		return r.db.Clauses(clause.Insert{Modifier: "IGNORE"}).Create(&trace).Error
-	}
-	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&trace).Error
+	return r.ignoreDuplicates().Create(&trace).Error
 }
 
 // GetTrace returns a trace by ID with its spans and logs.
 func (r *Repository) GetTrace(traceID string) (*Trace, error) {
 	var trace Trace
-	if err := r.db.Preload("Spans").Preload("Logs").Where("trace_id = ?", traceID).First(&trace).Error; err != nil {
+	if err := r.db.Preload("Spans").Preload("Logs").Preload("Annotations").Where("trace_id = ?", traceID).First(&trace).Error; err != nil {
 		return nil, fmt.Errorf("failed to get trace: %w", err)
 	}
+	if err := r.attachSpanLinks(traceID, trace.Spans); err != nil {
+		return nil, err
+	}
 	return &trace, nil
 }
 
+// traceIDChunkSize bounds the number of IDs bound into a single IN list.
+const traceIDChunkSize = 500
+
+// ExistingTraceIDs reports which of traceIDs are already stored. It reads the primary,
+// since the import that asks is about to write the missing ones.
+func (r *Repository) ExistingTraceIDs(traceIDs []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	for start := 0; start < len(traceIDs); start += traceIDChunkSize {
+		var ids []string
+		chunk := traceIDs[start:min(start+traceIDChunkSize, len(traceIDs))]
+		if err := r.primary().Model(&Trace{}).Where("trace_id IN ?", chunk).Pluck("trace_id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to look up trace IDs: %w", err)
+		}
+		for _, id := range ids {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
 // spanSummary is a lightweight struct used to enrich trace list items.
 type spanSummary struct {
 	TraceID       string
@@ -89,26 +195,145 @@ type spanSummary struct {
 	OperationName string
 }
 
+// TraceFilter defines criteria for listing traces.
+type TraceFilter struct {
+	StartTime     time.Time
+	EndTime       time.Time
+	ServiceNames  []string
+	Status        string
+	Search        string
+	ErrorOnly     bool   // shortcut for status LIKE '%ERROR%'
+	ErrorMode     string // ErrorModeRoot (default) or ErrorModeRollup; applies to ErrorOnly
+	MinDurationMs int64  // inclusive lower bound, 0 = unbounded
+	MaxDurationMs int64  // inclusive upper bound, 0 = unbounded
+	Completeness  string // TraceComplete, TracePartial or TraceCompletenessUnknown; empty = any
+	Annotations   []AnnotationFilter
+	Limit         int
+	Offset        int
+	SortBy        string
+	OrderBy       string
+	Fields        []string   // JSON fields to load, e.g. trace_id,duration_ms; empty loads all
+	Query         query.Expr // parsed TraceQL-lite expression; nil matches all
+
+	traceIDs *gorm.DB // subquery of the trace_ids to restrict to; set by GetTracesByLogsContext
+}
+
+// Error modes decide what makes a trace an error trace.
+const (
+	ErrorModeRoot   = "root"   // the stored trace status is an error
+	ErrorModeRollup = "rollup" // any span in the trace has error status
+)
+
 // GetTracesFiltered retrieves traces with filtering and pagination.
 // Spans are NOT eagerly loaded — a single batch summary query is used instead.
 func (r *Repository) GetTracesFiltered(start, end time.Time, serviceNames []string, status, search string, limit, offset int, sortBy, orderBy string) (*TracesResponse, error) {
+	return r.GetTracesFilteredContext(context.Background(), start, end, serviceNames, status, search, limit, offset, sortBy, orderBy)
+}
+
+// GetTracesFilteredContext is GetTracesFiltered with its queries bound to ctx.
+func (r *Repository) GetTracesFilteredContext(ctx context.Context, start, end time.Time, serviceNames []string, status, search string, limit, offset int, sortBy, orderBy string) (*TracesResponse, error) {
+	return r.QueryTracesContext(ctx, TraceFilter{
+		StartTime:    start,
+		EndTime:      end,
+		ServiceNames: serviceNames,
+		Status:       status,
+		Search:       search,
+		Limit:        limit,
+		Offset:       offset,
+		SortBy:       sortBy,
+		OrderBy:      orderBy,
+	})
+}
+
+// QueryTraces retrieves traces matching the filter, with pagination and sorting.
+// Duration bounds are given in milliseconds and compared against the stored microseconds.
+func (r *Repository) QueryTraces(filter TraceFilter) (*TracesResponse, error) {
+	return r.QueryTracesContext(context.Background(), filter)
+}
+
+// QueryTracesContext is QueryTraces with its queries bound to ctx.
+func (r *Repository) QueryTracesContext(ctx context.Context, filter TraceFilter) (*TracesResponse, error) {
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+	if filter.Query == nil || !hasSpanAttr(filter.Query) {
+		return r.listTraces(db, filter, nil)
+	}
+	// The traces span.attr comparisons match go to a temporary table, which only
+	// the connection that created it can read.
+	var resp *TracesResponse
+	err := db.Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{}) // chain from it like from db
+		ids, err := newTraceIDTable(conn, r.driver)
+		if err != nil {
+			return err
+		}
+		defer ids.drop()
+		resp, err = r.listTraces(conn, filter, ids)
+		return err
+	})
+	return resp, err
+}
+
+// listTraces runs QueryTracesContext on db. With ids set, db is a single
+// connection, and its statements run one at a time.
+func (r *Repository) listTraces(db *gorm.DB, filter TraceFilter, ids *traceIDTable) (*TracesResponse, error) {
 	var traces []Trace
 	var total int64
 
-	base := r.db.Model(&Trace{})
+	columns, err := projectionColumns(traceFieldColumns, filter.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	base := db.Model(&Trace{})
 
-	if !start.IsZero() && !end.IsZero() {
-		base = base.Where("timestamp BETWEEN ? AND ?", start, end)
+	if !filter.StartTime.IsZero() && !filter.EndTime.IsZero() {
+		base = base.Where("timestamp BETWEEN ? AND ?", filter.StartTime, filter.EndTime)
+	}
+	if len(filter.ServiceNames) > 0 {
+		base = base.Where("service_name IN ?", filter.ServiceNames)
+	}
+	if filter.Status != "" {
+		base = base.Where("status LIKE ?", "%"+filter.Status+"%")
+	}
+	if filter.ErrorOnly {
+		if filter.ErrorMode == ErrorModeRollup {
+			base = base.Where("has_error = ?", true)
+		} else {
+			base = base.Where("status LIKE ?", "%ERROR%")
+		}
+	}
+	if filter.Search != "" {
+		// A pasted whole ID is an indexed lookup; anything else a substring match
+		if id, kind := ParseExactID(filter.Search); kind != "" {
+			base = whereExactID(db, base, id, kind)
+		} else {
+			base = base.Where("trace_id LIKE ?", "%"+filter.Search+"%")
+		}
 	}
-	if len(serviceNames) > 0 {
-		base = base.Where("service_name IN ?", serviceNames)
+	if filter.MinDurationMs > 0 {
+		base = base.Where("duration >= ?", filter.MinDurationMs*1000)
 	}
-	if status != "" {
-		base = base.Where("status LIKE ?", "%"+status+"%")
+	if filter.MaxDurationMs > 0 {
+		base = base.Where("duration <= ?", filter.MaxDurationMs*1000)
 	}
-	if search != "" {
-		base = base.Where("trace_id LIKE ?", "%"+search+"%")
+	if filter.Completeness != "" {
+		base = base.Where("completeness = ?", filter.Completeness)
 	}
+	base = r.whereAnnotations(base, filter.Annotations)
+	if filter.Query != nil {
+		cond, err := r.whereTraceQuery(db, filter.Query, filter.StartTime, filter.EndTime, ids)
+		if err != nil {
+			return nil, err
+		}
+		base = base.Where(cond)
+	}
+	if filter.traceIDs != nil {
+		base = base.Where("trace_id IN (?)", filter.traceIDs)
+	}
+
+	limit, offset := filter.Limit, filter.Offset
+	sortBy, orderBy := filter.SortBy, filter.OrderBy
 
 	orderClause := "timestamp DESC"
 	if sortBy != "" {
@@ -117,38 +342,61 @@ func (r *Repository) GetTracesFiltered(start, end time.Time, serviceNames []stri
 			direction = "DESC"
 		}
 		validSorts := map[string]string{
-			"timestamp":    "timestamp",
-			"duration":     "duration",
-			"service_name": "service_name",
-			"status":       "status",
-			"trace_id":     "trace_id",
+			"timestamp":       "timestamp",
+			"duration":        "duration",
+			"service_name":    "service_name",
+			"status":          "status",
+			"trace_id":        "trace_id",
+			"idle_percentage": "idle_percentage",
 		}
 		if field, ok := validSorts[sortBy]; ok {
 			orderClause = fmt.Sprintf("%s %s", field, direction)
 		}
+		if sortBy == "idle_percentage" {
+			// Traces not reconciled yet last, whichever way each database sorts NULL
+			orderClause = "idle_percentage IS NULL, " + orderClause
+		}
 	}
 
-	// Run COUNT and SELECT in parallel using independent sessions.
-	var g errgroup.Group
-	g.Go(func() error {
+	count := func() error {
 		return base.Session(&gorm.Session{}).Count(&total).Error
-	})
-	g.Go(func() error {
-		return base.Session(&gorm.Session{}).Order(orderClause).Limit(limit).Offset(offset).Find(&traces).Error
-	})
-	if err := g.Wait(); err != nil {
+	}
+	find := func() error {
+		page := base.Session(&gorm.Session{}).Order(orderClause).Limit(limit).Offset(offset)
+		if columns != nil {
+			page = page.Select(columns)
+		}
+		return page.Find(&traces).Error
+	}
+	if ids != nil {
+		if err = count(); err == nil {
+			err = find()
+		}
+	} else {
+		// Run COUNT and SELECT in parallel using independent sessions.
+		var g errgroup.Group
+		g.Go(count)
+		g.Go(find)
+		err = g.Wait()
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to fetch traces: %w", err)
 	}
 
+	for i := range traces {
+		traces[i].DurationMs = float64(traces[i].Duration) / 1000.0
+	}
+
 	// Enrich traces with span summary via a single batch query (no N+1, no full span load).
-	if len(traces) > 0 {
+	needSummary := columns == nil || slices.Contains(filter.Fields, "span_count") || slices.Contains(filter.Fields, "operation")
+	if len(traces) > 0 && needSummary {
 		traceIDs := make([]string, len(traces))
 		for i, t := range traces {
 			traceIDs[i] = t.TraceID
 		}
 
 		var summaries []spanSummary
-		r.db.Raw(
+		db.Raw(
 			`SELECT trace_id, COUNT(*) as span_count, MIN(operation_name) as operation_name
 			 FROM spans WHERE trace_id IN ? GROUP BY trace_id`, traceIDs,
 		).Scan(&summaries)
@@ -161,7 +409,6 @@ func (r *Repository) GetTracesFiltered(start, end time.Time, serviceNames []stri
 		for i := range traces {
 			s := sm[traces[i].TraceID]
 			traces[i].SpanCount = s.SpanCount
-			traces[i].DurationMs = float64(traces[i].Duration) / 1000.0
 			if s.OperationName != "" {
 				traces[i].Operation = s.OperationName
 			} else {
@@ -180,14 +427,52 @@ func (r *Repository) GetTracesFiltered(start, end time.Time, serviceNames []stri
 
 const serviceMapSpanLimit = 500_000
 
+// Span kinds as persisted on Span.Kind.
+const (
+	SpanKindServer   = "SERVER"
+	SpanKindClient   = "CLIENT"
+	SpanKindProducer = "PRODUCER"
+	SpanKindConsumer = "CONSUMER"
+	SpanKindInternal = "INTERNAL"
+)
+
+// ServiceMapFilter narrows a service map to the neighbourhood of one service and
+// drops rarely used edges.
+type ServiceMapFilter struct {
+	Focus        string // keep the services within Depth hops of this one ("" = all)
+	Depth        int    // hops from Focus, following edges in either direction
+	MinCallCount int64  // edges with fewer calls are dropped before hops are counted
+}
+
 // GetServiceMapMetrics computes topology metrics from spans.
 func (r *Repository) GetServiceMapMetrics(start, end time.Time) (*ServiceMapMetrics, error) {
+	return r.GetServiceMapMetricsContext(context.Background(), start, end)
+}
+
+// GetServiceMapMetricsContext is GetServiceMapMetrics with its query bound to ctx.
+func (r *Repository) GetServiceMapMetricsContext(ctx context.Context, start, end time.Time) (*ServiceMapMetrics, error) {
+	return r.GetServiceMapContext(ctx, start, end, ServiceMapFilter{})
+}
+
+// GetServiceMapContext is GetServiceMapMetricsContext narrowed by f. With a focus
+// only the spans of traces that pass through the focus service are read, so the
+// counts of services and calls further away cover those traces alone.
+func (r *Repository) GetServiceMapContext(ctx context.Context, start, end time.Time, f ServiceMapFilter) (*ServiceMapMetrics, error) {
 	var spans []Span
-	query := r.db.Model(&Span{})
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+	query := db.Model(&Span{})
 
 	if !start.IsZero() && !end.IsZero() {
 		query = query.Where("start_time BETWEEN ? AND ?", start, end)
 	}
+	if f.Focus != "" {
+		traces := db.Session(&gorm.Session{NewDB: true}).Model(&Span{}).Select("trace_id").Where("service_name = ?", f.Focus)
+		if !start.IsZero() && !end.IsZero() {
+			traces = traces.Where("start_time BETWEEN ? AND ?", start, end)
+		}
+		query = query.Where("trace_id IN (?)", traces)
+	}
 
 	if err := query.Limit(serviceMapSpanLimit).Find(&spans).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch spans: %w", err)
@@ -200,6 +485,14 @@ func (r *Repository) GetServiceMapMetrics(start, end time.Time) (*ServiceMapMetr
 	nodeStats := make(map[string]*ServiceMapNode)
 	edgeStats := make(map[string]*ServiceMapEdge)
 
+	// Server-side latency per service. When a service reports SERVER spans, node
+	// latency is their average (processing time) instead of the all-span average.
+	type latencyAcc struct {
+		sum   float64
+		count int64
+	}
+	serverLatency := make(map[string]*latencyAcc)
+
 	for _, s := range spans {
 		spanMap[s.SpanID] = s
 
@@ -213,11 +506,24 @@ func (r *Repository) GetServiceMapMetrics(start, end time.Time) (*ServiceMapMetr
 		ns := nodeStats[s.ServiceName]
 		ns.TotalTraces++
 		ns.AvgLatencyMs += float64(s.Duration)
+
+		if s.Kind == SpanKindServer {
+			acc, ok := serverLatency[s.ServiceName]
+			if !ok {
+				acc = &latencyAcc{}
+				serverLatency[s.ServiceName] = acc
+			}
+			acc.sum += float64(s.Duration)
+			acc.count++
+		}
 	}
 
 	nodes := make([]ServiceMapNode, 0)
 	for _, ns := range nodeStats {
-		if ns.TotalTraces > 0 {
+		if acc, ok := serverLatency[ns.Name]; ok && acc.count > 0 {
+			ns.AvgLatencyMs = acc.sum / float64(acc.count) / 1000.0
+			ns.AvgLatencyMs = math.Round(ns.AvgLatencyMs*100) / 100
+		} else if ns.TotalTraces > 0 {
 			ns.AvgLatencyMs = ns.AvgLatencyMs / float64(ns.TotalTraces) / 1000.0
 			ns.AvgLatencyMs = math.Round(ns.AvgLatencyMs*100) / 100
 		}
@@ -247,7 +553,13 @@ func (r *Repository) GetServiceMapMetrics(start, end time.Time) (*ServiceMapMetr
 		}
 		es := edgeStats[key]
 		es.CallCount++
-		es.AvgLatencyMs += float64(s.Duration)
+		// A CLIENT parent measures the call as seen by the caller (including
+		// network time); prefer it over the callee's processing time.
+		if parent.Kind == SpanKindClient {
+			es.AvgLatencyMs += float64(parent.Duration)
+		} else {
+			es.AvgLatencyMs += float64(s.Duration)
+		}
 	}
 
 	edges := make([]ServiceMapEdge, 0)
@@ -259,17 +571,87 @@ func (r *Repository) GetServiceMapMetrics(start, end time.Time) (*ServiceMapMetr
 		edges = append(edges, *es)
 	}
 
-	return &ServiceMapMetrics{
+	return f.apply(&ServiceMapMetrics{
 		Nodes: nodes,
 		Edges: edges,
-	}, nil
+	}), nil
+}
+
+// apply drops the edges below MinCallCount and, with a focus, the services more than
+// Depth hops from it along the remaining edges, with their edges.
+func (f ServiceMapFilter) apply(m *ServiceMapMetrics) *ServiceMapMetrics {
+	edges := m.Edges[:0]
+	for _, e := range m.Edges {
+		if e.CallCount >= f.MinCallCount {
+			edges = append(edges, e)
+		}
+	}
+	m.Edges = edges
+	if f.Focus == "" {
+		return m
+	}
+
+	neighbours := make(map[string][]string)
+	for _, e := range m.Edges {
+		neighbours[e.Source] = append(neighbours[e.Source], e.Target)
+		neighbours[e.Target] = append(neighbours[e.Target], e.Source)
+	}
+	keep := map[string]bool{}
+	for _, n := range m.Nodes {
+		if n.Name == f.Focus {
+			keep[f.Focus] = true
+		}
+	}
+	frontier := []string{f.Focus}
+	for hop := 0; hop < f.Depth && len(frontier) > 0 && keep[f.Focus]; hop++ {
+		var next []string
+		for _, name := range frontier {
+			for _, n := range neighbours[name] {
+				if !keep[n] {
+					keep[n] = true
+					next = append(next, n)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	nodes := make([]ServiceMapNode, 0, len(keep))
+	for _, n := range m.Nodes {
+		if keep[n.Name] {
+			nodes = append(nodes, n)
+		}
+	}
+	edges = make([]ServiceMapEdge, 0, len(m.Edges))
+	for _, e := range m.Edges {
+		if keep[e.Source] && keep[e.Target] {
+			edges = append(edges, e)
+		}
+	}
+	m.Nodes, m.Edges = nodes, edges
+	return m
 }
 
 // PurgeTraces deletes traces older than the given timestamp.
+// With a purge archiver installed, traces are archived and hard-deleted together with
+// their spans and logs in batches of purgeBatchSize instead.
 func (r *Repository) PurgeTraces(olderThan time.Time) (int64, error) {
-	result := r.db.Where("timestamp < ?", olderThan).Delete(&Trace{})
-	if result.Error != nil {
-		return 0, fmt.Errorf("failed to purge traces: %w", result.Error)
+	if r.purgeArchiver != nil {
+		return r.purgeTracesArchived(olderThan)
+	}
+	var result *gorm.DB
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteTraceAnnotations(tx, tx.Model(&Trace{}).Where("timestamp < ?", olderThan)); err != nil {
+			return err
+		}
+		if err := deleteSpanLinks(tx, tx.Model(&Trace{}).Where("timestamp < ?", olderThan)); err != nil {
+			return err
+		}
+		result = tx.Where("timestamp < ?", olderThan).Delete(&Trace{})
+		return result.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge traces: %w", err)
 	}
 	slog.Info("Traces purged", "count", result.RowsAffected, "cutoff", olderThan)
 	return result.RowsAffected, nil
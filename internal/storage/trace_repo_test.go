@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newTestRepository returns a Repository backed by a throwaway SQLite file.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	db, err := NewDatabase("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase() error = %v", err)
+	}
+	if _, err := MigrateSchema(db, "sqlite"); err != nil {
+		t.Fatalf("MigrateSchema() error = %v", err)
+	}
+	repo := &Repository{db: db, driver: "sqlite"}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestServiceMapMetricsSpanKind(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	// frontend SERVER (100ms) -> frontend CLIENT (80ms) -> backend SERVER (50ms)
+	spans := []Span{
+		{TraceID: "t1", SpanID: "a1", ServiceName: "frontend", Kind: SpanKindServer, OperationName: "GET /", StartTime: now, EndTime: now.Add(100 * time.Millisecond), Duration: 100_000},
+		{TraceID: "t1", SpanID: "a2", ParentSpanID: "a1", ServiceName: "frontend", Kind: SpanKindClient, OperationName: "call backend", StartTime: now, EndTime: now.Add(80 * time.Millisecond), Duration: 80_000},
+		{TraceID: "t1", SpanID: "b1", ParentSpanID: "a2", ServiceName: "backend", Kind: SpanKindServer, OperationName: "handle", StartTime: now, EndTime: now.Add(50 * time.Millisecond), Duration: 50_000},
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatalf("BatchCreateSpans() error = %v", err)
+	}
+
+	m, err := repo.GetServiceMapMetrics(now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetServiceMapMetrics() error = %v", err)
+	}
+
+	if len(m.Edges) != 1 {
+		t.Fatalf("expected 1 edge, got %d", len(m.Edges))
+	}
+	if e := m.Edges[0]; e.Source != "frontend" || e.Target != "backend" || e.AvgLatencyMs != 80 {
+		t.Errorf("edge = %+v, want frontend->backend with client latency 80ms", e)
+	}
+
+	nodes := make(map[string]ServiceMapNode)
+	for _, n := range m.Nodes {
+		nodes[n.Name] = n
+	}
+	if got := nodes["frontend"].AvgLatencyMs; got != 100 {
+		t.Errorf("frontend node latency = %v, want server latency 100ms", got)
+	}
+	if got := nodes["backend"].AvgLatencyMs; got != 50 {
+		t.Errorf("backend node latency = %v, want server latency 50ms", got)
+	}
+}
+
+func TestServiceMapMetricsWithoutSpanKind(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	spans := []Span{
+		{TraceID: "t1", SpanID: "a1", ServiceName: "frontend", StartTime: now, Duration: 100_000},
+		{TraceID: "t1", SpanID: "b1", ParentSpanID: "a1", ServiceName: "backend", StartTime: now, Duration: 50_000},
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatalf("BatchCreateSpans() error = %v", err)
+	}
+
+	m, err := repo.GetServiceMapMetrics(now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetServiceMapMetrics() error = %v", err)
+	}
+	if len(m.Edges) != 1 || m.Edges[0].AvgLatencyMs != 50 {
+		t.Errorf("edges = %+v, want single edge with callee latency 50ms", m.Edges)
+	}
+}
+
+func TestQueryTracesDurationFilters(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	// Durations in ms: 500, 1000, 2000, 2000 (error), 3000
+	durations := []int64{500, 1000, 2000, 2000, 3000}
+	var traces []Trace
+	for i, ms := range durations {
+		status := "STATUS_CODE_OK"
+		if i == 3 {
+			status = "STATUS_CODE_ERROR"
+		}
+		traces = append(traces, Trace{
+			TraceID:     fmt.Sprintf("trace-%d", i),
+			ServiceName: "svc",
+			Duration:    ms * 1000,
+			Status:      status,
+			Timestamp:   now.Add(-time.Duration(i) * time.Second),
+		})
+	}
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatalf("BatchCreateTraces() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    TraceFilter
+		wantTotal int64
+		wantPage  int
+	}{
+		{"min inclusive", TraceFilter{MinDurationMs: 2000, Limit: 10}, 3, 3},
+		{"max inclusive", TraceFilter{MaxDurationMs: 1000, Limit: 10}, 2, 2},
+		{"range", TraceFilter{MinDurationMs: 1000, MaxDurationMs: 2000, Limit: 10}, 3, 3},
+		{"error only with min", TraceFilter{MinDurationMs: 2000, ErrorOnly: true, Limit: 10}, 1, 1},
+		{"paginated total", TraceFilter{MinDurationMs: 1000, Limit: 2, Offset: 2}, 4, 2},
+		{"composes with service", TraceFilter{MinDurationMs: 1000, ServiceNames: []string{"other"}, Limit: 10}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := repo.QueryTraces(tt.filter)
+			if err != nil {
+				t.Fatalf("QueryTraces() error = %v", err)
+			}
+			if resp.Total != tt.wantTotal {
+				t.Errorf("Total = %d, want %d", resp.Total, tt.wantTotal)
+			}
+			if len(resp.Traces) != tt.wantPage {
+				t.Errorf("page size = %d, want %d", len(resp.Traces), tt.wantPage)
+			}
+		})
+	}
+}
+
+func TestTraceErrorRollup(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	// "soft" has a successful root; its failing child arrives in a later batch.
+	// "hard" failed at the root; "ok" never failed.
+	if err := repo.BatchCreateTraces([]Trace{
+		{TraceID: "soft", ServiceName: "order", Status: "STATUS_CODE_OK", Timestamp: now},
+		{TraceID: "hard", ServiceName: "order", Status: "STATUS_CODE_ERROR", HasError: true, Timestamp: now},
+		{TraceID: "ok", ServiceName: "order", Status: "STATUS_CODE_OK", Timestamp: now},
+	}); err != nil {
+		t.Fatalf("BatchCreateTraces() error = %v", err)
+	}
+	if err := repo.BatchCreateTraces([]Trace{
+		{TraceID: "soft", ServiceName: "shipping", Status: "STATUS_CODE_ERROR", HasError: true, Timestamp: now},
+	}); err != nil {
+		t.Fatalf("BatchCreateTraces() error = %v", err)
+	}
+
+	soft, err := repo.GetTrace("soft")
+	if err != nil {
+		t.Fatalf("GetTrace() error = %v", err)
+	}
+	if !soft.HasError || soft.Status != "STATUS_CODE_OK" || soft.ServiceName != "order" {
+		t.Errorf("soft trace = %+v, want root status kept and has_error set", soft)
+	}
+
+	for mode, want := range map[string]int64{"": 1, ErrorModeRoot: 1, ErrorModeRollup: 2} {
+		resp, err := repo.QueryTraces(TraceFilter{ErrorOnly: true, ErrorMode: mode, Limit: 10})
+		if err != nil {
+			t.Fatalf("QueryTraces() error = %v", err)
+		}
+		if resp.Total != want {
+			t.Errorf("error_mode %q: Total = %d, want %d", mode, resp.Total, want)
+		}
+	}
+
+	stats, err := repo.GetDashboardStats(now.Add(-time.Minute), now.Add(time.Minute), nil)
+	if err != nil {
+		t.Fatalf("GetDashboardStats() error = %v", err)
+	}
+	if stats.TotalErrors != 1 || stats.RollupErrors != 2 {
+		t.Errorf("stats = %d root / %d rollup errors, want 1 / 2", stats.TotalErrors, stats.RollupErrors)
+	}
+}
+
+func TestServiceMapFocus(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+
+	// 50 services in a chain; each trace walks five consecutive ones and is sent
+	// twice, so every chain edge has at least two calls. One stray call links
+	// svc-05 to svc-40.
+	svc := func(i int) string { return fmt.Sprintf("svc-%02d", i) }
+	var spans []Span
+	walk := func(traceID string, services ...int) {
+		parent := ""
+		for i, s := range services {
+			id := fmt.Sprintf("%s-%d", traceID, i)
+			spans = append(spans, Span{TraceID: traceID, SpanID: id, ParentSpanID: parent, ServiceName: svc(s), OperationName: "op",
+				StartTime: now, EndTime: now.Add(time.Millisecond), Duration: 1000})
+			parent = id
+		}
+	}
+	for k := 0; k+4 < 50; k++ {
+		for copy := range 2 {
+			walk(fmt.Sprintf("t%02d-%d", k, copy), k, k+1, k+2, k+3, k+4)
+		}
+	}
+	walk("stray", 5, 40)
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+
+	var queries []string
+	var rows int64
+	repo.db.Callback().Query().After("gorm:query").Register("test:spans", func(db *gorm.DB) {
+		if db.Statement.Table == "spans" && !db.DryRun { // subqueries are built by a dry run
+			queries = append(queries, db.Statement.SQL.String())
+			rows += db.RowsAffected
+		}
+	})
+	serviceMap := func(f ServiceMapFilter) (nodes, edges []string) {
+		t.Helper()
+		m, err := repo.GetServiceMapContext(context.Background(), now.Add(-time.Minute), now.Add(time.Minute), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range m.Nodes {
+			nodes = append(nodes, n.Name)
+		}
+		for _, e := range m.Edges {
+			edges = append(edges, e.Source+">"+e.Target)
+		}
+		sort.Strings(nodes)
+		sort.Strings(edges)
+		return nodes, edges
+	}
+
+	if nodes, edges := serviceMap(ServiceMapFilter{}); len(nodes) != 50 || len(edges) != 50 {
+		t.Fatalf("unfiltered map has %d nodes and %d edges, want 50 and 50", len(nodes), len(edges))
+	}
+
+	queries, rows = nil, 0
+	nodes, edges := serviceMap(ServiceMapFilter{Focus: "svc-20", Depth: 2})
+	if got := strings.Join(nodes, " "); got != "svc-18 svc-19 svc-20 svc-21 svc-22" {
+		t.Errorf("nodes within 2 hops of svc-20 = %s", got)
+	}
+	if got := strings.Join(edges, " "); got != "svc-18>svc-19 svc-19>svc-20 svc-20>svc-21 svc-21>svc-22" {
+		t.Errorf("edges within 2 hops of svc-20 = %s", got)
+	}
+	// Only the ten traces through svc-20 are read, not all 93
+	if len(queries) != 1 || !strings.Contains(queries[0], "trace_id IN (SELECT `trace_id` FROM") {
+		t.Errorf("span queries = %q, want one narrowed to the traces through the focus", queries)
+	}
+	if rows != 10*5 {
+		t.Errorf("read %d spans, want the 50 of the traces through svc-20", rows)
+	}
+
+	nodes, _ = serviceMap(ServiceMapFilter{Focus: "svc-05", Depth: 1})
+	if got := strings.Join(nodes, " "); got != "svc-04 svc-05 svc-06 svc-40" {
+		t.Errorf("neighbours of svc-05 = %s", got)
+	}
+	nodes, edges = serviceMap(ServiceMapFilter{Focus: "svc-05", Depth: 1, MinCallCount: 2})
+	if got := strings.Join(nodes, " "); got != "svc-04 svc-05 svc-06" {
+		t.Errorf("neighbours of svc-05 over edges with 2+ calls = %s", got)
+	}
+	if len(edges) != 2 {
+		t.Errorf("edges = %v, want the stray call dropped", edges)
+	}
+
+	if nodes, edges := serviceMap(ServiceMapFilter{Focus: "svc-99", Depth: 3}); len(nodes) != 0 || len(edges) != 0 {
+		t.Errorf("unknown focus returned %v %v, want an empty map", nodes, edges)
+	}
+}
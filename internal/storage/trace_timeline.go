@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// TraceTimeline splits a trace's duration into the time some child span was running
+// and the idle time the root spans alone account for: work nobody instrumented, or
+// queueing. A trace of a single span is all idle.
+type TraceTimeline struct {
+	TotalDurationUs    int64   `json:"total_duration_us"`    // from the first span's start to the last span's end
+	InstrumentedTimeUs int64   `json:"instrumented_time_us"` // union of the intervals of all spans with a parent
+	IdleTimeUs         int64   `json:"idle_time_us"`
+	IdlePercentage     float64 `json:"idle_percentage"` // of the total duration
+}
+
+// ComputeTraceTimeline returns the timeline of a trace's spans, or nil without spans.
+// Child spans running concurrently count once, and orphans (whose parent is missing)
+// count as children.
+func ComputeTraceTimeline(spans []Span) *TraceTimeline {
+	if len(spans) == 0 {
+		return nil
+	}
+	from, to := spans[0].StartTime, spanEnd(&spans[0])
+	var children []timeInterval
+	for i := range spans {
+		s := &spans[i]
+		if s.StartTime.Before(from) {
+			from = s.StartTime
+		}
+		if end := spanEnd(s); end.After(to) {
+			to = end
+		}
+		if !isRootSpanID(s.ParentSpanID) {
+			children = append(children, timeInterval{s.StartTime, spanEnd(s)})
+		}
+	}
+	t := &TraceTimeline{
+		TotalDurationUs:    to.Sub(from).Microseconds(),
+		InstrumentedTimeUs: coveredTime(children, from, to).Microseconds(),
+	}
+	t.IdleTimeUs = t.TotalDurationUs - t.InstrumentedTimeUs
+	if t.TotalDurationUs > 0 {
+		t.IdlePercentage = math.Round(float64(t.IdleTimeUs)/float64(t.TotalDurationUs)*10000) / 100
+	}
+	return t
+}
+
+// SelfTimes returns each span's self time in microseconds, indexed like spans: its
+// duration minus the part of it covered by its children.
+func SelfTimes(spans []Span) []int64 {
+	index := make(map[*Span]int, len(spans))
+	for i := range spans {
+		index[&spans[i]] = i
+	}
+	out := make([]int64, len(spans))
+	var walk func(n *SpanNode)
+	walk = func(n *SpanNode) {
+		out[index[n.Span]] = selfTime(n)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	for _, n := range BuildSpanTree(spans) {
+		walk(n)
+	}
+	return out
+}
+
+// selfTime is the span's duration minus the part of it covered by its children.
+// Overlapping (concurrent) children are counted once, and child time outside the
+// span is ignored.
+func selfTime(n *SpanNode) int64 {
+	children := make([]timeInterval, len(n.Children))
+	for i, c := range n.Children {
+		children[i] = timeInterval{c.Span.StartTime, spanEnd(c.Span)}
+	}
+	busy := coveredTime(children, n.Span.StartTime, spanEnd(n.Span))
+	return max(0, n.Span.Duration-busy.Microseconds())
+}
+
+type timeInterval struct{ from, to time.Time }
+
+// coveredTime is the length of the union of intervals within [from, to]: overlapping
+// and nested intervals count once, and the parts outside the window not at all.
+func coveredTime(intervals []timeInterval, from, to time.Time) time.Duration {
+	clipped := make([]timeInterval, 0, len(intervals))
+	for _, iv := range intervals {
+		if iv.from.Before(from) {
+			iv.from = from
+		}
+		if iv.to.After(to) {
+			iv.to = to
+		}
+		if iv.to.After(iv.from) {
+			clipped = append(clipped, iv)
+		}
+	}
+	sort.Slice(clipped, func(i, j int) bool { return clipped[i].from.Before(clipped[j].from) })
+
+	var covered time.Duration
+	var cur timeInterval
+	for i, iv := range clipped {
+		switch {
+		case i == 0:
+			cur = iv
+		case !iv.from.After(cur.to):
+			if iv.to.After(cur.to) {
+				cur.to = iv.to
+			}
+		default:
+			covered += cur.to.Sub(cur.from)
+			cur = iv
+		}
+	}
+	if len(clipped) > 0 {
+		covered += cur.to.Sub(cur.from)
+	}
+	return covered
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCoveredTime(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+	iv := func(from, to int) timeInterval { return timeInterval{ms(from), ms(to)} }
+
+	tests := []struct {
+		name      string
+		intervals []timeInterval
+		wantMs    int
+	}{
+		{"none", nil, 0},
+		{"disjoint", []timeInterval{iv(60, 80), iv(10, 20), iv(30, 40)}, 40},
+		{"overlapping", []timeInterval{iv(10, 50), iv(30, 70)}, 60},
+		{"nested", []timeInterval{iv(10, 90), iv(20, 30), iv(40, 60)}, 80},
+		{"touching", []timeInterval{iv(10, 20), iv(20, 30)}, 20},
+		{"chained overlaps", []timeInterval{iv(10, 30), iv(25, 45), iv(40, 60), iv(70, 75)}, 55},
+		{"clipped to the window", []timeInterval{iv(-50, 10), iv(90, 150)}, 20},
+		{"outside the window", []timeInterval{iv(-50, -10), iv(100, 150)}, 0},
+		{"empty intervals", []timeInterval{iv(30, 30), iv(50, 40)}, 0},
+	}
+	for _, tt := range tests {
+		if got := coveredTime(tt.intervals, ms(0), ms(100)); got != time.Duration(tt.wantMs)*time.Millisecond {
+			t.Errorf("%s: covered %s, want %dms", tt.name, got, tt.wantMs)
+		}
+	}
+}
+
+func TestComputeTraceTimeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans []Span
+		want  TraceTimeline
+	}{
+		{"idle root", waterfall(
+			[4]any{"root", "", 0, 900},
+			[4]any{"a", "root", 100, 250},
+			[4]any{"b", "root", 200, 300}, // overlaps a
+		), TraceTimeline{900_000, 200_000, 700_000, 77.78}},
+		{"nested children count once", waterfall(
+			[4]any{"root", "", 0, 100},
+			[4]any{"a", "root", 0, 80},
+			[4]any{"b", "a", 10, 70},
+		), TraceTimeline{100_000, 80_000, 20_000, 20}},
+		{"orphans and spans past the root", waterfall(
+			[4]any{"root", "", 0, 100},
+			[4]any{"a", "missing", 50, 150},
+		), TraceTimeline{150_000, 100_000, 50_000, 33.33}},
+		{"single span", waterfall([4]any{"root", "", 0, 40}), TraceTimeline{40_000, 0, 40_000, 100}},
+		{"zero duration", waterfall([4]any{"root", "", 0, 0}), TraceTimeline{}},
+	}
+	for _, tt := range tests {
+		if got := ComputeTraceTimeline(tt.spans); *got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+	if ComputeTraceTimeline(nil) != nil {
+		t.Error("timeline of no spans, want nil")
+	}
+}
+
+func TestSelfTimes(t *testing.T) {
+	spans := waterfall(
+		[4]any{"root", "", 0, 100},
+		[4]any{"a", "root", 10, 50},
+		[4]any{"b", "root", 30, 60}, // overlaps a
+		[4]any{"c", "a", 20, 30},
+		[4]any{"d", "b", 50, 90}, // ends after b
+	)
+	want := map[string]int64{"root": 50_000, "a": 30_000, "b": 20_000, "c": 10_000, "d": 40_000}
+	for i, us := range SelfTimes(spans) {
+		if us != want[spans[i].SpanID] {
+			t.Errorf("span %s self time = %dµs, want %d", spans[i].SpanID, us, want[spans[i].SpanID])
+		}
+	}
+}
+
+func TestReconcileStoresIdlePercentage(t *testing.T) {
+	repo := newTestRepository(t)
+	if err := repo.BatchCreateTraces([]Trace{{TraceID: "t", Timestamp: time.Now()}, {TraceID: "nospans", Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	spans := waterfall([4]any{"root", "", 0, 100}, [4]any{"a", "root", 0, 25})
+	for i := range spans {
+		spans[i].TraceID = "t"
+	}
+	if err := repo.BatchCreateSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	if tr := traceCompleteness(t, repo, "t"); tr.IdlePercentage != nil {
+		t.Fatalf("idle percentage before reconciling = %v, want null", *tr.IdlePercentage)
+	}
+	if _, err := repo.ReconcileTraceCompleteness(context.Background(), CompletenessCursor{}, time.Now(), 100); err != nil {
+		t.Fatal(err)
+	}
+	if tr := traceCompleteness(t, repo, "t"); tr.IdlePercentage == nil || *tr.IdlePercentage != 75 {
+		t.Errorf("idle percentage = %v, want 75", tr.IdlePercentage)
+	}
+	if tr := traceCompleteness(t, repo, "nospans"); tr.IdlePercentage != nil {
+		t.Errorf("idle percentage without spans = %v, want null", *tr.IdlePercentage)
+	}
+}
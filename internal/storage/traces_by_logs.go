@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// MaxTracesByLogs caps how many distinct traces GetTracesByLogsContext resolves.
+const MaxTracesByLogs = 2000
+
+// TracesByLogsResponse is a page of the traces behind a log search.
+type TracesByLogsResponse struct {
+	TracesResponse
+	// Truncated is set when the logs referenced more than the maxTraces traces
+	// considered; the page then covers only those with the most recent matches.
+	Truncated bool `json:"truncated"`
+}
+
+// GetTracesByLogsContext lists the traces that emitted logs matching logFilter. It
+// first resolves the distinct trace IDs of the matching logs — at most maxTraces,
+// those with the most recent matching log first — and then lists the stored traces
+// among them through QueryTracesContext, with the sorting, paging and remaining
+// criteria of traceFilter. Each trace carries its number of matching logs in
+// LogMatches. logFilter's own paging is ignored.
+//
+// The traces are restricted by a subquery rather than by the resolved IDs, which
+// would bind up to MaxTracesByLogs parameters, near SQL Server's limit of 2100.
+func (r *Repository) GetTracesByLogsContext(ctx context.Context, logFilter LogFilter, traceFilter TraceFilter, maxTraces int) (*TracesByLogsResponse, error) {
+	if maxTraces <= 0 || maxTraces > MaxTracesByLogs {
+		maxTraces = MaxTracesByLogs
+	}
+
+	db, cancel := r.withContext(ctx)
+	defer cancel()
+	base, err := r.filteredLogs(db, logFilter)
+	if err != nil {
+		return nil, err
+	}
+	var matches []struct {
+		TraceID  string
+		LogCount int64
+	}
+	base = base.Where("trace_id <> ''").Group("trace_id").Order("MAX(timestamp) DESC, trace_id")
+	err = base.Session(&gorm.Session{}).
+		Select("trace_id, COUNT(*) AS log_count").
+		Limit(maxTraces + 1).
+		Scan(&matches).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve traces from logs: %w", err)
+	}
+
+	resp := &TracesByLogsResponse{
+		TracesResponse: TracesResponse{Traces: []Trace{}, Limit: traceFilter.Limit, Offset: traceFilter.Offset},
+		Truncated:      len(matches) > maxTraces,
+	}
+	if resp.Truncated {
+		matches = matches[:maxTraces]
+	}
+	if len(matches) == 0 {
+		return resp, nil
+	}
+
+	counts := make(map[string]int64, len(matches))
+	for _, m := range matches {
+		counts[m.TraceID] = m.LogCount
+	}
+	// A derived table, as MySQL does not take LIMIT in an IN subquery
+	top := base.Session(&gorm.Session{}).Select("trace_id").Limit(maxTraces)
+	traceFilter.traceIDs = db.Session(&gorm.Session{NewDB: true}).Table("(?) AS matched", top).Select("trace_id")
+	page, err := r.QueryTracesContext(ctx, traceFilter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Traces {
+		page.Traces[i].LogMatches = counts[page.Traces[i].TraceID]
+	}
+	if page.Traces != nil {
+		resp.Traces = page.Traces
+	}
+	resp.Total = page.Total
+	return resp, nil
+}
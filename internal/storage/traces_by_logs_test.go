@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestGetTracesByLogs(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// No statement may bind the resolved trace IDs: SQL Server takes 2100 parameters.
+	var (
+		mu      sync.Mutex
+		maxVars int
+	)
+	err := repo.db.Callback().Query().Before("gorm:query").Register("test:count_vars", func(db *gorm.DB) {
+		mu.Lock()
+		maxVars = max(maxVars, len(db.Statement.Vars))
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := traceIDChunkSize + 100
+	traces := make([]Trace, n)
+	var logs []Log
+	for i := range traces {
+		id := fmt.Sprintf("trace-%04d", i)
+		traces[i] = Trace{TraceID: id, ServiceName: "checkout", Timestamp: now.Add(time.Duration(i) * time.Millisecond)}
+		logs = append(logs,
+			Log{TraceID: id, ServiceName: "checkout", Severity: "ERROR", Body: "payment_gateway_timeout", Timestamp: now.Add(time.Duration(i) * time.Millisecond)},
+			Log{TraceID: id, ServiceName: "checkout", Severity: "INFO", Body: "order placed", Timestamp: now},
+		)
+	}
+	logs = append(logs,
+		Log{TraceID: "trace-0000", ServiceName: "checkout", Severity: "ERROR", Body: "payment_gateway_timeout (retry)", Timestamp: now},
+		Log{TraceID: "not-stored", ServiceName: "checkout", Severity: "ERROR", Body: "payment_gateway_timeout", Timestamp: now},
+		Log{ServiceName: "checkout", Severity: "ERROR", Body: "payment_gateway_timeout without trace", Timestamp: now},
+	)
+	if err := repo.BatchCreateTraces(traces); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.BatchCreateLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	logFilter := LogFilter{Severity: "ERROR"}
+	resp, err := repo.GetTracesByLogsContext(context.Background(), logFilter,
+		TraceFilter{Limit: 10, SortBy: "trace_id", OrderBy: "asc"}, MaxTracesByLogs)
+	if err != nil {
+		t.Fatalf("GetTracesByLogsContext() error = %v", err)
+	}
+	if resp.Total != int64(n) || resp.Truncated || len(resp.Traces) != 10 {
+		t.Fatalf("got total %d, %d traces, truncated %v; want total %d, 10 traces", resp.Total, len(resp.Traces), resp.Truncated, n)
+	}
+	if first := resp.Traces[0]; first.TraceID != "trace-0000" || first.LogMatches != 2 {
+		t.Errorf("first trace = %s with %d matches, want trace-0000 with 2", first.TraceID, first.LogMatches)
+	}
+	if second := resp.Traces[1]; second.LogMatches != 1 {
+		t.Errorf("%s has %d matches, want 1", second.TraceID, second.LogMatches)
+	}
+	if maxVars > 10 {
+		t.Errorf("a statement bound %d parameters, want the trace IDs left in the database", maxVars)
+	}
+
+	// Capped: only the traces with the most recent matching logs are considered.
+	resp, err = repo.GetTracesByLogsContext(context.Background(), logFilter, TraceFilter{Limit: 10}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Truncated || resp.Total != 3 || resp.Traces[0].TraceID != fmt.Sprintf("trace-%04d", n-1) {
+		t.Errorf("capped: total %d, truncated %v, first %s; want the 3 newest", resp.Total, resp.Truncated, resp.Traces[0].TraceID)
+	}
+
+	// No matching logs: an empty page rather than every trace.
+	resp, err = repo.GetTracesByLogsContext(context.Background(), LogFilter{Severity: "FATAL"}, TraceFilter{Limit: 10}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 0 || len(resp.Traces) != 0 || resp.Traces == nil {
+		t.Errorf("no matches: total %d, traces %v; want an empty list", resp.Total, resp.Traces)
+	}
+}
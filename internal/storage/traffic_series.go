@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits on GetTrafficByService.
+const (
+	DefaultTrafficSeries = 10
+	MaxTrafficSeries     = 50
+	// maxTrafficBuckets bounds the points per series; longer windows use wider buckets.
+	maxTrafficBuckets = 720
+)
+
+// TrafficOtherSeries names the series that sums the services beyond the top K.
+const TrafficOtherSeries = "other"
+
+// TrafficSeries is the traffic of one service, or of the "other" rollup.
+type TrafficSeries struct {
+	ServiceName string         `json:"service_name"`
+	Other       bool           `json:"other,omitempty"` // rollup of the services not listed
+	Count       int64          `json:"count"`
+	ErrorCount  int64          `json:"error_count"`
+	Points      []TrafficPoint `json:"points"`
+}
+
+// TrafficByService is traffic split per service. Every series has a point for every
+// bucket, zero-filled, so stacked series line up.
+type TrafficByService struct {
+	StepSeconds   int64           `json:"step_seconds"`
+	Series        []TrafficSeries `json:"series"`
+	OtherServices int             `json:"other_services"` // services rolled into "other"
+}
+
+// trafficStep picks the bucket width for a window: a minute, as for GetTrafficMetrics,
+// unless that would exceed maxTrafficBuckets.
+func trafficStep(window time.Duration) time.Duration {
+	for _, step := range heatmapSteps {
+		if step >= time.Minute && window/step <= maxTrafficBuckets {
+			return step
+		}
+	}
+	return heatmapSteps[len(heatmapSteps)-1]
+}
+
+// GetTrafficByService returns request and error counts over [start, end] per service,
+// in one pass over the traces. The top services by request count get their own series,
+// busiest first; the rest are summed into a final "other" series. Errors are counted
+// as in GetTrafficMetrics. Buckets are aligned in loc (nil: UTC); see bucketBounds.
+func (r *Repository) GetTrafficByService(start, end time.Time, serviceNames []string, top int, loc *time.Location) (*TrafficByService, error) {
+	if top <= 0 || top > MaxTrafficSeries {
+		top = DefaultTrafficSeries
+	}
+	step := trafficStep(end.Sub(start))
+	bounds := bucketBounds(start, end, step, loc)
+	numBuckets := len(bounds) - 1
+
+	query := r.db.Model(&Trace{}).
+		Select("service_name, timestamp, status").
+		Where("timestamp BETWEEN ? AND ?", start, end)
+	if len(serviceNames) > 0 {
+		query = query.Where("service_name IN ?", serviceNames)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get traffic by service: %w", err)
+	}
+	defer rows.Close()
+
+	type counts struct{ total, errors []int64 }
+	byService := make(map[string]*counts)
+	for rows.Next() {
+		var row struct {
+			ServiceName string
+			Timestamp   time.Time
+			Status      string
+		}
+		if err := r.db.ScanRows(rows, &row); err != nil {
+			return nil, fmt.Errorf("failed to scan traffic row: %w", err)
+		}
+		i := bucketIndex(bounds, row.Timestamp)
+		if i < 0 {
+			continue
+		}
+		c, ok := byService[row.ServiceName]
+		if !ok {
+			c = &counts{total: make([]int64, numBuckets), errors: make([]int64, numBuckets)}
+			byService[row.ServiceName] = c
+		}
+		c.total[i]++
+		if strings.Contains(strings.ToUpper(row.Status), "ERROR") {
+			c.errors[i]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read traffic rows: %w", err)
+	}
+
+	series := make([]TrafficSeries, 0, len(byService))
+	for name, c := range byService {
+		s := TrafficSeries{ServiceName: name, Points: make([]TrafficPoint, numBuckets)}
+		for i := range s.Points {
+			s.Points[i] = TrafficPoint{Timestamp: bounds[i], Count: c.total[i], ErrorCount: c.errors[i]}
+			s.Count += c.total[i]
+			s.ErrorCount += c.errors[i]
+		}
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Count != series[j].Count {
+			return series[i].Count > series[j].Count
+		}
+		return series[i].ServiceName < series[j].ServiceName
+	})
+
+	out := &TrafficByService{StepSeconds: int64(step / time.Second), Series: series}
+	if len(series) > top {
+		other := TrafficSeries{ServiceName: TrafficOtherSeries, Other: true, Points: make([]TrafficPoint, numBuckets)}
+		for i := range other.Points {
+			other.Points[i].Timestamp = bounds[i]
+		}
+		for _, s := range series[top:] {
+			other.Count += s.Count
+			other.ErrorCount += s.ErrorCount
+			for i, p := range s.Points {
+				other.Points[i].Count += p.Count
+				other.Points[i].ErrorCount += p.ErrorCount
+			}
+		}
+		out.OtherServices = len(series) - top
+		out.Series = append(series[:top:top], other)
+	}
+	return out, nil
+}
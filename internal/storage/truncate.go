@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// LogPreviewRunes is the length, in runes, of the body previews returned by log
+// listings in summary mode.
+const LogPreviewRunes = 200
+
+// PreviewText cuts s to its first max runes and appends an ellipsis, reporting
+// whether s was cut. Unlike TruncateText it is for display only; nothing cut by it
+// is stored.
+func PreviewText(s string, max int) (string, bool) {
+	if len(s) <= max {
+		return s, false // fewer bytes than max means fewer runes too
+	}
+	n := 0
+	for i := range s {
+		if n == max {
+			return s[:i] + "…", true
+		}
+		n++
+	}
+	return s, false
+}
+
+// TruncateText cuts s to at most max bytes, backing up to a rune boundary so no
+// UTF-8 sequence is split, and appends a "...[truncated N bytes]" marker. It reports
+// whether s was cut. max <= 0 means no limit.
+func TruncateText(s string, max int) (string, bool) {
+	if max <= 0 || len(s) <= max {
+		return s, false
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "...[truncated " + strconv.Itoa(len(s)-cut) + " bytes]", true
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateText(t *testing.T) {
+	if got, cut := TruncateText("short", 10); got != "short" || cut {
+		t.Errorf("under the limit: %q, %v", got, cut)
+	}
+	if got, cut := TruncateText(strings.Repeat("a", 20), 0); len(got) != 20 || cut {
+		t.Errorf("no limit: %d bytes, %v", len(got), cut)
+	}
+	if got, _ := TruncateText("abcdefghij", 4); got != "abcd...[truncated 6 bytes]" {
+		t.Errorf("ascii: %q", got)
+	}
+
+	// "é" is 2 bytes, "€" 3 and "😀" 4: every limit must land on a rune boundary.
+	s := strings.Repeat("é€😀", 10)
+	for max := 1; max < len(s); max++ {
+		got, cut := TruncateText(s, max)
+		if !cut || !utf8.ValidString(got) {
+			t.Fatalf("max %d: %q is not valid UTF-8 (cut %v)", max, got, cut)
+		}
+		kept, _, _ := strings.Cut(got, "...[truncated ")
+		if len(kept) > max || len(kept) < max-3 || !strings.HasPrefix(s, kept) {
+			t.Fatalf("max %d: kept %d bytes %q", max, len(kept), kept)
+		}
+	}
+}
+
+func TestPreviewText(t *testing.T) {
+	if got, cut := PreviewText("short", 10); got != "short" || cut {
+		t.Errorf("under the limit: %q, %v", got, cut)
+	}
+	// 10 runes in 30 bytes: a byte limit would cut it, a rune limit must not.
+	if got, cut := PreviewText(strings.Repeat("€", 10), 10); utf8.RuneCountInString(got) != 10 || cut {
+		t.Errorf("exactly at the limit: %q, %v", got, cut)
+	}
+	got, cut := PreviewText(strings.Repeat("é€😀", 10), 4)
+	if got != "é€😀é…" || !cut {
+		t.Errorf("multi-byte: %q, %v; want the first 4 runes and an ellipsis", got, cut)
+	}
+}
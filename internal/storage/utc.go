@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// registerUTC installs callbacks that convert every time a statement writes or binds
+// to UTC, so timestamps are stored in UTC whatever the process's local time zone.
+// SQLite keeps a time as text with its zone offset and compares the text, so a
+// condition bound with a non-UTC time would compare wrongly against UTC rows.
+func registerUTC(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("utc:create", utcValues),
+		cb.Update().Before("gorm:update").Register("utc:update", utcValues),
+		cb.Query().Before("gorm:query").Register("utc:query", utcConditions),
+		cb.Row().Before("gorm:row").Register("utc:row", utcConditions),
+		cb.Delete().Before("gorm:delete").Register("utc:delete", utcConditions),
+		cb.Raw().Before("gorm:raw").Register("utc:raw", utcConditions),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register UTC callbacks: %w", err)
+		}
+	}
+	return nil
+}
+
+// utcValues converts the time fields of the rows being written, the values of a
+// map update, and the statement's conditions.
+func utcValues(db *gorm.DB) {
+	utcConditions(db)
+	stmt := db.Statement
+	if m, ok := stmt.Dest.(map[string]interface{}); ok {
+		for k, v := range m {
+			m[k] = utcVar(v)
+		}
+		return
+	}
+	if stmt.Schema == nil || !stmt.ReflectValue.IsValid() {
+		return
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			utcFields(db, reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		utcFields(db, stmt.ReflectValue)
+	}
+}
+
+// utcFields converts the time.Time and *time.Time fields of one row.
+func utcFields(db *gorm.DB, row reflect.Value) {
+	ctx := db.Statement.Context
+	for _, f := range db.Statement.Schema.Fields {
+		if f.FieldType != reflect.TypeOf(time.Time{}) && f.FieldType != reflect.TypeOf(&time.Time{}) {
+			continue
+		}
+		v, zero := f.ValueOf(ctx, row)
+		if zero {
+			continue
+		}
+		switch t := v.(type) {
+		case time.Time:
+			if t.Location() != time.UTC {
+				_ = f.Set(ctx, row, t.UTC())
+			}
+		case *time.Time:
+			if t != nil && t.Location() != time.UTC {
+				u := t.UTC()
+				_ = f.Set(ctx, row, &u)
+			}
+		}
+	}
+}
+
+// utcConditions converts the times bound to the WHERE clause and to raw SQL.
+func utcConditions(db *gorm.DB) {
+	stmt := db.Statement
+	for i, v := range stmt.Vars {
+		stmt.Vars[i] = utcVar(v)
+	}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			where.Exprs = utcExprs(where.Exprs)
+			c.Expression = where
+			stmt.Clauses["WHERE"] = c
+		}
+	}
+}
+
+func utcExprs(exprs []clause.Expression) []clause.Expression {
+	out := make([]clause.Expression, len(exprs))
+	for i, e := range exprs {
+		switch e := e.(type) {
+		case clause.Expr:
+			e.Vars = utcVars(e.Vars)
+			out[i] = e
+		case clause.NamedExpr:
+			e.Vars = utcVars(e.Vars)
+			out[i] = e
+		case clause.IN:
+			e.Values = utcVars(e.Values)
+			out[i] = e
+		case clause.Eq:
+			e.Value = utcVar(e.Value)
+			out[i] = e
+		case clause.Neq:
+			e.Value = utcVar(e.Value)
+			out[i] = e
+		case clause.Gt:
+			e.Value = utcVar(e.Value)
+			out[i] = e
+		case clause.Gte:
+			e.Value = utcVar(e.Value)
+			out[i] = e
+		case clause.Lt:
+			e.Value = utcVar(e.Value)
+			out[i] = e
+		case clause.Lte:
+			e.Value = utcVar(e.Value)
+			out[i] = e
+		case clause.AndConditions:
+			e.Exprs = utcExprs(e.Exprs)
+			out[i] = e
+		case clause.OrConditions:
+			e.Exprs = utcExprs(e.Exprs)
+			out[i] = e
+		case clause.NotConditions:
+			e.Exprs = utcExprs(e.Exprs)
+			out[i] = e
+		default:
+			out[i] = e
+		}
+	}
+	return out
+}
+
+func utcVars(vars []interface{}) []interface{} {
+	out := make([]interface{}, len(vars))
+	for i, v := range vars {
+		out[i] = utcVar(v)
+	}
+	return out
+}
+
+// utcVar returns v in UTC if it is a time, or a slice holding times.
+func utcVar(v interface{}) interface{} {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC()
+	case *time.Time:
+		if t != nil {
+			u := t.UTC()
+			return &u
+		}
+	case []time.Time:
+		out := make([]time.Time, len(t))
+		for i := range t {
+			out[i] = t[i].UTC()
+		}
+		return out
+	case []interface{}:
+		return utcVars(t)
+	}
+	return v
+}
@@ -12,7 +12,8 @@ import (
 
 // HealthWSHandler returns an HTTP handler that upgrades to WebSocket and
 // pushes HealthStats snapshots every 3 seconds. An immediate snapshot is
-// sent on connection so the client never has to wait for the first tick.
+// sent on connection so the client never has to wait for the first tick. Clients
+// that stop answering pings are disconnected (see SetHealthKeepalive).
 func (m *Metrics) HealthWSHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
@@ -24,9 +25,9 @@ func (m *Metrics) HealthWSHandler() http.HandlerFunc {
 		}
 		defer conn.Close(websocket.StatusNormalClosure, "closing")
 
-		// Track this connection in active_connections metric
-		m.IncrementActiveConns()
-		defer m.DecrementActiveConns()
+		// Track this connection in active_connections{hub="health"}
+		m.addHealthConnection(1)
+		defer m.addHealthConnection(-1)
 
 		slog.Info("📊 Health WS client connected")
 
@@ -53,6 +54,7 @@ func (m *Metrics) HealthWSHandler() http.HandlerFunc {
 				}
 			}
 		}()
+		go m.healthKeepalive.Run(connCtx, conn)
 
 		for {
 			select {
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// serviceWindowSeconds is the sliding window used for per-service ingest volume.
+const serviceWindowSeconds = 60
+
+// ServiceIngestStat is the ingest volume of a single service over the last minute.
+type ServiceIngestStat struct {
+	Service string `json:"service"`
+	Records int64  `json:"records"`
+}
+
+// serviceIngestWindow keeps per-second, per-service record counts for the last minute.
+type serviceIngestWindow struct {
+	mu    sync.Mutex
+	slots [serviceWindowSeconds]struct {
+		second int64
+		counts map[string]int64
+	}
+}
+
+func (w *serviceIngestWindow) add(service string, n int, now time.Time) {
+	sec := now.Unix()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot := &w.slots[sec%serviceWindowSeconds]
+	if slot.second != sec || slot.counts == nil {
+		slot.second = sec
+		slot.counts = make(map[string]int64)
+	}
+	slot.counts[service] += int64(n)
+}
+
+// top returns the n services with the highest volume within the window.
+func (w *serviceIngestWindow) top(n int, now time.Time) []ServiceIngestStat {
+	oldest := now.Unix() - serviceWindowSeconds + 1
+	totals := make(map[string]int64)
+
+	w.mu.Lock()
+	for i := range w.slots {
+		slot := &w.slots[i]
+		if slot.second < oldest {
+			continue
+		}
+		for svc, c := range slot.counts {
+			totals[svc] += c
+		}
+	}
+	w.mu.Unlock()
+
+	out := make([]ServiceIngestStat, 0, len(totals))
+	for svc, c := range totals {
+		out = append(out, ServiceIngestStat{Service: svc, Records: c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Records != out[j].Records {
+			return out[i].Records > out[j].Records
+		}
+		return out[i].Service < out[j].Service
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
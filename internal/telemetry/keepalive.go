@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Keepalive pings WebSocket clients, so a connection whose peer vanished without
+// closing it (a laptop lid shut, a dropped network) is closed instead of lingering
+// until the TCP stack gives up. The zero value sends no pings.
+type Keepalive struct {
+	Interval    time.Duration // between pings; 0 = no keepalive
+	IdleTimeout time.Duration // a client without a pong for this long is disconnected
+}
+
+// Run pings conn every Interval until ctx is done and closes it once IdleTimeout
+// passes without a pong. Pongs are only processed while the caller reads from conn,
+// so the caller's read loop sees the close and unregisters the client as usual.
+func (k Keepalive) Run(ctx context.Context, conn *websocket.Conn) {
+	if k.Interval <= 0 || k.IdleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(k.Interval)
+	defer ticker.Stop()
+
+	lastPong := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pingCtx, cancel := context.WithDeadline(ctx, lastPong.Add(k.IdleTimeout))
+		err := conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Debug("WebSocket client stopped answering pings, closing", "idle", time.Since(lastPong).Round(time.Millisecond), "error", err)
+				conn.CloseNow()
+			}
+			return
+		}
+		lastPong = time.Now()
+	}
+}
@@ -4,20 +4,31 @@ import (
 	"encoding/json"
 	"net/http"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// WebSocket hub types, the values of the "hub" label on OtelContext_active_connections.
+const (
+	HubWS     = "ws"     // /ws live log and metric stream
+	HubEvents = "events" // /ws/events live snapshots
+	HubHealth = "health" // /ws/health health stream
+)
+
 // Metrics holds all internal Prometheus metrics for OtelContext self-monitoring.
 type Metrics struct {
 	// --- Existing ---
 	IngestionRate     prometheus.Counter
-	ActiveConnections prometheus.Gauge
+	ActiveConnections *prometheus.GaugeVec
 	DBLatency         prometheus.Histogram
+	DBQueryDuration   *prometheus.HistogramVec
+	DBBatchSize       *prometheus.GaugeVec
 	DLQSize           prometheus.Gauge
 
 	// --- gRPC ---
@@ -25,19 +36,38 @@ type Metrics struct {
 	GRPCRequestDuration *prometheus.HistogramVec
 	GRPCBatchSize       prometheus.Histogram
 
+	// --- Ingest ---
+	IngestExportDuration *prometheus.HistogramVec
+	IngestRequestBytes   *prometheus.CounterVec
+	IngestServiceRecords *prometheus.CounterVec
+	IngestDuplicates     *prometheus.CounterVec
+	MetricPointsClamped  prometheus.Counter
+	LogsCollapsed        prometheus.Counter
+	SpansOverTraceLimit  prometheus.Counter
+	LogDispatchDuration  prometheus.Histogram
+	LogDispatchDropped   prometheus.Counter
+
 	// --- HTTP ---
 	HTTPRequestsTotal   *prometheus.CounterVec
 	HTTPRequestDuration *prometheus.HistogramVec
+	HTTPThrottled       *prometheus.CounterVec
+
+	// --- Dashboard cache ---
+	DashboardCacheHits   prometheus.Counter
+	DashboardCacheMisses prometheus.Counter
 
 	// --- TSDB ---
 	TSDBIngestTotal       prometheus.Counter
 	TSDBFlushDuration     prometheus.Histogram
 	TSDBBatchesDropped    prometheus.Counter
 	TSDBCardinalityOverflow prometheus.Counter
+	TSDBSeriesOverflow      prometheus.Counter
 
 	// --- WebSocket ---
 	WSMessagesSent        *prometheus.CounterVec
 	WSSlowClientsRemoved  prometheus.Counter
+	LiveSnapshotDuration  prometheus.Histogram
+	LiveSnapshotsSkipped  prometheus.Counter
 
 	// --- DLQ ---
 	DLQEnqueuedTotal    prometheus.Counter
@@ -45,42 +75,69 @@ type Metrics struct {
 	DLQReplayFailure    prometheus.Counter
 	DLQDiskBytes        prometheus.Gauge
 
+	// --- Log bridge ---
+	BridgeMessages *prometheus.CounterVec
+
 	// --- Archive ---
 	ArchiveRecordsMoved *prometheus.CounterVec
 	HotDBSizeBytes      prometheus.Gauge
 	ColdStorageBytes    prometheus.Gauge
 
+	// --- Reports ---
+	ReportDeliveries *prometheus.CounterVec
+
 	// --- Runtime ---
 	GoGoroutines   prometheus.Gauge
 	GoHeapAllocBytes prometheus.Gauge
 
 	// Atomic counters for JSON health endpoint (avoids scraping Prometheus)
-	totalIngested   atomic.Int64
-	activeConns     atomic.Int64
-	dlqFileCount    atomic.Int64
-	dbLatencyP99Ms  atomic.Int64
-	startTime       time.Time
+	totalIngested  atomic.Int64
+	dlqFileCount   atomic.Int64
+	dbLatencyP99Ms atomic.Int64
+	startTime      time.Time
+
+	// Open WebSocket connections per hub. Each hub reports only its own count, so
+	// the total is the sum and cannot drift when one hub's clients churn.
+	connMu     sync.Mutex
+	connCounts map[string]int64
+
+	serviceWindow serviceIngestWindow // per-service ingest volume (last minute)
+
+	version string // server build version reported by /api/health
+	uiBuild string // embedded frontend build stamp reported by /api/health
+
+	healthKeepalive Keepalive // pings of /ws/health clients
 }
 
 // New creates and registers all OtelContext internal metrics.
 func New() *Metrics {
 	m := &Metrics{
-		startTime: time.Now(),
+		startTime:  time.Now(),
+		connCounts: map[string]int64{HubWS: 0, HubEvents: 0, HubHealth: 0},
 
 		// Existing
 		IngestionRate: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "OtelContext_ingestion_rate",
 			Help: "Total number of spans and logs ingested.",
 		}),
-		ActiveConnections: promauto.NewGauge(prometheus.GaugeOpts{
+		ActiveConnections: promauto.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "OtelContext_active_connections",
-			Help: "Number of active WebSocket client connections.",
-		}),
+			Help: "Number of active WebSocket client connections by hub (ws, events, health).",
+		}, []string{"hub"}),
 		DBLatency: promauto.NewHistogram(prometheus.HistogramOpts{
 			Name:    "OtelContext_db_latency",
 			Help:    "Database operation latency in seconds.",
 			Buckets: prometheus.DefBuckets,
 		}),
+		DBQueryDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "OtelContext_db_query_duration_seconds",
+			Help:    "Database statement latency in seconds by the API route that ran it (\"background\" outside API requests).",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"route"}),
+		DBBatchSize: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "OtelContext_db_batch_size",
+			Help: "Rows per insert statement by table; changes over time with DB_BATCH_ADAPTIVE.",
+		}, []string{"table"}),
 		DLQSize: promauto.NewGauge(prometheus.GaugeOpts{
 			Name: "OtelContext_dlq_size",
 			Help: "Number of files currently in the Dead Letter Queue.",
@@ -102,16 +159,70 @@ func New() *Metrics {
 			Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500},
 		}),
 
+		// Ingest
+		IngestExportDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "OtelContext_ingest_export_duration_seconds",
+			Help:    "OTLP Export handler latency in seconds by signal (traces, logs, metrics).",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method"}),
+		IngestRequestBytes: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "OtelContext_ingest_request_bytes_total",
+			Help: "Total OTLP Export request payload bytes by signal.",
+		}, []string{"method"}),
+		IngestServiceRecords: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "OtelContext_ingest_service_records_total",
+			Help: "Spans, logs and metric points ingested per service and signal.",
+		}, []string{"service", "method"}),
+		IngestDuplicates: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "OtelContext_ingest_duplicates_skipped_total",
+			Help: "Spans and logs not stored because an identical record already was (retried exports).",
+		}, []string{"signal"}),
+		MetricPointsClamped: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_ingest_metric_points_clamped_total",
+			Help: "Metric data points whose future timestamp was clamped to server time.",
+		}),
+		LogsCollapsed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_ingest_logs_collapsed_total",
+			Help: "Repeated log records counted on an earlier identical record instead of being stored.",
+		}),
+		SpansOverTraceLimit: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_ingest_spans_over_trace_limit_total",
+			Help: "Spans not stored because their trace already had TRACE_MAX_SPANS spans.",
+		}),
+		LogDispatchDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "OtelContext_log_dispatch_duration_seconds",
+			Help:    "Time to fan out one batch of stored logs (live broadcast, AI enqueue, refresh), off the Export path.",
+			Buckets: []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}),
+		LogDispatchDropped: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_log_dispatch_dropped_total",
+			Help: "Stored logs left out of live fan-out because the dispatch queue was full.",
+		}),
+
 		// HTTP
 		HTTPRequestsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "OtelContext_http_requests_total",
-			Help: "Total HTTP requests by method, path, and status.",
-		}, []string{"method", "path", "status"}),
+			Help: "Total HTTP requests by method, route pattern, and status.",
+		}, []string{"method", "route", "status"}),
 		HTTPRequestDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
 			Name:    "OtelContext_http_request_duration_seconds",
-			Help:    "HTTP request latency in seconds.",
+			Help:    "HTTP request latency in seconds by method and route pattern.",
 			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
-		}, []string{"method", "path"}),
+		}, []string{"method", "route"}),
+		HTTPThrottled: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "OtelContext_http_throttled_total",
+			Help: "API requests rejected by the rate limiter (rate_limit) or an endpoint's concurrency limit (concurrency), by route pattern.",
+		}, []string{"route", "reason"}),
+
+		// Dashboard cache
+		DashboardCacheHits: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_dashboard_cache_hits_total",
+			Help: "Dashboard stats requests served from the cache.",
+		}),
+		DashboardCacheMisses: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_dashboard_cache_misses_total",
+			Help: "Dashboard stats requests that had to query the database.",
+		}),
 
 		// TSDB
 		TSDBIngestTotal: promauto.NewCounter(prometheus.CounterOpts{
@@ -131,6 +242,10 @@ func New() *Metrics {
 			Name: "OtelContext_tsdb_cardinality_overflow_total",
 			Help: "Metric points routed to overflow bucket due to cardinality limit.",
 		}),
+		TSDBSeriesOverflow: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_tsdb_series_overflow_total",
+			Help: "Metric points folded into their metric's overflow series due to the per-metric series limit.",
+		}),
 
 		// WebSocket
 		WSMessagesSent: promauto.NewCounterVec(prometheus.CounterOpts{
@@ -141,6 +256,15 @@ func New() *Metrics {
 			Name: "OtelContext_ws_slow_clients_removed_total",
 			Help: "WebSocket clients dropped due to slow consumption.",
 		}),
+		LiveSnapshotDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "OtelContext_live_snapshot_duration_seconds",
+			Help:    "Time to compute one service filter's live snapshot for the events WebSocket.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8},
+		}),
+		LiveSnapshotsSkipped: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "OtelContext_live_snapshot_skipped_total",
+			Help: "Live snapshot ticks skipped or cut short because the previous flush was still running or the budget ran out.",
+		}),
 
 		// DLQ
 		DLQEnqueuedTotal: promauto.NewCounter(prometheus.CounterOpts{
@@ -160,6 +284,12 @@ func New() *Metrics {
 			Help: "Total disk usage of the DLQ directory in bytes.",
 		}),
 
+		// Log bridge
+		BridgeMessages: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "OtelContext_bridge_messages_total",
+			Help: "Messages consumed by the log bridge, by result: stored, filtered, spilled (to the DLQ) or failed (left for redelivery).",
+		}, []string{"result"}),
+
 		// Archive
 		ArchiveRecordsMoved: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "OtelContext_archive_records_moved_total",
@@ -174,6 +304,12 @@ func New() *Metrics {
 			Help: "Total cold archive size on disk in bytes.",
 		}),
 
+		// Reports
+		ReportDeliveries: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "OtelContext_report_deliveries_total",
+			Help: "Scheduled report delivery attempts by channel and result (success, retry, failure).",
+		}, []string{"channel", "result"}),
+
 		// Runtime
 		GoGoroutines: promauto.NewGauge(prometheus.GaugeOpts{
 			Name: "OtelContext_go_goroutines",
@@ -184,6 +320,14 @@ func New() *Metrics {
 			Help: "Current Go heap allocations in bytes.",
 		}),
 	}
+
+	// The default registry already carries the process collector and a Go collector
+	// with goroutine and memstats series; replace the latter with one that also
+	// exports GC pause and scheduler latency histograms.
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.MustRegister(collectors.NewGoCollector(
+		collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsGC, collectors.MetricsScheduler),
+	))
 	return m
 }
 
@@ -208,23 +352,79 @@ func (m *Metrics) RecordIngestion(count int) {
 	m.totalIngested.Add(int64(count))
 }
 
-func (m *Metrics) SetActiveConnections(n int) {
-	m.ActiveConnections.Set(float64(n))
-	m.activeConns.Store(int64(n))
+// RecordServiceIngest records records ingested for a service, labeled by signal
+// (traces, logs, metrics), and feeds the last-minute top services view.
+func (m *Metrics) RecordServiceIngest(service, method string, count int) {
+	if count <= 0 {
+		return
+	}
+	m.IngestServiceRecords.WithLabelValues(service, method).Add(float64(count))
+	m.serviceWindow.add(service, count, time.Now())
+}
+
+// RecordDuplicatesSkipped counts spans or logs dropped as duplicates of stored records.
+func (m *Metrics) RecordDuplicatesSkipped(signal string, count int) {
+	m.IngestDuplicates.WithLabelValues(signal).Add(float64(count))
+}
+
+// RecordReportDelivery counts one report delivery attempt outcome.
+func (m *Metrics) RecordReportDelivery(channel, result string) {
+	m.ReportDeliveries.WithLabelValues(channel, result).Inc()
+}
+
+// RecordMetricPointsClamped counts metric points whose timestamp was clamped to now.
+func (m *Metrics) RecordMetricPointsClamped(count int) {
+	m.MetricPointsClamped.Add(float64(count))
+}
+
+// RecordLogsCollapsed counts log records folded into the repeat count of an earlier one.
+func (m *Metrics) RecordLogsCollapsed(count int) {
+	m.LogsCollapsed.Add(float64(count))
+}
+
+// RecordSpansOverTraceLimit counts spans dropped by the per-trace span limit.
+func (m *Metrics) RecordSpansOverTraceLimit(count int) {
+	m.SpansOverTraceLimit.Add(float64(count))
 }
 
-func (m *Metrics) IncrementActiveConns() {
-	n := m.activeConns.Add(1)
-	m.ActiveConnections.Set(float64(n))
+// ObserveExport records the duration and payload size of a single OTLP Export call.
+func (m *Metrics) ObserveExport(method string, seconds float64, bytes int) {
+	m.IngestExportDuration.WithLabelValues(method).Observe(seconds)
+	m.IngestRequestBytes.WithLabelValues(method).Add(float64(bytes))
 }
 
-func (m *Metrics) DecrementActiveConns() {
-	n := m.activeConns.Add(-1)
+// SetActiveConnections records the number of clients connected to one hub. Hubs
+// call it with their own client count whenever it changes.
+func (m *Metrics) SetActiveConnections(hub string, n int) {
 	if n < 0 {
 		n = 0
-		m.activeConns.Store(0)
 	}
-	m.ActiveConnections.Set(float64(n))
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	m.connCounts[hub] = int64(n)
+	m.ActiveConnections.WithLabelValues(hub).Set(float64(n))
+}
+
+// addHealthConnection adjusts the /ws/health client count, which this package owns.
+func (m *Metrics) addHealthConnection(delta int64) {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	n := max(m.connCounts[HubHealth]+delta, 0)
+	m.connCounts[HubHealth] = n
+	m.ActiveConnections.WithLabelValues(HubHealth).Set(float64(n))
+}
+
+// connections returns the per-hub counts and their total.
+func (m *Metrics) connections() (map[string]int64, int64) {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	byHub := make(map[string]int64, len(m.connCounts))
+	var total int64
+	for hub, n := range m.connCounts {
+		byHub[hub] = n
+		total += n
+	}
+	return byHub, total
 }
 
 func (m *Metrics) SetDLQSize(n int) {
@@ -232,35 +432,69 @@ func (m *Metrics) SetDLQSize(n int) {
 	m.dlqFileCount.Store(int64(n))
 }
 
+// SetBuildInfo sets the server version and embedded UI build stamp reported in the
+// health payload. Call it before serving requests.
+func (m *Metrics) SetBuildInfo(version, uiBuild string) {
+	m.version = version
+	m.uiBuild = uiBuild
+}
+
+// SetHealthKeepalive sets how /ws/health clients are pinged. Call it before serving
+// requests.
+func (m *Metrics) SetHealthKeepalive(k Keepalive) {
+	m.healthKeepalive = k
+}
+
 func (m *Metrics) ObserveDBLatency(seconds float64) {
 	m.DBLatency.Observe(seconds)
 	m.dbLatencyP99Ms.Store(int64(seconds * 1000))
 }
 
+// ObserveDBQuery records the latency of a statement run for route.
+func (m *Metrics) ObserveDBQuery(route string, seconds float64) {
+	m.DBQueryDuration.WithLabelValues(route).Observe(seconds)
+}
+
+// SetDBBatchSize records the number of rows per insert statement into table.
+func (m *Metrics) SetDBBatchSize(table string, size int) {
+	m.DBBatchSize.WithLabelValues(table).Set(float64(size))
+}
+
 // --- Health endpoint ---
 
 // HealthStats is the JSON response for GET /api/health.
 type HealthStats struct {
-	IngestionRate  int64   `json:"ingestion_rate"`
-	DLQSize        int64   `json:"dlq_size"`
-	ActiveConns    int64   `json:"active_connections"`
-	DBLatencyP99Ms float64 `json:"db_latency_p99_ms"`
-	Goroutines     int     `json:"goroutines"`
-	HeapAllocMB    float64 `json:"heap_alloc_mb"`
-	UptimeSeconds  float64 `json:"uptime_seconds"`
+	IngestionRate  int64               `json:"ingestion_rate"`
+	DLQSize        int64               `json:"dlq_size"`
+	ActiveConns    int64               `json:"active_connections"` // sum of Connections
+	Connections    map[string]int64    `json:"connections"`        // open WebSocket clients per hub
+	DBLatencyP99Ms float64             `json:"db_latency_p99_ms"`
+	Goroutines     int                 `json:"goroutines"`
+	HeapAllocMB    float64             `json:"heap_alloc_mb"`
+	HeapInuseMB    float64             `json:"heap_inuse_mb"`
+	UptimeSeconds  float64             `json:"uptime_seconds"`
+	TopServices    []ServiceIngestStat `json:"top_services"` // top 5 by ingest volume, last minute
+	Version        string              `json:"version"`
+	UIBuild        string              `json:"ui_build"` // compare with the value the SPA was loaded with
 }
 
 func (m *Metrics) GetHealthStats() HealthStats {
 	var ms runtime.MemStats
 	runtime.ReadMemStats(&ms)
+	byHub, totalConns := m.connections()
 	return HealthStats{
 		IngestionRate:  m.totalIngested.Load(),
 		DLQSize:        m.dlqFileCount.Load(),
-		ActiveConns:    m.activeConns.Load(),
+		ActiveConns:    totalConns,
+		Connections:    byHub,
 		DBLatencyP99Ms: float64(m.dbLatencyP99Ms.Load()),
 		Goroutines:     runtime.NumGoroutine(),
 		HeapAllocMB:    float64(ms.HeapAlloc) / 1024 / 1024,
+		HeapInuseMB:    float64(ms.HeapInuse) / 1024 / 1024,
 		UptimeSeconds:  time.Since(m.startTime).Seconds(),
+		TopServices:    m.serviceWindow.top(5, time.Now()),
+		Version:        m.version,
+		UIBuild:        m.uiBuild,
 	}
 }
 
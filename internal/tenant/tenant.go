@@ -0,0 +1,170 @@
+// Package tenant maps bearer tokens to tenants and carries the resolved tenant
+// through request contexts. Multi-tenancy is on when at least one tenant token is
+// configured; ingest then stores every record under its sender's tenant, and API
+// reads only see the caller's tenant unless the super-admin token is used.
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Default owns data ingested without a tenant token, including every row stored
+// before multi-tenancy was enabled.
+const Default = "default"
+
+// validName limits tenant IDs to what is safe in logs, URLs and index keys.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Tokens resolves bearer tokens to tenants. The zero value and nil have no tokens,
+// which leaves multi-tenancy off.
+type Tokens struct {
+	byToken    map[string]string
+	superAdmin string
+}
+
+// ParseTokens builds the token table from "token=tenant,..." or the path of a JSON
+// file holding {"token": "tenant"}, plus the super-admin token. Unlike most settings,
+// a malformed entry is an error: silently dropping a token would lock a team out, and
+// guessing at one could let it into another team's data.
+func ParseTokens(spec, superAdmin string) (*Tokens, error) {
+	t := &Tokens{byToken: make(map[string]string), superAdmin: strings.TrimSpace(superAdmin)}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return t, nil
+	}
+
+	pairs := make(map[string]string)
+	if !strings.Contains(spec, "=") {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tenant token file: %w", err)
+		}
+		if err := json.Unmarshal(data, &pairs); err != nil {
+			return nil, fmt.Errorf("invalid tenant token file %s: %w", spec, err)
+		}
+	} else {
+		for i, pair := range strings.Split(spec, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			token, name, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("tenant token entry %d: want token=tenant", i+1)
+			}
+			if _, dup := pairs[strings.TrimSpace(token)]; dup {
+				return nil, fmt.Errorf("tenant token entry %d: token listed twice", i+1)
+			}
+			pairs[strings.TrimSpace(token)] = strings.TrimSpace(name)
+		}
+	}
+
+	for token, name := range pairs {
+		switch {
+		case token == "":
+			return nil, fmt.Errorf("empty token for tenant %q", name)
+		case !validName.MatchString(name):
+			return nil, fmt.Errorf("invalid tenant name %q: use up to 64 letters, digits, '.', '_' or '-'", name)
+		case token == t.superAdmin:
+			return nil, fmt.Errorf("the token of tenant %q is also the super-admin token", name)
+		}
+		t.byToken[token] = name
+	}
+	return t, nil
+}
+
+// Enabled reports whether any tenant token is configured.
+func (t *Tokens) Enabled() bool {
+	return t != nil && len(t.byToken) > 0
+}
+
+// Tenants returns the configured tenant names, with duplicates removed.
+func (t *Tokens) Tenants() []string {
+	if t == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range t.byToken {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Resolve returns the identity a token grants: a tenant, or super-admin access to
+// every tenant. ok is false for unknown tokens.
+func (t *Tokens) Resolve(token string) (id Identity, ok bool) {
+	if t == nil || token == "" {
+		return Identity{}, false
+	}
+	if t.superAdmin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.superAdmin)) == 1 {
+		return Identity{SuperAdmin: true}, true
+	}
+	// Map lookups are not constant-time, but tokens are long random secrets and the
+	// lookup reveals no more than whether a guess was right.
+	if name, found := t.byToken[token]; found {
+		return Identity{Tenant: name}, true
+	}
+	return Identity{}, false
+}
+
+// BearerToken extracts the token of an "Authorization: Bearer <token>" header value.
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	Tenant     string // "" for the super-admin
+	SuperAdmin bool
+}
+
+// String names the identity for logs and audit entries.
+func (id Identity) String() string {
+	if id.SuperAdmin {
+		return "super-admin"
+	}
+	return "tenant:" + id.Tenant
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying id.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity in ctx; ok is false when the request was not
+// authenticated, i.e. multi-tenancy is off.
+func FromContext(ctx context.Context) (id Identity, ok bool) {
+	id, ok = ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// Scope returns the tenant whose data ctx may see, or "" when it may see everything:
+// with multi-tenancy off, or for the super-admin.
+func Scope(ctx context.Context) string {
+	id, _ := FromContext(ctx)
+	return id.Tenant
+}
+
+// IngestTenant returns the tenant records sent with ctx are stored under. Records
+// sent without a tenant token, or with the super-admin token, belong to Default.
+func IngestTenant(ctx context.Context) string {
+	if t := Scope(ctx); t != "" {
+		return t
+	}
+	return Default
+}
@@ -0,0 +1,89 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens(" a-secret=team-a, b-secret=team-b,,c-secret=team-a ", "root")
+	if err != nil {
+		t.Fatalf("ParseTokens() error = %v", err)
+	}
+	if !tokens.Enabled() || len(tokens.Tenants()) != 2 {
+		t.Errorf("tenants = %v, want team-a and team-b", tokens.Tenants())
+	}
+	for token, want := range map[string]Identity{
+		"a-secret": {Tenant: "team-a"},
+		"c-secret": {Tenant: "team-a"},
+		"b-secret": {Tenant: "team-b"},
+		"root":     {SuperAdmin: true},
+	} {
+		if id, ok := tokens.Resolve(token); !ok || id != want {
+			t.Errorf("Resolve(%q) = %+v, %v; want %+v", token, id, ok, want)
+		}
+	}
+	for _, token := range []string{"", "team-a", "a-secret "} {
+		if _, ok := tokens.Resolve(token); ok {
+			t.Errorf("Resolve(%q) succeeded", token)
+		}
+	}
+
+	for _, spec := range []string{
+		"a-secret",             // no tenant
+		"a=team-a,a=team-b",    // duplicate token
+		"=team-a",              // empty token
+		"a=",                   // empty tenant
+		"a=team a",             // invalid name
+		"a=team-a,root=team-b", // super-admin token reused
+		filepath.Join(t.TempDir(), "missing.json"),
+	} {
+		if _, err := ParseTokens(spec, "root"); err == nil {
+			t.Errorf("ParseTokens(%q) succeeded", spec)
+		}
+	}
+
+	if off, err := ParseTokens("", "root"); err != nil || off.Enabled() {
+		t.Errorf("ParseTokens(\"\") = %+v, %v; want multi-tenancy off", off, err)
+	}
+}
+
+func TestParseTokensFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, []byte(`{"a-secret": "team-a"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := ParseTokens(path, "")
+	if err != nil {
+		t.Fatalf("ParseTokens() error = %v", err)
+	}
+	if id, ok := tokens.Resolve("a-secret"); !ok || id.Tenant != "team-a" {
+		t.Errorf("Resolve() = %+v, %v", id, ok)
+	}
+	if _, ok := tokens.Resolve(""); ok {
+		t.Error("empty token resolved with no super-admin token set")
+	}
+}
+
+func TestContextScope(t *testing.T) {
+	ctx := context.Background()
+	if Scope(ctx) != "" || IngestTenant(ctx) != Default {
+		t.Errorf("unauthenticated: scope %q, ingest tenant %q", Scope(ctx), IngestTenant(ctx))
+	}
+	admin := NewContext(ctx, Identity{SuperAdmin: true})
+	if Scope(admin) != "" || IngestTenant(admin) != Default {
+		t.Errorf("super-admin: scope %q, ingest tenant %q", Scope(admin), IngestTenant(admin))
+	}
+	team := NewContext(ctx, Identity{Tenant: "team-a"})
+	if Scope(team) != "team-a" || IngestTenant(team) != "team-a" {
+		t.Errorf("tenant: scope %q, ingest tenant %q", Scope(team), IngestTenant(team))
+	}
+	if got := BearerToken("bearer  abc "); got != "abc" {
+		t.Errorf("BearerToken() = %q, want abc", got)
+	}
+	if got := BearerToken("Basic abc"); got != "" {
+		t.Errorf("BearerToken(Basic) = %q, want empty", got)
+	}
+}
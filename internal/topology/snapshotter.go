@@ -0,0 +1,85 @@
+// Package topology records the service map at a fixed interval, so the topology and
+// error rates at a past moment can still be shown once the spans behind them have
+// been purged.
+package topology
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// Store is the storage the snapshotter reads service maps from and saves them to.
+type Store interface {
+	GetServiceMapMetricsContext(ctx context.Context, start, end time.Time) (*storage.ServiceMapMetrics, error)
+	storage.ServiceMapHistoryStore
+}
+
+// Snapshotter saves the service map of each interval and prunes snapshots older than
+// the retention.
+type Snapshotter struct {
+	store     Store
+	interval  time.Duration
+	retention time.Duration
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// New creates a snapshotter that stores the map of the last interval every interval
+// and keeps snapshots for retention.
+func New(store Store, interval, retention time.Duration) *Snapshotter {
+	return &Snapshotter{
+		store:     store,
+		interval:  interval,
+		retention: retention,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start runs the snapshot loop. Blocks until ctx is cancelled or Stop is called.
+func (s *Snapshotter) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			if err := s.SnapshotOnce(ctx, time.Now()); err != nil {
+				slog.Error("Topology: snapshot failed", "error", err)
+			}
+		}
+	}
+}
+
+// Stop terminates the snapshot loop.
+func (s *Snapshotter) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
+
+// SnapshotOnce stores the service map of the interval ending at now and prunes
+// snapshots that have passed the retention.
+func (s *Snapshotter) SnapshotOnce(ctx context.Context, now time.Time) error {
+	m, err := s.store.GetServiceMapMetricsContext(ctx, now.Add(-s.interval), now)
+	if err != nil {
+		return err
+	}
+	if err := s.store.SaveServiceMapSnapshot(now, s.interval, m); err != nil {
+		return err
+	}
+	if s.retention > 0 {
+		if _, err := s.store.PruneServiceMapSnapshots(now.Add(-s.retention)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
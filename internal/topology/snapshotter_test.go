@@ -0,0 +1,56 @@
+package topology
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+func TestSnapshotOncePrunesPastRetention(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "topology.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	if err := repo.BatchCreateSpans([]storage.Span{{
+		TraceID: "t1", SpanID: "s1", OperationName: "GET /cart", ServiceName: "cart",
+		StartTime: now.Add(-time.Minute), EndTime: now.Add(-time.Minute + time.Millisecond),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(repo, 5*time.Minute, 24*time.Hour)
+	for _, at := range []time.Time{now.Add(-48 * time.Hour), now.Add(-time.Hour), now} {
+		if err := s.SnapshotOnce(context.Background(), at); err != nil {
+			t.Fatalf("SnapshotOnce(%v) error = %v", at, err)
+		}
+	}
+
+	// The 48h-old snapshot was pruned by the last run; the hour-old one is kept.
+	oldest, err := repo.GetServiceMapSnapshotNear(now.Add(-72 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !oldest.Timestamp.Equal(now.Add(-time.Hour)) {
+		t.Errorf("oldest snapshot = %v, want %v", oldest.Timestamp, now.Add(-time.Hour))
+	}
+
+	latest, err := repo.GetServiceMapSnapshotNear(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := latest.ServiceMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Nodes) != 1 || m.Nodes[0].Name != "cart" {
+		t.Errorf("latest snapshot nodes = %+v, want cart", m.Nodes)
+	}
+}
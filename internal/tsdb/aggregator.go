@@ -4,25 +4,72 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log/slog"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/RandomCodeSpace/otelcontext/internal/logging"
 	"github.com/RandomCodeSpace/otelcontext/internal/storage"
 )
 
+// logger is the "tsdb" component logger, so aggregator debugging can be turned on
+// without the rest of the process.
+var logger = logging.Component("tsdb")
+
 // RawMetric represents an incoming single metric data point before aggregation.
 type RawMetric struct {
 	Name        string
+	TenantID    string // "" = the default tenant
 	ServiceName string
+	ScopeName   string // instrumentation scope that produced the point (not persisted)
 	Value       float64
 	Timestamp   time.Time
 	Attributes  map[string]interface{}
+	Exemplars   []storage.Exemplar // sampled measurements carrying trace context, if any
+
+	// Catalog metadata from the OTLP Metric; not persisted with the bucket.
+	Type        string // gauge, sum or histogram
+	Unit        string
+	Description string
+}
+
+// MaxCatalogSeries caps the distinct series the catalog counts per metric and window;
+// a metric with more is reported with this cardinality and the services of the series
+// counted.
+const MaxCatalogSeries = 10000
+
+// MaxCatalogMetrics caps the distinct metrics the catalog describes per window; the
+// points of further metrics are not described until a window with room.
+const MaxCatalogMetrics = 10000
+
+// DefaultMaxSeriesPerMetric is the number of attribute sets a metric may have per
+// window unless changed with SetSeriesLimit.
+const DefaultMaxSeriesPerMetric = 1000
+
+// overflowAttributes replaces the attributes of series beyond a metric's limit, so all
+// of them are aggregated into one bucket per service.
+const overflowAttributes = `{"argus.overflow":"true"}`
+
+// metricSeries counts the series one metric opened in the current window.
+type metricSeries struct {
+	count  int
+	warned bool // the overflow has been logged this window
+}
+
+// catalogEntry collects what one window saw of one metric.
+type catalogEntry struct {
+	meta     storage.MetricCatalog
+	services map[string]struct{}
+	series   map[uint64]struct{}
 }
 
 // Aggregator manages in-memory tumbling windows for metrics.
 type Aggregator struct {
-	repo            *storage.Repository
+	repo            storage.MetricWriter
 	windowSize      time.Duration
 	buckets         map[string]*storage.MetricBucket
 	mu              sync.Mutex
@@ -31,14 +78,37 @@ type Aggregator struct {
 	pool            sync.Pool
 	droppedBatches  int64
 
+	// Shutdown
+	stopOnce sync.Once
+	running  bool          // Start has begun; guarded by mu
+	stopped  bool          // Stop has been called; guarded by mu
+	done     chan struct{} // closed once the final flush has been persisted
+
+	// spill receives batches that cannot be queued or written (e.g. the DLQ)
+	spill func([]storage.MetricBucket) error
+
+	// Exemplars kept per bucket; the highest-value ones win
+	maxExemplars int
+
 	// Cardinality controls
 	maxCardinality      int    // 0 = unlimited
 	cardinalityOverflow func() // called when overflow bucket is used (for metrics)
 	overflowKey         string // constant key for the overflow bucket
 
+	// Per-metric series limits, reset every window
+	maxSeries      int            // 0 = unlimited
+	seriesLimits   map[string]int // metric name -> limit, overriding maxSeries
+	seriesOverflow func()         // called for each point folded into an overflow series
+	series         map[string]*metricSeries
+
 	// Ring buffer accelerator (optional)
 	ring *RingBuffer
 
+	// Metric catalog, written on every flush when set
+	catalogWriter storage.MetricCatalogWriter
+	catalog       map[string]*catalogEntry
+	catalogFull   bool // MaxCatalogMetrics has been reached and logged this window
+
 	// Metric callbacks
 	onIngest  func() // TSDBIngestTotal.Inc()
 	onDropped func() // TSDBBatchesDropped.Inc()
@@ -46,15 +116,23 @@ type Aggregator struct {
 
 const persistenceWorkers = 3
 
+// DefaultMaxExemplars is the number of exemplars kept per bucket unless changed with
+// SetExemplarLimit.
+const DefaultMaxExemplars = 3
+
 // NewAggregator creates a new TSDB aggregator.
-func NewAggregator(repo *storage.Repository, windowSize time.Duration) *Aggregator {
+func NewAggregator(repo storage.MetricWriter, windowSize time.Duration) *Aggregator {
 	a := &Aggregator{
-		repo:        repo,
-		windowSize:  windowSize,
-		buckets:     make(map[string]*storage.MetricBucket),
-		stopChan:    make(chan struct{}),
-		flushChan:   make(chan []storage.MetricBucket, 500),
-		overflowKey: "__cardinality_overflow__",
+		repo:         repo,
+		windowSize:   windowSize,
+		buckets:      make(map[string]*storage.MetricBucket),
+		stopChan:     make(chan struct{}),
+		done:         make(chan struct{}),
+		flushChan:    make(chan []storage.MetricBucket, 500),
+		overflowKey:  "__cardinality_overflow__",
+		maxExemplars: DefaultMaxExemplars,
+		maxSeries:    DefaultMaxSeriesPerMetric,
+		series:       make(map[string]*metricSeries),
 	}
 	a.pool.New = func() interface{} {
 		return make([]storage.MetricBucket, 0, 100)
@@ -71,6 +149,46 @@ func (a *Aggregator) SetCardinalityLimit(max int, onOverflow func()) {
 	a.cardinalityOverflow = onOverflow
 }
 
+// SetSeriesLimit caps the distinct attribute sets each metric may open per window at
+// limit, or at its entry in overrides; 0 means unlimited. Points of further series are
+// aggregated into the metric's overflow series, attributed {"argus.overflow":"true"},
+// and onOverflow is called for each.
+func (a *Aggregator) SetSeriesLimit(limit int, overrides map[string]int, onOverflow func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.maxSeries = limit
+	a.seriesLimits = overrides
+	a.seriesOverflow = onOverflow
+}
+
+// ParseSeriesLimits parses per-metric series limits written as "name=limit,name2=limit".
+func ParseSeriesLimits(spec string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("entry %q: want name=limit", strings.TrimSpace(pair))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("entry %q: limit must be an integer >= 0", strings.TrimSpace(pair))
+		}
+		limits[name] = n
+	}
+	return limits, nil
+}
+
+// SetExemplarLimit sets how many exemplars each bucket keeps; 0 drops them all.
+func (a *Aggregator) SetExemplarLimit(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.maxExemplars = max(n, 0)
+}
+
 // SetRingBuffer attaches a RingBuffer that receives every ingested data point.
 func (a *Aggregator) SetRingBuffer(rb *RingBuffer) {
 	a.mu.Lock()
@@ -78,6 +196,15 @@ func (a *Aggregator) SetRingBuffer(rb *RingBuffer) {
 	a.ring = rb
 }
 
+// SetCatalog records the type, unit, description, services and cardinality of every
+// metric name, and saves them to w on each flush.
+func (a *Aggregator) SetCatalog(w storage.MetricCatalogWriter) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.catalogWriter = w
+	a.catalog = make(map[string]*catalogEntry)
+}
+
 // SetMetrics wires Prometheus metric callbacks.
 func (a *Aggregator) SetMetrics(onIngest, onDropped func()) {
 	a.mu.Lock()
@@ -86,16 +213,41 @@ func (a *Aggregator) SetMetrics(onIngest, onDropped func()) {
 	a.onDropped = onDropped
 }
 
+// SetSpill sets where batches go when the flush channel is full or a write fails,
+// instead of being dropped. The function must be done with the batch when it returns.
+func (a *Aggregator) SetSpill(fn func([]storage.MetricBucket) error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.spill = fn
+}
+
 // Start begins the aggregation background processes.
 func (a *Aggregator) Start(ctx context.Context) {
+	a.mu.Lock()
+	if a.stopped {
+		a.mu.Unlock()
+		return
+	}
+	a.running = true
+	a.mu.Unlock()
+
 	ticker := time.NewTicker(a.windowSize)
 	defer ticker.Stop()
 
-	slog.Info("📈 TSDB Aggregator started", "window_size", a.windowSize, "workers", persistenceWorkers)
+	logger.Info("📈 TSDB Aggregator started", "window_size", a.windowSize, "workers", persistenceWorkers)
 
+	var workers sync.WaitGroup
 	for i := 0; i < persistenceWorkers; i++ {
-		go a.persistenceWorker(ctx)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			a.persistenceWorker(ctx)
+		}()
 	}
+	defer func() {
+		workers.Wait()
+		close(a.done)
+	}()
 
 	for {
 		select {
@@ -103,6 +255,8 @@ func (a *Aggregator) Start(ctx context.Context) {
 			a.flush()
 		case <-a.stopChan:
 			a.flush() // Final flush
+			// Nothing sends after the final flush; the workers drain what is queued and exit.
+			close(a.flushChan)
 			return
 		case <-ctx.Done():
 			return
@@ -110,16 +264,31 @@ func (a *Aggregator) Start(ctx context.Context) {
 	}
 }
 
-// Stop stops the aggregator.
+// Stop flushes the open window and blocks until every queued batch has been written
+// (or spilled). Cancel Start's context only after Stop returns.
 func (a *Aggregator) Stop() {
-	close(a.stopChan)
+	a.stopOnce.Do(func() {
+		a.mu.Lock()
+		a.stopped = true
+		running := a.running
+		a.mu.Unlock()
+		close(a.stopChan)
+		if !running {
+			// Start never ran, so flush and persist here.
+			a.flush()
+			close(a.flushChan)
+			a.persistenceWorker(context.Background())
+			close(a.done)
+		}
+	})
+	<-a.done
 }
 
 // Ingest adds a raw metric point to the current aggregator window.
 func (a *Aggregator) Ingest(m RawMetric) {
 	// Pre-compute key outside the lock — json.Marshal is CPU-bound and must not hold mu.
 	attrJSON, _ := json.Marshal(m.Attributes)
-	key := fmt.Sprintf("%s|%s|%s", m.ServiceName, m.Name, string(attrJSON))
+	key := fmt.Sprintf("%s|%s|%s|%s", m.TenantID, m.ServiceName, m.Name, string(attrJSON))
 
 	// Feed ring buffer and metric counter outside the lock (both are thread-safe).
 	if a.ring != nil {
@@ -132,20 +301,28 @@ func (a *Aggregator) Ingest(m RawMetric) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	a.describe(m, seriesHash(m.ServiceName, attrJSON))
+
 	bucket, exists := a.buckets[key]
+	if !exists && a.overSeriesLimit(m) {
+		attrJSON = []byte(overflowAttributes)
+		key = fmt.Sprintf("%s|%s|%s|%s", m.TenantID, m.ServiceName, m.Name, overflowAttributes)
+		bucket, exists = a.buckets[key]
+	}
 	if !exists {
 		// Cardinality guard: if limit exceeded, route to overflow bucket.
 		if a.maxCardinality > 0 && len(a.buckets) >= a.maxCardinality {
 			if a.cardinalityOverflow != nil {
 				a.cardinalityOverflow()
 			}
-			key = a.overflowKey
+			key = a.overflowKey + m.TenantID // tenants never share a bucket
 			bucket = a.buckets[key]
 			if bucket == nil {
 				windowStart := m.Timestamp.Truncate(a.windowSize)
 				bucket = &storage.MetricBucket{
 					Name:        "__overflow__",
 					ServiceName: m.ServiceName,
+					TenantID:    m.TenantID,
 					TimeBucket:  windowStart,
 					Min:         m.Value,
 					Max:         m.Value,
@@ -160,6 +337,7 @@ func (a *Aggregator) Ingest(m RawMetric) {
 			bucket = &storage.MetricBucket{
 				Name:           m.Name,
 				ServiceName:    m.ServiceName,
+				TenantID:       m.TenantID,
 				TimeBucket:     windowStart,
 				Min:            m.Value,
 				Max:            m.Value,
@@ -167,11 +345,14 @@ func (a *Aggregator) Ingest(m RawMetric) {
 				Count:          1,
 				AttributesJSON: storage.CompressedText(attrJSON),
 			}
+			bucket.Exemplars = mergeExemplars(nil, m.Exemplars, a.maxExemplars)
 			a.buckets[key] = bucket
 			return
 		}
 	}
 
+	bucket.Exemplars = mergeExemplars(bucket.Exemplars, m.Exemplars, a.maxExemplars)
+
 	if m.Value < bucket.Min {
 		bucket.Min = m.Value
 	}
@@ -182,6 +363,117 @@ func (a *Aggregator) Ingest(m RawMetric) {
 	bucket.Count++
 }
 
+// overSeriesLimit reports whether a new series of m would take its metric past its
+// series limit, and counts the series otherwise. Callers hold mu.
+func (a *Aggregator) overSeriesLimit(m RawMetric) bool {
+	limit, ok := a.seriesLimits[m.Name]
+	if !ok {
+		limit = a.maxSeries
+	}
+	if limit <= 0 {
+		return false
+	}
+	key := m.TenantID + "|" + m.Name
+	s := a.series[key]
+	if s == nil {
+		s = &metricSeries{}
+		a.series[key] = s
+	}
+	if s.count < limit {
+		s.count++
+		return false
+	}
+	if a.seriesOverflow != nil {
+		a.seriesOverflow()
+	}
+	if !s.warned {
+		s.warned = true
+		logger.Warn("⚠️ Metric series limit reached; further series go to its overflow series",
+			"metric", m.Name, "tenant", m.TenantID, "limit", limit)
+	}
+	return true
+}
+
+// Describe records m in the metric catalog without aggregating its value, for points
+// the aggregator does not store, such as histogram data points.
+func (a *Aggregator) Describe(m RawMetric) {
+	attrJSON, _ := json.Marshal(m.Attributes)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.describe(m, seriesHash(m.ServiceName, attrJSON))
+}
+
+// describe adds m to the catalog entry of its metric. Callers hold mu.
+func (a *Aggregator) describe(m RawMetric, series uint64) {
+	if a.catalog == nil {
+		return
+	}
+	key := m.TenantID + "|" + m.Name
+	e := a.catalog[key]
+	if e == nil {
+		if len(a.catalog) >= MaxCatalogMetrics {
+			if !a.catalogFull {
+				a.catalogFull = true
+				logger.Warn("⚠️ Metric catalog limit reached; further metrics are described in a later window",
+					"limit", MaxCatalogMetrics)
+			}
+			return
+		}
+		e = &catalogEntry{
+			meta:     storage.MetricCatalog{TenantID: m.TenantID, Name: m.Name},
+			services: make(map[string]struct{}),
+			series:   make(map[uint64]struct{}),
+		}
+		a.catalog[key] = e
+	}
+	if m.Type != "" {
+		e.meta.Type = m.Type
+	}
+	if m.Unit != "" {
+		e.meta.Unit = m.Unit
+	}
+	if m.Description != "" {
+		e.meta.Description = m.Description
+	}
+	if m.Timestamp.After(e.meta.LastSeen) {
+		e.meta.LastSeen = m.Timestamp
+	}
+	if len(e.series) < MaxCatalogSeries {
+		e.services[m.ServiceName] = struct{}{}
+		e.series[series] = struct{}{}
+	}
+}
+
+// seriesHash identifies a series of a metric: its service and attribute set.
+func seriesHash(service string, attrJSON []byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(service))
+	h.Write([]byte{0})
+	h.Write(attrJSON)
+	return h.Sum64()
+}
+
+// mergeExemplars adds incoming to kept and returns the limit highest-value exemplars,
+// highest first. kept is modified in place.
+func mergeExemplars(kept, incoming []storage.Exemplar, limit int) []storage.Exemplar {
+	for _, ex := range incoming {
+		if limit <= 0 {
+			return nil
+		}
+		if len(kept) == limit {
+			if ex.Value <= kept[len(kept)-1].Value {
+				continue
+			}
+			kept = kept[:len(kept)-1]
+		}
+		i := sort.Search(len(kept), func(i int) bool { return kept[i].Value < ex.Value })
+		kept = append(kept, storage.Exemplar{})
+		copy(kept[i+1:], kept[i:])
+		kept[i] = ex
+	}
+	return kept
+}
+
 // BucketCount returns the current number of in-memory buckets (for metrics/health).
 func (a *Aggregator) BucketCount() int {
 	a.mu.Lock()
@@ -190,53 +482,114 @@ func (a *Aggregator) BucketCount() int {
 	return n
 }
 
-// DroppedBatches returns the total number of batches dropped due to a full flush channel.
+// DroppedBatches returns the total number of batches lost because they could neither
+// be queued nor spilled.
 func (a *Aggregator) DroppedBatches() int64 {
-	return a.droppedBatches
+	return atomic.LoadInt64(&a.droppedBatches)
 }
 
 // flush moves the current buckets to the flush channel and resets the in-memory map.
 func (a *Aggregator) flush() {
 	a.mu.Lock()
+	entries := a.takeCatalog()
+	writer := a.catalogWriter
 	if len(a.buckets) == 0 {
 		a.mu.Unlock()
+		a.saveCatalog(writer, entries)
 		return
 	}
 
 	batch := a.pool.Get().([]storage.MetricBucket)
 	for _, b := range a.buckets {
+		if len(b.Exemplars) > 0 {
+			if data, err := json.Marshal(b.Exemplars); err == nil {
+				b.ExemplarsJSON = storage.CompressedText(data)
+			}
+		}
 		batch = append(batch, *b)
 	}
 	a.buckets = make(map[string]*storage.MetricBucket)
+	a.series = make(map[string]*metricSeries)
 	a.mu.Unlock()
 
 	select {
 	case a.flushChan <- batch:
 	default:
-		a.droppedBatches++
-		if a.onDropped != nil {
-			a.onDropped()
+		a.spillBatch(batch, "flush channel full")
+		a.pool.Put(batch[:0])
+	}
+	a.saveCatalog(writer, entries)
+}
+
+// takeCatalog returns the catalog entries of the window and starts a new one. Callers
+// hold mu.
+func (a *Aggregator) takeCatalog() []storage.MetricCatalog {
+	if len(a.catalog) == 0 {
+		return nil
+	}
+	entries := make([]storage.MetricCatalog, 0, len(a.catalog))
+	for _, e := range a.catalog {
+		meta := e.meta
+		meta.Cardinality = int64(len(e.series))
+		for svc := range e.services {
+			meta.Services = append(meta.Services, svc)
+		}
+		entries = append(entries, meta)
+	}
+	a.catalog = make(map[string]*catalogEntry)
+	a.catalogFull = false
+	return entries
+}
+
+func (a *Aggregator) saveCatalog(w storage.MetricCatalogWriter, entries []storage.MetricCatalog) {
+	if w == nil || len(entries) == 0 {
+		return
+	}
+	if err := w.SaveMetricCatalog(entries); err != nil {
+		logger.Error("❌ Failed to save metric catalog", "error", err, "count", len(entries))
+	}
+}
+
+// spillBatch hands a batch that cannot be persisted now to the spill function, and
+// counts it as dropped when there is none or it fails.
+func (a *Aggregator) spillBatch(batch []storage.MetricBucket, reason string) {
+	a.mu.Lock()
+	spill := a.spill
+	a.mu.Unlock()
+	if spill != nil {
+		err := spill(batch)
+		if err == nil {
+			logger.Warn("⚠️ TSDB metric batch spilled", "reason", reason, "count", len(batch))
+			return
 		}
-		slog.Warn("⚠️ TSDB flush channel full, dropping metric batch", "count", len(batch), "total_dropped", a.droppedBatches)
-		batch = batch[:0]
-		a.pool.Put(batch)
+		logger.Error("❌ Failed to spill metric batch", "reason", reason, "error", err, "count", len(batch))
 	}
+	atomic.AddInt64(&a.droppedBatches, 1)
+	if a.onDropped != nil {
+		a.onDropped()
+	}
+	logger.Warn("⚠️ TSDB dropping metric batch", "reason", reason, "count", len(batch), "total_dropped", atomic.LoadInt64(&a.droppedBatches))
 }
 
-// persistenceWorker drains the flush channel and writes batches to the database.
+// persistenceWorker drains the flush channel and writes batches to the database. It
+// returns when the channel is closed and empty, or when ctx is cancelled.
 func (a *Aggregator) persistenceWorker(ctx context.Context) {
 	for {
 		select {
-		case batch := <-a.flushChan:
+		case batch, ok := <-a.flushChan:
+			if !ok {
+				return
+			}
 			if len(batch) == 0 {
 				a.pool.Put(batch[:0])
 				continue
 			}
 			err := a.repo.BatchCreateMetrics(batch)
 			if err != nil {
-				slog.Error("❌ Failed to persist metric batch", "error", err, "count", len(batch))
+				logger.Error("❌ Failed to persist metric batch", "error", err, "count", len(batch))
+				a.spillBatch(batch, "write failed")
 			} else {
-				slog.Debug("💾 TSDB persisted metric batch", "count", len(batch))
+				logger.Debug("💾 TSDB persisted metric batch", "count", len(batch))
 			}
 			batch = batch[:0]
 			a.pool.Put(batch)
@@ -245,4 +598,3 @@ func (a *Aggregator) persistenceWorker(ctx context.Context) {
 		}
 	}
 }
-
@@ -0,0 +1,343 @@
+package tsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// chanWriter is a MetricWriter that hands every persisted batch to the test.
+type chanWriter chan []storage.MetricBucket
+
+func (c chanWriter) BatchCreateMetrics(buckets []storage.MetricBucket) error {
+	c <- append([]storage.MetricBucket(nil), buckets...)
+	return nil
+}
+
+func TestAggregatorFlushesToMetricWriter(t *testing.T) {
+	writer := make(chanWriter, 1)
+	agg := NewAggregator(writer, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go agg.persistenceWorker(ctx)
+
+	now := time.Now()
+	for _, v := range []float64{4, 1, 7} {
+		agg.Ingest(RawMetric{Name: "queue_depth", ServiceName: "checkout", Value: v, Timestamp: now})
+	}
+	agg.Ingest(RawMetric{Name: "queue_depth", ServiceName: "checkout", Value: 2, Timestamp: now, Attributes: map[string]interface{}{"queue": "orders"}})
+	agg.flush()
+
+	select {
+	case batch := <-writer:
+		if len(batch) != 2 {
+			t.Fatalf("batch has %d buckets, want 2 (one per attribute set)", len(batch))
+		}
+		b := batch[0]
+		if b.Count == 1 {
+			b = batch[1]
+		}
+		if b.Count != 3 || b.Sum != 12 || b.Min != 1 || b.Max != 7 {
+			t.Errorf("bucket = %+v, want count=3 sum=12 min=1 max=7", b)
+		}
+		if !b.TimeBucket.Equal(now.Truncate(time.Minute)) {
+			t.Errorf("time bucket = %v, want %v", b.TimeBucket, now.Truncate(time.Minute))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("aggregator did not write a batch")
+	}
+}
+
+func exemplar(traceID string, v float64) storage.Exemplar {
+	return storage.Exemplar{TraceID: traceID, SpanID: "s-" + traceID, Value: v, Timestamp: time.Unix(0, 0)}
+}
+
+func TestAggregatorKeepsHighestExemplarsAcrossWindow(t *testing.T) {
+	writer := make(chanWriter, 1)
+	agg := NewAggregator(writer, time.Minute)
+	agg.SetExemplarLimit(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go agg.persistenceWorker(ctx)
+
+	now := time.Now()
+	points := []RawMetric{
+		{Value: 120, Exemplars: []storage.Exemplar{exemplar("a", 120)}},
+		{Value: 80}, // no exemplar: counted, but nothing to keep
+		{Value: 900, Exemplars: []storage.Exemplar{exemplar("spike", 900)}},
+		{Value: 50, Exemplars: []storage.Exemplar{exemplar("low", 50)}}, // below both kept values
+		{Value: 300, Exemplars: []storage.Exemplar{exemplar("b", 300), exemplar("c", 10)}},
+	}
+	for _, p := range points {
+		p.Name, p.ServiceName, p.Timestamp = "http.server.duration", "checkout", now
+		agg.Ingest(p)
+	}
+	agg.flush()
+
+	select {
+	case batch := <-writer:
+		if len(batch) != 1 {
+			t.Fatalf("batch has %d buckets, want 1", len(batch))
+		}
+		b := batch[0]
+		if b.Count != 5 || b.Max != 900 {
+			t.Errorf("bucket = count %d max %v, want 5 and 900", b.Count, b.Max)
+		}
+		if len(b.Exemplars) != 2 || b.Exemplars[0].TraceID != "spike" || b.Exemplars[1].TraceID != "b" {
+			t.Fatalf("exemplars = %+v, want spike then b", b.Exemplars)
+		}
+		var persisted []storage.Exemplar
+		if err := json.Unmarshal([]byte(b.ExemplarsJSON), &persisted); err != nil || len(persisted) != 2 || persisted[0].Value != 900 {
+			t.Errorf("ExemplarsJSON = %q (%v), want the two kept exemplars", b.ExemplarsJSON, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("aggregator did not write a batch")
+	}
+}
+
+func TestMergeExemplars(t *testing.T) {
+	kept := mergeExemplars(nil, []storage.Exemplar{exemplar("a", 1), exemplar("b", 3), exemplar("c", 2)}, 3)
+	if len(kept) != 3 || kept[0].Value != 3 || kept[1].Value != 2 || kept[2].Value != 1 {
+		t.Fatalf("kept = %+v, want descending 3,2,1", kept)
+	}
+	kept = mergeExemplars(kept, []storage.Exemplar{exemplar("d", 2.5)}, 3)
+	if len(kept) != 3 || kept[1].TraceID != "d" || kept[2].Value != 2 {
+		t.Errorf("after insert = %+v, want 3,2.5,2", kept)
+	}
+	if got := mergeExemplars(nil, []storage.Exemplar{exemplar("a", 1)}, 0); got != nil {
+		t.Errorf("limit 0 kept %+v", got)
+	}
+}
+
+func TestAggregatorStopPersistsEveryBucket(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "tsdb.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	defer repo.Close()
+
+	// A window far longer than the test: only Stop's final flush can persist anything.
+	agg := NewAggregator(repo, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go agg.Start(ctx)
+
+	now := time.Now()
+	const series = 40
+	for i := 0; i < series; i++ {
+		for v := 0; v < 5; v++ {
+			agg.Ingest(RawMetric{Name: fmt.Sprintf("m%d", i), ServiceName: "checkout", Value: float64(v), Timestamp: now})
+		}
+	}
+	agg.Stop()
+	agg.Stop() // idempotent
+
+	var buckets []storage.MetricBucket
+	if err := repo.DB().Find(&buckets).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != series {
+		t.Fatalf("persisted %d buckets after Stop, want %d", len(buckets), series)
+	}
+	for _, b := range buckets {
+		if b.Count != 5 || b.Sum != 10 {
+			t.Errorf("bucket %s = count %d sum %v, want 5 and 10", b.Name, b.Count, b.Sum)
+		}
+	}
+}
+
+func TestAggregatorSpillsInsteadOfDropping(t *testing.T) {
+	agg := NewAggregator(make(chanWriter, 1), time.Minute)
+	var spilled [][]storage.MetricBucket
+	agg.SetSpill(func(batch []storage.MetricBucket) error {
+		spilled = append(spilled, append([]storage.MetricBucket(nil), batch...))
+		return nil
+	})
+	// No workers are running, so the queue stays full.
+	for i := 0; i < cap(agg.flushChan); i++ {
+		agg.flushChan <- nil
+	}
+
+	agg.Ingest(RawMetric{Name: "queue_depth", ServiceName: "checkout", Value: 3, Timestamp: time.Now()})
+	agg.flush()
+	if len(spilled) != 1 || len(spilled[0]) != 1 || spilled[0][0].Sum != 3 {
+		t.Fatalf("spilled = %+v, want the one-bucket batch", spilled)
+	}
+	if n := agg.DroppedBatches(); n != 0 {
+		t.Errorf("DroppedBatches() = %d, want 0 when spilled", n)
+	}
+
+	agg.SetSpill(func([]storage.MetricBucket) error { return errors.New("disk full") })
+	agg.Ingest(RawMetric{Name: "queue_depth", ServiceName: "checkout", Value: 4, Timestamp: time.Now()})
+	agg.flush()
+	if n := agg.DroppedBatches(); n != 1 {
+		t.Errorf("DroppedBatches() = %d, want 1 when the spill fails", n)
+	}
+}
+
+func TestAggregatorUpdatesMetricCatalog(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", filepath.Join(t.TempDir(), "tsdb.db"))
+	repo, err := storage.NewRepository(nil)
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	defer repo.Close()
+
+	agg := NewAggregator(make(chanWriter, 10), time.Minute)
+	agg.SetCatalog(repo)
+	catalog := func() storage.MetricCatalog {
+		t.Helper()
+		entries, err := repo.GetMetricCatalog("")
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("catalog = %+v, %v; want one entry", entries, err)
+		}
+		return entries[0]
+	}
+	point := func(service, route string, ts time.Time) RawMetric {
+		return RawMetric{Name: "http.server.duration", ServiceName: service, Value: 1, Timestamp: ts,
+			Attributes: map[string]interface{}{"route": route}, Type: "histogram", Unit: "ms"}
+	}
+
+	first := time.Now().UTC().Truncate(time.Second)
+	agg.Describe(point("checkout", "/cart", first))
+	agg.Describe(point("checkout", "/cart", first))
+	agg.Describe(point("checkout", "/pay", first))
+	agg.flush()
+	c := catalog()
+	if c.Type != "histogram" || c.Unit != "ms" || c.Cardinality != 2 || len(c.Services) != 1 || !c.LastSeen.Equal(first) {
+		t.Fatalf("first window: %+v, want a histogram in ms with 2 series from checkout", c)
+	}
+
+	// New attribute combinations and a new service: the next window counts them, and
+	// the services add up.
+	second := first.Add(time.Minute)
+	for _, route := range []string{"/cart", "/pay", "/refund"} {
+		agg.Ingest(point("billing", route, second))
+	}
+	agg.Ingest(point("checkout", "/cart", second))
+	agg.flush()
+	c = catalog()
+	if c.Cardinality != 4 || len(c.Services) != 2 || c.Services[0] != "billing" || !c.LastSeen.Equal(second) {
+		t.Fatalf("second window: %+v, want 4 series from billing and checkout", c)
+	}
+	if entries, _ := repo.GetMetricCatalog("billing"); len(entries) != 1 {
+		t.Errorf("catalog for billing = %+v, want the metric", entries)
+	}
+	if entries, _ := repo.GetMetricCatalog("cart"); len(entries) != 0 {
+		t.Errorf("catalog for an unknown service = %+v, want none", entries)
+	}
+}
+
+func TestAggregatorSeriesLimitBoundsHighCardinality(t *testing.T) {
+	writer := make(chanWriter, 1)
+	agg := NewAggregator(writer, time.Minute)
+	var overflowed int
+	agg.SetSeriesLimit(DefaultMaxSeriesPerMetric, map[string]int{"cache.hits": 2}, func() { overflowed++ })
+
+	// A request ID as an attribute: every point is a new series.
+	now := time.Now()
+	const points = 50000
+	for i := 0; i < points; i++ {
+		agg.Ingest(RawMetric{Name: "http.requests", ServiceName: "checkout", Value: 1, Timestamp: now,
+			Attributes: map[string]interface{}{"request.id": fmt.Sprintf("req-%d", i)}})
+	}
+	// Below their limits, other metrics keep every series.
+	for _, route := range []string{"/cart", "/pay", "/cart"} {
+		agg.Ingest(RawMetric{Name: "http.duration", ServiceName: "checkout", Value: 2, Timestamp: now,
+			Attributes: map[string]interface{}{"route": route}})
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		agg.Ingest(RawMetric{Name: "cache.hits", ServiceName: "checkout", Value: 1, Timestamp: now,
+			Attributes: map[string]interface{}{"key": key}})
+	}
+
+	// 1000 series, one overflow series and two route series for the rest, plus two
+	// cache.hits series and their overflow.
+	if n := agg.BucketCount(); n != DefaultMaxSeriesPerMetric+1+2+3 {
+		t.Fatalf("BucketCount() = %d after %d distinct series, want bounded at %d", n, points, DefaultMaxSeriesPerMetric+6)
+	}
+	if want := points - DefaultMaxSeriesPerMetric + 2; overflowed != want {
+		t.Errorf("overflow callback ran %d times, want %d", overflowed, want)
+	}
+
+	go agg.persistenceWorker(context.Background())
+	agg.flush()
+	batch := <-writer
+	byMetric := make(map[string][]storage.MetricBucket)
+	for _, b := range batch {
+		if string(b.AttributesJSON) == `{"argus.overflow":"true"}` {
+			byMetric[b.Name+" overflow"] = append(byMetric[b.Name+" overflow"], b)
+			continue
+		}
+		byMetric[b.Name] = append(byMetric[b.Name], b)
+	}
+	if o := byMetric["http.requests overflow"]; len(o) != 1 || o[0].Count != points-DefaultMaxSeriesPerMetric || o[0].ServiceName != "checkout" {
+		t.Errorf("http.requests overflow = %+v, want one bucket holding the %d extra points", o, points-DefaultMaxSeriesPerMetric)
+	}
+	if d := byMetric["http.duration"]; len(d) != 2 || len(byMetric["http.duration overflow"]) != 0 {
+		t.Errorf("http.duration buckets = %+v, want /cart and /pay untouched", d)
+	}
+	if c, o := byMetric["cache.hits"], byMetric["cache.hits overflow"]; len(c) != 2 || len(o) != 1 || o[0].Count != 2 {
+		t.Errorf("cache.hits = %d series and overflow %+v, want the override of 2 applied", len(c), o)
+	}
+
+	// The next window starts counting afresh.
+	agg.Ingest(RawMetric{Name: "http.requests", ServiceName: "checkout", Value: 1, Timestamp: now.Add(time.Minute),
+		Attributes: map[string]interface{}{"request.id": "req-new"}})
+	agg.flush()
+	if batch := <-writer; len(batch) != 1 || string(batch[0].AttributesJSON) != `{"request.id":"req-new"}` {
+		t.Errorf("next window = %+v, want the new series kept", batch)
+	}
+}
+
+func TestParseSeriesLimits(t *testing.T) {
+	limits, err := ParseSeriesLimits(" http.requests=5000, cache.hits = 0 ,")
+	if err != nil || len(limits) != 2 || limits["http.requests"] != 5000 || limits["cache.hits"] != 0 {
+		t.Errorf("ParseSeriesLimits() = %v, %v", limits, err)
+	}
+	for _, spec := range []string{"http.requests", "=10", "a=-1", "a=lots"} {
+		if _, err := ParseSeriesLimits(spec); err == nil {
+			t.Errorf("ParseSeriesLimits(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestAggregatorBoundsMetricCatalog(t *testing.T) {
+	w := &catalogRecorder{}
+	agg := NewAggregator(make(chanWriter, 10), time.Minute)
+	agg.SetCatalog(w)
+	now := time.Now()
+	for i := range MaxCatalogMetrics + 5 {
+		agg.Describe(RawMetric{Name: fmt.Sprintf("m%d", i), ServiceName: "api", Timestamp: now})
+	}
+	agg.flush()
+	if len(w.entries) != MaxCatalogMetrics {
+		t.Fatalf("catalog described %d metrics, want %d", len(w.entries), MaxCatalogMetrics)
+	}
+
+	// The next window has room again
+	agg.Describe(RawMetric{Name: fmt.Sprintf("m%d", MaxCatalogMetrics), ServiceName: "api", Timestamp: now})
+	agg.flush()
+	if len(w.entries) != 1 {
+		t.Errorf("next window described %d metrics, want 1", len(w.entries))
+	}
+}
+
+// catalogRecorder keeps the catalog entries of the last save.
+type catalogRecorder struct{ entries []storage.MetricCatalog }
+
+func (c *catalogRecorder) SaveMetricCatalog(entries []storage.MetricCatalog) error {
+	c.entries = entries
+	return nil
+}
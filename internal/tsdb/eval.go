@@ -0,0 +1,397 @@
+package tsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// BucketSource reads stored metric buckets; storage.Backend is one.
+type BucketSource interface {
+	GetMetricBuckets(start, end time.Time, serviceName, metricName string) ([]storage.MetricBucket, error)
+}
+
+// QueryRange is the window a metric expression is evaluated over: steps of Step
+// starting at Start, the last one beginning before End.
+type QueryRange struct {
+	Start, End time.Time
+	Step       time.Duration
+}
+
+// Steps returns the number of steps in the range.
+func (qr QueryRange) Steps() int {
+	if qr.Step <= 0 || !qr.Start.Before(qr.End) {
+		return 0
+	}
+	return int((qr.End.Sub(qr.Start) + qr.Step - 1) / qr.Step)
+}
+
+// Values are the points of a series, one per step. A missing point is NaN and is
+// encoded as JSON null.
+type Values []float64
+
+func (v Values) MarshalJSON() ([]byte, error) {
+	b := []byte{'['}
+	for i, x := range v {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			b = append(b, "null"...)
+		} else {
+			b = strconv.AppendFloat(b, x, 'g', -1, 64)
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// ResultSeries is one series of an evaluated expression. Service and Attributes are
+// empty for series combined by avg, sum, min or max.
+type ResultSeries struct {
+	Service    string            `json:"service,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Values     Values            `json:"values"`
+
+	key string // identity for matching the series of two operands
+}
+
+// QueryResult is an evaluated metric expression.
+type QueryResult struct {
+	Timestamps []time.Time     `json:"timestamps"` // start of each step
+	Series     []*ResultSeries `json:"series"`
+}
+
+// FillMissing replaces missing points with v.
+func (r *QueryResult) FillMissing(v float64) {
+	for _, s := range r.Series {
+		for i, x := range s.Values {
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				s.Values[i] = v
+			}
+		}
+	}
+}
+
+// Evaluate computes expr over qr from the buckets in src. No selector may match more
+// than maxSeries series, nor may an operation produce more; 0 means no limit.
+//
+// A step without buckets is missing, and stays missing through the evaluation:
+//   - a selector's point is the mean of the values recorded in the step
+//   - rate is the per-second increase of a cumulative counter from the step before,
+//     using the largest value of each step; a decrease is a counter reset, counted as
+//     an increase from zero. It is missing unless both steps have points
+//   - avg, sum, min and max combine the points present at each step, and are missing
+//     where no series has one
+//   - arithmetic matches the series of both sides by service and attributes, or pairs
+//     a single series or number with every series of the other side; it is missing
+//     where either point is, and a division by zero is missing
+func Evaluate(src BucketSource, expr Expr, qr QueryRange, maxSeries int) (*QueryResult, error) {
+	steps := qr.Steps()
+	if steps == 0 {
+		return nil, fmt.Errorf("empty query range")
+	}
+	ev := &evaluator{src: src, qr: qr, steps: steps, maxSeries: maxSeries}
+	v, err := ev.eval(expr)
+	if err != nil {
+		return nil, err
+	}
+	res := &QueryResult{Timestamps: make([]time.Time, steps), Series: v.series}
+	for i := range res.Timestamps {
+		res.Timestamps[i] = qr.Start.Add(time.Duration(i) * qr.Step)
+	}
+	if v.scalar {
+		res.Series = []*ResultSeries{{Values: ev.constant(v.num)}}
+	}
+	if res.Series == nil {
+		res.Series = []*ResultSeries{}
+	}
+	return res, nil
+}
+
+// exprValue is a number or a set of series.
+type exprValue struct {
+	scalar bool
+	num    float64
+	series []*ResultSeries
+}
+
+type evaluator struct {
+	src       BucketSource
+	qr        QueryRange
+	steps     int
+	maxSeries int
+}
+
+func (ev *evaluator) eval(e Expr) (exprValue, error) {
+	switch e := e.(type) {
+	case *NumberLit:
+		return exprValue{scalar: true, num: e.Val}, nil
+	case *Selector:
+		series, err := ev.selectSeries(e, false)
+		return exprValue{series: series}, err
+	case *Call:
+		if e.Func == FuncRate {
+			series, err := ev.selectSeries(e.Arg.(*Selector), true)
+			return exprValue{series: series}, err
+		}
+		arg, err := ev.eval(e.Arg)
+		if err != nil || arg.scalar {
+			return arg, err
+		}
+		return exprValue{series: ev.combine(e.Func, arg.series)}, nil
+	case *BinaryExpr:
+		left, err := ev.eval(e.Left)
+		if err != nil {
+			return exprValue{}, err
+		}
+		right, err := ev.eval(e.Right)
+		if err != nil {
+			return exprValue{}, err
+		}
+		return ev.binary(e, left, right)
+	}
+	return exprValue{}, &ExprError{Pos: e.Pos(), Msg: "unsupported expression"}
+}
+
+func (ev *evaluator) constant(v float64) Values {
+	vals := make(Values, ev.steps)
+	for i := range vals {
+		vals[i] = v
+	}
+	return vals
+}
+
+func missing(n int) Values {
+	vals := make(Values, n)
+	for i := range vals {
+		vals[i] = math.NaN()
+	}
+	return vals
+}
+
+// stepStats accumulates the buckets of one series in one step.
+type stepStats struct {
+	sum   float64
+	count int64
+	max   float64
+}
+
+// selectSeries reads the series of a selector: the mean per step, or with rate the
+// per-second increase.
+func (ev *evaluator) selectSeries(sel *Selector, rate bool) ([]*ResultSeries, error) {
+	service := ""
+	for _, m := range sel.Matchers {
+		if m.Label == ServiceLabel && m.Op == "=" {
+			service = m.Value
+		}
+	}
+	// One step more for rate, to have the increase into the first one
+	from := ev.qr.Start.Add(-ev.qr.Step)
+	buckets, err := ev.src.GetMetricBuckets(from, ev.qr.End, service, sel.Metric)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*ResultSeries)
+	stats := make(map[string][]stepStats)
+	var order []*ResultSeries
+	for i := range buckets {
+		b := &buckets[i]
+		if !b.TimeBucket.Before(ev.qr.End) || b.TimeBucket.Before(from) {
+			continue
+		}
+		attrs := bucketAttributes(b)
+		if !matches(sel.Matchers, b.ServiceName, attrs) {
+			continue
+		}
+		key := seriesKey(b.ServiceName, attrs)
+		s := byKey[key]
+		if s == nil {
+			if ev.maxSeries > 0 && len(order) == ev.maxSeries {
+				return nil, &ExprError{Pos: sel.At, Msg: fmt.Sprintf("%s matches more than %d series; narrow it with matchers", sel.Metric, ev.maxSeries)}
+			}
+			s = &ResultSeries{Service: b.ServiceName, Attributes: attrs, key: key}
+			byKey[key] = s
+			order = append(order, s)
+			stats[key] = make([]stepStats, ev.steps+1)
+		}
+		step := int(b.TimeBucket.Sub(from) / ev.qr.Step)
+		if step > ev.steps {
+			continue
+		}
+		st := &stats[key][step]
+		if st.count == 0 || b.Max > st.max {
+			st.max = b.Max
+		}
+		st.sum += b.Sum
+		st.count += b.Count
+	}
+
+	seconds := ev.qr.Step.Seconds()
+	for _, s := range order {
+		st := stats[s.key]
+		s.Values = missing(ev.steps)
+		for i := range s.Values {
+			cur, prev := st[i+1], st[i]
+			switch {
+			case cur.count == 0:
+			case !rate:
+				s.Values[i] = cur.sum / float64(cur.count)
+			case prev.count == 0:
+			case cur.max < prev.max:
+				s.Values[i] = cur.max / seconds
+			default:
+				s.Values[i] = (cur.max - prev.max) / seconds
+			}
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].key < order[j].key })
+	return order, nil
+}
+
+// bucketAttributes decodes a bucket's attributes, rendering values as label text.
+func bucketAttributes(b *storage.MetricBucket) map[string]string {
+	var raw map[string]any
+	if b.AttributesJSON == "" || json.Unmarshal([]byte(b.AttributesJSON), &raw) != nil || len(raw) == 0 {
+		return nil
+	}
+	attrs := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			attrs[k] = s
+		} else {
+			attrs[k] = fmt.Sprint(v)
+		}
+	}
+	return attrs
+}
+
+func matches(matchers []Matcher, service string, attrs map[string]string) bool {
+	for _, m := range matchers {
+		v := attrs[m.Label]
+		if m.Label == ServiceLabel {
+			v = service
+		}
+		if (v == m.Value) != (m.Op == "=") {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesKey identifies a series by its service and attributes.
+func seriesKey(service string, attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(service)
+	for _, k := range keys {
+		sb.WriteString("\x00" + k + "=" + attrs[k])
+	}
+	return sb.String()
+}
+
+// combine reduces series to one with avg, sum, min or max of the points present at
+// each step.
+func (ev *evaluator) combine(fn string, series []*ResultSeries) []*ResultSeries {
+	out := missing(ev.steps)
+	for i := range out {
+		n := 0
+		acc := 0.0
+		for _, s := range series {
+			x := s.Values[i]
+			if math.IsNaN(x) {
+				continue
+			}
+			switch {
+			case n == 0:
+				acc = x
+			case fn == FuncMin:
+				acc = math.Min(acc, x)
+			case fn == FuncMax:
+				acc = math.Max(acc, x)
+			default:
+				acc += x
+			}
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		if fn == FuncAvg {
+			acc /= float64(n)
+		}
+		out[i] = acc
+	}
+	return []*ResultSeries{{Values: out}}
+}
+
+func (ev *evaluator) binary(e *BinaryExpr, left, right exprValue) (exprValue, error) {
+	apply := func(a, b float64) float64 {
+		switch e.Op {
+		case '+':
+			return a + b
+		case '-':
+			return a - b
+		case '*':
+			return a * b
+		}
+		if b == 0 {
+			return math.NaN()
+		}
+		return a / b
+	}
+	if left.scalar && right.scalar {
+		return exprValue{scalar: true, num: apply(left.num, right.num)}, nil
+	}
+	pointwise := func(into *ResultSeries, a, b Values) *ResultSeries {
+		s := &ResultSeries{Service: into.Service, Attributes: into.Attributes, key: into.key, Values: make(Values, ev.steps)}
+		for i := range s.Values {
+			s.Values[i] = apply(a[i], b[i])
+		}
+		return s
+	}
+
+	var out []*ResultSeries
+	switch {
+	case left.scalar || !right.scalar && len(left.series) == 1 && len(right.series) != 1:
+		one := ev.constant(left.num)
+		if !left.scalar {
+			one = left.series[0].Values
+		}
+		for _, s := range right.series {
+			out = append(out, pointwise(s, one, s.Values))
+		}
+	case right.scalar || len(right.series) == 1:
+		one := ev.constant(right.num)
+		if !right.scalar {
+			one = right.series[0].Values
+		}
+		for _, s := range left.series {
+			out = append(out, pointwise(s, s.Values, one))
+		}
+	default:
+		byKey := make(map[string]*ResultSeries, len(right.series))
+		for _, s := range right.series {
+			byKey[s.key] = s
+		}
+		for _, s := range left.series {
+			if r, ok := byKey[s.key]; ok {
+				out = append(out, pointwise(s, s.Values, r.Values))
+			}
+		}
+	}
+	if ev.maxSeries > 0 && len(out) > ev.maxSeries {
+		return exprValue{}, &ExprError{Pos: e.At, Msg: fmt.Sprintf("result has more than %d series", ev.maxSeries)}
+	}
+	return exprValue{series: out}, nil
+}
@@ -0,0 +1,152 @@
+package tsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// bucketList serves buckets the way the repository does: by time, service and name.
+type bucketList []storage.MetricBucket
+
+func (l bucketList) GetMetricBuckets(start, end time.Time, serviceName, metricName string) ([]storage.MetricBucket, error) {
+	var out []storage.MetricBucket
+	for _, b := range l {
+		if !b.TimeBucket.Before(start) && !b.TimeBucket.After(end) && (serviceName == "" || b.ServiceName == serviceName) && b.Name == metricName {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+var evalStart = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+// point is one bucket of one value at minute m.
+func point(name, service, attrs string, m int, v float64) storage.MetricBucket {
+	return storage.MetricBucket{Name: name, ServiceName: service, AttributesJSON: storage.CompressedText(attrs),
+		TimeBucket: evalStart.Add(time.Duration(m) * time.Minute), Min: v, Max: v, Sum: v, Count: 1}
+}
+
+func evalExpr(t *testing.T, src BucketSource, expr string, maxSeries int) (*QueryResult, error) {
+	t.Helper()
+	e, err := ParseExpr(expr)
+	if err != nil {
+		t.Fatalf("ParseExpr(%q) error = %v", expr, err)
+	}
+	return Evaluate(src, e, QueryRange{Start: evalStart, End: evalStart.Add(4 * time.Minute), Step: time.Minute}, maxSeries)
+}
+
+// values renders a series as JSON, so missing points show as null.
+func values(s *ResultSeries) string {
+	b, _ := json.Marshal(s.Values)
+	return string(b)
+}
+
+func TestEvaluate(t *testing.T) {
+	src := bucketList{
+		// requests: a cumulative counter per service; orders resets after minute 1
+		point("requests", "orders", `{"route":"/cart"}`, -1, 60),
+		point("requests", "orders", `{"route":"/cart"}`, 0, 120),
+		point("requests", "orders", `{"route":"/cart"}`, 1, 240),
+		point("requests", "orders", `{"route":"/cart"}`, 2, 30),
+		point("requests", "orders", `{"route":"/cart"}`, 3, 90),
+		point("requests", "users", `{"route":"/me"}`, 0, 600),
+		point("requests", "users", `{"route":"/me"}`, 2, 720), // minute 1 missing
+		point("requests", "users", `{"route":"/me"}`, 3, 780),
+		// errors: orders and users per minute; users reports none at minute 3
+		point("errors", "orders", `{"route":"/cart"}`, 0, 1),
+		point("errors", "orders", `{"route":"/cart"}`, 1, 2),
+		point("errors", "orders", `{"route":"/cart"}`, 2, 0),
+		point("errors", "orders", `{"route":"/cart"}`, 3, 4),
+		point("errors", "users", `{"route":"/me"}`, 0, 10),
+		point("errors", "users", `{"route":"/me"}`, 1, 20),
+		point("errors", "users", `{"route":"/me"}`, 2, 30),
+		// latency: two buckets in one step average out
+		point("latency", "orders", `{"route":"/cart"}`, 0, 10),
+		point("latency", "orders", `{"route":"/cart"}`, 0, 30),
+		point("latency", "orders", `{"route":"/other"}`, 1, 5),
+		point("latency", "orders", ``, 2, 7),
+		point("latency", "orders", `{"route":"/cart"}`, 4, 99), // at End: outside the range
+	}
+
+	tests := []struct {
+		expr string
+		want []string // values of each series, in series order
+	}{
+		{`latency{route="/cart"}`, []string{`[20,null,null,null]`}},
+		{`latency{route!="/cart"}`, []string{`[null,null,7,null]`, `[null,5,null,null]`}},
+		{`latency{route=""}`, []string{`[null,null,7,null]`}},
+		{`rate(requests{service="orders"})`, []string{`[1,2,0.5,1]`}},
+		{`rate(requests{service="users"})`, []string{`[null,null,null,1]`}},
+		{`sum(rate(requests))`, []string{`[1,2,0.5,2]`}},
+		{`sum(errors)`, []string{`[11,22,30,4]`}},
+		{`avg(errors)`, []string{`[5.5,11,15,4]`}},
+		{`min(errors)`, []string{`[1,2,0,4]`}},
+		{`max(errors)`, []string{`[10,20,30,4]`}},
+		{`sum(nothing)`, []string{`[null,null,null,null]`}},
+		{`nothing`, nil},
+		// Series matched by service and attributes
+		{`errors / rate(requests)`, []string{`[1,1,0,4]`, `[null,null,null,null]`}},
+		{`errors{service="orders"} * 60`, []string{`[60,120,0,240]`}},
+		{`100 - errors{service="users"}`, []string{`[90,80,70,null]`}},
+		{`sum(errors) / sum(rate(requests) * 60)`, []string{`[0.18333333333333332,0.18333333333333332,1,0.03333333333333333]`}},
+		{`errors / 0`, []string{`[null,null,null,null]`, `[null,null,null,null]`}},
+		{`errors{service="orders"} / errors{service="orders"}`, []string{`[1,1,null,1]`}},
+		{`2 * (3 + 4)`, []string{`[14,14,14,14]`}},
+		{`-errors{service="orders"}`, []string{`[-1,-2,0,-4]`}},
+	}
+	for _, tt := range tests {
+		res, err := evalExpr(t, src, tt.expr, 0)
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.expr, err)
+			continue
+		}
+		var got []string
+		for _, s := range res.Series {
+			got = append(got, values(s))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	res, _ := evalExpr(t, src, `errors{service="orders"}`, 0)
+	if len(res.Timestamps) != 4 || !res.Timestamps[1].Equal(evalStart.Add(time.Minute)) {
+		t.Errorf("timestamps = %v, want the start of each minute", res.Timestamps)
+	}
+	if s := res.Series[0]; s.Service != "orders" || s.Attributes["route"] != "/cart" {
+		t.Errorf("series = %+v, want orders /cart", s)
+	}
+	res, _ = evalExpr(t, src, `sum(errors{service="users"})`, 0)
+	res.FillMissing(0)
+	if got := values(res.Series[0]); got != `[10,20,30,0]` {
+		t.Errorf("filled = %s, want the missing point as 0", got)
+	}
+}
+
+func TestEvaluateSeriesBudget(t *testing.T) {
+	var src bucketList
+	for i := range 5 {
+		src = append(src, point("requests", "svc", `{"pod":"`+string(rune('a'+i))+`"}`, 0, 1))
+	}
+	if _, err := evalExpr(t, src, `sum(requests)`, 5); err != nil {
+		t.Errorf("5 series with a budget of 5: %v", err)
+	}
+	_, err := evalExpr(t, src, `sum(requests{service="svc"})`, 4)
+	var ee *ExprError
+	if !errors.As(err, &ee) || ee.Pos != 4 || !strings.Contains(ee.Msg, "more than 4 series") {
+		t.Errorf("over budget error = %v, want one at the selector", err)
+	}
+}
+
+func TestValuesJSON(t *testing.T) {
+	b, err := json.Marshal(Values{1.5, math.NaN(), math.Inf(1), -2})
+	if err != nil || string(b) != `[1.5,null,null,-2]` {
+		t.Errorf("json = %s, %v", b, err)
+	}
+}
@@ -0,0 +1,414 @@
+package tsdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Metric expressions, as accepted by POST /api/metrics/query, e.g.
+//
+//	sum(rate(http_server_requests{service="order-service", http.route!="/health"}))
+//	sum(errors) / sum(requests)
+//
+// Grammar:
+//
+//	expr     = term { ("+" | "-") term }
+//	term     = unary { ("*" | "/") unary }
+//	unary    = [ "-" ] primary
+//	primary  = number | call | selector | "(" expr ")"
+//	call     = func "(" expr ")"
+//	func     = "rate" | "avg" | "sum" | "min" | "max"
+//	selector = metric [ "{" [ matcher { "," matcher } ] "}" ]
+//	matcher  = label ( "=" | "!=" ) string
+//
+// Metric and label names may contain letters, digits, "_", "." and ":". The label
+// service matches the service name; any other label a metric attribute. rate takes
+// a selector.
+
+// ExprError is an expression that does not parse or cannot be evaluated. Pos is the
+// byte offset of the offending token in the expression.
+type ExprError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("error at position %d: %s", e.Pos, e.Msg)
+}
+
+// Functions of metric expressions. rate is the per-second increase of a counter;
+// the others combine all series of their argument into one, step by step.
+const (
+	FuncRate = "rate"
+	FuncAvg  = "avg"
+	FuncSum  = "sum"
+	FuncMin  = "min"
+	FuncMax  = "max"
+)
+
+// ServiceLabel is the matcher label that selects by service name.
+const ServiceLabel = "service"
+
+// Expr is a parsed metric expression: a *NumberLit, *Selector, *Call or *BinaryExpr.
+type Expr interface {
+	Pos() int
+}
+
+// NumberLit is a constant.
+type NumberLit struct {
+	Val float64
+	At  int
+}
+
+func (n *NumberLit) Pos() int { return n.At }
+
+// Selector picks the series of one metric.
+type Selector struct {
+	Metric   string
+	Matchers []Matcher
+	At       int
+}
+
+func (s *Selector) Pos() int { return s.At }
+
+// Matcher keeps the series whose label equals (Op "=") or differs from (Op "!=")
+// Value. A missing attribute is "".
+type Matcher struct {
+	Label string
+	Op    string
+	Value string
+	At    int
+}
+
+// Call applies a function to its argument.
+type Call struct {
+	Func string
+	Arg  Expr
+	At   int
+}
+
+func (c *Call) Pos() int { return c.At }
+
+// BinaryExpr is arithmetic (+, -, * or /) between two expressions.
+type BinaryExpr struct {
+	Op          byte
+	Left, Right Expr
+	At          int
+}
+
+func (b *BinaryExpr) Pos() int { return b.At }
+
+// Limits of ParseExpr, which recurses once per parenthesis or call.
+const (
+	MaxExprLen   = 4096 // bytes
+	maxExprDepth = 64   // parentheses and calls nested in one another
+)
+
+// ParseExpr parses a metric expression. Errors are *ExprError.
+func ParseExpr(src string) (Expr, error) {
+	if len(src) > MaxExprLen {
+		return nil, &ExprError{Pos: MaxExprLen, Msg: fmt.Sprintf("expression longer than %d bytes", MaxExprLen)}
+	}
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	if p.peek().kind == etEOF {
+		return nil, &ExprError{Pos: 0, Msg: "empty expression"}
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != etEOF {
+		return nil, &ExprError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s, expected an operator", t)}
+	}
+	return e, nil
+}
+
+type exprTokenKind int
+
+const (
+	etEOF exprTokenKind = iota
+	etIdent
+	etString
+	etNumber
+	etOp     // + - * /
+	etMatch  // = !=
+	etLParen // (
+	etRParen // )
+	etLBrace // {
+	etRBrace // }
+	etComma  // ,
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string // unquoted for strings
+	pos  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case etEOF:
+		return "end of expression"
+	case etString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexExpr splits an expression into tokens, ending with etEOF. A minus is always an
+// operator; the parser makes it unary where needed.
+func lexExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			end, text, err := lexExprString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, exprToken{etString, text, i})
+			i = end
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				(src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E')) {
+				i++
+			}
+			toks = append(toks, exprToken{etNumber, src[start:i], start})
+		case c == '_' || isExprLetter(src[i:]):
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] == '.' || src[i] == ':' || src[i] >= '0' && src[i] <= '9' || isExprLetter(src[i:])) {
+				_, size := utf8.DecodeRuneInString(src[i:])
+				i += size
+			}
+			toks = append(toks, exprToken{etIdent, src[start:i], start})
+		case strings.HasPrefix(src[i:], "!="):
+			toks = append(toks, exprToken{etMatch, "!=", i})
+			i += 2
+		case c == '=':
+			toks = append(toks, exprToken{etMatch, "=", i})
+			i++
+		case c == '+' || c == '-' || c == '*' || c == '/':
+			toks = append(toks, exprToken{etOp, src[i : i+1], i})
+			i++
+		case c == '(':
+			toks = append(toks, exprToken{etLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, exprToken{etRParen, ")", i})
+			i++
+		case c == '{':
+			toks = append(toks, exprToken{etLBrace, "{", i})
+			i++
+		case c == '}':
+			toks = append(toks, exprToken{etRBrace, "}", i})
+			i++
+		case c == ',':
+			toks = append(toks, exprToken{etComma, ",", i})
+			i++
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, &ExprError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(toks, exprToken{etEOF, "", len(src)}), nil
+}
+
+// lexExprString reads the double-quoted string starting at src[start], with Go
+// escapes, and returns the offset just past it.
+func lexExprString(src string, start int) (int, string, error) {
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			text, err := strconv.Unquote(src[start : i+1])
+			if err != nil {
+				return 0, "", &ExprError{Pos: start, Msg: "invalid escape in string"}
+			}
+			return i + 1, text, nil
+		}
+	}
+	return 0, "", &ExprError{Pos: start, Msg: "unterminated string"}
+}
+
+func isExprLetter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r)
+}
+
+type exprParser struct {
+	toks  []exprToken
+	i     int
+	depth int // open parentheses and calls
+}
+
+func (p *exprParser) peek() exprToken { return p.toks[p.i] }
+
+func (p *exprParser) next() exprToken {
+	t := p.toks[p.i]
+	if t.kind != etEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *exprParser) expect(kind exprTokenKind, what string) (exprToken, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, &ExprError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s, expected %s", t, what)}
+	}
+	return t, nil
+}
+
+// nest enters the parenthesis or call opened by t; the caller must leave it with
+// p.depth-- once parsed.
+func (p *exprParser) nest(t exprToken) error {
+	if p.depth++; p.depth > maxExprDepth {
+		return &ExprError{Pos: t.pos, Msg: fmt.Sprintf("expression nested more than %d deep", maxExprDepth)}
+	}
+	return nil
+}
+
+func (p *exprParser) parseExpr() (Expr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == etOp && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: t.text[0], Left: left, Right: right, At: t.pos}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseTerm() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == etOp && (t.text == "*" || t.text == "/"); t = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: t.text[0], Left: left, Right: right, At: t.pos}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	if t := p.peek(); t.kind == etOp && t.text == "-" {
+		p.next()
+		operand, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := operand.(*NumberLit); ok {
+			return &NumberLit{Val: -n.Val, At: t.pos}, nil
+		}
+		return &BinaryExpr{Op: '-', Left: &NumberLit{At: t.pos}, Right: operand, At: t.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case etNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &ExprError{Pos: t.pos, Msg: fmt.Sprintf("invalid number %s", t)}
+		}
+		return &NumberLit{Val: n, At: t.pos}, nil
+	case etLParen:
+		if err := p.nest(t); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(etRParen, ")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case etIdent:
+		if p.peek().kind == etLParen {
+			return p.parseCall(t)
+		}
+		return p.parseSelector(t)
+	}
+	return nil, &ExprError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s, expected a metric, function or number", t)}
+}
+
+func (p *exprParser) parseCall(name exprToken) (Expr, error) {
+	switch name.text {
+	case FuncRate, FuncAvg, FuncSum, FuncMin, FuncMax:
+	default:
+		return nil, &ExprError{Pos: name.pos, Msg: fmt.Sprintf("unknown function %q, expected rate, avg, sum, min or max", name.text)}
+	}
+	if err := p.nest(p.next()); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(etRParen, ")"); err != nil {
+		return nil, err
+	}
+	if _, ok := arg.(*Selector); name.text == FuncRate && !ok {
+		return nil, &ExprError{Pos: arg.Pos(), Msg: "rate takes a metric selector"}
+	}
+	return &Call{Func: name.text, Arg: arg, At: name.pos}, nil
+}
+
+func (p *exprParser) parseSelector(name exprToken) (Expr, error) {
+	sel := &Selector{Metric: name.text, At: name.pos}
+	if p.peek().kind != etLBrace {
+		return sel, nil
+	}
+	p.next()
+	for p.peek().kind != etRBrace {
+		label, err := p.expect(etIdent, "a label")
+		if err != nil {
+			return nil, err
+		}
+		op, err := p.expect(etMatch, "= or !=")
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.expect(etString, "a quoted value")
+		if err != nil {
+			return nil, err
+		}
+		sel.Matchers = append(sel.Matchers, Matcher{Label: label.text, Op: op.text, Value: value.text, At: label.pos})
+		if p.peek().kind != etComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(etRBrace, ", or }"); err != nil {
+		return nil, err
+	}
+	return sel, nil
+}
@@ -0,0 +1,112 @@
+package tsdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// renderExpr prints an expression fully parenthesized, so tests can assert on shape.
+func renderExpr(e Expr) string {
+	switch e := e.(type) {
+	case *NumberLit:
+		return fmt.Sprint(e.Val)
+	case *Selector:
+		if len(e.Matchers) == 0 {
+			return e.Metric
+		}
+		var ms []string
+		for _, m := range e.Matchers {
+			ms = append(ms, fmt.Sprintf("%s%s%q", m.Label, m.Op, m.Value))
+		}
+		return e.Metric + "{" + strings.Join(ms, ",") + "}"
+	case *Call:
+		return e.Func + "(" + renderExpr(e.Arg) + ")"
+	case *BinaryExpr:
+		return fmt.Sprintf("(%s %c %s)", renderExpr(e.Left), e.Op, renderExpr(e.Right))
+	}
+	return "?"
+}
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`http_server_requests`, `http_server_requests`},
+		{`rate(http_server_requests{service="order-service"})`, `rate(http_server_requests{service="order-service"})`},
+		{`http.server.duration{ service = "a", http.route != "/health" , }`, `http.server.duration{service="a",http.route!="/health"}`},
+		{`m{}`, `m`},
+		{`errors / requests`, `(errors / requests)`},
+		{`a + b * c`, `(a + (b * c))`},
+		{`(a + b) * c`, `((a + b) * c)`},
+		{`a - b - c`, `((a - b) - c)`},
+		{`sum(errors) / sum(requests) * 100`, `((sum(errors) / sum(requests)) * 100)`},
+		{`-1.5e3`, `-1500`},
+		{`-rate(x)`, `(0 - rate(x))`},
+		{`a-1`, `(a - 1)`},
+		{`avg(min(a) + max(b))`, `avg((min(a) + max(b)))`},
+		{`sum`, `sum`}, // a metric, not a call
+		{`ns:metric_1{k="\"q\""}`, `ns:metric_1{k="\"q\""}`},
+	}
+	for _, tt := range tests {
+		got, err := ParseExpr(tt.in)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) error = %v", tt.in, err)
+			continue
+		}
+		if r := renderExpr(got); r != tt.want {
+			t.Errorf("ParseExpr(%q) = %s, want %s", tt.in, r, tt.want)
+		}
+	}
+}
+
+func TestParseExprNesting(t *testing.T) {
+	in := strings.Repeat("sum(", maxExprDepth/2) + strings.Repeat("(", maxExprDepth/2) + "a" + strings.Repeat(")", maxExprDepth)
+	if _, err := ParseExpr(in); err != nil {
+		t.Errorf("ParseExpr nested %d deep: %v", maxExprDepth, err)
+	}
+	// Four million parentheses used to overflow the stack.
+	if _, err := ParseExpr(strings.Repeat("(", 4<<20)); err == nil {
+		t.Error("ParseExpr of 4M parentheses succeeded, want an error")
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		in      string
+		pos     int
+		contain string
+	}{
+		{``, 0, "empty expression"},
+		{`   `, 0, "empty expression"},
+		{`a +`, 3, "expected a metric, function or number"},
+		{`a b`, 2, "expected an operator"},
+		{`rate(1)`, 5, "rate takes a metric selector"},
+		{`rate(a + b)`, 7, "rate takes a metric selector"},
+		{`p99(a)`, 0, `unknown function "p99"`},
+		{`sum(a`, 5, "expected )"},
+		{`m{service}`, 9, "expected = or !="},
+		{`m{service=order}`, 10, "expected a quoted value"},
+		{`m{service="a" k="b"}`, 14, "expected , or }"},
+		{`m{"k"="v"}`, 2, "expected a label"},
+		{`m{k="v}`, 4, "unterminated string"},
+		{`a % b`, 2, `unexpected character '%'`},
+		{`1.2.3`, 0, "invalid number"},
+		{`(a`, 2, "expected )"},
+		{strings.Repeat("(", maxExprDepth+1) + "a" + strings.Repeat(")", maxExprDepth+1), maxExprDepth, "nested more than 64 deep"},
+		{strings.Repeat("sum(", maxExprDepth) + "(a" + strings.Repeat(")", maxExprDepth+1), 4 * maxExprDepth, "nested more than 64 deep"},
+		{strings.Repeat("(", MaxExprLen+1), MaxExprLen, "longer than 4096 bytes"},
+	}
+	for _, tt := range tests {
+		_, err := ParseExpr(tt.in)
+		var ee *ExprError
+		if !errors.As(err, &ee) {
+			t.Errorf("ParseExpr(%q) error = %v, want an ExprError", tt.in, err)
+			continue
+		}
+		if ee.Pos != tt.pos || !strings.Contains(ee.Msg, tt.contain) {
+			t.Errorf("ParseExpr(%q) = %q at %d, want %q at %d", tt.in, ee.Msg, ee.Pos, tt.contain, tt.pos)
+		}
+	}
+}
@@ -196,6 +196,35 @@ func (rb *RingBuffer) QueryRecent(metricName, serviceName string, windowCount in
 	return ring.Windows(windowCount)
 }
 
+// WindowsBetween returns the non-empty windows of every tracked series whose start
+// lies in [start, end). Windows dated after now (left behind by points with a
+// future timestamp) are skipped.
+func (rb *RingBuffer) WindowsBetween(start, end time.Time) []WindowAgg {
+	rb.mu.RLock()
+	rings := make([]*MetricRing, 0, len(rb.rings))
+	for _, ring := range rb.rings {
+		rings = append(rings, ring)
+	}
+	rb.mu.RUnlock()
+
+	now := time.Now()
+	var out []WindowAgg
+	for _, ring := range rings {
+		for _, w := range ring.Windows(ring.size) {
+			if w.WindowStart.Before(start) || !w.WindowStart.Before(end) || w.WindowStart.After(now) {
+				continue
+			}
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// RetainedSince returns the oldest point in time the ring buffer can still hold.
+func (rb *RingBuffer) RetainedSince() time.Time {
+	return time.Now().Add(-time.Duration(rb.slots) * rb.windowDur).Truncate(rb.windowDur)
+}
+
 // AllKeys returns all registered metric+service keys.
 func (rb *RingBuffer) AllKeys() []string {
 	rb.mu.RLock()
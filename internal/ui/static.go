@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache policies. Vite writes content-hashed file names under assets/, so those can
+// be cached forever; everything else (index.html above all) must be revalidated so a
+// new build is picked up on the next load.
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+	hashedAssetsDir = "assets/"
+	spaIndexFile    = "index.html"
+)
+
+// encodings lists the pre-compressed variants in order of preference.
+var encodings = []struct {
+	name string // Content-Encoding token
+	ext  string // file suffix produced by ui/scripts/compress.mjs
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticVariant is one encoding of an embedded file.
+type staticVariant struct {
+	data []byte
+	etag string
+}
+
+// staticAsset is an embedded file with its identity encoding and any pre-compressed
+// variants, keyed by Content-Encoding token.
+type staticAsset struct {
+	name        string
+	contentType string
+	identity    staticVariant
+	compressed  map[string]staticVariant
+	immutable   bool
+}
+
+// spaHandler serves the embedded single-page app. Files are read and hashed once at
+// startup; unknown paths fall back to index.html so client-side routes work.
+type spaHandler struct {
+	assets  map[string]*staticAsset
+	modTime time.Time
+}
+
+// newSPAHandler indexes every file in fsys. .br and .gz files are attached to the file
+// they compress and are not served on their own.
+func newSPAHandler(fsys fs.FS) (*spaHandler, error) {
+	h := &spaHandler{assets: make(map[string]*staticAsset), modTime: time.Now()}
+	compressed := make(map[string][]byte)
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		for _, enc := range encodings {
+			if strings.HasSuffix(name, enc.ext) {
+				compressed[name] = data
+				return nil
+			}
+		}
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = http.DetectContentType(data)
+		}
+		h.assets[name] = &staticAsset{
+			name:        name,
+			contentType: ctype,
+			identity:    staticVariant{data: data, etag: contentETag(data, "")},
+			compressed:  make(map[string]staticVariant),
+			immutable:   strings.HasPrefix(name, hashedAssetsDir),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ui: failed to index static files: %w", err)
+	}
+
+	for name, data := range compressed {
+		for _, enc := range encodings {
+			base, ok := strings.CutSuffix(name, enc.ext)
+			if !ok {
+				continue
+			}
+			if a, found := h.assets[base]; found {
+				a.compressed[enc.name] = staticVariant{data: data, etag: contentETag(a.identity.data, enc.name)}
+			}
+		}
+	}
+	return h, nil
+}
+
+// BuildStamp identifies the embedded frontend build: a hash over the names and
+// contents of every file in dist/. It changes whenever the SPA is rebuilt, so the
+// UI can tell that it was loaded from a different build than the server is running.
+var BuildStamp = sync.OnceValue(func() string {
+	h := sha256.New()
+	fs.WalkDir(content, "dist", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(content, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(data))
+		h.Write(data)
+		return nil
+	})
+	return hex.EncodeToString(h.Sum(nil)[:8])
+})
+
+// contentETag derives a strong ETag from the uncompressed contents; each encoding
+// gets its own tag because the bytes on the wire differ.
+func contentETag(data []byte, encoding string) string {
+	sum := sha256.Sum256(data)
+	tag := hex.EncodeToString(sum[:8])
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return `"` + tag + `"`
+}
+
+func (h *spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	asset, ok := h.assets[name]
+	if !ok {
+		// SPA fallback — let the React router handle the path.
+		asset, ok = h.assets[spaIndexFile]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	variant, encoding := asset.identity, ""
+	if len(asset.compressed) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		accepted := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+		for _, enc := range encodings {
+			if v, found := asset.compressed[enc.name]; found && accepted[enc.name] {
+				variant, encoding = v, enc.name
+				break
+			}
+		}
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", asset.contentType)
+	hdr.Set("ETag", variant.etag)
+	if asset.immutable {
+		hdr.Set("Cache-Control", cacheImmutable)
+	} else {
+		hdr.Set("Cache-Control", cacheRevalidate)
+	}
+	if encoding != "" {
+		hdr.Set("Content-Encoding", encoding)
+	}
+
+	if etagMatches(r.Header.Get("If-None-Match"), variant.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if encoding != "" {
+		// Byte ranges over a compressed body would be ranges of the encoded stream;
+		// write it whole rather than going through http.ServeContent.
+		hdr.Set("Content-Length", strconv.Itoa(len(variant.data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(variant.data)
+		}
+		return
+	}
+	http.ServeContent(w, r, asset.name, h.modTime, bytes.NewReader(variant.data))
+}
+
+// acceptedEncodings parses an Accept-Encoding header into the set of codings the
+// client accepts (q > 0). "*" is not expanded; browsers always list br and gzip.
+func acceptedEncodings(header string) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[token] = q > 0
+	}
+	return accepted
+}
+
+// etagMatches reports whether an If-None-Match header lists etag (weak comparison).
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
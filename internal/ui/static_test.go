@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testBundle = "console.log('argus');"
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func newTestSPA(t *testing.T) *spaHandler {
+	t.Helper()
+	h, err := newSPAHandler(fstest.MapFS{
+		"index.html":                  {Data: []byte("<!doctype html><div id=root></div>")},
+		"favicon.svg":                 {Data: []byte("<svg/>")},
+		"assets/index-AbC12_xy.js":    {Data: []byte(testBundle)},
+		"assets/index-AbC12_xy.js.gz": {Data: gzipped(t, testBundle)},
+		"assets/index-AbC12_xy.js.br": {Data: []byte("brotli-bytes")},
+	})
+	if err != nil {
+		t.Fatalf("newSPAHandler() error = %v", err)
+	}
+	return h
+}
+
+func serve(h http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSPAAcceptEncodingNegotiation(t *testing.T) {
+	h := newTestSPA(t)
+	const asset = "/assets/index-AbC12_xy.js"
+
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0, gzip;q=0.8", "gzip"},
+		{"", ""},
+		{"identity", ""},
+	}
+	for _, tt := range tests {
+		rec := serve(h, asset, map[string]string{"Accept-Encoding": tt.acceptEncoding})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Accept-Encoding %q: status = %d", tt.acceptEncoding, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", tt.acceptEncoding, got, tt.wantEncoding)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: Vary = %q", tt.acceptEncoding, got)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+			t.Errorf("Accept-Encoding %q: Content-Type = %q", tt.acceptEncoding, ct)
+		}
+	}
+
+	rec := serve(h, asset, map[string]string{"Accept-Encoding": "gzip"})
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != testBundle {
+		t.Errorf("gzip body decodes to %q", body)
+	}
+	if rec := serve(h, asset, nil); rec.Body.String() != testBundle {
+		t.Errorf("identity body = %q", rec.Body.String())
+	}
+}
+
+func TestSPACacheHeaders(t *testing.T) {
+	h := newTestSPA(t)
+
+	if cc := serve(h, "/assets/index-AbC12_xy.js", nil).Header().Get("Cache-Control"); cc != cacheImmutable {
+		t.Errorf("hashed asset Cache-Control = %q, want %q", cc, cacheImmutable)
+	}
+	for _, path := range []string{"/", "/index.html", "/favicon.svg", "/traces/abc123"} {
+		if cc := serve(h, path, nil).Header().Get("Cache-Control"); cc != cacheRevalidate {
+			t.Errorf("%s Cache-Control = %q, want %q", path, cc, cacheRevalidate)
+		}
+	}
+
+	// Client-side routes fall back to index.html.
+	if rec := serve(h, "/traces/abc123", nil); !strings.Contains(rec.Body.String(), "id=root") {
+		t.Errorf("SPA fallback body = %q", rec.Body.String())
+	}
+}
+
+func TestSPAConditionalRequests(t *testing.T) {
+	h := newTestSPA(t)
+	const asset = "/assets/index-AbC12_xy.js"
+
+	plain := serve(h, asset, nil).Header().Get("ETag")
+	gz := serve(h, asset, map[string]string{"Accept-Encoding": "gzip"}).Header().Get("ETag")
+	if plain == "" || gz == "" || plain == gz {
+		t.Fatalf("ETags identity=%q gzip=%q, want distinct non-empty tags", plain, gz)
+	}
+
+	rec := serve(h, asset, map[string]string{"If-None-Match": plain})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match with current ETag: status = %d, body %d bytes; want 304 and no body", rec.Code, rec.Body.Len())
+	}
+	rec = serve(h, asset, map[string]string{"If-None-Match": `"stale", W/` + gz, "Accept-Encoding": "gzip"})
+	if rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != gz {
+		t.Errorf("If-None-Match list with weak gzip tag: status = %d", rec.Code)
+	}
+	if rec := serve(h, asset, map[string]string{"If-None-Match": `"stale"`}); rec.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: status = %d, want 200", rec.Code)
+	}
+	// The identity tag does not validate the gzip representation.
+	if rec := serve(h, asset, map[string]string{"If-None-Match": plain, "Accept-Encoding": "gzip"}); rec.Code != http.StatusOK {
+		t.Errorf("identity ETag against gzip variant: status = %d, want 200", rec.Code)
+	}
+
+	index := serve(h, "/", nil).Header().Get("ETag")
+	if rec := serve(h, "/settings", map[string]string{"If-None-Match": index}); rec.Code != http.StatusNotModified {
+		t.Errorf("SPA fallback revalidation: status = %d, want 304", rec.Code)
+	}
+}
+
+func TestEmbeddedDistIndexes(t *testing.T) {
+	distFS, err := fs.Sub(content, "dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := newSPAHandler(distFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.assets[spaIndexFile]; !ok {
+		t.Error("embedded dist has no index.html")
+	}
+}
+
+func TestBuildStamp(t *testing.T) {
+	stamp := BuildStamp()
+	if len(stamp) != 16 {
+		t.Fatalf("BuildStamp() = %q, want 16 hex digits", stamp)
+	}
+	if again := BuildStamp(); again != stamp {
+		t.Errorf("BuildStamp() changed between calls: %q then %q", stamp, again)
+	}
+}
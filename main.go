@@ -14,21 +14,37 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
-	"github.com/RandomCodeSpace/central-ops/pkg/version"
 
 	"github.com/RandomCodeSpace/otelcontext/internal/ai"
+	"github.com/RandomCodeSpace/otelcontext/internal/anomaly"
 	"github.com/RandomCodeSpace/otelcontext/internal/api"
 	"github.com/RandomCodeSpace/otelcontext/internal/archive"
+	"github.com/RandomCodeSpace/otelcontext/internal/buildinfo"
+	"github.com/RandomCodeSpace/otelcontext/internal/completeness"
 	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/demo"
+	"github.com/RandomCodeSpace/otelcontext/internal/export"
 	"github.com/RandomCodeSpace/otelcontext/internal/graph"
 	"github.com/RandomCodeSpace/otelcontext/internal/graphrag"
 	"github.com/RandomCodeSpace/otelcontext/internal/ingest"
+	"github.com/RandomCodeSpace/otelcontext/internal/ingest/bridge"
+	"github.com/RandomCodeSpace/otelcontext/internal/liveness"
+	"github.com/RandomCodeSpace/otelcontext/internal/logging"
 	"github.com/RandomCodeSpace/otelcontext/internal/mcp"
+	"github.com/RandomCodeSpace/otelcontext/internal/outbox"
+	"github.com/RandomCodeSpace/otelcontext/internal/purge"
 	"github.com/RandomCodeSpace/otelcontext/internal/queue"
+	"github.com/RandomCodeSpace/otelcontext/internal/quota"
 	"github.com/RandomCodeSpace/otelcontext/internal/realtime"
+	"github.com/RandomCodeSpace/otelcontext/internal/report"
+	"github.com/RandomCodeSpace/otelcontext/internal/shutdown"
+	"github.com/RandomCodeSpace/otelcontext/internal/slo"
 	"github.com/RandomCodeSpace/otelcontext/internal/storage"
 	"github.com/RandomCodeSpace/otelcontext/internal/telemetry"
+	"github.com/RandomCodeSpace/otelcontext/internal/tenant"
+	"github.com/RandomCodeSpace/otelcontext/internal/topology"
 	"github.com/RandomCodeSpace/otelcontext/internal/tsdb"
 	"github.com/RandomCodeSpace/otelcontext/internal/vectordb"
 	"github.com/RandomCodeSpace/otelcontext/internal/ui"
@@ -37,62 +53,87 @@ import (
 	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	_ "google.golang.org/grpc/encoding/gzip" // Register gzip decompressor
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 
-// Version is detected from build info at startup.
-// Returns the real tag when installed via `go install`, "local" otherwise.
-var Version = version.Detect()
+// shutdownTimeout bounds the whole shutdown sequence.
+const shutdownTimeout = 15 * time.Second
+
+// build identifies this binary. Release builds stamp it via -ldflags (see Makefile);
+// otherwise the module version and the toolchain's VCS stamp are used.
+var build = buildinfo.Read()
 
 func main() {
 	versionFlag := flag.Bool("version", false, "print version and exit")
+	demoFlag := flag.Bool("demo", false, "run with throwaway storage fed by simulated services")
 	flag.Parse()
 
+	if flag.Arg(0) == "migrate" {
+		os.Exit(runMigrate(flag.Args()[1:]))
+	}
+
 	if *versionFlag {
-		fmt.Printf("OtelContext version %s\n", Version)
+		fmt.Printf("OtelContext version %s (commit %s, built %s, %s)\n",
+			build.Version, build.Commit, build.BuildDate, build.GoVersion)
 		os.Exit(0)
 	}
 
-	// Force UTC timezone globally — prevents system timezone leaking into timestamps
-	time.Local = time.UTC
-
-	printBanner()
-
 	// 0. Load Configuration
 	cfg, err := config.Load("")
 	if err != nil {
 		slog.Error("failed to load configuration", "error", err)
 		os.Exit(1)
 	}
+	if *demoFlag {
+		cfg.Demo = true
+	}
+	var demoDir string
+	if cfg.Demo {
+		demoDir, err = os.MkdirTemp("", "otelcontext-demo-")
+		if err != nil {
+			slog.Error("failed to create demo data directory", "error", err)
+			os.Exit(1)
+		}
+		cfg.UseDemoStorage(demoDir)
+		// The repository reads its driver and DSN from the environment
+		os.Setenv("DB_DRIVER", cfg.DBDriver)
+		os.Setenv("DB_DSN", cfg.DBDSN)
+	}
 	if err := cfg.Validate(); err != nil {
 		slog.Error("invalid configuration", "error", err)
 		os.Exit(1)
 	}
+	// Storage stays UTC; this only places hour and day boundaries of aggregations
+	displayLoc, _ := time.LoadLocation(cfg.DisplayTimezone)
+	build.DBDriver = strings.ToLower(cfg.DBDriver)
+	build.UIBuild = ui.BuildStamp()
 
-	// Initialize structured logger
-	var level slog.Level
-	switch strings.ToUpper(cfg.LogLevel) {
-	case "DEBUG":
-		level = slog.LevelDebug
-	case "WARN":
-		level = slog.LevelWarn
-	case "ERROR":
-		level = slog.LevelError
-	default:
+	printBanner()
+
+	// Initialize structured logger. The level can be changed at runtime through
+	// PUT /api/admin/loglevel.
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
 		level = slog.LevelInfo
 	}
+	logging.Init(os.Stdout, level)
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: level,
-	}))
-	slog.SetDefault(logger)
-
-	slog.Info("🚀 Starting OtelContext", "version", Version, "env", cfg.Env, "log_level", level)
+	slog.Info("🚀 Starting OtelContext", "version", build.Version, "commit", build.Commit,
+		"ui_build", build.UIBuild, "env", cfg.Env, "log_level", level)
 
 	// 1. Initialize Internal Telemetry (first — everything registers metrics against this)
 	metrics := telemetry.New()
+	metrics.SetBuildInfo(build.Version, build.UIBuild)
+	wsPingInterval, _ := time.ParseDuration(cfg.WSPingInterval)
+	wsIdleTimeout, _ := time.ParseDuration(cfg.WSIdleTimeout)
+	wsKeepalive := telemetry.Keepalive{Interval: wsPingInterval, IdleTimeout: wsIdleTimeout}
+	metrics.SetHealthKeepalive(wsKeepalive)
 	slog.Info("📊 Internal telemetry initialized")
 
 	// 2. Initialize Storage
@@ -101,6 +142,49 @@ func main() {
 		log.Fatalf("Failed to initialize repository: %v", err)
 	}
 	slog.Info("💾 Storage initialized", "driver", cfg.DBDriver)
+	if cfg.LogIndexedAttributes != "" {
+		repo.SetLogAttributeKeys(strings.Split(cfg.LogIndexedAttributes, ","))
+		slog.Info("🏷️ Log attribute index enabled", "keys", cfg.LogIndexedAttributes)
+	}
+	// Validate() has already checked the format.
+	if queryTimeout, _ := time.ParseDuration(cfg.DBQueryTimeout); queryTimeout > 0 {
+		repo.SetQueryTimeout(queryTimeout)
+		slog.Info("⏱️ Query timeout enabled", "timeout", queryTimeout)
+	}
+	var slowQueries *storage.SlowQueryLog
+	if threshold, _ := time.ParseDuration(cfg.DBSlowQueryThreshold); threshold > 0 {
+		slowQueries = storage.NewSlowQueryLog(threshold, cfg.DBSlowQueryLogSize)
+		repo.SetSlowQueryLog(slowQueries)
+	}
+	if cfg.DBReadDSN != "" {
+		maxLag, _ := time.ParseDuration(cfg.DBReadMaxLag)
+		if err := repo.SetReadReplica(cfg.DBReadDSN, maxLag); err != nil {
+			log.Fatalf("Failed to open read replica: %v", err)
+		}
+		_, healthy, lag := repo.ReplicaStatus()
+		slog.Info("📖 Read replica enabled", "max_lag", maxLag, "healthy", healthy, "lag", lag)
+	}
+	batchSize := cfg.DBBatchSize
+	if batchSize == 0 {
+		batchSize = storage.DefaultBatchSize(cfg.DBDriver)
+	}
+	if cfg.DBBatchAdaptive {
+		target, _ := time.ParseDuration(cfg.DBBatchTargetLatency)
+		repo.SetBatchSizing(func() *storage.BatchSizer {
+			return storage.NewAdaptiveBatchSizer(batchSize, cfg.DBBatchMinSize, cfg.DBBatchMaxSize, target)
+		})
+		slog.Info("📦 Adaptive insert batching enabled", "start", batchSize, "min", cfg.DBBatchMinSize,
+			"max", cfg.DBBatchMaxSize, "target_latency", target)
+	} else {
+		repo.SetBatchSizing(func() *storage.BatchSizer { return storage.NewBatchSizer(batchSize) })
+	}
+	tenants, err := tenant.ParseTokens(cfg.TenantTokens, cfg.SuperAdminToken)
+	if err != nil {
+		log.Fatalf("Invalid TENANT_TOKENS: %v", err)
+	}
+	if tenants.Enabled() {
+		slog.Info("🏢 Multi-tenancy enabled", "tenants", len(tenants.Tenants()), "super_admin", cfg.SuperAdminToken != "")
+	}
 
 	// 3. Initialize DLQ (Dead Letter Queue)
 	replayInterval, err := time.ParseDuration(cfg.DLQReplayInterval)
@@ -108,47 +192,35 @@ func main() {
 		replayInterval = 5 * time.Minute
 	}
 
-	dlq, err := queue.NewDLQWithLimits(cfg.DLQPath, replayInterval, func(data []byte) error {
-		// Replay handler: typed envelope supports logs, spans, traces, and metrics
-		var envelope struct {
-			Type string          `json:"type"`
-			Data json.RawMessage `json:"data"`
-		}
-		if err := json.Unmarshal(data, &envelope); err != nil {
-			// Legacy format: try to deserialize as []storage.Log
+	dlq, err := queue.NewDLQWithLimits(cfg.DLQPath, replayInterval, func(entryType string, data []byte) error {
+		// Replay handler: entries are handed over in sequence order, traces before spans
+		switch entryType {
+		case queue.TypeLogs:
 			var logs []storage.Log
-			if err2 := json.Unmarshal(data, &logs); err2 != nil {
-				return fmt.Errorf("DLQ replay unmarshal failed: %w", err)
-			}
-			return repo.BatchCreateLogs(logs)
-		}
-		switch envelope.Type {
-		case "logs":
-			var logs []storage.Log
-			if err := json.Unmarshal(envelope.Data, &logs); err != nil {
+			if err := json.Unmarshal(data, &logs); err != nil {
 				return fmt.Errorf("DLQ replay logs unmarshal failed: %w", err)
 			}
 			return repo.BatchCreateLogs(logs)
-		case "spans":
+		case queue.TypeSpans:
 			var spans []storage.Span
-			if err := json.Unmarshal(envelope.Data, &spans); err != nil {
+			if err := json.Unmarshal(data, &spans); err != nil {
 				return fmt.Errorf("DLQ replay spans unmarshal failed: %w", err)
 			}
 			return repo.BatchCreateSpans(spans)
-		case "traces":
+		case queue.TypeTraces:
 			var traces []storage.Trace
-			if err := json.Unmarshal(envelope.Data, &traces); err != nil {
+			if err := json.Unmarshal(data, &traces); err != nil {
 				return fmt.Errorf("DLQ replay traces unmarshal failed: %w", err)
 			}
 			return repo.BatchCreateTraces(traces)
-		case "metrics":
+		case queue.TypeMetrics:
 			var metrics []storage.MetricBucket
-			if err := json.Unmarshal(envelope.Data, &metrics); err != nil {
+			if err := json.Unmarshal(data, &metrics); err != nil {
 				return fmt.Errorf("DLQ replay metrics unmarshal failed: %w", err)
 			}
 			return repo.BatchCreateMetrics(metrics)
 		default:
-			return fmt.Errorf("DLQ replay: unknown type %q", envelope.Type)
+			return fmt.Errorf("DLQ replay: unknown type %q", entryType)
 		}
 	}, cfg.DLQMaxFiles, int64(cfg.DLQMaxDiskMB), cfg.DLQMaxRetries)
 	if err != nil {
@@ -162,24 +234,47 @@ func main() {
 	)
 	slog.Info("🔁 DLQ initialized", "path", cfg.DLQPath, "interval", replayInterval)
 
-	// 4. Initialize Real-Time WebSocket Hub
-	hub := realtime.NewHub(func(count int) {
-		metrics.SetActiveConnections(count)
+	// 4a. Dashboard stats cache shared by the API and live snapshots
+	var backend storage.Backend = repo
+	dashboardTTL, err := time.ParseDuration(cfg.DashboardCacheTTL)
+	if err != nil || dashboardTTL < 0 {
+		dashboardTTL = 5 * time.Second
+	}
+	var dashboardCache *storage.DashboardCache
+	if dashboardTTL > 0 {
+		dashboardCache = storage.NewDashboardCache(repo, dashboardTTL)
+		dashboardCache.SetMetrics(metrics.DashboardCacheHits.Inc, metrics.DashboardCacheMisses.Inc)
+		backend = dashboardCache
+		slog.Info("🗃️ Dashboard stats cache enabled", "ttl", dashboardTTL)
+	}
+
+	// 4b. Initialize Event Notification Hub (for live mode — pushes data snapshots; also serves /ws)
+	eventHub := realtime.NewEventHub(backend, func(count int) {
+		metrics.SetActiveConnections(telemetry.HubEvents, count)
+	})
+	eventHub.SetLegacyConnectionCallback(func(count int) {
+		metrics.SetActiveConnections(telemetry.HubWS, count)
 	})
-	hub.SetDevMode(cfg.DevMode)
-	hub.SetWSMetrics(
+	eventHub.SetDevMode(cfg.DevMode)
+	eventHub.SetKeepalive(wsKeepalive)
+	eventHub.SetWSMetrics(
 		func(msgType string) { metrics.WSMessagesSent.WithLabelValues(msgType).Inc() },
 		func() { metrics.WSSlowClientsRemoved.Inc() },
 	)
-	go hub.Run()
-	slog.Info("🔌 WebSocket hub started")
-
-	// 4b. Initialize Event Notification Hub (for live mode — pushes data snapshots)
-	eventHub := realtime.NewEventHub(
-		repo,
-		metrics.IncrementActiveConns,
-		metrics.DecrementActiveConns,
-	)
+	if dashboardCache != nil {
+		eventHub.SetRefreshCallback(dashboardCache.Invalidate)
+	}
+	snapshotBudget, _ := time.ParseDuration(cfg.LiveSnapshotBudget)
+	eventHub.SetSnapshotLimits(cfg.LiveSnapshotWorkers, snapshotBudget)
+	eventHub.SetIdleRefresh(cfg.LiveIdleRefresh)
+	eventHub.SetSnapshotMetrics(func(d time.Duration) {
+		metrics.LiveSnapshotDuration.Observe(d.Seconds())
+	}, metrics.LiveSnapshotsSkipped.Inc)
+	replayMaxAge, _ := time.ParseDuration(cfg.LiveReplayMaxAge)
+	eventHub.SetReplayBuffer(cfg.LiveReplaySize, replayMaxAge)
+	dlq.SetProgressCallback(func(p queue.Progress) {
+		eventHub.BroadcastEvent("dlq_replay", "", p)
+	})
 	ctxEvents, cancelEvents := context.WithCancel(context.Background())
 	go eventHub.Start(ctxEvents, 5*time.Second, 500*time.Millisecond)
 	slog.Info("⚡ Event notification hub started (5s snapshots, 500ms batches)")
@@ -192,12 +287,25 @@ func main() {
 		})
 		slog.Info("📈 TSDB cardinality limit set", "max", cfg.MetricMaxCardinality)
 	}
+	seriesLimits, err := tsdb.ParseSeriesLimits(cfg.MetricSeriesLimits)
+	if err != nil {
+		log.Fatalf("Invalid METRIC_SERIES_LIMITS: %v", err)
+	}
+	tsdbAgg.SetSeriesLimit(cfg.MetricMaxSeries, seriesLimits, func() {
+		metrics.TSDBSeriesOverflow.Inc()
+	})
+	tsdbAgg.SetExemplarLimit(cfg.MetricMaxExemplars)
+	tsdbAgg.SetCatalog(repo)
 	tsdbAgg.SetMetrics(
 		func() { metrics.TSDBIngestTotal.Inc() },
 		func() { metrics.TSDBBatchesDropped.Inc() },
 	)
 	ringBuf := tsdb.NewRingBuffer(120, 30*time.Second)
 	tsdbAgg.SetRingBuffer(ringBuf)
+	// Batches that cannot be queued or written go to the DLQ and are replayed later.
+	tsdbAgg.SetSpill(func(batch []storage.MetricBucket) error {
+		return dlq.Enqueue(queue.Entry{Type: queue.TypeMetrics, Data: batch})
+	})
 	slog.Info("📈 TSDB ring buffer attached (120 slots × 30s = 1h retention)")
 
 	ctxTSDB, cancelTSDB := context.WithCancel(context.Background())
@@ -214,6 +322,19 @@ func main() {
 		"cold_path", cfg.ColdStoragePath,
 	)
 
+	// 4d-2. Optional pre-purge trace archive (local directory or S3-compatible bucket)
+	var purgeArchive *archive.PurgeArchive
+	if cfg.ArchiveEnabled {
+		store, err := archive.NewStore(cfg)
+		if err != nil {
+			slog.Error("failed to initialize trace archive", "error", err)
+			os.Exit(1)
+		}
+		purgeArchive = archive.NewPurgeArchive(repo, store)
+		repo.SetPurgeArchiver(purgeArchive.Export)
+		slog.Info("📦 Pre-purge trace archive enabled", "path", cfg.ArchivePath, "s3_bucket", cfg.ArchiveS3Bucket)
+	}
+
 	// 4e. Initialize In-Memory Service Graph (rebuilds from spans every 30s)
 	svcGraph := graph.New(func(since time.Time) ([]graph.SpanRow, error) {
 		rows, err := repo.GetSpansForGraph(since)
@@ -264,20 +385,141 @@ func main() {
 	go graphRAG.Start(ctxGraphRAG)
 	slog.Info("GraphRAG started (layered graph with anomaly detection)")
 
-	// Auto-migrate GraphRAG models (Investigation, GraphSnapshot)
-	if err := graphrag.AutoMigrateGraphRAG(repo.DB()); err != nil {
-		slog.Error("Failed to migrate GraphRAG models", "error", err)
+	// 4h. Initialize SLO evaluator (operation latency objectives)
+	sloInterval, err := time.ParseDuration(cfg.SLOEvalInterval)
+	if err != nil || sloInterval <= 0 {
+		sloInterval = time.Minute
+	}
+	sloEvaluator := slo.New(repo, sloInterval) // breaches are announced through the outbox
+	ctxSLO, cancelSLO := context.WithCancel(context.Background())
+	go sloEvaluator.Start(ctxSLO)
+	slog.Info("🎯 SLO evaluator started", "interval", sloInterval)
+
+	// 4i. Initialize anomaly detector (request/error rate against rolling baselines)
+	anomalyInterval, err := time.ParseDuration(cfg.AnomalyEvalInterval)
+	if err != nil || anomalyInterval <= 0 {
+		anomalyInterval = time.Minute
+	}
+	anomalyDetector := anomaly.New(repo, anomalyInterval, anomaly.Config{
+		Sigma:       cfg.AnomalySigma,
+		Consecutive: cfg.AnomalyConsecutive,
+		MinSamples:  cfg.AnomalyMinSamples,
+	}) // anomalies are announced through the outbox
+	ctxAnomaly, cancelAnomaly := context.WithCancel(context.Background())
+	go anomalyDetector.Start(ctxAnomaly)
+	slog.Info("📉 Anomaly detector started", "interval", anomalyInterval, "sigma", cfg.AnomalySigma, "consecutive", cfg.AnomalyConsecutive)
+
+	// 4i-2. Service map snapshots for GET /api/metrics/service-map/history
+	mapInterval, _ := time.ParseDuration(cfg.ServiceMapSnapshotInterval) // checked by Validate()
+	mapRetention := time.Duration(cfg.ServiceMapSnapshotRetentionDays) * 24 * time.Hour
+	mapSnapshotter := topology.New(repo, mapInterval, mapRetention)
+	ctxMapSnapshots, cancelMapSnapshots := context.WithCancel(context.Background())
+	if mapInterval > 0 {
+		go mapSnapshotter.Start(ctxMapSnapshots)
+		slog.Info("🗺️ Service map snapshots started", "interval", mapInterval, "retention_days", cfg.ServiceMapSnapshotRetentionDays)
+	}
+
+	// 4i-2b. Trace completeness, a settling delay behind ingest
+	completenessInterval, _ := time.ParseDuration(cfg.TraceCompletenessInterval) // checked by Validate()
+	completenessDelay, _ := time.ParseDuration(cfg.TraceCompletenessDelay)
+	completenessReconciler := completeness.New(repo, completenessInterval, completenessDelay)
+	ctxCompleteness, cancelCompleteness := context.WithCancel(context.Background())
+	if completenessInterval > 0 {
+		go completenessReconciler.Start(ctxCompleteness)
+		slog.Info("🧩 Trace completeness reconciler started", "interval", completenessInterval, "delay", completenessDelay)
+	}
+
+	// 4i-2c. Outbox: delivers the anomaly and SLO breach events to /ws/events and the
+	// webhook, starting with those a previous run left undelivered
+	outboxInterval, _ := time.ParseDuration(cfg.OutboxInterval) // checked by Validate()
+	outboxDispatcher := outbox.New(repo, outboxInterval, cfg.OutboxMaxAttempts)
+	outboxDispatcher.SetBroadcaster(func(ev storage.OutboxEvent) {
+		eventHub.BroadcastTenantEvent(ev.TenantID, ev.Type, ev.ServiceName, json.RawMessage(ev.PayloadJSON))
+	})
+	if cfg.OutboxWebhookURL != "" {
+		var types []string
+		if cfg.OutboxWebhookEvents != "" {
+			types = strings.Split(cfg.OutboxWebhookEvents, ",")
+		}
+		outboxDispatcher.SetWebhook(cfg.OutboxWebhookURL, types)
+	}
+	ctxOutbox, cancelOutbox := context.WithCancel(context.Background())
+	go outboxDispatcher.Start(ctxOutbox)
+	slog.Info("📬 Outbox dispatcher started", "interval", outboxInterval, "webhook", cfg.OutboxWebhookURL != "")
+
+	// 4i-3. Background purge jobs for large DELETE /api/admin/purge requests; resumes
+	// jobs interrupted by the last shutdown
+	purgePause, _ := time.ParseDuration(cfg.PurgeBatchPause) // checked by Validate()
+	purgeWorker := purge.New(backend, cfg.PurgeBatchSize, purgePause) // through the dashboard cache, which each batch clears
+	ctxPurge, cancelPurge := context.WithCancel(context.Background())
+	go purgeWorker.Start(ctxPurge)
+
+	// 4i-4. Read replica lag checks; reads fall back to the primary while it lags
+	ctxReplica, cancelReplica := context.WithCancel(context.Background())
+	go repo.MonitorReplica(ctxReplica, storage.ReplicaCheckInterval)
+
+	// 4j. Initialize daily report (scheduled and via POST /api/admin/report/run)
+	var reportSenders []report.Sender
+	if cfg.ReportWebhookURL != "" {
+		reportSenders = append(reportSenders, report.NewWebhookSender(cfg.ReportWebhookURL))
+	}
+	if cfg.SMTPHost != "" {
+		reportSenders = append(reportSenders, &report.SMTPSender{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			To:       strings.FieldsFunc(cfg.SMTPTo, func(r rune) bool { return r == ',' || r == ' ' }),
+		})
+	}
+	reporter := report.New(repo, reportSenders...)
+	reporter.SetMetrics(metrics)
+	reporter.SetRetries(cfg.ReportRetries)
+	reporter.SetLocation(displayLoc)
+	ctxReport, cancelReport := context.WithCancel(context.Background())
+	if cfg.ReportSchedule != "" {
+		sched, err := report.ParseSchedule(cfg.ReportSchedule)
+		if err != nil {
+			slog.Error("Invalid REPORT_SCHEDULE, scheduled reports disabled", "error", err)
+		} else {
+			go reporter.Start(ctxReport, sched)
+			slog.Info("📨 Daily report scheduled", "schedule", cfg.ReportSchedule, "next_run", sched.Next(time.Now()), "destinations", len(reportSenders))
+		}
 	}
 
 	// 5. Initialize AI Service
 	aiService := ai.NewService(repo)
+	aiService.SetSuppressAfter(cfg.AISuppressAfter)
+	aiService.SetInsightCallback(eventHub.BroadcastLogInsight)
 
 	// 6. Initialize API Server
-	apiServer := api.NewServer(repo, hub, eventHub, metrics)
+	apiServer := api.NewServer(backend, eventHub, metrics)
 	apiServer.SetGraph(svcGraph)
 	apiServer.SetGraphRAG(graphRAG)
 	apiServer.SetVectorIndex(vectorIdx)
 	apiServer.SetColdStoragePath(cfg.ColdStoragePath)
+	apiServer.SetPurgeArchive(purgeArchive)
+	apiServer.SetPurgeWorker(purgeWorker, int64(cfg.PurgeSyncMaxRows))
+	apiServer.SetRingBuffer(ringBuf)
+	apiServer.SetDLQ(dlq)
+	apiServer.SetSlowQueryLog(slowQueries)
+	apiServer.SetBuildInfo(build)
+	apiServer.SetReporter(reporter)
+	apiServer.SetServiceMapHistory(mapInterval, time.Duration(cfg.HotRetentionDays)*24*time.Hour)
+	apiServer.SetDependencyThresholds(cfg.DependencyErrorRateDelta, cfg.DependencyLatencyChange, cfg.DependencyMinCalls)
+	apiServer.SetInsightSuppression(cfg.AISuppressAfter)
+	apiServer.SetDisplayTimezone(displayLoc)
+	maxTimeRange, _ := time.ParseDuration(cfg.APIMaxTimeRange)
+	apiServer.SetMaxTimeRange(maxTimeRange)
+	apiServer.SetImportMaxBytes(int64(cfg.ImportMaxMB) << 20)
+	if cfg.TraceForwardEndpoints != "" {
+		forwardTimeout, _ := time.ParseDuration(cfg.TraceForwardTimeout) // checked by Validate()
+		apiServer.SetTraceForwarder(export.NewForwarder(strings.Split(cfg.TraceForwardEndpoints, ","), forwardTimeout))
+	}
+	apiServer.SetRestore(cfg.RestoreEnabled, int64(cfg.RestoreMaxMB)<<20)
+	apiServer.SetPprofEnabled(cfg.PprofEnabled)
+	apiServer.SetTenants(tenants)
 
 	// 6b. Initialize MCP Server (HTTP Streamable, JSON-RPC 2.0 + SSE)
 	mcpServer := mcp.New(repo, metrics, svcGraph, vectorIdx)
@@ -289,6 +531,29 @@ func main() {
 	logsServer := ingest.NewLogsServer(repo, metrics, cfg)
 	metricsServer := ingest.NewMetricsServer(repo, metrics, tsdbAgg, cfg)
 
+	// Share one set of ingest filters so PUT /api/admin/ingest-config applies to all receivers
+	ingestFilters := ingest.NewFilters(cfg)
+	if cfg.IngestConfigFile != "" {
+		if err := ingestFilters.SetPersistPath(cfg.IngestConfigFile); err != nil {
+			slog.Error("Failed to load ingest config file, using environment settings", "path", cfg.IngestConfigFile, "error", err)
+		}
+	}
+	traceServer.SetFilters(ingestFilters)
+	logsServer.SetFilters(ingestFilters)
+	metricsServer.SetFilters(ingestFilters)
+	apiServer.SetIngestFilters(ingestFilters)
+	if cfg.IngestDeriveREDMetrics {
+		traceServer.SetDerivedMetrics(tsdbAgg)
+		slog.Info("📈 Deriving RED metrics from root spans", "prefix", ingest.DerivedMetricPrefix)
+	}
+	if cfg.IngestDedupeStatusLogs {
+		traceServer.SetStatusLogDedupe(repo)
+	}
+	if cfg.TraceMaxSpans > 0 {
+		traceServer.SetSpanLimiter(ingest.NewSpanLimiter(repo, cfg.TraceMaxSpans, cfg.TraceMaxSpansTracked))
+		slog.Info("✂️ Per-trace span limit enabled", "max_spans", cfg.TraceMaxSpans, "tracked_traces", cfg.TraceMaxSpansTracked)
+	}
+
 	// Wire adaptive sampler (only when rate < 1.0 to avoid unnecessary overhead)
 	if cfg.SamplingRate > 0 && cfg.SamplingRate < 1.0 {
 		sampler := ingest.NewSampler(cfg.SamplingRate, cfg.SamplingAlwaysOnErrors, float64(cfg.SamplingLatencyThresholdMs))
@@ -300,35 +565,159 @@ func main() {
 		)
 	}
 
-	// Wire up live log streaming + AI + DLQ metrics
+	// Wire per-service daily quotas (managed via /api/admin/quotas)
+	quotaInterval, err := time.ParseDuration(cfg.QuotaPersistInterval)
+	if err != nil || quotaInterval <= 0 {
+		quotaInterval = 30 * time.Second
+	}
+	quotaMgr := quota.New(repo, quotaInterval)
+	if err := quotaMgr.Load(); err != nil {
+		slog.Error("Failed to load ingest quotas", "error", err)
+	}
+	traceServer.SetQuota(quotaMgr)
+	logsServer.SetQuota(quotaMgr)
+	apiServer.SetQuotaManager(quotaMgr)
+	ctxQuota, cancelQuota := context.WithCancel(context.Background())
+	go quotaMgr.Start(ctxQuota)
+
+	// Per-service export liveness (GET /api/services/liveness, service_stale events)
+	staleAfter, _ := time.ParseDuration(cfg.ServiceStaleAfter)
+	recoverAfter, _ := time.ParseDuration(cfg.ServiceRecoverAfter)
+	livenessInterval, _ := time.ParseDuration(cfg.LivenessPersistInterval)
+	livenessTracker := liveness.New(repo, livenessInterval, staleAfter, recoverAfter)
+	if err := livenessTracker.Load(); err != nil {
+		slog.Error("Failed to load service liveness", "error", err)
+	}
+	livenessTracker.SetTransitionCallback(func(tr liveness.Transition) {
+		event := "service_recovered"
+		if tr.Stale {
+			event = "service_stale"
+		}
+		eventHub.BroadcastTenantEvent(tr.TenantID, event, tr.ServiceName, tr)
+	})
+	traceServer.SetLiveness(livenessTracker)
+	logsServer.SetLiveness(livenessTracker)
+	metricsServer.SetLiveness(livenessTracker)
+	apiServer.SetLiveness(livenessTracker)
+	ctxLiveness, cancelLiveness := context.WithCancel(context.Background())
+	go livenessTracker.Start(ctxLiveness)
+
+	// Collapse bursts of identical log lines into a repeat count on the first one
+	var logCollapser *ingest.LogCollapser
+	ctxCollapse, cancelCollapse := context.WithCancel(context.Background())
+	if window, err := time.ParseDuration(cfg.LogCollapseWindow); err == nil && window > 0 {
+		logCollapser = ingest.NewLogCollapser(repo, window, cfg.LogCollapseMaxKeys)
+		logCollapser.SetRepeatCallback(func(r ingest.LogRepeat) {
+			eventHub.BroadcastTenantEvent(r.TenantID, "log_repeat", r.ServiceName, r)
+		})
+		logsServer.SetCollapser(logCollapser)
+		go logCollapser.Start(ctxCollapse)
+		slog.Info("🔁 Log collapsing enabled", "window", window, "max_keys", cfg.LogCollapseMaxKeys)
+	}
+
+	// Wire up live log streaming + AI. Fan-out runs on the dispatcher goroutine, off the
+	// OTLP Export path, so slow subscribers cannot hold up ingestion.
 	logHandler := func(l storage.Log) {
-		start := time.Now()
 		eventHub.BroadcastLog(realtime.LogEntry{
 			ID:             l.ID,
 			TraceID:        l.TraceID,
 			SpanID:         l.SpanID,
 			Severity:       l.Severity,
 			Body:           string(l.Body),
+			BodyType:       l.BodyType,
+			Truncated:      l.Truncated,
 			ServiceName:    l.ServiceName,
+			Environment:    l.Environment,
 			AttributesJSON: string(l.AttributesJSON),
 			AIInsight:      string(l.AIInsight),
 			Timestamp:      l.Timestamp,
+			TenantID:       l.TenantID,
 		})
 		aiService.EnqueueLog(l)
 		vectorIdx.Add(l.ID, l.ServiceName, l.Severity, string(l.Body))
+		graphRAG.OnLogIngested(l)
+	}
+	logDispatcher := ingest.NewLogDispatcher(cfg.LogDispatchQueueSize, func(batch []storage.Log) {
+		for _, l := range batch {
+			logHandler(l)
+		}
 		eventHub.NotifyRefresh()
-		if time.Since(start) > 100*time.Millisecond {
-			slog.Warn("Slow broadcast/enqueue", "duration", time.Since(start))
+	})
+	logDispatcher.SetMetrics(
+		func(n int) { metrics.LogDispatchDropped.Add(float64(n)) },
+		func(d time.Duration) { metrics.LogDispatchDuration.Observe(d.Seconds()) },
+	)
+	logsServer.SetLogCallback(logDispatcher.Dispatch)
+	traceServer.SetLogCallback(logDispatcher.Dispatch)
+	ctxDispatch, cancelDispatch := context.WithCancel(context.Background())
+	dispatchDone := make(chan struct{})
+	go func() {
+		logDispatcher.Start(ctxDispatch)
+		close(dispatchDone)
+	}()
+
+	// Optional log bridge: JSON logs consumed from NATS JetStream or Kafka join the OTLP log pipeline
+	ctxBridge, cancelBridge := context.WithCancel(context.Background())
+	bridgeDone := make(chan struct{})
+	if cfg.BridgeNATSURL != "" || cfg.BridgeKafkaBrokers != "" {
+		mapping, err := bridge.ParseMapping(cfg.BridgeMapping)
+		if err != nil {
+			log.Fatalf("Invalid BRIDGE_MAPPING: %v", err)
 		}
+		var src bridge.Source
+		var from []any // logged with the start message
+		if cfg.BridgeKafkaBrokers != "" {
+			src, err = bridge.NewKafkaSource(cfg.BridgeKafkaBrokers, cfg.BridgeKafkaTopics, cfg.BridgeKafkaGroup, bridge.KafkaOptions{
+				TLS:           cfg.BridgeKafkaTLS,
+				CAFile:        cfg.BridgeKafkaCA,
+				SASLMechanism: cfg.BridgeKafkaSASL,
+				Username:      cfg.BridgeKafkaUsername,
+				Password:      cfg.BridgeKafkaPassword,
+			})
+			from = []any{"topics", cfg.BridgeKafkaTopics, "group", cfg.BridgeKafkaGroup}
+		} else {
+			src, err = bridge.NewNATSSource(cfg.BridgeNATSURL, cfg.BridgeNATSStream, cfg.BridgeNATSConsumer, cfg.BridgeNATSSubject, bridge.NATSOptions{
+				CredsFile: cfg.BridgeNATSCreds,
+				NKeyFile:  cfg.BridgeNATSNKey,
+				CAFile:    cfg.BridgeNATSCA,
+			})
+			from = []any{"stream", cfg.BridgeNATSStream, "consumer", cfg.BridgeNATSConsumer}
+		}
+		if err != nil {
+			log.Fatalf("Invalid log bridge settings: %v", err)
+		}
+		flushInterval, _ := time.ParseDuration(cfg.BridgeFlushInterval)
+		logBridge := bridge.New(src, repo, mapping, cfg.BridgeBatchSize, flushInterval)
+		logBridge.SetMaxBodyBytes(cfg.LogMaxBodyBytes)
+		logBridge.SetFilters(ingestFilters)
+		logBridge.SetLogCallback(logDispatcher.Dispatch)
+		logBridge.SetDeadLetter(func(logs []storage.Log) error {
+			return dlq.Enqueue(queue.Entry{Type: queue.TypeLogs, Data: logs})
+		})
+		logBridge.SetMetrics(func(result string, n int) {
+			metrics.BridgeMessages.WithLabelValues(result).Add(float64(n))
+		})
+		go func() {
+			logBridge.Start(ctxBridge)
+			close(bridgeDone)
+		}()
+		slog.Info("🌉 Log bridge started", from...)
+	} else {
+		close(bridgeDone)
 	}
 
-	logsServer.SetLogCallback(func(l storage.Log) {
-		logHandler(l)
-		graphRAG.OnLogIngested(l)
-	})
-	traceServer.SetLogCallback(func(l storage.Log) {
-		logHandler(l)
-		graphRAG.OnLogIngested(l)
+	// Push incremental trace summaries to live event clients
+	traceServer.SetTraceCallback(func(t storage.Trace) {
+		eventHub.BroadcastTrace(realtime.TraceEntry{
+			TraceID:     t.TraceID,
+			ServiceName: t.ServiceName,
+			Environment: t.Environment,
+			Operation:   t.Operation,
+			DurationMs:  t.DurationMs,
+			Status:      t.Status,
+			Timestamp:   t.Timestamp,
+			TenantID:    t.TenantID,
+		})
 	})
 
 	// Wire span callbacks for GraphRAG
@@ -343,17 +732,38 @@ func main() {
 			Value:       m.Value,
 			Timestamp:   m.Timestamp,
 			Attributes:  m.Attributes,
+			TenantID:    m.TenantID,
 		})
 		graphRAG.OnMetricIngested(m)
 	})
 
+	// Per-service ingest volume (Prometheus + health top services)
+	traceServer.SetIngestCallback(func(service string, count int) {
+		metrics.RecordServiceIngest(service, "traces", count)
+		eventHub.NotifyRefresh()
+	})
+	logsServer.SetIngestCallback(func(service string, count int) {
+		metrics.RecordServiceIngest(service, "logs", count)
+	})
+	metricsServer.SetIngestCallback(func(service string, count int) {
+		metrics.RecordServiceIngest(service, "metrics", count)
+	})
+
 	// Update DLQ size metric periodically
+	ctxDLQSize, cancelDLQSize := context.WithCancel(context.Background())
+	dlqSizeDone := make(chan struct{})
 	go func() {
+		defer close(dlqSizeDone)
 		ticker := time.NewTicker(30 * time.Second)
 		defer ticker.Stop()
-		for range ticker.C {
-			metrics.SetDLQSize(dlq.Size())
-			metrics.DLQDiskBytes.Set(float64(dlq.DiskBytes()))
+		for {
+			select {
+			case <-ctxDLQSize.Done():
+				return
+			case <-ticker.C:
+				metrics.SetDLQSize(dlq.Size())
+				metrics.DLQDiskBytes.Set(float64(dlq.DiskBytes()))
+			}
 		}
 	}()
 
@@ -363,7 +773,11 @@ func main() {
 		log.Fatalf("Failed to listen on :%s: %v", cfg.GRPCPort, err)
 	}
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(metricsUnaryInterceptor(metrics)),
+		grpc.ChainUnaryInterceptor(
+			metricsUnaryInterceptor(metrics),
+			tenantUnaryInterceptor(tenants),
+			ingestUnaryInterceptor(metrics),
+		),
 	)
 	coltracepb.RegisterTraceServiceServer(grpcServer, traceServer)
 	collogspb.RegisterLogsServiceServer(grpcServer, logsServer)
@@ -381,12 +795,30 @@ func main() {
 	metrics.StartRuntimeMetrics()
 	slog.Info("📊 Runtime metrics sampling started")
 
+	// Demo mode: simulated services feed the ingest servers in-process
+	var demoGen *demo.Generator
+	if cfg.Demo {
+		demoGen = demo.New(demo.Exporters{Traces: traceServer, Logs: logsServer, Metrics: metricsServer}, 1, cfg.DemoRate)
+		apiServer.SetDemo(demoGen)
+		demoGen.Start()
+		slog.Info("🎭 Demo mode: generating simulated traffic", "services", demo.Services, "rate", cfg.DemoRate, "data_dir", demoDir)
+	}
+
 	// 7b. Register HTTP OTLP endpoints (before catch-all UI handler)
 	otlpHTTP := ingest.NewHTTPHandler(traceServer, logsServer, metricsServer)
 
 	// 8. Start HTTP Server
 	mux := http.NewServeMux()
 	otlpHTTP.RegisterRoutes(mux)
+	if cfg.APIRateLimitRPS > 0 {
+		apiServer.SetRateLimiter(api.NewRateLimiter(float64(cfg.APIRateLimitRPS), cfg.APIRateLimitBurst))
+		slog.Info("🛡️  API rate limiter enabled", "rps_per_client", cfg.APIRateLimitRPS, "burst", cfg.APIRateLimitBurst)
+	}
+	if cfg.APIMaxConcurrent > 0 {
+		queueWait, _ := time.ParseDuration(cfg.APIConcurrencyQueueWait)
+		apiServer.SetConcurrencyLimit(cfg.APIMaxConcurrent, queueWait)
+		slog.Info("🛡️  API concurrency limit enabled", "per_endpoint", cfg.APIMaxConcurrent, "queue_wait", queueWait)
+	}
 	apiServer.RegisterRoutes(mux)
 
 	// MCP Server routes (conditionally enabled via MCP_ENABLED)
@@ -395,8 +827,10 @@ func main() {
 		if mcpPath == "" {
 			mcpPath = "/mcp"
 		}
-		mux.Handle(mcpPath, http.StripPrefix(mcpPath, mcpServer.Handler()))
-		mux.Handle(mcpPath+"/", http.StripPrefix(mcpPath, mcpServer.Handler()))
+		// MCP tools read across tenants, so only the super-admin may use them
+		mcpHandler := apiServer.RequireSuperAdmin(http.StripPrefix(mcpPath, mcpServer.Handler()))
+		mux.Handle(mcpPath, mcpHandler)
+		mux.Handle(mcpPath+"/", mcpHandler)
 		slog.Info("🤖 MCP endpoint registered", "path", mcpPath)
 	}
 
@@ -407,16 +841,9 @@ func main() {
 		log.Fatalf("Failed to register UI routes: %v", err)
 	}
 
-	var httpHandler http.Handler = api.MetricsMiddleware(metrics, mux)
-	if cfg.APIRateLimitRPS > 0 {
-		rl := api.NewRateLimiter(float64(cfg.APIRateLimitRPS))
-		httpHandler = rl.Middleware(httpHandler)
-		slog.Info("🛡️  API rate limiter enabled", "rps_per_ip", cfg.APIRateLimitRPS)
-	}
-
 	srv := &http.Server{
 		Addr:    ":" + cfg.HTTPPort,
-		Handler: httpHandler,
+		Handler: apiServer.Handler(mux, cfg.APIGzipMinBytes),
 	}
 
 	go func() {
@@ -431,40 +858,99 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	slog.Info("Shutting down OtelContext V5.4...")
+	slog.Info("Shutting down OtelContext...", "version", build.Version)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
-	// Ordered shutdown: ingestion → HTTP → hubs/events → processing → DLQ → DB
-	// 1. Stop ingestion paths first (no new data)
-	grpcServer.GracefulStop()
-	if err := srv.Shutdown(ctx); err != nil {
-		slog.Error("HTTP server forced shutdown", "error", err)
+	// Ordered shutdown: each step only starts once the one before it is done, so
+	// everything accepted before the signal is stored before the database closes.
+	var seq shutdown.Sequence
+	seq.Add("readiness", func(context.Context) error {
+		apiServer.SetDraining()
+		return nil
+	})
+	seq.Add("listeners", func(ctx context.Context) error {
+		if demoGen != nil {
+			demoGen.Stop()
+		}
+		grpcServer.GracefulStop()
+		cancelBridge() // stores and commits what it has already fetched
+		<-bridgeDone
+		return srv.Shutdown(ctx)
+	})
+	seq.Add("ingest dispatch", func(context.Context) error {
+		// Fan out what ingestion has already queued while the hubs are still up
+		cancelDispatch()
+		<-dispatchDone
+		cancelDLQSize()
+		<-dlqSizeDone
+		return nil
+	})
+	seq.Add("flush", func(context.Context) error {
+		tsdbAgg.Stop()
+		cancelTSDB()
+		aiService.Stop()
+		cancelCollapse()
+		if logCollapser != nil {
+			logCollapser.Flush(true)
+		}
+		quotaMgr.Stop()
+		cancelQuota()
+		livenessTracker.Stop()
+		cancelLiveness()
+		if err := quotaMgr.Flush(); err != nil {
+			slog.Error("Failed to persist quota usage", "error", err)
+		}
+		if err := livenessTracker.Flush(); err != nil {
+			slog.Error("Failed to persist service liveness", "error", err)
+		}
+		return nil
+	})
+	seq.Add("background workers", func(context.Context) error {
+		cancelArchive()
+		cancelGraph()
+		graphRAG.Stop()
+		cancelGraphRAG()
+		sloEvaluator.Stop()
+		cancelSLO()
+		anomalyDetector.Stop()
+		cancelAnomaly()
+		mapSnapshotter.Stop()
+		cancelMapSnapshots()
+		completenessReconciler.Stop()
+		cancelCompleteness()
+		outboxDispatcher.Stop()
+		cancelOutbox()
+		purgeWorker.Stop()
+		cancelPurge()
+		cancelReplica()
+		reporter.Stop()
+		cancelReport()
+		apiServer.Stop() // integrity checks and report runs started through the API
+		return nil
+	})
+	seq.Add("websockets", func(context.Context) error {
+		eventHub.Stop()
+		cancelEvents()
+		return nil
+	})
+	seq.Add("dlq", func(context.Context) error {
+		dlq.Stop() // may still be replaying
+		return nil
+	})
+	seq.Add("database", func(context.Context) error {
+		return repo.Close() // last: everything above may still write
+	})
+	if unfinished := seq.Run(ctx); len(unfinished) > 0 {
+		slog.Error("❌ Shutdown timed out, exiting", "timeout", shutdownTimeout, "unfinished", unfinished)
+		os.Exit(1)
 	}
-
-	// 2. Stop real-time hubs and event processing
-	hub.Stop()
-	cancelEvents()
-	aiService.Stop()
-
-	// 3. Stop processing engines (TSDB flush, archiver, graph, GraphRAG)
-	tsdbAgg.Stop()
-	cancelTSDB()
-	cancelArchive()
-	cancelGraph()
-	graphRAG.Stop()
-	cancelGraphRAG()
-
-	// 4. Stop DLQ (may still be replaying)
-	dlq.Stop()
-
-	// 5. Close database last (everything above may still write)
-	if err := repo.Close(); err != nil {
-		slog.Error("Failed to close database", "error", err)
+	if demoDir != "" {
+		os.RemoveAll(demoDir)
 	}
 
-	slog.Info("✅ OtelContext V5.4 shutdown complete")
+	slog.Info("✅ OtelContext shutdown complete", "version", build.Version)
 }
 
 // metricsUnaryInterceptor records OtelContext_grpc_requests_total and OtelContext_grpc_request_duration_seconds
@@ -490,6 +976,76 @@ func metricsUnaryInterceptor(m *telemetry.Metrics) grpc.UnaryServerInterceptor {
 	}
 }
 
+// ingestUnaryInterceptor records OtelContext_ingest_export_duration_seconds and
+// OtelContext_ingest_request_bytes_total for OTLP Export calls, labeled by signal.
+func ingestUnaryInterceptor(m *telemetry.Metrics) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		method := ingestMethod(info.FullMethod)
+		if method == "" {
+			return handler(ctx, req)
+		}
+
+		size := 0
+		if msg, ok := req.(proto.Message); ok {
+			size = proto.Size(msg)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.ObserveExport(method, time.Since(start).Seconds(), size)
+		return resp, err
+	}
+}
+
+// tenantUnaryInterceptor resolves the bearer token in the "authorization" metadata of
+// OTLP Export calls into the tenant their records are stored under. Calls without a
+// token go to the default tenant; an unknown token is rejected.
+func tenantUnaryInterceptor(tokens *tenant.Tokens) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if !tokens.Enabled() || ingestMethod(info.FullMethod) == "" {
+			return handler(ctx, req)
+		}
+		var token string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get("authorization"); len(v) > 0 {
+				token = tenant.BearerToken(v[0])
+			}
+		}
+		if token == "" {
+			return handler(ctx, req)
+		}
+		id, ok := tokens.Resolve(token)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return handler(tenant.NewContext(ctx, id), req)
+	}
+}
+
+// ingestMethod maps an OTLP collector gRPC method to its signal name.
+func ingestMethod(fullMethod string) string {
+	switch {
+	case strings.HasPrefix(fullMethod, "/opentelemetry.proto.collector.trace."):
+		return "traces"
+	case strings.HasPrefix(fullMethod, "/opentelemetry.proto.collector.logs."):
+		return "logs"
+	case strings.HasPrefix(fullMethod, "/opentelemetry.proto.collector.metrics."):
+		return "metrics"
+	default:
+		return ""
+	}
+}
+
 func printBanner() {
 	banner := `
   ___ _____ _____ _     
@@ -498,9 +1054,14 @@ func printBanner() {
 | |_| || | | |___| |___ 
  \___/ |_| |_____|_____|
 
-  version: %s
+  version:  %s
+  commit:   %s
+  built:    %s
+  go:       %s
+  database: %s
+  ui build: %s
 `
-	fmt.Printf(banner, Version)
+	fmt.Printf(banner, build.Version, build.Commit, build.BuildDate, build.GoVersion, build.DBDriver, build.UIBuild)
 }
 
 
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RandomCodeSpace/otelcontext/internal/config"
+	"github.com/RandomCodeSpace/otelcontext/internal/storage"
+)
+
+// runMigrate implements "otelcontext migrate status|up" against the configured
+// database, e.g. to apply migrations ahead of a rollout. It returns the exit code.
+func runMigrate(args []string) int {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		fmt.Fprintln(os.Stderr, "usage: otelcontext migrate status|up")
+		return 2
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return 1
+	}
+	db, err := storage.NewDatabase(cfg.DBDriver, cfg.DBDSN)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	runner, err := storage.NewSchemaRunner(db, cfg.DBDriver)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if args[0] == "up" {
+		n, err := storage.MigrateSchema(db, cfg.DBDriver)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Schema is at version %d (%d migration(s) applied)\n", runner.Latest(), n)
+		return 0
+	}
+
+	applied, pending, err := runner.Status()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, rec := range applied {
+		state := "applied"
+		switch {
+		case rec.Version > runner.Latest():
+			state = "unknown (newer release)"
+		case rec.Dirty:
+			state = "dirty"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", rec.Version, rec.Name, state, rec.AppliedAt.Format(time.RFC3339))
+	}
+	for _, m := range pending {
+		fmt.Fprintf(w, "%d\t%s\tpending\t\n", m.Version, m.Name)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,220 @@
+// Package argusotel wires the OpenTelemetry SDK of a Go service to an OtelContext
+// (Argus) endpoint in one call: tracer provider, metric exporter, a log/slog bridge,
+// W3C propagators and graceful shutdown, all exporting OTLP over gRPC.
+//
+//	shutdown, err := argusotel.Setup(ctx, "order-service", "localhost:4317", argusotel.WithInsecure())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer shutdown(context.Background())
+package argusotel
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// config holds the settings assembled from Options.
+type config struct {
+	sampleRatio    float64
+	insecure       bool
+	tlsConfig      *tls.Config
+	attributes     []attribute.KeyValue
+	metricInterval time.Duration
+	logLevel       slog.Level
+	logs           bool
+	logWriter      io.Writer
+}
+
+// Option customizes Setup and New.
+type Option func(*config)
+
+// WithSampleRatio samples the given fraction (0..1) of new traces. Child spans follow
+// their parent's decision. Default: 1 (keep everything).
+func WithSampleRatio(ratio float64) Option {
+	return func(c *config) { c.sampleRatio = ratio }
+}
+
+// WithInsecure disables TLS, e.g. for a local OtelContext on localhost:4317.
+func WithInsecure() Option {
+	return func(c *config) { c.insecure = true }
+}
+
+// WithTLSConfig sets the TLS configuration used to reach the endpoint.
+// Without it, TLS with the system root CAs is used unless WithInsecure is given.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *config) { c.tlsConfig = cfg }
+}
+
+// WithResourceAttributes adds attributes (deployment.environment, service.version, ...)
+// to the resource shared by traces, metrics and logs.
+func WithResourceAttributes(attrs ...attribute.KeyValue) Option {
+	return func(c *config) { c.attributes = append(c.attributes, attrs...) }
+}
+
+// WithMetricInterval sets how often metrics are exported. Default: 5s.
+func WithMetricInterval(d time.Duration) Option {
+	return func(c *config) { c.metricInterval = d }
+}
+
+// WithLogLevel sets the minimum slog level that is exported. Default: slog.LevelInfo.
+func WithLogLevel(level slog.Level) Option {
+	return func(c *config) { c.logLevel = level }
+}
+
+// WithLogWriter sets where log records are printed besides being exported.
+// Default: os.Stderr; io.Discard prints nothing.
+func WithLogWriter(w io.Writer) Option {
+	return func(c *config) { c.logWriter = w }
+}
+
+// WithoutLogs leaves the default slog logger untouched and exports no logs.
+func WithoutLogs() Option {
+	return func(c *config) { c.logs = false }
+}
+
+// Providers is the telemetry pipeline of one service, as built by New.
+type Providers struct {
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+	// Logger prints each record locally and exports it as an OTLP log correlated with
+	// the active span. It is nil with WithoutLogs.
+	Logger *slog.Logger
+
+	logs *logExporter
+}
+
+// Shutdown flushes and shuts down the providers and the log exporter.
+func (p *Providers) Shutdown(ctx context.Context) error {
+	errs := []error{p.TracerProvider.Shutdown(ctx), p.MeterProvider.Shutdown(ctx)}
+	if p.logs != nil {
+		errs = append(errs, p.logs.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Propagator returns the W3C trace context and baggage propagator Setup installs.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// Setup configures the global tracer provider, meter provider and text map propagator
+// to export to endpoint (host:port of the OTLP gRPC listener) under serviceName. Unless
+// WithoutLogs is given it also replaces the default slog logger — and with it the output
+// of the standard log package — with one that prints to stderr and exports every record
+// as an OTLP log correlated with the active span.
+//
+// The returned function flushes and shuts everything down; call it before exiting.
+func Setup(ctx context.Context, serviceName, endpoint string, opts ...Option) (func(context.Context) error, error) {
+	p, err := New(ctx, serviceName, endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(p.TracerProvider)
+	otel.SetMeterProvider(p.MeterProvider)
+	otel.SetTextMapPropagator(Propagator())
+	if p.Logger != nil {
+		slog.SetDefault(p.Logger)
+	}
+	return p.Shutdown, nil
+}
+
+// New builds the providers Setup installs without installing anything globally, for
+// a process hosting several services that each report under their own name. Pass
+// Propagator() to instrumentation that takes one.
+func New(ctx context.Context, serviceName, endpoint string, opts ...Option) (*Providers, error) {
+	cfg := config{
+		sampleRatio:    1,
+		metricInterval: 5 * time.Second,
+		logLevel:       slog.LevelInfo,
+		logs:           true,
+		logWriter:      os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithAttributes(cfg.attributes...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	// Traces
+	traceOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if cfg.insecure {
+		traceOpts = append(traceOpts, otlptracegrpc.WithInsecure())
+	} else {
+		traceOpts = append(traceOpts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(cfg.tlsConfig)))
+	}
+	traceExporter, err := otlptracegrpc.New(ctx, traceOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	var sampler sdktrace.Sampler = sdktrace.AlwaysSample()
+	if cfg.sampleRatio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.sampleRatio))
+	}
+	p := &Providers{TracerProvider: sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(res),
+		sdktrace.WithBatcher(traceExporter),
+	)}
+
+	// Metrics
+	metricOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(endpoint)}
+	if cfg.insecure {
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
+	} else {
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(cfg.tlsConfig)))
+	}
+	metricExporter, err := otlpmetricgrpc.New(ctx, metricOpts...)
+	if err != nil {
+		_ = p.TracerProvider.Shutdown(ctx)
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	p.MeterProvider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(cfg.metricInterval))),
+	)
+
+	// Logs
+	if cfg.logs {
+		creds := insecure.NewCredentials()
+		if !cfg.insecure {
+			creds = credentials.NewTLS(cfg.tlsConfig)
+		}
+		conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			_ = p.TracerProvider.Shutdown(ctx)
+			_ = p.MeterProvider.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create log exporter: %w", err)
+		}
+		p.logs = newLogExporter(conn, res, serviceName)
+		local := slog.NewTextHandler(cfg.logWriter, &slog.HandlerOptions{Level: cfg.logLevel})
+		p.Logger = slog.New(newBridgeHandler(local, p.logs, cfg.logLevel))
+	}
+	return p, nil
+}
@@ -0,0 +1,191 @@
+package argusotel
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+)
+
+// collector is an in-memory OTLP gRPC receiver that records every request.
+type collector struct {
+	coltracepb.UnimplementedTraceServiceServer
+	colmetricspb.UnimplementedMetricsServiceServer
+	collogspb.UnimplementedLogsServiceServer
+
+	mu      sync.Mutex
+	traces  []*coltracepb.ExportTraceServiceRequest
+	metrics []*colmetricspb.ExportMetricsServiceRequest
+	logs    []*collogspb.ExportLogsServiceRequest
+}
+
+func (c *collector) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.traces = append(c.traces, req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsCollector struct{ *collector }
+
+func (c metricsCollector) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = append(c.metrics, req)
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+type logsCollector struct{ *collector }
+
+func (c logsCollector) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logs = append(c.logs, req)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func startCollector(t *testing.T) (*collector, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, c)
+	colmetricspb.RegisterMetricsServiceServer(srv, metricsCollector{c})
+	collogspb.RegisterLogsServiceServer(srv, logsCollector{c})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return c, lis.Addr().String()
+}
+
+func attrMap(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.GetStringValue()
+	}
+	return m
+}
+
+func TestSetupExportsToEndpoint(t *testing.T) {
+	c, endpoint := startCollector(t)
+	prevLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prevLogger) })
+
+	ctx := context.Background()
+	shutdown, err := Setup(ctx, "checkout", endpoint,
+		WithInsecure(),
+		WithResourceAttributes(attribute.String("deployment.environment", "test")),
+	)
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	spanCtx, span := otel.Tracer("test").Start(ctx, "GET /cart")
+	slog.InfoContext(spanCtx, "cart loaded", "items", 3)
+	span.End()
+	counter, _ := otel.Meter("test").Int64Counter("carts_total")
+	counter.Add(ctx, 1)
+
+	sctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := shutdown(sctx); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.traces) == 0 || len(c.metrics) == 0 || len(c.logs) == 0 {
+		t.Fatalf("collector received traces=%d metrics=%d logs=%d, want all > 0", len(c.traces), len(c.metrics), len(c.logs))
+	}
+
+	for name, res := range map[string][]*commonpb.KeyValue{
+		"traces":  c.traces[0].ResourceSpans[0].Resource.Attributes,
+		"metrics": c.metrics[0].ResourceMetrics[0].Resource.Attributes,
+		"logs":    c.logs[0].ResourceLogs[0].Resource.Attributes,
+	} {
+		attrs := attrMap(res)
+		if attrs["service.name"] != "checkout" || attrs["deployment.environment"] != "test" {
+			t.Errorf("%s resource attributes = %v", name, attrs)
+		}
+	}
+
+	rec := c.logs[0].ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if rec.Body.GetStringValue() != "cart loaded" {
+		t.Errorf("log body = %q", rec.Body.GetStringValue())
+	}
+	wantTrace := span.SpanContext().TraceID()
+	if string(rec.TraceId) != string(wantTrace[:]) {
+		t.Errorf("log record not correlated with the active span")
+	}
+}
+
+func TestSampleRatio(t *testing.T) {
+	_, endpoint := startCollector(t)
+	shutdown, err := Setup(context.Background(), "sampled", endpoint, WithInsecure(), WithSampleRatio(0), WithoutLogs())
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	defer shutdown(context.Background())
+
+	_, span := otel.Tracer("test").Start(context.Background(), "dropped")
+	defer span.End()
+	if span.SpanContext().IsSampled() {
+		t.Error("span sampled with ratio 0")
+	}
+}
+
+func TestNewLeavesGlobalsAlone(t *testing.T) {
+	c, endpoint := startCollector(t)
+	prevLogger, prevTracer := slog.Default(), otel.GetTracerProvider()
+
+	ctx := context.Background()
+	var loggers []*slog.Logger
+	for _, name := range []string{"cart", "pricing"} {
+		p, err := New(ctx, name, endpoint, WithInsecure(), WithLogWriter(io.Discard))
+		if err != nil {
+			t.Fatalf("New(%s) error = %v", name, err)
+		}
+		_, span := p.TracerProvider.Tracer("test").Start(ctx, name+" op")
+		span.End()
+		p.Logger.InfoContext(ctx, name+" ready")
+		loggers = append(loggers, p.Logger)
+		if err := p.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown() error = %v", err)
+		}
+	}
+	if slog.Default() != prevLogger || otel.GetTracerProvider() != prevTracer {
+		t.Error("New replaced the global logger or tracer provider")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	services := map[string]bool{}
+	for _, req := range c.traces {
+		for _, rs := range req.ResourceSpans {
+			services[attrMap(rs.Resource.Attributes)["service.name"]] = true
+		}
+	}
+	for _, req := range c.logs {
+		for _, rl := range req.ResourceLogs {
+			services["logs:"+attrMap(rl.Resource.Attributes)["service.name"]] = true
+		}
+	}
+	for _, want := range []string{"cart", "pricing", "logs:cart", "logs:pricing"} {
+		if !services[want] {
+			t.Errorf("no telemetry for %s, got %v", want, services)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package argusotel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+)
+
+const (
+	logBatchSize     = 512
+	logFlushInterval = time.Second
+	logQueueLimit    = 8192 // records beyond this are dropped while the endpoint is unreachable
+)
+
+// logExporter batches OTLP log records and ships them over gRPC.
+type logExporter struct {
+	conn     *grpc.ClientConn
+	client   collogspb.LogsServiceClient
+	resource *resourcepb.Resource
+	scope    *commonpb.InstrumentationScope
+
+	mu      sync.Mutex
+	pending []*logspb.LogRecord
+
+	kick     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newLogExporter(conn *grpc.ClientConn, res *resource.Resource, scopeName string) *logExporter {
+	e := &logExporter{
+		conn:     conn,
+		client:   collogspb.NewLogsServiceClient(conn),
+		resource: &resourcepb.Resource{Attributes: keyValues(res.Attributes())},
+		scope:    &commonpb.InstrumentationScope{Name: scopeName},
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// enqueue adds a record to the next batch, waking the exporter once a batch is full.
+func (e *logExporter) enqueue(rec *logspb.LogRecord) {
+	e.mu.Lock()
+	if len(e.pending) < logQueueLimit {
+		e.pending = append(e.pending, rec)
+	}
+	full := len(e.pending) >= logBatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *logExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		case <-e.kick:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		e.flush(ctx)
+		cancel()
+	}
+}
+
+// flush exports everything queued so far. Failed batches are dropped: logs are
+// best-effort and must never block the application.
+func (e *logExporter) flush(ctx context.Context) error {
+	e.mu.Lock()
+	batch := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	_, err := e.client.Export(ctx, &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{Scope: e.scope, LogRecords: batch}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export %d log records: %w", len(batch), err)
+	}
+	return nil
+}
+
+// Shutdown stops the background exporter, flushes what is left and closes the connection.
+func (e *logExporter) Shutdown(ctx context.Context) error {
+	var err error
+	e.stopOnce.Do(func() {
+		close(e.stop)
+		<-e.done
+		err = e.flush(ctx)
+		if cerr := e.conn.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// bridgeHandler is a slog.Handler that writes every record to a local handler and
+// queues it as an OTLP log record carrying the trace and span IDs of the context.
+type bridgeHandler struct {
+	local    slog.Handler
+	exporter *logExporter
+	level    slog.Level
+	attrs    []*commonpb.KeyValue
+	group    string // dotted prefix for attributes added after WithGroup
+}
+
+func newBridgeHandler(local slog.Handler, exporter *logExporter, level slog.Level) *bridgeHandler {
+	return &bridgeHandler{local: local, exporter: exporter, level: level}
+}
+
+func (h *bridgeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level || h.local.Enabled(ctx, level)
+}
+
+func (h *bridgeHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= h.level {
+		rec := &logspb.LogRecord{
+			TimeUnixNano:         uint64(r.Time.UnixNano()),
+			ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+			SeverityNumber:       severityNumber(r.Level),
+			SeverityText:         r.Level.String(),
+			Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: r.Message}},
+			Attributes:           append([]*commonpb.KeyValue(nil), h.attrs...),
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			rec.Attributes = appendAttr(rec.Attributes, h.group, a)
+			return true
+		})
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			tid, sid := sc.TraceID(), sc.SpanID()
+			rec.TraceId = tid[:]
+			rec.SpanId = sid[:]
+			rec.Flags = uint32(sc.TraceFlags())
+		}
+		h.exporter.enqueue(rec)
+	}
+	if h.local.Enabled(ctx, r.Level) {
+		return h.local.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *bridgeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	nh.local = h.local.WithAttrs(attrs)
+	nh.attrs = append([]*commonpb.KeyValue(nil), h.attrs...)
+	for _, a := range attrs {
+		nh.attrs = appendAttr(nh.attrs, h.group, a)
+	}
+	return &nh
+}
+
+func (h *bridgeHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	nh := *h
+	nh.local = h.local.WithGroup(name)
+	nh.group = h.group + name + "."
+	return &nh
+}
+
+// appendAttr flattens a slog attribute (including nested groups) into OTLP key/values.
+func appendAttr(kvs []*commonpb.KeyValue, prefix string, a slog.Attr) []*commonpb.KeyValue {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		p := prefix
+		if a.Key != "" {
+			p += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			kvs = appendAttr(kvs, p, ga)
+		}
+		return kvs
+	}
+	if a.Key == "" {
+		return kvs
+	}
+
+	var av *commonpb.AnyValue
+	switch v.Kind() {
+	case slog.KindBool:
+		av = &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.Bool()}}
+	case slog.KindInt64:
+		av = &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.Int64()}}
+	case slog.KindUint64:
+		av = &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.Uint64())}}
+	case slog.KindFloat64:
+		av = &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.Float64()}}
+	default:
+		av = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.String()}}
+	}
+	return append(kvs, &commonpb.KeyValue{Key: prefix + a.Key, Value: av})
+}
+
+// keyValues converts SDK resource attributes to their OTLP form.
+func keyValues(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		var av *commonpb.AnyValue
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			av = &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: kv.Value.AsBool()}}
+		case attribute.INT64:
+			av = &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: kv.Value.AsInt64()}}
+		case attribute.FLOAT64:
+			av = &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: kv.Value.AsFloat64()}}
+		default:
+			av = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: kv.Value.Emit()}}
+		}
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: av})
+	}
+	return out
+}
+
+// severityNumber maps slog levels onto the OTLP severity scale.
+func severityNumber(level slog.Level) logspb.SeverityNumber {
+	switch {
+	case level >= slog.LevelError:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case level >= slog.LevelWarn:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case level >= slog.LevelInfo:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	}
+}
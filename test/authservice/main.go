@@ -8,57 +8,21 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/RandomCodeSpace/otelcontext/pkg/argusotel"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var tracer trace.Tracer
 
-func initTracer() func(context.Context) error {
-	ctx := context.Background()
-
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("auth-service"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
-	}
-
-	traceClient := otlptracegrpc.NewClient(
-		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithEndpoint("localhost:4317"),
-	)
-
-	exporter, err := otlptrace.New(ctx, traceClient)
+func main() {
+	shutdown, err := argusotel.Setup(context.Background(), "auth-service", "localhost:4317", argusotel.WithInsecure())
 	if err != nil {
-		log.Fatalf("failed to create trace exporter: %v", err)
+		log.Fatalf("failed to set up OpenTelemetry: %v", err)
 	}
-
-	bsp := sdktrace.NewBatchSpanProcessor(exporter)
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSpanProcessor(bsp),
-	)
-	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-
-	return tracerProvider.Shutdown
-}
-
-func main() {
-	shutdown := initTracer()
 	defer shutdown(context.Background())
 
 	tracer = otel.Tracer("auth-service")
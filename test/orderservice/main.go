@@ -8,19 +8,12 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/RandomCodeSpace/otelcontext/pkg/argusotel"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/propagation"
-	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -29,67 +22,18 @@ var (
 	orderCounter metric.Int64Counter
 )
 
-func initOTel() func(context.Context) error {
-	ctx := context.Background()
-
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("order-service"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
-	}
-
-	// 1. Tracing Setup
-	traceClient := otlptracegrpc.NewClient(
-		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithEndpoint("localhost:4317"),
-	)
-	traceExporter, err := otlptrace.New(ctx, traceClient)
-	if err != nil {
-		log.Fatalf("failed to create trace exporter: %v", err)
-	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(traceExporter)),
-	)
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-
-	// 2. Metrics Setup
-	metricExporter, err := otlpmetricgrpc.New(ctx,
-		otlpmetricgrpc.WithInsecure(),
-		otlpmetricgrpc.WithEndpoint("localhost:4317"),
-	)
+func main() {
+	shutdown, err := argusotel.Setup(context.Background(), "order-service", "localhost:4317", argusotel.WithInsecure())
 	if err != nil {
-		log.Fatalf("failed to create metric exporter: %v", err)
+		log.Fatalf("failed to set up OpenTelemetry: %v", err)
 	}
+	defer shutdown(context.Background())
 
-	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(5*time.Second))),
-	)
-	otel.SetMeterProvider(mp)
+	tracer = otel.Tracer("order-service")
 
 	meter := otel.Meter("order-service")
 	orderCounter, _ = meter.Int64Counter("orders_processed_total", metric.WithDescription("Total number of orders processed"))
 
-	return func(ctx context.Context) error {
-		_ = tp.Shutdown(ctx)
-		_ = mp.Shutdown(ctx)
-		return nil
-	}
-}
-
-func main() {
-	shutdown := initOTel()
-	defer shutdown(context.Background())
-
-	tracer = otel.Tracer("order-service")
-
 	mux := http.NewServeMux()
 	mux.Handle("/order", otelhttp.NewHandler(http.HandlerFunc(handleOrder), "POST /order"))
 
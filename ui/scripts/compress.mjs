@@ -0,0 +1,32 @@
+// Writes .br and .gz siblings for the text assets of the production build so the Go
+// server can hand them out pre-compressed (see internal/ui/static.go).
+import { readdirSync, readFileSync, statSync, writeFileSync } from 'node:fs'
+import { join, resolve } from 'node:path'
+import { brotliCompressSync, constants, gzipSync } from 'node:zlib'
+
+const distDir = resolve(import.meta.dirname, '../../internal/ui/dist')
+const compressible = /\.(js|mjs|css|html|svg|json|txt|map)$/
+const minBytes = 1024
+
+function walk(dir) {
+  return readdirSync(dir).flatMap((name) => {
+    const path = join(dir, name)
+    return statSync(path).isDirectory() ? walk(path) : [path]
+  })
+}
+
+for (const file of walk(distDir)) {
+  if (!compressible.test(file)) continue
+  const data = readFileSync(file)
+  if (data.length < minBytes) continue
+
+  const br = brotliCompressSync(data, {
+    params: {
+      [constants.BROTLI_PARAM_QUALITY]: constants.BROTLI_MAX_QUALITY,
+      [constants.BROTLI_PARAM_SIZE_HINT]: data.length,
+    },
+  })
+  const gz = gzipSync(data, { level: 9 })
+  if (br.length < data.length) writeFileSync(`${file}.br`, br)
+  if (gz.length < data.length) writeFileSync(`${file}.gz`, gz)
+}
@@ -11,6 +11,16 @@ interface Props {
   onClearFilter: () => void
 }
 
+// formatBody pretty-prints structured (kvlist/array) bodies, which are stored as JSON.
+function formatBody(log: LogEntry): string {
+  if (log.body_type !== 'kvlist' && log.body_type !== 'array') return log.body
+  try {
+    return JSON.stringify(JSON.parse(log.body), null, 2)
+  } catch {
+    return log.body
+  }
+}
+
 export default function LogsPage({ logs, similar, loading, error, onSimilar, serviceFilter, onClearFilter }: Props) {
   const [query, setQuery] = useState('')
   const [severity, setSeverity] = useState('')
@@ -74,7 +84,7 @@ export default function LogsPage({ logs, similar, loading, error, onSimilar, ser
                 </div>
                 <span style={{ fontSize: '0.68rem', color: 'var(--text-dim)' }}>{new Date(log.timestamp).toLocaleTimeString()}</span>
               </div>
-              <div style={{ fontSize: '0.74rem', color: 'var(--text-secondary)', lineHeight: 1.6 }}>{log.body}</div>
+              <div style={{ fontSize: '0.74rem', color: 'var(--text-secondary)', lineHeight: 1.6, whiteSpace: 'pre-wrap', fontFamily: log.body_type === 'kvlist' || log.body_type === 'array' ? 'monospace' : undefined }}>{formatBody(log)}</div>
             </div>
           ))}
         </div>
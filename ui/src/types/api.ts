@@ -9,8 +9,10 @@ export interface DashboardStats {
   total_traces: number
   total_logs: number
   total_errors: number
+  rollup_errors: number
   avg_latency_ms: number
   error_rate: number
+  rollup_error_rate: number
   active_services: number
   p99_latency: number
   top_failing_services: ServiceError[]
@@ -19,27 +21,52 @@ export interface DashboardStats {
 export interface Trace {
   id: number
   trace_id: string
+  tenant_id?: string
   service_name: string
   duration: number
   duration_ms: number
   span_count: number
   operation: string
   status: string
+  has_error: boolean
   timestamp: string
   spans?: Span[]
   logs?: LogEntry[]
+  annotations?: TraceAnnotation[]
+}
+
+export interface TraceAnnotation {
+  id: number
+  trace_id: string
+  key: string
+  value: string
+  author: string
+  created_at: string
 }
 
 export interface Span {
   id: number
   trace_id: string
   span_id: string
+  tenant_id?: string
   parent_span_id: string
   operation_name: string
+  span_kind?: string
   start_time: string
   end_time: string
   duration: number
   service_name: string
+  scope_name?: string
+  scope_version?: string
+  attributes_json: string
+  links?: SpanLink[]
+}
+
+export interface SpanLink {
+  trace_id: string
+  span_id: string
+  linked_trace_id: string
+  linked_span_id: string
   attributes_json: string
 }
 
@@ -47,11 +74,27 @@ export interface LogEntry {
   id: number
   trace_id: string
   span_id: string
-  severity: string
+  tenant_id?: string
+  severity: string // TRACE, DEBUG, INFO, WARN, ERROR or FATAL
+  raw_severity?: string // as received
+  repeat_count?: number // identical records folded into this one
   body: string
+  body_type?: 'string' | 'bool' | 'int' | 'double' | 'bytes' | 'array' | 'kvlist' | 'empty' // kvlist, array and bytes bodies are JSON
+  truncated?: boolean // body cut to LOG_MAX_BODY_BYTES at ingest; GET /api/logs/{id}/raw has the stored text
+  body_preview?: boolean // body cut to a preview by GET /api/logs; GET /api/logs/{id} has all of it
   service_name: string
+  scope_name?: string
+  scope_version?: string
   attributes_json: string
   timestamp: string
+  trace?: LogTraceSummary // with include_trace_summary=true
+}
+
+export interface LogTraceSummary {
+  exists: boolean
+  duration_ms?: number
+  status?: string
+  service_name?: string
 }
 
 export interface TracesResponse {
@@ -67,6 +110,7 @@ export interface LogsResponse {
   total?: number
   limit?: number
   offset?: number
+  next_cursor?: string
 }
 
 export interface SystemNode {
@@ -118,6 +162,17 @@ export interface RepoStats {
   [key: string]: unknown
 }
 
+/** GET /api/version. ui_build also appears in /api/health; a mismatch with the value
+ *  seen when the page loaded means the server now embeds a newer frontend. */
+export interface VersionInfo {
+  version: string
+  commit: string
+  build_date: string
+  go_version: string
+  db_driver?: string
+  ui_build?: string
+}
+
 export interface MCPTool {
   name: string
   description: string
@@ -126,3 +181,13 @@ export interface MCPTool {
     required?: string[]
   }
 }
+
+export type ApiErrorCode = 'invalid_argument' | 'not_found' | 'internal' | 'unavailable' | 'rate_limited'
+
+export interface ApiErrorResponse {
+  error: {
+    code: ApiErrorCode
+    message: string
+    details?: { correlation_id?: string } & Record<string, unknown>
+  }
+}